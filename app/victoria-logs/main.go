@@ -17,6 +17,7 @@ import (
 
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlrules"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlselect"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlstorage"
 )
@@ -49,6 +50,8 @@ func main() {
 	insertutil.SetLogRowsStorage(&vlstorage.Storage{})
 	vlinsert.Init()
 
+	vlrules.Init()
+
 	go httpserver.Serve(listenAddrs, requestHandler, httpserver.ServeOptions{
 		UseProxyProtocol: useProxyProtocol,
 	})
@@ -66,6 +69,7 @@ func main() {
 	}
 	logger.Infof("successfully shut down the webservice in %.3f seconds", time.Since(startTime).Seconds())
 
+	vlrules.Stop()
 	vlinsert.Stop()
 	vlselect.Stop()
 	vlstorage.Stop()
@@ -86,10 +90,14 @@ func requestHandler(w http.ResponseWriter, r *http.Request) bool {
 		httpserver.WriteAPIHelp(w, [][2]string{
 			{"select/vmui", "Web UI for VictoriaLogs"},
 			{"metrics", "available service metrics"},
+			{"api/v1/alerts", "active alerts generated by alerting rules"},
 			{"flags", "command-line flags"},
 		})
 		return true
 	}
+	if vlrules.RequestHandler(w, r) {
+		return true
+	}
 	if vlinsert.RequestHandler(w, r) {
 		return true
 	}
@@ -0,0 +1,208 @@
+package filetail
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+var (
+	paths = flagutil.NewArrayString("fileInput.path", "Glob pattern for log files to tail; for example, -fileInput.path='/var/log/*.log'. "+
+		"See https://docs.victoriametrics.com/victorialogs/vlagent/#collecting-logs-from-files")
+	streamFields = flagutil.NewArrayString("fileInput.streamFields", `Fields to use as log stream labels for logs read from files matching the corresponding -fileInput.path; `+
+		`for example, -fileInput.streamFields='["path","app"]'. By default every file is stored in a separate log stream with the 'path' label. `+
+		`See https://docs.victoriametrics.com/victorialogs/vlagent/#collecting-logs-from-files`)
+	extraFields = flagutil.NewArrayString("fileInput.extraFields", `Fields to add to logs read from files matching the corresponding -fileInput.path; `+
+		`for example, -fileInput.extraFields='{"app":"nginx"}'. See https://docs.victoriametrics.com/victorialogs/vlagent/#collecting-logs-from-files`)
+	tenantIDs = flagutil.NewArrayString("fileInput.tenantID", "TenantID for logs read from files matching the corresponding -fileInput.path. "+
+		"See https://docs.victoriametrics.com/victorialogs/vlagent/#collecting-logs-from-files")
+	multilineStartRegexps = flagutil.NewArrayString("fileInput.multilineStartRegexp", "Optional regexp for the first line of multiline log entries "+
+		"at files matching the corresponding -fileInput.path. Lines not matching the regexp are appended to the previous line. "+
+		"See https://docs.victoriametrics.com/victorialogs/vlagent/#multiline-log-entries")
+
+	pollInterval     = flag.Duration("fileInput.pollInterval", time.Second, "The interval for discovering files matching -fileInput.path and reading new logs from them")
+	multilineTimeout = flag.Duration("fileInput.multilineTimeout", 3*time.Second, "The maximum duration to wait for the next line of the multiline log entry "+
+		"before sending it to -remoteWrite.url. See -fileInput.multilineStartRegexp")
+	startAtEnd = flag.Bool("fileInput.startAtEnd", false, "Whether to start reading files found at vlagent startup from the end if there are no saved read offsets for them. "+
+		"By default files are read from the beginning")
+)
+
+// stateFilename is the name of the file for persisting read offsets at the directory passed to MustInit.
+const stateFilename = "file-input-offsets.json"
+
+// LogRowsStorage is the storage for the logs read from files.
+type LogRowsStorage interface {
+	// MustAddRows must add lr to the storage.
+	MustAddRows(lr *logstorage.LogRows)
+}
+
+var tailer *Tailer
+
+// MustInit starts tailing files matching -fileInput.path and sending their logs to storage.
+//
+// Read offsets are persisted at the given dataPath.
+//
+// MustStop must be called for stopping the tailing.
+func MustInit(dataPath string, storage LogRowsStorage) {
+	if len(*paths) == 0 {
+		return
+	}
+
+	sources := make([]Source, 0, len(*paths))
+	for argIdx, pattern := range *paths {
+		src, err := newSource(argIdx, pattern, storage)
+		if err != nil {
+			logger.Fatalf("cannot initialize -fileInput.path=%q: %s", pattern, err)
+		}
+		sources = append(sources, src)
+	}
+
+	fs.MustMkdirIfNotExist(dataPath)
+	t, err := NewTailer(sources, &Options{
+		Name:             "file",
+		StatePath:        filepath.Join(dataPath, stateFilename),
+		StartAtEnd:       *startAtEnd,
+		MultilineTimeout: *multilineTimeout,
+		MaxEntrySize:     insertutil.MaxLineSizeBytes.IntN(),
+	})
+	if err != nil {
+		logger.Fatalf("cannot initialize tailing for -fileInput.path: %s", err)
+	}
+	t.Start(*pollInterval)
+	tailer = t
+}
+
+// MustStop stops tailing files started by MustInit.
+func MustStop() {
+	if tailer == nil {
+		return
+	}
+	tailer.MustStop()
+	tailer = nil
+}
+
+func newSource(argIdx int, pattern string, storage LogRowsStorage) (Source, error) {
+	sfs, err := ParseFieldsList(streamFields.GetOptionalArg(argIdx))
+	if err != nil {
+		return Source{}, fmt.Errorf("cannot parse -fileInput.streamFields: %w", err)
+	}
+	if sfs == nil {
+		sfs = []string{"path"}
+	}
+
+	efs, err := ParseExtraFields(extraFields.GetOptionalArg(argIdx))
+	if err != nil {
+		return Source{}, fmt.Errorf("cannot parse -fileInput.extraFields: %w", err)
+	}
+
+	tenantID, err := logstorage.ParseTenantID(tenantIDs.GetOptionalArg(argIdx))
+	if err != nil {
+		return Source{}, fmt.Errorf("cannot parse -fileInput.tenantID: %w", err)
+	}
+
+	var re *regexp.Regexp
+	if s := multilineStartRegexps.GetOptionalArg(argIdx); s != "" {
+		re, err = regexp.Compile(s)
+		if err != nil {
+			return Source{}, fmt.Errorf("cannot parse -fileInput.multilineStartRegexp: %w", err)
+		}
+	}
+
+	return Source{
+		Pattern:              pattern,
+		MultilineStartRegexp: re,
+		Handler: &logRowsHandler{
+			storage:  storage,
+			tenantID: tenantID,
+			lr:       logstorage.GetLogRows(sfs, nil, nil, efs, ""),
+		},
+	}, nil
+}
+
+// logRowsHandler sends log entries read from files to storage.
+type logRowsHandler struct {
+	storage  LogRowsStorage
+	tenantID logstorage.TenantID
+
+	lr     *logstorage.LogRows
+	fields []logstorage.Field
+}
+
+// HandleEntry implements Handler interface.
+func (h *logRowsHandler) HandleEntry(path string, entry []byte) {
+	h.fields = append(h.fields[:0], logstorage.Field{
+		Name:  "_msg",
+		Value: bytesutil.ToUnsafeString(entry),
+	}, logstorage.Field{
+		Name:  "path",
+		Value: path,
+	})
+	h.lr.MustAdd(h.tenantID, time.Now().UnixNano(), h.fields, nil)
+	if h.lr.NeedFlush() {
+		h.Flush()
+	}
+}
+
+// Flush implements Handler interface.
+func (h *logRowsHandler) Flush() {
+	if h.lr.RowsCount() == 0 {
+		return
+	}
+	h.storage.MustAddRows(h.lr)
+	h.lr.ResetKeepSettings()
+}
+
+// HandleFileClose implements Handler interface.
+func (h *logRowsHandler) HandleFileClose(_ string) {
+	// Nothing to do, since logRowsHandler doesn't hold per-file state.
+}
+
+// ParseFieldsList parses JSON array of field names from s.
+//
+// nil is returned if s is empty.
+func ParseFieldsList(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var a []string
+	err := json.Unmarshal([]byte(s), &a)
+	return a, err
+}
+
+// ParseExtraFields parses JSON object with field names and values from s.
+//
+// The returned fields are sorted by name. nil is returned if s is empty.
+func ParseExtraFields(s string) ([]logstorage.Field, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var m map[string]string
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		return nil, err
+	}
+	fields := make([]logstorage.Field, 0, len(m))
+	for k, v := range m {
+		fields = append(fields, logstorage.Field{
+			Name:  k,
+			Value: v,
+		})
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Name < fields[j].Name
+	})
+	return fields, nil
+}
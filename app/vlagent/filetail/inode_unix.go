@@ -0,0 +1,16 @@
+//go:build !windows
+
+package filetail
+
+import (
+	"os"
+	"syscall"
+)
+
+func getInode(fi os.FileInfo) uint64 {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0
+	}
+	return uint64(st.Ino)
+}
@@ -0,0 +1,14 @@
+//go:build windows
+
+package filetail
+
+import (
+	"os"
+)
+
+// getInode returns zero on Windows, since it has no inodes.
+//
+// Files are identified by their paths and fingerprints on Windows.
+func getInode(_ os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,550 @@
+package filetail
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/cespare/xxhash/v2"
+)
+
+// maxFingerprintLen is the maximum number of bytes at the beginning of the file used for detecting whether the file has been replaced.
+const maxFingerprintLen = 1024
+
+// maxReadBytesPerPoll is the maximum number of bytes to read from a single file per poll.
+//
+// This prevents from delaying the read offsets persistence and the reading of other files on big files.
+const maxReadBytesPerPoll = 16 * 1024 * 1024
+
+// Source describes a group of files to tail.
+type Source struct {
+	// Pattern is a glob pattern for the files to tail. See https://pkg.go.dev/path/filepath#Match for the supported syntax.
+	Pattern string
+
+	// MultilineStartRegexp is an optional regexp for the first line of multiline log entries.
+	//
+	// Lines not matching the regexp are appended to the previous line.
+	MultilineStartRegexp *regexp.Regexp
+
+	// Handler handles log entries read from files matching the Pattern.
+	Handler Handler
+}
+
+// Handler handles log entries read from the tailed files.
+type Handler interface {
+	// HandleEntry is called for every log entry read from the file at the given path.
+	//
+	// The entry must not be held after returning from HandleEntry.
+	HandleEntry(path string, entry []byte)
+
+	// Flush must send the entries passed to HandleEntry since the previous call to Flush to the storage.
+	//
+	// Read offsets are persisted after the call to Flush, so the flushed entries aren't read again after the restart.
+	Flush()
+
+	// HandleFileClose is called when the file at the given path is closed after it has been removed or renamed.
+	//
+	// All the entries from the file are passed to HandleEntry before the call, so the handler may release the state held for the file.
+	HandleFileClose(path string)
+}
+
+// Options contains options for the Tailer.
+type Options struct {
+	// Name is the name of the tailer. It is used in the exposed metrics.
+	Name string
+
+	// StatePath is the path to the file for persisting read offsets.
+	StatePath string
+
+	// StartAtEnd enables reading files found during the first scan from the end if there are no persisted read offsets for them.
+	StartAtEnd bool
+
+	// MultilineTimeout is the maximum duration to wait for the next line of the multiline log entry.
+	MultilineTimeout time.Duration
+
+	// MaxEntrySize is the maximum size of a single log entry. Longer entries are split into multiple entries.
+	MaxEntrySize int
+}
+
+// Tailer tails files matching the configured sources.
+type Tailer struct {
+	sources []Source
+	opts    Options
+
+	// readers contains readers for the currently tailed files.
+	readers []*fileReader
+
+	// savedStates contains read offsets loaded from opts.StatePath. It is reset after the first poll.
+	savedStates []fileState
+
+	firstPollDone bool
+
+	// lastState contains the last persisted state.
+	lastState []byte
+
+	readBuf []byte
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+
+	readBytesTotal   *metrics.Counter
+	entriesTotal     *metrics.Counter
+	rotationsTotal   *metrics.Counter
+	truncationsTotal *metrics.Counter
+	errorsTotal      *metrics.Counter
+}
+
+// fileState is the persisted read state for the tailed file.
+type fileState struct {
+	// Path is the path to the file.
+	Path string `json:"path"`
+
+	// Inode is the inode number of the file. It is always zero on systems without inodes.
+	Inode uint64 `json:"inode"`
+
+	// Fingerprint is the hash of the first FingerprintLen bytes of the file.
+	Fingerprint    uint64 `json:"fingerprint"`
+	FingerprintLen int    `json:"fingerprintLen"`
+
+	// Offset is the offset of the first log entry, which wasn't passed to Handler yet.
+	Offset int64 `json:"offset"`
+}
+
+// NewTailer returns new Tailer for the given sources.
+//
+// Call Start for starting tailing the files and MustStop for stopping it.
+func NewTailer(sources []Source, opts *Options) (*Tailer, error) {
+	for _, src := range sources {
+		if _, err := filepath.Match(src.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob pattern %q: %w", src.Pattern, err)
+		}
+	}
+	savedStates, err := readStates(opts.StatePath)
+	if err != nil {
+		return nil, err
+	}
+	name := opts.Name
+	return &Tailer{
+		sources:     sources,
+		opts:        *opts,
+		savedStates: savedStates,
+		readBuf:     make([]byte, 64*1024),
+
+		readBytesTotal:   metrics.GetOrCreateCounter(fmt.Sprintf(`vlagent_filetail_read_bytes_total{type=%q}`, name)),
+		entriesTotal:     metrics.GetOrCreateCounter(fmt.Sprintf(`vlagent_filetail_entries_total{type=%q}`, name)),
+		rotationsTotal:   metrics.GetOrCreateCounter(fmt.Sprintf(`vlagent_filetail_rotations_total{type=%q}`, name)),
+		truncationsTotal: metrics.GetOrCreateCounter(fmt.Sprintf(`vlagent_filetail_truncations_total{type=%q}`, name)),
+		errorsTotal:      metrics.GetOrCreateCounter(fmt.Sprintf(`vlagent_filetail_errors_total{type=%q}`, name)),
+	}, nil
+}
+
+func readStates(path string) ([]fileState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot read file with read offsets: %w", err)
+	}
+	var states []fileState
+	if err := json.Unmarshal(data, &states); err != nil {
+		return nil, fmt.Errorf("cannot parse file with read offsets %q: %w", path, err)
+	}
+	return states, nil
+}
+
+// Start starts tailing the files with the given pollInterval.
+func (t *Tailer) Start(pollInterval time.Duration) {
+	t.stopCh = make(chan struct{})
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+
+		t.poll()
+
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-t.stopCh:
+				return
+			case <-ticker.C:
+				t.poll()
+			}
+		}
+	}()
+}
+
+// MustStop stops tailing the files.
+//
+// Incomplete log entries are read again after the restart.
+func (t *Tailer) MustStop() {
+	close(t.stopCh)
+	t.wg.Wait()
+
+	for _, fr := range t.readers {
+		fr.close()
+	}
+	t.readers = nil
+}
+
+// poll discovers the files matching the configured sources and reads new log entries from them.
+func (t *Tailer) poll() {
+	seen := make([]bool, len(t.readers))
+	for i := range t.sources {
+		src := &t.sources[i]
+
+		// The error is impossible, since the pattern has been already verified in NewTailer.
+		paths, _ := filepath.Glob(src.Pattern)
+		for _, path := range paths {
+			fi, err := os.Stat(path)
+			if err != nil || !fi.Mode().IsRegular() {
+				continue
+			}
+			if idx := t.getReaderIndex(fi); idx >= 0 {
+				// The file is already tailed. It may be tailed under another path if it has been renamed.
+				seen[idx] = true
+				continue
+			}
+
+			fr := t.openReader(src, path)
+			if fr == nil {
+				continue
+			}
+			t.readers = append(t.readers, fr)
+			seen = append(seen, true)
+		}
+	}
+
+	now := time.Now()
+	readers := t.readers[:0]
+	for i, fr := range t.readers {
+		if !seen[i] {
+			// The file has been removed or renamed to the name, which doesn't match the configured sources.
+			// Read the remaining data from the file and close it.
+			t.readNewData(fr, true)
+			fr.flushAll()
+			fr.src.Handler.HandleFileClose(fr.path)
+			fr.close()
+			t.rotationsTotal.Inc()
+			continue
+		}
+		t.readNewData(fr, false)
+		if len(fr.pending) > 0 && now.Sub(fr.lastReadTime) >= t.opts.MultilineTimeout {
+			fr.flushPending()
+		}
+		readers = append(readers, fr)
+	}
+	clear(t.readers[len(readers):])
+	t.readers = readers
+
+	for i := range t.sources {
+		t.sources[i].Handler.Flush()
+	}
+
+	t.firstPollDone = true
+	t.savedStates = nil
+	t.mustSaveState()
+}
+
+func (t *Tailer) getReaderIndex(fi os.FileInfo) int {
+	for i, fr := range t.readers {
+		if os.SameFile(fr.fi, fi) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (t *Tailer) openReader(src *Source, path string) *fileReader {
+	f, err := os.Open(path)
+	if err != nil {
+		logger.Errorf("cannot open file for tailing: %s", err)
+		t.errorsTotal.Inc()
+		return nil
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		logger.Errorf("cannot obtain information about file %q: %s", path, err)
+		t.errorsTotal.Inc()
+		fs.MustClose(f)
+		return nil
+	}
+
+	fr := &fileReader{
+		src:          src,
+		path:         path,
+		f:            f,
+		fi:           fi,
+		maxEntrySize: t.opts.MaxEntrySize,
+		entriesTotal: t.entriesTotal,
+	}
+
+	offset := int64(0)
+	if st := t.getSavedState(fr); st != nil {
+		// Preserve the original path for the file renamed during the restart, so it remains in the same log stream.
+		fr.path = st.Path
+		offset = st.Offset
+	} else if !t.firstPollDone && t.opts.StartAtEnd {
+		offset = fi.Size()
+	}
+	if offset > 0 {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			logger.Errorf("cannot seek to offset %d at file %q: %s", offset, path, err)
+			t.errorsTotal.Inc()
+			fs.MustClose(f)
+			return nil
+		}
+	}
+	fr.offset = offset
+	return fr
+}
+
+// getSavedState returns the saved state for the file opened by fr.
+//
+// nil is returned if there is no saved state for the file.
+func (t *Tailer) getSavedState(fr *fileReader) *fileState {
+	inode := getInode(fr.fi)
+	size := fr.fi.Size()
+	var candidate *fileState
+	for i := range t.savedStates {
+		st := &t.savedStates[i]
+		if st.Inode != inode || st.Offset > size {
+			continue
+		}
+		if st.Path == fr.path {
+			candidate = st
+			break
+		}
+		if inode != 0 && st.FingerprintLen > 0 && candidate == nil {
+			// The file has been renamed during the restart.
+			candidate = st
+		}
+	}
+	if candidate == nil {
+		return nil
+	}
+	fingerprint, ok := fr.getFingerprint(candidate.FingerprintLen)
+	if !ok || fingerprint != candidate.Fingerprint {
+		return nil
+	}
+	return candidate
+}
+
+func (t *Tailer) readNewData(fr *fileReader, drain bool) {
+	if fr.isTruncated() {
+		logger.Infof("file %q has been truncated; reading it from the beginning", fr.path)
+		t.truncationsTotal.Inc()
+		fr.flushAll()
+		if _, err := fr.f.Seek(0, io.SeekStart); err != nil {
+			logger.Errorf("cannot seek to the beginning of the truncated file %q: %s", fr.path, err)
+			t.errorsTotal.Inc()
+			return
+		}
+		fr.offset = 0
+		fr.fingerprintLen = 0
+	}
+
+	bytesRead := 0
+	for drain || bytesRead < maxReadBytesPerPoll {
+		n, err := fr.f.Read(t.readBuf)
+		if n > 0 {
+			bytesRead += n
+			fr.offset += int64(n)
+			fr.lastReadTime = time.Now()
+			fr.processData(t.readBuf[:n])
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				logger.Errorf("cannot read data from file %q: %s", fr.path, err)
+				t.errorsTotal.Inc()
+			}
+			break
+		}
+		if n == 0 {
+			break
+		}
+	}
+	t.readBytesTotal.Add(bytesRead)
+}
+
+func (t *Tailer) mustSaveState() {
+	states := make([]fileState, 0, len(t.readers))
+	for _, fr := range t.readers {
+		states = append(states, fr.getState())
+	}
+	data, err := json.Marshal(states)
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal read offsets: %s", err)
+	}
+	if bytes.Equal(data, t.lastState) {
+		return
+	}
+	fs.MustWriteAtomic(t.opts.StatePath, data, true)
+	t.lastState = data
+}
+
+// fileReader reads log entries from the tailed file.
+type fileReader struct {
+	src *Source
+
+	// path is the path to the file. It is passed to Handler.
+	path string
+
+	f  *os.File
+	fi os.FileInfo
+
+	// offset is the offset of the next byte to read from f.
+	offset int64
+
+	// buf contains the incomplete line read from f.
+	buf []byte
+
+	// pending contains the multiline log entry, which may be continued by the next lines.
+	pending []byte
+
+	// pendingRawLen is the size of the lines in the pending log entry at f.
+	pendingRawLen int
+
+	// lastReadTime is the last time new data has been read from f.
+	lastReadTime time.Time
+
+	fingerprint    uint64
+	fingerprintLen int
+
+	maxEntrySize int
+	entriesTotal *metrics.Counter
+}
+
+func (fr *fileReader) close() {
+	fs.MustClose(fr.f)
+}
+
+func (fr *fileReader) processData(data []byte) {
+	fr.buf = append(fr.buf, data...)
+	b := fr.buf
+	for {
+		n := bytes.IndexByte(b, '\n')
+		if n < 0 {
+			break
+		}
+		fr.processLine(b[:n], n+1)
+		b = b[n+1:]
+	}
+	if len(b) > fr.maxEntrySize {
+		fr.processLine(b, len(b))
+		b = b[:0]
+	}
+	fr.buf = append(fr.buf[:0], b...)
+}
+
+func (fr *fileReader) processLine(line []byte, rawLen int) {
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	if len(line) > fr.maxEntrySize {
+		line = line[:fr.maxEntrySize]
+	}
+
+	re := fr.src.MultilineStartRegexp
+	if re == nil {
+		fr.emit(line)
+		return
+	}
+
+	if len(fr.pending) > 0 && !re.Match(line) && len(fr.pending)+1+len(line) <= fr.maxEntrySize {
+		fr.pending = append(fr.pending, '\n')
+		fr.pending = append(fr.pending, line...)
+		fr.pendingRawLen += rawLen
+		return
+	}
+	fr.flushPending()
+	fr.pending = append(fr.pending[:0], line...)
+	fr.pendingRawLen = rawLen
+}
+
+// flushPending passes the pending multiline log entry at fr to Handler.
+func (fr *fileReader) flushPending() {
+	if len(fr.pending) == 0 {
+		return
+	}
+	pending := fr.pending
+	fr.pending = fr.pending[:0]
+	fr.pendingRawLen = 0
+	fr.emit(pending)
+}
+
+// flushAll passes all the buffered data at fr to Handler, including the last line without the trailing newline.
+func (fr *fileReader) flushAll() {
+	if len(fr.buf) > 0 {
+		fr.processLine(fr.buf, len(fr.buf))
+		fr.buf = fr.buf[:0]
+	}
+	fr.flushPending()
+}
+
+// isTruncated returns true if the file at fr has been truncated since the last read.
+func (fr *fileReader) isTruncated() bool {
+	fi, err := fr.f.Stat()
+	if err != nil {
+		return false
+	}
+	if fi.Size() < fr.offset {
+		return true
+	}
+	if fr.fingerprintLen == 0 {
+		return false
+	}
+	// The file could be truncated and then written with more data than the read offset.
+	fingerprint, ok := fr.getFingerprint(fr.fingerprintLen)
+	return !ok || fingerprint != fr.fingerprint
+}
+
+func (fr *fileReader) emit(entry []byte) {
+	if len(entry) == 0 {
+		return
+	}
+	fr.src.Handler.HandleEntry(fr.path, entry)
+	fr.entriesTotal.Inc()
+}
+
+// getState returns the state for persisting the read offset at fr.
+func (fr *fileReader) getState() fileState {
+	offset := fr.offset - int64(len(fr.buf)) - int64(fr.pendingRawLen)
+	if fr.fingerprintLen < maxFingerprintLen && int64(fr.fingerprintLen) < fr.offset {
+		fingerprintLen := int(min(fr.offset, maxFingerprintLen))
+		if fingerprint, ok := fr.getFingerprint(fingerprintLen); ok {
+			fr.fingerprint = fingerprint
+			fr.fingerprintLen = fingerprintLen
+		}
+	}
+	return fileState{
+		Path:           fr.path,
+		Inode:          getInode(fr.fi),
+		Fingerprint:    fr.fingerprint,
+		FingerprintLen: fr.fingerprintLen,
+		Offset:         offset,
+	}
+}
+
+// getFingerprint returns the hash for the first n bytes of the file at fr.
+//
+// false is returned if the file contains less than n bytes.
+func (fr *fileReader) getFingerprint(n int) (uint64, bool) {
+	var buf [maxFingerprintLen]byte
+	if n > len(buf) {
+		return 0, false
+	}
+	if _, err := fr.f.ReadAt(buf[:n], 0); err != nil {
+		return 0, false
+	}
+	return xxhash.Sum64(buf[:n]), true
+}
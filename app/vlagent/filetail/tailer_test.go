@@ -0,0 +1,283 @@
+package filetail
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testHandler struct {
+	pending []string
+	flushed []string
+	closed  []string
+}
+
+func (h *testHandler) HandleEntry(path string, entry []byte) {
+	h.pending = append(h.pending, fmt.Sprintf("%s: %s", filepath.Base(path), entry))
+}
+
+func (h *testHandler) Flush() {
+	h.flushed = append(h.flushed, h.pending...)
+	h.pending = h.pending[:0]
+}
+
+func (h *testHandler) HandleFileClose(path string) {
+	h.closed = append(h.closed, filepath.Base(path))
+}
+
+func (h *testHandler) getFlushed() []string {
+	flushed := h.flushed
+	h.flushed = nil
+	return flushed
+}
+
+func newTestTailer(t *testing.T, dir string, multilineStartRegexp string, h *testHandler) *Tailer {
+	t.Helper()
+
+	var re *regexp.Regexp
+	if multilineStartRegexp != "" {
+		re = regexp.MustCompile(multilineStartRegexp)
+	}
+	tailer, err := NewTailer([]Source{{
+		Pattern:              filepath.Join(dir, "*.log"),
+		MultilineStartRegexp: re,
+		Handler:              h,
+	}}, &Options{
+		Name:             "test",
+		StatePath:        filepath.Join(dir, "state.json"),
+		MultilineTimeout: time.Hour,
+		MaxEntrySize:     1024,
+	})
+	if err != nil {
+		t.Fatalf("cannot create tailer: %s", err)
+	}
+	return tailer
+}
+
+func mustAppendFile(t *testing.T, path, data string) {
+	t.Helper()
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("cannot open %q: %s", path, err)
+	}
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatalf("cannot write to %q: %s", path, err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("cannot close %q: %s", path, err)
+	}
+}
+
+func checkEntries(t *testing.T, h *testHandler, entriesExpected []string) {
+	t.Helper()
+
+	entries := h.getFlushed()
+	if len(entries) == 0 && len(entriesExpected) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(entries, entriesExpected) {
+		t.Fatalf("unexpected entries\ngot\n%s\nwant\n%s", strings.Join(entries, "\n"), strings.Join(entriesExpected, "\n"))
+	}
+}
+
+func TestTailerReadLines(t *testing.T) {
+	dir := t.TempDir()
+	h := &testHandler{}
+	tailer := newTestTailer(t, dir, "", h)
+	defer tailer.MustStop()
+	tailer.stopCh = make(chan struct{})
+
+	path := filepath.Join(dir, "app.log")
+	mustAppendFile(t, path, "foo\r\nbar\n\nincomplete")
+	mustAppendFile(t, filepath.Join(dir, "app.txt"), "not matching\n")
+	tailer.poll()
+	checkEntries(t, h, []string{"app.log: foo", "app.log: bar"})
+
+	// The incomplete line is read after it is terminated with newline.
+	mustAppendFile(t, path, " line\nbaz\n")
+	tailer.poll()
+	checkEntries(t, h, []string{"app.log: incomplete line", "app.log: baz"})
+
+	// Nothing new
+	tailer.poll()
+	checkEntries(t, h, nil)
+
+	// New file
+	mustAppendFile(t, filepath.Join(dir, "other.log"), "qwe\n")
+	tailer.poll()
+	checkEntries(t, h, []string{"other.log: qwe"})
+}
+
+func TestTailerMultiline(t *testing.T) {
+	dir := t.TempDir()
+	h := &testHandler{}
+	tailer := newTestTailer(t, dir, `^\d{4}-`, h)
+	defer tailer.MustStop()
+	tailer.stopCh = make(chan struct{})
+
+	path := filepath.Join(dir, "app.log")
+	mustAppendFile(t, path, "2025-01-01 panic: foo\n\tat a.go:1\n\tat b.go:2\n2025-01-01 bar\n")
+	tailer.poll()
+	checkEntries(t, h, []string{"app.log: 2025-01-01 panic: foo\n\tat a.go:1\n\tat b.go:2"})
+
+	// The pending entry is continued by the next poll.
+	mustAppendFile(t, path, "  continued\n2025-01-02 baz\n")
+	tailer.poll()
+	checkEntries(t, h, []string{"app.log: 2025-01-01 bar\n  continued"})
+
+	// The pending entry is flushed after the timeout.
+	tailer.opts.MultilineTimeout = 0
+	tailer.poll()
+	checkEntries(t, h, []string{"app.log: 2025-01-02 baz"})
+}
+
+func TestTailerRotation(t *testing.T) {
+	dir := t.TempDir()
+	h := &testHandler{}
+	tailer := newTestTailer(t, dir, "", h)
+	defer tailer.MustStop()
+	tailer.stopCh = make(chan struct{})
+
+	path := filepath.Join(dir, "app.log")
+	mustAppendFile(t, path, "foo\n")
+	tailer.poll()
+	checkEntries(t, h, []string{"app.log: foo"})
+
+	// Rename the file to the name, which doesn't match the pattern, and create a new file.
+	// The remaining data from the renamed file must be read.
+	mustAppendFile(t, path, "bar\nlast")
+	if err := os.Rename(path, filepath.Join(dir, "app.log.1")); err != nil {
+		t.Fatalf("cannot rename file: %s", err)
+	}
+	mustAppendFile(t, path, "new\n")
+	tailer.poll()
+	checkEntries(t, h, []string{"app.log: bar", "app.log: last", "app.log: new"})
+	if !reflect.DeepEqual(h.closed, []string{"app.log"}) {
+		t.Fatalf("unexpected closed files; got %q; want %q", h.closed, []string{"app.log"})
+	}
+	if n := len(tailer.readers); n != 1 {
+		t.Fatalf("unexpected number of readers; got %d; want 1", n)
+	}
+
+	// Rename the file to the name matching the pattern. It must be read without duplicates.
+	mustAppendFile(t, path, "baz\n")
+	if err := os.Rename(path, filepath.Join(dir, "renamed.log")); err != nil {
+		t.Fatalf("cannot rename file: %s", err)
+	}
+	mustAppendFile(t, path, "qwe\n")
+	tailer.poll()
+	checkEntries(t, h, []string{"app.log: baz", "app.log: qwe"})
+
+	// Remove the file
+	if err := os.Remove(filepath.Join(dir, "renamed.log")); err != nil {
+		t.Fatalf("cannot remove file: %s", err)
+	}
+	tailer.poll()
+	checkEntries(t, h, nil)
+	if !reflect.DeepEqual(h.closed, []string{"app.log", "app.log"}) {
+		t.Fatalf("unexpected closed files; got %q; want %q", h.closed, []string{"app.log", "app.log"})
+	}
+	if n := len(tailer.readers); n != 1 {
+		t.Fatalf("unexpected number of readers; got %d; want 1", n)
+	}
+}
+
+func TestTailerTruncation(t *testing.T) {
+	dir := t.TempDir()
+	h := &testHandler{}
+	tailer := newTestTailer(t, dir, "", h)
+	defer tailer.MustStop()
+	tailer.stopCh = make(chan struct{})
+
+	path := filepath.Join(dir, "app.log")
+	mustAppendFile(t, path, "foo\nbar\n")
+	tailer.poll()
+	checkEntries(t, h, []string{"app.log: foo", "app.log: bar"})
+
+	// Truncate the file
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatalf("cannot truncate file: %s", err)
+	}
+	mustAppendFile(t, path, "a\n")
+	tailer.poll()
+	checkEntries(t, h, []string{"app.log: a"})
+
+	// Truncate the file and write more data than it had before the truncation
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatalf("cannot truncate file: %s", err)
+	}
+	mustAppendFile(t, path, "bbb\nccc\n")
+	tailer.poll()
+	checkEntries(t, h, []string{"app.log: bbb", "app.log: ccc"})
+}
+
+func TestTailerRestart(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	mustAppendFile(t, path, "foo\n2025 bar\n")
+
+	h := &testHandler{}
+	tailer := newTestTailer(t, dir, `^2025`, h)
+	tailer.stopCh = make(chan struct{})
+	tailer.poll()
+	checkEntries(t, h, []string{"app.log: foo"})
+	tailer.MustStop()
+
+	// The pending multiline entry must be read again after the restart.
+	mustAppendFile(t, path, "  continued\n2025 baz\n")
+	tailer = newTestTailer(t, dir, `^2025`, h)
+	tailer.stopCh = make(chan struct{})
+	tailer.poll()
+	checkEntries(t, h, []string{"app.log: 2025 bar\n  continued"})
+	tailer.MustStop()
+
+	// The file renamed during the restart must be read from the saved offset under the original path.
+	mustAppendFile(t, path, "  qwe\n")
+	if err := os.Rename(path, filepath.Join(dir, "renamed.log")); err != nil {
+		t.Fatalf("cannot rename file: %s", err)
+	}
+	tailer = newTestTailer(t, dir, `^2025`, h)
+	tailer.stopCh = make(chan struct{})
+	tailer.opts.MultilineTimeout = 0
+	tailer.poll()
+	tailer.poll()
+	checkEntries(t, h, []string{"app.log: 2025 baz\n  qwe"})
+	tailer.MustStop()
+
+	// The file replaced during the restart must be read from the beginning.
+	if err := os.Remove(filepath.Join(dir, "renamed.log")); err != nil {
+		t.Fatalf("cannot remove file: %s", err)
+	}
+	mustAppendFile(t, path, "2025 new\n")
+	tailer = newTestTailer(t, dir, "", h)
+	tailer.stopCh = make(chan struct{})
+	tailer.poll()
+	checkEntries(t, h, []string{"app.log: 2025 new"})
+	tailer.MustStop()
+}
+
+func TestTailerStartAtEnd(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	mustAppendFile(t, path, "old\n")
+
+	h := &testHandler{}
+	tailer := newTestTailer(t, dir, "", h)
+	defer tailer.MustStop()
+	tailer.stopCh = make(chan struct{})
+	tailer.opts.StartAtEnd = true
+	tailer.poll()
+	checkEntries(t, h, nil)
+
+	// Files created after the first poll are read from the beginning.
+	mustAppendFile(t, path, "new\n")
+	mustAppendFile(t, filepath.Join(dir, "other.log"), "other\n")
+	tailer.poll()
+	checkEntries(t, h, []string{"app.log: new", "other.log: other"})
+}
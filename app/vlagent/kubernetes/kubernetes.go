@@ -0,0 +1,450 @@
+package kubernetes
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/valyala/fastjson"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlagent/filetail"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+var (
+	enable = flag.Bool("kubernetes.enable", false, "Whether to collect logs from Kubernetes containers running at the current node. "+
+		"See https://docs.victoriametrics.com/victorialogs/vlagent/#collecting-logs-from-kubernetes")
+	logsDir      = flag.String("kubernetes.logsDir", "/var/log/pods", "Path to the directory with Kubernetes container logs if -kubernetes.enable is set")
+	pollInterval = flag.Duration("kubernetes.pollInterval", time.Second, "The interval for discovering new container log files at -kubernetes.logsDir and reading new logs from them")
+	startAtEnd   = flag.Bool("kubernetes.startAtEnd", false, "Whether to start reading container log files found at vlagent startup from the end if there are no saved read offsets for them. "+
+		"By default the files are read from the beginning")
+
+	metadataURL = flag.String("kubernetes.metadataURL", "", "Optional URL for obtaining pod metadata such as labels. It must return PodList in JSON; "+
+		"for example, kubelet /pods endpoint such as https://node-ip:10250/pods or Kubernetes API server /api/v1/pods endpoint. "+
+		"By default Kubernetes API server is used with the pods filtered by -kubernetes.nodeName when vlagent runs inside Kubernetes. "+
+		"See https://docs.victoriametrics.com/victorialogs/vlagent/#kubernetes-metadata")
+	nodeName = flag.String("kubernetes.nodeName", "", "The name of the Kubernetes node where vlagent runs. It is used for obtaining metadata for pods at the node "+
+		"from Kubernetes API server if -kubernetes.metadataURL isn't set")
+	metadataRefreshInterval = flag.Duration("kubernetes.metadataRefreshInterval", 30*time.Second, "The interval for refreshing pod metadata from -kubernetes.metadataURL")
+	bearerTokenFile         = flag.String("kubernetes.bearerTokenFile", "", "Optional path to bearer token file for -kubernetes.metadataURL. "+
+		"By default the service account token is used when vlagent runs inside Kubernetes")
+	tlsCAFile = flag.String("kubernetes.tlsCAFile", "", "Optional path to TLS CA file for verifying -kubernetes.metadataURL. "+
+		"By default the service account CA is used when vlagent runs inside Kubernetes")
+	tlsInsecureSkipVerify = flag.Bool("kubernetes.tlsInsecureSkipVerify", false, "Whether to skip TLS verification when connecting to -kubernetes.metadataURL")
+
+	tenantID     = flag.String("kubernetes.tenantID", "", "TenantID for logs collected from Kubernetes containers")
+	streamFields = flag.String("kubernetes.streamFields", "", `Fields to use as log stream labels for logs collected from Kubernetes containers; `+
+		`for example, -kubernetes.streamFields='["kubernetes.pod_namespace","kubernetes.pod_labels.app"]'. `+
+		`By default kubernetes.pod_namespace, kubernetes.pod_name and kubernetes.container_name fields are used`)
+	ignoreFields = flag.String("kubernetes.ignoreFields", "", `Fields to ignore at logs collected from Kubernetes containers; `+
+		`for example, -kubernetes.ignoreFields='["kubernetes.pod_labels.pod-template-hash"]'`)
+	extraFields = flag.String("kubernetes.extraFields", "", `Fields to add to logs collected from Kubernetes containers; `+
+		`for example, -kubernetes.extraFields='{"cluster":"prod"}'`)
+)
+
+// stateFilename is the name of the file for persisting read offsets at the directory passed to MustInit.
+const stateFilename = "kubernetes-offsets.json"
+
+const (
+	serviceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	serviceAccountCAPath    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+var (
+	tailer  *filetail.Tailer
+	handler *logsHandler
+)
+
+// MustInit starts collecting Kubernetes container logs from -kubernetes.logsDir if -kubernetes.enable is set.
+//
+// Read offsets are persisted at the given dataPath.
+//
+// MustStop must be called for stopping the collection.
+func MustInit(dataPath string) {
+	if !*enable {
+		return
+	}
+
+	cp, err := getCommonParams()
+	if err != nil {
+		logger.Fatalf("cannot initialize Kubernetes logs collection: %s", err)
+	}
+	ms, err := getMetadataSource()
+	if err != nil {
+		logger.Fatalf("cannot initialize Kubernetes metadata source: %s", err)
+	}
+	h := newLogsHandler(cp, ms)
+
+	fs.MustMkdirIfNotExist(dataPath)
+	t, err := filetail.NewTailer([]filetail.Source{{
+		Pattern: filepath.Join(*logsDir, "*", "*", "*.log"),
+		Handler: h,
+	}}, &filetail.Options{
+		Name:             "kubernetes",
+		StatePath:        filepath.Join(dataPath, stateFilename),
+		StartAtEnd:       *startAtEnd,
+		MultilineTimeout: time.Second,
+		MaxEntrySize:     insertutil.MaxLineSizeBytes.IntN(),
+	})
+	if err != nil {
+		logger.Fatalf("cannot initialize tailing for -kubernetes.logsDir=%q: %s", *logsDir, err)
+	}
+	t.Start(*pollInterval)
+
+	tailer = t
+	handler = h
+}
+
+// MustStop stops collecting Kubernetes container logs started by MustInit.
+func MustStop() {
+	if tailer == nil {
+		return
+	}
+	tailer.MustStop()
+	tailer = nil
+
+	// Send the remaining partial log lines, since their read offsets are already persisted, so they aren't read again after the restart.
+	handler.flushPartials("")
+	handler.lmp.MustClose()
+	handler = nil
+}
+
+func getCommonParams() (*insertutil.CommonParams, error) {
+	tid, err := logstorage.ParseTenantID(*tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -kubernetes.tenantID: %w", err)
+	}
+	sfs, err := filetail.ParseFieldsList(*streamFields)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -kubernetes.streamFields: %w", err)
+	}
+	if sfs == nil {
+		sfs = []string{
+			"kubernetes.pod_namespace",
+			"kubernetes.pod_name",
+			"kubernetes.container_name",
+		}
+	}
+	ifs, err := filetail.ParseFieldsList(*ignoreFields)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -kubernetes.ignoreFields: %w", err)
+	}
+	efs, err := filetail.ParseExtraFields(*extraFields)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -kubernetes.extraFields: %w", err)
+	}
+	return insertutil.NewCommonParams(tid, nil, nil, sfs, ifs, nil, efs), nil
+}
+
+// getMetadataSource returns metadata source configured via command-line flags.
+//
+// nil is returned if pod metadata cannot be obtained.
+func getMetadataSource() (*metadataSource, error) {
+	u := *metadataURL
+	tokenFile := *bearerTokenFile
+	caFile := *tlsCAFile
+	if u == "" {
+		host := os.Getenv("KUBERNETES_SERVICE_HOST")
+		port := os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			logger.Infof("pod metadata isn't collected, since -kubernetes.metadataURL isn't set and vlagent runs outside Kubernetes")
+			return nil, nil
+		}
+		if *nodeName == "" {
+			return nil, fmt.Errorf("-kubernetes.nodeName must be set when -kubernetes.metadataURL isn't set")
+		}
+		u = fmt.Sprintf("https://%s/api/v1/pods?fieldSelector=%s", net.JoinHostPort(host, port), url.QueryEscape("spec.nodeName="+*nodeName))
+		if tokenFile == "" {
+			tokenFile = serviceAccountTokenPath
+		}
+		if caFile == "" {
+			caFile = serviceAccountCAPath
+		}
+	}
+
+	opts := &promauth.Options{
+		BearerTokenFile: tokenFile,
+		TLSConfig: &promauth.TLSConfig{
+			CAFile:             caFile,
+			InsecureSkipVerify: *tlsInsecureSkipVerify,
+		},
+	}
+	ac, err := opts.NewConfig()
+	if err != nil {
+		return nil, fmt.Errorf("cannot initialize auth config for -kubernetes.metadataURL: %w", err)
+	}
+	tr := httputil.NewTransport(false, "vlagent_kubernetes_metadata")
+	c := &http.Client{
+		Transport: ac.NewRoundTripper(tr),
+		Timeout:   30 * time.Second,
+	}
+	return newMetadataSource(u, c, ac, *metadataRefreshInterval), nil
+}
+
+// logsHandler parses container log lines and sends them to the storage via insertutil.LogMessageProcessor.
+//
+// It implements filetail.Handler interface.
+type logsHandler struct {
+	cp  *insertutil.CommonParams
+	lmp insertutil.LogMessageProcessor
+
+	// ms is the source for pod metadata. It is nil if pod metadata is unavailable.
+	ms *metadataSource
+
+	maxEntrySize int
+
+	// partials contains partial log lines keyed by the log file path and the stream name.
+	//
+	// Partial log lines for the file are sent to the storage when the file is closed or when the handler is stopped.
+	partials map[string]*partialLine
+
+	p      fastjson.Parser
+	fields []logstorage.Field
+
+	parseErrors *metrics.Counter
+}
+
+type partialLine struct {
+	path   string
+	stream string
+
+	timestamp int64
+	msg       []byte
+}
+
+func newLogsHandler(cp *insertutil.CommonParams, ms *metadataSource) *logsHandler {
+	return &logsHandler{
+		cp:           cp,
+		lmp:          cp.NewLogMessageProcessor("kubernetes", false),
+		ms:           ms,
+		maxEntrySize: insertutil.MaxLineSizeBytes.IntN(),
+		partials:     make(map[string]*partialLine),
+
+		parseErrors: metrics.GetOrCreateCounter(`vlagent_kubernetes_parse_errors_total`),
+	}
+}
+
+var parseErrorLogger = logger.WithThrottler("kubernetes_parse_error", 5*time.Second)
+
+// HandleEntry implements filetail.Handler interface.
+func (h *logsHandler) HandleEntry(path string, entry []byte) {
+	plp, ok := parsePodLogPath(path)
+	if !ok {
+		parseErrorLogger.Warnf("cannot parse pod info from the container log path %q", path)
+		h.parseErrors.Inc()
+		return
+	}
+
+	var line containerLogLine
+	var err error
+	if entry[0] == '{' {
+		err = line.parseDockerJSON(&h.p, entry)
+	} else {
+		err = line.parseCRI(entry)
+	}
+	if err != nil {
+		parseErrorLogger.Warnf("cannot parse container log line at %q: %s; line: %q", path, err, entry)
+		h.parseErrors.Inc()
+		return
+	}
+
+	key := path + "\x00" + line.stream
+	pl := h.partials[key]
+	if line.isPartial {
+		if pl == nil {
+			pl = &partialLine{
+				path:      path,
+				stream:    line.stream,
+				timestamp: line.timestamp,
+			}
+			h.partials[key] = pl
+		}
+		pl.msg = append(pl.msg, line.msg...)
+		if len(pl.msg) < h.maxEntrySize {
+			return
+		}
+		// Too long line. Send it in chunks.
+		line.msg = nil
+	}
+	if pl != nil {
+		delete(h.partials, key)
+		pl.msg = append(pl.msg, line.msg...)
+		line.msg = pl.msg
+		line.timestamp = pl.timestamp
+	}
+
+	h.addRow(plp, &line)
+}
+
+func (h *logsHandler) addRow(plp *podLogPath, line *containerLogLine) {
+	fields := append(h.fields[:0], logstorage.Field{
+		Name:  "_msg",
+		Value: bytesutil.ToUnsafeString(line.msg),
+	}, logstorage.Field{
+		Name:  "stream",
+		Value: line.stream,
+	}, logstorage.Field{
+		Name:  "kubernetes.pod_namespace",
+		Value: plp.namespace,
+	}, logstorage.Field{
+		Name:  "kubernetes.pod_name",
+		Value: plp.podName,
+	}, logstorage.Field{
+		Name:  "kubernetes.pod_uid",
+		Value: plp.podUID,
+	}, logstorage.Field{
+		Name:  "kubernetes.container_name",
+		Value: plp.containerName,
+	})
+	if h.ms != nil {
+		if pm := h.ms.getPodMetadata(plp.podUID); pm != nil {
+			if image := pm.containerImages[plp.containerName]; image != "" {
+				fields = append(fields, logstorage.Field{
+					Name:  "kubernetes.container_image",
+					Value: image,
+				})
+			}
+			fields = append(fields, pm.fields...)
+		}
+	}
+	h.fields = fields
+
+	h.lmp.AddRow(line.timestamp, fields, nil)
+}
+
+// Flush implements filetail.Handler interface.
+func (h *logsHandler) Flush() {
+	h.lmp.MustClose()
+	h.lmp = h.cp.NewLogMessageProcessor("kubernetes", false)
+}
+
+// HandleFileClose implements filetail.Handler interface.
+func (h *logsHandler) HandleFileClose(path string) {
+	h.flushPartials(path)
+}
+
+// flushPartials sends partial log lines for the file at the given path to the storage.
+//
+// Partial log lines for all the files are sent if path is empty.
+func (h *logsHandler) flushPartials(path string) {
+	for key, pl := range h.partials {
+		if path != "" && pl.path != path {
+			continue
+		}
+		delete(h.partials, key)
+
+		plp, ok := parsePodLogPath(pl.path)
+		if !ok {
+			// This cannot happen, since partial lines are registered only for valid paths.
+			continue
+		}
+		line := containerLogLine{
+			timestamp: pl.timestamp,
+			stream:    pl.stream,
+			msg:       pl.msg,
+		}
+		h.addRow(plp, &line)
+	}
+}
+
+// containerLogLine is a parsed line from the container log file.
+type containerLogLine struct {
+	timestamp int64
+	stream    string
+	isPartial bool
+	msg       []byte
+}
+
+// parseCRI parses the line in CRI format: `<timestamp> <stream> <tag> <message>`, where tag is `P` for partial lines and `F` for full lines.
+//
+// See https://github.com/kubernetes/design-proposals-archive/blob/main/node/kubelet-cri-logging.md
+func (line *containerLogLine) parseCRI(b []byte) error {
+	n := bytes.IndexByte(b, ' ')
+	if n < 0 {
+		return fmt.Errorf("missing stream name")
+	}
+	timestamp, err := parseTimestamp(b[:n])
+	if err != nil {
+		return err
+	}
+	b = b[n+1:]
+
+	n = bytes.IndexByte(b, ' ')
+	if n < 0 {
+		return fmt.Errorf("missing tag")
+	}
+	stream := getStreamName(b[:n])
+	b = b[n+1:]
+
+	tag := b
+	msg := b[len(b):]
+	if n := bytes.IndexByte(b, ' '); n >= 0 {
+		tag = b[:n]
+		msg = b[n+1:]
+	}
+	if len(tag) == 0 {
+		return fmt.Errorf("missing tag")
+	}
+
+	line.timestamp = timestamp
+	line.stream = stream
+	// The tag may contain multiple values delimited by ':' in the future. The first value is P or F.
+	line.isPartial = tag[0] == 'P'
+	line.msg = msg
+	return nil
+}
+
+// parseDockerJSON parses the line in Docker json-file format: `{"log":"<message>\n","stream":"<stream>","time":"<timestamp>"}`.
+//
+// Partial lines do not end with newline.
+//
+// See https://docs.docker.com/engine/logging/drivers/json-file/
+func (line *containerLogLine) parseDockerJSON(p *fastjson.Parser, b []byte) error {
+	v, err := p.ParseBytes(b)
+	if err != nil {
+		return fmt.Errorf("cannot parse JSON: %w", err)
+	}
+	timestamp, err := parseTimestamp(v.GetStringBytes("time"))
+	if err != nil {
+		return err
+	}
+	msg := v.GetStringBytes("log")
+
+	line.timestamp = timestamp
+	line.stream = getStreamName(v.GetStringBytes("stream"))
+	line.isPartial = len(msg) == 0 || msg[len(msg)-1] != '\n'
+	line.msg = bytes.TrimSuffix(msg, []byte("\n"))
+	return nil
+}
+
+func parseTimestamp(b []byte) (int64, error) {
+	t, err := time.Parse(time.RFC3339Nano, bytesutil.ToUnsafeString(b))
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse timestamp %q: %w", b, err)
+	}
+	return t.UnixNano(), nil
+}
+
+func getStreamName(b []byte) string {
+	switch string(b) {
+	case "stdout":
+		return "stdout"
+	case "stderr":
+		return "stderr"
+	default:
+		return string(b)
+	}
+}
@@ -0,0 +1,264 @@
+package kubernetes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+	"github.com/valyala/fastjson"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlagent/filetail"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestParsePodLogPath(t *testing.T) {
+	f := func(path string, resultExpected *podLogPath) {
+		t.Helper()
+
+		result, ok := parsePodLogPath(path)
+		if resultExpected == nil {
+			if ok {
+				t.Fatalf("expecting failure for %q; got %+v", path, result)
+			}
+			return
+		}
+		if !ok {
+			t.Fatalf("cannot parse %q", path)
+		}
+		if *result != *resultExpected {
+			t.Fatalf("unexpected result for %q; got %+v; want %+v", path, result, resultExpected)
+		}
+	}
+
+	f("/var/log/pods/default_nginx-7d9f8_0a1b2c3d/nginx/0.log", &podLogPath{
+		namespace:     "default",
+		podName:       "nginx-7d9f8",
+		podUID:        "0a1b2c3d",
+		containerName: "nginx",
+	})
+	f("pods/kube-system_coredns_123/coredns/12.log", &podLogPath{
+		namespace:     "kube-system",
+		podName:       "coredns",
+		podUID:        "123",
+		containerName: "coredns",
+	})
+
+	// invalid paths
+	f("0.log", nil)
+	f("/var/log/pods/nginx/0.log", nil)
+	f("/var/log/pods/default_nginx/nginx/0.log", nil)
+}
+
+func TestContainerLogLineParseSuccess(t *testing.T) {
+	f := func(s string, timestampExpected int64, streamExpected string, isPartialExpected bool, msgExpected string) {
+		t.Helper()
+
+		var line containerLogLine
+		var err error
+		if strings.HasPrefix(s, "{") {
+			var p fastjson.Parser
+			err = line.parseDockerJSON(&p, []byte(s))
+		} else {
+			err = line.parseCRI([]byte(s))
+		}
+		if err != nil {
+			t.Fatalf("unexpected error when parsing %q: %s", s, err)
+		}
+		if line.timestamp != timestampExpected {
+			t.Fatalf("unexpected timestamp; got %d; want %d", line.timestamp, timestampExpected)
+		}
+		if line.stream != streamExpected {
+			t.Fatalf("unexpected stream; got %q; want %q", line.stream, streamExpected)
+		}
+		if line.isPartial != isPartialExpected {
+			t.Fatalf("unexpected isPartial; got %v; want %v", line.isPartial, isPartialExpected)
+		}
+		if string(line.msg) != msgExpected {
+			t.Fatalf("unexpected msg; got %q; want %q", line.msg, msgExpected)
+		}
+	}
+
+	// CRI format
+	f("2025-01-02T03:04:05.123456789Z stdout F foo bar", 1735787045123456789, "stdout", false, "foo bar")
+	f("2025-01-02T03:04:05Z stderr P foo ", 1735787045000000000, "stderr", true, "foo ")
+	f("2025-01-02T03:04:05+01:00 stdout F", 1735783445000000000, "stdout", false, "")
+	f("2025-01-02T03:04:05Z stdout F:x foo", 1735787045000000000, "stdout", false, "foo")
+
+	// Docker json-file format
+	f(`{"log":"foo bar\n","stream":"stdout","time":"2025-01-02T03:04:05.123456789Z"}`, 1735787045123456789, "stdout", false, "foo bar")
+	f(`{"log":"foo","stream":"stderr","time":"2025-01-02T03:04:05Z"}`, 1735787045000000000, "stderr", true, "foo")
+}
+
+func TestContainerLogLineParseFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+
+		var line containerLogLine
+		var err error
+		if strings.HasPrefix(s, "{") {
+			var p fastjson.Parser
+			err = line.parseDockerJSON(&p, []byte(s))
+		} else {
+			err = line.parseCRI([]byte(s))
+		}
+		if err == nil {
+			t.Fatalf("expecting non-nil error when parsing %q", s)
+		}
+	}
+
+	// CRI format
+	f("foo")
+	f("2025-01-02T03:04:05Z stdout")
+	f("2025-01-02T03:04:05Z stdout ")
+	f("foobar stdout F foo")
+
+	// Docker json-file format
+	f(`{"log":"foo\n"`)
+	f(`{"log":"foo\n","stream":"stdout"}`)
+	f(`{"log":"foo\n","stream":"stdout","time":"foobar"}`)
+}
+
+type testStorage struct {
+	mu   sync.Mutex
+	rows []string
+}
+
+func (s *testStorage) MustAddRows(lr *logstorage.LogRows) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := 0; i < lr.RowsCount(); i++ {
+		s.rows = append(s.rows, lr.GetRowString(i))
+	}
+}
+
+func (s *testStorage) CanWriteData() error {
+	return nil
+}
+
+func (s *testStorage) CanWriteTenantData(_ logstorage.TenantID) error {
+	return nil
+}
+
+func TestCollectLogs(t *testing.T) {
+	var requests int
+	podList, err := os.ReadFile("testdata/podlist.json")
+	if err != nil {
+		t.Fatalf("cannot read pod list: %s", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if auth := r.Header.Get("Authorization"); auth != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(podList)
+	}))
+	defer srv.Close()
+
+	opts := &promauth.Options{
+		BearerToken: "secret",
+	}
+	ac, err := opts.NewConfig()
+	if err != nil {
+		t.Fatalf("cannot create auth config: %s", err)
+	}
+	ms := newMetadataSource(srv.URL, srv.Client(), ac, time.Hour)
+
+	s := &testStorage{}
+	insertutil.SetLogRowsStorage(s)
+	defer insertutil.SetLogRowsStorage(nil)
+
+	cp := insertutil.NewCommonParams(logstorage.TenantID{}, nil, nil, []string{"kubernetes.pod_namespace", "kubernetes.pod_name", "kubernetes.container_name"},
+		[]string{"kubernetes.pod_labels.pod-template-hash"}, nil, nil)
+	h := newLogsHandler(cp, ms)
+	tailer, err := filetail.NewTailer([]filetail.Source{{
+		Pattern: filepath.Join("testdata", "pods", "*", "*", "*.log"),
+		Handler: h,
+	}}, &filetail.Options{
+		Name:             "kubernetes_test",
+		StatePath:        filepath.Join(t.TempDir(), stateFilename),
+		MultilineTimeout: time.Second,
+		MaxEntrySize:     1024,
+	})
+	if err != nil {
+		t.Fatalf("cannot create tailer: %s", err)
+	}
+	tailer.Start(time.Hour)
+	tailer.MustStop()
+	h.lmp.MustClose()
+
+	rows := s.rows
+	sort.Strings(rows)
+	result := strings.Join(rows, "\n")
+	resultExpected := `{"_msg":"GET / 200","_stream":"{kubernetes.container_name=\"nginx\",kubernetes.pod_name=\"nginx-7d9f8\",kubernetes.pod_namespace=\"default\"}","_time":"2025-01-02T03:04:05.123456789Z","kubernetes.container_image":"nginx:1.27","kubernetes.container_name":"nginx","kubernetes.pod_labels.app":"nginx","kubernetes.pod_name":"nginx-7d9f8","kubernetes.pod_namespace":"default","kubernetes.pod_node_name":"node-1","kubernetes.pod_uid":"0a1b2c3d-0000-0000-0000-000000000001","stream":"stdout"}
+{"_msg":"[INFO] plugin/reload: Running configuration","_stream":"{kubernetes.container_name=\"coredns\",kubernetes.pod_name=\"coredns-5d78c\",kubernetes.pod_namespace=\"kube-system\"}","_time":"2025-01-02T03:04:05Z","kubernetes.container_name":"coredns","kubernetes.pod_name":"coredns-5d78c","kubernetes.pod_namespace":"kube-system","kubernetes.pod_uid":"0a1b2c3d-0000-0000-0000-000000000002","stream":"stdout"}
+{"_msg":"error line","_stream":"{kubernetes.container_name=\"nginx\",kubernetes.pod_name=\"nginx-7d9f8\",kubernetes.pod_namespace=\"default\"}","_time":"2025-01-02T03:04:07Z","kubernetes.container_image":"nginx:1.27","kubernetes.container_name":"nginx","kubernetes.pod_labels.app":"nginx","kubernetes.pod_name":"nginx-7d9f8","kubernetes.pod_namespace":"default","kubernetes.pod_node_name":"node-1","kubernetes.pod_uid":"0a1b2c3d-0000-0000-0000-000000000001","stream":"stderr"}
+{"_msg":"first part, second part","_stream":"{kubernetes.container_name=\"nginx\",kubernetes.pod_name=\"nginx-7d9f8\",kubernetes.pod_namespace=\"default\"}","_time":"2025-01-02T03:04:06Z","kubernetes.container_image":"nginx:1.27","kubernetes.container_name":"nginx","kubernetes.pod_labels.app":"nginx","kubernetes.pod_name":"nginx-7d9f8","kubernetes.pod_namespace":"default","kubernetes.pod_node_name":"node-1","kubernetes.pod_uid":"0a1b2c3d-0000-0000-0000-000000000001","stream":"stdout"}
+{"_msg":"partial line","_stream":"{kubernetes.container_name=\"coredns\",kubernetes.pod_name=\"coredns-5d78c\",kubernetes.pod_namespace=\"kube-system\"}","_time":"2025-01-02T03:04:06Z","kubernetes.container_name":"coredns","kubernetes.pod_name":"coredns-5d78c","kubernetes.pod_namespace":"kube-system","kubernetes.pod_uid":"0a1b2c3d-0000-0000-0000-000000000002","stream":"stderr"}`
+	if result != resultExpected {
+		t.Fatalf("unexpected rows\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+
+	// The pod list must be requested once, since the metadata for unknown pods is refreshed no more frequently than minRefreshInterval.
+	if requests != 1 {
+		t.Fatalf("unexpected number of requests to the metadata source; got %d; want 1", requests)
+	}
+}
+
+func TestLogsHandlerFlushPartials(t *testing.T) {
+	s := &testStorage{}
+	insertutil.SetLogRowsStorage(s)
+	defer insertutil.SetLogRowsStorage(nil)
+
+	cp := insertutil.NewCommonParams(logstorage.TenantID{}, nil, nil, []string{"kubernetes.pod_name"}, nil, nil, nil)
+	h := newLogsHandler(cp, nil)
+
+	path1 := "/var/log/pods/default_app-1_0a1b2c3d-0000-0000-0000-000000000001/app/0.log"
+	path2 := "/var/log/pods/default_app-2_0a1b2c3d-0000-0000-0000-000000000002/app/0.log"
+	h.HandleEntry(path1, []byte("2025-01-02T03:04:05Z stdout P first "))
+	h.HandleEntry(path2, []byte("2025-01-02T03:04:06Z stderr P second "))
+
+	checkRows := func(rowsExpected []string) {
+		t.Helper()
+
+		h.Flush()
+		rows := s.rows
+		s.rows = nil
+		if !reflect.DeepEqual(rows, rowsExpected) {
+			t.Fatalf("unexpected rows\ngot\n%s\nwant\n%s", strings.Join(rows, "\n"), strings.Join(rowsExpected, "\n"))
+		}
+	}
+
+	// Partial lines must be buffered until the full line is received.
+	checkRows(nil)
+
+	// Partial lines for the closed file must be flushed.
+	h.HandleFileClose(path1)
+	checkRows([]string{
+		`{"_msg":"first ","_stream":"{kubernetes.pod_name=\"app-1\"}","_time":"2025-01-02T03:04:05Z","kubernetes.container_name":"app","kubernetes.pod_name":"app-1","kubernetes.pod_namespace":"default","kubernetes.pod_uid":"0a1b2c3d-0000-0000-0000-000000000001","stream":"stdout"}`,
+	})
+	if len(h.partials) != 1 {
+		t.Fatalf("unexpected number of partial lines; got %d; want 1", len(h.partials))
+	}
+
+	// The remaining partial lines must be flushed on stop.
+	h.flushPartials("")
+	checkRows([]string{
+		`{"_msg":"second ","_stream":"{kubernetes.pod_name=\"app-2\"}","_time":"2025-01-02T03:04:06Z","kubernetes.container_name":"app","kubernetes.pod_name":"app-2","kubernetes.pod_namespace":"default","kubernetes.pod_uid":"0a1b2c3d-0000-0000-0000-000000000002","stream":"stderr"}`,
+	})
+	if len(h.partials) != 0 {
+		t.Fatalf("unexpected number of partial lines; got %d; want 0", len(h.partials))
+	}
+	h.lmp.MustClose()
+}
@@ -0,0 +1,204 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+// minRefreshInterval is the minimum interval between metadata refreshes triggered by logs from unknown pods.
+const minRefreshInterval = 5 * time.Second
+
+// podList is a subset of Kubernetes PodList returned by kubelet /pods endpoint and by Kubernetes API server /api/v1/pods endpoint.
+//
+// See https://kubernetes.io/docs/reference/kubernetes-api/workload-resources/pod-v1/#PodList
+type podList struct {
+	Items []pod `json:"items"`
+}
+
+type pod struct {
+	Metadata struct {
+		UID    string            `json:"uid"`
+		Labels map[string]string `json:"labels"`
+	} `json:"metadata"`
+	Spec struct {
+		NodeName       string      `json:"nodeName"`
+		Containers     []container `json:"containers"`
+		InitContainers []container `json:"initContainers"`
+	} `json:"spec"`
+}
+
+type container struct {
+	Name  string `json:"name"`
+	Image string `json:"image"`
+}
+
+// podMetadata contains metadata for a pod obtained from metadataSource.
+type podMetadata struct {
+	// fields contains pod-level fields such as node name and labels, which must be added to logs from all the pod containers.
+	fields []logstorage.Field
+
+	// containerImages contains container images keyed by container name.
+	containerImages map[string]string
+}
+
+// metadataSource obtains pod metadata from kubelet or Kubernetes API server.
+type metadataSource struct {
+	url             string
+	c               *http.Client
+	ac              *promauth.Config
+	refreshInterval time.Duration
+
+	pods            map[string]*podMetadata
+	lastRefreshTime time.Time
+
+	refreshErrors *metrics.Counter
+}
+
+func newMetadataSource(url string, c *http.Client, ac *promauth.Config, refreshInterval time.Duration) *metadataSource {
+	return &metadataSource{
+		url:             url,
+		c:               c,
+		ac:              ac,
+		refreshInterval: refreshInterval,
+
+		refreshErrors: metrics.GetOrCreateCounter(`vlagent_kubernetes_metadata_refresh_errors_total`),
+	}
+}
+
+// getPodMetadata returns metadata for the pod with the given uid.
+//
+// nil is returned if the metadata for the pod is unavailable.
+//
+// Pod metadata is refreshed every refreshInterval. It is also refreshed on unknown pods, but no more frequently than minRefreshInterval.
+func (ms *metadataSource) getPodMetadata(uid string) *podMetadata {
+	pm := ms.pods[uid]
+	d := time.Since(ms.lastRefreshTime)
+	if d >= ms.refreshInterval || pm == nil && d >= minRefreshInterval {
+		ms.refresh()
+		pm = ms.pods[uid]
+	}
+	return pm
+}
+
+func (ms *metadataSource) refresh() {
+	ms.lastRefreshTime = time.Now()
+	pods, err := ms.readPods()
+	if err != nil {
+		logger.Errorf("cannot refresh pod metadata; using the previously obtained metadata: %s", err)
+		ms.refreshErrors.Inc()
+		return
+	}
+	ms.pods = pods
+}
+
+func (ms *metadataSource) readPods() (map[string]*podMetadata, error) {
+	req, err := http.NewRequest(http.MethodGet, ms.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create request to %q: %w", ms.url, err)
+	}
+	if err := ms.ac.SetHeaders(req, true); err != nil {
+		return nil, fmt.Errorf("cannot set auth headers for %q: %w", ms.url, err)
+	}
+	resp, err := ms.c.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot send request to %q: %w", ms.url, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read response from %q: %w", ms.url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code returned from %q: %d; want %d; response body: %q", ms.url, resp.StatusCode, http.StatusOK, data)
+	}
+	return parsePodList(data)
+}
+
+func parsePodList(data []byte) (map[string]*podMetadata, error) {
+	var pl podList
+	if err := json.Unmarshal(data, &pl); err != nil {
+		return nil, fmt.Errorf("cannot parse PodList: %w", err)
+	}
+
+	pods := make(map[string]*podMetadata, len(pl.Items))
+	for i := range pl.Items {
+		p := &pl.Items[i]
+
+		var fields []logstorage.Field
+		if p.Spec.NodeName != "" {
+			fields = append(fields, logstorage.Field{
+				Name:  "kubernetes.pod_node_name",
+				Value: p.Spec.NodeName,
+			})
+		}
+		labelFields := make([]logstorage.Field, 0, len(p.Metadata.Labels))
+		for k, v := range p.Metadata.Labels {
+			labelFields = append(labelFields, logstorage.Field{
+				Name:  "kubernetes.pod_labels." + k,
+				Value: v,
+			})
+		}
+		sort.Slice(labelFields, func(i, j int) bool {
+			return labelFields[i].Name < labelFields[j].Name
+		})
+		fields = append(fields, labelFields...)
+
+		containerImages := make(map[string]string, len(p.Spec.Containers)+len(p.Spec.InitContainers))
+		for _, c := range p.Spec.InitContainers {
+			containerImages[c.Name] = c.Image
+		}
+		for _, c := range p.Spec.Containers {
+			containerImages[c.Name] = c.Image
+		}
+
+		pods[p.Metadata.UID] = &podMetadata{
+			fields:          fields,
+			containerImages: containerImages,
+		}
+	}
+	return pods, nil
+}
+
+// podLogPath contains the pod info obtained from the path to the container log file.
+type podLogPath struct {
+	namespace     string
+	podName       string
+	podUID        string
+	containerName string
+}
+
+// parsePodLogPath parses the path to container log file in the form `.../<namespace>_<pod_name>_<pod_uid>/<container_name>/<restart_count>.log`.
+//
+// See https://github.com/kubernetes/kubernetes/blob/master/pkg/kubelet/kuberuntime/helpers.go
+func parsePodLogPath(path string) (*podLogPath, bool) {
+	path = strings.ReplaceAll(path, "\\", "/")
+	parts := strings.Split(path, "/")
+	if len(parts) < 3 {
+		return nil, false
+	}
+	podDir := parts[len(parts)-3]
+	containerName := parts[len(parts)-2]
+
+	podParts := strings.Split(podDir, "_")
+	if len(podParts) != 3 || containerName == "" {
+		return nil, false
+	}
+	return &podLogPath{
+		namespace:     podParts[0],
+		podName:       podParts[1],
+		podUID:        podParts[2],
+		containerName: containerName,
+	}, true
+}
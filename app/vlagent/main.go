@@ -15,6 +15,8 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/procutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/pushmetrics"
 
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlagent/filetail"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlagent/kubernetes"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlagent/remotewrite"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
@@ -42,6 +44,9 @@ func main() {
 	vlinsert.Init()
 
 	insertutil.SetLogRowsStorage(&remotewrite.Storage{})
+	filetail.MustInit(remotewrite.GetTmpDataPath(), &remotewrite.Storage{})
+	kubernetes.MustInit(remotewrite.GetTmpDataPath())
+
 	listenAddrs := *httpListenAddrs
 	if len(listenAddrs) == 0 {
 		listenAddrs = []string{":9429"}
@@ -64,6 +69,8 @@ func main() {
 		logger.Fatalf("cannot stop the webservice: %s", err)
 	}
 	vlinsert.Stop()
+	filetail.MustStop()
+	kubernetes.MustStop()
 	remotewrite.Stop()
 	logger.Infof("successfully shut down the webservice in %.3f seconds", time.Since(startTime).Seconds())
 	logger.Infof("successfully stopped vlagent in %.3f seconds", time.Since(startTime).Seconds())
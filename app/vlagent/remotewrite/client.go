@@ -76,6 +76,9 @@ type client struct {
 	sendBlock func(block []byte) bool
 	authCfg   *promauth.Config
 
+	// ss is set for syslog+tcp and syslog+tls -remoteWrite.url
+	ss *syslogSender
+
 	rl *ratelimiter.RateLimiter
 
 	bytesSent       *metrics.Counter
@@ -167,6 +170,9 @@ func (c *client) init(argIdx, concurrency int, sanitizedURL string) {
 func (c *client) MustStop() {
 	close(c.stopCh)
 	c.wg.Wait()
+	if c.ss != nil {
+		c.ss.mustCloseConns()
+	}
 	logger.Infof("stopped client for -remoteWrite.url=%q", c.sanitizedURL)
 }
 
@@ -0,0 +1,57 @@
+package remotewrite
+
+import (
+	"github.com/cespare/xxhash/v2"
+)
+
+// consistentHash implements rendezvous hashing for distributing log streams among -remoteWrite.url targets.
+//
+// Adding or removing a target moves only the streams, which belong to this target.
+type consistentHash struct {
+	nodeHashes []uint64
+}
+
+func newConsistentHash(nodes []string) *consistentHash {
+	nodeHashes := make([]uint64, len(nodes))
+	for i, node := range nodes {
+		nodeHashes[i] = xxhash.Sum64([]byte(node))
+	}
+	return &consistentHash{
+		nodeHashes: nodeHashes,
+	}
+}
+
+// appendNodeIdxs appends to dst n distinct node indexes for the given hash h and returns the result.
+//
+// The first appended index is the primary node for h, while the rest of indexes are replicas in the order of preference.
+func (ch *consistentHash) appendNodeIdxs(dst []int, h uint64, n int) []int {
+	if n > len(ch.nodeHashes) {
+		n = len(ch.nodeHashes)
+	}
+	dstLen := len(dst)
+	for len(dst)-dstLen < n {
+		idx := -1
+		var mMax uint64
+	nextNode:
+		for i, nh := range ch.nodeHashes {
+			for _, j := range dst[dstLen:] {
+				if i == j {
+					continue nextNode
+				}
+			}
+			if m := fastHashUint64(nh ^ h); idx < 0 || m > mMax {
+				mMax = m
+				idx = i
+			}
+		}
+		dst = append(dst, idx)
+	}
+	return dst
+}
+
+func fastHashUint64(x uint64) uint64 {
+	x ^= x >> 12 // a
+	x ^= x << 25 // b
+	x ^= x >> 27 // c
+	return x * 2685821657736338717
+}
@@ -0,0 +1,104 @@
+package remotewrite
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+func TestConsistentHashAppendNodeIdxs(t *testing.T) {
+	f := func(nodesCount, n, resultLenExpected int) {
+		t.Helper()
+
+		nodes := make([]string, nodesCount)
+		for i := range nodes {
+			nodes[i] = fmt.Sprintf("http://node-%d:9428/internal/insert", i)
+		}
+		ch := newConsistentHash(nodes)
+
+		for i := 0; i < 1000; i++ {
+			h := xxhash.Sum64([]byte(fmt.Sprintf("stream %d", i)))
+			result := ch.appendNodeIdxs(nil, h, n)
+			if len(result) != resultLenExpected {
+				t.Fatalf("unexpected number of node indexes; got %d; want %d", len(result), resultLenExpected)
+			}
+			m := make(map[int]struct{})
+			for _, idx := range result {
+				if idx < 0 || idx >= nodesCount {
+					t.Fatalf("unexpected node index %d; it must be in the range [0..%d)", idx, nodesCount)
+				}
+				if _, ok := m[idx]; ok {
+					t.Fatalf("duplicate node index %d in %v", idx, result)
+				}
+				m[idx] = struct{}{}
+			}
+
+			// The result must be stable
+			result2 := ch.appendNodeIdxs(nil, h, n)
+			if fmt.Sprint(result) != fmt.Sprint(result2) {
+				t.Fatalf("unstable result for the same hash; got %v and %v", result, result2)
+			}
+		}
+	}
+
+	f(1, 1, 1)
+	f(3, 1, 1)
+	f(3, 2, 2)
+	f(3, 3, 3)
+
+	// the number of replicas exceeds the number of nodes
+	f(2, 5, 2)
+}
+
+func TestConsistentHashUniformity(t *testing.T) {
+	const nodesCount = 4
+	const streamsCount = 100_000
+
+	nodes := make([]string, nodesCount)
+	for i := range nodes {
+		nodes[i] = fmt.Sprintf("http://node-%d:9428/internal/insert", i)
+	}
+	ch := newConsistentHash(nodes)
+
+	perNode := make([]int, nodesCount)
+	var buf []int
+	for i := 0; i < streamsCount; i++ {
+		h := xxhash.Sum64([]byte(fmt.Sprintf("stream %d", i)))
+		buf = ch.appendNodeIdxs(buf[:0], h, 1)
+		perNode[buf[0]]++
+	}
+	expected := float64(streamsCount) / nodesCount
+	for i, n := range perNode {
+		if math.Abs(float64(n)-expected)/expected > 0.05 {
+			t.Fatalf("too uneven distribution of streams among nodes: node #%d got %d streams; want %.0f; distribution: %v", i, n, expected, perNode)
+		}
+	}
+}
+
+func TestConsistentHashStability(t *testing.T) {
+	const streamsCount = 10_000
+
+	nodes := []string{"node-0", "node-1", "node-2"}
+	ch := newConsistentHash(nodes)
+	chExtended := newConsistentHash(append(nodes, "node-3"))
+
+	// Adding a new node must move streams only to the new node.
+	moved := 0
+	for i := 0; i < streamsCount; i++ {
+		h := xxhash.Sum64([]byte(fmt.Sprintf("stream %d", i)))
+		idx := ch.appendNodeIdxs(nil, h, 1)[0]
+		idxExtended := chExtended.appendNodeIdxs(nil, h, 1)[0]
+		if idx == idxExtended {
+			continue
+		}
+		if idxExtended != 3 {
+			t.Fatalf("stream %d has been moved from node %d to node %d; want moving only to the new node 3", i, idx, idxExtended)
+		}
+		moved++
+	}
+	if moved == 0 || moved > streamsCount/3 {
+		t.Fatalf("unexpected number of moved streams: %d", moved)
+	}
+}
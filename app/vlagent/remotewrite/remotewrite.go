@@ -24,12 +24,27 @@ import (
 var (
 	remoteWriteURLs = flagutil.NewArrayString("remoteWrite.url", "Remote storage URL to write data to. It must support VictoriaLogs native protocol. "+
 		"Example url: http://<victorialogs-host>:9428/internal/insert. "+
-		"Pass multiple -remoteWrite.url options in order to replicate the collected data to multiple remote storage systems.")
+		"It is possible to send logs to syslog server in RFC5424 format via syslog+tcp://<syslog-host>:514 or syslog+tls://<syslog-host>:6514 url; "+
+		"see https://docs.victoriametrics.com/victorialogs/vlagent/#forwarding-logs-to-syslog . "+
+		"Pass multiple -remoteWrite.url options in order to replicate the collected data to multiple remote storage systems. "+
+		"See also -remoteWrite.shardByURL")
 	maxPendingBytesPerURL = flagutil.NewArrayBytes("remoteWrite.maxDiskUsagePerURL", 0, "The maximum file-based buffer size in bytes at -remoteWrite.tmpDataPath "+
 		"for each -remoteWrite.url. When buffer size reaches the configured maximum, then old data is dropped when adding new data to the buffer. "+
 		"Buffered data is stored in ~500MB chunks. It is recommended to set the value for this flag to a multiple of the block size 500MB. "+
 		"Disk usage is unlimited if the value is set to 0")
 
+	filters = flagutil.NewArrayString("remoteWrite.filter", "Optional LogsQL filter for logs to send to the corresponding -remoteWrite.url; "+
+		"for example, -remoteWrite.filter='level:error'. By default all the logs are sent to the corresponding -remoteWrite.url. "+
+		"See https://docs.victoriametrics.com/victorialogs/vlagent/#routing-and-filtering")
+	tenantIDs = flagutil.NewArrayString("remoteWrite.tenantID", "Optional tenant in the form AccountID:ProjectID for all the logs sent to the corresponding -remoteWrite.url. "+
+		"By default the original tenant of logs is preserved. See https://docs.victoriametrics.com/victorialogs/vlagent/#routing-and-filtering")
+
+	shardByURL = flag.Bool("remoteWrite.shardByURL", false, "Whether to shard outgoing logs across all the -remoteWrite.url targets by log streams "+
+		"instead of replicating all the logs to all the -remoteWrite.url targets. All the logs for the same log stream are sent to the same -remoteWrite.url. "+
+		"See also -remoteWrite.shardByURLReplicas and https://docs.victoriametrics.com/victorialogs/vlagent/#sharding-among-remote-storages")
+	shardByURLReplicas = flag.Int("remoteWrite.shardByURLReplicas", 1, "How many copies of every log stream to send to distinct -remoteWrite.url targets "+
+		"when -remoteWrite.shardByURL is set. See https://docs.victoriametrics.com/victorialogs/vlagent/#sharding-among-remote-storages")
+
 	tmpDataPath = flag.String("remoteWrite.tmpDataPath", "vlagent-remotewrite-data", "Path to directory for storing pending data, which isn't sent to the configured -remoteWrite.url . "+
 		"See also -remoteWrite.maxDiskUsagePerURL")
 	queues = flag.Int("remoteWrite.queues", cgroup.AvailableCPUs()*2, "The number of concurrent queues to each -remoteWrite.url. Set more queues if default number of queues "+
@@ -43,6 +58,9 @@ var (
 // rwctxsGlobal contains statically populated entries when -remoteWrite.url is specified.
 var rwctxsGlobal []*remoteWriteCtx
 
+// rwctxsShardsGlobal distributes log streams among rwctxsGlobal when -remoteWrite.shardByURL is set.
+var rwctxsShardsGlobal *consistentHash
+
 // Storage implements insertutil.LogRowsStorage interface
 type Storage struct{}
 
@@ -56,6 +74,11 @@ func (*Storage) CanWriteData() error {
 	return nil
 }
 
+// CanWriteTenantData implements insertutil.LogRowsStorage interface
+func (*Storage) CanWriteTenantData(_ logstorage.TenantID) error {
+	return nil
+}
+
 // maxQueues limits the maximum value for `-remoteWrite.queues`. There is no sense in setting too high value,
 // since it may lead to high memory usage due to big number of buffers.
 var maxQueues = cgroup.AvailableCPUs() * 16
@@ -85,10 +108,19 @@ func Init() {
 	if *queues <= 0 {
 		*queues = 1
 	}
+	if *shardByURL && (*shardByURLReplicas < 1 || *shardByURLReplicas > len(*remoteWriteURLs)) {
+		logger.Fatalf("-remoteWrite.shardByURLReplicas=%d must be in the range [1..%d], where %d is the number of -remoteWrite.url flags",
+			*shardByURLReplicas, len(*remoteWriteURLs), len(*remoteWriteURLs))
+	}
 	initRemoteWriteCtxs(*remoteWriteURLs)
 	dropDanglingQueues()
 }
 
+// GetTmpDataPath returns the path to -remoteWrite.tmpDataPath directory.
+func GetTmpDataPath() string {
+	return *tmpDataPath
+}
+
 // Stop stops remotewrite.
 //
 // It is expected that nobody calls TryPush during and after the call to this func.
@@ -97,6 +129,7 @@ func Stop() {
 		rwctx.mustStop()
 	}
 	rwctxsGlobal = nil
+	rwctxsShardsGlobal = nil
 }
 
 func dropDanglingQueues() {
@@ -160,6 +193,9 @@ func initRemoteWriteCtxs(urls []string) {
 	}
 
 	rwctxsGlobal = rwctxs
+	if *shardByURL {
+		rwctxsShardsGlobal = newConsistentHash(urls)
+	}
 }
 
 func pushToRemoteStorages(lr *logstorage.LogRows) {
@@ -169,6 +205,10 @@ func pushToRemoteStorages(lr *logstorage.LogRows) {
 		rwctxs[0].push(lr)
 		return
 	}
+	if rwctxsShardsGlobal != nil {
+		pushToRemoteStoragesSharded(rwctxs, rwctxsShardsGlobal, lr)
+		return
+	}
 	// Push samples to remote storage systems in parallel in order to reduce
 	// the time needed for sending the data to multiple remote storage systems.
 	var wg sync.WaitGroup
@@ -188,6 +228,14 @@ type remoteWriteCtx struct {
 	fq  *persistentqueue.FastQueue
 	c   *client
 
+	// filter is an optional filter for logs to send to the remote storage.
+	filter *logstorage.RowFilter
+
+	// tenantID is an optional tenant for all the logs sent to the remote storage.
+	tenantID *logstorage.TenantID
+
+	rowsFiltered *metrics.Counter
+
 	pls        []*pendingLogs
 	pssNextIdx atomic.Uint64
 }
@@ -229,11 +277,31 @@ func newRemoteWriteCtx(argIdx int, remoteWriteURL *url.URL, maxInmemoryBlocks in
 	switch remoteWriteURL.Scheme {
 	case "http", "https":
 		c = newHTTPClient(argIdx, remoteWriteURL.String(), sanitizedURL, fq, *queues)
+	case "syslog+tcp", "syslog+tls":
+		c = newSyslogClient(argIdx, remoteWriteURL, sanitizedURL, fq)
 	default:
-		logger.Fatalf("unsupported scheme: %s for remoteWriteURL: %s, want `http`, `https`", remoteWriteURL.Scheme, sanitizedURL)
+		logger.Fatalf("unsupported scheme: %s for remoteWriteURL: %s, want `http`, `https`, `syslog+tcp` or `syslog+tls`", remoteWriteURL.Scheme, sanitizedURL)
 	}
 	c.init(argIdx, *queues, sanitizedURL)
 
+	var filter *logstorage.RowFilter
+	if s := filters.GetOptionalArg(argIdx); s != "" {
+		f, err := logstorage.ParseRowFilter(s)
+		if err != nil {
+			logger.Fatalf("cannot parse -remoteWrite.filter=%q for -remoteWrite.url=%q: %s", s, sanitizedURL, err)
+		}
+		filter = f
+	}
+
+	var tenantID *logstorage.TenantID
+	if s := tenantIDs.GetOptionalArg(argIdx); s != "" {
+		tid, err := logstorage.ParseTenantID(s)
+		if err != nil {
+			logger.Fatalf("cannot parse -remoteWrite.tenantID=%q for -remoteWrite.url=%q: %s", s, sanitizedURL, err)
+		}
+		tenantID = &tid
+	}
+
 	// Initialize pss
 	plsLen := *queues
 	if n := cgroup.AvailableCPUs(); plsLen > n {
@@ -251,15 +319,67 @@ func newRemoteWriteCtx(argIdx int, remoteWriteURL *url.URL, maxInmemoryBlocks in
 		fq:  fq,
 		c:   c,
 		pls: pls,
+
+		filter:   filter,
+		tenantID: tenantID,
+
+		rowsFiltered: metrics.GetOrCreateCounter(fmt.Sprintf(`vlagent_remotewrite_rows_filtered_total{url=%q}`, sanitizedURL)),
 	}
 
 	return rwctx
 }
 
-func (rwctx *remoteWriteCtx) push(lr *logstorage.LogRows) {
+// pushToRemoteStoragesSharded sends every log stream from lr to -remoteWrite.shardByURLReplicas distinct rwctxs selected by ch.
+func pushToRemoteStoragesSharded(rwctxs []*remoteWriteCtx, ch *consistentHash, lr *logstorage.LogRows) {
+	pls := make([]*pendingLogs, len(rwctxs))
+	for i, rwctx := range rwctxs {
+		pls[i] = rwctx.getPendingLogs()
+	}
+
+	var idxs []int
+	lr.ForEachRow(func(streamHash uint64, r *logstorage.InsertRow) {
+		idxs = ch.appendNodeIdxs(idxs[:0], streamHash, *shardByURLReplicas)
+		for _, idx := range idxs {
+			rwctxs[idx].addLogRow(pls[idx], r)
+		}
+	})
+}
+
+func (rwctx *remoteWriteCtx) getPendingLogs() *pendingLogs {
 	pls := rwctx.pls
 	idx := rwctx.pssNextIdx.Add(1) % uint64(len(pls))
-	pls[idx].add(lr)
+	return pls[idx]
+}
+
+func (rwctx *remoteWriteCtx) push(lr *logstorage.LogRows) {
+	pl := rwctx.getPendingLogs()
+	if rwctx.filter == nil && rwctx.tenantID == nil {
+		// Fast path - send all the logs as is.
+		pl.add(lr)
+		return
+	}
+
+	lr.ForEachRow(func(_ uint64, r *logstorage.InsertRow) {
+		rwctx.addLogRow(pl, r)
+	})
+}
+
+// addLogRow adds r to pl if r matches rwctx.filter.
+//
+// r remains unchanged after the call, so it can be passed to other rwctxs.
+func (rwctx *remoteWriteCtx) addLogRow(pl *pendingLogs, r *logstorage.InsertRow) {
+	if rwctx.filter != nil && !rwctx.filter.MatchInsertRow(r) {
+		rwctx.rowsFiltered.Inc()
+		return
+	}
+	if rwctx.tenantID == nil {
+		pl.addLogRow(r)
+		return
+	}
+	tenantID := r.TenantID
+	r.TenantID = *rwctx.tenantID
+	pl.addLogRow(r)
+	r.TenantID = tenantID
 }
 
 func (rwctx *remoteWriteCtx) mustStop() {
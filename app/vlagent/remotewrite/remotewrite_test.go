@@ -0,0 +1,169 @@
+package remotewrite
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestRemoteWriteCtxPush(t *testing.T) {
+	f := func(filter, tenantID string, rowsExpected []string) {
+		t.Helper()
+
+		pl := &pendingLogs{}
+		rwctx := &remoteWriteCtx{
+			pls:          []*pendingLogs{pl},
+			rowsFiltered: metrics.NewCounter(fmt.Sprintf(`vlagent_remotewrite_rows_filtered_total{test=%q}`, t.Name())),
+		}
+		if filter != "" {
+			rf, err := logstorage.ParseRowFilter(filter)
+			if err != nil {
+				t.Fatalf("cannot parse filter [%s]: %s", filter, err)
+			}
+			rwctx.filter = rf
+		}
+		if tenantID != "" {
+			tid, err := logstorage.ParseTenantID(tenantID)
+			if err != nil {
+				t.Fatalf("cannot parse tenantID %q: %s", tenantID, err)
+			}
+			rwctx.tenantID = &tid
+		}
+		defer metrics.UnregisterMetric(fmt.Sprintf(`vlagent_remotewrite_rows_filtered_total{test=%q}`, t.Name()))
+
+		lr := logstorage.GetLogRows([]string{"app"}, nil, nil, nil, "")
+		defer logstorage.PutLogRows(lr)
+		lr.MustAdd(logstorage.TenantID{AccountID: 1}, 1, []logstorage.Field{
+			{Name: "app", Value: "nginx"},
+			{Name: "level", Value: "error"},
+			{Name: "_msg", Value: "foo"},
+		}, nil)
+		lr.MustAdd(logstorage.TenantID{AccountID: 2}, 2, []logstorage.Field{
+			{Name: "app", Value: "apache"},
+			{Name: "level", Value: "info"},
+			{Name: "_msg", Value: "bar"},
+		}, nil)
+		rwctx.push(lr)
+
+		rows := getPendingRows(t, pl)
+		if !reflect.DeepEqual(rows, rowsExpected) {
+			t.Fatalf("unexpected rows\ngot\n%q\nwant\n%q", rows, rowsExpected)
+		}
+		if n := int(pl.wr.pendingLogRowsCount); n != len(rowsExpected) {
+			t.Fatalf("unexpected number of pending rows; got %d; want %d", n, len(rowsExpected))
+		}
+	}
+
+	rowNginx := `{"app":"nginx","level":"error","_msg":"foo"}`
+	rowApache := `{"app":"apache","level":"info","_msg":"bar"}`
+
+	// no filter and no tenant override
+	f("", "", []string{"1:0 " + rowNginx, "2:0 " + rowApache})
+
+	// filter
+	f("level:error", "", []string{"1:0 " + rowNginx})
+	f(`{app="apache"}`, "", []string{"2:0 " + rowApache})
+	f("level:warn", "", nil)
+
+	// tenant override
+	f("", "3:4", []string{"3:4 " + rowNginx, "3:4 " + rowApache})
+
+	// filter and tenant override
+	f("bar", "5:6", []string{"5:6 " + rowApache})
+}
+
+func TestPushToRemoteStoragesSharded(t *testing.T) {
+	f := func(nodesCount, replicas int) {
+		t.Helper()
+
+		origReplicas := *shardByURLReplicas
+		*shardByURLReplicas = replicas
+		defer func() {
+			*shardByURLReplicas = origReplicas
+		}()
+
+		nodes := make([]string, nodesCount)
+		rwctxs := make([]*remoteWriteCtx, nodesCount)
+		for i := range rwctxs {
+			nodes[i] = fmt.Sprintf("http://node-%d:9428/internal/insert", i)
+			rwctxs[i] = &remoteWriteCtx{
+				pls: []*pendingLogs{{}},
+			}
+		}
+		ch := newConsistentHash(nodes)
+
+		const streamsCount = 100
+		const rowsPerStream = 3
+		lr := logstorage.GetLogRows([]string{"app"}, nil, nil, nil, "")
+		defer logstorage.PutLogRows(lr)
+		for i := 0; i < rowsPerStream; i++ {
+			for j := 0; j < streamsCount; j++ {
+				lr.MustAdd(logstorage.TenantID{}, int64(i), []logstorage.Field{
+					{Name: "app", Value: fmt.Sprintf("app-%d", j)},
+					{Name: "_msg", Value: fmt.Sprintf("msg-%d", i)},
+				}, nil)
+			}
+		}
+		pushToRemoteStoragesSharded(rwctxs, ch, lr)
+
+		// Every row must be sent to exactly `replicas` nodes, while all the rows for the same stream must be sent to the same nodes.
+		streamNodes := make(map[string][]int)
+		rowsPerStreamNode := make(map[string]int)
+		for i, rwctx := range rwctxs {
+			for _, row := range getPendingRows(t, rwctx.pls[0]) {
+				stream := row[:strings.Index(row, ",")]
+				key := fmt.Sprintf("%s node-%d", stream, i)
+				if rowsPerStreamNode[key] == 0 {
+					streamNodes[stream] = append(streamNodes[stream], i)
+				}
+				rowsPerStreamNode[key]++
+			}
+		}
+		if len(streamNodes) != streamsCount {
+			t.Fatalf("unexpected number of streams; got %d; want %d", len(streamNodes), streamsCount)
+		}
+		usedNodes := make(map[int]struct{})
+		for stream, idxs := range streamNodes {
+			if len(idxs) != replicas {
+				t.Fatalf("unexpected number of nodes for stream %s; got %d; want %d", stream, len(idxs), replicas)
+			}
+			for _, idx := range idxs {
+				usedNodes[idx] = struct{}{}
+				key := fmt.Sprintf("%s node-%d", stream, idx)
+				if n := rowsPerStreamNode[key]; n != rowsPerStream {
+					t.Fatalf("unexpected number of rows for stream %s at node %d; got %d; want %d", stream, idx, n, rowsPerStream)
+				}
+			}
+		}
+		if len(usedNodes) != nodesCount {
+			t.Fatalf("streams must be spread among all the %d nodes; got %d nodes", nodesCount, len(usedNodes))
+		}
+	}
+
+	f(2, 1)
+	f(3, 1)
+	f(3, 2)
+	f(4, 4)
+}
+
+func getPendingRows(t *testing.T, pl *pendingLogs) []string {
+	t.Helper()
+
+	var rows []string
+	src := pl.wr.pendingData.B
+	for len(src) > 0 {
+		var r logstorage.InsertRow
+		tail, err := r.UnmarshalInplace(src)
+		if err != nil {
+			t.Fatalf("cannot unmarshal pending row: %s", err)
+		}
+		src = tail
+		rows = append(rows, fmt.Sprintf("%d:%d %s", r.TenantID.AccountID, r.TenantID.ProjectID, logstorage.MarshalFieldsToJSON(nil, r.Fields)))
+	}
+	return rows
+}
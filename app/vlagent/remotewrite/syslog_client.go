@@ -0,0 +1,331 @@
+package remotewrite
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding/zstd"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/persistentqueue"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timerpool"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timeutil"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+// syslogSender sends blocks from the persistent queue to syslog server in RFC5424 format.
+//
+// See https://datatracker.ietf.org/doc/html/rfc5424
+type syslogSender struct {
+	c *client
+
+	addr        string
+	tlsConfig   *tls.Config
+	sendTimeout time.Duration
+
+	// connsLock protects conns
+	connsLock sync.Mutex
+
+	// conns contains idle connections to addr
+	conns []net.Conn
+}
+
+func newSyslogClient(argIdx int, remoteWriteURL *url.URL, sanitizedURL string, fq *persistentqueue.FastQueue) *client {
+	var tlsConfig *tls.Config
+	defaultPort := "514"
+	if remoteWriteURL.Scheme == "syslog+tls" {
+		authCfg, err := getAuthConfig(argIdx)
+		if err != nil {
+			logger.Fatalf("cannot initialize auth config for -remoteWrite.url=%q: %s", sanitizedURL, err)
+		}
+		tlsConfig, err = authCfg.GetTLSConfig()
+		if err != nil {
+			logger.Fatalf("cannot initialize tls config for -remoteWrite.url=%q: %s", sanitizedURL, err)
+		}
+		// See https://datatracker.ietf.org/doc/html/rfc5425#section-4.1
+		defaultPort = "6514"
+	}
+	if remoteWriteURL.Hostname() == "" {
+		logger.Fatalf("missing host in -remoteWrite.url=%q", sanitizedURL)
+	}
+	addr := remoteWriteURL.Host
+	if remoteWriteURL.Port() == "" {
+		addr = net.JoinHostPort(remoteWriteURL.Hostname(), defaultPort)
+	}
+
+	c := &client{
+		sanitizedURL:     sanitizedURL,
+		remoteWriteURL:   remoteWriteURL.String(),
+		fq:               fq,
+		retryMinInterval: retryMinInterval.GetOptionalArg(argIdx),
+		retryMaxTime:     retryMaxTime.GetOptionalArg(argIdx),
+		stopCh:           make(chan struct{}),
+	}
+	ss := &syslogSender{
+		c:           c,
+		addr:        addr,
+		tlsConfig:   tlsConfig,
+		sendTimeout: sendTimeout.GetOptionalArg(argIdx),
+	}
+	c.ss = ss
+	c.sendBlock = ss.sendBlock
+	return c
+}
+
+// sendBlock sends the given block to ss.addr.
+//
+// The function returns false only if c.stopCh is closed.
+// Otherwise, it tries sending the block to syslog server indefinitely.
+func (ss *syslogSender) sendBlock(block []byte) bool {
+	c := ss.c
+
+	bb := bbPool.Get()
+	defer bbPool.Put(bb)
+
+	var err error
+	bb.B, err = marshalSyslogMessages(bb.B[:0], block)
+	if err != nil {
+		remoteWriteRejectedLogger.Errorf("cannot convert a block with size %d bytes to syslog messages for %q (skipping the block): %s", len(block), c.sanitizedURL, err)
+		c.packetsDropped.Inc()
+		return true
+	}
+	c.rl.Register(len(bb.B))
+	maxRetryDuration := timeutil.AddJitterToDuration(c.retryMaxTime)
+	retryDuration := timeutil.AddJitterToDuration(c.retryMinInterval)
+
+again:
+	startTime := time.Now()
+	err = ss.write(bb.B)
+	c.requestDuration.UpdateDuration(startTime)
+	if err != nil {
+		c.errorsCount.Inc()
+		retryDuration *= 2
+		if retryDuration > maxRetryDuration {
+			retryDuration = maxRetryDuration
+		}
+		remoteWriteRetryLogger.Warnf("couldn't send a block with size %d bytes to %q: %s; re-sending the block in %.3f seconds",
+			len(bb.B), c.sanitizedURL, err, retryDuration.Seconds())
+		t := timerpool.Get(retryDuration)
+		select {
+		case <-c.stopCh:
+			timerpool.Put(t)
+			return false
+		case <-t.C:
+			timerpool.Put(t)
+		}
+		c.retriesCount.Inc()
+		goto again
+	}
+
+	c.requestsOKCount.Inc()
+	c.bytesSent.Add(len(bb.B))
+	c.blocksSent.Inc()
+	return true
+}
+
+// write writes data to ss.addr.
+//
+// The connection is closed on error, so the next write establishes a new connection.
+// This means that the messages, which have been partially written before the error, may be delivered twice.
+func (ss *syslogSender) write(data []byte) error {
+	conn, err := ss.getConn()
+	if err != nil {
+		return err
+	}
+	if err := conn.SetWriteDeadline(time.Now().Add(ss.sendTimeout)); err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("cannot set write deadline: %w", err)
+	}
+	if _, err := conn.Write(data); err != nil {
+		_ = conn.Close()
+		return err
+	}
+	ss.putConn(conn)
+	return nil
+}
+
+func (ss *syslogSender) getConn() (net.Conn, error) {
+	ss.connsLock.Lock()
+	if n := len(ss.conns); n > 0 {
+		conn := ss.conns[n-1]
+		ss.conns[n-1] = nil
+		ss.conns = ss.conns[:n-1]
+		ss.connsLock.Unlock()
+		return conn, nil
+	}
+	ss.connsLock.Unlock()
+
+	d := &net.Dialer{
+		Timeout: ss.sendTimeout,
+	}
+	if ss.tlsConfig == nil {
+		return d.Dial("tcp", ss.addr)
+	}
+	td := &tls.Dialer{
+		NetDialer: d,
+		Config:    ss.tlsConfig,
+	}
+	return td.Dial("tcp", ss.addr)
+}
+
+func (ss *syslogSender) putConn(conn net.Conn) {
+	ss.connsLock.Lock()
+	ss.conns = append(ss.conns, conn)
+	ss.connsLock.Unlock()
+}
+
+func (ss *syslogSender) mustCloseConns() {
+	ss.connsLock.Lock()
+	for _, conn := range ss.conns {
+		_ = conn.Close()
+	}
+	ss.conns = nil
+	ss.connsLock.Unlock()
+}
+
+// marshalSyslogMessages appends RFC5424 messages for the log entries from the given block to dst and returns the result.
+//
+// Every message is prefixed with its length according to octet-counting framing.
+// See https://datatracker.ietf.org/doc/html/rfc6587#section-3.4.1
+func marshalSyslogMessages(dst, block []byte) ([]byte, error) {
+	bb := bbPool.Get()
+	defer bbPool.Put(bb)
+
+	var err error
+	bb.B, err = zstd.Decompress(bb.B[:0], block)
+	if err != nil {
+		return dst, fmt.Errorf("cannot decompress block: %w", err)
+	}
+
+	r := logstorage.GetInsertRow()
+	defer logstorage.PutInsertRow(r)
+
+	var msg []byte
+	src := bb.B
+	for len(src) > 0 {
+		tail, err := r.UnmarshalInplace(src)
+		if err != nil {
+			return dst, fmt.Errorf("cannot unmarshal log entry: %w", err)
+		}
+		src = tail
+
+		msg = appendSyslogMessage(msg[:0], r)
+		dst = strconv.AppendInt(dst, int64(len(msg)), 10)
+		dst = append(dst, ' ')
+		dst = append(dst, msg...)
+	}
+	return dst, nil
+}
+
+// appendSyslogMessage appends RFC5424 message for r to dst and returns the result.
+//
+// See https://datatracker.ietf.org/doc/html/rfc5424#section-6
+func appendSyslogMessage(dst []byte, r *logstorage.InsertRow) []byte {
+	var msg, hostname, appName, procID, msgID, level string
+	severity := -1
+	facility := -1
+	for _, f := range r.Fields {
+		switch f.Name {
+		case "", "_msg":
+			msg = f.Value
+		case "hostname":
+			hostname = f.Value
+		case "app_name":
+			appName = f.Value
+		case "proc_id":
+			procID = f.Value
+		case "msg_id":
+			msgID = f.Value
+		case "level":
+			level = f.Value
+		case "severity":
+			if n, err := strconv.Atoi(f.Value); err == nil && n >= 0 && n <= 7 {
+				severity = n
+			}
+		case "facility":
+			if n, err := strconv.Atoi(f.Value); err == nil && n >= 0 && n <= 23 {
+				facility = n
+			}
+		}
+	}
+	if severity < 0 {
+		severity = syslogLevelToSeverity(level)
+	}
+	if facility < 0 {
+		// user-level messages
+		facility = 1
+	}
+
+	dst = append(dst, '<')
+	dst = strconv.AppendInt(dst, int64(facility*8+severity), 10)
+	dst = append(dst, ">1 "...)
+	dst = time.Unix(0, r.Timestamp).UTC().AppendFormat(dst, "2006-01-02T15:04:05.000000Z07:00")
+	dst = append(dst, ' ')
+	dst = appendSyslogHeaderField(dst, hostname, 255)
+	dst = append(dst, ' ')
+	dst = appendSyslogHeaderField(dst, appName, 48)
+	dst = append(dst, ' ')
+	dst = appendSyslogHeaderField(dst, procID, 128)
+	dst = append(dst, ' ')
+	dst = appendSyslogHeaderField(dst, msgID, 32)
+
+	// Structured data isn't sent.
+	dst = append(dst, " -"...)
+
+	if msg != "" {
+		dst = append(dst, ' ')
+		dst = append(dst, msg...)
+	}
+	return dst
+}
+
+// appendSyslogHeaderField appends s to dst as RFC5424 header field with the given maxLen and returns the result.
+//
+// Empty s is replaced with NILVALUE, while chars outside PRINTUSASCII are replaced with '_'.
+func appendSyslogHeaderField(dst []byte, s string, maxLen int) []byte {
+	if s == "" {
+		return append(dst, '-')
+	}
+	if len(s) > maxLen {
+		s = s[:maxLen]
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 33 || c > 126 {
+			c = '_'
+		}
+		dst = append(dst, c)
+	}
+	return dst
+}
+
+// syslogLevelToSeverity converts the given log level to syslog severity.
+//
+// It returns informational severity for unknown levels.
+func syslogLevelToSeverity(level string) int {
+	// See https://en.wikipedia.org/wiki/Syslog#Severity_level
+	switch strings.ToLower(level) {
+	case "emerg", "emergency", "panic":
+		return 0
+	case "alert":
+		return 1
+	case "crit", "critical", "fatal":
+		return 2
+	case "err", "error":
+		return 3
+	case "warn", "warning":
+		return 4
+	case "notice":
+		return 5
+	case "debug", "trace":
+		return 7
+	default:
+		return 6
+	}
+}
@@ -0,0 +1,263 @@
+package remotewrite
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding/zstd"
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestAppendSyslogMessage(t *testing.T) {
+	f := func(fields []logstorage.Field, resultExpected string) {
+		t.Helper()
+
+		r := &logstorage.InsertRow{
+			Timestamp: 1735787045123456789,
+			Fields:    fields,
+		}
+		result := appendSyslogMessage(nil, r)
+		if string(result) != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	// empty fields
+	f(nil, `<14>1 2025-01-02T03:04:05.123456Z - - - - -`)
+
+	// message only
+	f([]logstorage.Field{
+		{Name: "_msg", Value: "foo bar"},
+	}, `<14>1 2025-01-02T03:04:05.123456Z - - - - - foo bar`)
+
+	// all the header fields
+	f([]logstorage.Field{
+		{Name: "hostname", Value: "host-1"},
+		{Name: "app_name", Value: "nginx"},
+		{Name: "proc_id", Value: "123"},
+		{Name: "msg_id", Value: "ID47"},
+		{Name: "_msg", Value: "foo bar"},
+		{Name: "path", Value: "/var/log/nginx.log"},
+	}, `<14>1 2025-01-02T03:04:05.123456Z host-1 nginx 123 ID47 - foo bar`)
+
+	// severity from level
+	f([]logstorage.Field{
+		{Name: "level", Value: "ERROR"},
+		{Name: "_msg", Value: "foo"},
+	}, `<11>1 2025-01-02T03:04:05.123456Z - - - - - foo`)
+	f([]logstorage.Field{
+		{Name: "level", Value: "warn"},
+	}, `<12>1 2025-01-02T03:04:05.123456Z - - - - -`)
+	f([]logstorage.Field{
+		{Name: "level", Value: "unknown"},
+	}, `<14>1 2025-01-02T03:04:05.123456Z - - - - -`)
+
+	// severity and facility fields obtained from syslog have priority over level
+	f([]logstorage.Field{
+		{Name: "level", Value: "error"},
+		{Name: "severity", Value: "7"},
+		{Name: "facility", Value: "16"},
+	}, `<135>1 2025-01-02T03:04:05.123456Z - - - - -`)
+
+	// invalid severity and facility
+	f([]logstorage.Field{
+		{Name: "level", Value: "debug"},
+		{Name: "severity", Value: "8"},
+		{Name: "facility", Value: "foo"},
+	}, `<15>1 2025-01-02T03:04:05.123456Z - - - - -`)
+
+	// header fields with invalid chars and too long header fields
+	f([]logstorage.Field{
+		{Name: "hostname", Value: "host 1"},
+		{Name: "app_name", Value: strings.Repeat("a", 50)},
+		{Name: "msg_id", Value: "фу"},
+	}, `<14>1 2025-01-02T03:04:05.123456Z host_1 `+strings.Repeat("a", 48)+` - ____ -`)
+}
+
+func TestSyslogLevelToSeverity(t *testing.T) {
+	f := func(level string, severityExpected int) {
+		t.Helper()
+
+		severity := syslogLevelToSeverity(level)
+		if severity != severityExpected {
+			t.Fatalf("unexpected severity for level %q; got %d; want %d", level, severity, severityExpected)
+		}
+	}
+
+	f("emerg", 0)
+	f("alert", 1)
+	f("fatal", 2)
+	f("Error", 3)
+	f("warning", 4)
+	f("notice", 5)
+	f("info", 6)
+	f("trace", 7)
+	f("", 6)
+	f("foo", 6)
+}
+
+func TestSyslogSenderSendBlock(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot start listener: %s", err)
+	}
+	defer ln.Close()
+
+	resultCh := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			resultCh <- nil
+			return
+		}
+		defer conn.Close()
+
+		// Read octet-counted messages.
+		var messages []string
+		br := bufio.NewReader(conn)
+		for len(messages) < 2 {
+			lenStr, err := br.ReadString(' ')
+			if err != nil {
+				break
+			}
+			n, err := strconv.Atoi(strings.TrimSuffix(lenStr, " "))
+			if err != nil {
+				break
+			}
+			buf := make([]byte, n)
+			if _, err := io.ReadFull(br, buf); err != nil {
+				break
+			}
+			messages = append(messages, string(buf))
+		}
+		resultCh <- messages
+	}()
+
+	s := metrics.NewSet()
+	c := &client{
+		sanitizedURL:     "1:secret-url",
+		retryMinInterval: time.Millisecond,
+		retryMaxTime:     time.Millisecond,
+		stopCh:           make(chan struct{}),
+
+		bytesSent:       s.NewCounter("bytes_sent"),
+		blocksSent:      s.NewCounter("blocks_sent"),
+		requestDuration: s.NewHistogram("request_duration"),
+		requestsOKCount: s.NewCounter("requests_ok"),
+		errorsCount:     s.NewCounter("errors"),
+		packetsDropped:  s.NewCounter("packets_dropped"),
+		retriesCount:    s.NewCounter("retries"),
+	}
+	ss := &syslogSender{
+		c:           c,
+		addr:        ln.Addr().String(),
+		sendTimeout: time.Second,
+	}
+	defer ss.mustCloseConns()
+
+	// Prepare a block in the same way as pendingLogs does.
+	var pl pendingLogs
+	lr := logstorage.GetLogRows(nil, nil, nil, nil, "")
+	defer logstorage.PutLogRows(lr)
+	lr.MustAdd(logstorage.TenantID{}, 1735787045000000000, []logstorage.Field{
+		{Name: "hostname", Value: "host-1"},
+		{Name: "app_name", Value: "nginx"},
+		{Name: "level", Value: "error"},
+		{Name: "_msg", Value: "multi\nline"},
+	}, nil)
+	lr.MustAdd(logstorage.TenantID{}, 1735787046000000000, []logstorage.Field{
+		{Name: "_msg", Value: "bar"},
+	}, nil)
+	pl.add(lr)
+	block := zstd.CompressLevel(nil, pl.wr.pendingData.B, 1)
+
+	if !ss.sendBlock(block) {
+		t.Fatalf("cannot send block")
+	}
+
+	var messages []string
+	select {
+	case messages = <-resultCh:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout when waiting for syslog messages")
+	}
+	result := strings.Join(messages, "\n")
+	resultExpected := "<11>1 2025-01-02T03:04:05.000000Z host-1 nginx - - - multi\nline\n<14>1 2025-01-02T03:04:06.000000Z - - - - - bar"
+	if result != resultExpected {
+		t.Fatalf("unexpected messages\ngot\n%s\nwant\n%s", result, resultExpected)
+	}
+	if n := c.blocksSent.Get(); n != 1 {
+		t.Fatalf("unexpected number of sent blocks; got %d; want 1", n)
+	}
+
+	// Invalid block must be dropped
+	if !ss.sendBlock([]byte("invalid block")) {
+		t.Fatalf("invalid block must be dropped")
+	}
+	if n := c.packetsDropped.Get(); n != 1 {
+		t.Fatalf("unexpected number of dropped blocks; got %d; want 1", n)
+	}
+}
+
+func TestSyslogSenderSendBlockStop(t *testing.T) {
+	// Obtain an address without listener.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot start listener: %s", err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	s := metrics.NewSet()
+	c := &client{
+		sanitizedURL:     "1:secret-url",
+		retryMinInterval: time.Millisecond,
+		retryMaxTime:     10 * time.Millisecond,
+		stopCh:           make(chan struct{}),
+
+		requestDuration: s.NewHistogram("request_duration"),
+		errorsCount:     s.NewCounter("errors"),
+		retriesCount:    s.NewCounter("retries"),
+	}
+	ss := &syslogSender{
+		c:           c,
+		addr:        addr,
+		sendTimeout: time.Second,
+	}
+
+	var pl pendingLogs
+	lr := logstorage.GetLogRows(nil, nil, nil, nil, "")
+	defer logstorage.PutLogRows(lr)
+	lr.MustAdd(logstorage.TenantID{}, 1735787045000000000, []logstorage.Field{
+		{Name: "_msg", Value: "foo"},
+	}, nil)
+	pl.add(lr)
+	block := zstd.CompressLevel(nil, pl.wr.pendingData.B, 1)
+
+	resultCh := make(chan bool, 1)
+	go func() {
+		resultCh <- ss.sendBlock(block)
+	}()
+
+	// The block must be re-sent until the client is stopped.
+	time.Sleep(100 * time.Millisecond)
+	close(c.stopCh)
+	select {
+	case ok := <-resultCh:
+		if ok {
+			t.Fatalf("expecting false result after the client is stopped")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout when waiting for sendBlock to return")
+	}
+	if n := c.errorsCount.Get(); n == 0 {
+		t.Fatalf("expecting non-zero errors")
+	}
+}
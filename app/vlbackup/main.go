@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/buildinfo"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/envflag"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/backup"
+)
+
+var (
+	snapshotPath = flag.String("snapshotPath", "", "Path to the partition snapshot to backup. The snapshot can be created via /internal/partition/snapshot/create endpoint; "+
+		"see https://docs.victoriametrics.com/victorialogs/#backup-and-restore . See also -snapshot.createURL")
+	snapshotCreateURL = flag.String("snapshot.createURL", "", "Optional VictoriaLogs URL for creating the partition snapshot before the backup, "+
+		"for example, http://victorialogs:9428/internal/partition/snapshot/create?name=YYYYMMDD . The created snapshot is deleted after the backup. "+
+		"vlbackup must run on the same host as VictoriaLogs in this case. See also -snapshotPath")
+	dst = flag.String("dst", "", "Where to put the backup. Supported formats: fs:///path/to/backup, s3://bucket/path/to/backup . "+
+		"The backup at -dst is updated incrementally if it already exists")
+	concurrency = flag.Int("concurrency", 10, "The number of concurrent workers for uploading files to -dst")
+)
+
+func main() {
+	// Write flags and help message to stdout, since it is easier to grep or pipe.
+	flag.CommandLine.SetOutput(os.Stdout)
+	envflag.Parse()
+	buildinfo.Init()
+	logger.Init()
+
+	if *dst == "" {
+		logger.Fatalf("missing -dst command-line flag")
+	}
+	if (*snapshotPath == "") == (*snapshotCreateURL == "") {
+		logger.Fatalf("either -snapshotPath or -snapshot.createURL command-line flag must be set")
+	}
+	rfs, err := backup.NewRemoteFS(*dst)
+	if err != nil {
+		logger.Fatalf("cannot parse -dst=%q: %s", *dst, err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	path := *snapshotPath
+	if *snapshotCreateURL != "" {
+		path, err = createSnapshot(ctx, *snapshotCreateURL)
+		if err != nil {
+			logger.Fatalf("cannot create snapshot via -snapshot.createURL: %s", err)
+		}
+		logger.Infof("created snapshot at %q", path)
+	}
+
+	err = backup.Backup(ctx, path, rfs, *concurrency)
+
+	if *snapshotCreateURL != "" {
+		fs.MustRemoveDir(path)
+		logger.Infof("deleted snapshot at %q", path)
+	}
+
+	if err != nil {
+		logger.Fatalf("cannot make backup from %q to %s: %s", path, rfs, err)
+	}
+}
+
+// createSnapshot creates partition snapshot via /internal/partition/snapshot/create endpoint at snapshotCreateURL
+// and returns the path to the created snapshot.
+func createSnapshot(ctx context.Context, snapshotCreateURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, snapshotCreateURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot create request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("cannot read response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code: %d; want %d; response body: %q", resp.StatusCode, http.StatusOK, data)
+	}
+
+	var path string
+	if err := json.Unmarshal(data, &path); err != nil {
+		return "", fmt.Errorf("cannot parse response body %q: %w", data, err)
+	}
+	return path, nil
+}
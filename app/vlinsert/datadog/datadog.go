@@ -77,13 +77,20 @@ func datadogLogsIngestion(w http.ResponseWriter, r *http.Request) bool {
 		httpserver.Errorf(w, r, "%s", err)
 		return true
 	}
+	if err := insertutil.CheckTenantLimits(cp.TenantID); err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return true
+	}
 
 	encoding := r.Header.Get("Content-Encoding")
 	err = protoparserutil.ReadUncompressedData(r.Body, encoding, maxRequestSize, func(data []byte) error {
 		lmp := cp.NewLogMessageProcessor("datadog", false)
 		err := readLogsRequest(ts, data, lmp)
 		lmp.MustClose()
-		return err
+		if err != nil {
+			return err
+		}
+		return insertutil.CheckRowsDroppedByTenantLimits(lmp)
 	})
 	if err != nil {
 		httpserver.Errorf(w, r, "cannot read DataDog protocol data: %s", err)
@@ -101,6 +101,10 @@ func RequestHandler(path string, w http.ResponseWriter, r *http.Request) bool {
 			httpserver.Errorf(w, r, "%s", err)
 			return true
 		}
+		if err := insertutil.CheckTenantLimits(cp.TenantID); err != nil {
+			httpserver.Errorf(w, r, "%s", err)
+			return true
+		}
 		lmp := cp.NewLogMessageProcessor("elasticsearch_bulk", true)
 		encoding := r.Header.Get("Content-Encoding")
 		streamName := fmt.Sprintf("remoteAddr=%s, requestURI=%q", httpserver.GetQuotedRemoteAddr(r), r.RequestURI)
@@ -110,6 +114,10 @@ func RequestHandler(path string, w http.ResponseWriter, r *http.Request) bool {
 			logger.Warnf("cannot decode log message #%d in /_bulk request: %s, stream fields: %s", n, err, cp.StreamFields)
 			return true
 		}
+		if err := insertutil.CheckRowsDroppedByTenantLimits(lmp); err != nil {
+			httpserver.Errorf(w, r, "%s", err)
+			return true
+		}
 
 		tookMs := time.Since(startTime).Milliseconds()
 		bw := bufferedwriter.Get(w)
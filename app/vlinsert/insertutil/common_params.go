@@ -22,8 +22,26 @@ import (
 var (
 	defaultMsgValue = flag.String("defaultMsgValue", "missing _msg field; see https://docs.victoriametrics.com/victorialogs/keyconcepts/#message-field",
 		"Default value for _msg field if the ingested log entry doesn't contain it; see https://docs.victoriametrics.com/victorialogs/keyconcepts/#message-field")
+	pipeline = flag.String("insert.pipeline", "", "Optional LogsQL pipes to apply to the ingested logs before storing them, such as 'unpack_json | delete password'. "+
+		"The pipes passed via 'pipeline' query arg or 'VL-Pipeline' request header are applied after these pipes. See https://docs.victoriametrics.com/victorialogs/data-ingestion/#ingestion-pipeline")
 )
 
+var defaultPipeline *logstorage.IngestionPipeline
+
+// MustInit initializes insertutil package from command-line flags.
+func MustInit() {
+	mustInitTenantLimits()
+
+	if *pipeline == "" {
+		return
+	}
+	ip, err := logstorage.ParseIngestionPipeline(*pipeline)
+	if err != nil {
+		logger.Fatalf("cannot parse -insert.pipeline=%q: %s", *pipeline, err)
+	}
+	defaultPipeline = ip
+}
+
 // CommonParams contains common HTTP parameters used by log ingestion APIs.
 //
 // See https://docs.victoriametrics.com/victorialogs/data-ingestion/#http-parameters
@@ -35,6 +53,7 @@ type CommonParams struct {
 	IgnoreFields     []string
 	DecolorizeFields []string
 	ExtraFields      []logstorage.Field
+	Pipeline         *logstorage.IngestionPipeline
 
 	IsTimeFieldSet  bool
 	Debug           bool
@@ -67,6 +86,17 @@ func GetCommonParams(r *http.Request) (*CommonParams, error) {
 		return nil, err
 	}
 
+	// The -insert.pipeline is always applied first, so clients cannot bypass it with the pipeline from the request.
+	pipeline := defaultPipeline
+	if s := httputil.GetRequestValue(r, "pipeline", "VL-Pipeline"); s != "" {
+		var ip *logstorage.IngestionPipeline
+		ip, err = logstorage.ParseIngestionPipeline(s)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse pipeline=%q: %w", s, err)
+		}
+		pipeline = defaultPipeline.Concat(ip)
+	}
+
 	debug := false
 	if dv := httputil.GetRequestValue(r, "debug", "VL-Debug"); dv != "" {
 		debug, err = strconv.ParseBool(dv)
@@ -89,6 +119,7 @@ func GetCommonParams(r *http.Request) (*CommonParams, error) {
 		IgnoreFields:     ignoreFields,
 		DecolorizeFields: decolorizeFields,
 		ExtraFields:      extraFields,
+		Pipeline:         pipeline,
 
 		IsTimeFieldSet:  isTimeFieldSet,
 		Debug:           debug,
@@ -141,6 +172,29 @@ func GetCommonParamsForSyslog(tenantID logstorage.TenantID, streamFields, ignore
 		IgnoreFields:     ignoreFields,
 		DecolorizeFields: decolorizeFields,
 		ExtraFields:      extraFields,
+		Pipeline:         defaultPipeline,
+	}
+
+	return cp
+}
+
+// NewCommonParams returns common params for ingesting logs with the given settings into the given tenantID.
+//
+// It is used by data ingestion protocols, which do not accept HTTP requests, such as Kafka.
+// The -insert.pipeline is applied to the logs ingested with the returned params.
+func NewCommonParams(tenantID logstorage.TenantID, timeFields, msgFields, streamFields, ignoreFields, decolorizeFields []string, extraFields []logstorage.Field) *CommonParams {
+	if len(timeFields) == 0 {
+		timeFields = []string{"_time"}
+	}
+	cp := &CommonParams{
+		TenantID:         tenantID,
+		TimeFields:       timeFields,
+		MsgFields:        msgFields,
+		StreamFields:     streamFields,
+		IgnoreFields:     ignoreFields,
+		DecolorizeFields: decolorizeFields,
+		ExtraFields:      extraFields,
+		Pipeline:         defaultPipeline,
 	}
 
 	return cp
@@ -153,6 +207,9 @@ type LogRowsStorage interface {
 
 	// CanWriteData must returns non-nil error if logs cannot be added to the underlying storage.
 	CanWriteData() error
+
+	// CanWriteTenantData must return non-nil error if logs for the given tenantID cannot be added to the underlying storage because of tenant limits.
+	CanWriteTenantData(tenantID logstorage.TenantID) error
 }
 
 var logRowsStorage LogRowsStorage
@@ -169,6 +226,13 @@ func CanWriteData() error {
 	return logRowsStorage.CanWriteData()
 }
 
+// CanWriteTenantData returns non-nil error if data for the given tenantID cannot be written to the underlying storage because of tenant limits on the stored logs.
+//
+// Use CheckTenantLimits for checking all the tenant limits, including data ingestion rate limits.
+func CanWriteTenantData(tenantID logstorage.TenantID) error {
+	return logRowsStorage.CanWriteTenantData(tenantID)
+}
+
 // LogMessageProcessor is an interface for log message processors.
 type LogMessageProcessor interface {
 	// AddRow must add row to the LogMessageProcessor with the given timestamp and fields.
@@ -191,6 +255,20 @@ type logMessageProcessor struct {
 	cp *CommonParams
 	lr *logstorage.LogRows
 
+	// ipp applies cp.Pipeline to the added rows if it is set.
+	ipp *logstorage.IngestionPipelineProcessor
+
+	// pipelineStreamFields holds streamFields for the row passed to ipp.
+	pipelineStreamFields []logstorage.Field
+
+	// tl limits the data ingestion rate for cp.TenantID. It is nil if the tenant has no rate limits.
+	tl *tenantLimiter
+
+	// rowsDroppedByTenantLimits is the number of rows dropped because of tl limits.
+	//
+	// See CheckRowsDroppedByTenantLimits.
+	rowsDroppedByTenantLimits uint64
+
 	rowsIngestedTotal  *metrics.Counter
 	bytesIngestedTotal *metrics.Counter
 	flushDuration      *metrics.Summary
@@ -230,15 +308,39 @@ func (lmp *logMessageProcessor) AddRow(timestamp int64, fields, streamFields []l
 	n := logstorage.EstimatedJSONRowLen(fields)
 	lmp.bytesIngestedTotal.Add(n)
 
+	lmp.mu.Lock()
+	defer lmp.mu.Unlock()
+
+	if lmp.ipp != nil {
+		// The ipp calls addPipelineRowLocked for every row generated by the pipeline.
+		lmp.pipelineStreamFields = streamFields
+		lmp.ipp.AddRow(timestamp, fields)
+		lmp.pipelineStreamFields = nil
+		return
+	}
+
+	lmp.addRowLocked(timestamp, fields, streamFields)
+}
+
+// addPipelineRowLocked is called for rows generated by lmp.ipp.
+//
+// It must be called under locked lmp.mu.
+func (lmp *logMessageProcessor) addPipelineRowLocked(timestamp int64, fields []logstorage.Field) {
+	lmp.addRowLocked(timestamp, fields, lmp.pipelineStreamFields)
+}
+
+// addRowLocked must be called under locked lmp.mu.
+func (lmp *logMessageProcessor) addRowLocked(timestamp int64, fields, streamFields []logstorage.Field) {
 	if len(fields) > *MaxFieldsPerLine {
 		line := logstorage.MarshalFieldsToJSON(nil, fields)
 		logger.Warnf("dropping log line with %d fields; it exceeds -insert.maxFieldsPerLine=%d; %s", len(fields), *MaxFieldsPerLine, line)
 		rowsDroppedTotalTooManyFields.Inc()
 		return
 	}
-
-	lmp.mu.Lock()
-	defer lmp.mu.Unlock()
+	if lmp.tl != nil && !lmp.tl.tryAddRow(uint64(logstorage.EstimatedJSONRowLen(fields)), time.Now()) {
+		lmp.rowsDroppedByTenantLimits++
+		return
+	}
 
 	lmp.lr.MustAdd(lmp.cp.TenantID, timestamp, fields, streamFields)
 
@@ -261,6 +363,8 @@ type InsertRowProcessor interface {
 }
 
 // AddInsertRow adds r to lmp.
+//
+// The ingestion pipeline isn't applied to r, since it is already applied at the sender side.
 func (lmp *logMessageProcessor) AddInsertRow(r *logstorage.InsertRow) {
 	lmp.rowsIngestedTotal.Inc()
 	n := logstorage.EstimatedJSONRowLen(r.Fields)
@@ -304,6 +408,13 @@ func (lmp *logMessageProcessor) MustClose() {
 	close(lmp.stopCh)
 	lmp.wg.Wait()
 
+	if lmp.ipp != nil {
+		if err := lmp.ipp.Close(); err != nil {
+			logger.Warnf("error in ingestion pipeline [%s]: %s", lmp.cp.Pipeline, err)
+		}
+		lmp.ipp = nil
+	}
+
 	lmp.flushLocked()
 	logstorage.PutLogRows(lmp.lr)
 	lmp.lr = nil
@@ -326,8 +437,13 @@ func (cp *CommonParams) NewLogMessageProcessor(protocolName string, isStreamMode
 		bytesIngestedTotal: bytesIngestedTotal,
 		flushDuration:      flushDuration,
 
+		tl: getTenantLimiter(cp.TenantID),
+
 		stopCh: make(chan struct{}),
 	}
+	if cp.Pipeline != nil {
+		lmp.ipp = cp.Pipeline.NewProcessor(lmp.addPipelineRowLocked)
+	}
 
 	if isStreamMode {
 		lmp.initPeriodicFlush()
@@ -0,0 +1,57 @@
+package insertutil
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestGetCommonParamsPipeline(t *testing.T) {
+	defaultPipelineOrig := defaultPipeline
+	defer func() {
+		defaultPipeline = defaultPipelineOrig
+	}()
+
+	f := func(insertPipeline, requestPipeline, resultExpected string) {
+		t.Helper()
+
+		defaultPipeline = nil
+		if insertPipeline != "" {
+			ip, err := logstorage.ParseIngestionPipeline(insertPipeline)
+			if err != nil {
+				t.Fatalf("cannot parse -insert.pipeline: %s", err)
+			}
+			defaultPipeline = ip
+		}
+
+		r, err := http.NewRequest(http.MethodPost, "http://localhost/insert/jsonline?pipeline="+url.QueryEscape(requestPipeline), nil)
+		if err != nil {
+			t.Fatalf("cannot create request: %s", err)
+		}
+		cp, err := GetCommonParams(r)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		result := ""
+		if cp.Pipeline != nil {
+			result = cp.Pipeline.String()
+		}
+		if result != resultExpected {
+			t.Fatalf("unexpected pipeline;\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	// no pipelines
+	f(``, ``, ``)
+
+	// only -insert.pipeline
+	f(`delete password`, ``, `delete password`)
+
+	// only the pipeline from the request
+	f(``, `unpack_json`, `unpack_json`)
+
+	// -insert.pipeline must be applied before the pipeline from the request
+	f(`delete password`, `unpack_json | filter level:error`, `delete password | unpack_json | filter level:error`)
+}
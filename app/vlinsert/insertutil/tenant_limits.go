@@ -0,0 +1,204 @@
+package insertutil
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+var (
+	maxIngestedBytesPerSecond = flagutil.NewArrayString("tenant.maxIngestedBytesPerSecond", "Optional limit on the size of the ingested logs per second per tenant. "+
+		"It can be set either in the form 'limit' for all the tenants or in the form 'accountID:projectID:limit' for the given tenant; for example, "+
+		"-tenant.maxIngestedBytesPerSecond=1MiB -tenant.maxIngestedBytesPerSecond=12:34:10MiB . "+
+		"Data ingestion requests for tenants exceeding the limit are rejected with 429 Too Many Requests; see https://docs.victoriametrics.com/victorialogs/#tenant-limits")
+	maxIngestedRowsPerSecond = flagutil.NewArrayString("tenant.maxIngestedRowsPerSecond", "Optional limit on the number of the ingested log entries per second per tenant. "+
+		"It can be set either in the form 'limit' for all the tenants or in the form 'accountID:projectID:limit' for the given tenant; for example, "+
+		"-tenant.maxIngestedRowsPerSecond=10000 -tenant.maxIngestedRowsPerSecond=12:34:100000 . "+
+		"Data ingestion requests for tenants exceeding the limit are rejected with 429 Too Many Requests; see https://docs.victoriametrics.com/victorialogs/#tenant-limits")
+)
+
+const (
+	tenantLimitReasonBytesPerSecond = "bytes_per_second"
+	tenantLimitReasonRowsPerSecond  = "rows_per_second"
+)
+
+var (
+	maxIngestedBytesPerSecondLimits *logstorage.TenantLimits
+	maxIngestedRowsPerSecondLimits  *logstorage.TenantLimits
+)
+
+func mustInitTenantLimits() {
+	var err error
+	maxIngestedBytesPerSecondLimits, err = logstorage.ParseTenantLimits(*maxIngestedBytesPerSecond, parseBytes)
+	if err != nil {
+		logger.Fatalf("cannot parse -tenant.maxIngestedBytesPerSecond: %s", err)
+	}
+	maxIngestedRowsPerSecondLimits, err = logstorage.ParseTenantLimits(*maxIngestedRowsPerSecond, parseInt)
+	if err != nil {
+		logger.Fatalf("cannot parse -tenant.maxIngestedRowsPerSecond: %s", err)
+	}
+}
+
+func parseBytes(s string) (int64, error) {
+	var b flagutil.Bytes
+	if err := b.Set(s); err != nil {
+		return 0, err
+	}
+	return b.N, nil
+}
+
+func parseInt(s string) (int64, error) {
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// CheckTenantLimits returns non-nil error if logs for the given tenantID cannot be ingested because of tenant limits.
+//
+// The returned error has http.StatusTooManyRequests status code.
+//
+// See https://docs.victoriametrics.com/victorialogs/#tenant-limits
+func CheckTenantLimits(tenantID logstorage.TenantID) error {
+	if tl := getTenantLimiter(tenantID); tl != nil {
+		if reason := tl.getExceededLimit(time.Now()); reason != "" {
+			logstorage.GetTenantRejectedRequestsCounter(tenantID, reason).Inc()
+			return &httpserver.ErrorWithStatusCode{
+				Err: fmt.Errorf("cannot ingest logs for the tenant %d:%d, since it exceeds the limit on %s; "+
+					"see https://docs.victoriametrics.com/victorialogs/#tenant-limits", tenantID.AccountID, tenantID.ProjectID, reason),
+				StatusCode: http.StatusTooManyRequests,
+			}
+		}
+	}
+	return logRowsStorage.CanWriteTenantData(tenantID)
+}
+
+// CheckRowsDroppedByTenantLimits returns non-nil error if lmp has dropped some logs, since they exceed the ingestion rate limits for the tenant.
+//
+// The returned error has http.StatusTooManyRequests status code, so the client could notice that not all the logs were ingested.
+// It must be called after lmp.MustClose().
+//
+// See https://docs.victoriametrics.com/victorialogs/#tenant-limits
+func CheckRowsDroppedByTenantLimits(lmp LogMessageProcessor) error {
+	p, ok := lmp.(*logMessageProcessor)
+	if !ok || p.rowsDroppedByTenantLimits == 0 {
+		return nil
+	}
+	tenantID := p.cp.TenantID
+	return &httpserver.ErrorWithStatusCode{
+		Err: fmt.Errorf("dropped %d log entries for the tenant %d:%d, since it exceeds the limit on the ingestion rate; "+
+			"see https://docs.victoriametrics.com/victorialogs/#tenant-limits", p.rowsDroppedByTenantLimits, tenantID.AccountID, tenantID.ProjectID),
+		StatusCode: http.StatusTooManyRequests,
+	}
+}
+
+// tenantLimiter limits data ingestion rate for a single tenant.
+//
+// It uses token bucket algorithm with the bucket size equal to the per-second limit.
+type tenantLimiter struct {
+	tenantID logstorage.TenantID
+
+	maxBytesPerSecond float64
+	maxRowsPerSecond  float64
+
+	mu sync.Mutex
+
+	// bytesAvailable is the number of bytes, which can be ingested at the moment.
+	//
+	// It may become negative if the last ingested rows exceed the limit.
+	bytesAvailable float64
+
+	// rowsAvailable is the number of rows, which can be ingested at the moment.
+	//
+	// It may become negative if the last ingested rows exceed the limit.
+	rowsAvailable float64
+
+	// lastUpdateTime is the last time bytesAvailable and rowsAvailable were updated.
+	lastUpdateTime time.Time
+}
+
+var (
+	tenantLimitersLock sync.Mutex
+	tenantLimiters     = make(map[logstorage.TenantID]*tenantLimiter)
+)
+
+// getTenantLimiter returns tenantLimiter for the given tenantID.
+//
+// nil is returned if the tenantID has no rate limits.
+func getTenantLimiter(tenantID logstorage.TenantID) *tenantLimiter {
+	maxBytesPerSecond := maxIngestedBytesPerSecondLimits.Get(tenantID)
+	maxRowsPerSecond := maxIngestedRowsPerSecondLimits.Get(tenantID)
+	if maxBytesPerSecond <= 0 && maxRowsPerSecond <= 0 {
+		return nil
+	}
+
+	tenantLimitersLock.Lock()
+	defer tenantLimitersLock.Unlock()
+
+	tl := tenantLimiters[tenantID]
+	if tl == nil {
+		tl = &tenantLimiter{
+			tenantID:          tenantID,
+			maxBytesPerSecond: float64(maxBytesPerSecond),
+			maxRowsPerSecond:  float64(maxRowsPerSecond),
+			bytesAvailable:    float64(maxBytesPerSecond),
+			rowsAvailable:     float64(maxRowsPerSecond),
+			lastUpdateTime:    time.Now(),
+		}
+		tenantLimiters[tenantID] = tl
+	}
+	return tl
+}
+
+// tryAddRow returns true if the row with the given rowSize can be ingested at the given time.
+func (tl *tenantLimiter) tryAddRow(rowSize uint64, currentTime time.Time) bool {
+	tl.mu.Lock()
+	reason := tl.getExceededLimitLocked(currentTime)
+	if reason == "" {
+		tl.bytesAvailable -= float64(rowSize)
+		tl.rowsAvailable--
+	}
+	tl.mu.Unlock()
+
+	if reason != "" {
+		logstorage.GetTenantRejectedRowsCounter(tl.tenantID, reason).Inc()
+		tenantLimitsLogger.Warnf("dropping log entries for the tenant %d:%d, since it exceeds the limit on %s; "+
+			"see https://docs.victoriametrics.com/victorialogs/#tenant-limits", tl.tenantID.AccountID, tl.tenantID.ProjectID, reason)
+		return false
+	}
+	return true
+}
+
+// getExceededLimit returns the name for the limit exceeded by tl at the given time.
+//
+// An empty string is returned if tl doesn't exceed limits.
+func (tl *tenantLimiter) getExceededLimit(currentTime time.Time) string {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+
+	return tl.getExceededLimitLocked(currentTime)
+}
+
+func (tl *tenantLimiter) getExceededLimitLocked(currentTime time.Time) string {
+	d := currentTime.Sub(tl.lastUpdateTime).Seconds()
+	if d > 0 {
+		tl.bytesAvailable = min(tl.bytesAvailable+d*tl.maxBytesPerSecond, tl.maxBytesPerSecond)
+		tl.rowsAvailable = min(tl.rowsAvailable+d*tl.maxRowsPerSecond, tl.maxRowsPerSecond)
+		tl.lastUpdateTime = currentTime
+	}
+
+	if tl.maxBytesPerSecond > 0 && tl.bytesAvailable <= 0 {
+		return tenantLimitReasonBytesPerSecond
+	}
+	if tl.maxRowsPerSecond > 0 && tl.rowsAvailable <= 0 {
+		return tenantLimitReasonRowsPerSecond
+	}
+	return ""
+}
+
+var tenantLimitsLogger = logger.WithThrottler("tenant_limits", 5*time.Second)
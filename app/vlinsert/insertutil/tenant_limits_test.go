@@ -0,0 +1,109 @@
+package insertutil
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestTenantLimiter(t *testing.T) {
+	startTime := time.Unix(1000, 0)
+	tl := &tenantLimiter{
+		tenantID:          logstorage.TenantID{AccountID: 12, ProjectID: 34},
+		maxBytesPerSecond: 1000,
+		maxRowsPerSecond:  5,
+		bytesAvailable:    1000,
+		rowsAvailable:     5,
+		lastUpdateTime:    startTime,
+	}
+
+	f := func(rowSize uint64, currentTime time.Time, resultExpected bool, limitExpected string) {
+		t.Helper()
+
+		result := tl.tryAddRow(rowSize, currentTime)
+		if result != resultExpected {
+			t.Fatalf("unexpected tryAddRow result; got %v; want %v", result, resultExpected)
+		}
+		limit := tl.getExceededLimit(currentTime)
+		if limit != limitExpected {
+			t.Fatalf("unexpected exceeded limit; got %q; want %q", limit, limitExpected)
+		}
+	}
+
+	// The limit on rows per second
+	for i := 0; i < 4; i++ {
+		f(10, startTime, true, "")
+	}
+	f(10, startTime, true, "rows_per_second")
+	f(10, startTime, false, "rows_per_second")
+
+	// The limit is restored after a second
+	startTime = startTime.Add(time.Second)
+	f(10, startTime, true, "")
+
+	// The limit on bytes per second
+	f(1000, startTime, true, "bytes_per_second")
+	f(10, startTime, false, "bytes_per_second")
+
+	// The available bytes are restored gradually
+	startTime = startTime.Add(5 * time.Millisecond)
+	f(10, startTime, false, "bytes_per_second")
+	startTime = startTime.Add(time.Second)
+	f(10, startTime, true, "")
+}
+
+func TestCheckRowsDroppedByTenantLimits(t *testing.T) {
+	tenantID := logstorage.TenantID{AccountID: 12, ProjectID: 34}
+	lmp := &logMessageProcessor{
+		cp: &CommonParams{
+			TenantID: tenantID,
+		},
+		lr: logstorage.GetLogRows(nil, nil, nil, nil, ""),
+		tl: &tenantLimiter{
+			tenantID:         tenantID,
+			maxRowsPerSecond: 2,
+			rowsAvailable:    2,
+			lastUpdateTime:   time.Now(),
+		},
+	}
+	defer logstorage.PutLogRows(lmp.lr)
+
+	fields := []logstorage.Field{
+		{
+			Name:  "_msg",
+			Value: "foo",
+		},
+	}
+
+	// Rows within the limit
+	lmp.addRowLocked(0, fields, nil)
+	if err := CheckRowsDroppedByTenantLimits(lmp); err != nil {
+		t.Fatalf("unexpected error for rows within the limit: %s", err)
+	}
+
+	// Rows exceeding the limit must result in 429 error
+	for i := 0; i < 3; i++ {
+		lmp.addRowLocked(0, fields, nil)
+	}
+	if lmp.rowsDroppedByTenantLimits == 0 {
+		t.Fatalf("expecting non-zero number of dropped rows")
+	}
+	err := CheckRowsDroppedByTenantLimits(lmp)
+	var esc *httpserver.ErrorWithStatusCode
+	if !errors.As(err, &esc) {
+		t.Fatalf("expecting error with status code; got %v", err)
+	}
+	if esc.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("unexpected status code; got %d; want %d", esc.StatusCode, http.StatusTooManyRequests)
+	}
+
+	// Other LogMessageProcessor implementations do not drop rows
+	if err := CheckRowsDroppedByTenantLimits(&TestLogMessageProcessor{}); err != nil {
+		t.Fatalf("unexpected error for TestLogMessageProcessor: %s", err)
+	}
+}
@@ -3,6 +3,7 @@ package internalinsert
 import (
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
@@ -44,11 +45,12 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	tenantIDs := make(map[logstorage.TenantID]struct{})
 	encoding := r.Header.Get("Content-Encoding")
 	err = protoparserutil.ReadUncompressedData(r.Body, encoding, maxRequestSize, func(data []byte) error {
 		lmp := cp.NewLogMessageProcessor("internalinsert", false)
 		irp := lmp.(insertutil.InsertRowProcessor)
-		err := parseData(irp, data)
+		err := parseData(irp, data, tenantIDs)
 		lmp.MustClose()
 		return err
 	})
@@ -58,10 +60,17 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Report tenants exceeding the limits on the stored logs, so vlinsert could reject data ingestion requests for them
+	// with 429 Too Many Requests. Log entries for such tenants are dropped by the storage.
+	if h := getRejectedTenantsHeader(tenantIDs); h != "" {
+		w.Header().Set(netinsert.RejectedTenantsHeader, h)
+	}
+
 	requestDuration.UpdateDuration(startTime)
 }
 
-func parseData(irp insertutil.InsertRowProcessor, data []byte) error {
+// parseData parses rows from data, passes them to irp and registers their tenants at tenantIDs.
+func parseData(irp insertutil.InsertRowProcessor, data []byte, tenantIDs map[logstorage.TenantID]struct{}) error {
 	r := logstorage.GetInsertRow()
 	src := data
 	i := 0
@@ -73,6 +82,7 @@ func parseData(irp insertutil.InsertRowProcessor, data []byte) error {
 		src = tail
 		i++
 
+		tenantIDs[r.TenantID] = struct{}{}
 		irp.AddInsertRow(r)
 	}
 	logstorage.PutInsertRow(r)
@@ -80,6 +90,16 @@ func parseData(irp insertutil.InsertRowProcessor, data []byte) error {
 	return nil
 }
 
+func getRejectedTenantsHeader(tenantIDs map[logstorage.TenantID]struct{}) string {
+	var rejected []string
+	for tenantID := range tenantIDs {
+		if err := insertutil.CanWriteTenantData(tenantID); err != nil {
+			rejected = append(rejected, fmt.Sprintf("%d:%d", tenantID.AccountID, tenantID.ProjectID))
+		}
+	}
+	return strings.Join(rejected, ",")
+}
+
 var (
 	requestsTotal = metrics.NewCounter(`vl_http_requests_total{path="/internal/insert"}`)
 	errorsTotal   = metrics.NewCounter(`vl_http_errors_total{path="/internal/insert"}`)
@@ -112,6 +112,11 @@ func handleJournald(r *http.Request, w http.ResponseWriter) {
 		httpserver.Errorf(w, r, "%s", err)
 		return
 	}
+	if err := insertutil.CheckTenantLimits(cp.TenantID); err != nil {
+		errorsTotal.Inc()
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
 
 	encoding := r.Header.Get("Content-Encoding")
 	reader, err := protoparserutil.GetUncompressedReader(r.Body, encoding)
@@ -126,6 +131,9 @@ func handleJournald(r *http.Request, w http.ResponseWriter) {
 	err = processStreamInternal(streamName, reader, lmp, cp)
 	protoparserutil.PutUncompressedReader(reader)
 	lmp.MustClose()
+	if err == nil {
+		err = insertutil.CheckRowsDroppedByTenantLimits(lmp)
+	}
 	if err != nil {
 		errorsTotal.Inc()
 		httpserver.Errorf(w, r, "cannot read journald protocol data: %s", err)
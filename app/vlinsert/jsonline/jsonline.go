@@ -37,6 +37,10 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) {
 		httpserver.Errorf(w, r, "%s", err)
 		return
 	}
+	if err := insertutil.CheckTenantLimits(cp.TenantID); err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
 
 	encoding := r.Header.Get("Content-Encoding")
 	reader, err := protoparserutil.GetUncompressedReader(r.Body, encoding)
@@ -50,6 +54,9 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) {
 	streamName := fmt.Sprintf("remoteAddr=%s, requestURI=%q", httpserver.GetQuotedRemoteAddr(r), r.RequestURI)
 	err = processStreamInternal(streamName, reader, cp.TimeFields, cp.MsgFields, lmp)
 	lmp.MustClose()
+	if err == nil {
+		err = insertutil.CheckRowsDroppedByTenantLimits(lmp)
+	}
 	if err != nil {
 		httpserver.Errorf(w, r, "cannot process jsonline request; error: %s", err)
 		return
@@ -58,6 +65,13 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) {
 	requestDuration.UpdateDuration(startTime)
 }
 
+// ProcessStream parses jsonline-encoded logs from r and sends them to lmp.
+//
+// It is used by data ingestion protocols, which transfer logs in jsonline format, such as Kafka.
+func ProcessStream(streamName string, r io.Reader, timeFields, msgFields []string, lmp insertutil.LogMessageProcessor) error {
+	return processStreamInternal(streamName, r, timeFields, msgFields, lmp)
+}
+
 func processStreamInternal(streamName string, r io.Reader, timeFields, msgFields []string, lmp insertutil.LogMessageProcessor) error {
 	wcr := writeconcurrencylimiter.GetReader(r)
 	defer writeconcurrencylimiter.PutReader(wcr)
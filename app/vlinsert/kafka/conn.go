@@ -0,0 +1,120 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	// dialTimeout is the timeout for establishing connections to Kafka brokers.
+	dialTimeout = 10 * time.Second
+
+	// callTimeout is the timeout for a single request to Kafka broker. It must exceed fetchMaxWait.
+	callTimeout = 30 * time.Second
+
+	// maxResponseSize is the maximum size of Kafka response.
+	maxResponseSize = 64 * 1024 * 1024
+
+	// clientID is sent to Kafka brokers in every request.
+	clientID = "victorialogs"
+)
+
+// requestEncoder is Kafka request body.
+type requestEncoder interface {
+	encode(e *encoder)
+}
+
+// responseDecoder is Kafka response body.
+type responseDecoder interface {
+	decode(d *decoder)
+}
+
+// brokerConn is a connection to Kafka broker.
+//
+// It cannot be used from concurrently running goroutines.
+type brokerConn struct {
+	addr string
+	c    net.Conn
+
+	correlationID int32
+
+	reqBuf  []byte
+	respBuf []byte
+}
+
+func dialBroker(addr string) (*brokerConn, error) {
+	c, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to Kafka broker %q: %w", addr, err)
+	}
+	bc := &brokerConn{
+		addr: addr,
+		c:    c,
+	}
+	return bc, nil
+}
+
+func (bc *brokerConn) close() {
+	_ = bc.c.Close()
+}
+
+// call sends req with the given apiKey and apiVersion to the broker and reads the response into resp.
+//
+// resp may refer to the internal buffer of bc, so it must be used only until the next call.
+func (bc *brokerConn) call(apiKey, apiVersion int16, req requestEncoder, resp responseDecoder) error {
+	bc.correlationID++
+	h := &requestHeader{
+		apiKey:        apiKey,
+		apiVersion:    apiVersion,
+		correlationID: bc.correlationID,
+		clientID:      clientID,
+	}
+
+	// Reserve space for the message size
+	e := &encoder{
+		b: append(bc.reqBuf[:0], 0, 0, 0, 0),
+	}
+	h.encode(e)
+	req.encode(e)
+	binary.BigEndian.PutUint32(e.b, uint32(len(e.b)-4))
+	bc.reqBuf = e.b
+
+	if err := bc.c.SetDeadline(time.Now().Add(callTimeout)); err != nil {
+		return fmt.Errorf("cannot set deadline for connection to Kafka broker %q: %w", bc.addr, err)
+	}
+	if _, err := bc.c.Write(e.b); err != nil {
+		return fmt.Errorf("cannot send request to Kafka broker %q: %w", bc.addr, err)
+	}
+
+	var sizeBuf [4]byte
+	if _, err := io.ReadFull(bc.c, sizeBuf[:]); err != nil {
+		return fmt.Errorf("cannot read response size from Kafka broker %q: %w", bc.addr, err)
+	}
+	size := binary.BigEndian.Uint32(sizeBuf[:])
+	if size < 4 || size > maxResponseSize {
+		return fmt.Errorf("unexpected response size from Kafka broker %q: %d bytes; it must be in the range [4..%d]", bc.addr, size, maxResponseSize)
+	}
+	if n := int(size); cap(bc.respBuf) < n {
+		bc.respBuf = make([]byte, n)
+	}
+	bc.respBuf = bc.respBuf[:size]
+	if _, err := io.ReadFull(bc.c, bc.respBuf); err != nil {
+		return fmt.Errorf("cannot read response from Kafka broker %q: %w", bc.addr, err)
+	}
+
+	d := &decoder{
+		b: bc.respBuf,
+	}
+	correlationID := d.int32()
+	if correlationID != bc.correlationID {
+		return fmt.Errorf("unexpected correlation_id in response from Kafka broker %q; got %d; want %d", bc.addr, correlationID, bc.correlationID)
+	}
+	resp.decode(d)
+	if d.err != nil {
+		return fmt.Errorf("cannot parse response from Kafka broker %q for api_key=%d: %w", bc.addr, apiKey, d.err)
+	}
+	return nil
+}
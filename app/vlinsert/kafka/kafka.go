@@ -0,0 +1,668 @@
+package kafka
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/jsonline"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/syslog"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+var (
+	brokers = flagutil.NewArrayString("kafka.consumer.brokers", "Comma-separated list of Kafka broker addresses to consume logs from. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/kafka/")
+	topics = flagutil.NewArrayString("kafka.consumer.topic", "Kafka topics to consume logs from. Every topic may have its own settings "+
+		"via the corresponding -kafka.consumer.* flags. See https://docs.victoriametrics.com/victorialogs/data-ingestion/kafka/")
+	initialOffset = flag.String("kafka.consumer.initialOffset", "oldest", "The offset to start consuming Kafka partitions from if the consumer group has no committed offsets for them. "+
+		"Supported values: oldest, newest. See https://docs.victoriametrics.com/victorialogs/data-ingestion/kafka/#offsets")
+
+	partitions = flagutil.NewArrayString("kafka.consumer.partitions", "Optional list of partitions to consume for the corresponding -kafka.consumer.topic in JSON array format, for example, [0,1,2]. "+
+		"All the topic partitions are consumed by default. See https://docs.victoriametrics.com/victorialogs/data-ingestion/kafka/#partitions")
+	groupID = flagutil.NewArrayString("kafka.consumer.groupID", "Consumer group for committing offsets for the corresponding -kafka.consumer.topic. "+
+		"The 'victorialogs' consumer group is used by default. See https://docs.victoriametrics.com/victorialogs/data-ingestion/kafka/#offsets")
+	format = flagutil.NewArrayString("kafka.consumer.format", "The format of Kafka messages for the corresponding -kafka.consumer.topic. "+
+		"Supported values: jsonline, logfmt, syslog. The jsonline format is used by default. See https://docs.victoriametrics.com/victorialogs/data-ingestion/kafka/#message-formats")
+
+	timeFields = flagutil.NewArrayString("kafka.consumer.timeFields", "Fields to use as log timestamp for logs ingested via the corresponding -kafka.consumer.topic in JSON array format. "+
+		"The _time field is used by default. See https://docs.victoriametrics.com/victorialogs/data-ingestion/kafka/#message-formats")
+	msgFields = flagutil.NewArrayString("kafka.consumer.msgFields", "Fields to use as log message for logs ingested via the corresponding -kafka.consumer.topic in JSON array format. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/kafka/#message-formats")
+	streamFields = flagutil.NewArrayString("kafka.consumer.streamFields", "Fields to use as log stream labels for logs ingested via the corresponding -kafka.consumer.topic in JSON array format. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/kafka/#stream-fields")
+	ignoreFields = flagutil.NewArrayString("kafka.consumer.ignoreFields", "Fields to ignore at logs ingested via the corresponding -kafka.consumer.topic in JSON array format. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/kafka/#dropping-fields")
+	decolorizeFields = flagutil.NewArrayString("kafka.consumer.decolorizeFields", "Fields to remove ANSI color codes across logs ingested via the corresponding -kafka.consumer.topic "+
+		"in JSON array format. See https://docs.victoriametrics.com/victorialogs/data-ingestion/kafka/#decolorizing-fields")
+	extraFields = flagutil.NewArrayString("kafka.consumer.extraFields", "Fields to add to logs ingested via the corresponding -kafka.consumer.topic in JSON object format. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/kafka/#adding-extra-fields")
+	tenantID = flagutil.NewArrayString("kafka.consumer.tenantID", "TenantID for logs ingested via the corresponding -kafka.consumer.topic. "+
+		"See https://docs.victoriametrics.com/victorialogs/data-ingestion/kafka/#multitenancy")
+)
+
+const (
+	// fetchMaxWait is the maximum duration Kafka broker waits for new messages before returning an empty fetch response.
+	fetchMaxWait = 500 * time.Millisecond
+
+	// fetchMaxBytes is the maximum size of fetch response.
+	//
+	// Kafka broker returns the first record batch even if it exceeds fetchMaxBytes.
+	fetchMaxBytes = 4 * 1024 * 1024
+
+	// retryInterval is the interval between attempts to recover from errors.
+	retryInterval = time.Second
+)
+
+// MustInit starts consuming logs from -kafka.consumer.topic at -kafka.consumer.brokers.
+//
+// This function must be called after flag.Parse().
+//
+// MustStop() must be called in order to free up resources occupied by the initialized consumers.
+func MustInit() {
+	if workersStopCh != nil {
+		logger.Panicf("BUG: MustInit() called twice without MustStop() call")
+	}
+	workersStopCh = make(chan struct{})
+
+	if len(*topics) == 0 {
+		return
+	}
+	if len(*brokers) == 0 {
+		logger.Fatalf("-kafka.consumer.brokers must be set when -kafka.consumer.topic is set")
+	}
+
+	var startOffset int64
+	switch *initialOffset {
+	case "oldest":
+		startOffset = offsetOldest
+	case "newest":
+		startOffset = offsetNewest
+	default:
+		logger.Fatalf("unsupported -kafka.consumer.initialOffset=%q; supported values: oldest, newest", *initialOffset)
+	}
+
+	for argIdx, topic := range *topics {
+		cfg, err := getConfig(topic, argIdx)
+		if err != nil {
+			logger.Fatalf("cannot initialize Kafka consumer for -kafka.consumer.topic=%q: %s", topic, err)
+		}
+		cfg.brokers = *brokers
+		cfg.initialOffset = startOffset
+		cfg.newLogMessageProcessor = func() insertutil.LogMessageProcessor {
+			return cfg.cp.NewLogMessageProcessor("kafka", false)
+		}
+
+		workersWG.Add(1)
+		go func() {
+			runTopicConsumer(cfg, workersStopCh)
+			workersWG.Done()
+		}()
+	}
+}
+
+var (
+	workersWG     sync.WaitGroup
+	workersStopCh chan struct{}
+)
+
+// MustStop stops Kafka consumers started via MustInit().
+func MustStop() {
+	close(workersStopCh)
+	workersWG.Wait()
+	workersStopCh = nil
+}
+
+const (
+	// offsetOldest is the ListOffsets timestamp for obtaining the oldest available offset.
+	offsetOldest = -2
+
+	// offsetNewest is the ListOffsets timestamp for obtaining the offset of the next produced message.
+	offsetNewest = -1
+)
+
+// config contains settings for consuming a single Kafka topic.
+type config struct {
+	brokers []string
+
+	topic         string
+	partitions    []int32
+	groupID       string
+	format        string
+	initialOffset int64
+
+	cp *insertutil.CommonParams
+
+	// newLogMessageProcessor must return LogMessageProcessor for the fetched messages.
+	newLogMessageProcessor func() insertutil.LogMessageProcessor
+}
+
+func getConfig(topic string, argIdx int) (*config, error) {
+	partitionsStr := partitions.GetOptionalArg(argIdx)
+	var ps []int32
+	if partitionsStr != "" {
+		if err := json.Unmarshal([]byte(partitionsStr), &ps); err != nil {
+			return nil, fmt.Errorf("cannot parse -kafka.consumer.partitions=%q: %w", partitionsStr, err)
+		}
+	}
+
+	group := groupID.GetOptionalArg(argIdx)
+	if group == "" {
+		group = "victorialogs"
+	}
+
+	f := format.GetOptionalArg(argIdx)
+	switch f {
+	case "":
+		f = "jsonline"
+	case "jsonline", "logfmt", "syslog":
+	default:
+		return nil, fmt.Errorf("unsupported -kafka.consumer.format=%q; supported values: jsonline, logfmt, syslog", f)
+	}
+
+	timeFieldsStr := timeFields.GetOptionalArg(argIdx)
+	tfs, err := parseFieldsList(timeFieldsStr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -kafka.consumer.timeFields=%q: %w", timeFieldsStr, err)
+	}
+
+	msgFieldsStr := msgFields.GetOptionalArg(argIdx)
+	mfs, err := parseFieldsList(msgFieldsStr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -kafka.consumer.msgFields=%q: %w", msgFieldsStr, err)
+	}
+
+	streamFieldsStr := streamFields.GetOptionalArg(argIdx)
+	sfs, err := parseFieldsList(streamFieldsStr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -kafka.consumer.streamFields=%q: %w", streamFieldsStr, err)
+	}
+
+	ignoreFieldsStr := ignoreFields.GetOptionalArg(argIdx)
+	ifs, err := parseFieldsList(ignoreFieldsStr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -kafka.consumer.ignoreFields=%q: %w", ignoreFieldsStr, err)
+	}
+
+	decolorizeFieldsStr := decolorizeFields.GetOptionalArg(argIdx)
+	dfs, err := parseFieldsList(decolorizeFieldsStr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -kafka.consumer.decolorizeFields=%q: %w", decolorizeFieldsStr, err)
+	}
+
+	extraFieldsStr := extraFields.GetOptionalArg(argIdx)
+	efs, err := parseExtraFields(extraFieldsStr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -kafka.consumer.extraFields=%q: %w", extraFieldsStr, err)
+	}
+
+	tenantIDStr := tenantID.GetOptionalArg(argIdx)
+	tid, err := logstorage.ParseTenantID(tenantIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -kafka.consumer.tenantID=%q: %w", tenantIDStr, err)
+	}
+
+	cfg := &config{
+		topic:      topic,
+		partitions: ps,
+		groupID:    group,
+		format:     f,
+		cp:         insertutil.NewCommonParams(tid, tfs, mfs, sfs, ifs, dfs, efs),
+	}
+	return cfg, nil
+}
+
+func parseFieldsList(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var a []string
+	err := json.Unmarshal([]byte(s), &a)
+	return a, err
+}
+
+func parseExtraFields(s string) ([]logstorage.Field, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var m map[string]string
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		return nil, err
+	}
+	fields := make([]logstorage.Field, 0, len(m))
+	for k, v := range m {
+		fields = append(fields, logstorage.Field{
+			Name:  k,
+			Value: v,
+		})
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Name < fields[j].Name
+	})
+	return fields, nil
+}
+
+// runTopicConsumer consumes cfg.topic until stopCh is closed.
+func runTopicConsumer(cfg *config, stopCh <-chan struct{}) {
+	ps := cfg.partitions
+	for len(ps) == 0 {
+		var err error
+		ps, err = getTopicPartitions(cfg.brokers, cfg.topic)
+		if err == nil {
+			break
+		}
+		logger.Errorf("cannot obtain partitions for Kafka topic %q: %s; retrying in %s", cfg.topic, err, retryInterval)
+		if !sleepOrStop(retryInterval, stopCh) {
+			return
+		}
+	}
+	logger.Infof("started consuming Kafka topic %q partitions %v at %s", cfg.topic, ps, cfg.brokers)
+
+	var wg sync.WaitGroup
+	for _, partition := range ps {
+		wg.Add(1)
+		go func(partition int32) {
+			defer wg.Done()
+			pc := newPartitionConsumer(cfg, partition)
+			pc.run(stopCh)
+		}(partition)
+	}
+	wg.Wait()
+}
+
+// getTopicPartitions returns all the partitions for the given topic.
+func getTopicPartitions(brokerAddrs []string, topic string) ([]int32, error) {
+	resp, err := getMetadata(brokerAddrs, topic)
+	if err != nil {
+		return nil, err
+	}
+	t, err := getMetadataTopic(resp, topic)
+	if err != nil {
+		return nil, err
+	}
+	ps := make([]int32, 0, len(t.partitions))
+	for _, p := range t.partitions {
+		ps = append(ps, p.partition)
+	}
+	sort.Slice(ps, func(i, j int) bool {
+		return ps[i] < ps[j]
+	})
+	return ps, nil
+}
+
+func getMetadata(brokerAddrs []string, topic string) (*metadataResponse, error) {
+	var lastErr error
+	for _, addr := range brokerAddrs {
+		bc, err := dialBroker(addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		req := &metadataRequest{
+			topics: []string{topic},
+		}
+		var resp metadataResponse
+		err = bc.call(apiKeyMetadata, apiVersionMetadata, req, &resp)
+		bc.close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return &resp, nil
+	}
+	return nil, fmt.Errorf("cannot obtain metadata from Kafka brokers %s: %w", brokerAddrs, lastErr)
+}
+
+func getMetadataTopic(resp *metadataResponse, topic string) (*metadataTopic, error) {
+	for i := range resp.topics {
+		t := &resp.topics[i]
+		if t.name != topic {
+			continue
+		}
+		if err := newKafkaError(t.errorCode); err != nil {
+			return nil, fmt.Errorf("cannot obtain metadata for topic %q: %w", topic, err)
+		}
+		return t, nil
+	}
+	return nil, fmt.Errorf("missing metadata for topic %q", topic)
+}
+
+// partitionConsumer consumes a single partition of Kafka topic.
+type partitionConsumer struct {
+	cfg       *config
+	partition int32
+
+	// offset is the offset of the next message to consume. It is set to -1 if the offset is unknown yet.
+	offset int64
+
+	leader      *brokerConn
+	coordinator *brokerConn
+
+	buf []byte
+
+	messagesRead *metrics.Counter
+	errors       *metrics.Counter
+	commits      *metrics.Counter
+}
+
+func newPartitionConsumer(cfg *config, partition int32) *partitionConsumer {
+	return &partitionConsumer{
+		cfg:       cfg,
+		partition: partition,
+		offset:    -1,
+
+		messagesRead: metrics.GetOrCreateCounter(fmt.Sprintf(`vl_kafka_messages_read_total{topic=%q}`, cfg.topic)),
+		errors:       metrics.GetOrCreateCounter(fmt.Sprintf(`vl_kafka_errors_total{topic=%q}`, cfg.topic)),
+		commits:      metrics.GetOrCreateCounter(fmt.Sprintf(`vl_kafka_offset_commits_total{topic=%q}`, cfg.topic)),
+	}
+}
+
+// run consumes pc.partition until stopCh is closed.
+func (pc *partitionConsumer) run(stopCh <-chan struct{}) {
+	defer pc.closeConns()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+
+		if err := pc.consumeNext(); err != nil {
+			pc.errors.Inc()
+			logger.Errorf("error when consuming Kafka topic %q partition %d: %s; retrying in %s", pc.cfg.topic, pc.partition, err, retryInterval)
+			pc.closeConns()
+			if !sleepOrStop(retryInterval, stopCh) {
+				return
+			}
+		}
+	}
+}
+
+// consumeNext fetches the next portion of messages from pc.partition, ingests them and commits the next offset.
+func (pc *partitionConsumer) consumeNext() error {
+	if err := pc.connect(); err != nil {
+		return err
+	}
+	if pc.offset < 0 {
+		offset, err := pc.getInitialOffset()
+		if err != nil {
+			return err
+		}
+		pc.offset = offset
+	}
+
+	req := &fetchRequest{
+		topic:     pc.cfg.topic,
+		partition: pc.partition,
+		offset:    pc.offset,
+		maxWaitMs: int32(fetchMaxWait.Milliseconds()),
+		maxBytes:  fetchMaxBytes,
+	}
+	var resp fetchResponse
+	if err := pc.leader.call(apiKeyFetch, apiVersionFetch, req, &resp); err != nil {
+		return fmt.Errorf("cannot fetch messages: %w", err)
+	}
+	switch resp.errorCode {
+	case errCodeNone:
+	case errCodeOffsetOutOfRange:
+		logger.Warnf("the offset %d is out of range for Kafka topic %q partition %d; resetting it to -kafka.consumer.initialOffset=%s",
+			pc.offset, pc.cfg.topic, pc.partition, *initialOffset)
+		offset, err := pc.listOffset(pc.cfg.initialOffset)
+		if err != nil {
+			return err
+		}
+		pc.offset = offset
+		return nil
+	default:
+		return fmt.Errorf("cannot fetch messages at offset %d: %w", pc.offset, newKafkaError(resp.errorCode))
+	}
+
+	nextOffset, err := pc.processRecords(resp.records)
+	if err != nil {
+		return err
+	}
+	if nextOffset == pc.offset {
+		// Nothing to commit
+		return nil
+	}
+
+	// Commit the offset only after the messages are ingested, so they are re-read after the restart if the commit fails.
+	if err := pc.commitOffset(nextOffset); err != nil {
+		// The messages have been already ingested, so do not re-read them.
+		pc.offset = nextOffset
+		return err
+	}
+	pc.offset = nextOffset
+	return nil
+}
+
+// processRecords ingests messages from record batches in data and returns the offset of the next message to fetch.
+func (pc *partitionConsumer) processRecords(data []byte) (int64, error) {
+	buf := pc.buf[:0]
+	messages := 0
+	nextOffset, err := parseRecordBatches(data, pc.offset, func(r *record) error {
+		messages++
+		if len(r.value) == 0 {
+			return nil
+		}
+		buf = append(buf, r.value...)
+		if buf[len(buf)-1] != '\n' {
+			buf = append(buf, '\n')
+		}
+		return nil
+	})
+	pc.buf = buf
+	if err != nil {
+		return pc.offset, fmt.Errorf("cannot parse fetched messages at offset %d: %w", pc.offset, err)
+	}
+	if messages == 0 {
+		return nextOffset, nil
+	}
+
+	pc.messagesRead.Add(messages)
+
+	lmp := pc.cfg.newLogMessageProcessor()
+	err = processMessages(pc.cfg, buf, lmp)
+	lmp.MustClose()
+	if err != nil {
+		// Do not block the partition because of malformed messages.
+		pc.errors.Inc()
+		logger.Warnf("cannot parse messages from Kafka topic %q partition %d at offsets [%d..%d): %s", pc.cfg.topic, pc.partition, pc.offset, nextOffset, err)
+	}
+	return nextOffset, nil
+}
+
+// processMessages parses newline-delimited messages in data according to cfg.format and sends them to lmp.
+func processMessages(cfg *config, data []byte, lmp insertutil.LogMessageProcessor) error {
+	switch cfg.format {
+	case "jsonline":
+		return jsonline.ProcessStream("kafka", bytes.NewReader(data), cfg.cp.TimeFields, cfg.cp.MsgFields, lmp)
+	case "syslog":
+		return syslog.ProcessStream(bytes.NewReader(data), false, lmp)
+	case "logfmt":
+		return processLogfmtMessages(cfg, data, lmp)
+	default:
+		logger.Panicf("BUG: unexpected format %q", cfg.format)
+		return nil
+	}
+}
+
+func processLogfmtMessages(cfg *config, data []byte, lmp insertutil.LogMessageProcessor) error {
+	var fields []logstorage.Field
+	var lastErr error
+	for len(data) > 0 {
+		n := bytes.IndexByte(data, '\n')
+		if n < 0 {
+			n = len(data)
+		}
+		line := string(data[:n])
+		data = data[min(n+1, len(data)):]
+		if line == "" {
+			continue
+		}
+
+		fields = logstorage.AppendLogfmtFields(fields[:0], line)
+		ts, err := insertutil.ExtractTimestampFromFields(cfg.cp.TimeFields, fields)
+		if err != nil {
+			lastErr = fmt.Errorf("%w; message contents: %q", err, line)
+			continue
+		}
+		logstorage.RenameField(fields, cfg.cp.MsgFields, "_msg")
+		lmp.AddRow(ts, fields, nil)
+	}
+	return lastErr
+}
+
+// getInitialOffset returns the committed offset for pc.partition.
+//
+// If there is no committed offset, then the offset is obtained according to -kafka.consumer.initialOffset.
+func (pc *partitionConsumer) getInitialOffset() (int64, error) {
+	req := &offsetFetchRequest{
+		groupID:   pc.cfg.groupID,
+		topic:     pc.cfg.topic,
+		partition: pc.partition,
+	}
+	var resp offsetFetchResponse
+	if err := pc.coordinator.call(apiKeyOffsetFetch, apiVersionOffsetFetch, req, &resp); err != nil {
+		return 0, fmt.Errorf("cannot fetch committed offset: %w", err)
+	}
+	if err := newKafkaError(resp.errorCode); err != nil {
+		return 0, fmt.Errorf("cannot fetch committed offset for consumer group %q: %w", pc.cfg.groupID, err)
+	}
+	if resp.offset >= 0 {
+		return resp.offset, nil
+	}
+	return pc.listOffset(pc.cfg.initialOffset)
+}
+
+// listOffset returns the oldest or the newest offset for pc.partition depending on the timestamp.
+func (pc *partitionConsumer) listOffset(timestamp int64) (int64, error) {
+	req := &listOffsetsRequest{
+		topic:     pc.cfg.topic,
+		partition: pc.partition,
+		timestamp: timestamp,
+	}
+	var resp listOffsetsResponse
+	if err := pc.leader.call(apiKeyListOffsets, apiVersionListOffsets, req, &resp); err != nil {
+		return 0, fmt.Errorf("cannot list offsets: %w", err)
+	}
+	if err := newKafkaError(resp.errorCode); err != nil {
+		return 0, fmt.Errorf("cannot list offsets: %w", err)
+	}
+	return resp.offset, nil
+}
+
+// commitOffset commits the offset for pc.partition at the consumer group coordinator.
+func (pc *partitionConsumer) commitOffset(offset int64) error {
+	req := &offsetCommitRequest{
+		groupID:   pc.cfg.groupID,
+		topic:     pc.cfg.topic,
+		partition: pc.partition,
+		offset:    offset,
+	}
+	var resp offsetCommitResponse
+	if err := pc.coordinator.call(apiKeyOffsetCommit, apiVersionOffsetCommit, req, &resp); err != nil {
+		return fmt.Errorf("cannot commit offset %d: %w", offset, err)
+	}
+	if err := newKafkaError(resp.errorCode); err != nil {
+		return fmt.Errorf("cannot commit offset %d for consumer group %q: %w", offset, pc.cfg.groupID, err)
+	}
+	pc.commits.Inc()
+	return nil
+}
+
+// connect establishes connections to the partition leader and to the consumer group coordinator if they aren't established yet.
+func (pc *partitionConsumer) connect() error {
+	if pc.leader != nil && pc.coordinator != nil {
+		return nil
+	}
+	pc.closeConns()
+
+	resp, err := getMetadata(pc.cfg.brokers, pc.cfg.topic)
+	if err != nil {
+		return err
+	}
+	t, err := getMetadataTopic(resp, pc.cfg.topic)
+	if err != nil {
+		return err
+	}
+	leaderID := int32(-1)
+	for _, p := range t.partitions {
+		if p.partition != pc.partition {
+			continue
+		}
+		if err := newKafkaError(p.errorCode); err != nil {
+			return fmt.Errorf("cannot obtain metadata for partition: %w", err)
+		}
+		leaderID = p.leader
+	}
+	if leaderID < 0 {
+		return fmt.Errorf("cannot find the leader for partition")
+	}
+	leaderAddr, ok := resp.getBrokerAddr(leaderID)
+	if !ok {
+		return fmt.Errorf("missing address for the partition leader with node_id=%d", leaderID)
+	}
+	leader, err := dialBroker(leaderAddr)
+	if err != nil {
+		return err
+	}
+
+	req := &findCoordinatorRequest{
+		groupID: pc.cfg.groupID,
+	}
+	var fcResp findCoordinatorResponse
+	if err := leader.call(apiKeyFindCoordinator, apiVersionFindCoordinator, req, &fcResp); err != nil {
+		leader.close()
+		return fmt.Errorf("cannot find coordinator for consumer group %q: %w", pc.cfg.groupID, err)
+	}
+	if err := newKafkaError(fcResp.errorCode); err != nil {
+		leader.close()
+		return fmt.Errorf("cannot find coordinator for consumer group %q: %w", pc.cfg.groupID, err)
+	}
+	coordinatorAddr := fmt.Sprintf("%s:%d", fcResp.host, fcResp.port)
+	coordinator, err := dialBroker(coordinatorAddr)
+	if err != nil {
+		leader.close()
+		return err
+	}
+
+	pc.leader = leader
+	pc.coordinator = coordinator
+	return nil
+}
+
+func (pc *partitionConsumer) closeConns() {
+	if pc.leader != nil {
+		pc.leader.close()
+		pc.leader = nil
+	}
+	if pc.coordinator != nil {
+		pc.coordinator.close()
+		pc.coordinator = nil
+	}
+}
+
+// sleepOrStop sleeps for the given duration and returns true, or returns false if stopCh is closed.
+func sleepOrStop(d time.Duration, stopCh <-chan struct{}) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-stopCh:
+		return false
+	case <-t.C:
+		return true
+	}
+}
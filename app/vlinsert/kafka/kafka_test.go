@@ -0,0 +1,626 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/syslog"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestGetConfig(t *testing.T) {
+	f := func(args map[string]string, cfgExpected *config) {
+		t.Helper()
+
+		resetFlags := setFlagsForTest(args)
+		defer resetFlags()
+
+		cfg, err := getConfig("logs", 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		cfg.cp.Pipeline = nil
+		if !reflect.DeepEqual(cfg, cfgExpected) {
+			t.Fatalf("unexpected config;\ngot\n%+v\n%+v\nwant\n%+v\n%+v", cfg, cfg.cp, cfgExpected, cfgExpected.cp)
+		}
+	}
+
+	// default settings
+	f(nil, &config{
+		topic:   "logs",
+		groupID: "victorialogs",
+		format:  "jsonline",
+		cp:      insertutil.NewCommonParams(logstorage.TenantID{}, nil, nil, nil, nil, nil, nil),
+	})
+
+	// custom settings
+	f(map[string]string{
+		"kafka.consumer.partitions":   "[0,2]",
+		"kafka.consumer.groupID":      "foo",
+		"kafka.consumer.format":       "logfmt",
+		"kafka.consumer.timeFields":   `["ts"]`,
+		"kafka.consumer.msgFields":    `["message"]`,
+		"kafka.consumer.streamFields": `["host","app"]`,
+		"kafka.consumer.extraFields":  `{"source":"kafka"}`,
+		"kafka.consumer.tenantID":     "12:34",
+	}, &config{
+		topic:      "logs",
+		partitions: []int32{0, 2},
+		groupID:    "foo",
+		format:     "logfmt",
+		cp: insertutil.NewCommonParams(logstorage.TenantID{AccountID: 12, ProjectID: 34}, []string{"ts"}, []string{"message"}, []string{"host", "app"}, nil, nil, []logstorage.Field{
+			{
+				Name:  "source",
+				Value: "kafka",
+			},
+		}),
+	})
+}
+
+func TestGetConfigFailure(t *testing.T) {
+	f := func(name, value string) {
+		t.Helper()
+
+		resetFlags := setFlagsForTest(map[string]string{
+			name: value,
+		})
+		defer resetFlags()
+
+		cfg, err := getConfig("logs", 0)
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		if cfg != nil {
+			t.Fatalf("expecting nil config")
+		}
+	}
+
+	f("kafka.consumer.partitions", "foo")
+	f("kafka.consumer.format", "json")
+	f("kafka.consumer.timeFields", "ts")
+	f("kafka.consumer.extraFields", `["foo"]`)
+	f("kafka.consumer.tenantID", "foo")
+}
+
+func setFlagsForTest(args map[string]string) func() {
+	flags := map[string]*flagutil.ArrayString{
+		"kafka.consumer.partitions":   partitions,
+		"kafka.consumer.groupID":      groupID,
+		"kafka.consumer.format":       format,
+		"kafka.consumer.timeFields":   timeFields,
+		"kafka.consumer.msgFields":    msgFields,
+		"kafka.consumer.streamFields": streamFields,
+		"kafka.consumer.extraFields":  extraFields,
+		"kafka.consumer.tenantID":     tenantID,
+	}
+	for name, value := range args {
+		a, ok := flags[name]
+		if !ok {
+			panic(fmt.Errorf("BUG: unknown flag -%s", name))
+		}
+		*a = flagutil.ArrayString{value}
+	}
+	return func() {
+		for _, a := range flags {
+			*a = nil
+		}
+	}
+}
+
+func TestProcessMessages(t *testing.T) {
+	syslog.MustInit()
+	defer syslog.MustStop()
+
+	f := func(format, data string, timeFields, msgFields []string, timestampsExpected []int64, resultExpected string) {
+		t.Helper()
+
+		cfg := &config{
+			format: format,
+			cp:     insertutil.NewCommonParams(logstorage.TenantID{}, timeFields, msgFields, nil, nil, nil, nil),
+		}
+		tlp := &insertutil.TestLogMessageProcessor{}
+		_ = processMessages(cfg, []byte(data), tlp)
+		if err := tlp.Verify(timestampsExpected, resultExpected); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// jsonline
+	f("jsonline", `{"_time":"2025-01-02T10:20:30Z","_msg":"foo","level":"info"}
+{"ts":"2025-01-02T10:20:31Z","message":"bar"}
+`, []string{"_time", "ts"}, []string{"message"}, []int64{1735813230000000000, 1735813231000000000}, `{"_msg":"foo","level":"info"}
+{"_msg":"bar"}`)
+
+	// logfmt
+	f("logfmt", `ts=2025-01-02T10:20:30Z level=info msg="foo bar"
+
+ts=2025-01-02T10:20:31Z msg=baz
+invalid-timestamp ts=foo
+`, []string{"ts"}, []string{"msg"}, []int64{1735813230000000000, 1735813231000000000}, `{"level":"info","_msg":"foo bar"}
+{"_msg":"baz"}`)
+
+	// syslog
+	f("syslog", `<165>1 2025-01-02T10:20:30.000Z mymachine.example.com appname 12345 ID47 - foo bar
+`, nil, nil, []int64{1735813230000000000}, `{"priority":"165","facility_keyword":"local4","level":"notice","facility":"20","severity":"5","format":"rfc5424","hostname":"mymachine.example.com","app_name":"appname","proc_id":"12345","msg_id":"ID47","_msg":"foo bar"}`)
+}
+
+func TestPartitionConsumer(t *testing.T) {
+	fb := newFakeBroker(t, "logs", 1)
+	defer fb.stop()
+
+	rows := &rowsCollector{}
+	cfg := &config{
+		brokers:       []string{fb.addr()},
+		topic:         "logs",
+		groupID:       "group1",
+		format:        "jsonline",
+		initialOffset: offsetOldest,
+		cp:            insertutil.NewCommonParams(logstorage.TenantID{}, nil, nil, nil, nil, nil, nil),
+	}
+	cfg.newLogMessageProcessor = func() insertutil.LogMessageProcessor {
+		return rows
+	}
+
+	consume := func(pc *partitionConsumer, offsetExpected int64, rowsExpected []string) {
+		t.Helper()
+
+		if err := pc.consumeNext(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if pc.offset != offsetExpected {
+			t.Fatalf("unexpected offset; got %d; want %d", pc.offset, offsetExpected)
+		}
+		result := rows.reset()
+		if !reflect.DeepEqual(result, rowsExpected) {
+			t.Fatalf("unexpected rows;\ngot\n%q\nwant\n%q", result, rowsExpected)
+		}
+	}
+
+	// consume messages from the oldest offset
+	fb.produce(0, compressionNone, `{"_msg":"a"}`, `{"_msg":"b"}`)
+	fb.produce(0, compressionGzip, `{"_msg":"c"}`)
+
+	pc := newPartitionConsumer(cfg, 0)
+	consume(pc, 3, []string{`{"_msg":"a"}`, `{"_msg":"b"}`, `{"_msg":"c"}`})
+	if n := fb.getCommittedOffset("group1", 0); n != 3 {
+		t.Fatalf("unexpected committed offset; got %d; want 3", n)
+	}
+
+	// no new messages
+	consume(pc, 3, nil)
+
+	// the restarted consumer continues from the committed offset
+	pc.closeConns()
+	fb.produce(0, compressionZstd, `{"_msg":"d"}`)
+	pc = newPartitionConsumer(cfg, 0)
+	consume(pc, 4, []string{`{"_msg":"d"}`})
+	if n := fb.getCommittedOffset("group1", 0); n != 4 {
+		t.Fatalf("unexpected committed offset; got %d; want 4", n)
+	}
+	pc.closeConns()
+
+	// the consumer in another group starts from the newest offset
+	cfg.groupID = "group2"
+	cfg.initialOffset = offsetNewest
+	pc = newPartitionConsumer(cfg, 0)
+	consume(pc, 4, nil)
+	fb.produce(0, compressionSnappy, `{"_msg":"e"}`)
+	consume(pc, 5, []string{`{"_msg":"e"}`})
+	pc.closeConns()
+
+	// out of range offset is reset to the initial offset
+	cfg.groupID = "group3"
+	cfg.initialOffset = offsetOldest
+	fb.setCommittedOffset("group3", 0, 100)
+	pc = newPartitionConsumer(cfg, 0)
+	consume(pc, 0, nil)
+	consume(pc, 5, []string{`{"_msg":"a"}`, `{"_msg":"b"}`, `{"_msg":"c"}`, `{"_msg":"d"}`, `{"_msg":"e"}`})
+	pc.closeConns()
+
+	// the consumer recovers after broker errors
+	pc = newPartitionConsumer(cfg, 0)
+	fb.setFetchError(errCodeNotLeaderForPartition)
+	if err := pc.consumeNext(); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+	pc.closeConns()
+	fb.setFetchError(errCodeNone)
+	fb.produce(0, compressionNone, `{"_msg":"f"}`)
+	consume(pc, 6, []string{`{"_msg":"f"}`})
+	pc.closeConns()
+}
+
+func TestRunTopicConsumer(t *testing.T) {
+	fb := newFakeBroker(t, "logs", 3)
+	defer fb.stop()
+
+	rows := &rowsCollector{}
+	cfg := &config{
+		brokers:       []string{"127.0.0.1:1", fb.addr()},
+		topic:         "logs",
+		groupID:       "victorialogs",
+		format:        "logfmt",
+		initialOffset: offsetOldest,
+		cp:            insertutil.NewCommonParams(logstorage.TenantID{}, nil, nil, nil, nil, nil, nil),
+		newLogMessageProcessor: func() insertutil.LogMessageProcessor {
+			return rows
+		},
+	}
+
+	var rowsExpected []string
+	for partition := int32(0); partition < 3; partition++ {
+		for i := 0; i < 5; i++ {
+			msg := fmt.Sprintf("p%d-%d", partition, i)
+			fb.produce(partition, compressionNone, "_msg="+msg)
+			rowsExpected = append(rowsExpected, fmt.Sprintf(`{"_msg":%q}`, msg))
+		}
+	}
+
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		runTopicConsumer(cfg, stopCh)
+		close(doneCh)
+	}()
+
+	var result []string
+	deadline := time.Now().Add(5 * time.Second)
+	for len(result) < len(rowsExpected) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		result = append(result, rows.reset()...)
+	}
+	close(stopCh)
+	<-doneCh
+
+	sort.Strings(result)
+	if !reflect.DeepEqual(result, rowsExpected) {
+		t.Fatalf("unexpected rows;\ngot\n%q\nwant\n%q", result, rowsExpected)
+	}
+	for partition := int32(0); partition < 3; partition++ {
+		if n := fb.getCommittedOffset("victorialogs", partition); n != 5 {
+			t.Fatalf("unexpected committed offset for partition %d; got %d; want 5", partition, n)
+		}
+	}
+}
+
+// rowsCollector is LogMessageProcessor, which collects the ingested rows.
+type rowsCollector struct {
+	mu   sync.Mutex
+	rows []string
+}
+
+func (rc *rowsCollector) AddRow(_ int64, fields, _ []logstorage.Field) {
+	row := string(logstorage.MarshalFieldsToJSON(nil, fields))
+	rc.mu.Lock()
+	rc.rows = append(rc.rows, row)
+	rc.mu.Unlock()
+}
+
+func (rc *rowsCollector) MustClose() {
+}
+
+func (rc *rowsCollector) reset() []string {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rows := rc.rows
+	rc.rows = nil
+	return rows
+}
+
+// fakeBroker is an in-process Kafka broker, which implements the subset of Kafka protocol used by the consumer.
+type fakeBroker struct {
+	t  *testing.T
+	ln net.Listener
+	wg sync.WaitGroup
+
+	topic string
+
+	mu               sync.Mutex
+	batches          [][][]byte
+	nextOffsets      []int64
+	committedOffsets map[string]int64
+	fetchError       int16
+	conns            []net.Conn
+}
+
+func newFakeBroker(t *testing.T, topic string, partitionsCount int) *fakeBroker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot start fake Kafka broker: %s", err)
+	}
+	fb := &fakeBroker{
+		t:                t,
+		ln:               ln,
+		topic:            topic,
+		batches:          make([][][]byte, partitionsCount),
+		nextOffsets:      make([]int64, partitionsCount),
+		committedOffsets: make(map[string]int64),
+	}
+	fb.wg.Add(1)
+	go func() {
+		defer fb.wg.Done()
+		fb.acceptConns()
+	}()
+	return fb
+}
+
+func (fb *fakeBroker) addr() string {
+	return fb.ln.Addr().String()
+}
+
+func (fb *fakeBroker) stop() {
+	_ = fb.ln.Close()
+	fb.mu.Lock()
+	for _, c := range fb.conns {
+		_ = c.Close()
+	}
+	fb.mu.Unlock()
+	fb.wg.Wait()
+}
+
+func (fb *fakeBroker) produce(partition int32, codec int16, values ...string) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	batch := marshalRecordBatch(nil, fb.nextOffsets[partition], values, codec, 0)
+	fb.batches[partition] = append(fb.batches[partition], batch)
+	fb.nextOffsets[partition] += int64(len(values))
+}
+
+func (fb *fakeBroker) getCommittedOffset(group string, partition int32) int64 {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	n, ok := fb.committedOffsets[committedOffsetKey(group, partition)]
+	if !ok {
+		return -1
+	}
+	return n
+}
+
+func (fb *fakeBroker) setCommittedOffset(group string, partition int32, offset int64) {
+	fb.mu.Lock()
+	fb.committedOffsets[committedOffsetKey(group, partition)] = offset
+	fb.mu.Unlock()
+}
+
+func (fb *fakeBroker) setFetchError(code int16) {
+	fb.mu.Lock()
+	fb.fetchError = code
+	fb.mu.Unlock()
+}
+
+func committedOffsetKey(group string, partition int32) string {
+	return group + "/" + strconv.Itoa(int(partition))
+}
+
+func (fb *fakeBroker) acceptConns() {
+	for {
+		c, err := fb.ln.Accept()
+		if err != nil {
+			return
+		}
+		fb.mu.Lock()
+		fb.conns = append(fb.conns, c)
+		fb.mu.Unlock()
+
+		fb.wg.Add(1)
+		go func() {
+			defer fb.wg.Done()
+			fb.serveConn(c)
+		}()
+	}
+}
+
+func (fb *fakeBroker) serveConn(c net.Conn) {
+	defer func() {
+		_ = c.Close()
+	}()
+
+	for {
+		var sizeBuf [4]byte
+		if _, err := io.ReadFull(c, sizeBuf[:]); err != nil {
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint32(sizeBuf[:]))
+		if _, err := io.ReadFull(c, req); err != nil {
+			return
+		}
+
+		d := &decoder{
+			b: req,
+		}
+		apiKey := d.int16()
+		apiVersion := d.int16()
+		correlationID := d.int32()
+		_ = d.nullableString()
+
+		e := &encoder{}
+		e.int32(0)
+		e.int32(correlationID)
+		fb.handleRequest(apiKey, apiVersion, d, e)
+		if d.err != nil {
+			fb.t.Errorf("cannot parse request with api_key=%d: %s", apiKey, d.err)
+			return
+		}
+		if len(d.b) > 0 {
+			fb.t.Errorf("unexpected tail left after parsing request with api_key=%d: %X", apiKey, d.b)
+			return
+		}
+		binary.BigEndian.PutUint32(e.b, uint32(len(e.b)-4))
+		if _, err := c.Write(e.b); err != nil {
+			return
+		}
+	}
+}
+
+func (fb *fakeBroker) handleRequest(apiKey, apiVersion int16, d *decoder, e *encoder) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	host, portStr, _ := net.SplitHostPort(fb.addr())
+	port, _ := strconv.Atoi(portStr)
+
+	switch {
+	case apiKey == apiKeyMetadata && apiVersion == apiVersionMetadata:
+		var topics []string
+		for i := d.arrayLen(); i > 0; i-- {
+			topics = append(topics, d.string())
+		}
+		_ = d.bool()
+
+		// throttle_time_ms
+		e.int32(0)
+		e.arrayLen(1)
+		e.int32(1)
+		e.string(host)
+		e.int32(int32(port))
+		e.nullableString(nil)
+		// cluster_id
+		e.nullableString(nil)
+		// controller_id
+		e.int32(1)
+		e.arrayLen(len(topics))
+		for _, topic := range topics {
+			if topic != fb.topic {
+				e.int16(errCodeUnknownTopicOrPartition)
+				e.string(topic)
+				e.bool(false)
+				e.arrayLen(0)
+				continue
+			}
+			e.int16(errCodeNone)
+			e.string(topic)
+			e.bool(false)
+			e.arrayLen(len(fb.batches))
+			for partition := range fb.batches {
+				e.int16(errCodeNone)
+				e.int32(int32(partition))
+				// leader
+				e.int32(1)
+				// replica_nodes and isr_nodes
+				e.arrayLen(1)
+				e.int32(1)
+				e.arrayLen(1)
+				e.int32(1)
+			}
+		}
+	case apiKey == apiKeyFindCoordinator && apiVersion == apiVersionFindCoordinator:
+		_ = d.string()
+		_ = d.int8()
+
+		// throttle_time_ms
+		e.int32(0)
+		e.int16(errCodeNone)
+		e.nullableString(nil)
+		e.int32(1)
+		e.string(host)
+		e.int32(int32(port))
+	case apiKey == apiKeyListOffsets && apiVersion == apiVersionListOffsets:
+		_ = d.int32()
+		_ = d.arrayLen()
+		topic := d.string()
+		_ = d.arrayLen()
+		partition := d.int32()
+		timestamp := d.int64()
+
+		offset := int64(0)
+		if timestamp == offsetNewest {
+			offset = fb.nextOffsets[partition]
+		}
+		e.arrayLen(1)
+		e.string(topic)
+		e.arrayLen(1)
+		e.int32(partition)
+		e.int16(errCodeNone)
+		e.int64(timestamp)
+		e.int64(offset)
+	case apiKey == apiKeyFetch && apiVersion == apiVersionFetch:
+		_ = d.int32()
+		_ = d.int32()
+		_ = d.int32()
+		_ = d.int32()
+		_ = d.int8()
+		_ = d.arrayLen()
+		topic := d.string()
+		_ = d.arrayLen()
+		partition := d.int32()
+		offset := d.int64()
+		_ = d.int32()
+
+		errCode := fb.fetchError
+		if errCode == errCodeNone && offset > fb.nextOffsets[partition] {
+			errCode = errCodeOffsetOutOfRange
+		}
+		var records []byte
+		if errCode == errCodeNone {
+			for _, batch := range fb.batches[partition] {
+				records = append(records, batch...)
+			}
+		}
+
+		// throttle_time_ms
+		e.int32(0)
+		e.arrayLen(1)
+		e.string(topic)
+		e.arrayLen(1)
+		e.int32(partition)
+		e.int16(errCode)
+		// high_watermark and last_stable_offset
+		e.int64(fb.nextOffsets[partition])
+		e.int64(fb.nextOffsets[partition])
+		// aborted_transactions
+		e.arrayLen(-1)
+		e.bytes(records)
+	case apiKey == apiKeyOffsetFetch && apiVersion == apiVersionOffsetFetch:
+		group := d.string()
+		_ = d.arrayLen()
+		topic := d.string()
+		_ = d.arrayLen()
+		partition := d.int32()
+
+		offset, ok := fb.committedOffsets[committedOffsetKey(group, partition)]
+		if !ok {
+			offset = -1
+		}
+		e.arrayLen(1)
+		e.string(topic)
+		e.arrayLen(1)
+		e.int32(partition)
+		e.int64(offset)
+		e.nullableString(nil)
+		e.int16(errCodeNone)
+	case apiKey == apiKeyOffsetCommit && apiVersion == apiVersionOffsetCommit:
+		group := d.string()
+		_ = d.int32()
+		_ = d.string()
+		_ = d.int64()
+		_ = d.arrayLen()
+		topic := d.string()
+		_ = d.arrayLen()
+		partition := d.int32()
+		offset := d.int64()
+		_ = d.nullableString()
+
+		fb.committedOffsets[committedOffsetKey(group, partition)] = offset
+		e.arrayLen(1)
+		e.string(topic)
+		e.arrayLen(1)
+		e.int32(partition)
+		e.int16(errCodeNone)
+	default:
+		fb.t.Errorf("unexpected request with api_key=%d, api_version=%d", apiKey, apiVersion)
+	}
+}
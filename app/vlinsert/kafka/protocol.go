@@ -0,0 +1,595 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Kafka API keys used by the consumer.
+//
+// See https://kafka.apache.org/protocol#protocol_api_keys
+const (
+	apiKeyFetch           = 1
+	apiKeyListOffsets     = 2
+	apiKeyMetadata        = 3
+	apiKeyOffsetCommit    = 8
+	apiKeyOffsetFetch     = 9
+	apiKeyFindCoordinator = 10
+)
+
+// API versions used by the consumer.
+//
+// These are the oldest non-flexible versions supported by Kafka 4.0,
+// so the consumer works with all the Kafka versions starting from Kafka 1.0.
+const (
+	apiVersionFetch           = 4
+	apiVersionListOffsets     = 1
+	apiVersionMetadata        = 4
+	apiVersionOffsetCommit    = 2
+	apiVersionOffsetFetch     = 1
+	apiVersionFindCoordinator = 1
+)
+
+// Kafka error codes handled by the consumer.
+//
+// See https://kafka.apache.org/protocol#protocol_error_codes
+const (
+	errCodeNone                      = 0
+	errCodeOffsetOutOfRange          = 1
+	errCodeUnknownTopicOrPartition   = 3
+	errCodeLeaderNotAvailable        = 5
+	errCodeNotLeaderForPartition     = 6
+	errCodeCoordinatorLoadInProgress = 14
+	errCodeCoordinatorNotAvailable   = 15
+	errCodeNotCoordinator            = 16
+)
+
+// kafkaError is an error returned by Kafka broker.
+type kafkaError struct {
+	code int16
+}
+
+func (e *kafkaError) Error() string {
+	if name, ok := kafkaErrorNames[e.code]; ok {
+		return fmt.Sprintf("kafka error %s (code %d)", name, e.code)
+	}
+	return fmt.Sprintf("kafka error code %d", e.code)
+}
+
+var kafkaErrorNames = map[int16]string{
+	errCodeOffsetOutOfRange:          "OFFSET_OUT_OF_RANGE",
+	errCodeUnknownTopicOrPartition:   "UNKNOWN_TOPIC_OR_PARTITION",
+	errCodeLeaderNotAvailable:        "LEADER_NOT_AVAILABLE",
+	errCodeNotLeaderForPartition:     "NOT_LEADER_OR_FOLLOWER",
+	errCodeCoordinatorLoadInProgress: "COORDINATOR_LOAD_IN_PROGRESS",
+	errCodeCoordinatorNotAvailable:   "COORDINATOR_NOT_AVAILABLE",
+	errCodeNotCoordinator:            "NOT_COORDINATOR",
+}
+
+func newKafkaError(code int16) error {
+	if code == errCodeNone {
+		return nil
+	}
+	return &kafkaError{
+		code: code,
+	}
+}
+
+// encoder marshals Kafka protocol primitives.
+//
+// See https://kafka.apache.org/protocol#protocol_types
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) int8(v int8) {
+	e.b = append(e.b, byte(v))
+}
+
+func (e *encoder) int16(v int16) {
+	e.b = binary.BigEndian.AppendUint16(e.b, uint16(v))
+}
+
+func (e *encoder) int32(v int32) {
+	e.b = binary.BigEndian.AppendUint32(e.b, uint32(v))
+}
+
+func (e *encoder) int64(v int64) {
+	e.b = binary.BigEndian.AppendUint64(e.b, uint64(v))
+}
+
+func (e *encoder) bool(v bool) {
+	if v {
+		e.int8(1)
+	} else {
+		e.int8(0)
+	}
+}
+
+func (e *encoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.b = append(e.b, s...)
+}
+
+func (e *encoder) nullableString(s *string) {
+	if s == nil {
+		e.int16(-1)
+		return
+	}
+	e.string(*s)
+}
+
+func (e *encoder) bytes(b []byte) {
+	if b == nil {
+		e.int32(-1)
+		return
+	}
+	e.int32(int32(len(b)))
+	e.b = append(e.b, b...)
+}
+
+func (e *encoder) arrayLen(n int) {
+	e.int32(int32(n))
+}
+
+func (e *encoder) varint(v int64) {
+	e.b = binary.AppendVarint(e.b, v)
+}
+
+// decoder unmarshals Kafka protocol primitives.
+//
+// The first occurred error is stored in err. All the subsequent calls return zero values after the error.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) fail(what string) {
+	if d.err == nil {
+		d.err = fmt.Errorf("cannot read %s: unexpected end of data", what)
+	}
+	d.b = nil
+}
+
+func (d *decoder) int8() int8 {
+	if len(d.b) < 1 {
+		d.fail("int8")
+		return 0
+	}
+	v := int8(d.b[0])
+	d.b = d.b[1:]
+	return v
+}
+
+func (d *decoder) int16() int16 {
+	if len(d.b) < 2 {
+		d.fail("int16")
+		return 0
+	}
+	v := int16(binary.BigEndian.Uint16(d.b))
+	d.b = d.b[2:]
+	return v
+}
+
+func (d *decoder) int32() int32 {
+	if len(d.b) < 4 {
+		d.fail("int32")
+		return 0
+	}
+	v := int32(binary.BigEndian.Uint32(d.b))
+	d.b = d.b[4:]
+	return v
+}
+
+func (d *decoder) int64() int64 {
+	if len(d.b) < 8 {
+		d.fail("int64")
+		return 0
+	}
+	v := int64(binary.BigEndian.Uint64(d.b))
+	d.b = d.b[8:]
+	return v
+}
+
+func (d *decoder) bool() bool {
+	return d.int8() != 0
+}
+
+func (d *decoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.rawBytes(int(n), "string"))
+}
+
+func (d *decoder) nullableString() *string {
+	n := d.int16()
+	if n < 0 {
+		return nil
+	}
+	s := string(d.rawBytes(int(n), "string"))
+	return &s
+}
+
+// bytes returns bytes, which refer to d.b.
+func (d *decoder) bytes() []byte {
+	n := d.int32()
+	if n < 0 {
+		return nil
+	}
+	return d.rawBytes(int(n), "bytes")
+}
+
+func (d *decoder) rawBytes(n int, what string) []byte {
+	if n < 0 || n > len(d.b) {
+		d.fail(what)
+		return nil
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
+
+// arrayLen returns the number of items in the array.
+//
+// It returns 0 for null arrays.
+func (d *decoder) arrayLen() int {
+	n := d.int32()
+	if n < 0 {
+		return 0
+	}
+	if int(n) > len(d.b) {
+		// Every array item occupies at least a single byte
+		d.fail("array")
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) varint() int64 {
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.fail("varint")
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+// varintBytes returns varint-prefixed bytes, which refer to d.b.
+func (d *decoder) varintBytes() []byte {
+	n := d.varint()
+	if n < 0 {
+		return nil
+	}
+	return d.rawBytes(int(n), "varint bytes")
+}
+
+// requestHeader is Kafka request header v1.
+type requestHeader struct {
+	apiKey        int16
+	apiVersion    int16
+	correlationID int32
+	clientID      string
+}
+
+func (h *requestHeader) encode(e *encoder) {
+	e.int16(h.apiKey)
+	e.int16(h.apiVersion)
+	e.int32(h.correlationID)
+	e.nullableString(&h.clientID)
+}
+
+// metadataRequest is Metadata request v4.
+type metadataRequest struct {
+	topics []string
+}
+
+func (r *metadataRequest) encode(e *encoder) {
+	e.arrayLen(len(r.topics))
+	for _, topic := range r.topics {
+		e.string(topic)
+	}
+	// allow_auto_topic_creation
+	e.bool(false)
+}
+
+// metadataResponse is Metadata response v4.
+type metadataResponse struct {
+	brokers []metadataBroker
+	topics  []metadataTopic
+}
+
+type metadataBroker struct {
+	nodeID int32
+	host   string
+	port   int32
+}
+
+type metadataTopic struct {
+	errorCode  int16
+	name       string
+	partitions []metadataPartition
+}
+
+type metadataPartition struct {
+	errorCode int16
+	partition int32
+	leader    int32
+}
+
+func (r *metadataResponse) decode(d *decoder) {
+	// throttle_time_ms
+	_ = d.int32()
+
+	n := d.arrayLen()
+	r.brokers = make([]metadataBroker, n)
+	for i := range r.brokers {
+		b := &r.brokers[i]
+		b.nodeID = d.int32()
+		b.host = d.string()
+		b.port = d.int32()
+		// rack
+		_ = d.nullableString()
+	}
+
+	// cluster_id
+	_ = d.nullableString()
+	// controller_id
+	_ = d.int32()
+
+	n = d.arrayLen()
+	r.topics = make([]metadataTopic, n)
+	for i := range r.topics {
+		t := &r.topics[i]
+		t.errorCode = d.int16()
+		t.name = d.string()
+		// is_internal
+		_ = d.bool()
+
+		n := d.arrayLen()
+		t.partitions = make([]metadataPartition, n)
+		for j := range t.partitions {
+			p := &t.partitions[j]
+			p.errorCode = d.int16()
+			p.partition = d.int32()
+			p.leader = d.int32()
+			// replica_nodes
+			for k := d.arrayLen(); k > 0; k-- {
+				_ = d.int32()
+			}
+			// isr_nodes
+			for k := d.arrayLen(); k > 0; k-- {
+				_ = d.int32()
+			}
+		}
+	}
+}
+
+// getBrokerAddr returns the address for the broker with the given nodeID.
+func (r *metadataResponse) getBrokerAddr(nodeID int32) (string, bool) {
+	for _, b := range r.brokers {
+		if b.nodeID == nodeID {
+			return fmt.Sprintf("%s:%d", b.host, b.port), true
+		}
+	}
+	return "", false
+}
+
+// findCoordinatorRequest is FindCoordinator request v1.
+type findCoordinatorRequest struct {
+	groupID string
+}
+
+func (r *findCoordinatorRequest) encode(e *encoder) {
+	e.string(r.groupID)
+	// key_type: 0 means consumer group
+	e.int8(0)
+}
+
+// findCoordinatorResponse is FindCoordinator response v1.
+type findCoordinatorResponse struct {
+	errorCode int16
+	nodeID    int32
+	host      string
+	port      int32
+}
+
+func (r *findCoordinatorResponse) decode(d *decoder) {
+	// throttle_time_ms
+	_ = d.int32()
+	r.errorCode = d.int16()
+	// error_message
+	_ = d.nullableString()
+	r.nodeID = d.int32()
+	r.host = d.string()
+	r.port = d.int32()
+}
+
+// listOffsetsRequest is ListOffsets request v1 for a single partition.
+type listOffsetsRequest struct {
+	topic     string
+	partition int32
+
+	// timestamp is either -2 for the earliest offset or -1 for the latest offset.
+	timestamp int64
+}
+
+func (r *listOffsetsRequest) encode(e *encoder) {
+	// replica_id
+	e.int32(-1)
+	e.arrayLen(1)
+	e.string(r.topic)
+	e.arrayLen(1)
+	e.int32(r.partition)
+	e.int64(r.timestamp)
+}
+
+// listOffsetsResponse is ListOffsets response v1 for a single partition.
+type listOffsetsResponse struct {
+	errorCode int16
+	offset    int64
+}
+
+func (r *listOffsetsResponse) decode(d *decoder) {
+	r.errorCode = errCodeUnknownTopicOrPartition
+	for i := d.arrayLen(); i > 0; i-- {
+		// name
+		_ = d.string()
+		for j := d.arrayLen(); j > 0; j-- {
+			// partition_index
+			_ = d.int32()
+			r.errorCode = d.int16()
+			// timestamp
+			_ = d.int64()
+			r.offset = d.int64()
+		}
+	}
+}
+
+// fetchRequest is Fetch request v4 for a single partition.
+type fetchRequest struct {
+	topic     string
+	partition int32
+	offset    int64
+
+	maxWaitMs int32
+	maxBytes  int32
+}
+
+func (r *fetchRequest) encode(e *encoder) {
+	// replica_id
+	e.int32(-1)
+	e.int32(r.maxWaitMs)
+	// min_bytes
+	e.int32(1)
+	e.int32(r.maxBytes)
+	// isolation_level: read_uncommitted
+	e.int8(0)
+	e.arrayLen(1)
+	e.string(r.topic)
+	e.arrayLen(1)
+	e.int32(r.partition)
+	e.int64(r.offset)
+	// partition_max_bytes
+	e.int32(r.maxBytes)
+}
+
+// fetchResponse is Fetch response v4 for a single partition.
+type fetchResponse struct {
+	errorCode     int16
+	highWatermark int64
+
+	// records contains record batches. It refers to the response buffer.
+	records []byte
+}
+
+func (r *fetchResponse) decode(d *decoder) {
+	// throttle_time_ms
+	_ = d.int32()
+
+	r.errorCode = errCodeUnknownTopicOrPartition
+	for i := d.arrayLen(); i > 0; i-- {
+		// topic
+		_ = d.string()
+		for j := d.arrayLen(); j > 0; j-- {
+			// partition_index
+			_ = d.int32()
+			r.errorCode = d.int16()
+			r.highWatermark = d.int64()
+			// last_stable_offset
+			_ = d.int64()
+			// aborted_transactions
+			for k := d.arrayLen(); k > 0; k-- {
+				// producer_id
+				_ = d.int64()
+				// first_offset
+				_ = d.int64()
+			}
+			r.records = d.bytes()
+		}
+	}
+}
+
+// offsetFetchRequest is OffsetFetch request v1 for a single partition.
+type offsetFetchRequest struct {
+	groupID   string
+	topic     string
+	partition int32
+}
+
+func (r *offsetFetchRequest) encode(e *encoder) {
+	e.string(r.groupID)
+	e.arrayLen(1)
+	e.string(r.topic)
+	e.arrayLen(1)
+	e.int32(r.partition)
+}
+
+// offsetFetchResponse is OffsetFetch response v1 for a single partition.
+type offsetFetchResponse struct {
+	errorCode int16
+
+	// offset is the committed offset. It is set to -1 if there is no committed offset.
+	offset int64
+}
+
+func (r *offsetFetchResponse) decode(d *decoder) {
+	r.offset = -1
+	for i := d.arrayLen(); i > 0; i-- {
+		// name
+		_ = d.string()
+		for j := d.arrayLen(); j > 0; j-- {
+			// partition_index
+			_ = d.int32()
+			r.offset = d.int64()
+			// metadata
+			_ = d.nullableString()
+			r.errorCode = d.int16()
+		}
+	}
+}
+
+// offsetCommitRequest is OffsetCommit request v2 for a single partition.
+type offsetCommitRequest struct {
+	groupID   string
+	topic     string
+	partition int32
+	offset    int64
+}
+
+func (r *offsetCommitRequest) encode(e *encoder) {
+	e.string(r.groupID)
+	// generation_id: -1 is used by consumers, which do not participate in consumer group membership
+	e.int32(-1)
+	// member_id
+	e.string("")
+	// retention_time_ms: -1 means the broker default retention
+	e.int64(-1)
+	e.arrayLen(1)
+	e.string(r.topic)
+	e.arrayLen(1)
+	e.int32(r.partition)
+	e.int64(r.offset)
+	// committed_metadata
+	e.nullableString(nil)
+}
+
+// offsetCommitResponse is OffsetCommit response v2 for a single partition.
+type offsetCommitResponse struct {
+	errorCode int16
+}
+
+func (r *offsetCommitResponse) decode(d *decoder) {
+	r.errorCode = errCodeUnknownTopicOrPartition
+	for i := d.arrayLen(); i > 0; i-- {
+		// name
+		_ = d.string()
+		for j := d.arrayLen(); j > 0; j-- {
+			// partition_index
+			_ = d.int32()
+			r.errorCode = d.int16()
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package kafka
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding/zstd"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/gzip"
+)
+
+// Compression codecs for record batches.
+//
+// See https://kafka.apache.org/documentation/#recordbatch
+const (
+	compressionNone   = 0
+	compressionGzip   = 1
+	compressionSnappy = 2
+	compressionLZ4    = 3
+	compressionZstd   = 4
+)
+
+const (
+	// recordBatchHeaderSize is the size of the record batch header starting from the baseOffset up to the records count inclusive.
+	recordBatchHeaderSize = 61
+
+	// recordBatchLengthOffset is the offset of the batchLength field in the record batch header.
+	recordBatchLengthOffset = 8
+
+	// recordBatchMagicOffset is the offset of the magic field in the record batch header.
+	recordBatchMagicOffset = 16
+
+	attributeCompressionMask = 0x07
+	attributeControlBatch    = 0x20
+)
+
+// xerialSnappyHeader is the header for snappy-compressed data in xerial framing format, which is used by Java Kafka clients.
+var xerialSnappyHeader = []byte("\x82SNAPPY\x00")
+
+// record is a single Kafka record.
+type record struct {
+	offset int64
+	value  []byte
+}
+
+// parseRecordBatches parses record batches from data and calls f for every record with the offset bigger or equal to minOffset.
+//
+// It returns the offset of the next record to fetch. The returned offset is set to minOffset if data contains no records.
+//
+// Record values passed to f are valid only until f returns.
+// The last record batch in data may be truncated by Kafka broker according to the requested maxBytes. Such a batch is skipped.
+func parseRecordBatches(data []byte, minOffset int64, f func(r *record) error) (int64, error) {
+	nextOffset := minOffset
+	var buf []byte
+	for len(data) >= recordBatchHeaderSize {
+		baseOffset := int64(binary.BigEndian.Uint64(data))
+		batchLength := int32(binary.BigEndian.Uint32(data[recordBatchLengthOffset:]))
+		batchSize := 12 + int(batchLength)
+		if batchLength < 0 || batchSize > len(data) {
+			// Truncated record batch
+			break
+		}
+		magic := int8(data[recordBatchMagicOffset])
+		if magic != 2 {
+			return nextOffset, fmt.Errorf("unsupported record batch magic %d at offset %d; only Kafka message format v2 is supported", magic, baseOffset)
+		}
+		if batchSize < recordBatchHeaderSize {
+			return nextOffset, fmt.Errorf("too small record batch size at offset %d: %d bytes; must be at least %d bytes", baseOffset, batchSize, recordBatchHeaderSize)
+		}
+
+		d := &decoder{
+			b: data[recordBatchMagicOffset+1 : batchSize],
+		}
+		data = data[batchSize:]
+
+		// crc
+		_ = d.int32()
+		attributes := d.int16()
+		lastOffsetDelta := d.int32()
+		// firstTimestamp, maxTimestamp, producerId
+		_ = d.int64()
+		_ = d.int64()
+		_ = d.int64()
+		// producerEpoch
+		_ = d.int16()
+		// baseSequence
+		_ = d.int32()
+		recordsCount := d.int32()
+		if d.err != nil {
+			return nextOffset, fmt.Errorf("cannot parse record batch header at offset %d: %w", baseOffset, d.err)
+		}
+
+		batchNextOffset := baseOffset + int64(lastOffsetDelta) + 1
+		if attributes&attributeControlBatch != 0 || batchNextOffset <= minOffset {
+			// Skip control batches and batches with already processed records.
+			nextOffset = max(nextOffset, batchNextOffset)
+			continue
+		}
+
+		recordsData := d.b
+		if codec := attributes & attributeCompressionMask; codec != compressionNone {
+			b, err := decompressRecords(buf[:0], recordsData, codec)
+			if err != nil {
+				return nextOffset, fmt.Errorf("cannot decompress record batch at offset %d: %w", baseOffset, err)
+			}
+			buf = b
+			recordsData = b
+		}
+
+		d = &decoder{
+			b: recordsData,
+		}
+		var r record
+		for i := int32(0); i < recordsCount; i++ {
+			recordLen := d.varint()
+			rd := &decoder{
+				b: d.rawBytes(int(recordLen), "record"),
+			}
+			if d.err != nil {
+				return nextOffset, fmt.Errorf("cannot parse record #%d in record batch at offset %d: %w", i, baseOffset, d.err)
+			}
+
+			// attributes
+			_ = rd.int8()
+			// timestampDelta
+			_ = rd.varint()
+			offsetDelta := rd.varint()
+			// key
+			_ = rd.varintBytes()
+			value := rd.varintBytes()
+			// Headers are ignored
+			if rd.err != nil {
+				return nextOffset, fmt.Errorf("cannot parse record #%d in record batch at offset %d: %w", i, baseOffset, rd.err)
+			}
+
+			r.offset = baseOffset + offsetDelta
+			if r.offset < minOffset {
+				continue
+			}
+			r.value = value
+			if err := f(&r); err != nil {
+				return nextOffset, err
+			}
+		}
+		nextOffset = max(nextOffset, batchNextOffset)
+	}
+	return nextOffset, nil
+}
+
+func decompressRecords(dst, src []byte, codec int16) ([]byte, error) {
+	switch codec {
+	case compressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(src))
+		if err != nil {
+			return dst, err
+		}
+		bb := bytes.NewBuffer(dst)
+		if _, err := io.Copy(bb, zr); err != nil {
+			return dst, err
+		}
+		return bb.Bytes(), nil
+	case compressionSnappy:
+		return decompressSnappy(dst, src)
+	case compressionLZ4:
+		return dst, fmt.Errorf("lz4 compression isn't supported; configure Kafka producers or topic to use gzip, snappy or zstd compression instead")
+	case compressionZstd:
+		return zstd.Decompress(dst, src)
+	default:
+		return dst, fmt.Errorf("unknown compression codec %d", codec)
+	}
+}
+
+// decompressSnappy decompresses src in either raw snappy format or in xerial framing format.
+func decompressSnappy(dst, src []byte) ([]byte, error) {
+	if !bytes.HasPrefix(src, xerialSnappyHeader) {
+		return snappy.Decode(dst[:cap(dst)], src)
+	}
+
+	// Skip the header, the version and the compatible version.
+	headerSize := len(xerialSnappyHeader) + 8
+	if len(src) < headerSize {
+		return dst, fmt.Errorf("too short xerial snappy header; got %d bytes; want %d bytes", len(src), headerSize)
+	}
+	src = src[headerSize:]
+	for len(src) > 0 {
+		if len(src) < 4 {
+			return dst, fmt.Errorf("cannot read xerial snappy chunk length")
+		}
+		n := binary.BigEndian.Uint32(src)
+		src = src[4:]
+		if uint64(n) > uint64(len(src)) {
+			return dst, fmt.Errorf("too big xerial snappy chunk length: %d bytes; only %d bytes left", n, len(src))
+		}
+		decodedLen, err := snappy.DecodedLen(src[:n])
+		if err != nil {
+			return dst, err
+		}
+		dstLen := len(dst)
+		dst = append(dst, make([]byte, decodedLen)...)
+		if _, err := snappy.Decode(dst[dstLen:], src[:n]); err != nil {
+			return dst, err
+		}
+		src = src[n:]
+	}
+	return dst, nil
+}
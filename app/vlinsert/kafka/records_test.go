@@ -0,0 +1,211 @@
+package kafka
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding/zstd"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/gzip"
+)
+
+func TestParseRecordBatchesSuccess(t *testing.T) {
+	f := func(data []byte, minOffset int64, recordsExpected []string, nextOffsetExpected int64) {
+		t.Helper()
+
+		var records []string
+		nextOffset, err := parseRecordBatches(data, minOffset, func(r *record) error {
+			records = append(records, fmt.Sprintf("%d:%s", r.offset, r.value))
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(records, recordsExpected) {
+			t.Fatalf("unexpected records;\ngot\n%q\nwant\n%q", records, recordsExpected)
+		}
+		if nextOffset != nextOffsetExpected {
+			t.Fatalf("unexpected next offset; got %d; want %d", nextOffset, nextOffsetExpected)
+		}
+	}
+
+	values := []string{"foo", "", "bar baz"}
+
+	// empty data
+	f(nil, 0, nil, 0)
+	f(nil, 123, nil, 123)
+
+	// all the supported compression codecs
+	for _, codec := range []int16{compressionNone, compressionGzip, compressionSnappy, compressionZstd} {
+		data := marshalRecordBatch(nil, 10, values, codec, 0)
+		f(data, 0, []string{"10:foo", "11:", "12:bar baz"}, 13)
+	}
+
+	// snappy in xerial framing format
+	data := marshalRecordBatch(nil, 10, values, compressionSnappy, 0)
+	data = xerialSnappyBatch(data)
+	f(data, 0, []string{"10:foo", "11:", "12:bar baz"}, 13)
+
+	// multiple batches
+	data = marshalRecordBatch(nil, 0, []string{"a", "b"}, compressionNone, 0)
+	data = marshalRecordBatch(data, 2, []string{"c"}, compressionGzip, 0)
+	f(data, 0, []string{"0:a", "1:b", "2:c"}, 3)
+
+	// skip records below minOffset
+	f(data, 1, []string{"1:b", "2:c"}, 3)
+	f(data, 2, []string{"2:c"}, 3)
+	f(data, 3, nil, 3)
+
+	// skip control batches
+	data = marshalRecordBatch(nil, 0, []string{"a"}, compressionNone, 0)
+	data = marshalRecordBatch(data, 1, []string{"commit marker"}, compressionNone, attributeControlBatch)
+	data = marshalRecordBatch(data, 2, []string{"b"}, compressionNone, 0)
+	f(data, 0, []string{"0:a", "2:b"}, 3)
+
+	// skip truncated trailing batch
+	data = marshalRecordBatch(nil, 0, []string{"a"}, compressionNone, 0)
+	n := len(data)
+	data = marshalRecordBatch(data, 1, []string{"b"}, compressionNone, 0)
+	f(data[:n+recordBatchHeaderSize+1], 0, []string{"0:a"}, 1)
+	f(data[:n+5], 0, []string{"0:a"}, 1)
+}
+
+func TestParseRecordBatchesFailure(t *testing.T) {
+	f := func(data []byte) {
+		t.Helper()
+
+		_, err := parseRecordBatches(data, 0, func(_ *record) error {
+			return nil
+		})
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// unsupported lz4 compression
+	data := marshalRecordBatch(nil, 0, []string{"foo"}, compressionNone, 0)
+	binary.BigEndian.PutUint16(data[recordBatchMagicOffset+5:], compressionLZ4)
+	f(data)
+
+	// unsupported magic
+	data = marshalRecordBatch(nil, 0, []string{"foo"}, compressionNone, 0)
+	data[recordBatchMagicOffset] = 1
+	f(data)
+
+	// corrupted records
+	data = marshalRecordBatch(nil, 0, []string{"foo"}, compressionNone, 0)
+	data[recordBatchHeaderSize] = 0x7f
+	f(data)
+
+	// corrupted gzip data
+	data = marshalRecordBatch(nil, 0, []string{"foo"}, compressionNone, 0)
+	binary.BigEndian.PutUint16(data[recordBatchMagicOffset+5:], compressionGzip)
+	f(data)
+}
+
+// marshalRecordBatch appends Kafka record batch with the given values to dst and returns the result.
+func marshalRecordBatch(dst []byte, baseOffset int64, values []string, codec, attributes int16) []byte {
+	var records []byte
+	for i, v := range values {
+		var r []byte
+		// attributes
+		r = append(r, 0)
+		// timestampDelta
+		r = binary.AppendVarint(r, 0)
+		// offsetDelta
+		r = binary.AppendVarint(r, int64(i))
+		// key
+		r = binary.AppendVarint(r, -1)
+		// value
+		r = binary.AppendVarint(r, int64(len(v)))
+		r = append(r, v...)
+		// headers
+		r = binary.AppendVarint(r, 0)
+
+		records = binary.AppendVarint(records, int64(len(r)))
+		records = append(records, r...)
+	}
+	records = compressRecords(records, codec)
+
+	e := &encoder{}
+	// partitionLeaderEpoch
+	e.int32(0)
+	// magic
+	e.int8(2)
+	// crc isn't verified by the consumer
+	e.int32(0)
+	e.int16(attributes | codec)
+	// lastOffsetDelta
+	e.int32(int32(len(values) - 1))
+	// firstTimestamp, maxTimestamp
+	e.int64(0)
+	e.int64(0)
+	// producerId, producerEpoch, baseSequence
+	e.int64(-1)
+	e.int16(-1)
+	e.int32(-1)
+	e.int32(int32(len(values)))
+	e.b = append(e.b, records...)
+
+	dst = binary.BigEndian.AppendUint64(dst, uint64(baseOffset))
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(e.b)))
+	return append(dst, e.b...)
+}
+
+func compressRecords(data []byte, codec int16) []byte {
+	switch codec {
+	case compressionNone:
+		return data
+	case compressionGzip:
+		var bb bytes.Buffer
+		zw := gzip.NewWriter(&bb)
+		if _, err := zw.Write(data); err != nil {
+			panic(fmt.Errorf("BUG: cannot compress data: %w", err))
+		}
+		if err := zw.Close(); err != nil {
+			panic(fmt.Errorf("BUG: cannot compress data: %w", err))
+		}
+		return bb.Bytes()
+	case compressionSnappy:
+		return snappy.Encode(nil, data)
+	case compressionZstd:
+		return zstd.CompressLevel(nil, data, 1)
+	default:
+		panic(fmt.Errorf("BUG: unsupported codec %d", codec))
+	}
+}
+
+// xerialSnappyBatch converts the record batch with snappy-compressed records in raw format to xerial framing format.
+func xerialSnappyBatch(batch []byte) []byte {
+	header := batch[:recordBatchHeaderSize]
+	compressed := batch[recordBatchHeaderSize:]
+
+	// Split the compressed records into two chunks in order to verify multi-chunk decoding.
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		panic(fmt.Errorf("BUG: cannot decode snappy data: %w", err))
+	}
+	n := len(data) / 2
+	chunks := [][]byte{
+		snappy.Encode(nil, data[:n]),
+		snappy.Encode(nil, data[n:]),
+	}
+
+	var records []byte
+	records = append(records, xerialSnappyHeader...)
+	// version and compatible version
+	records = binary.BigEndian.AppendUint32(records, 1)
+	records = binary.BigEndian.AppendUint32(records, 1)
+	for _, chunk := range chunks {
+		records = binary.BigEndian.AppendUint32(records, uint32(len(chunk)))
+		records = append(records, chunk...)
+	}
+
+	result := append([]byte{}, header...)
+	result = append(result, records...)
+	binary.BigEndian.PutUint32(result[recordBatchLengthOffset:], uint32(len(result)-12))
+	return result
+}
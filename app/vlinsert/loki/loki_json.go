@@ -35,6 +35,10 @@ func handleJSON(r *http.Request, w http.ResponseWriter) {
 		httpserver.Errorf(w, r, "%s", err)
 		return
 	}
+	if err := insertutil.CheckTenantLimits(cp.cp.TenantID); err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
 
 	encoding := r.Header.Get("Content-Encoding")
 	err = protoparserutil.ReadUncompressedData(r.Body, encoding, maxRequestSize, func(data []byte) error {
@@ -42,7 +46,10 @@ func handleJSON(r *http.Request, w http.ResponseWriter) {
 		useDefaultStreamFields := len(cp.cp.StreamFields) == 0
 		err := parseJSONRequest(data, lmp, cp.cp.MsgFields, useDefaultStreamFields, cp.parseMessage)
 		lmp.MustClose()
-		return err
+		if err != nil {
+			return err
+		}
+		return insertutil.CheckRowsDroppedByTenantLimits(lmp)
 	})
 	if err != nil {
 		httpserver.Errorf(w, r, "cannot read Loki json data: %s", err)
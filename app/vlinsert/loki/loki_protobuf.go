@@ -33,6 +33,10 @@ func handleProtobuf(r *http.Request, w http.ResponseWriter) {
 		httpserver.Errorf(w, r, "%s", err)
 		return
 	}
+	if err := insertutil.CheckTenantLimits(cp.cp.TenantID); err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
 
 	encoding := r.Header.Get("Content-Encoding")
 	if encoding == "" {
@@ -45,7 +49,10 @@ func handleProtobuf(r *http.Request, w http.ResponseWriter) {
 		useDefaultStreamFields := len(cp.cp.StreamFields) == 0
 		err := parseProtobufRequest(data, lmp, cp.cp.MsgFields, useDefaultStreamFields, cp.parseMessage)
 		lmp.MustClose()
-		return err
+		if err != nil {
+			return err
+		}
+		return insertutil.CheckRowsDroppedByTenantLimits(lmp)
 	})
 	if err != nil {
 		httpserver.Errorf(w, r, "cannot read Loki protobuf data: %s", err)
@@ -10,11 +10,15 @@ import (
 
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/datadog"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/elasticsearch"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/internalinsert"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/journald"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/jsonline"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/kafka"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/loki"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/native"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/opentelemetry"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/parquet"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/syslog"
 )
 
@@ -25,11 +29,14 @@ var (
 
 // Init initializes vlinsert
 func Init() {
+	insertutil.MustInit()
 	syslog.MustInit()
+	kafka.MustInit()
 }
 
 // Stop stops vlinsert
 func Stop() {
+	kafka.MustStop()
 	syslog.MustStop()
 }
 
@@ -63,6 +70,12 @@ func insertHandler(w http.ResponseWriter, r *http.Request, path string) bool {
 	case "/insert/jsonline":
 		jsonline.RequestHandler(w, r)
 		return true
+	case "/insert/native":
+		native.RequestHandler(w, r)
+		return true
+	case "/insert/parquet":
+		parquet.RequestHandler(w, r)
+		return true
 	case "/insert/ready":
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(200)
@@ -0,0 +1,203 @@
+package native
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/protoparserutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/slicesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/writeconcurrencylimiter"
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+var maxBlockSize = flagutil.NewBytes("native.maxBlockSize", 64*1024*1024, "The maximum size in bytes of a single data block, which can be accepted at /insert/native . "+
+	"See https://docs.victoriametrics.com/victorialogs/data-ingestion/#native-format")
+
+// RequestHandler processes /insert/native requests.
+//
+// See https://docs.victoriametrics.com/victorialogs/data-ingestion/#native-format
+func RequestHandler(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	w.Header().Add("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	requestsTotal.Inc()
+
+	cp, err := insertutil.GetCommonParams(r)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	if err := insertutil.CanWriteData(); err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	if err := insertutil.CheckTenantLimits(cp.TenantID); err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+
+	encoding := r.Header.Get("Content-Encoding")
+	reader, err := protoparserutil.GetUncompressedReader(r.Body, encoding)
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot decode native request: %s", err)
+		return
+	}
+	defer protoparserutil.PutUncompressedReader(reader)
+
+	lmp := cp.NewLogMessageProcessor("native", true)
+	err = processStream(reader, lmp)
+	lmp.MustClose()
+	if err == nil {
+		err = insertutil.CheckRowsDroppedByTenantLimits(lmp)
+	}
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot process native request: %s", err)
+		return
+	}
+
+	requestDuration.UpdateDuration(startTime)
+}
+
+// processStream reads data blocks exported via /select/logsql/export_native from r and sends them to lmp.
+//
+// Every data block is prefixed with its size encoded as varuint64.
+func processStream(r io.Reader, lmp insertutil.LogMessageProcessor) error {
+	wcr := writeconcurrencylimiter.GetReader(r)
+	defer writeconcurrencylimiter.PutReader(wcr)
+
+	br := bufio.NewReader(wcr)
+
+	var bp blockProcessor
+	for {
+		blockSize, err := binary.ReadUvarint(br)
+		if err != nil {
+			wcr.DecConcurrency()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("cannot read data block size: %w", err)
+		}
+		if blockSize > uint64(maxBlockSize.IntN()) {
+			wcr.DecConcurrency()
+			return fmt.Errorf("too big data block size: %d bytes; mustn't exceed -native.maxBlockSize=%d bytes", blockSize, maxBlockSize.IntN())
+		}
+		bp.buf = slicesutil.SetLength(bp.buf, int(blockSize))
+		_, err = io.ReadFull(br, bp.buf)
+		wcr.DecConcurrency()
+		if err != nil {
+			return fmt.Errorf("cannot read data block with the size %d bytes: %w", blockSize, err)
+		}
+
+		if err := bp.processBlock(lmp); err != nil {
+			return err
+		}
+	}
+}
+
+type blockProcessor struct {
+	buf       []byte
+	valuesBuf []string
+
+	db logstorage.DataBlock
+
+	fields []logstorage.Field
+
+	// streamFields must be non-nil in order to override the stream fields configured via _stream_fields query arg.
+	streamFields []logstorage.Field
+}
+
+// processBlock unmarshals data block from bp.buf and sends the logs from it to lmp.
+//
+// The _time field is used as log timestamp, while the _stream field is used as log stream.
+// The _stream_id field is ignored, since it is generated from _stream during data ingestion.
+func (bp *blockProcessor) processBlock(lmp insertutil.LogMessageProcessor) error {
+	db := &bp.db
+	tail, valuesBuf, err := db.UnmarshalInplace(bp.buf, bp.valuesBuf[:0])
+	bp.valuesBuf = valuesBuf
+	if err != nil {
+		return fmt.Errorf("cannot unmarshal data block: %w", err)
+	}
+	if len(tail) > 0 {
+		return fmt.Errorf("unexpected non-empty tail left after unmarshaling data block; len(tail)=%d", len(tail))
+	}
+
+	if bp.streamFields == nil {
+		bp.streamFields = make([]logstorage.Field, 0, 8)
+	}
+
+	rowsCount := db.RowsCount()
+	rowsSkipped := 0
+	for i := 0; i < rowsCount; i++ {
+		timestamp := time.Now().UnixNano()
+		fields := bp.fields[:0]
+		streamFields := bp.streamFields[:0]
+		hasStream := false
+		ok := true
+		for _, c := range db.Columns {
+			v := c.Values[i]
+			switch c.Name {
+			case "_time":
+				nsecs, tsOK := logstorage.TryParseTimestampRFC3339Nano(v)
+				if !tsOK {
+					logger.Warnf("native: cannot parse _time=%q; skipping the log entry", v)
+					ok = false
+					continue
+				}
+				timestamp = nsecs
+			case "_stream":
+				streamFields, err = logstorage.ParseStreamFields(streamFields, v)
+				if err != nil {
+					logger.Warnf("native: cannot parse _stream=%q: %s; skipping the log entry", v, err)
+					ok = false
+					continue
+				}
+				hasStream = true
+			case "_stream_id":
+				// Skip _stream_id, since it is generated from _stream during data ingestion.
+			default:
+				fields = append(fields, logstorage.Field{
+					Name:  c.Name,
+					Value: v,
+				})
+			}
+		}
+		bp.fields = fields
+		bp.streamFields = streamFields
+
+		if !ok {
+			rowsSkipped++
+			continue
+		}
+		if !hasStream {
+			// Use stream fields from _stream_fields query arg
+			streamFields = nil
+		}
+		lmp.AddRow(timestamp, fields, streamFields)
+	}
+	errorsTotal.Add(rowsSkipped)
+
+	return nil
+}
+
+var (
+	requestsTotal = metrics.NewCounter(`vl_http_requests_total{path="/insert/native"}`)
+	errorsTotal   = metrics.NewCounter(`vl_http_errors_total{path="/insert/native"}`)
+
+	requestDuration = metrics.NewSummary(`vl_http_request_duration_seconds{path="/insert/native"}`)
+)
@@ -0,0 +1,141 @@
+package native
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+type testLogMessageProcessor struct {
+	rows []string
+}
+
+func (tlp *testLogMessageProcessor) AddRow(timestamp int64, fields, streamFields []logstorage.Field) {
+	stream := "<default>"
+	if streamFields != nil {
+		st := logstorage.GetStreamTags()
+		for _, f := range streamFields {
+			st.Add(f.Name, f.Value)
+		}
+		stream = st.String()
+		logstorage.PutStreamTags(st)
+	}
+	tf := logstorage.TimeFormatter(timestamp)
+	row := string(logstorage.MarshalFieldsToJSON(nil, fields))
+	tlp.rows = append(tlp.rows, tf.String()+" "+stream+" "+row)
+}
+
+func (tlp *testLogMessageProcessor) MustClose() {
+}
+
+func TestProcessStreamSuccess(t *testing.T) {
+	f := func(blocks []*logstorage.DataBlock, resultExpected string) {
+		t.Helper()
+
+		var data []byte
+		for _, db := range blocks {
+			data = encoding.MarshalBytes(data, db.Marshal(nil))
+		}
+
+		tlp := &testLogMessageProcessor{}
+		if err := processStream(bytes.NewReader(data), tlp); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		result := strings.Join(tlp.rows, "\n")
+		if result != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	// Empty stream
+	f(nil, "")
+
+	// Multiple blocks
+	blocks := []*logstorage.DataBlock{
+		{
+			Columns: []logstorage.BlockColumn{
+				{
+					Name:   "_time",
+					Values: []string{"2025-01-02T03:04:05.123456789Z", "2025-01-02T03:04:06Z"},
+				},
+				{
+					Name:   "_stream_id",
+					Values: []string{"00000000000000005e6570d61e203e93235541f012058141", "0000000000000000e934a84adb05276890d7f7bfcadabe92"},
+				},
+				{
+					Name:   "_stream",
+					Values: []string{`{host="a",app="x"}`, `{}`},
+				},
+				{
+					Name:   "_msg",
+					Values: []string{"foo", "bar"},
+				},
+				{
+					Name:   "host",
+					Values: []string{"a", ""},
+				},
+			},
+		},
+		{
+			Columns: []logstorage.BlockColumn{
+				{
+					Name:   "_time",
+					Values: []string{"2025-01-02T03:04:07Z"},
+				},
+				{
+					Name:   "_msg",
+					Values: []string{"without stream"},
+				},
+			},
+		},
+	}
+	resultExpected := `2025-01-02T03:04:05.123456789Z {host="a",app="x"} {"_msg":"foo","host":"a"}
+2025-01-02T03:04:06Z {} {"_msg":"bar"}
+2025-01-02T03:04:07Z <default> {"_msg":"without stream"}`
+	f(blocks, resultExpected)
+
+	// Invalid rows are skipped
+	blocks = []*logstorage.DataBlock{
+		{
+			Columns: []logstorage.BlockColumn{
+				{
+					Name:   "_time",
+					Values: []string{"invalid", "2025-01-02T03:04:06Z", "2025-01-02T03:04:07Z"},
+				},
+				{
+					Name:   "_stream",
+					Values: []string{`{}`, `{host=`, `{host="b"}`},
+				},
+			},
+		},
+	}
+	resultExpected = `2025-01-02T03:04:07Z {host="b"} {}`
+	f(blocks, resultExpected)
+}
+
+func TestProcessStreamFailure(t *testing.T) {
+	f := func(data []byte) {
+		t.Helper()
+
+		tlp := &testLogMessageProcessor{}
+		if err := processStream(bytes.NewReader(data), tlp); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// Truncated block size
+	f([]byte{0x80})
+
+	// Truncated block
+	f([]byte{0x10, 0x01})
+
+	// Invalid block
+	f(encoding.MarshalBytes(nil, []byte("foobar")))
+
+	// Too big block
+	f(encoding.MarshalVarUint64(nil, 1<<40))
+}
@@ -0,0 +1,121 @@
+package parquet
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/protoparserutil"
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/parquet"
+)
+
+var maxRequestSize = flagutil.NewBytes("parquet.maxRequestSize", 256*1024*1024, "The maximum size in bytes of a single Parquet file, "+
+	"which can be sent to /insert/parquet. See https://docs.victoriametrics.com/victorialogs/data-ingestion/#parquet")
+
+// RequestHandler processes /insert/parquet requests.
+//
+// See https://docs.victoriametrics.com/victorialogs/data-ingestion/#parquet
+func RequestHandler(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	w.Header().Add("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	requestsTotal.Inc()
+
+	cp, err := insertutil.GetCommonParams(r)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	if err := insertutil.CanWriteData(); err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	if err := insertutil.CheckTenantLimits(cp.TenantID); err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+
+	encoding := r.Header.Get("Content-Encoding")
+	err = protoparserutil.ReadUncompressedData(r.Body, encoding, maxRequestSize, func(data []byte) error {
+		lmp := cp.NewLogMessageProcessor("parquet", false)
+		err := processData(data, cp.TimeFields, cp.MsgFields, lmp)
+		lmp.MustClose()
+		if err != nil {
+			return err
+		}
+		return insertutil.CheckRowsDroppedByTenantLimits(lmp)
+	})
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot process Parquet request: %s", err)
+		return
+	}
+
+	requestDuration.UpdateDuration(startTime)
+}
+
+// processData reads logs from Parquet file contents in data and sends them to lmp.
+//
+// The _time field is obtained from the first existing column from timeFields.
+// The _msg field is obtained from the first existing column from msgFields.
+//
+// The _stream and _stream_id columns are ignored.
+func processData(data []byte, timeFields, msgFields []string, lmp insertutil.LogMessageProcessor) error {
+	pr, err := parquet.NewReader(data)
+	if err != nil {
+		return fmt.Errorf("cannot open Parquet file: %w", err)
+	}
+
+	n := 0
+	errors := 0
+	var lastError error
+	err = pr.ForEachRow(func(fields []logstorage.Field) error {
+		n++
+
+		// Drop _stream and _stream_id columns, which are present in Parquet files exported from VictoriaLogs,
+		// since they are generated during data ingestion according to the _stream_fields query arg.
+		fields = slices.DeleteFunc(fields, func(f logstorage.Field) bool {
+			return f.Name == "_stream" || f.Name == "_stream_id"
+		})
+
+		ts, err := insertutil.ExtractTimestampFromFields(timeFields, fields)
+		if err != nil {
+			lastError = err
+			errors++
+			logger.Warnf("parquet: cannot process row #%d: %s", n, err)
+			return nil
+		}
+		logstorage.RenameField(fields, msgFields, "_msg")
+		lmp.AddRow(ts, fields, nil)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("cannot read Parquet file: %w", err)
+	}
+	errorsTotal.Add(errors)
+
+	if errors > 0 && n == errors {
+		// Return an error if no logs were processed and there were errors
+		return lastError
+	}
+	return nil
+}
+
+var (
+	requestsTotal = metrics.NewCounter(`vl_http_requests_total{path="/insert/parquet"}`)
+	errorsTotal   = metrics.NewCounter(`vl_http_errors_total{path="/insert/parquet"}`)
+
+	requestDuration = metrics.NewSummary(`vl_http_request_duration_seconds{path="/insert/parquet"}`)
+)
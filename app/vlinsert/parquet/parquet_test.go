@@ -0,0 +1,100 @@
+package parquet
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlinsert/insertutil"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/parquet"
+)
+
+func TestProcessDataSuccess(t *testing.T) {
+	f := func(rows [][]logstorage.Field, timeField, msgField string, timestampsExpected []int64, resultExpected string) {
+		t.Helper()
+
+		var bb bytes.Buffer
+		pw := parquet.NewWriter(&bb, parquet.CodecSnappy)
+		for _, fields := range rows {
+			if err := pw.WriteRow(fields); err != nil {
+				t.Fatalf("cannot write row: %s", err)
+			}
+		}
+		if err := pw.Close(); err != nil {
+			t.Fatalf("cannot close Parquet writer: %s", err)
+		}
+
+		timeFields := []string{timeField}
+		msgFields := []string{msgField}
+		tlp := &insertutil.TestLogMessageProcessor{}
+		if err := processData(bb.Bytes(), timeFields, msgFields, tlp); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if err := tlp.Verify(timestampsExpected, resultExpected); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// _time column is stored as TIMESTAMP column
+	rows := [][]logstorage.Field{
+		{
+			{Name: "_time", Value: "2023-06-06T04:48:11.735Z"},
+			{Name: "message", Value: "foobar"},
+			{Name: "host", Value: "host-1"},
+		},
+		{
+			{Name: "_time", Value: "2023-06-06T04:48:12.735Z"},
+			{Name: "message", Value: "baz"},
+		},
+	}
+	timestampsExpected := []int64{1686026891735000000, 1686026892735000000}
+	resultExpected := `{"_msg":"foobar","host":"host-1"}
+{"_msg":"baz"}`
+	f(rows, "_time", "message", timestampsExpected, resultExpected)
+
+	// Custom time column stored as string
+	rows = [][]logstorage.Field{
+		{
+			{Name: "ts", Value: "2023-06-06T04:48:11.735+01:00"},
+			{Name: "_msg", Value: "foobar"},
+		},
+		{
+			{Name: "ts", Value: "1686026892"},
+			{Name: "_msg", Value: "baz"},
+			{Name: "x", Value: "y"},
+		},
+	}
+	timestampsExpected = []int64{1686023291735000000, 1686026892000000000}
+	resultExpected = `{"_msg":"foobar"}
+{"_msg":"baz","x":"y"}`
+	f(rows, "ts", "_msg", timestampsExpected, resultExpected)
+
+	// _stream and _stream_id columns are ignored
+	rows = [][]logstorage.Field{
+		{
+			{Name: "_time", Value: "2023-06-06T04:48:11Z"},
+			{Name: "_stream_id", Value: "00000000000000005e6570d61e203e93235541f012058141"},
+			{Name: "_stream", Value: `{host="a"}`},
+			{Name: "_msg", Value: "foobar"},
+			{Name: "host", Value: "a"},
+		},
+	}
+	timestampsExpected = []int64{1686026891000000000}
+	resultExpected = `{"_msg":"foobar","host":"a"}`
+	f(rows, "_time", "_msg", timestampsExpected, resultExpected)
+}
+
+func TestProcessDataFailure(t *testing.T) {
+	f := func(data []byte) {
+		t.Helper()
+
+		tlp := &insertutil.TestLogMessageProcessor{}
+		if err := processData(data, []string{"_time"}, []string{"_msg"}, tlp); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	f(nil)
+	f([]byte("not a parquet file"))
+}
@@ -428,6 +428,9 @@ func processStream(protocol string, r io.Reader, compressMethod string, useLocal
 	if err := insertutil.CanWriteData(); err != nil {
 		return err
 	}
+	if err := insertutil.CheckTenantLimits(cp.TenantID); err != nil {
+		return err
+	}
 
 	lmp := cp.NewLogMessageProcessor("syslog_"+protocol, true)
 	err := processStreamInternal(r, compressMethod, useLocalTimestamp, remoteIP, lmp)
@@ -446,6 +449,13 @@ func processStreamInternal(r io.Reader, compressMethod string, useLocalTimestamp
 	return processUncompressedStream(reader, useLocalTimestamp, remoteIP, lmp)
 }
 
+// ProcessStream parses uncompressed syslog messages from r and sends them to lmp.
+//
+// It is used by data ingestion protocols, which transfer syslog messages, such as Kafka. MustInit must be called before using this function.
+func ProcessStream(r io.Reader, useLocalTimestamp bool, lmp insertutil.LogMessageProcessor) error {
+	return processUncompressedStream(r, useLocalTimestamp, "", lmp)
+}
+
 func processUncompressedStream(r io.Reader, useLocalTimestamp bool, remoteIP string, lmp insertutil.LogMessageProcessor) error {
 	wcr := writeconcurrencylimiter.GetReader(r)
 	defer writeconcurrencylimiter.PutReader(wcr)
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/buildinfo"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/envflag"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/ratelimiter"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	storageNodeAddrs = flagutil.NewArrayString("storageNode", "Comma-separated list of TCP addresses for all the vlstorage nodes in the cluster including the newly added nodes. "+
+		"See https://docs.victoriametrics.com/victorialogs/cluster/#rebalancing")
+	replicationFactor = flag.Int("replicationFactor", 1, "The -replicationFactor used by vlinsert for storing logs at -storageNode nodes. "+
+		"vlrebalance refuses to run if it is bigger than 1, since the moved logs must stay at the nodes their log streams are placed at. "+
+		"See https://docs.victoriametrics.com/victorialogs/cluster/#rebalancing")
+	mode = flag.String("mode", "stream", "Rebalancing mode. Supported values: 'stream' - move per-day log streams between -storageNode nodes; "+
+		"'partition' - move the whole per-day partitions for tenants between -storageNode nodes")
+	partitionPrefix = flag.String("partitionPrefix", "", "Optional prefix for names of per-day partitions in the form YYYYMMDD to rebalance; "+
+		"for example, -partitionPrefix=202501 rebalances only partitions for January 2025. By default all the partitions older than -minDataAge are rebalanced")
+	minDataAge = flag.Duration("minDataAge", 24*time.Hour, "The minimum duration since the end of the day for rebalancing logs for this day. "+
+		"Recent days are skipped, since they may still receive new logs, which could be lost during the rebalancing")
+	tolerance = flag.Float64("tolerance", 0.05, "The allowed relative excess of the number of stored log entries at -storageNode over the average number of stored log entries "+
+		"across all the -storageNode nodes. Log entries aren't moved from -storageNode nodes with smaller excess")
+	stateFile = flag.String("stateFile", "vlrebalance-state.json", "Path to the file for storing the rebalancing state. "+
+		"It is used for safe resumption of the interrupted rebalancing")
+	dryRun            = flag.Bool("dryRun", false, "Whether to log the planned moves without moving the data")
+	maxBytesPerSecond = flagutil.NewBytes("maxBytesPerSecond", 0, "The maximum number of bytes per second to send to -storageNode nodes during the rebalancing. "+
+		"By default the rate isn't limited")
+	concurrency        = flag.Int("concurrency", 1, "The number of concurrent moves")
+	progressInterval   = flag.Duration("progressInterval", 10*time.Second, "The interval for logging the rebalancing progress")
+	disableCompression = flag.Bool("disableCompression", false, "Whether to disable compression for the data sent to and received from -storageNode nodes. "+
+		"Disabled compression reduces CPU usage at the cost of higher network usage")
+	forceFlushAuthKey = flagutil.NewPassword("forceFlushAuthKey", "authKey for /internal/force_flush endpoint at -storageNode nodes; it must match -forceFlushAuthKey at -storageNode nodes")
+
+	storageNodeUsername     = flagutil.NewArrayString("storageNode.username", "Optional basic auth username to use for the corresponding -storageNode")
+	storageNodePassword     = flagutil.NewArrayString("storageNode.password", "Optional basic auth password to use for the corresponding -storageNode")
+	storageNodePasswordFile = flagutil.NewArrayString("storageNode.passwordFile", "Optional path to basic auth password to use for the corresponding -storageNode. "+
+		"The file is re-read every second")
+	storageNodeBearerToken     = flagutil.NewArrayString("storageNode.bearerToken", "Optional bearer auth token to use for the corresponding -storageNode")
+	storageNodeBearerTokenFile = flagutil.NewArrayString("storageNode.bearerTokenFile", "Optional path to bearer token file to use for the corresponding -storageNode. "+
+		"The token is re-read from the file every second")
+
+	storageNodeTLS = flagutil.NewArrayBool("storageNode.tls", "Whether to use TLS (HTTPS) protocol for communicating with the corresponding -storageNode. "+
+		"By default communication is performed via HTTP")
+	storageNodeTLSCAFile = flagutil.NewArrayString("storageNode.tlsCAFile", "Optional path to TLS CA file to use for verifying connections to the corresponding -storageNode. "+
+		"By default, system CA is used")
+	storageNodeTLSCertFile = flagutil.NewArrayString("storageNode.tlsCertFile", "Optional path to client-side TLS certificate file to use when connecting "+
+		"to the corresponding -storageNode")
+	storageNodeTLSKeyFile    = flagutil.NewArrayString("storageNode.tlsKeyFile", "Optional path to client-side TLS certificate key to use when connecting to the corresponding -storageNode")
+	storageNodeTLSServerName = flagutil.NewArrayString("storageNode.tlsServerName", "Optional TLS server name to use for connections to the corresponding -storageNode. "+
+		"By default, the server name from -storageNode is used")
+	storageNodeTLSInsecureSkipVerify = flagutil.NewArrayBool("storageNode.tlsInsecureSkipVerify", "Whether to skip tls verification when connecting to the corresponding -storageNode")
+)
+
+func main() {
+	// Write flags and help message to stdout, since it is easier to grep or pipe.
+	flag.CommandLine.SetOutput(os.Stdout)
+	envflag.Parse()
+	buildinfo.Init()
+	logger.Init()
+
+	addrs := *storageNodeAddrs
+	if len(addrs) < 2 {
+		logger.Fatalf("at least two -storageNode command-line flags must be set; got %d", len(addrs))
+	}
+	if *replicationFactor > 1 {
+		logger.Fatalf("vlrebalance cannot be used with -replicationFactor=%d, since it would move replicated log streams outside the nodes they are placed at; "+
+			"see https://docs.victoriametrics.com/victorialogs/cluster/#rebalancing", *replicationFactor)
+	}
+	if *mode != "stream" && *mode != "partition" {
+		logger.Fatalf("unsupported -mode=%q; supported values: stream, partition", *mode)
+	}
+	if *concurrency < 1 {
+		logger.Fatalf("-concurrency must be bigger than 0; got %d", *concurrency)
+	}
+	if *minDataAge < 0 {
+		logger.Fatalf("-minDataAge cannot be negative; got %s", *minDataAge)
+	}
+	if *tolerance < 0 {
+		logger.Fatalf("-tolerance cannot be negative; got %v", *tolerance)
+	}
+
+	nodes := make(map[string]*storageNode, len(addrs))
+	for i, addr := range addrs {
+		if nodes[addr] != nil {
+			logger.Fatalf("duplicate -storageNode=%q", addr)
+		}
+		nodes[addr] = newStorageNode(addr, newAuthConfigForStorageNode(i), storageNodeTLS.GetOptionalArg(i))
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	rs, err := readState(*stateFile)
+	if err != nil {
+		logger.Fatalf("cannot read -stateFile=%q: %s", *stateFile, err)
+	}
+	if rs != nil && rs.unfinishedMoves() > 0 {
+		for _, m := range rs.Moves {
+			if nodes[m.Src] == nil || nodes[m.Dst] == nil {
+				logger.Fatalf("-stateFile=%q contains the move %s between nodes missing in -storageNode list", *stateFile, m)
+			}
+		}
+		logger.Infof("resuming %d unfinished moves from -stateFile=%q", rs.unfinishedMoves(), *stateFile)
+	} else {
+		logger.Infof("planning the rebalancing for %d nodes in -mode=%s", len(addrs), *mode)
+		rs, err = newRebalanceState(ctx, addrs, nodes, *partitionPrefix, *mode == "stream", *tolerance, *minDataAge)
+		if err != nil {
+			logger.Fatalf("cannot plan the rebalancing: %s", err)
+		}
+	}
+
+	if *dryRun {
+		for _, m := range rs.Moves {
+			if !m.isFinished() {
+				logger.Infof("planned move of %s", m)
+			}
+		}
+		logger.Infof("planned %d moves; exiting, since -dryRun is set", rs.unfinishedMoves())
+		return
+	}
+	if rs.unfinishedMoves() == 0 {
+		logger.Infof("the data is already balanced among -storageNode nodes; nothing to move")
+		return
+	}
+
+	rb := &rebalancer{
+		nodes:      nodes,
+		statePath:  *stateFile,
+		state:      rs,
+		minDataAge: *minDataAge,
+	}
+	if n := maxBytesPerSecond.IntN(); n > 0 {
+		rb.rl = ratelimiter.New(int64(n), metrics.NewCounter(`vl_rebalance_rate_limit_reached_total`), ctx.Done())
+	}
+	rb.mustSaveState()
+
+	failedMoves := rb.run(ctx, *concurrency, *progressInterval)
+	if ctx.Err() != nil {
+		logger.Fatalf("the rebalancing has been interrupted; %d moves are left unfinished; run vlrebalance with the same -stateFile in order to resume it", failedMoves)
+	}
+	if failedMoves > 0 {
+		logger.Fatalf("%d moves failed; run vlrebalance with the same -stateFile in order to retry them", failedMoves)
+	}
+	logger.Infof("the rebalancing has been successfully finished")
+}
+
+func newAuthConfigForStorageNode(argIdx int) *promauth.Config {
+	username := storageNodeUsername.GetOptionalArg(argIdx)
+	password := storageNodePassword.GetOptionalArg(argIdx)
+	passwordFile := storageNodePasswordFile.GetOptionalArg(argIdx)
+	var basicAuthCfg *promauth.BasicAuthConfig
+	if username != "" || password != "" || passwordFile != "" {
+		basicAuthCfg = &promauth.BasicAuthConfig{
+			Username:     username,
+			Password:     promauth.NewSecret(password),
+			PasswordFile: passwordFile,
+		}
+	}
+
+	token := storageNodeBearerToken.GetOptionalArg(argIdx)
+	tokenFile := storageNodeBearerTokenFile.GetOptionalArg(argIdx)
+
+	tlsCfg := &promauth.TLSConfig{
+		CAFile:             storageNodeTLSCAFile.GetOptionalArg(argIdx),
+		CertFile:           storageNodeTLSCertFile.GetOptionalArg(argIdx),
+		KeyFile:            storageNodeTLSKeyFile.GetOptionalArg(argIdx),
+		ServerName:         storageNodeTLSServerName.GetOptionalArg(argIdx),
+		InsecureSkipVerify: storageNodeTLSInsecureSkipVerify.GetOptionalArg(argIdx),
+	}
+
+	opts := &promauth.Options{
+		BasicAuth:       basicAuthCfg,
+		BearerToken:     token,
+		BearerTokenFile: tokenFile,
+		TLSConfig:       tlsCfg,
+	}
+	ac, err := opts.NewConfig()
+	if err != nil {
+		logger.Fatalf("cannot populate auth config for -storageNode #%d: %s", argIdx, err)
+	}
+
+	return ac
+}
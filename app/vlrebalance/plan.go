@@ -0,0 +1,125 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+// unitKey identifies the data, which can be moved between storage nodes as a whole.
+type unitKey struct {
+	tenantID logstorage.TenantID
+
+	// day is the per-day partition name in the form YYYYMMDD.
+	day string
+
+	// streamID is the _stream_id of the moved log stream.
+	//
+	// It is empty if the whole partition for the tenant must be moved.
+	streamID string
+}
+
+// unit is the data for the given key stored at the storage node with the src index.
+type unit struct {
+	key  unitKey
+	src  int
+	rows uint64
+}
+
+// plannedMove is the move of the given unit to the storage node with the dst index.
+type plannedMove struct {
+	unit
+	dst int
+}
+
+// planMoves returns moves for the given units, which make the loads at storage nodes more even.
+//
+// loads must contain the number of rows stored at every storage node. It is updated according to the returned moves.
+//
+// Moves are planned only from storage nodes with loads exceeding the average load by more than tolerance
+// to storage nodes with loads below the average. The unit is never moved to the storage node, which already contains
+// the data for the unit key, since this would break safe resumption of the interrupted move and would reduce the number of replicas.
+func planMoves(loads []uint64, units []unit, tolerance float64) []plannedMove {
+	if len(loads) < 2 {
+		return nil
+	}
+
+	total := uint64(0)
+	for _, load := range loads {
+		total += load
+	}
+	avgLoad := float64(total) / float64(len(loads))
+	maxLoad := avgLoad * (1 + tolerance)
+
+	present := make(map[unitKey][]bool)
+	for _, u := range units {
+		p := present[u.key]
+		if p == nil {
+			p = make([]bool, len(loads))
+			present[u.key] = p
+		}
+		p[u.src] = true
+	}
+
+	// Move the biggest units at first, so the smaller units could be used for fine-tuning the loads.
+	units = slices.Clone(units)
+	slices.SortFunc(units, func(a, b unit) int {
+		if n := cmp.Compare(b.rows, a.rows); n != 0 {
+			return n
+		}
+		return compareUnits(a, b)
+	})
+
+	var moves []plannedMove
+	for _, u := range units {
+		if u.rows == 0 || u.rows > loads[u.src] || float64(loads[u.src]) <= maxLoad {
+			continue
+		}
+
+		p := present[u.key]
+		dst := -1
+		for i, load := range loads {
+			if p[i] {
+				continue
+			}
+			if dst < 0 || load < loads[dst] {
+				dst = i
+			}
+		}
+		if dst < 0 || float64(loads[dst]) >= avgLoad {
+			continue
+		}
+		if loads[dst]+u.rows > loads[u.src]-u.rows {
+			// The move would make the dst node more loaded than the src node.
+			continue
+		}
+
+		loads[u.src] -= u.rows
+		loads[dst] += u.rows
+		p[dst] = true
+
+		moves = append(moves, plannedMove{
+			unit: u,
+			dst:  dst,
+		})
+	}
+
+	return moves
+}
+
+func compareUnits(a, b unit) int {
+	if n := cmp.Compare(a.key.tenantID.AccountID, b.key.tenantID.AccountID); n != 0 {
+		return n
+	}
+	if n := cmp.Compare(a.key.tenantID.ProjectID, b.key.tenantID.ProjectID); n != 0 {
+		return n
+	}
+	if n := cmp.Compare(a.key.day, b.key.day); n != 0 {
+		return n
+	}
+	if n := cmp.Compare(a.key.streamID, b.key.streamID); n != 0 {
+		return n
+	}
+	return cmp.Compare(a.src, b.src)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestPlanMoves(t *testing.T) {
+	f := func(loads []uint64, units []unit, tolerance float64, movesExpected []string, loadsExpected []uint64) {
+		t.Helper()
+
+		pms := planMoves(loads, units, tolerance)
+		moves := make([]string, 0, len(pms))
+		for _, pm := range pms {
+			moves = append(moves, fmt.Sprintf("%d:%s/%s %d->%d (%d)", pm.key.tenantID.AccountID, pm.key.day, pm.key.streamID, pm.src, pm.dst, pm.rows))
+		}
+		if !reflect.DeepEqual(moves, movesExpected) {
+			t.Fatalf("unexpected moves\ngot\n%s\nwant\n%s", strings.Join(moves, "\n"), strings.Join(movesExpected, "\n"))
+		}
+		if !reflect.DeepEqual(loads, loadsExpected) {
+			t.Fatalf("unexpected loads; got %v; want %v", loads, loadsExpected)
+		}
+	}
+
+	newUnit := func(accountID uint32, day, streamID string, src int, rows uint64) unit {
+		return unit{
+			key: unitKey{
+				tenantID: logstorage.TenantID{
+					AccountID: accountID,
+				},
+				day:      day,
+				streamID: streamID,
+			},
+			src:  src,
+			rows: rows,
+		}
+	}
+
+	// A single node
+	f([]uint64{100}, []unit{newUnit(0, "20250101", "", 0, 100)}, 0, []string{}, []uint64{100})
+
+	// Already balanced nodes
+	f([]uint64{100, 100}, []unit{
+		newUnit(0, "20250101", "", 0, 100),
+		newUnit(0, "20250101", "", 1, 100),
+	}, 0, []string{}, []uint64{100, 100})
+
+	// Move partitions to the newly added node
+	f([]uint64{300, 300, 0}, []unit{
+		newUnit(0, "20250101", "", 0, 100),
+		newUnit(0, "20250102", "", 0, 200),
+		newUnit(0, "20250101", "", 1, 200),
+		newUnit(0, "20250102", "", 1, 100),
+	}, 0, []string{
+		"0:20250101/ 0->2 (100)",
+		"0:20250102/ 1->2 (100)",
+	}, []uint64{200, 200, 200})
+
+	// The unit isn't moved to the node, which already contains data for the unit key
+	f([]uint64{300, 300, 0}, []unit{
+		newUnit(0, "20250101", "", 0, 150),
+		newUnit(0, "20250102", "", 0, 150),
+		newUnit(0, "20250101", "", 1, 150),
+		newUnit(0, "20250102", "", 1, 150),
+	}, 0, []string{
+		"0:20250101/ 0->2 (150)",
+	}, []uint64{150, 300, 150})
+
+	// Move streams to the newly added nodes
+	f([]uint64{600, 0, 0}, []unit{
+		newUnit(0, "20250101", "a", 0, 100),
+		newUnit(0, "20250101", "b", 0, 100),
+		newUnit(0, "20250101", "c", 0, 100),
+		newUnit(1, "20250101", "a", 0, 100),
+		newUnit(1, "20250101", "b", 0, 100),
+		newUnit(1, "20250101", "c", 0, 100),
+	}, 0, []string{
+		"0:20250101/a 0->1 (100)",
+		"0:20250101/b 0->2 (100)",
+		"0:20250101/c 0->1 (100)",
+		"1:20250101/a 0->2 (100)",
+	}, []uint64{200, 200, 200})
+
+	// Tolerance prevents small moves
+	f([]uint64{105, 95}, []unit{
+		newUnit(0, "20250101", "a", 0, 5),
+		newUnit(0, "20250101", "b", 0, 100),
+		newUnit(0, "20250101", "c", 1, 95),
+	}, 0.1, []string{}, []uint64{105, 95})
+	f([]uint64{105, 95}, []unit{
+		newUnit(0, "20250101", "a", 0, 5),
+		newUnit(0, "20250101", "b", 0, 100),
+		newUnit(0, "20250101", "c", 1, 95),
+	}, 0, []string{
+		"0:20250101/a 0->1 (5)",
+	}, []uint64{100, 100})
+
+	// The unit isn't moved if it makes the destination more loaded than the source
+	f([]uint64{200, 0}, []unit{
+		newUnit(0, "20250101", "a", 0, 200),
+	}, 0, []string{}, []uint64{200, 0})
+}
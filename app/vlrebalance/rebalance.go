@@ -0,0 +1,649 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/ratelimiter"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+// Move statuses stored in the state file.
+const (
+	// statusPending is the status of the move, which isn't started yet.
+	statusPending = "pending"
+
+	// statusCopying is the status of the move, which is copying the data from src to dst.
+	//
+	// The dst may contain partially copied data for the move if the rebalancing has been interrupted.
+	// This data is deleted before the copying is started again.
+	statusCopying = "copying"
+
+	// statusCopied is the status of the move, which has copied and verified the data at dst,
+	// but didn't delete the data at src yet.
+	statusCopied = "copied"
+
+	// statusDone is the status of the finished move.
+	statusDone = "done"
+
+	// statusSkipped is the status of the move, which has been skipped because dst already contains the data for the move.
+	statusSkipped = "skipped"
+)
+
+// move is the move of the data for the given tenant, day and stream from Src to Dst storage node.
+type move struct {
+	AccountID uint32 `json:"accountID"`
+	ProjectID uint32 `json:"projectID"`
+
+	// Day is the per-day partition name in the form YYYYMMDD.
+	Day string `json:"day"`
+
+	// StreamID is the _stream_id of the moved stream. The whole partition for the tenant is moved if it is empty.
+	StreamID string `json:"streamID,omitempty"`
+
+	Src string `json:"src"`
+	Dst string `json:"dst"`
+
+	// Rows is the number of rows at Src at the time the move has been planned.
+	Rows uint64 `json:"rows"`
+
+	// SrcRows is the number of rows at Src at the time the copying has been started.
+	SrcRows uint64 `json:"srcRows,omitempty"`
+
+	// DstBaselineRows is the number of rows at Dst before the copying has been started.
+	//
+	// Dst may already contain rows for the move, for example, if logs for the stream were re-routed to Dst while Src was unavailable.
+	DstBaselineRows uint64 `json:"dstBaselineRows,omitempty"`
+
+	Status string `json:"status"`
+}
+
+func (m *move) tenantID() logstorage.TenantID {
+	return logstorage.TenantID{
+		AccountID: m.AccountID,
+		ProjectID: m.ProjectID,
+	}
+}
+
+// filter returns LogsQL filter for selecting logs for m.
+func (m *move) filter() (string, error) {
+	filter, err := getDayFilter(m.Day)
+	if err != nil {
+		return "", err
+	}
+	if m.StreamID != "" {
+		filter += " _stream_id:" + m.StreamID
+	}
+	return filter, nil
+}
+
+func (m *move) String() string {
+	tenantID := m.tenantID()
+	s := fmt.Sprintf("tenant=%s, day=%s", tenantID.String(), m.Day)
+	if m.StreamID != "" {
+		s += ", _stream_id=" + m.StreamID
+	}
+	return fmt.Sprintf("%s from %q to %q (%d rows)", s, m.Src, m.Dst, m.Rows)
+}
+
+func (m *move) isFinished() bool {
+	return m.Status == statusDone || m.Status == statusSkipped
+}
+
+// isRecentDay returns true if the per-day partition with the given name in the form YYYYMMDD ends later than now-minAge.
+//
+// Such partitions may still receive new logs, so they mustn't be rebalanced.
+func isRecentDay(day string, now time.Time, minAge time.Duration) (bool, error) {
+	t, err := time.Parse("20060102", day)
+	if err != nil {
+		return false, fmt.Errorf("cannot parse partition name %q: %w", day, err)
+	}
+	return t.Add(24 * time.Hour).After(now.Add(-minAge)), nil
+}
+
+// getDayFilter returns _time filter for the given per-day partition name in the form YYYYMMDD.
+func getDayFilter(day string) (string, error) {
+	t, err := time.Parse("20060102", day)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse partition name %q: %w", day, err)
+	}
+	start := t.Format(time.RFC3339)
+	end := t.Add(24 * time.Hour).Format(time.RFC3339)
+	return fmt.Sprintf("_time:[%s, %s)", start, end), nil
+}
+
+// rebalanceState is the rebalancing state persisted at -stateFile.
+type rebalanceState struct {
+	Moves []*move `json:"moves"`
+}
+
+func (rs *rebalanceState) unfinishedMoves() int {
+	n := 0
+	for _, m := range rs.Moves {
+		if !m.isFinished() {
+			n++
+		}
+	}
+	return n
+}
+
+// readState reads rebalancing state from the given path.
+//
+// It returns nil state if the file at path doesn't exist.
+func readState(path string) (*rebalanceState, error) {
+	if !fs.IsPathExist(path) {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rs rebalanceState
+	if err := json.Unmarshal(data, &rs); err != nil {
+		return nil, fmt.Errorf("cannot parse rebalancing state at %q: %w", path, err)
+	}
+	return &rs, nil
+}
+
+// rebalancer executes moves between storage nodes.
+type rebalancer struct {
+	nodes map[string]*storageNode
+
+	statePath string
+
+	// stateLock protects state from concurrent access.
+	stateLock sync.Mutex
+	state     *rebalanceState
+
+	rl *ratelimiter.RateLimiter
+
+	// minDataAge is the minimum age of the end of the day for moving logs for this day.
+	minDataAge time.Duration
+
+	movesDone  atomic.Uint64
+	rowsCopied atomic.Uint64
+	bytesSent  atomic.Uint64
+}
+
+// mustSaveState atomically writes rb.state to rb.statePath.
+func (rb *rebalancer) mustSaveState() {
+	rb.stateLock.Lock()
+	defer rb.stateLock.Unlock()
+
+	data, err := json.MarshalIndent(rb.state, "", "  ")
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal rebalancing state: %s", err)
+	}
+	fs.MustWriteAtomic(rb.statePath, data, true)
+}
+
+func (rb *rebalancer) setStatus(m *move, status string) {
+	rb.stateLock.Lock()
+	m.Status = status
+	rb.stateLock.Unlock()
+
+	rb.mustSaveState()
+}
+
+// run executes unfinished moves from rb.state with the given concurrency.
+//
+// It returns the number of failed moves.
+func (rb *rebalancer) run(ctx context.Context, concurrency int, progressInterval time.Duration) int {
+	var moves []*move
+	rowsTotal := uint64(0)
+	for _, m := range rb.state.Moves {
+		if !m.isFinished() {
+			moves = append(moves, m)
+			rowsTotal += m.Rows
+		}
+	}
+
+	startTime := time.Now()
+	stopCh := make(chan struct{})
+	var progressWG sync.WaitGroup
+	progressWG.Add(1)
+	go func() {
+		defer progressWG.Done()
+
+		t := time.NewTicker(progressInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-t.C:
+				rb.logProgress(startTime, len(moves), rowsTotal)
+			}
+		}
+	}()
+
+	workCh := make(chan *move)
+	var failedMoves atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for m := range workCh {
+				if err := rb.runMove(ctx, m); err != nil {
+					if ctx.Err() == nil {
+						logger.Errorf("cannot move %s: %s", m, err)
+					}
+					failedMoves.Add(1)
+					continue
+				}
+				rb.movesDone.Add(1)
+			}
+		}()
+	}
+
+	for _, m := range moves {
+		if ctx.Err() != nil {
+			failedMoves.Add(1)
+			continue
+		}
+		workCh <- m
+	}
+	close(workCh)
+	wg.Wait()
+
+	close(stopCh)
+	progressWG.Wait()
+
+	rb.logProgress(startTime, len(moves), rowsTotal)
+
+	return int(failedMoves.Load())
+}
+
+func (rb *rebalancer) logProgress(startTime time.Time, movesTotal int, rowsTotal uint64) {
+	elapsed := time.Since(startTime).Seconds()
+	bytesSent := rb.bytesSent.Load()
+	logger.Infof("progress: %d out of %d moves finished; copied %d out of %d rows; sent %d bytes in %.3f seconds (%.0f bytes/sec)",
+		rb.movesDone.Load(), movesTotal, rb.rowsCopied.Load(), rowsTotal, bytesSent, elapsed, float64(bytesSent)/elapsed)
+}
+
+// runMove executes m.
+//
+// The move can be safely resumed after the interruption at any step, since the number of rows at dst before the copying is stored in the state,
+// while the data at src is deleted only after the copied data is verified at dst and the number of rows at src is verified to be unchanged.
+func (rb *rebalancer) runMove(ctx context.Context, m *move) error {
+	src := rb.nodes[m.Src]
+	dst := rb.nodes[m.Dst]
+	tenantID := m.tenantID()
+	filter, err := m.filter()
+	if err != nil {
+		return err
+	}
+	isRecent, err := isRecentDay(m.Day, time.Now(), rb.minDataAge)
+	if err != nil {
+		return err
+	}
+	if isRecent {
+		return fmt.Errorf("the day %s may still receive new logs, since it is newer than -minDataAge=%s; the move will be retried on the next run", m.Day, rb.minDataAge)
+	}
+
+	switch m.Status {
+	case statusPending, statusCopying, "":
+		srcRows, err := src.countRows(ctx, tenantID, filter)
+		if err != nil {
+			return err
+		}
+		if srcRows == 0 {
+			if m.Status == statusCopying {
+				return fmt.Errorf("%q contains no rows for the interrupted move; refusing to delete the copied data at %q", m.Src, m.Dst)
+			}
+			logger.Warnf("skipping the move of %s, since the source contains no rows for it", m)
+			rb.setStatus(m, statusSkipped)
+			return nil
+		}
+
+		if err := dst.forceFlush(ctx); err != nil {
+			return err
+		}
+		dstRows, err := dst.countRows(ctx, tenantID, filter)
+		if err != nil {
+			return err
+		}
+		if m.Status == statusCopying && dstRows != m.DstBaselineRows {
+			// The previous copying has been interrupted.
+			if m.DstBaselineRows > 0 {
+				return fmt.Errorf("%q contains %d rows after the interrupted copying, while it contained %d rows before the copying; "+
+					"partially copied rows cannot be deleted without deleting the rows, which existed at the destination before the copying; "+
+					"delete the rows for the move at %q manually or restore them from %q, and then mark the move as pending in -stateFile",
+					m.Dst, dstRows, m.DstBaselineRows, m.Dst, m.Src)
+			}
+
+			// Delete the partially copied data at dst.
+			logger.Infof("deleting partially copied data for %s", m)
+			if err := dst.deleteRows(ctx, tenantID, filter); err != nil {
+				return err
+			}
+			dstRows, err = dst.countRows(ctx, tenantID, filter)
+			if err != nil {
+				return err
+			}
+			if dstRows > 0 {
+				return fmt.Errorf("%q still contains %d rows after deleting partially copied data", m.Dst, dstRows)
+			}
+		}
+
+		rb.stateLock.Lock()
+		m.SrcRows = srcRows
+		m.DstBaselineRows = dstRows
+		rb.stateLock.Unlock()
+		rb.setStatus(m, statusCopying)
+
+		rowsCopied, err := rb.copyRows(ctx, src, dst, tenantID, filter)
+		if err != nil {
+			return err
+		}
+		if rowsCopied != srcRows {
+			return fmt.Errorf("unexpected number of rows copied from %q: %d; want %d", m.Src, rowsCopied, srcRows)
+		}
+
+		if err := rb.verifyCopiedRows(ctx, m, dst, tenantID, filter); err != nil {
+			return fmt.Errorf("%w; the move will be retried on the next run", err)
+		}
+		rb.setStatus(m, statusCopied)
+		fallthrough
+	case statusCopied:
+		// Verify the data at src and dst right before deleting the data at src,
+		// since the move could be resumed after a long time since the copying.
+		srcRows, err := src.countRows(ctx, tenantID, filter)
+		if err != nil {
+			return err
+		}
+		if srcRows != m.SrcRows {
+			return fmt.Errorf("unexpected number of rows at %q before deleting the copied rows: %d; want %d; refusing to delete the rows at %q",
+				m.Src, srcRows, m.SrcRows, m.Src)
+		}
+		if err := rb.verifyCopiedRows(ctx, m, dst, tenantID, filter); err != nil {
+			return fmt.Errorf("%w; refusing to delete the rows at %q", err, m.Src)
+		}
+
+		if err := src.deleteRows(ctx, tenantID, filter); err != nil {
+			return err
+		}
+		rb.setStatus(m, statusDone)
+		logger.Infof("moved %s", m)
+		return nil
+	default:
+		return fmt.Errorf("unexpected status=%q", m.Status)
+	}
+}
+
+// verifyCopiedRows verifies that dst contains m.DstBaselineRows+m.SrcRows rows for m.
+func (rb *rebalancer) verifyCopiedRows(ctx context.Context, m *move, dst *storageNode, tenantID logstorage.TenantID, filter string) error {
+	if err := dst.forceFlush(ctx); err != nil {
+		return err
+	}
+	dstRows, err := dst.countRows(ctx, tenantID, filter)
+	if err != nil {
+		return err
+	}
+	if dstRows != m.DstBaselineRows+m.SrcRows {
+		return fmt.Errorf("unexpected number of rows at %q after the copying: %d; want %d (%d rows before the copying plus %d copied rows)",
+			m.Dst, dstRows, m.DstBaselineRows+m.SrcRows, m.DstBaselineRows, m.SrcRows)
+	}
+	return nil
+}
+
+// copyRows copies rows matching the given filter for the given tenantID from src to dst.
+//
+// It returns the number of copied rows.
+func (rb *rebalancer) copyRows(ctx context.Context, src, dst *storageNode, tenantID logstorage.TenantID, filter string) (uint64, error) {
+	ctxWithCancel, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	bc := &blockConverter{
+		tenantID: tenantID,
+	}
+
+	var errGlobal error
+	var rowsCopied uint64
+	var bcLock sync.Mutex
+	flush := func() {
+		rb.rl.Register(len(bc.buf))
+		if err := dst.sendInsertBlock(ctxWithCancel, bc.buf); err != nil {
+			errGlobal = err
+			cancel()
+			return
+		}
+		rb.bytesSent.Add(uint64(len(bc.buf)))
+		rb.rowsCopied.Add(uint64(bc.rows))
+		rowsCopied += uint64(bc.rows)
+		bc.reset()
+	}
+
+	writeBlock := func(_ uint, db *logstorage.DataBlock) {
+		bcLock.Lock()
+		defer bcLock.Unlock()
+
+		if errGlobal != nil {
+			return
+		}
+		if err := bc.addBlock(db); err != nil {
+			errGlobal = err
+			cancel()
+			return
+		}
+		if len(bc.buf) >= maxInsertBlockSize {
+			flush()
+		}
+	}
+
+	err := src.readRows(ctxWithCancel, tenantID, filter, writeBlock)
+	if errGlobal != nil {
+		return 0, errGlobal
+	}
+	if err != nil {
+		return 0, err
+	}
+	flush()
+	if errGlobal != nil {
+		return 0, errGlobal
+	}
+	return rowsCopied, nil
+}
+
+// blockConverter converts data blocks returned from /internal/select/query into marshaled logstorage.InsertRow entries
+// accepted by /internal/insert.
+type blockConverter struct {
+	tenantID logstorage.TenantID
+
+	// buf contains marshaled logstorage.InsertRow entries.
+	buf []byte
+
+	// rows is the number of rows at buf.
+	rows int
+
+	r logstorage.InsertRow
+
+	// streamFields is a buffer for parsed _stream fields.
+	streamFields []logstorage.Field
+
+	// stream and streamTagsCanonical contain the last converted _stream and its canonical representation.
+	stream              string
+	streamTagsCanonical string
+}
+
+func (bc *blockConverter) reset() {
+	bc.buf = bc.buf[:0]
+	bc.rows = 0
+}
+
+// addBlock appends rows from db to bc.buf.
+func (bc *blockConverter) addBlock(db *logstorage.DataBlock) error {
+	r := &bc.r
+	rowsCount := db.RowsCount()
+	for i := 0; i < rowsCount; i++ {
+		r.Reset()
+		r.TenantID = bc.tenantID
+
+		hasTime := false
+		hasStream := false
+		for _, c := range db.Columns {
+			v := c.Values[i]
+			switch c.Name {
+			case "_time":
+				timestamp, ok := logstorage.TryParseTimestampRFC3339Nano(v)
+				if !ok {
+					return fmt.Errorf("cannot parse _time=%q", v)
+				}
+				r.Timestamp = timestamp
+				hasTime = true
+			case "_stream":
+				streamTagsCanonical, err := bc.getStreamTagsCanonical(v)
+				if err != nil {
+					return err
+				}
+				r.StreamTagsCanonical = streamTagsCanonical
+				hasStream = true
+			case "_stream_id":
+				// Skip _stream_id, since it is generated from the tenant and _stream during data ingestion.
+			default:
+				if v != "" {
+					r.Fields = append(r.Fields, logstorage.Field{
+						Name:  c.Name,
+						Value: v,
+					})
+				}
+			}
+		}
+		if !hasTime || !hasStream {
+			return fmt.Errorf("missing _time or _stream field in the log entry")
+		}
+
+		bc.buf = r.Marshal(bc.buf)
+		bc.rows++
+	}
+	return nil
+}
+
+func (bc *blockConverter) getStreamTagsCanonical(stream string) (string, error) {
+	if stream == bc.stream && bc.streamTagsCanonical != "" {
+		return bc.streamTagsCanonical, nil
+	}
+
+	fields, err := logstorage.ParseStreamFields(bc.streamFields[:0], stream)
+	bc.streamFields = fields
+	if err != nil {
+		return "", fmt.Errorf("cannot parse _stream=%q: %w", stream, err)
+	}
+
+	st := logstorage.GetStreamTags()
+	for _, f := range fields {
+		st.Add(f.Name, f.Value)
+	}
+	bc.streamTagsCanonical = string(st.MarshalCanonical(nil))
+	logstorage.PutStreamTags(st)
+
+	bc.stream = strings.Clone(stream)
+	return bc.streamTagsCanonical, nil
+}
+
+// newRebalanceState returns rebalancing state with moves, which make the number of rows at nodes more even.
+//
+// Only partitions with names starting with partitionNamePrefix, which end earlier than minDataAge ago, are taken into account.
+// If moveStreams is set, then per-day log streams are moved. Otherwise the whole per-day partitions for tenants are moved.
+func newRebalanceState(ctx context.Context, addrs []string, nodes map[string]*storageNode, partitionNamePrefix string, moveStreams bool, tolerance float64,
+	minDataAge time.Duration) (*rebalanceState, error) {
+
+	now := time.Now()
+
+	loads := make([]uint64, len(addrs))
+	var units []unit
+	for i, addr := range addrs {
+		sn := nodes[addr]
+		tus, err := sn.getTenantsUsage(ctx, partitionNamePrefix)
+		if err != nil {
+			return nil, fmt.Errorf("cannot obtain tenants usage from %q: %w", addr, err)
+		}
+		for _, tu := range tus {
+			tenantID := logstorage.TenantID{
+				AccountID: tu.AccountID,
+				ProjectID: tu.ProjectID,
+			}
+			for _, pu := range tu.Partitions {
+				if pu.StoredRows == 0 {
+					continue
+				}
+				isRecent, err := isRecentDay(pu.Name, now, minDataAge)
+				if err != nil {
+					return nil, err
+				}
+				if isRecent {
+					// Skip the partitions, which may still receive new logs.
+					continue
+				}
+
+				// Obtain the number of rows per stream instead of using pu.StoredRows,
+				// since the latter may include the deleted rows, which aren't removed by background merges yet.
+				filter, err := getDayFilter(pu.Name)
+				if err != nil {
+					return nil, err
+				}
+				vhs, err := sn.getStreamIDs(ctx, tenantID, filter)
+				if err != nil {
+					return nil, fmt.Errorf("cannot obtain streams for tenant=%s, day=%s from %q: %w", tenantID.String(), pu.Name, addr, err)
+				}
+
+				partitionUnit := unit{
+					key: unitKey{
+						tenantID: tenantID,
+						day:      pu.Name,
+					},
+					src: i,
+				}
+				for _, vh := range vhs {
+					loads[i] += vh.Hits
+					partitionUnit.rows += vh.Hits
+					if moveStreams {
+						streamUnit := partitionUnit
+						streamUnit.key.streamID = vh.Value
+						streamUnit.rows = vh.Hits
+						units = append(units, streamUnit)
+					}
+				}
+				if !moveStreams && partitionUnit.rows > 0 {
+					units = append(units, partitionUnit)
+				}
+			}
+		}
+	}
+
+	for i, addr := range addrs {
+		logger.Infof("%q contains %d rows", addr, loads[i])
+	}
+
+	pms := planMoves(loads, units, tolerance)
+
+	rs := &rebalanceState{}
+	for _, pm := range pms {
+		rs.Moves = append(rs.Moves, &move{
+			AccountID: pm.key.tenantID.AccountID,
+			ProjectID: pm.key.tenantID.ProjectID,
+			Day:       pm.key.day,
+			StreamID:  pm.key.streamID,
+			Src:       addrs[pm.src],
+			Dst:       addrs[pm.dst],
+			Rows:      pm.rows,
+			Status:    statusPending,
+		})
+	}
+
+	for i, addr := range addrs {
+		logger.Infof("%q will contain %d rows after the rebalancing", addr, loads[i])
+	}
+
+	return rs, nil
+}
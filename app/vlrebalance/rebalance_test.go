@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsRecentDay(t *testing.T) {
+	now := time.Date(2025, 1, 10, 10, 0, 0, 0, time.UTC)
+
+	f := func(day string, minAge time.Duration, resultExpected bool) {
+		t.Helper()
+
+		result, err := isRecentDay(day, now, minAge)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if result != resultExpected {
+			t.Fatalf("unexpected result for day=%s, minAge=%s; got %v; want %v", day, minAge, result, resultExpected)
+		}
+	}
+
+	// zero minAge
+	f("20250110", 0, true)
+	f("20250109", 0, false)
+	f("20250111", 0, true)
+
+	// non-zero minAge
+	f("20250109", time.Hour, false)
+	f("20250109", 11*time.Hour, true)
+	f("20250108", 24*time.Hour, false)
+	f("20250109", 24*time.Hour, true)
+
+	// invalid day
+	if _, err := isRecentDay("2025-01-09", now, 0); err == nil {
+		t.Fatalf("expecting non-nil error for invalid day")
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding/zstd"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlstorage/netinsert"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlstorage/netselect"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+// the maximum size of a single data block sent to /internal/insert at storage node.
+const maxInsertBlockSize = 2 * 1024 * 1024
+
+// storageNode is a client for vlstorage node at addr.
+type storageNode struct {
+	// scheme is http or https scheme to communicate with addr
+	scheme string
+
+	// addr is TCP address of the storage node
+	addr string
+
+	// s is used for querying and deleting logs at the storage node via /internal/select/* endpoints.
+	s *netselect.Storage
+
+	// c is an http client used for sending requests to /internal/insert and /internal/force_flush endpoints.
+	c *http.Client
+
+	// ac is auth config used for setting request headers such as Authorization and Host.
+	ac *promauth.Config
+}
+
+func newStorageNode(addr string, ac *promauth.Config, isTLS bool) *storageNode {
+	tr := httputil.NewTransport(false, "vlrebalance_backend")
+	tr.TLSHandshakeTimeout = 20 * time.Second
+	tr.DisableCompression = true
+
+	scheme := "http"
+	if isTLS {
+		scheme = "https"
+	}
+
+	return &storageNode{
+		scheme: scheme,
+		addr:   addr,
+		s:      netselect.NewStorage([]string{addr}, []*promauth.Config{ac}, []bool{isTLS}, *disableCompression, 1),
+		c: &http.Client{
+			Transport: ac.NewRoundTripper(tr),
+		},
+		ac: ac,
+	}
+}
+
+// getTenantsUsage returns per-tenant usage stats for partitions with names starting with partitionNamePrefix at sn.
+func (sn *storageNode) getTenantsUsage(ctx context.Context, partitionNamePrefix string) ([]*logstorage.TenantUsage, error) {
+	return sn.s.GetTenantsUsage(ctx, partitionNamePrefix)
+}
+
+// getStreamIDs returns _stream_id values with the number of rows for logs matching the given filter for the given tenantID at sn.
+func (sn *storageNode) getStreamIDs(ctx context.Context, tenantID logstorage.TenantID, filter string) ([]logstorage.ValueWithHits, error) {
+	qctx, err := newQueryContext(ctx, tenantID, filter)
+	if err != nil {
+		return nil, err
+	}
+	return sn.s.GetStreamIDs(qctx, 0)
+}
+
+// countRows returns the number of rows matching the given filter for the given tenantID at sn.
+func (sn *storageNode) countRows(ctx context.Context, tenantID logstorage.TenantID, filter string) (uint64, error) {
+	qctx, err := newQueryContext(ctx, tenantID, filter+" | stats count() rows")
+	if err != nil {
+		return 0, err
+	}
+
+	var rowsLock sync.Mutex
+	rows := uint64(0)
+	var errParse error
+	writeBlock := func(_ uint, db *logstorage.DataBlock) {
+		rowsLock.Lock()
+		defer rowsLock.Unlock()
+
+		c := db.GetColumnByName("rows")
+		if c == nil {
+			return
+		}
+		for _, v := range c.Values {
+			n, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				errParse = fmt.Errorf("cannot parse the number of rows %q: %w", v, err)
+				continue
+			}
+			rows += n
+		}
+	}
+	if err := sn.s.RunQuery(qctx, writeBlock); err != nil {
+		return 0, fmt.Errorf("cannot count rows matching [%s] at %q: %w", filter, sn.addr, err)
+	}
+	if errParse != nil {
+		return 0, errParse
+	}
+	return rows, nil
+}
+
+// readRows calls writeBlock for data blocks with all the logs matching the given filter for the given tenantID at sn.
+func (sn *storageNode) readRows(ctx context.Context, tenantID logstorage.TenantID, filter string, writeBlock logstorage.WriteDataBlockFunc) error {
+	qctx, err := newQueryContext(ctx, tenantID, filter)
+	if err != nil {
+		return err
+	}
+	if err := sn.s.RunQuery(qctx, writeBlock); err != nil {
+		return fmt.Errorf("cannot read rows matching [%s] from %q: %w", filter, sn.addr, err)
+	}
+	return nil
+}
+
+// deleteRows deletes logs matching the given filter for the given tenantID at sn.
+func (sn *storageNode) deleteRows(ctx context.Context, tenantID logstorage.TenantID, filter string) error {
+	qctx, err := newQueryContext(ctx, tenantID, filter)
+	if err != nil {
+		return err
+	}
+	if err := sn.s.DeleteRows(qctx); err != nil {
+		return fmt.Errorf("cannot delete rows matching [%s] at %q: %w", filter, sn.addr, err)
+	}
+	return nil
+}
+
+// sendInsertBlock sends data with marshaled logstorage.InsertRow entries to /internal/insert at sn.
+func (sn *storageNode) sendInsertBlock(ctx context.Context, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	if !*disableCompression {
+		data = zstd.CompressLevel(nil, data, 1)
+	}
+
+	args := url.Values{}
+	args.Set("version", netinsert.ProtocolVersion)
+	reqURL := sn.getRequestURL("/internal/insert", args)
+	req, err := http.NewRequestWithContext(ctx, "POST", reqURL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("cannot create request to %q: %w", reqURL, err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if !*disableCompression {
+		req.Header.Set("Content-Encoding", "zstd")
+	}
+	return sn.doRequest(req)
+}
+
+// forceFlush makes the recently ingested logs at sn available for querying.
+func (sn *storageNode) forceFlush(ctx context.Context) error {
+	args := url.Values{}
+	if authKey := forceFlushAuthKey.Get(); authKey != "" {
+		args.Set("authKey", authKey)
+	}
+	reqURL := sn.getRequestURL("/internal/force_flush", args)
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return fmt.Errorf("cannot create request to %q: %w", reqURL, err)
+	}
+	return sn.doRequest(req)
+}
+
+func (sn *storageNode) doRequest(req *http.Request) error {
+	reqURL := req.URL.Redacted()
+	if err := sn.ac.SetHeaders(req, true); err != nil {
+		return fmt.Errorf("cannot set auth headers for %q: %w", reqURL, err)
+	}
+
+	resp, err := sn.c.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot send request to %q: %w", reqURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			respBody = []byte(err.Error())
+		}
+		return fmt.Errorf("unexpected status code returned from %q: %d; want 2xx; response body: %q", reqURL, resp.StatusCode, respBody)
+	}
+	return nil
+}
+
+func (sn *storageNode) getRequestURL(path string, args url.Values) string {
+	reqURL := fmt.Sprintf("%s://%s%s", sn.scheme, sn.addr, path)
+	if len(args) > 0 {
+		reqURL += "?" + args.Encode()
+	}
+	return reqURL
+}
+
+func newQueryContext(ctx context.Context, tenantID logstorage.TenantID, qStr string) (*logstorage.QueryContext, error) {
+	q, err := logstorage.ParseQueryAtTimestamp(qStr, time.Now().UnixNano())
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse query [%s]: %w", qStr, err)
+	}
+	tenantIDs := []logstorage.TenantID{tenantID}
+	return logstorage.NewQueryContext(ctx, &logstorage.QueryStats{}, tenantIDs, q), nil
+}
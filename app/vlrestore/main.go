@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/buildinfo"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/envflag"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/backup"
+)
+
+var (
+	src             = flag.String("src", "", "Backup to restore, which was created by vlbackup. Supported formats: fs:///path/to/backup, s3://bucket/path/to/backup")
+	storageDataPath = flag.String("storageDataPath", "victoria-logs-data", "Path to VictoriaLogs data directory to restore the partition to. "+
+		"VictoriaLogs must be stopped during the restore or the restored partition must be detached via /internal/partition/detach endpoint. "+
+		"The files, which already exist at -storageDataPath with the same contents, aren't downloaded")
+	storageDataPathCold = flag.String("storageDataPath.cold", "", "Path to the directory for cold partitions if VictoriaLogs runs with -storageDataPath.cold. "+
+		"The partition is restored to -storageDataPath.cold if it already exists there, since VictoriaLogs prefers partitions at -storageDataPath.cold "+
+		"over partitions with the same name at -storageDataPath. See https://docs.victoriametrics.com/victorialogs/#tiered-storage")
+	concurrency = flag.Int("concurrency", 10, "The number of concurrent workers for downloading files from -src")
+)
+
+func main() {
+	// Write flags and help message to stdout, since it is easier to grep or pipe.
+	flag.CommandLine.SetOutput(os.Stdout)
+	envflag.Parse()
+	buildinfo.Init()
+	logger.Init()
+
+	if *src == "" {
+		logger.Fatalf("missing -src command-line flag")
+	}
+	rfs, err := backup.NewRemoteFS(*src)
+	if err != nil {
+		logger.Fatalf("cannot parse -src=%q: %s", *src, err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	if err := backup.Restore(ctx, rfs, *storageDataPath, *storageDataPathCold, *concurrency); err != nil {
+		logger.Fatalf("cannot restore from %s to -storageDataPath=%q: %s", rfs, *storageDataPath, err)
+	}
+}
@@ -0,0 +1,343 @@
+package vlrules
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+// alertState is the state of the alert.
+type alertState int
+
+const (
+	// alertStatePending is the state of the active alert, which is active for less than `for` duration.
+	alertStatePending alertState = iota
+
+	// alertStateFiring is the state of the active alert, which is active for at least `for` duration.
+	alertStateFiring
+
+	// alertStateResolved is the state of the firing alert, which is no longer active.
+	alertStateResolved
+)
+
+func (s alertState) String() string {
+	switch s {
+	case alertStatePending:
+		return "pending"
+	case alertStateFiring:
+		return "firing"
+	case alertStateResolved:
+		return "inactive"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(s))
+	}
+}
+
+// alert is a single alert generated by the alerting rule for a single row returned by the rule query.
+type alert struct {
+	// labels contains sorted labels for the alert including alertname label.
+	labels []prompb.Label
+
+	// annotations contains annotations for the alert after applying templates.
+	annotations map[string]string
+
+	// value is the first numeric result of the query for the alert.
+	value float64
+
+	// state is the current state of the alert.
+	state alertState
+
+	// activeAt is the time when the alert became active.
+	activeAt time.Time
+
+	// firedAt is the time when the alert became firing.
+	firedAt time.Time
+
+	// resolvedAt is the time when the alert became resolved.
+	resolvedAt time.Time
+}
+
+// alertingRule is a rule, which generates alerts for rows returned by LogsQL query with `stats` pipe.
+type alertingRule struct {
+	// name is the name of the alert. It is exposed in alertname label.
+	name string
+
+	// expr is LogsQL query to evaluate.
+	expr string
+
+	// forDuration is the duration the alert must be active before it becomes firing.
+	forDuration time.Duration
+
+	// labels are added to the generated alerts.
+	labels map[string]string
+
+	// annotations contains templates for alert annotations.
+	annotations map[string]*template.Template
+
+	// mu protects alerts.
+	mu sync.Mutex
+
+	// alerts contains active alerts keyed by their labels.
+	alerts map[string]*alert
+}
+
+// annotationTemplateData is passed to annotation templates.
+type annotationTemplateData struct {
+	Labels map[string]string
+	Value  float64
+}
+
+// annotationTemplatePrefix defines $labels and $value variables for annotation templates.
+const annotationTemplatePrefix = "{{ $labels := .Labels }}{{ $value := .Value }}"
+
+func parseAnnotationTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=zero").Parse(annotationTemplatePrefix + text)
+}
+
+// eval evaluates ar for logs on the time range (ts-g.interval ... ts] and returns alerts, which must be sent to -rule.notifier.url.
+func (ar *alertingRule) eval(ctx context.Context, g *group, ts time.Time) ([]*alert, error) {
+	evaluationsTotal := metrics.GetOrCreateCounter(fmt.Sprintf(`vl_rule_evaluations_total{group=%q,rule=%q}`, g.name, ar.name))
+	evaluationErrors := metrics.GetOrCreateCounter(fmt.Sprintf(`vl_rule_evaluation_errors_total{group=%q,rule=%q}`, g.name, ar.name))
+
+	evaluationsTotal.Inc()
+	alerts, err := ar.evalInternal(ctx, g, ts)
+	if err != nil {
+		evaluationErrors.Inc()
+		return nil, err
+	}
+	return alerts, nil
+}
+
+func (ar *alertingRule) evalInternal(ctx context.Context, g *group, ts time.Time) ([]*alert, error) {
+	var asLock sync.Mutex
+	var as []*alert
+	var errGlobal error
+	err := runStatsQuery(ctx, g, ar.expr, ts, func(columns []logstorage.BlockColumn, rowsCount int, byFields []string) {
+		asLocal, err := ar.getAlertsFromBlock(columns, rowsCount, byFields)
+
+		asLock.Lock()
+		as = append(as, asLocal...)
+		if err != nil && errGlobal == nil {
+			errGlobal = err
+		}
+		asLock.Unlock()
+	})
+	if err != nil {
+		return nil, err
+	}
+	if errGlobal != nil {
+		return nil, errGlobal
+	}
+
+	return ar.updateAlerts(as, ts), nil
+}
+
+// getAlertsFromBlock converts the rows returned by ar query to alerts.
+//
+// Every row is converted to a separate alert. The columns listed in byFields are converted to alert labels.
+func (ar *alertingRule) getAlertsFromBlock(columns []logstorage.BlockColumn, rowsCount int, byFields []string) ([]*alert, error) {
+	var as []*alert
+	for i := 0; i < rowsCount; i++ {
+		var rowLabels []prompb.Label
+		value := float64(0)
+		hasValue := false
+		for _, c := range columns {
+			if slices.Contains(byFields, c.Name) {
+				rowLabels = append(rowLabels, prompb.Label{
+					Name:  sanitizeLabelName(c.Name),
+					Value: strings.Clone(c.Values[i]),
+				})
+				continue
+			}
+			if hasValue {
+				continue
+			}
+			v, err := strconv.ParseFloat(c.Values[i], 64)
+			if err == nil {
+				value = v
+				hasValue = true
+			}
+		}
+
+		labels := ar.newLabels(rowLabels)
+		annotations, err := ar.newAnnotations(labels, value)
+		if err != nil {
+			return as, err
+		}
+		as = append(as, &alert{
+			labels:      labels,
+			annotations: annotations,
+			value:       value,
+		})
+	}
+	return as, nil
+}
+
+// newLabels returns sorted labels for the alert with the given rowLabels.
+//
+// The ar.labels override rowLabels with the same names.
+func (ar *alertingRule) newLabels(rowLabels []prompb.Label) []prompb.Label {
+	labels := make([]prompb.Label, 0, len(rowLabels)+len(ar.labels)+1)
+	labels = append(labels, prompb.Label{
+		Name:  "alertname",
+		Value: ar.name,
+	})
+	for _, label := range rowLabels {
+		if _, ok := ar.labels[label.Name]; ok || label.Name == "alertname" || label.Name == "__name__" {
+			continue
+		}
+		labels = append(labels, label)
+	}
+	for k, v := range ar.labels {
+		labels = append(labels, prompb.Label{
+			Name:  k,
+			Value: v,
+		})
+	}
+	slices.SortFunc(labels, func(a, b prompb.Label) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return labels
+}
+
+// newAnnotations applies ar.annotations templates to the alert with the given labels and value.
+func (ar *alertingRule) newAnnotations(labels []prompb.Label, value float64) (map[string]string, error) {
+	if len(ar.annotations) == 0 {
+		return nil, nil
+	}
+
+	data := &annotationTemplateData{
+		Labels: make(map[string]string, len(labels)),
+		Value:  value,
+	}
+	for _, label := range labels {
+		data.Labels[label.Name] = label.Value
+	}
+
+	annotations := make(map[string]string, len(ar.annotations))
+	var bb bytes.Buffer
+	for k, t := range ar.annotations {
+		bb.Reset()
+		if err := t.Execute(&bb, data); err != nil {
+			return nil, fmt.Errorf("cannot execute template for annotation %q: %w", k, err)
+		}
+		annotations[k] = bb.String()
+	}
+	return annotations, nil
+}
+
+// updateAlerts updates the state of ar alerts according to the currently active alerts at the evaluation time ts.
+//
+// It returns firing and resolved alerts, which must be sent to -rule.notifier.url.
+// Resolved alerts are removed from ar after that.
+func (ar *alertingRule) updateAlerts(active []*alert, ts time.Time) []*alert {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	if ar.alerts == nil {
+		ar.alerts = make(map[string]*alert)
+	}
+
+	seen := make(map[string]struct{}, len(active))
+	for _, a := range active {
+		key := prompb.LabelsToString(a.labels)
+		seen[key] = struct{}{}
+
+		prev := ar.alerts[key]
+		if prev == nil {
+			a.state = alertStatePending
+			a.activeAt = ts
+			ar.alerts[key] = a
+			prev = a
+		} else {
+			prev.annotations = a.annotations
+			prev.value = a.value
+		}
+		if prev.state == alertStatePending && ts.Sub(prev.activeAt) >= ar.forDuration {
+			prev.state = alertStateFiring
+			prev.firedAt = ts
+		}
+	}
+
+	var notifications []*alert
+	for key, a := range ar.alerts {
+		if _, ok := seen[key]; !ok {
+			if a.state == alertStatePending {
+				// Pending alerts are removed silently, since they weren't sent to -rule.notifier.url.
+				delete(ar.alerts, key)
+				continue
+			}
+			a.state = alertStateResolved
+			a.resolvedAt = ts
+			delete(ar.alerts, key)
+		}
+		if a.state == alertStatePending {
+			continue
+		}
+		notifications = append(notifications, a.clone())
+	}
+	sortAlerts(notifications)
+	return notifications
+}
+
+// getActiveAlerts returns a copy of active alerts for ar.
+func (ar *alertingRule) getActiveAlerts() []*alert {
+	ar.mu.Lock()
+	as := make([]*alert, 0, len(ar.alerts))
+	for _, a := range ar.alerts {
+		as = append(as, a.clone())
+	}
+	ar.mu.Unlock()
+
+	sortAlerts(as)
+	return as
+}
+
+// getAlertsSeries returns ALERTS series for active alerts in ar.
+//
+// The ALERTS series has the same format as in Prometheus.
+func (ar *alertingRule) getAlertsSeries() []*series {
+	as := ar.getActiveAlerts()
+	ss := make([]*series, 0, len(as))
+	for _, a := range as {
+		labels := make([]prompb.Label, 0, len(a.labels)+2)
+		labels = append(labels, prompb.Label{
+			Name:  "__name__",
+			Value: "ALERTS",
+		}, prompb.Label{
+			Name:  "alertstate",
+			Value: a.state.String(),
+		})
+		labels = append(labels, a.labels...)
+		slices.SortFunc(labels, func(a, b prompb.Label) int {
+			return strings.Compare(a.Name, b.Name)
+		})
+		ss = append(ss, &series{
+			labels: labels,
+			value:  1,
+		})
+	}
+	return ss
+}
+
+func (a *alert) clone() *alert {
+	aCopy := *a
+	return &aCopy
+}
+
+func sortAlerts(as []*alert) {
+	slices.SortFunc(as, func(a, b *alert) int {
+		return strings.Compare(prompb.LabelsToString(a.labels), prompb.LabelsToString(b.labels))
+	})
+}
@@ -0,0 +1,148 @@
+package vlrules
+
+import (
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestAlertingRuleGetAlertsFromBlock(t *testing.T) {
+	tpl, err := parseAnnotationTemplate("summary", "{{ $labels.alertname }} at {{ $labels.host_name }}: {{ $value }}")
+	if err != nil {
+		t.Fatalf("cannot parse template: %s", err)
+	}
+	ar := &alertingRule{
+		name: "TooManyErrors",
+		labels: map[string]string{
+			"severity": "critical",
+		},
+		annotations: map[string]*template.Template{
+			"summary": tpl,
+		},
+	}
+
+	columns := []logstorage.BlockColumn{
+		{
+			Name:   "host.name",
+			Values: []string{"foo", "bar"},
+		},
+		{
+			Name:   "last_msg",
+			Values: []string{"abc", "def"},
+		},
+		{
+			Name:   "errors",
+			Values: []string{"12", "34.5"},
+		},
+	}
+	as, err := ar.getAlertsFromBlock(columns, 2, []string{"host.name"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(as) != 2 {
+		t.Fatalf("unexpected number of alerts; got %d; want 2", len(as))
+	}
+
+	f := func(a *alert, labelsExpected, summaryExpected string, valueExpected float64) {
+		t.Helper()
+
+		labels := prompb.LabelsToString(a.labels)
+		if labels != labelsExpected {
+			t.Fatalf("unexpected labels; got %s; want %s", labels, labelsExpected)
+		}
+		summary := a.annotations["summary"]
+		if summary != summaryExpected {
+			t.Fatalf("unexpected summary; got %q; want %q", summary, summaryExpected)
+		}
+		if a.value != valueExpected {
+			t.Fatalf("unexpected value; got %v; want %v", a.value, valueExpected)
+		}
+	}
+
+	f(as[0], `{alertname="TooManyErrors",host_name="foo",severity="critical"}`, "TooManyErrors at foo: 12", 12)
+	f(as[1], `{alertname="TooManyErrors",host_name="bar",severity="critical"}`, "TooManyErrors at bar: 34.5", 34.5)
+}
+
+func TestAlertingRuleUpdateAlerts(t *testing.T) {
+	ar := &alertingRule{
+		name:        "foo",
+		forDuration: time.Minute,
+	}
+
+	newAlert := func(host string) *alert {
+		return &alert{
+			labels: []prompb.Label{
+				{
+					Name:  "alertname",
+					Value: "foo",
+				},
+				{
+					Name:  "host",
+					Value: host,
+				},
+			},
+		}
+	}
+
+	f := func(active []*alert, ts time.Time, notificationsExpected, activeAlertsExpected string) {
+		t.Helper()
+
+		notifications := ar.updateAlerts(active, ts)
+		result := alertsToString(notifications)
+		if result != notificationsExpected {
+			t.Fatalf("unexpected notifications;\ngot\n%s\nwant\n%s", result, notificationsExpected)
+		}
+
+		result = alertsToString(ar.getActiveAlerts())
+		if result != activeAlertsExpected {
+			t.Fatalf("unexpected active alerts;\ngot\n%s\nwant\n%s", result, activeAlertsExpected)
+		}
+	}
+
+	ts := time.Unix(1000, 0)
+
+	// new alerts are pending
+	f([]*alert{newAlert("a"), newAlert("b")}, ts, ``, `{alertname="foo",host="a"} pending
+{alertname="foo",host="b"} pending
+`)
+
+	// the alert becomes firing after `for` duration; pending alert is removed silently when it becomes inactive
+	ts = ts.Add(time.Minute)
+	f([]*alert{newAlert("a")}, ts, `{alertname="foo",host="a"} firing
+`, `{alertname="foo",host="a"} firing
+`)
+
+	// the firing alert is sent on every evaluation
+	ts = ts.Add(time.Minute)
+	f([]*alert{newAlert("a"), newAlert("c")}, ts, `{alertname="foo",host="a"} firing
+`, `{alertname="foo",host="a"} firing
+{alertname="foo",host="c"} pending
+`)
+
+	// the firing alert is resolved when it becomes inactive
+	ts = ts.Add(time.Minute)
+	f([]*alert{newAlert("c")}, ts, `{alertname="foo",host="a"} inactive
+{alertname="foo",host="c"} firing
+`, `{alertname="foo",host="c"} firing
+`)
+
+	// no active alerts
+	ts = ts.Add(time.Minute)
+	f(nil, ts, `{alertname="foo",host="c"} inactive
+`, ``)
+}
+
+func alertsToString(as []*alert) string {
+	var b []byte
+	for _, a := range as {
+		b = append(b, prompb.LabelsToString(a.labels)...)
+		b = append(b, ' ')
+		b = append(b, a.state.String()...)
+		b = append(b, '\n')
+	}
+	return string(b)
+}
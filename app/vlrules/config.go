@@ -0,0 +1,278 @@
+package vlrules
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+// rulesConfig represents the contents of a file with rules.
+//
+// See https://docs.victoriametrics.com/victorialogs/rules/
+type rulesConfig struct {
+	Groups []*groupConfig `yaml:"groups"`
+}
+
+// groupConfig represents a group of rules, which are evaluated together with the given interval.
+type groupConfig struct {
+	// Name is the name of the group. It must be unique across all the files with rules.
+	Name string `yaml:"name"`
+
+	// Interval is the interval between evaluations of the rules in the group.
+	//
+	// -rule.evaluationInterval is used if it isn't set.
+	Interval time.Duration `yaml:"interval,omitempty"`
+
+	// Tenant is the tenant in the form accountID:projectID to query logs from.
+	Tenant string `yaml:"tenant,omitempty"`
+
+	// Labels are added to all the metrics and alerts generated by rules in the group.
+	Labels map[string]string `yaml:"labels,omitempty"`
+
+	// Rules is the list of rules in the group.
+	Rules []*ruleConfig `yaml:"rules"`
+}
+
+// ruleConfig represents a single rule.
+//
+// Either Record or Alert must be set.
+type ruleConfig struct {
+	// Record is the name of the metric generated by the recording rule.
+	Record string `yaml:"record,omitempty"`
+
+	// Alert is the name of the alert generated by the alerting rule.
+	Alert string `yaml:"alert,omitempty"`
+
+	// Expr is LogsQL query with `stats` pipe to evaluate.
+	Expr string `yaml:"expr"`
+
+	// For is the duration the alert must be active before it becomes firing.
+	//
+	// It is applicable only to alerting rules.
+	For time.Duration `yaml:"for,omitempty"`
+
+	// Labels are added to all the metrics or alerts generated by the rule.
+	Labels map[string]string `yaml:"labels,omitempty"`
+
+	// Annotations are templates for annotations added to alerts generated by the rule.
+	//
+	// It is applicable only to alerting rules.
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// name returns the name of the rule for rc.
+func (rc *ruleConfig) name() string {
+	if rc.Alert != "" {
+		return rc.Alert
+	}
+	return rc.Record
+}
+
+var metricNameRegexp = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+var labelNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// loadGroups loads groups from the files matching the given paths.
+//
+// Every path may contain glob patterns supported by filepath.Glob.
+func loadGroups(paths []string) ([]*group, error) {
+	var groups []*group
+	groupNames := make(map[string]struct{})
+	for _, path := range paths {
+		files, err := filepath.Glob(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", path, err)
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("cannot find files matching %q", path)
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read rules file: %w", err)
+			}
+			gs, err := parseGroups(data)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse rules from %q: %w", file, err)
+			}
+			for _, g := range gs {
+				if _, ok := groupNames[g.name]; ok {
+					return nil, fmt.Errorf("duplicate group name %q in %q", g.name, file)
+				}
+				groupNames[g.name] = struct{}{}
+			}
+			groups = append(groups, gs...)
+		}
+	}
+	return groups, nil
+}
+
+// parseGroups parses groups from the rules config in data.
+func parseGroups(data []byte) ([]*group, error) {
+	var cfg rulesConfig
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, err
+	}
+
+	var groups []*group
+	for _, gc := range cfg.Groups {
+		g, err := newGroup(gc)
+		if err != nil {
+			return nil, fmt.Errorf("cannot initialize group %q: %w", gc.Name, err)
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+func newGroup(gc *groupConfig) (*group, error) {
+	if gc.Name == "" {
+		return nil, fmt.Errorf("missing group name")
+	}
+	if len(gc.Rules) == 0 {
+		return nil, fmt.Errorf("missing rules")
+	}
+
+	interval := gc.Interval
+	if interval == 0 {
+		interval = *evaluationInterval
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("interval must be positive; got %s", interval)
+	}
+
+	tenantID, err := logstorage.ParseTenantID(gc.Tenant)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse tenant: %w", err)
+	}
+
+	if err := checkLabels(gc.Labels); err != nil {
+		return nil, err
+	}
+
+	g := &group{
+		name:     gc.Name,
+		interval: interval,
+		tenantID: tenantID,
+	}
+	for _, rc := range gc.Rules {
+		if rc.Alert != "" {
+			ar, err := newAlertingRule(rc, gc.Labels)
+			if err != nil {
+				return nil, fmt.Errorf("cannot initialize rule %q: %w", rc.name(), err)
+			}
+			g.alertingRules = append(g.alertingRules, ar)
+			continue
+		}
+		rr, err := newRecordingRule(rc, gc.Labels)
+		if err != nil {
+			return nil, fmt.Errorf("cannot initialize rule %q: %w", rc.name(), err)
+		}
+		g.recordingRules = append(g.recordingRules, rr)
+	}
+	return g, nil
+}
+
+func newRecordingRule(rc *ruleConfig, groupLabels map[string]string) (*recordingRule, error) {
+	if !metricNameRegexp.MatchString(rc.Record) {
+		return nil, fmt.Errorf("invalid metric name in `record`: %q; it must match %s", rc.Record, metricNameRegexp)
+	}
+	if rc.For != 0 {
+		return nil, fmt.Errorf("`for` cannot be set for recording rule")
+	}
+	if len(rc.Annotations) > 0 {
+		return nil, fmt.Errorf("`annotations` cannot be set for recording rule")
+	}
+	labels, err := newRuleLabels(rc, groupLabels)
+	if err != nil {
+		return nil, err
+	}
+
+	rr := &recordingRule{
+		name:   rc.Record,
+		expr:   rc.Expr,
+		labels: labels,
+	}
+	return rr, nil
+}
+
+func newAlertingRule(rc *ruleConfig, groupLabels map[string]string) (*alertingRule, error) {
+	if rc.Record != "" {
+		return nil, fmt.Errorf("`record` and `alert` cannot be set simultaneously")
+	}
+	if !metricNameRegexp.MatchString(rc.Alert) {
+		return nil, fmt.Errorf("invalid alert name in `alert`: %q; it must match %s", rc.Alert, metricNameRegexp)
+	}
+	if rc.For < 0 {
+		return nil, fmt.Errorf("`for` cannot be negative; got %s", rc.For)
+	}
+	labels, err := newRuleLabels(rc, groupLabels)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := labels["alertname"]; ok {
+		return nil, fmt.Errorf("the label name %q cannot be overridden", "alertname")
+	}
+
+	annotations := make(map[string]*template.Template, len(rc.Annotations))
+	for k, v := range rc.Annotations {
+		t, err := parseAnnotationTemplate(k, v)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse template for annotation %q: %w", k, err)
+		}
+		annotations[k] = t
+	}
+
+	ar := &alertingRule{
+		name:        rc.Alert,
+		expr:        rc.Expr,
+		forDuration: rc.For,
+		labels:      labels,
+		annotations: annotations,
+	}
+	return ar, nil
+}
+
+// newRuleLabels validates rc and returns labels for rc.
+func newRuleLabels(rc *ruleConfig, groupLabels map[string]string) (map[string]string, error) {
+	if err := checkLabels(rc.Labels); err != nil {
+		return nil, err
+	}
+
+	q, err := logstorage.ParseQuery(rc.Expr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse expr: %w", err)
+	}
+	if _, err := q.GetStatsByFields(); err != nil {
+		return nil, fmt.Errorf("unsupported expr: %w", err)
+	}
+
+	// Rule labels override group labels.
+	labels := make(map[string]string, len(groupLabels)+len(rc.Labels))
+	for k, v := range groupLabels {
+		labels[k] = v
+	}
+	for k, v := range rc.Labels {
+		labels[k] = v
+	}
+	return labels, nil
+}
+
+func checkLabels(labels map[string]string) error {
+	for k := range labels {
+		if !labelNameRegexp.MatchString(k) {
+			return fmt.Errorf("invalid label name %q; it must match %s", k, labelNameRegexp)
+		}
+		if k == "__name__" {
+			return fmt.Errorf("the label name %q cannot be overridden", k)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package vlrules
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseGroupsSuccess(t *testing.T) {
+	data := `
+groups:
+- name: nginx
+  interval: 5m
+  tenant: "12:34"
+  labels:
+    env: prod
+  rules:
+  - record: nginx_requests:5m
+    expr: '{app="nginx"} | stats by (status) count() requests'
+    labels:
+      source: vlogs
+  - record: nginx_errors
+    expr: '{app="nginx"} error | stats count()'
+    labels:
+      env: dev
+- name: default
+  rules:
+  - record: logs_total
+    expr: '* | stats count()'
+  - alert: TooManyErrors
+    expr: 'error | stats by (host) count() errors | filter errors:>10'
+    for: 5m
+    labels:
+      severity: critical
+    annotations:
+      summary: 'Too many errors at {{ $labels.host }}: {{ $value }}'
+`
+	groups, err := parseGroups([]byte(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("unexpected number of groups; got %d; want 2", len(groups))
+	}
+
+	g := groups[0]
+	if g.name != "nginx" {
+		t.Fatalf("unexpected group name; got %q; want %q", g.name, "nginx")
+	}
+	if g.interval != 5*time.Minute {
+		t.Fatalf("unexpected interval; got %s; want 5m", g.interval)
+	}
+	if g.tenantID.AccountID != 12 || g.tenantID.ProjectID != 34 {
+		t.Fatalf("unexpected tenant; got %s; want 12:34", &g.tenantID)
+	}
+	if len(g.recordingRules) != 2 {
+		t.Fatalf("unexpected number of rules; got %d; want 2", len(g.recordingRules))
+	}
+	rr := g.recordingRules[1]
+	if rr.name != "nginx_errors" {
+		t.Fatalf("unexpected rule name; got %q; want %q", rr.name, "nginx_errors")
+	}
+	if rr.labels["env"] != "dev" {
+		t.Fatalf("rule labels must override group labels; got env=%q; want env=%q", rr.labels["env"], "dev")
+	}
+
+	g = groups[1]
+	if g.interval != *evaluationInterval {
+		t.Fatalf("unexpected default interval; got %s; want %s", g.interval, *evaluationInterval)
+	}
+	if len(g.recordingRules) != 1 {
+		t.Fatalf("unexpected number of recording rules; got %d; want 1", len(g.recordingRules))
+	}
+	if len(g.alertingRules) != 1 {
+		t.Fatalf("unexpected number of alerting rules; got %d; want 1", len(g.alertingRules))
+	}
+	ar := g.alertingRules[0]
+	if ar.name != "TooManyErrors" {
+		t.Fatalf("unexpected alert name; got %q; want %q", ar.name, "TooManyErrors")
+	}
+	if ar.forDuration != 5*time.Minute {
+		t.Fatalf("unexpected for; got %s; want 5m", ar.forDuration)
+	}
+	if len(ar.annotations) != 1 {
+		t.Fatalf("unexpected number of annotations; got %d; want 1", len(ar.annotations))
+	}
+}
+
+func TestParseGroupsFailure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+
+		groups, err := parseGroups([]byte(data))
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		if groups != nil {
+			t.Fatalf("expecting nil groups")
+		}
+	}
+
+	// invalid yaml
+	f(`groups: [`)
+
+	// unknown field
+	f(`
+groups:
+- name: foo
+  unknown_field: bar
+  rules:
+  - record: foo
+    expr: '* | stats count()'
+`)
+
+	// missing group name
+	f(`
+groups:
+- rules:
+  - record: foo
+    expr: '* | stats count()'
+`)
+
+	// missing rules
+	f(`
+groups:
+- name: foo
+`)
+
+	// invalid tenant
+	f(`
+groups:
+- name: foo
+  tenant: bar
+  rules:
+  - record: foo
+    expr: '* | stats count()'
+`)
+
+	// invalid metric name
+	f(`
+groups:
+- name: foo
+  rules:
+  - record: foo-bar
+    expr: '* | stats count()'
+`)
+
+	// invalid expr
+	f(`
+groups:
+- name: foo
+  rules:
+  - record: foo
+    expr: '* | stats'
+`)
+
+	// missing stats pipe
+	f(`
+groups:
+- name: foo
+  rules:
+  - record: foo
+    expr: 'error'
+`)
+
+	// invalid label name
+	f(`
+groups:
+- name: foo
+  rules:
+  - record: foo
+    expr: '* | stats count()'
+    labels:
+      foo-bar: baz
+`)
+
+	// both record and alert
+	f(`
+groups:
+- name: foo
+  rules:
+  - record: foo
+    alert: bar
+    expr: '* | stats count()'
+`)
+
+	// for in recording rule
+	f(`
+groups:
+- name: foo
+  rules:
+  - record: foo
+    expr: '* | stats count()'
+    for: 5m
+`)
+
+	// annotations in recording rule
+	f(`
+groups:
+- name: foo
+  rules:
+  - record: foo
+    expr: '* | stats count()'
+    annotations:
+      summary: foo
+`)
+
+	// invalid alert name
+	f(`
+groups:
+- name: foo
+  rules:
+  - alert: foo bar
+    expr: '* | stats count()'
+`)
+
+	// negative for
+	f(`
+groups:
+- name: foo
+  rules:
+  - alert: foo
+    expr: '* | stats count()'
+    for: -5m
+`)
+
+	// alertname label override
+	f(`
+groups:
+- name: foo
+  rules:
+  - alert: foo
+    expr: '* | stats count()'
+    labels:
+      alertname: bar
+`)
+
+	// invalid annotation template
+	f(`
+groups:
+- name: foo
+  rules:
+  - alert: foo
+    expr: '* | stats count()'
+    annotations:
+      summary: '{{ $labels.host'
+`)
+}
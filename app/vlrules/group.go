@@ -0,0 +1,308 @@
+package vlrules
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+// group is a group of rules, which are evaluated together with the given interval.
+type group struct {
+	name     string
+	interval time.Duration
+	tenantID logstorage.TenantID
+
+	recordingRules []*recordingRule
+	alertingRules  []*alertingRule
+}
+
+// run evaluates g rules every g.interval until ctx is canceled.
+func (g *group) run(ctx context.Context) {
+	rulesCount := len(g.recordingRules) + len(g.alertingRules)
+	logger.Infof("starting evaluation of group %q with %d rules every %s", g.name, rulesCount, g.interval)
+
+	t := time.NewTicker(g.interval)
+	defer t.Stop()
+	for {
+		g.eval(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// eval evaluates all the rules in g at the given evaluation time.
+func (g *group) eval(ctx context.Context, evalTime time.Time) {
+	// Shift the evaluation time back by -rule.evalDelay in order to take into account the delay for the ingested logs.
+	ts := evalTime.Add(-*evalDelay)
+
+	var tss []prompb.TimeSeries
+	for _, rr := range g.recordingRules {
+		series, err := rr.eval(ctx, g, ts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Errorf("cannot evaluate rule %q from group %q: %s", rr.name, g.name, err)
+			continue
+		}
+		tss = appendTimeSeries(tss, series, ts.UnixMilli())
+	}
+
+	var alerts []*alert
+	for _, ar := range g.alertingRules {
+		alertsLocal, err := ar.eval(ctx, g, ts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Errorf("cannot evaluate rule %q from group %q: %s", ar.name, g.name, err)
+			continue
+		}
+		alerts = append(alerts, alertsLocal...)
+		tss = appendTimeSeries(tss, ar.getAlertsSeries(), ts.UnixMilli())
+	}
+
+	if notifierClient != nil && len(alerts) > 0 {
+		// Firing alerts must be re-sent periodically until they are resolved, so set endsAt to a few evaluation intervals in the future.
+		endsAt := evalTime.Add(3 * g.interval)
+		if err := notifierClient.send(ctx, alerts, endsAt); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Errorf("cannot send %d alerts generated by group %q to -rule.notifier.url: %s", len(alerts), g.name, err)
+		}
+	}
+
+	if remoteWriteClient != nil && len(tss) > 0 {
+		if err := remoteWriteClient.send(ctx, tss); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Errorf("cannot send %d time series generated by group %q to -rule.remoteWrite.url: %s", len(tss), g.name, err)
+		}
+	}
+}
+
+// recordingRule is a rule, which converts results of LogsQL query with `stats` pipe to metrics.
+type recordingRule struct {
+	// name is the name of the generated metric.
+	name string
+
+	// expr is LogsQL query to evaluate.
+	expr string
+
+	// labels are added to the generated metrics.
+	labels map[string]string
+
+	// mu protects the results of the last evaluation.
+	mu sync.Mutex
+
+	// series contains the results of the last successful evaluation.
+	series []*series
+}
+
+// series is a single metric generated by the recording rule.
+type series struct {
+	// labels contains sorted labels for the metric including __name__ label.
+	labels []prompb.Label
+
+	// value is the metric value.
+	value float64
+}
+
+// eval evaluates rr for logs on the time range (ts-g.interval ... ts] and returns the generated series.
+func (rr *recordingRule) eval(ctx context.Context, g *group, ts time.Time) ([]*series, error) {
+	evaluationsTotal := metrics.GetOrCreateCounter(fmt.Sprintf(`vl_rule_evaluations_total{group=%q,rule=%q}`, g.name, rr.name))
+	evaluationErrors := metrics.GetOrCreateCounter(fmt.Sprintf(`vl_rule_evaluation_errors_total{group=%q,rule=%q}`, g.name, rr.name))
+
+	evaluationsTotal.Inc()
+	series, err := rr.evalInternal(ctx, g, ts)
+	if err != nil {
+		evaluationErrors.Inc()
+		return nil, err
+	}
+
+	rr.mu.Lock()
+	rr.series = series
+	rr.mu.Unlock()
+
+	return series, nil
+}
+
+func (rr *recordingRule) evalInternal(ctx context.Context, g *group, ts time.Time) ([]*series, error) {
+	var ssLock sync.Mutex
+	var ss []*series
+	err := runStatsQuery(ctx, g, rr.expr, ts, func(columns []logstorage.BlockColumn, rowsCount int, byFields []string) {
+		seriesLocal := rr.getSeriesFromBlock(columns, rowsCount, byFields)
+
+		ssLock.Lock()
+		ss = append(ss, seriesLocal...)
+		ssLock.Unlock()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sortSeries(ss)
+	return ss, nil
+}
+
+// runStatsQuery executes the given expr with `stats` pipe over logs on the time range (ts-g.interval ... ts]
+// and calls writeBlock for every returned block of rows.
+//
+// writeBlock may be called concurrently.
+func runStatsQuery(ctx context.Context, g *group, expr string, ts time.Time, writeBlock func(columns []logstorage.BlockColumn, rowsCount int, byFields []string)) error {
+	end := ts.UnixNano()
+	start := end - g.interval.Nanoseconds()
+
+	q, err := logstorage.ParseQueryAtTimestamp(expr, end)
+	if err != nil {
+		return fmt.Errorf("cannot parse expr: %w", err)
+	}
+	q.AddTimeFilter(start+1, end)
+	byFields, err := q.GetStatsByFields()
+	if err != nil {
+		return err
+	}
+
+	writeDataBlock := func(_ uint, db *logstorage.DataBlock) {
+		rowsCount := db.RowsCount()
+		if rowsCount == 0 {
+			return
+		}
+		writeBlock(db.Columns, rowsCount, byFields)
+	}
+
+	var qs logstorage.QueryStats
+	qctx := logstorage.NewQueryContext(ctx, &qs, []logstorage.TenantID{g.tenantID}, q)
+	if err := vlstorage.RunQuery(qctx, writeDataBlock); err != nil {
+		return fmt.Errorf("cannot execute query [%s]: %w", q, err)
+	}
+	return nil
+}
+
+func sortSeries(ss []*series) {
+	slices.SortFunc(ss, func(a, b *series) int {
+		return strings.Compare(prompb.LabelsToString(a.labels), prompb.LabelsToString(b.labels))
+	})
+}
+
+// getSeriesFromBlock converts the rows returned by rr query to series.
+//
+// Every column, which isn't listed in byFields, is converted to a separate series per every row.
+// The columns listed in byFields are converted to labels.
+func (rr *recordingRule) getSeriesFromBlock(columns []logstorage.BlockColumn, rowsCount int, byFields []string) []*series {
+	metricColumns := 0
+	for _, c := range columns {
+		if !slices.Contains(byFields, c.Name) {
+			metricColumns++
+		}
+	}
+
+	var ss []*series
+	for i := 0; i < rowsCount; i++ {
+		var rowLabels []prompb.Label
+		for _, c := range columns {
+			if slices.Contains(byFields, c.Name) {
+				rowLabels = append(rowLabels, prompb.Label{
+					Name:  sanitizeLabelName(c.Name),
+					Value: strings.Clone(c.Values[i]),
+				})
+			}
+		}
+
+		for _, c := range columns {
+			if slices.Contains(byFields, c.Name) {
+				continue
+			}
+			v, err := strconv.ParseFloat(c.Values[i], 64)
+			if err != nil {
+				// Skip non-numeric results
+				continue
+			}
+
+			// Use the rule name as metric name if the query returns a single result.
+			// Otherwise append the result name to the rule name in order to distinguish results.
+			metricName := rr.name
+			if metricColumns > 1 {
+				metricName += ":" + sanitizeLabelName(c.Name)
+			}
+			ss = append(ss, &series{
+				labels: rr.newLabels(metricName, rowLabels),
+				value:  v,
+			})
+		}
+	}
+	return ss
+}
+
+// newLabels returns sorted labels for the metric with the given name and the given rowLabels.
+//
+// The rr.labels override rowLabels with the same names.
+func (rr *recordingRule) newLabels(metricName string, rowLabels []prompb.Label) []prompb.Label {
+	labels := make([]prompb.Label, 0, len(rowLabels)+len(rr.labels)+1)
+	labels = append(labels, prompb.Label{
+		Name:  "__name__",
+		Value: metricName,
+	})
+	for _, label := range rowLabels {
+		if _, ok := rr.labels[label.Name]; ok || label.Name == "__name__" {
+			continue
+		}
+		labels = append(labels, label)
+	}
+	for k, v := range rr.labels {
+		labels = append(labels, prompb.Label{
+			Name:  k,
+			Value: v,
+		})
+	}
+	slices.SortFunc(labels, func(a, b prompb.Label) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return labels
+}
+
+// sanitizeLabelName replaces chars, which aren't allowed in Prometheus label names, with underscores.
+func sanitizeLabelName(name string) string {
+	if labelNameRegexp.MatchString(name) {
+		return name
+	}
+	b := []byte(name)
+	for i, c := range b {
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (i == 0 || c < '0' || c > '9') {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+func appendTimeSeries(dst []prompb.TimeSeries, ss []*series, timestamp int64) []prompb.TimeSeries {
+	for _, s := range ss {
+		dst = append(dst, prompb.TimeSeries{
+			Labels: s.labels,
+			Samples: []prompb.Sample{
+				{
+					Value:     s.value,
+					Timestamp: timestamp,
+				},
+			},
+		})
+	}
+	return dst
+}
@@ -0,0 +1,100 @@
+package vlrules
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestRecordingRuleGetSeriesFromBlock(t *testing.T) {
+	f := func(rr *recordingRule, columns []logstorage.BlockColumn, byFields []string, resultExpected string) {
+		t.Helper()
+
+		rowsCount := len(columns[0].Values)
+		ss := rr.getSeriesFromBlock(columns, rowsCount, byFields)
+
+		var bb bytes.Buffer
+		for _, s := range ss {
+			writeSeries(&bb, s)
+		}
+		result := bb.String()
+		if result != resultExpected {
+			t.Fatalf("unexpected result;\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	// single result without labels
+	f(&recordingRule{
+		name: "logs_total",
+	}, []logstorage.BlockColumn{
+		{
+			Name:   "count(*)",
+			Values: []string{"123"},
+		},
+	}, nil, `logs_total 123
+`)
+
+	// single result with labels
+	f(&recordingRule{
+		name: "requests",
+		labels: map[string]string{
+			"env": "prod",
+		},
+	}, []logstorage.BlockColumn{
+		{
+			Name:   "host.name",
+			Values: []string{"foo", "bar"},
+		},
+		{
+			Name:   "hits",
+			Values: []string{"10", "2.5"},
+		},
+	}, []string{"host.name"}, `requests{env="prod",host_name="foo"} 10
+requests{env="prod",host_name="bar"} 2.5
+`)
+
+	// multiple results; non-numeric results must be skipped; rule labels override result labels
+	f(&recordingRule{
+		name: "requests",
+		labels: map[string]string{
+			"env": "prod",
+		},
+	}, []logstorage.BlockColumn{
+		{
+			Name:   "env",
+			Values: []string{"dev"},
+		},
+		{
+			Name:   "hits",
+			Values: []string{"10"},
+		},
+		{
+			Name:   "max(duration)",
+			Values: []string{"1.5"},
+		},
+		{
+			Name:   "last_msg",
+			Values: []string{"foo bar"},
+		},
+	}, []string{"env"}, `requests:hits{env="prod"} 10
+requests:max_duration_{env="prod"} 1.5
+`)
+}
+
+func TestSanitizeLabelName(t *testing.T) {
+	f := func(name, resultExpected string) {
+		t.Helper()
+
+		result := sanitizeLabelName(name)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for %q; got %q; want %q", name, result, resultExpected)
+		}
+	}
+
+	f("foo", "foo")
+	f("foo_Bar1", "foo_Bar1")
+	f("host.name", "host_name")
+	f("1foo", "_foo")
+	f("count(*)", "count___")
+}
@@ -0,0 +1,228 @@
+package vlrules
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	rulePaths = flagutil.NewArrayString("rule", "Path to the file with rules to evaluate. The path may contain glob patterns such as /etc/rules/*.yml . "+
+		"Rules aren't evaluated if this flag isn't set. See https://docs.victoriametrics.com/victorialogs/rules/")
+	evaluationInterval = flag.Duration("rule.evaluationInterval", time.Minute, "The default interval between evaluations of rules groups. "+
+		"It can be overridden with interval option per every group. See https://docs.victoriametrics.com/victorialogs/rules/")
+	evalDelay = flag.Duration("rule.evalDelay", 30*time.Second, "The delay for the evaluation time of rules. It is needed in order to take into account "+
+		"the delay between logs generation and their ingestion into VictoriaLogs. See https://docs.victoriametrics.com/victorialogs/rules/")
+	remoteWriteURL = flag.String("rule.remoteWrite.url", "", "Optional URL for sending the metrics generated by recording rules via Prometheus remote write protocol. "+
+		"For example, http://victoriametrics:8428/api/v1/write . See https://docs.victoriametrics.com/victorialogs/rules/")
+	notifierURL = flag.String("rule.notifier.url", "", "Optional URL of Alertmanager-compatible webhook for sending alerts generated by alerting rules. "+
+		"For example, http://alertmanager:9093/api/v2/alerts . See https://docs.victoriametrics.com/victorialogs/rules/#alerting-rules")
+)
+
+var (
+	groups []*group
+
+	rulesMetrics *metrics.Set
+
+	stopFunc context.CancelFunc
+	groupsWG sync.WaitGroup
+)
+
+// Init initializes rules evaluation.
+//
+// Stop must be called when rules evaluation is no longer needed.
+func Init() {
+	if len(*rulePaths) == 0 {
+		return
+	}
+
+	gs, err := loadGroups(*rulePaths)
+	if err != nil {
+		logger.Fatalf("cannot load rules from -rule=%s: %s", *rulePaths, err)
+	}
+	groups = gs
+
+	if *remoteWriteURL != "" {
+		remoteWriteClient = newRemoteWriteClient(*remoteWriteURL)
+	}
+	if *notifierURL != "" {
+		notifierClient = newNotifierClient(*notifierURL)
+	}
+
+	rulesMetrics = metrics.NewSet()
+	rulesMetrics.RegisterMetricsWriter(writeRulesMetrics)
+	metrics.RegisterSet(rulesMetrics)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopFunc = cancel
+	for _, g := range groups {
+		groupsWG.Add(1)
+		go func(g *group) {
+			defer groupsWG.Done()
+			g.run(ctx)
+		}(g)
+	}
+	logger.Infof("started evaluation of %d rules groups from -rule=%s", len(groups), *rulePaths)
+}
+
+// Stop stops rules evaluation.
+func Stop() {
+	if stopFunc == nil {
+		return
+	}
+
+	stopFunc()
+	groupsWG.Wait()
+	stopFunc = nil
+
+	metrics.UnregisterSet(rulesMetrics, true)
+	rulesMetrics = nil
+
+	groups = nil
+	remoteWriteClient = nil
+	notifierClient = nil
+}
+
+// RequestHandler handles HTTP requests for rules.
+//
+// See https://docs.victoriametrics.com/victorialogs/rules/
+func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
+	switch r.URL.Path {
+	case "/api/v1/alerts":
+		processAlertsRequest(w)
+		return true
+	}
+	return false
+}
+
+// alertsResponse is the response for /api/v1/alerts in Prometheus-compatible format.
+type alertsResponse struct {
+	Status string             `json:"status"`
+	Data   alertsResponseData `json:"data"`
+}
+
+type alertsResponseData struct {
+	Alerts []activeAlert `json:"alerts"`
+}
+
+type activeAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	State       string            `json:"state"`
+	ActiveAt    time.Time         `json:"activeAt"`
+	Value       string            `json:"value"`
+}
+
+func processAlertsRequest(w http.ResponseWriter) {
+	resp := alertsResponse{
+		Status: "success",
+		Data: alertsResponseData{
+			Alerts: []activeAlert{},
+		},
+	}
+	for _, g := range groups {
+		for _, ar := range g.alertingRules {
+			for _, a := range ar.getActiveAlerts() {
+				aa := activeAlert{
+					Labels:      make(map[string]string, len(a.labels)),
+					Annotations: a.annotations,
+					State:       a.state.String(),
+					ActiveAt:    a.activeAt,
+					Value:       strconv.FormatFloat(a.value, 'g', -1, 64),
+				}
+				for _, label := range a.labels {
+					aa.Labels[label.Name] = label.Value
+				}
+				if aa.Annotations == nil {
+					aa.Annotations = map[string]string{}
+				}
+				resp.Data.Alerts = append(resp.Data.Alerts, aa)
+			}
+		}
+	}
+
+	data, err := json.Marshal(&resp)
+	if err != nil {
+		logger.Panicf("BUG: unexpected error when marshaling alerts response: %s", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// writeRulesMetrics writes the results of the last evaluation of recording rules
+// and ALERTS series for active alerts to w in Prometheus text exposition format.
+func writeRulesMetrics(w io.Writer) {
+	for _, g := range groups {
+		for _, rr := range g.recordingRules {
+			rr.mu.Lock()
+			for _, s := range rr.series {
+				writeSeries(w, s)
+			}
+			rr.mu.Unlock()
+		}
+		for _, ar := range g.alertingRules {
+			for _, s := range ar.getAlertsSeries() {
+				writeSeries(w, s)
+			}
+		}
+	}
+}
+
+func writeSeries(w io.Writer, s *series) {
+	var b []byte
+	for _, label := range s.labels {
+		if label.Name == "__name__" {
+			b = append(b, label.Value...)
+			break
+		}
+	}
+	n := 0
+	for _, label := range s.labels {
+		if label.Name == "__name__" {
+			continue
+		}
+		if n == 0 {
+			b = append(b, '{')
+		} else {
+			b = append(b, ',')
+		}
+		b = append(b, label.Name...)
+		b = append(b, `="`...)
+		b = appendEscapedLabelValue(b, label.Value)
+		b = append(b, '"')
+		n++
+	}
+	if n > 0 {
+		b = append(b, '}')
+	}
+	fmt.Fprintf(w, "%s %g\n", b, s.value)
+}
+
+// appendEscapedLabelValue appends s escaped according to Prometheus text exposition format to dst and returns the result.
+//
+// Only backslash, double quote and newline chars are escaped, while the rest of chars including non-ASCII chars are written as is.
+func appendEscapedLabelValue(dst []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			dst = append(dst, `\\`...)
+		case '"':
+			dst = append(dst, `\"`...)
+		case '\n':
+			dst = append(dst, `\n`...)
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,50 @@
+package vlrules
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+)
+
+func TestWriteSeries(t *testing.T) {
+	f := func(labels []prompb.Label, value float64, resultExpected string) {
+		t.Helper()
+
+		s := &series{
+			labels: labels,
+			value:  value,
+		}
+		var bb bytes.Buffer
+		writeSeries(&bb, s)
+		result := bb.String()
+		if result != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	// metric without labels
+	f([]prompb.Label{
+		{Name: "__name__", Value: "foo"},
+	}, 12, "foo 12\n")
+
+	// metric with labels
+	f([]prompb.Label{
+		{Name: "__name__", Value: "foo"},
+		{Name: "host", Value: "bar"},
+		{Name: "job", Value: "baz"},
+	}, 1.5, `foo{host="bar",job="baz"} 1.5`+"\n")
+
+	// backslash, double quote and newline chars must be escaped
+	f([]prompb.Label{
+		{Name: "__name__", Value: "foo"},
+		{Name: "path", Value: `C:\logs "a"` + "\nb"},
+	}, 1, `foo{path="C:\\logs \"a\"\nb"} 1`+"\n")
+
+	// non-ASCII and other control chars must be written as is
+	f([]prompb.Label{
+		{Name: "__name__", Value: "foo"},
+		{Name: "city", Value: "Zürich 東京"},
+		{Name: "msg", Value: "a\tb\rc\x01"},
+	}, 2, "foo{city=\"Zürich 東京\",msg=\"a\tb\rc\x01\"} 2\n")
+}
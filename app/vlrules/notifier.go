@@ -0,0 +1,114 @@
+package vlrules
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputil"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var notifierClient *notifierClientT
+
+// notifierClientT sends alerts generated by alerting rules to Alertmanager-compatible webhook.
+//
+// See https://github.com/prometheus/alertmanager/blob/main/api/v2/openapi.yaml
+type notifierClientT struct {
+	url string
+	hc  *http.Client
+
+	requestsTotal *metrics.Counter
+	errorsTotal   *metrics.Counter
+	alertsSent    *metrics.Counter
+}
+
+func newNotifierClient(url string) *notifierClientT {
+	tr := httputil.NewTransport(false, "vlrules_notifier")
+	hc := &http.Client{
+		Transport: tr,
+		Timeout:   time.Minute,
+	}
+	return &notifierClientT{
+		url: url,
+		hc:  hc,
+
+		requestsTotal: metrics.GetOrCreateCounter(`vl_rule_notifier_requests_total`),
+		errorsTotal:   metrics.GetOrCreateCounter(`vl_rule_notifier_errors_total`),
+		alertsSent:    metrics.GetOrCreateCounter(`vl_rule_notifier_alerts_sent_total`),
+	}
+}
+
+// postableAlert is an alert in the format accepted by Alertmanager at /api/v2/alerts.
+type postableAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+// send sends alerts to c.url.
+//
+// endsAt is used as the end time for firing alerts.
+func (c *notifierClientT) send(ctx context.Context, alerts []*alert, endsAt time.Time) error {
+	c.requestsTotal.Inc()
+	if err := c.sendInternal(ctx, alerts, endsAt); err != nil {
+		c.errorsTotal.Inc()
+		return err
+	}
+	c.alertsSent.Add(len(alerts))
+	return nil
+}
+
+func (c *notifierClientT) sendInternal(ctx context.Context, alerts []*alert, endsAt time.Time) error {
+	data, err := json.Marshal(newPostableAlerts(alerts, endsAt))
+	if err != nil {
+		return fmt.Errorf("cannot marshal alerts: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("cannot create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot send request: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected response status code %d; response body: %q", resp.StatusCode, body)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func newPostableAlerts(alerts []*alert, endsAt time.Time) []postableAlert {
+	pas := make([]postableAlert, 0, len(alerts))
+	for _, a := range alerts {
+		pa := postableAlert{
+			Labels:      make(map[string]string, len(a.labels)),
+			Annotations: a.annotations,
+			StartsAt:    a.firedAt,
+			EndsAt:      endsAt,
+		}
+		for _, label := range a.labels {
+			pa.Labels[label.Name] = label.Value
+		}
+		if a.state == alertStateResolved {
+			pa.EndsAt = a.resolvedAt
+		}
+		pas = append(pas, pa)
+	}
+	return pas
+}
@@ -0,0 +1,85 @@
+package vlrules
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/golang/snappy"
+)
+
+var remoteWriteClient *remoteWriteClientT
+
+// remoteWriteClientT sends metrics generated by recording rules to the remote storage via Prometheus remote write protocol.
+type remoteWriteClientT struct {
+	url string
+	hc  *http.Client
+
+	requestsTotal *metrics.Counter
+	errorsTotal   *metrics.Counter
+	seriesSent    *metrics.Counter
+}
+
+func newRemoteWriteClient(url string) *remoteWriteClientT {
+	tr := httputil.NewTransport(false, "vlrules_remotewrite")
+	hc := &http.Client{
+		Transport: tr,
+		Timeout:   time.Minute,
+	}
+	return &remoteWriteClientT{
+		url: url,
+		hc:  hc,
+
+		requestsTotal: metrics.GetOrCreateCounter(`vl_rule_remotewrite_requests_total`),
+		errorsTotal:   metrics.GetOrCreateCounter(`vl_rule_remotewrite_errors_total`),
+		seriesSent:    metrics.GetOrCreateCounter(`vl_rule_remotewrite_series_sent_total`),
+	}
+}
+
+// send sends tss to c.url.
+func (c *remoteWriteClientT) send(ctx context.Context, tss []prompb.TimeSeries) error {
+	c.requestsTotal.Inc()
+	if err := c.sendInternal(ctx, tss); err != nil {
+		c.errorsTotal.Inc()
+		return err
+	}
+	c.seriesSent.Add(len(tss))
+	return nil
+}
+
+func (c *remoteWriteClientT) sendInternal(ctx context.Context, tss []prompb.TimeSeries) error {
+	wr := &prompb.WriteRequest{
+		Timeseries: tss,
+	}
+	data := wr.MarshalProtobuf(nil)
+	data = snappy.Encode(nil, data)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("cannot create request: %w", err)
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot send request: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected response status code %d; response body: %q", resp.StatusCode, body)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -2,6 +2,7 @@ package internalselect
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -49,6 +50,10 @@ var requestHandlers = map[string]func(ctx context.Context, w http.ResponseWriter
 	"/internal/select/stream_field_values": processStreamFieldValuesRequest,
 	"/internal/select/streams":             processStreamsRequest,
 	"/internal/select/stream_ids":          processStreamIDsRequest,
+	"/internal/select/delete":              processDeleteRequest,
+	"/internal/select/tenants_usage":       processTenantsUsageRequest,
+	"/internal/select/tenant_ids":          processTenantIDsRequest,
+	"/internal/select/data_set_version":    processDataSetVersionRequest,
 }
 
 func processQueryRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
@@ -273,10 +278,116 @@ func processStreamIDsRequest(ctx context.Context, w http.ResponseWriter, r *http
 	return writeValuesWithHits(w, qctx, streamIDs, cp.DisableCompression)
 }
 
+func processDeleteRequest(ctx context.Context, _ http.ResponseWriter, r *http.Request) error {
+	cp, err := getCommonParams(r, netselect.DeleteProtocolVersion)
+	if err != nil {
+		return err
+	}
+
+	qctx := cp.NewQueryContext(ctx)
+	if err := vlstorage.DeleteRows(qctx); err != nil {
+		return fmt.Errorf("cannot delete logs: %w", err)
+	}
+	return nil
+}
+
+func processTenantsUsageRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	version := r.FormValue("version")
+	if version != netselect.TenantsUsageProtocolVersion {
+		return fmt.Errorf("unexpected version=%q; want %q", version, netselect.TenantsUsageProtocolVersion)
+	}
+	s := r.FormValue("disable_compression")
+	disableCompression, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("cannot parse disable_compression=%q: %w", s, err)
+	}
+	partitionNamePrefix := r.FormValue("partition_prefix")
+
+	tus, err := vlstorage.GetTenantsUsage(ctx, partitionNamePrefix)
+	if err != nil {
+		return fmt.Errorf("cannot obtain tenants usage: %w", err)
+	}
+
+	b, err := json.Marshal(tus)
+	if err != nil {
+		return fmt.Errorf("cannot marshal tenants usage: %w", err)
+	}
+	if !disableCompression {
+		b = zstd.CompressLevel(nil, b, 1)
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	if _, err := w.Write(b); err != nil {
+		return fmt.Errorf("cannot send response to the client: %w", err)
+	}
+	return nil
+}
+
+func processTenantIDsRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	version := r.FormValue("version")
+	if version != netselect.TenantIDsProtocolVersion {
+		return fmt.Errorf("unexpected version=%q; want %q", version, netselect.TenantIDsProtocolVersion)
+	}
+	start, err := getInt64FromRequest(r, "start")
+	if err != nil {
+		return err
+	}
+	end, err := getInt64FromRequest(r, "end")
+	if err != nil {
+		return err
+	}
+	s := r.FormValue("disable_compression")
+	disableCompression, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("cannot parse disable_compression=%q: %w", s, err)
+	}
+
+	tenantIDs, err := vlstorage.GetTenantIDs(ctx, start, end)
+	if err != nil {
+		return fmt.Errorf("cannot obtain tenantIDs: %w", err)
+	}
+
+	b := logstorage.MarshalTenantIDs(nil, tenantIDs)
+	if !disableCompression {
+		b = zstd.CompressLevel(nil, b, 1)
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	if _, err := w.Write(b); err != nil {
+		return fmt.Errorf("cannot send response to the client: %w", err)
+	}
+	return nil
+}
+
+func processDataSetVersionRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	version := r.FormValue("version")
+	if version != netselect.DataSetVersionProtocolVersion {
+		return fmt.Errorf("unexpected version=%q; want %q", version, netselect.DataSetVersionProtocolVersion)
+	}
+
+	dataSetVersion, err := vlstorage.GetDataSetVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot obtain data set version: %w", err)
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	b := encoding.MarshalUint64(nil, dataSetVersion)
+	if _, err := w.Write(b); err != nil {
+		return fmt.Errorf("cannot send response to the client: %w", err)
+	}
+	return nil
+}
+
 type commonParams struct {
 	TenantIDs []logstorage.TenantID
 	Query     *logstorage.Query
 
+	// StreamShards is an optional list of log stream shards to query.
+	StreamShards *logstorage.StreamShards
+
 	DisableCompression bool
 
 	// qs contains execution statistics for the Query.
@@ -284,7 +395,9 @@ type commonParams struct {
 }
 
 func (cp *commonParams) NewQueryContext(ctx context.Context) *logstorage.QueryContext {
-	return logstorage.NewQueryContext(ctx, &cp.qs, cp.TenantIDs, cp.Query)
+	qctx := logstorage.NewQueryContext(ctx, &cp.qs, cp.TenantIDs, cp.Query)
+	qctx.StreamShards = cp.StreamShards
+	return qctx
 }
 
 func (cp *commonParams) UpdatePerQueryStatsMetrics() {
@@ -320,9 +433,19 @@ func getCommonParams(r *http.Request, expectedProtocolVersion string) (*commonPa
 		return nil, fmt.Errorf("cannot parse disable_compression=%q: %w", s, err)
 	}
 
+	var streamShards *logstorage.StreamShards
+	if ssStr := r.FormValue("stream_shards"); ssStr != "" {
+		ss, err := logstorage.ParseStreamShards(ssStr)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse stream_shards=%q: %w", ssStr, err)
+		}
+		streamShards = ss
+	}
+
 	cp := &commonParams{
-		TenantIDs: tenantIDs,
-		Query:     q,
+		TenantIDs:    tenantIDs,
+		Query:        q,
+		StreamShards: streamShards,
 
 		DisableCompression: disableCompression,
 	}
@@ -2,6 +2,7 @@ package logsql
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"io"
 	"math"
@@ -12,10 +13,12 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/atomicutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputil"
@@ -26,11 +29,14 @@ import (
 
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlstorage"
 	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/parquet"
 )
 
 var (
 	maxQueryTimeRange = flagutil.NewExtendedDuration("search.maxQueryTimeRange", "0", "The maximum time range, which can be set in the query sent to querying APIs. "+
 		"Queries with bigger time ranges are rejected. See https://docs.victoriametrics.com/victorialogs/querying/#resource-usage-limits")
+	allowPartialResponse = flag.Bool("search.allowPartialResponse", false, "Whether to return partial responses if some of -storageNode are unavailable. "+
+		"This flag can be overridden with allow_partial_response query arg. See https://docs.victoriametrics.com/victorialogs/cluster/#partial-responses")
 )
 
 // ProcessFacetsRequest handles /select/logsql/facets request.
@@ -123,6 +129,7 @@ func ProcessFacetsRequest(ctx context.Context, w http.ResponseWriter, r *http.Re
 
 	h.Set("Content-Type", "application/json")
 	writeRequestDuration(h, startTime)
+	ca.writePartialResponseHeaders(h, "")
 
 	// Write response
 	WriteFacetsResponse(w, m)
@@ -239,6 +246,7 @@ func ProcessHitsRequest(ctx context.Context, w http.ResponseWriter, r *http.Requ
 
 	h.Set("Content-Type", "application/json")
 	writeRequestDuration(h, startTime)
+	ca.writePartialResponseHeaders(h, "")
 
 	// The VL-Selected-Time-Range contains the time range specified in the query, not counting (start, end) and extra_filters
 	// It is used by the built-in web UI in order to adjust the selected time range.
@@ -342,6 +350,7 @@ func ProcessFieldNamesRequest(ctx context.Context, w http.ResponseWriter, r *htt
 
 	h.Set("Content-Type", "application/json")
 	writeRequestDuration(h, startTime)
+	ca.writePartialResponseHeaders(h, "")
 
 	// Write results
 	WriteValuesWithHitsJSON(w, fieldNames)
@@ -387,6 +396,7 @@ func ProcessFieldValuesRequest(ctx context.Context, w http.ResponseWriter, r *ht
 
 	h.Set("Content-Type", "application/json")
 	writeRequestDuration(h, startTime)
+	ca.writePartialResponseHeaders(h, "")
 
 	// Write results
 	WriteValuesWithHitsJSON(w, values)
@@ -418,6 +428,7 @@ func ProcessStreamFieldNamesRequest(ctx context.Context, w http.ResponseWriter,
 
 	h.Set("Content-Type", "application/json")
 	writeRequestDuration(h, startTime)
+	ca.writePartialResponseHeaders(h, "")
 
 	// Write results
 	WriteValuesWithHitsJSON(w, names)
@@ -463,6 +474,7 @@ func ProcessStreamFieldValuesRequest(ctx context.Context, w http.ResponseWriter,
 
 	h.Set("Content-Type", "application/json")
 	writeRequestDuration(h, startTime)
+	ca.writePartialResponseHeaders(h, "")
 
 	// Write results
 	WriteValuesWithHitsJSON(w, values)
@@ -500,6 +512,7 @@ func ProcessStreamIDsRequest(ctx context.Context, w http.ResponseWriter, r *http
 
 	h.Set("Content-Type", "application/json")
 	writeRequestDuration(h, startTime)
+	ca.writePartialResponseHeaders(h, "")
 
 	// Write results
 	WriteValuesWithHitsJSON(w, streamIDs)
@@ -537,11 +550,216 @@ func ProcessStreamsRequest(ctx context.Context, w http.ResponseWriter, r *http.R
 
 	h.Set("Content-Type", "application/json")
 	writeRequestDuration(h, startTime)
+	ca.writePartialResponseHeaders(h, "")
 
 	// Write results
 	WriteValuesWithHitsJSON(w, streams)
 }
 
+// ProcessStreamFieldRecommendationsRequest processes /select/logsql/stream_field_recommendations request.
+//
+// It returns per-field cardinality stats and recommendations on stream fields for logs matching the given query.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/#querying-stream-field-recommendations
+func ProcessStreamFieldRecommendationsRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ca, err := parseCommonArgs(r)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+
+	// Parse max_values_per_field query arg
+	maxValuesPerField, err := getPositiveInt(r, "max_values_per_field")
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	if maxValuesPerField == 0 {
+		maxValuesPerField = 100
+	}
+
+	// Parse top_streams query arg
+	topStreamsLimit, err := getPositiveInt(r, "top_streams")
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	if topStreamsLimit == 0 {
+		topStreamsLimit = 10
+	}
+
+	// Pipes must be dropped, since it is expected the stats are obtained
+	// from the real logs stored in the database.
+	ca.q.DropAllPipes()
+
+	qctx := ca.newQueryContext(ctx)
+	defer ca.updatePerQueryStatsMetrics()
+
+	startTime := time.Now()
+
+	// Obtain the number of logs and log streams for the given query
+	qCount := ca.q.Clone(ca.q.GetTimestamp())
+	qCount.AddRowsAndStreamsCountPipe()
+	var rows, streams atomic.Uint64
+	writeCountBlock := func(_ uint, db *logstorage.DataBlock) {
+		cRows := db.GetColumnByName("rows")
+		cStreams := db.GetColumnByName("streams")
+		if cRows == nil || cStreams == nil {
+			return
+		}
+		for i := range cRows.Values {
+			n, _ := strconv.ParseUint(cRows.Values[i], 10, 64)
+			rows.Add(n)
+			n, _ = strconv.ParseUint(cStreams.Values[i], 10, 64)
+			streams.Add(n)
+		}
+	}
+	if err := vlstorage.RunQuery(qctx.WithQuery(qCount), writeCountBlock); err != nil {
+		httpserver.Errorf(w, r, "cannot execute query [%s]: %s", qCount, err)
+		return
+	}
+
+	// Obtain log streams with the biggest number of logs for the given query
+	qTop := ca.q.Clone(ca.q.GetTimestamp())
+	qTop.AddTopStreamsPipe(topStreamsLimit)
+	var topStreamsLock sync.Mutex
+	var topStreams []logstorage.ValueWithHits
+	writeTopBlock := func(_ uint, db *logstorage.DataBlock) {
+		cStream := db.GetColumnByName("_stream")
+		cHits := db.GetColumnByName("hits")
+		if cStream == nil || cHits == nil {
+			return
+		}
+
+		topStreamsLock.Lock()
+		for i := range cStream.Values {
+			hits, _ := strconv.ParseUint(cHits.Values[i], 10, 64)
+			topStreams = append(topStreams, logstorage.ValueWithHits{
+				Value: strings.Clone(cStream.Values[i]),
+				Hits:  hits,
+			})
+		}
+		topStreamsLock.Unlock()
+	}
+	if err := vlstorage.RunQuery(qctx.WithQuery(qTop), writeTopBlock); err != nil {
+		httpserver.Errorf(w, r, "cannot execute query [%s]: %s", qTop, err)
+		return
+	}
+
+	// Obtain stream fields for the given query
+	streamFieldNames, err := vlstorage.GetStreamFieldNames(qctx)
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot obtain stream field names: %s", err)
+		return
+	}
+	streamFieldValues := make(map[string]uint64, len(streamFieldNames))
+	for _, vh := range streamFieldNames {
+		values, err := vlstorage.GetStreamFieldValues(qctx, vh.Value, uint64(maxValuesPerField)+1)
+		if err != nil {
+			httpserver.Errorf(w, r, "cannot obtain values for stream field %q: %s", vh.Value, err)
+			return
+		}
+		streamFieldValues[vh.Value] = uint64(len(values))
+	}
+
+	// Obtain all the field names for the given query
+	fieldNames, err := vlstorage.GetFieldNames(qctx)
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot obtain field names: %s", err)
+		return
+	}
+
+	// Obtain the number of unique values for fields with up to maxValuesPerField unique values via facets pipe
+	ca.q.AddFacetsPipe(maxValuesPerField, maxValuesPerField, 0, true)
+
+	var facetsLock sync.Mutex
+	facets := make(map[string]uint64)
+	writeBlock := func(_ uint, db *logstorage.DataBlock) {
+		cFieldName := db.GetColumnByName("field_name")
+		if cFieldName == nil {
+			return
+		}
+
+		facetsLock.Lock()
+		for _, fieldName := range cFieldName.Values {
+			n, ok := facets[fieldName]
+			if !ok {
+				fieldName = strings.Clone(fieldName)
+			}
+			facets[fieldName] = n + 1
+		}
+		facetsLock.Unlock()
+	}
+	qctxFacets := ca.newQueryContext(ctx)
+	if err := vlstorage.RunQuery(qctxFacets, writeBlock); err != nil {
+		httpserver.Errorf(w, r, "cannot execute query [%s]: %s", ca.q, err)
+		return
+	}
+
+	var durationSecs float64
+	if ca.minTimestamp != math.MinInt64 && ca.maxTimestamp > ca.minTimestamp {
+		durationSecs = float64(ca.maxTimestamp-ca.minTimestamp) / 1e9
+	}
+	sfr := newStreamFieldsReport(fieldNames, streamFieldNames, streamFieldValues, facets, rows.Load(), streams.Load(), topStreams, durationSecs, uint64(maxValuesPerField))
+
+	// Write response headers
+	h := w.Header()
+
+	h.Set("Content-Type", "application/json")
+	writeRequestDuration(h, startTime)
+	ca.writePartialResponseHeaders(h, "")
+
+	// Write results
+	WriteStreamFieldsReportJSON(w, sfr)
+}
+
+// ProcessTenantsRequest processes /select/tenants request.
+//
+// It returns tenants with logs on the optional [start, end] time range.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/#querying-tenants
+func ProcessTenantsRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	start, startStr, err := getTimeNsec(r, "start")
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	if startStr == "" {
+		start = math.MinInt64
+	}
+	end, endStr, err := getTimeNsec(r, "end")
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	if endStr == "" {
+		end = math.MaxInt64
+	} else {
+		end = logstorage.AdjustEndTimestamp(end, endStr)
+	}
+	if start > end {
+		httpserver.Errorf(w, r, "start=%s cannot exceed end=%s", startStr, endStr)
+		return
+	}
+
+	// Obtain tenants for the given time range
+	startTime := time.Now()
+	tenantIDs, err := vlstorage.GetTenantIDs(ctx, start, end)
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot obtain tenants: %s", err)
+		return
+	}
+
+	// Write response headers
+	h := w.Header()
+
+	h.Set("Content-Type", "application/json")
+	writeRequestDuration(h, startTime)
+
+	// Write results
+	WriteTenantsJSON(w, tenantIDs)
+}
+
 // ProcessLiveTailRequest processes live tailing request to /select/logsq/tail
 //
 // See https://docs.victoriametrics.com/victorialogs/querying/#live-tailing
@@ -847,7 +1065,7 @@ func ProcessStatsQueryRangeRequest(ctx context.Context, w http.ResponseWriter, r
 
 	// Execute the request.
 	startTime := time.Now()
-	if err := vlstorage.RunQuery(qctx, writeBlock); err != nil {
+	if err := runStatsQueryRange(qctx, r, ca, int64(step), m, writeBlock); err != nil {
 		err = fmt.Errorf("cannot execute query [%s]: %s", ca.q, err)
 		httpserver.SendPrometheusError(w, r, err)
 		return
@@ -871,6 +1089,7 @@ func ProcessStatsQueryRangeRequest(ctx context.Context, w http.ResponseWriter, r
 
 	h.Set("Content-Type", "application/json")
 	writeRequestDuration(h, startTime)
+	ca.writePartialResponseHeaders(h, "")
 
 	// The VL-Selected-Time-Range contains the time range specified in the query, not counting (start, end) and extra_filters
 	// It is used by the built-in web UI in order to adjust the selected time range.
@@ -966,6 +1185,7 @@ func ProcessStatsQueryRequest(ctx context.Context, w http.ResponseWriter, r *htt
 
 	h.Set("Content-Type", "application/json")
 	writeRequestDuration(h, startTime)
+	ca.writePartialResponseHeaders(h, "")
 
 	// Write response
 	WriteStatsQueryResponse(w, rows)
@@ -1002,6 +1222,29 @@ func ProcessQueryRequest(ctx context.Context, w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	// Parse format query arg
+	format := r.FormValue("format")
+	switch format {
+	case "", "jsonl", "parquet":
+	default:
+		httpserver.Errorf(w, r, "unsupported format=%q; supported values: jsonl, parquet", format)
+		return
+	}
+
+	if limit > 0 {
+		// Add '| sort by (_time) desc | offset <offset> | limit <limit>' to the end of the query.
+		// This pattern is automatically optimized during query execution - see https://github.com/VictoriaMetrics/VictoriaLogs/issues/96 .
+		if ca.q.CanReturnLastNResults() {
+			ca.q.AddPipeSortByTimeDesc()
+		}
+		ca.q.AddPipeOffsetLimit(uint64(offset), uint64(limit))
+	}
+
+	if format == "parquet" {
+		processQueryRequestParquet(ctx, w, r, ca)
+		return
+	}
+
 	sw := &syncWriter{
 		w: w,
 	}
@@ -1017,15 +1260,6 @@ func ProcessQueryRequest(ctx context.Context, w http.ResponseWriter, r *http.Req
 		}
 	}()
 
-	if limit > 0 {
-		// Add '| sort by (_time) desc | offset <offset> | limit <limit>' to the end of the query.
-		// This pattern is automatically optimized during query execution - see https://github.com/VictoriaMetrics/VictoriaLogs/issues/96 .
-		if ca.q.CanReturnLastNResults() {
-			ca.q.AddPipeSortByTimeDesc()
-		}
-		ca.q.AddPipeOffsetLimit(uint64(offset), uint64(limit))
-	}
-
 	startTime := time.Now()
 	writeResponseHeadersOnce := sync.OnceFunc(func() {
 		// Write response headers
@@ -1033,6 +1267,11 @@ func ProcessQueryRequest(ctx context.Context, w http.ResponseWriter, r *http.Req
 
 		h.Set("Content-Type", "application/stream+json")
 		writeRequestDuration(h, startTime)
+		if ca.pr != nil {
+			// The list of missing storage nodes is known only after the query is executed,
+			// while response headers may be already sent at this time. So send it in trailers.
+			h.Set("Trailer", "VL-Partial-Response, VL-Missing-Storage-Nodes")
+		}
 	})
 
 	writeBlock := func(workerID uint, db *logstorage.DataBlock) {
@@ -1063,6 +1302,154 @@ func ProcessQueryRequest(ctx context.Context, w http.ResponseWriter, r *http.Req
 
 	// This call is needed for the case when the response didn't return any results.
 	writeResponseHeadersOnce()
+
+	ca.writePartialResponseHeaders(w.Header(), http.TrailerPrefix)
+}
+
+// processQueryRequestParquet returns the results for the given ca in Parquet format.
+//
+// The results are written to w as they arrive from the storage, so the response may be large without consuming a lot of memory.
+func processQueryRequestParquet(ctx context.Context, w http.ResponseWriter, r *http.Request, ca *commonArgs) {
+	codec := parquet.CodecZstd
+	if s := r.FormValue("parquet_compression"); s != "" {
+		c, err := parquet.ParseCodec(s)
+		if err != nil {
+			httpserver.Errorf(w, r, "cannot parse parquet_compression query arg: %s", err)
+			return
+		}
+		codec = c
+	}
+
+	startTime := time.Now()
+	writeResponseHeadersOnce := sync.OnceFunc(func() {
+		// Write response headers
+		h := w.Header()
+
+		h.Set("Content-Type", "application/vnd.apache.parquet")
+		writeRequestDuration(h, startTime)
+		if ca.pr != nil {
+			h.Set("Trailer", "VL-Partial-Response, VL-Missing-Storage-Nodes")
+		}
+	})
+
+	// Parquet file cannot be written concurrently, so serialize writeBlock calls.
+	var pwLock sync.Mutex
+	pw := parquet.NewWriter(w, codec)
+
+	var fields []logstorage.Field
+	writeBlock := func(_ uint, db *logstorage.DataBlock) {
+		writeResponseHeadersOnce()
+		rowsCount := db.RowsCount()
+		if rowsCount == 0 {
+			return
+		}
+		columns := db.Columns
+
+		pwLock.Lock()
+		defer pwLock.Unlock()
+
+		for i := 0; i < rowsCount; i++ {
+			fields = fields[:0]
+			for _, c := range columns {
+				fields = append(fields, logstorage.Field{
+					Name:  c.Name,
+					Value: c.Values[i],
+				})
+			}
+			// Ignore the error, since it may be returned only when the client closes the connection.
+			_ = pw.WriteRow(fields)
+		}
+	}
+
+	qctx := ca.newQueryContext(ctx)
+	defer ca.updatePerQueryStatsMetrics()
+
+	// Execute the query
+	if err := vlstorage.RunQuery(qctx, writeBlock); err != nil {
+		httpserver.Errorf(w, r, "cannot execute query [%s]: %s", ca.q, err)
+		return
+	}
+
+	// This call is needed for the case when the response didn't return any results.
+	writeResponseHeadersOnce()
+
+	if err := pw.Close(); err != nil {
+		logger.Warnf("cannot send Parquet response to the client: %s", err)
+	}
+
+	ca.writePartialResponseHeaders(w.Header(), http.TrailerPrefix)
+}
+
+// ProcessExportNativeRequest handles /select/logsql/export_native request.
+//
+// It returns the logs matching the given query in native format, which can be ingested into VictoriaLogs via /insert/native.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/#exporting-logs-in-native-format
+func ProcessExportNativeRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ca, err := parseCommonArgs(r)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+
+	sw := &syncWriter{
+		w: w,
+	}
+
+	var bwShards atomicutil.Slice[bufferedWriter]
+	bwShards.Init = func(shard *bufferedWriter) {
+		shard.sw = sw
+	}
+	defer func() {
+		shards := bwShards.All()
+		for _, shard := range shards {
+			shard.FlushIgnoreErrors()
+		}
+	}()
+
+	startTime := time.Now()
+	writeResponseHeadersOnce := sync.OnceFunc(func() {
+		// Write response headers
+		h := w.Header()
+
+		h.Set("Content-Type", "application/octet-stream")
+		writeRequestDuration(h, startTime)
+		if ca.pr != nil {
+			h.Set("Trailer", "VL-Partial-Response, VL-Missing-Storage-Nodes")
+		}
+	})
+
+	writeBlock := func(workerID uint, db *logstorage.DataBlock) {
+		writeResponseHeadersOnce()
+		if db.RowsCount() == 0 {
+			return
+		}
+
+		// Every block is prefixed with its size, so the receiver could read blocks one by one from the response stream.
+		bb := blockResultPool.Get()
+		bb.B = db.Marshal(bb.B[:0])
+		bw := bwShards.Get(workerID)
+		bw.buf = encoding.MarshalBytes(bw.buf, bb.B)
+		blockResultPool.Put(bb)
+
+		if len(bw.buf) > 16*1024 {
+			bw.FlushIgnoreErrors()
+		}
+	}
+
+	qctx := ca.newQueryContext(ctx)
+	defer ca.updatePerQueryStatsMetrics()
+
+	// Execute the query
+	if err := vlstorage.RunQuery(qctx, writeBlock); err != nil {
+		httpserver.Errorf(w, r, "cannot execute query [%s]: %s", ca.q, err)
+		return
+	}
+
+	// This call is needed for the case when the response didn't return any results.
+	writeResponseHeadersOnce()
+
+	ca.writePartialResponseHeaders(w.Header(), http.TrailerPrefix)
 }
 
 type syncWriter struct {
@@ -1109,10 +1496,33 @@ type commonArgs struct {
 
 	// qs contains query execution statistics.
 	qs logstorage.QueryStats
+
+	// pr is set if the query may return partial response when some of storage nodes are unavailable.
+	pr *logstorage.PartialResponse
 }
 
 func (ca *commonArgs) newQueryContext(ctx context.Context) *logstorage.QueryContext {
-	return logstorage.NewQueryContext(ctx, &ca.qs, ca.tenantIDs, ca.q)
+	qctx := logstorage.NewQueryContext(ctx, &ca.qs, ca.tenantIDs, ca.q)
+	qctx.PartialResponse = ca.pr
+	return qctx
+}
+
+// writePartialResponseHeaders writes headers with the list of missing storage nodes to h if the response is partial.
+//
+// The prefix is prepended to header names. It must be set to http.TrailerPrefix if response headers were already sent.
+func (ca *commonArgs) writePartialResponseHeaders(h http.Header, prefix string) {
+	if ca.pr == nil {
+		return
+	}
+	missingNodes := ca.pr.GetMissingNodes()
+	if len(missingNodes) == 0 {
+		return
+	}
+	if prefix == "" {
+		h.Add("Access-Control-Expose-Headers", "VL-Partial-Response, VL-Missing-Storage-Nodes")
+	}
+	h.Set(prefix+"VL-Partial-Response", "true")
+	h.Set(prefix+"VL-Missing-Storage-Nodes", strings.Join(missingNodes, ","))
 }
 
 func (ca *commonArgs) updatePerQueryStatsMetrics() {
@@ -1221,6 +1631,16 @@ func parseCommonArgs(r *http.Request) (*commonArgs, error) {
 		}
 	}
 
+	// Parse optional allow_partial_response arg
+	isPartialResponseAllowed := *allowPartialResponse
+	if s := r.FormValue("allow_partial_response"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse allow_partial_response=%q: %w", s, err)
+		}
+		isPartialResponseAllowed = b
+	}
+
 	ca := &commonArgs{
 		q:         q,
 		tenantIDs: tenantIDs,
@@ -1228,6 +1648,9 @@ func parseCommonArgs(r *http.Request) (*commonArgs, error) {
 		minTimestamp: minTimestamp,
 		maxTimestamp: maxTimestamp,
 	}
+	if isPartialResponseAllowed {
+		ca.pr = &logstorage.PartialResponse{}
+	}
 	return ca, nil
 }
 
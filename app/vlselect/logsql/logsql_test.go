@@ -1,7 +1,14 @@
 package logsql
 
 import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
 	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
 )
 
 func TestParseExtraFilters_Success(t *testing.T) {
@@ -101,3 +108,142 @@ func TestParseExtraStreamFilters_Failure(t *testing.T) {
 	// excess pipe
 	f(`foo | count()`)
 }
+
+func TestParseCommonArgsAllowPartialResponse(t *testing.T) {
+	f := func(allowPartialResponseArg string, flagValue, isPartialResponseAllowedExpected bool) {
+		t.Helper()
+
+		origValue := *allowPartialResponse
+		*allowPartialResponse = flagValue
+		defer func() {
+			*allowPartialResponse = origValue
+		}()
+
+		args := url.Values{}
+		args.Set("query", "*")
+		if allowPartialResponseArg != "" {
+			args.Set("allow_partial_response", allowPartialResponseArg)
+		}
+		r := httptest.NewRequest(http.MethodGet, "/select/logsql/query?"+args.Encode(), nil)
+		ca, err := parseCommonArgs(r)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if isPartialResponseAllowed := ca.pr != nil; isPartialResponseAllowed != isPartialResponseAllowedExpected {
+			t.Fatalf("unexpected isPartialResponseAllowed; got %v; want %v", isPartialResponseAllowed, isPartialResponseAllowedExpected)
+		}
+
+		qctx := ca.newQueryContext(r.Context())
+		if qctx.PartialResponse != ca.pr {
+			t.Fatalf("PartialResponse must be passed to the query context")
+		}
+	}
+
+	// the default value from the flag
+	f("", false, false)
+	f("", true, true)
+
+	// the query arg overrides the flag
+	f("1", false, true)
+	f("true", false, true)
+	f("0", true, false)
+	f("false", true, false)
+
+	// invalid value
+	args := url.Values{}
+	args.Set("query", "*")
+	args.Set("allow_partial_response", "foo")
+	r := httptest.NewRequest(http.MethodGet, "/select/logsql/query?"+args.Encode(), nil)
+	if _, err := parseCommonArgs(r); err == nil {
+		t.Fatalf("expecting non-nil error for invalid allow_partial_response")
+	}
+}
+
+func TestWritePartialResponseHeaders(t *testing.T) {
+	f := func(pr *logstorage.PartialResponse, prefix string, headersExpected map[string][]string) {
+		t.Helper()
+
+		ca := &commonArgs{
+			pr: pr,
+		}
+		h := http.Header{}
+		ca.writePartialResponseHeaders(h, prefix)
+		headers := map[string][]string(h)
+		if len(headers) == 0 {
+			headers = nil
+		}
+		if !reflect.DeepEqual(headers, headersExpected) {
+			t.Fatalf("unexpected headers\ngot\n%v\nwant\n%v", headers, headersExpected)
+		}
+	}
+
+	newPartialResponse := func(missingNodes ...string) *logstorage.PartialResponse {
+		var pr logstorage.PartialResponse
+		for _, addr := range missingNodes {
+			pr.AddMissingNode(addr)
+		}
+		return &pr
+	}
+
+	// partial response isn't allowed
+	f(nil, "", nil)
+
+	// no missing nodes
+	f(newPartialResponse(), "", nil)
+	f(newPartialResponse(), http.TrailerPrefix, nil)
+
+	// missing nodes in headers
+	f(newPartialResponse("node-2", "node-1"), "", map[string][]string{
+		"Access-Control-Expose-Headers": {"VL-Partial-Response, VL-Missing-Storage-Nodes"},
+		"Vl-Partial-Response":           {"true"},
+		"Vl-Missing-Storage-Nodes":      {"node-1,node-2"},
+	})
+
+	// missing nodes in trailers
+	f(newPartialResponse("node-1"), http.TrailerPrefix, map[string][]string{
+		"Trailer:VL-Partial-Response":      {"true"},
+		"Trailer:VL-Missing-Storage-Nodes": {"node-1"},
+	})
+}
+
+func TestWritePartialResponseTrailers(t *testing.T) {
+	// Verify that the missing nodes are delivered to the client in trailers after the response headers are sent,
+	// in the same way as ProcessQueryRequest does.
+	pr := &logstorage.PartialResponse{}
+	ca := &commonArgs{
+		pr: pr,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Trailer", "VL-Partial-Response, VL-Missing-Storage-Nodes")
+		_, _ = w.Write([]byte("foo\n"))
+		w.(http.Flusher).Flush()
+
+		// The missing nodes are registered after the response headers are sent.
+		pr.AddMissingNode("node-1")
+		ca.writePartialResponseHeaders(w.Header(), http.TrailerPrefix)
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if v := resp.Header.Get("VL-Partial-Response"); v != "" {
+		t.Fatalf("unexpected VL-Partial-Response header: %q", v)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("cannot read response body: %s", err)
+	}
+	if string(body) != "foo\n" {
+		t.Fatalf("unexpected response body: %q", body)
+	}
+	if v := resp.Trailer.Get("VL-Partial-Response"); v != "true" {
+		t.Fatalf("unexpected VL-Partial-Response trailer; got %q; want %q", v, "true")
+	}
+	if v := resp.Trailer.Get("VL-Missing-Storage-Nodes"); v != "node-1" {
+		t.Fatalf("unexpected VL-Missing-Storage-Nodes trailer; got %q; want %q", v, "node-1")
+	}
+}
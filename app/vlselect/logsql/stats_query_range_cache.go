@@ -0,0 +1,440 @@
+package logsql
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+var (
+	disableCache = flag.Bool("search.disableCache", false, "Whether to disable the cache for /select/logsql/stats_query_range results. "+
+		"See https://docs.victoriametrics.com/victorialogs/querying/#stats-query-range-cache")
+	cacheTimestampOffset = flag.Duration("search.cacheTimestampOffset", 15*time.Minute, "The maximum duration since the current time for the results "+
+		"of /select/logsql/stats_query_range, which aren't cached. This allows the delayed logs to be visible in the query results. "+
+		"Values smaller than 15m are ignored, since the ingestion of logs older than 15m invalidates the cache. "+
+		"See https://docs.victoriametrics.com/victorialogs/querying/#stats-query-range-cache")
+	cacheMaxSize = flagutil.NewBytes("search.cacheMaxSize", 64*1024*1024, "The maximum size of the cache for /select/logsql/stats_query_range results. "+
+		"See https://docs.victoriametrics.com/victorialogs/querying/#stats-query-range-cache")
+	cacheDataPath = flag.String("cacheDataPath", "", "Optional path to the directory for storing the cache for /select/logsql/stats_query_range results "+
+		"between restarts. The cache is stored only in memory if this flag isn't set. "+
+		"See https://docs.victoriametrics.com/victorialogs/querying/#stats-query-range-cache")
+)
+
+const statsQueryRangeCacheFilename = "stats_query_range_cache.json"
+
+var statsQueryRangeCacheV *statsQueryRangeCache
+
+// Init initializes the logsql package.
+//
+// Stop must be called when the package is no longer needed.
+func Init() {
+	statsQueryRangeCacheV = newStatsQueryRangeCache(cacheMaxSize.IntN())
+	if *cacheDataPath == "" {
+		return
+	}
+	path := filepath.Join(*cacheDataPath, statsQueryRangeCacheFilename)
+	if err := statsQueryRangeCacheV.load(path); err != nil {
+		logger.Warnf("cannot load cache for stats_query_range results from %q: %s; starting with empty cache", path, err)
+		statsQueryRangeCacheV.reset()
+	}
+}
+
+// Stop stops the logsql package.
+func Stop() {
+	if *cacheDataPath == "" {
+		return
+	}
+	path := filepath.Join(*cacheDataPath, statsQueryRangeCacheFilename)
+	statsQueryRangeCacheV.mustSave(path)
+}
+
+// ResetStatsQueryRangeCache resets the cache for /select/logsql/stats_query_range results.
+func ResetStatsQueryRangeCache() {
+	statsQueryRangeCacheV.reset()
+}
+
+// runStatsQueryRange executes the query from qctx prepared for stats_query_range with the given step and passes the results to writeBlock.
+//
+// The results for the time buckets found in the cache are added to m instead of executing the query for them,
+// while the results for the remaining time range are obtained from the storage and are added to the cache.
+func runStatsQueryRange(qctx *logstorage.QueryContext, r *http.Request, ca *commonArgs, step int64, m map[string]*statsSeries, writeBlock logstorage.WriteDataBlockFunc) error {
+	if *disableCache || !ca.q.CanCacheStatsByTimeBuckets() {
+		return vlstorage.RunQuery(qctx, writeBlock)
+	}
+
+	start, end := ca.q.GetFilterTimeRange()
+	if start == math.MinInt64 || end == math.MaxInt64 {
+		return vlstorage.RunQuery(qctx, writeBlock)
+	}
+
+	// Cache only the time buckets, which are fully covered by [start, end] and which are older than -search.cacheTimestampOffset.
+	// Logs older than logstorage.MaxIngestionDelay change the data set version when they are ingested, so the cached buckets for them are invalidated.
+	// Newer logs do not change the data set version, so the buckets for them mustn't be cached.
+	maxCacheTimestamp := time.Now().UnixNano() - max(cacheTimestampOffset.Nanoseconds(), logstorage.MaxIngestionDelay.Nanoseconds())
+	cacheStart := -floorDiv(-start, step) * step
+	cacheEnd := floorDiv(min(end, maxCacheTimestamp)+1, step) * step
+	if cacheStart >= cacheEnd {
+		return vlstorage.RunQuery(qctx, writeBlock)
+	}
+
+	key, err := getStatsQueryRangeCacheKey(r, ca, step)
+	if err != nil {
+		return err
+	}
+
+	dataSetVersion, err := vlstorage.GetDataSetVersion(qctx.Context)
+	if err != nil {
+		// Cannot verify whether the cached results are up to date, so do not use the cache.
+		logger.Warnf("cannot obtain data set version; executing the query without cache: %s", err)
+		return vlstorage.RunQuery(qctx, writeBlock)
+	}
+	cachedEnd := statsQueryRangeCacheV.get(m, key, dataSetVersion, cacheStart, cacheEnd)
+	if cachedEnd <= cacheStart {
+		// Cache miss - execute the query over the whole time range.
+		if err := vlstorage.RunQuery(qctx, writeBlock); err != nil {
+			return err
+		}
+	} else {
+		// Execute the query only over the time ranges, which are missing in the cache.
+		if start < cacheStart {
+			if err := runStatsQueryRangeForTimeRange(qctx, step, start, cacheStart-1, writeBlock); err != nil {
+				return err
+			}
+		}
+		if cachedEnd <= end {
+			if err := runStatsQueryRangeForTimeRange(qctx, step, cachedEnd, end, writeBlock); err != nil {
+				return err
+			}
+		}
+	}
+
+	if ca.pr != nil && len(ca.pr.GetMissingNodes()) > 0 {
+		// Do not cache partial results.
+		return nil
+	}
+	statsQueryRangeCacheV.put(m, key, dataSetVersion, cacheStart, cacheEnd)
+	return nil
+}
+
+func runStatsQueryRangeForTimeRange(qctx *logstorage.QueryContext, step, start, end int64, writeBlock logstorage.WriteDataBlockFunc) error {
+	q := qctx.Query.CloneWithTimeFilter(qctx.Query.GetTimestamp(), start, end)
+
+	// Re-initialize rate functions with the step, since they were initialized with the time range at the CloneWithTimeFilter() call.
+	if _, err := q.GetStatsByFieldsAddGroupingByTime(step); err != nil {
+		logger.Panicf("BUG: cannot prepare the query [%s] for stats_query_range: %s", q, err)
+	}
+
+	qctxLocal := qctx.WithQuery(q)
+	return vlstorage.RunQuery(qctxLocal, writeBlock)
+}
+
+func getStatsQueryRangeCacheKey(r *http.Request, ca *commonArgs, step int64) (string, error) {
+	// Normalize the query, so semantically identical queries share the same cache entry.
+	qStr := r.FormValue("query")
+	q, err := logstorage.ParseQuery(qStr)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse query [%s]: %s", qStr, err)
+	}
+
+	var b []byte
+	for _, tenantID := range ca.tenantIDs {
+		b = fmt.Appendf(b, "%d:%d,", tenantID.AccountID, tenantID.ProjectID)
+	}
+	b = fmt.Appendf(b, "\nstep=%d\nquery=%s", step, q)
+	for _, s := range r.Form["extra_filters"] {
+		b = fmt.Appendf(b, "\nextra_filters=%s", s)
+	}
+	for _, s := range r.Form["extra_stream_filters"] {
+		b = fmt.Appendf(b, "\nextra_stream_filters=%s", s)
+	}
+	return string(b), nil
+}
+
+func floorDiv(a, b int64) int64 {
+	n := a / b
+	if a%b < 0 {
+		n--
+	}
+	return n
+}
+
+// statsQueryRangeCache caches the results of /select/logsql/stats_query_range per every `_time` bucket.
+type statsQueryRangeCache struct {
+	mu sync.Mutex
+
+	// maxSizeBytes is the maximum size of the cached entries.
+	maxSizeBytes int
+
+	// sizeBytes is the current size of the cached entries.
+	sizeBytes int
+
+	// dataSetVersion is the version of the stored logs at vlstorage, which were used for building the cached entries.
+	//
+	// The cached entries are ignored when the version changes, e.g. when partitions are attached or detached.
+	// See vlstorage.GetDataSetVersion.
+	dataSetVersion uint64
+
+	m map[string]*statsQueryRangeCacheEntry
+}
+
+// statsQueryRangeCacheEntry contains the cached results for the [Start, End) time range.
+//
+// Start and End are aligned to the step of the query.
+type statsQueryRangeCacheEntry struct {
+	Start  int64
+	End    int64
+	Series []*statsQueryRangeCacheSeries
+
+	sizeBytes      int
+	lastAccessTime uint64
+}
+
+type statsQueryRangeCacheSeries struct {
+	Key    string
+	Name   string
+	Labels []logstorage.Field
+	Points []statsPoint
+}
+
+func newStatsQueryRangeCache(maxSizeBytes int) *statsQueryRangeCache {
+	return &statsQueryRangeCache{
+		maxSizeBytes: maxSizeBytes,
+		m:            make(map[string]*statsQueryRangeCacheEntry),
+	}
+}
+
+func (c *statsQueryRangeCache) reset() {
+	c.mu.Lock()
+	c.m = make(map[string]*statsQueryRangeCacheEntry)
+	c.sizeBytes = 0
+	c.mu.Unlock()
+}
+
+// get adds the cached results for the given key to m.
+//
+// It returns the end of the time range starting at start, which is covered by the results added to m.
+// The returned value doesn't exceed end. It is smaller or equal to start if the results for start are missing in the cache.
+func (c *statsQueryRangeCache) get(m map[string]*statsSeries, key string, dataSetVersion uint64, start, end int64) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := c.m[key]
+	if c.dataSetVersion != dataSetVersion || e == nil || e.Start > start || e.End <= start {
+		statsQueryRangeCacheMisses.Inc()
+		return start
+	}
+	statsQueryRangeCacheHits.Inc()
+	e.lastAccessTime = uint64(time.Now().Unix())
+
+	cachedEnd := min(e.End, end)
+	for _, ces := range e.Series {
+		var points []statsPoint
+		for _, p := range ces.Points {
+			if p.Timestamp >= start && p.Timestamp < cachedEnd {
+				points = append(points, p)
+			}
+		}
+		if len(points) == 0 {
+			continue
+		}
+		m[ces.Key] = &statsSeries{
+			key:    ces.Key,
+			Name:   ces.Name,
+			Labels: ces.Labels,
+			Points: points,
+		}
+	}
+	return cachedEnd
+}
+
+// put stores the results from m for the [start, end) time range under the given key.
+func (c *statsQueryRangeCache) put(m map[string]*statsSeries, key string, dataSetVersion uint64, start, end int64) {
+	e := &statsQueryRangeCacheEntry{
+		Start:          start,
+		End:            end,
+		lastAccessTime: uint64(time.Now().Unix()),
+	}
+	for _, ss := range m {
+		var points []statsPoint
+		for _, p := range ss.Points {
+			if p.Timestamp >= start && p.Timestamp < end {
+				points = append(points, p)
+			}
+		}
+		if len(points) == 0 {
+			continue
+		}
+		e.Series = append(e.Series, &statsQueryRangeCacheSeries{
+			Key:    ss.key,
+			Name:   ss.Name,
+			Labels: ss.Labels,
+			Points: points,
+		})
+	}
+	e.sizeBytes = e.getSizeBytes(key)
+	if e.sizeBytes > c.maxSizeBytes/16 {
+		// Do not cache too big results, since they may evict many smaller results.
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if dataSetVersion != c.dataSetVersion {
+		// The set of stored logs has been changed. Drop all the cached results obtained from the previous set.
+		//
+		// Versions aren't ordered, so this may also drop the results for the newer set if the query
+		// for the older set finishes later. This is OK, since the cache is re-populated by the next queries.
+		c.m = make(map[string]*statsQueryRangeCacheEntry)
+		c.sizeBytes = 0
+		c.dataSetVersion = dataSetVersion
+	}
+
+	if eOld := c.m[key]; eOld != nil {
+		c.sizeBytes -= eOld.sizeBytes
+	}
+	c.m[key] = e
+	c.sizeBytes += e.sizeBytes
+
+	c.evictOldEntriesLocked()
+}
+
+// evictOldEntriesLocked removes the least recently accessed entries from c until its size becomes smaller than c.maxSizeBytes.
+func (c *statsQueryRangeCache) evictOldEntriesLocked() {
+	if c.sizeBytes <= c.maxSizeBytes {
+		return
+	}
+
+	keys := make([]string, 0, len(c.m))
+	for k := range c.m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.m[keys[i]].lastAccessTime < c.m[keys[j]].lastAccessTime
+	})
+
+	// Free up to 10% of the cache in order to avoid frequent evictions.
+	maxSizeBytes := c.maxSizeBytes - c.maxSizeBytes/10
+	for _, k := range keys {
+		if c.sizeBytes <= maxSizeBytes {
+			break
+		}
+		c.sizeBytes -= c.m[k].sizeBytes
+		delete(c.m, k)
+	}
+}
+
+func (e *statsQueryRangeCacheEntry) getSizeBytes(key string) int {
+	n := len(key) + 64
+	for _, ces := range e.Series {
+		n += len(ces.Key) + len(ces.Name) + 64
+		for _, f := range ces.Labels {
+			n += len(f.Name) + len(f.Value) + 32
+		}
+		for _, p := range ces.Points {
+			n += len(p.Value) + 24
+		}
+	}
+	return n
+}
+
+// statsQueryRangeCacheData is the representation of statsQueryRangeCache persisted at -cacheDataPath.
+type statsQueryRangeCacheData struct {
+	DataSetVersion uint64
+	Entries        map[string]*statsQueryRangeCacheEntry
+}
+
+// load loads c contents from the file at the given path.
+func (c *statsQueryRangeCache) load(path string) error {
+	if !fs.IsPathExist(path) {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var cd statsQueryRangeCacheData
+	if err := json.Unmarshal(data, &cd); err != nil {
+		return fmt.Errorf("cannot unmarshal cache data: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Keep the version the entries were obtained for, so they are ignored if the stored logs have been changed since then.
+	c.dataSetVersion = cd.DataSetVersion
+	currentTime := uint64(time.Now().Unix())
+	for k, e := range cd.Entries {
+		e.sizeBytes = e.getSizeBytes(k)
+		e.lastAccessTime = currentTime
+		c.m[k] = e
+		c.sizeBytes += e.sizeBytes
+	}
+	c.evictOldEntriesLocked()
+
+	logger.Infof("loaded %d entries from the cache for stats_query_range results at %q", len(c.m), path)
+	return nil
+}
+
+// mustSave saves c contents to the file at the given path.
+func (c *statsQueryRangeCache) mustSave(path string) {
+	c.mu.Lock()
+	cd := &statsQueryRangeCacheData{
+		DataSetVersion: c.dataSetVersion,
+		Entries:        c.m,
+	}
+	data, err := json.Marshal(cd)
+	entriesCount := len(c.m)
+	c.mu.Unlock()
+
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal the cache for stats_query_range results: %s", err)
+	}
+
+	fs.MustMkdirIfNotExist(filepath.Dir(path))
+	fs.MustWriteAtomic(path, data, true)
+
+	logger.Infof("saved %d entries from the cache for stats_query_range results to %q", entriesCount, path)
+}
+
+var (
+	statsQueryRangeCacheHits   = metrics.NewCounter(`vl_stats_query_range_cache_requests_total{result="hit"}`)
+	statsQueryRangeCacheMisses = metrics.NewCounter(`vl_stats_query_range_cache_requests_total{result="miss"}`)
+
+	_ = metrics.NewGauge(`vl_stats_query_range_cache_size_bytes`, func() float64 {
+		c := statsQueryRangeCacheV
+		if c == nil {
+			return 0
+		}
+		c.mu.Lock()
+		n := c.sizeBytes
+		c.mu.Unlock()
+		return float64(n)
+	})
+	_ = metrics.NewGauge(`vl_stats_query_range_cache_entries`, func() float64 {
+		c := statsQueryRangeCacheV
+		if c == nil {
+			return 0
+		}
+		c.mu.Lock()
+		n := len(c.m)
+		c.mu.Unlock()
+		return float64(n)
+	})
+)
@@ -0,0 +1,159 @@
+package logsql
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestStatsQueryRangeCache(t *testing.T) {
+	newSeries := func(key string, timestamps ...int64) *statsSeries {
+		points := make([]statsPoint, len(timestamps))
+		for i, ts := range timestamps {
+			points[i] = statsPoint{
+				Timestamp: ts,
+				Value:     "1",
+			}
+		}
+		return &statsSeries{
+			key:    key,
+			Name:   key,
+			Labels: []logstorage.Field{{Name: "host", Value: "foo"}},
+			Points: points,
+		}
+	}
+	getTimestamps := func(m map[string]*statsSeries) map[string][]int64 {
+		result := make(map[string][]int64)
+		for k, ss := range m {
+			for _, p := range ss.Points {
+				result[k] = append(result[k], p.Timestamp)
+			}
+		}
+		return result
+	}
+
+	c := newStatsQueryRangeCache(1024 * 1024)
+
+	// Empty cache
+	m := make(map[string]*statsSeries)
+	if n := c.get(m, "key", 0, 10, 50); n != 10 {
+		t.Fatalf("unexpected cached end for empty cache; got %d; want 10", n)
+	}
+	if len(m) != 0 {
+		t.Fatalf("unexpected results for empty cache: %v", getTimestamps(m))
+	}
+
+	// Only the points inside [start, end) must be cached
+	m = map[string]*statsSeries{
+		"a": newSeries("a", 5, 10, 20, 30, 40),
+		"b": newSeries("b", 50),
+	}
+	c.put(m, "key", 0, 10, 40)
+
+	m = make(map[string]*statsSeries)
+	if n := c.get(m, "key", 0, 20, 60); n != 40 {
+		t.Fatalf("unexpected cached end; got %d; want 40", n)
+	}
+	resultExpected := map[string][]int64{
+		"a": {20, 30},
+	}
+	if result := getTimestamps(m); !reflect.DeepEqual(result, resultExpected) {
+		t.Fatalf("unexpected cached results; got %v; want %v", result, resultExpected)
+	}
+
+	// The cached end mustn't exceed the requested end
+	m = make(map[string]*statsSeries)
+	if n := c.get(m, "key", 0, 10, 20); n != 20 {
+		t.Fatalf("unexpected cached end; got %d; want 20", n)
+	}
+	resultExpected = map[string][]int64{
+		"a": {10},
+	}
+	if result := getTimestamps(m); !reflect.DeepEqual(result, resultExpected) {
+		t.Fatalf("unexpected cached results; got %v; want %v", result, resultExpected)
+	}
+
+	// Time ranges starting outside the cached entry must be missing
+	m = make(map[string]*statsSeries)
+	if n := c.get(m, "key", 0, 0, 40); n != 0 {
+		t.Fatalf("unexpected cached end; got %d; want 0", n)
+	}
+	if n := c.get(m, "key", 0, 40, 60); n != 40 {
+		t.Fatalf("unexpected cached end; got %d; want 40", n)
+	}
+	if n := c.get(m, "other_key", 0, 10, 40); n != 10 {
+		t.Fatalf("unexpected cached end; got %d; want 10", n)
+	}
+	if len(m) != 0 {
+		t.Fatalf("unexpected results: %v", getTimestamps(m))
+	}
+
+	// The results must be saved and loaded
+	path := filepath.Join(t.TempDir(), statsQueryRangeCacheFilename)
+	c.mustSave(path)
+	cLoaded := newStatsQueryRangeCache(1024 * 1024)
+	if err := cLoaded.load(path); err != nil {
+		t.Fatalf("cannot load cache: %s", err)
+	}
+	m = make(map[string]*statsSeries)
+	if n := cLoaded.get(m, "key", 0, 10, 40); n != 40 {
+		t.Fatalf("unexpected cached end after load; got %d; want 40", n)
+	}
+	resultExpected = map[string][]int64{
+		"a": {10, 20, 30},
+	}
+	if result := getTimestamps(m); !reflect.DeepEqual(result, resultExpected) {
+		t.Fatalf("unexpected cached results after load; got %v; want %v", result, resultExpected)
+	}
+
+	// The loaded results must be ignored if the data set has been changed since they were saved
+	m = make(map[string]*statsSeries)
+	if n := cLoaded.get(m, "key", 1, 10, 40); n != 10 {
+		t.Fatalf("unexpected cached end after load for changed data set; got %d; want 10", n)
+	}
+	if len(m) != 0 {
+		t.Fatalf("unexpected results after load for changed data set: %v", getTimestamps(m))
+	}
+
+	// The results obtained from another data set mustn't be returned
+	c.put(map[string]*statsSeries{"a": newSeries("a", 10)}, "key", 1, 10, 20)
+	c.put(map[string]*statsSeries{"a": newSeries("a", 30)}, "other_key", 0, 30, 40)
+	m = make(map[string]*statsSeries)
+	if n := c.get(m, "other_key", 1, 30, 40); n != 30 {
+		t.Fatalf("unexpected cached end for results from another data set; got %d; want 30", n)
+	}
+	if n := c.get(m, "key", 0, 10, 20); n != 10 {
+		t.Fatalf("unexpected cached end for results from another data set; got %d; want 10", n)
+	}
+
+	// The results must be invalidated after the data set change
+	if n := c.get(m, "key", 2, 10, 20); n != 10 {
+		t.Fatalf("unexpected cached end after data set change; got %d; want 10", n)
+	}
+	if len(m) != 0 {
+		t.Fatalf("unexpected results: %v", getTimestamps(m))
+	}
+}
+
+func TestStatsQueryRangeCacheEviction(t *testing.T) {
+	c := newStatsQueryRangeCache(16 * 1024)
+
+	m := map[string]*statsSeries{
+		"a": {
+			key:    "a",
+			Name:   "a",
+			Points: []statsPoint{{Timestamp: 10, Value: "1"}},
+		},
+	}
+	for i := 0; i < 1000; i++ {
+		c.put(m, string(rune('a'+i%26))+string(rune('a'+i/26)), 0, 10, 20)
+		if c.sizeBytes > c.maxSizeBytes {
+			t.Fatalf("cache size exceeds the limit; got %d bytes; want up to %d bytes", c.sizeBytes, c.maxSizeBytes)
+		}
+	}
+	if len(c.m) == 0 {
+		t.Fatalf("the cache mustn't be empty")
+	}
+}
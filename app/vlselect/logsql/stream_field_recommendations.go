@@ -0,0 +1,180 @@
+package logsql
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+const (
+	// streamFieldRecommendationKeep means the stream field is OK.
+	streamFieldRecommendationKeep = "keep"
+
+	// streamFieldRecommendationRemove means the field must be removed from stream fields.
+	streamFieldRecommendationRemove = "remove"
+
+	// streamFieldRecommendationAdd means the field is a good candidate for stream fields.
+	streamFieldRecommendationAdd = "add"
+
+	// streamFieldRecommendationSkip means the field shouldn't be added to stream fields.
+	streamFieldRecommendationSkip = "skip"
+)
+
+// minStreamFieldCandidatePresence is the minimum share of logs with the given field, which is needed for recommending it as a stream field.
+const minStreamFieldCandidatePresence = 0.9
+
+// streamFieldsReport contains the cardinality stats for log fields and recommendations on stream fields.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/#querying-stream-field-recommendations
+type streamFieldsReport struct {
+	// rows is the number of logs on the selected time range.
+	rows uint64
+
+	// streams is the number of log streams on the selected time range.
+	streams uint64
+
+	// topStreams contains log streams with the biggest number of logs per second on the selected time range.
+	topStreams []streamRate
+
+	// fields contains per-field stats sorted by field name.
+	fields []streamFieldStats
+}
+
+// streamRate contains the ingestion rate for a single log stream.
+type streamRate struct {
+	// stream is the _stream field value.
+	stream string
+
+	// hits is the number of logs for the stream on the selected time range.
+	hits uint64
+
+	// rowsPerSecond is the average number of logs per second for the stream on the selected time range.
+	rowsPerSecond float64
+}
+
+// streamFieldStats contains cardinality stats and recommendation for a single log field.
+type streamFieldStats struct {
+	// name is the field name.
+	name string
+
+	// isStreamField is set if the field is a stream field.
+	isStreamField bool
+
+	// hits is the number of logs with the field.
+	hits uint64
+
+	// uniqueValues is the number of unique values for the field.
+	//
+	// It is capped by maxValuesPerField if uniqueValuesExceeded is set.
+	uniqueValues uint64
+
+	// uniqueValuesExceeded is set if the field has more than maxValuesPerField unique values.
+	uniqueValuesExceeded bool
+
+	// recommendation is one of streamFieldRecommendation* values.
+	recommendation string
+
+	// reason is a human-readable explanation for the recommendation.
+	reason string
+}
+
+// newStreamFieldsReport returns streamFieldsReport for the given stats.
+//
+// fieldNames and streamFieldNames contain the names of all the fields and stream fields with the number of logs containing them.
+// streamFieldValues contains the number of unique values per each stream field, while facets contains the number of unique values
+// per each field with up to maxValuesPerField unique values.
+// rows and streams are the number of logs and log streams, while topStreams contains log streams with the biggest number of logs.
+// durationSecs is the duration of the selected time range.
+func newStreamFieldsReport(fieldNames, streamFieldNames []logstorage.ValueWithHits, streamFieldValues, facets map[string]uint64,
+	rows, streams uint64, topStreams []logstorage.ValueWithHits, durationSecs float64, maxValuesPerField uint64) *streamFieldsReport {
+
+	sfr := &streamFieldsReport{
+		rows:    rows,
+		streams: streams,
+	}
+
+	for _, vh := range topStreams {
+		sr := streamRate{
+			stream: vh.Value,
+			hits:   vh.Hits,
+		}
+		if durationSecs > 0 {
+			sr.rowsPerSecond = float64(vh.Hits) / durationSecs
+		}
+		sfr.topStreams = append(sfr.topStreams, sr)
+	}
+	sort.SliceStable(sfr.topStreams, func(i, j int) bool {
+		return sfr.topStreams[i].hits > sfr.topStreams[j].hits
+	})
+
+	isStreamField := make(map[string]bool, len(streamFieldNames))
+	for _, vh := range streamFieldNames {
+		isStreamField[vh.Value] = true
+
+		n := streamFieldValues[vh.Value]
+		fs := streamFieldStats{
+			name:          vh.Value,
+			isStreamField: true,
+			hits:          vh.Hits,
+			uniqueValues:  n,
+		}
+		if n > maxValuesPerField {
+			fs.uniqueValues = maxValuesPerField
+			fs.uniqueValuesExceeded = true
+			fs.recommendation = streamFieldRecommendationRemove
+			fs.reason = fmt.Sprintf("the stream field has more than %d unique values; this results in high number of log streams; "+
+				"see https://docs.victoriametrics.com/victorialogs/keyconcepts/#high-cardinality", maxValuesPerField)
+		} else {
+			fs.recommendation = streamFieldRecommendationKeep
+			fs.reason = fmt.Sprintf("the stream field has %d unique values", n)
+		}
+		sfr.fields = append(sfr.fields, fs)
+	}
+
+	for _, vh := range fieldNames {
+		if isStreamField[vh.Value] || isSpecialFieldName(vh.Value) {
+			continue
+		}
+
+		n, ok := facets[vh.Value]
+		fs := streamFieldStats{
+			name:         vh.Value,
+			hits:         vh.Hits,
+			uniqueValues: n,
+		}
+		switch {
+		case !ok:
+			fs.uniqueValues = maxValuesPerField
+			fs.uniqueValuesExceeded = true
+			fs.recommendation = streamFieldRecommendationSkip
+			fs.reason = fmt.Sprintf("the field has more than %d unique values or too long values; it mustn't be used as a stream field", maxValuesPerField)
+		case n <= 1:
+			fs.recommendation = streamFieldRecommendationSkip
+			fs.reason = "the field has a constant value, so it doesn't help distinguishing log streams"
+		case rows == 0 || float64(vh.Hits)/float64(rows) < minStreamFieldCandidatePresence:
+			fs.recommendation = streamFieldRecommendationSkip
+			fs.reason = fmt.Sprintf("the field is missing in more than %.0f%% of logs", 100*(1-minStreamFieldCandidatePresence))
+		default:
+			fs.recommendation = streamFieldRecommendationAdd
+			fs.reason = fmt.Sprintf("the field has %d unique values and it is present in the majority of logs; "+
+				"it may be used as a stream field if it identifies the application instance, which generated the logs", n)
+		}
+		sfr.fields = append(sfr.fields, fs)
+	}
+
+	sort.Slice(sfr.fields, func(i, j int) bool {
+		return sfr.fields[i].name < sfr.fields[j].name
+	})
+
+	return sfr
+}
+
+func isSpecialFieldName(name string) bool {
+	switch name {
+	case "_time", "_msg", "_stream", "_stream_id":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,88 @@
+package logsql
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestNewStreamFieldsReport(t *testing.T) {
+	fieldNames := []logstorage.ValueWithHits{
+		{Value: "_msg", Hits: 100},
+		{Value: "_stream", Hits: 100},
+		{Value: "_time", Hits: 100},
+		{Value: "app", Hits: 100},
+		{Value: "env", Hits: 100},
+		{Value: "host", Hits: 100},
+		{Value: "level", Hits: 50},
+		{Value: "trace_id", Hits: 100},
+		{Value: "user_id", Hits: 100},
+	}
+	streamFieldNames := []logstorage.ValueWithHits{
+		{Value: "app", Hits: 100},
+		{Value: "user_id", Hits: 100},
+	}
+	streamFieldValues := map[string]uint64{
+		"app":     2,
+		"user_id": 11,
+	}
+	facets := map[string]uint64{
+		"app":   2,
+		"env":   1,
+		"host":  3,
+		"level": 4,
+	}
+	topStreams := []logstorage.ValueWithHits{
+		{Value: `{app="b",user_id="2"}`, Hits: 30},
+		{Value: `{app="a",user_id="1"}`, Hits: 60},
+	}
+
+	sfr := newStreamFieldsReport(fieldNames, streamFieldNames, streamFieldValues, facets, 100, 3, topStreams, 10, 10)
+
+	if sfr.rows != 100 {
+		t.Fatalf("unexpected rows; got %d; want 100", sfr.rows)
+	}
+	if sfr.streams != 3 {
+		t.Fatalf("unexpected streams; got %d; want 3", sfr.streams)
+	}
+	topStreamsExpected := []streamRate{
+		{stream: `{app="a",user_id="1"}`, hits: 60, rowsPerSecond: 6},
+		{stream: `{app="b",user_id="2"}`, hits: 30, rowsPerSecond: 3},
+	}
+	if !reflect.DeepEqual(sfr.topStreams, topStreamsExpected) {
+		t.Fatalf("unexpected topStreams\ngot\n%+v\nwant\n%+v", sfr.topStreams, topStreamsExpected)
+	}
+
+	type result struct {
+		isStreamField        bool
+		uniqueValues         uint64
+		uniqueValuesExceeded bool
+		recommendation       string
+	}
+	resultsExpected := map[string]result{
+		"app":      {true, 2, false, streamFieldRecommendationKeep},
+		"env":      {false, 1, false, streamFieldRecommendationSkip},
+		"host":     {false, 3, false, streamFieldRecommendationAdd},
+		"level":    {false, 4, false, streamFieldRecommendationSkip},
+		"trace_id": {false, 10, true, streamFieldRecommendationSkip},
+		"user_id":  {true, 10, true, streamFieldRecommendationRemove},
+	}
+	if len(sfr.fields) != len(resultsExpected) {
+		t.Fatalf("unexpected number of fields; got %d; want %d", len(sfr.fields), len(resultsExpected))
+	}
+	for i, fs := range sfr.fields {
+		if i > 0 && sfr.fields[i-1].name >= fs.name {
+			t.Fatalf("fields must be sorted by name; got %q after %q", fs.name, sfr.fields[i-1].name)
+		}
+		r := result{
+			isStreamField:        fs.isStreamField,
+			uniqueValues:         fs.uniqueValues,
+			uniqueValuesExceeded: fs.uniqueValuesExceeded,
+			recommendation:       fs.recommendation,
+		}
+		if r != resultsExpected[fs.name] {
+			t.Fatalf("unexpected result for field %q\ngot\n%+v\nwant\n%+v", fs.name, r, resultsExpected[fs.name])
+		}
+	}
+}
@@ -0,0 +1,863 @@
+package loki
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timeutil"
+)
+
+// logqlExpr is a parsed LogQL query.
+//
+// See https://grafana.com/docs/loki/latest/query/
+type logqlExpr struct {
+	// sel is the log stream selector with optional pipeline.
+	sel *logSelector
+
+	// rangeFunc is the name of the range aggregation function such as count_over_time or rate.
+	//
+	// It is empty for log queries.
+	rangeFunc string
+
+	// rangeNsecs is the lookbehind window in nanoseconds for rangeFunc.
+	rangeNsecs int64
+
+	// aggrFunc is an optional aggregation function such as sum or max, which is applied to rangeFunc results.
+	aggrFunc string
+
+	// aggrBy contains labels from `by (...)` clause of aggrFunc.
+	aggrBy []string
+}
+
+// isMetric returns true if e is LogQL metric query.
+func (e *logqlExpr) isMetric() bool {
+	return e.rangeFunc != ""
+}
+
+// canPushDownAggr returns true if aggrFunc results can be calculated directly by LogsQL stats grouped by aggrBy labels.
+func (e *logqlExpr) canPushDownAggr() bool {
+	if e.aggrFunc != "sum" {
+		return false
+	}
+	switch e.rangeFunc {
+	case "count_over_time", "rate", "bytes_over_time", "bytes_rate", "sum_over_time":
+		return true
+	default:
+		return false
+	}
+}
+
+// getStatsByFields returns fields for grouping LogsQL stats results for e.
+func (e *logqlExpr) getStatsByFields() []string {
+	if e.aggrFunc == "" {
+		return []string{"_stream"}
+	}
+	if e.canPushDownAggr() {
+		return e.aggrBy
+	}
+	return append([]string{"_stream"}, e.aggrBy...)
+}
+
+const (
+	// valueFieldName is the name of LogsQL stats result with the value for the given bucket.
+	valueFieldName = "__value__"
+
+	// countFieldName is the name of LogsQL stats result with the number of values for the given bucket.
+	//
+	// It is used for calculating avg_over_time.
+	countFieldName = "__count__"
+)
+
+// metricQueryString returns LogsQL query string, which calculates per-bucket stats needed for evaluating e.
+//
+// Buckets have bucketNsecs duration and start at offsetNsecs.
+func (e *logqlExpr) metricQueryString(bucketNsecs, offsetNsecs int64) string {
+	var funcs string
+	unwrap := strconv.Quote(e.sel.unwrap)
+	switch e.rangeFunc {
+	case "count_over_time":
+		funcs = "count()"
+	case "rate":
+		if e.sel.unwrap != "" {
+			funcs = "sum(" + unwrap + ")"
+		} else {
+			funcs = "count()"
+		}
+	case "bytes_over_time", "bytes_rate":
+		funcs = "sum_len(_msg)"
+	case "sum_over_time":
+		funcs = "sum(" + unwrap + ")"
+	case "min_over_time":
+		funcs = "min(" + unwrap + ")"
+	case "max_over_time":
+		funcs = "max(" + unwrap + ")"
+	case "avg_over_time":
+		funcs = "sum(" + unwrap + ") as " + valueFieldName + ", count(" + unwrap + ") as " + countFieldName
+	default:
+		panic(fmt.Errorf("BUG: unexpected range function %q", e.rangeFunc))
+	}
+	if e.rangeFunc != "avg_over_time" {
+		funcs += " as " + valueFieldName
+	}
+
+	byFields := []string{fmt.Sprintf("_time:%dns offset %dns", bucketNsecs, offsetNsecs)}
+	for _, f := range e.getStatsByFields() {
+		byFields = append(byFields, quoteFieldName(f))
+	}
+
+	return e.sel.String() + " | stats by (" + strings.Join(byFields, ", ") + ") " + funcs
+}
+
+// logSelector is a parsed LogQL log stream selector with optional pipeline.
+type logSelector struct {
+	// streamFilter is LogsQL stream filter generated from the LogQL stream selector.
+	streamFilter string
+
+	// filters contains LogsQL filters generated from LogQL line filters, which are located in front of other pipeline stages.
+	filters []string
+
+	// pipes contains LogsQL pipes generated from the rest of LogQL pipeline stages.
+	pipes []string
+
+	// unwrap is the field name from `| unwrap` stage.
+	unwrap string
+}
+
+// String returns LogsQL representation of ls.
+func (ls *logSelector) String() string {
+	a := append([]string{ls.streamFilter}, ls.filters...)
+	s := strings.Join(a, " ")
+	for _, p := range ls.pipes {
+		s += " | " + p
+	}
+	return s
+}
+
+func (ls *logSelector) addFilter(f string) {
+	if len(ls.pipes) == 0 && ls.unwrap == "" {
+		ls.filters = append(ls.filters, f)
+	} else {
+		ls.pipes = append(ls.pipes, "filter "+f)
+	}
+}
+
+var rangeFuncs = map[string]bool{
+	"count_over_time": false,
+	"rate":            false,
+	"bytes_over_time": false,
+	"bytes_rate":      false,
+	"sum_over_time":   true,
+	"avg_over_time":   true,
+	"min_over_time":   true,
+	"max_over_time":   true,
+}
+
+var aggrFuncs = map[string]bool{
+	"sum":   true,
+	"min":   true,
+	"max":   true,
+	"avg":   true,
+	"count": true,
+}
+
+// parseLogQL parses a practical subset of LogQL from s.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/loki/ for the list of supported features.
+func parseLogQL(s string) (*logqlExpr, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{
+		tokens: tokens,
+	}
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %s after the end of query", t)
+	}
+	return e, nil
+}
+
+// parseLogQLSelector parses LogQL log stream selector with optional pipeline from s.
+func parseLogQLSelector(s string) (*logSelector, error) {
+	e, err := parseLogQL(s)
+	if err != nil {
+		return nil, err
+	}
+	if e.isMetric() {
+		return nil, fmt.Errorf("expecting log stream selector instead of metric query")
+	}
+	return e.sel, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.peekAt(0)
+}
+
+func (p *parser) peekAt(n int) token {
+	if p.pos+n >= len(p.tokens) {
+		return token{
+			kind: tokenEOF,
+		}
+	}
+	return p.tokens[p.pos+n]
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isPunct(s string) bool {
+	t := p.peek()
+	return t.kind == tokenPunct && t.s == s
+}
+
+func (p *parser) isIdent(s string) bool {
+	t := p.peek()
+	return t.kind == tokenIdent && t.s == s
+}
+
+func (p *parser) expectPunct(s string) error {
+	if !p.isPunct(s) {
+		return fmt.Errorf("expecting %q instead of %s", s, p.peek())
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) expectIdent() (string, error) {
+	t := p.peek()
+	if t.kind != tokenIdent {
+		return "", fmt.Errorf("expecting identifier instead of %s", t)
+	}
+	p.next()
+	return t.s, nil
+}
+
+func (p *parser) expectString() (string, error) {
+	t := p.peek()
+	if t.kind != tokenString {
+		return "", fmt.Errorf("expecting quoted string instead of %s", t)
+	}
+	p.next()
+	return t.s, nil
+}
+
+func (p *parser) parseExpr() (*logqlExpr, error) {
+	t := p.peek()
+	switch {
+	case t.kind == tokenPunct && t.s == "{":
+		sel, err := p.parseLogSelector()
+		if err != nil {
+			return nil, err
+		}
+		return &logqlExpr{
+			sel: sel,
+		}, nil
+	case t.kind == tokenIdent && aggrFuncs[t.s]:
+		return p.parseAggrExpr()
+	case t.kind == tokenIdent:
+		if _, ok := rangeFuncs[t.s]; ok {
+			return p.parseRangeExpr()
+		}
+		return nil, fmt.Errorf("unsupported function %q", t.s)
+	default:
+		return nil, fmt.Errorf("unexpected %s at the beginning of query", t)
+	}
+}
+
+func (p *parser) parseAggrExpr() (*logqlExpr, error) {
+	aggrFunc := p.next().s
+
+	var by []string
+	hasBy := false
+	if p.isIdent("without") {
+		return nil, fmt.Errorf("`without` clause isn't supported in %s()", aggrFunc)
+	}
+	if p.isIdent("by") {
+		p.next()
+		labels, err := p.parseLabelsList()
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse `by` clause in %s(): %w", aggrFunc, err)
+		}
+		by = labels
+		hasBy = true
+	}
+
+	if err := p.expectPunct("("); err != nil {
+		return nil, fmt.Errorf("cannot parse %s(): %w", aggrFunc, err)
+	}
+	t := p.peek()
+	if _, ok := rangeFuncs[t.s]; t.kind != tokenIdent || !ok {
+		return nil, fmt.Errorf("%s() arg must be a range aggregation function such as count_over_time() or rate(); got %s", aggrFunc, t)
+	}
+	e, err := p.parseRangeExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectPunct(")"); err != nil {
+		return nil, fmt.Errorf("cannot parse %s(): %w", aggrFunc, err)
+	}
+
+	if p.isIdent("without") {
+		return nil, fmt.Errorf("`without` clause isn't supported in %s()", aggrFunc)
+	}
+	if p.isIdent("by") {
+		if hasBy {
+			return nil, fmt.Errorf("duplicate `by` clause in %s()", aggrFunc)
+		}
+		p.next()
+		labels, err := p.parseLabelsList()
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse `by` clause in %s(): %w", aggrFunc, err)
+		}
+		by = labels
+	}
+
+	e.aggrFunc = aggrFunc
+	e.aggrBy = by
+	return e, nil
+}
+
+func (p *parser) parseLabelsList() ([]string, error) {
+	if err := p.expectPunct("("); err != nil {
+		return nil, err
+	}
+	var labels []string
+	for !p.isPunct(")") {
+		label, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		labels = append(labels, label)
+		if p.isPunct(",") {
+			p.next()
+		} else if !p.isPunct(")") {
+			return nil, fmt.Errorf("expecting ',' or ')' instead of %s", p.peek())
+		}
+	}
+	p.next()
+	return labels, nil
+}
+
+func (p *parser) parseRangeExpr() (*logqlExpr, error) {
+	rangeFunc := p.next().s
+
+	if err := p.expectPunct("("); err != nil {
+		return nil, fmt.Errorf("cannot parse %s(): %w", rangeFunc, err)
+	}
+	sel, err := p.parseLogSelector()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.expectPunct("["); err != nil {
+		return nil, fmt.Errorf("cannot parse %s(): %w", rangeFunc, err)
+	}
+	t := p.next()
+	if t.kind != tokenNumber {
+		return nil, fmt.Errorf("expecting lookbehind window in %s() instead of %s", rangeFunc, t)
+	}
+	d, err := timeutil.ParseDuration(t.s)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse lookbehind window in %s(): %w", rangeFunc, err)
+	}
+	if d <= 0 {
+		return nil, fmt.Errorf("lookbehind window in %s() must be positive; got %s", rangeFunc, t.s)
+	}
+	if err := p.expectPunct("]"); err != nil {
+		return nil, fmt.Errorf("cannot parse %s(): %w", rangeFunc, err)
+	}
+
+	if p.isIdent("offset") {
+		return nil, fmt.Errorf("`offset` modifier isn't supported in %s()", rangeFunc)
+	}
+	if err := p.expectPunct(")"); err != nil {
+		return nil, fmt.Errorf("cannot parse %s(): %w", rangeFunc, err)
+	}
+
+	needUnwrap := rangeFuncs[rangeFunc]
+	if needUnwrap && sel.unwrap == "" {
+		return nil, fmt.Errorf("%s() requires `| unwrap` stage in the log selector", rangeFunc)
+	}
+	if !needUnwrap && sel.unwrap != "" && rangeFunc != "rate" {
+		return nil, fmt.Errorf("%s() cannot be used with `| unwrap` stage", rangeFunc)
+	}
+
+	e := &logqlExpr{
+		sel:        sel,
+		rangeFunc:  rangeFunc,
+		rangeNsecs: d.Nanoseconds(),
+	}
+	return e, nil
+}
+
+func (p *parser) parseLogSelector() (*logSelector, error) {
+	streamFilter, err := p.parseStreamSelector()
+	if err != nil {
+		return nil, err
+	}
+	ls := &logSelector{
+		streamFilter: streamFilter,
+	}
+
+	for {
+		t := p.peek()
+		if t.kind != tokenPunct {
+			return ls, nil
+		}
+		switch t.s {
+		case "|=", "!=", "|~", "!~":
+			p.next()
+			s, err := p.expectString()
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse line filter %q: %w", t.s, err)
+			}
+			f, err := lineFilterToLogsQL(t.s, s)
+			if err != nil {
+				return nil, err
+			}
+			if f != "" {
+				ls.addFilter(f)
+			}
+		case "|":
+			p.next()
+			if err := p.parseStage(ls); err != nil {
+				return nil, err
+			}
+		default:
+			return ls, nil
+		}
+	}
+}
+
+func (p *parser) parseStreamSelector() (string, error) {
+	if err := p.expectPunct("{"); err != nil {
+		return "", fmt.Errorf("cannot parse log stream selector: %w", err)
+	}
+	var matchers []string
+	for !p.isPunct("}") {
+		label, err := p.expectIdent()
+		if err != nil {
+			return "", fmt.Errorf("cannot parse log stream selector: %w", err)
+		}
+		t := p.next()
+		if t.kind != tokenPunct || (t.s != "=" && t.s != "!=" && t.s != "=~" && t.s != "!~") {
+			return "", fmt.Errorf("unexpected %s after label %q in log stream selector; expecting '=', '!=', '=~' or '!~'", t, label)
+		}
+		value, err := p.expectString()
+		if err != nil {
+			return "", fmt.Errorf("cannot parse value for label %q in log stream selector: %w", label, err)
+		}
+		if t.s == "=~" || t.s == "!~" {
+			if _, err := regexp.Compile(value); err != nil {
+				return "", fmt.Errorf("cannot parse regexp for label %q in log stream selector: %w", label, err)
+			}
+		}
+		matchers = append(matchers, label+t.s+strconv.Quote(value))
+
+		if p.isPunct(",") {
+			p.next()
+		} else if !p.isPunct("}") {
+			return "", fmt.Errorf("expecting ',' or '}' in log stream selector instead of %s", p.peek())
+		}
+	}
+	p.next()
+
+	if len(matchers) == 0 {
+		return "*", nil
+	}
+	return "{" + strings.Join(matchers, ",") + "}", nil
+}
+
+func (p *parser) parseStage(ls *logSelector) error {
+	t := p.peek()
+	if t.kind == tokenIdent && !isComparisonToken(p.peekAt(1)) {
+		switch t.s {
+		case "json", "logfmt":
+			p.next()
+			if p.peek().kind == tokenIdent {
+				return fmt.Errorf("`%s` stage with args isn't supported", t.s)
+			}
+			ls.pipes = append(ls.pipes, "unpack_"+t.s)
+			return nil
+		case "drop":
+			p.next()
+			var fields []string
+			for {
+				field, err := p.expectIdent()
+				if err != nil {
+					return fmt.Errorf("cannot parse `drop` stage: %w", err)
+				}
+				if isComparisonToken(p.peek()) {
+					return fmt.Errorf("`drop` stage with label matchers isn't supported")
+				}
+				fields = append(fields, quoteFieldName(field))
+				if !p.isPunct(",") {
+					break
+				}
+				p.next()
+			}
+			ls.pipes = append(ls.pipes, "delete "+strings.Join(fields, ", "))
+			return nil
+		case "line_format":
+			p.next()
+			tmpl, err := p.expectString()
+			if err != nil {
+				return fmt.Errorf("cannot parse `line_format` stage: %w", err)
+			}
+			pattern, err := lineFormatToPattern(tmpl)
+			if err != nil {
+				return err
+			}
+			ls.pipes = append(ls.pipes, "format "+strconv.Quote(pattern)+" as _msg")
+			return nil
+		case "unwrap":
+			p.next()
+			if ls.unwrap != "" {
+				return fmt.Errorf("duplicate `unwrap` stage")
+			}
+			field, err := p.expectIdent()
+			if err != nil {
+				return fmt.Errorf("cannot parse `unwrap` stage: %w", err)
+			}
+			if p.isPunct("(") {
+				return fmt.Errorf("`unwrap %s(...)` conversion function isn't supported", field)
+			}
+			ls.unwrap = field
+			return nil
+		}
+	}
+	if t.kind != tokenIdent && !(t.kind == tokenPunct && t.s == "(") {
+		return fmt.Errorf("unexpected %s after '|'", t)
+	}
+
+	f, err := p.parseLabelFilterOr()
+	if err != nil {
+		return fmt.Errorf("cannot parse label filter: %w", err)
+	}
+	ls.pipes = append(ls.pipes, "filter "+f)
+	return nil
+}
+
+func (p *parser) parseLabelFilterOr() (string, error) {
+	f, err := p.parseLabelFilterAnd()
+	if err != nil {
+		return "", err
+	}
+	for p.isIdent("or") {
+		p.next()
+		g, err := p.parseLabelFilterAnd()
+		if err != nil {
+			return "", err
+		}
+		f += " or " + g
+	}
+	return f, nil
+}
+
+func (p *parser) parseLabelFilterAnd() (string, error) {
+	f, err := p.parseLabelFilterPrimary()
+	if err != nil {
+		return "", err
+	}
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == tokenPunct && t.s == ",", t.kind == tokenIdent && t.s == "and":
+			p.next()
+		case t.kind == tokenPunct && t.s == "(", t.kind == tokenIdent && t.s != "or":
+			// Implicit `and`
+		default:
+			return f, nil
+		}
+		g, err := p.parseLabelFilterPrimary()
+		if err != nil {
+			return "", err
+		}
+		f += " " + g
+	}
+}
+
+func (p *parser) parseLabelFilterPrimary() (string, error) {
+	if p.isPunct("(") {
+		p.next()
+		f, err := p.parseLabelFilterOr()
+		if err != nil {
+			return "", err
+		}
+		if err := p.expectPunct(")"); err != nil {
+			return "", err
+		}
+		return "(" + f + ")", nil
+	}
+
+	label, err := p.expectIdent()
+	if err != nil {
+		return "", err
+	}
+	op := p.next()
+	if !isComparisonToken(op) {
+		return "", fmt.Errorf("expecting comparison operator after %q instead of %s", label, op)
+	}
+	value := p.next()
+	if value.kind != tokenString && value.kind != tokenNumber {
+		return "", fmt.Errorf("expecting value after %q %s instead of %s", label, op.s, value)
+	}
+	return labelFilterToLogsQL(label, op.s, value)
+}
+
+func isComparisonToken(t token) bool {
+	if t.kind != tokenPunct {
+		return false
+	}
+	switch t.s {
+	case "=", "!=", "=~", "!~", "==", ">", ">=", "<", "<=":
+		return true
+	default:
+		return false
+	}
+}
+
+// lineFilterToLogsQL returns LogsQL filter for LogQL line filter with the given op and s.
+//
+// An empty string is returned if the filter matches all the logs.
+func lineFilterToLogsQL(op, s string) (string, error) {
+	switch op {
+	case "|=", "!=":
+		if s == "" {
+			if op == "!=" {
+				return "", fmt.Errorf("`!= \"\"` line filter doesn't match any logs")
+			}
+			return "", nil
+		}
+		f := "_msg:*" + strconv.Quote(s) + "*"
+		if op == "!=" {
+			f = "-" + f
+		}
+		return f, nil
+	case "|~", "!~":
+		if _, err := regexp.Compile(s); err != nil {
+			return "", fmt.Errorf("cannot parse regexp in line filter %q: %w", op, err)
+		}
+		f := "_msg:~" + strconv.Quote(s)
+		if op == "!~" {
+			f = "-" + f
+		}
+		return f, nil
+	default:
+		return "", fmt.Errorf("BUG: unexpected line filter %q", op)
+	}
+}
+
+// labelFilterToLogsQL returns LogsQL filter for LogQL label filter `label op value`.
+func labelFilterToLogsQL(label, op string, value token) (string, error) {
+	field := quoteFieldName(label)
+	if value.kind == tokenNumber {
+		switch op {
+		case "=", "==":
+			return field + ":range[" + value.s + ", " + value.s + "]", nil
+		case "!=":
+			return "-" + field + ":range[" + value.s + ", " + value.s + "]", nil
+		case ">", ">=", "<", "<=":
+			return field + ":" + op + value.s, nil
+		default:
+			return "", fmt.Errorf("%q operator cannot be applied to numeric value %s", op, value.s)
+		}
+	}
+
+	v := value.s
+	switch op {
+	case "=", "==":
+		return field + ":=" + strconv.Quote(v), nil
+	case "!=":
+		return "-" + field + ":=" + strconv.Quote(v), nil
+	case "=~", "!~":
+		if _, err := regexp.Compile(v); err != nil {
+			return "", fmt.Errorf("cannot parse regexp for label %q: %w", label, err)
+		}
+		// LogQL regexps in label filters match the whole value
+		f := field + ":~" + strconv.Quote("^(?:"+v+")$")
+		if op == "!~" {
+			f = "-" + f
+		}
+		return f, nil
+	default:
+		return field + ":" + op + strconv.Quote(v), nil
+	}
+}
+
+// lineFormatToPattern converts line_format template to LogsQL format pipe pattern.
+//
+// Only {{.field}} and {{__line__}} placeholders are supported.
+func lineFormatToPattern(tmpl string) (string, error) {
+	var dst []byte
+	s := tmpl
+	for {
+		n := strings.Index(s, "{{")
+		if n < 0 {
+			dst = append(dst, s...)
+			return string(dst), nil
+		}
+		dst = append(dst, s[:n]...)
+		s = s[n+2:]
+
+		n = strings.Index(s, "}}")
+		if n < 0 {
+			return "", fmt.Errorf("missing `}}` in line_format template %q", tmpl)
+		}
+		action := strings.TrimSpace(s[:n])
+		s = s[n+2:]
+
+		switch {
+		case action == "__line__":
+			dst = append(dst, "<_msg>"...)
+		case strings.HasPrefix(action, ".") && isIdent(action[1:]):
+			dst = append(dst, '<')
+			dst = append(dst, action[1:]...)
+			dst = append(dst, '>')
+		default:
+			return "", fmt.Errorf("unsupported action {{%s}} in line_format template %q; only {{.field}} and {{__line__}} are supported", action, tmpl)
+		}
+	}
+}
+
+func quoteFieldName(s string) string {
+	return strconv.Quote(s)
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenPunct
+)
+
+type token struct {
+	kind tokenKind
+
+	// s contains unquoted value for tokenString
+	s string
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of query"
+	case tokenString:
+		return strconv.Quote(t.s)
+	default:
+		return fmt.Sprintf("%q", t.s)
+	}
+}
+
+// tokenize splits LogQL query s into tokens.
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+		if s == "" {
+			return tokens, nil
+		}
+
+		c := s[0]
+		switch {
+		case c == '"' || c == '`':
+			prefix, err := strconv.QuotedPrefix(s)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse quoted string at [%s]: %w", s, err)
+			}
+			v, err := strconv.Unquote(prefix)
+			if err != nil {
+				return nil, fmt.Errorf("cannot unquote string %s: %w", prefix, err)
+			}
+			tokens = append(tokens, token{
+				kind: tokenString,
+				s:    v,
+			})
+			s = s[len(prefix):]
+		case isIdentStartChar(c):
+			n := 1
+			for n < len(s) && isIdentChar(s[n]) {
+				n++
+			}
+			tokens = append(tokens, token{
+				kind: tokenIdent,
+				s:    s[:n],
+			})
+			s = s[n:]
+		case c >= '0' && c <= '9' || c == '-' && len(s) > 1 && s[1] >= '0' && s[1] <= '9':
+			n := 1
+			for n < len(s) && (isIdentChar(s[n]) || s[n] == '.') {
+				n++
+			}
+			tokens = append(tokens, token{
+				kind: tokenNumber,
+				s:    s[:n],
+			})
+			s = s[n:]
+		default:
+			punct := getPunct(s)
+			if punct == "" {
+				return nil, fmt.Errorf("unexpected char %q at [%s]", c, s)
+			}
+			tokens = append(tokens, token{
+				kind: tokenPunct,
+				s:    punct,
+			})
+			s = s[len(punct):]
+		}
+	}
+}
+
+func getPunct(s string) string {
+	if len(s) >= 2 {
+		switch s[:2] {
+		case "|=", "|~", "!=", "!~", "=~", "==", ">=", "<=":
+			return s[:2]
+		}
+	}
+	switch s[0] {
+	case '{', '}', '(', ')', '[', ']', ',', '|', '=', '>', '<':
+		return s[:1]
+	default:
+		return ""
+	}
+}
+
+func isIdent(s string) bool {
+	if s == "" || !isIdentStartChar(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isIdentChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isIdentStartChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStartChar(c) || c >= '0' && c <= '9'
+}
@@ -0,0 +1,199 @@
+package loki
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestParseLogQLLogQuerySuccess(t *testing.T) {
+	f := func(s, resultExpected string) {
+		t.Helper()
+
+		e, err := parseLogQL(s)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if e.isMetric() {
+			t.Fatalf("unexpected metric query")
+		}
+		result := e.sel.String()
+		if result != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+
+		// Verify that the generated query is valid LogsQL
+		if _, err := logstorage.ParseQuery(result); err != nil {
+			t.Fatalf("cannot parse the generated query [%s]: %s", result, err)
+		}
+	}
+
+	// stream selectors
+	f(`{}`, `*`)
+	f(`{app="nginx"}`, `{app="nginx"}`)
+	f(`{ app = "nginx" , env!="dev",host=~"host-.+", path!~"/api/.*" }`, `{app="nginx",env!="dev",host=~"host-.+",path!~"/api/.*"}`)
+	f("{app=`a\\b`}", `{app="a\\b"}`)
+
+	// line filters
+	f(`{app="nginx"} |= "error"`, `{app="nginx"} _msg:*"error"*`)
+	f(`{app="nginx"} != "debug"`, `{app="nginx"} -_msg:*"debug"*`)
+	f(`{app="nginx"} |~ "err.+" !~ "foo"`, `{app="nginx"} _msg:~"err.+" -_msg:~"foo"`)
+	f(`{app="nginx"} |= ""`, `{app="nginx"}`)
+
+	// parsers
+	f(`{app="nginx"} | json`, `{app="nginx"} | unpack_json`)
+	f(`{app="nginx"} |= "x" | logfmt |= "y"`, `{app="nginx"} _msg:*"x"* | unpack_logfmt | filter _msg:*"y"*`)
+
+	// label filters
+	f(`{app="nginx"} | json | level="error"`, `{app="nginx"} | unpack_json | filter "level":="error"`)
+	f(`{app="nginx"} | json | level!="info", status>=500`, `{app="nginx"} | unpack_json | filter -"level":="info" "status":>=500`)
+	f(`{app="nginx"} | logfmt | latency > 250ms and method=~"GET|POST"`, `{app="nginx"} | unpack_logfmt | filter "latency":>250ms "method":~"^(?:GET|POST)$"`)
+	f(`{app="nginx"} | logfmt | (status==404 or status!=200) method!~"P.+"`, `{app="nginx"} | unpack_logfmt | filter ("status":range[404, 404] or -"status":range[200, 200]) -"method":~"^(?:P.+)$"`)
+	f(`{app="nginx"} | json | user < "m"`, `{app="nginx"} | unpack_json | filter "user":<"m"`)
+	f(`{app="nginx"} | json | __error__=""`, `{app="nginx"} | unpack_json | filter "__error__":=""`)
+
+	// drop
+	f(`{app="nginx"} | json | drop trace_id, span_id`, `{app="nginx"} | unpack_json | delete "trace_id", "span_id"`)
+
+	// line_format
+	f(`{app="nginx"} | json | line_format "{{.method}} {{ .path }}: {{__line__}}"`, `{app="nginx"} | unpack_json | format "<method> <path>: <_msg>" as _msg`)
+}
+
+func TestParseLogQLMetricQuerySuccess(t *testing.T) {
+	f := func(s, resultExpected string, rangeNsecsExpected int64, aggrByExpected []string) {
+		t.Helper()
+
+		e, err := parseLogQL(s)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !e.isMetric() {
+			t.Fatalf("expecting metric query")
+		}
+		result := e.metricQueryString(60e9, 1e9)
+		if result != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+		if e.rangeNsecs != rangeNsecsExpected {
+			t.Fatalf("unexpected range; got %d; want %d", e.rangeNsecs, rangeNsecsExpected)
+		}
+		if !reflect.DeepEqual(e.aggrBy, aggrByExpected) {
+			t.Fatalf("unexpected by labels; got %q; want %q", e.aggrBy, aggrByExpected)
+		}
+
+		// Verify that the generated query is valid LogsQL
+		if _, err := logstorage.ParseQuery(result); err != nil {
+			t.Fatalf("cannot parse the generated query [%s]: %s", result, err)
+		}
+	}
+
+	// range functions
+	f(`count_over_time({app="nginx"}[5m])`,
+		`{app="nginx"} | stats by (_time:60000000000ns offset 1000000000ns, "_stream") count() as __value__`, 300e9, nil)
+	f(`rate({app="nginx"} |= "error" [1m])`,
+		`{app="nginx"} _msg:*"error"* | stats by (_time:60000000000ns offset 1000000000ns, "_stream") count() as __value__`, 60e9, nil)
+	f(`bytes_over_time({app="nginx"}[1h])`,
+		`{app="nginx"} | stats by (_time:60000000000ns offset 1000000000ns, "_stream") sum_len(_msg) as __value__`, 3600e9, nil)
+	f(`bytes_rate({app="nginx"}[30s])`,
+		`{app="nginx"} | stats by (_time:60000000000ns offset 1000000000ns, "_stream") sum_len(_msg) as __value__`, 30e9, nil)
+	f(`sum_over_time({app="nginx"} | json | unwrap size [5m])`,
+		`{app="nginx"} | unpack_json | stats by (_time:60000000000ns offset 1000000000ns, "_stream") sum("size") as __value__`, 300e9, nil)
+	f(`rate({app="nginx"} | json | unwrap size [5m])`,
+		`{app="nginx"} | unpack_json | stats by (_time:60000000000ns offset 1000000000ns, "_stream") sum("size") as __value__`, 300e9, nil)
+	f(`min_over_time({app="nginx"} | logfmt | unwrap latency | latency > 0 [5m])`,
+		`{app="nginx"} | unpack_logfmt | filter "latency":>0 | stats by (_time:60000000000ns offset 1000000000ns, "_stream") min("latency") as __value__`, 300e9, nil)
+	f(`max_over_time({app="nginx"} | logfmt | unwrap latency [5m])`,
+		`{app="nginx"} | unpack_logfmt | stats by (_time:60000000000ns offset 1000000000ns, "_stream") max("latency") as __value__`, 300e9, nil)
+	f(`avg_over_time({app="nginx"} | logfmt | unwrap latency [5m])`,
+		`{app="nginx"} | unpack_logfmt | stats by (_time:60000000000ns offset 1000000000ns, "_stream") sum("latency") as __value__, count("latency") as __count__`, 300e9, nil)
+
+	// aggregate functions, which can be pushed down to stats
+	f(`sum(count_over_time({app="nginx"}[5m]))`,
+		`{app="nginx"} | stats by (_time:60000000000ns offset 1000000000ns) count() as __value__`, 300e9, nil)
+	f(`sum by (host, level) (rate({app="nginx"} | json [5m]))`,
+		`{app="nginx"} | unpack_json | stats by (_time:60000000000ns offset 1000000000ns, "host", "level") count() as __value__`, 300e9, []string{"host", "level"})
+	f(`sum(rate({app="nginx"}[5m])) by (host)`,
+		`{app="nginx"} | stats by (_time:60000000000ns offset 1000000000ns, "host") count() as __value__`, 300e9, []string{"host"})
+
+	// aggregate functions, which are calculated over per-stream results
+	f(`max by (host) (count_over_time({app="nginx"}[5m]))`,
+		`{app="nginx"} | stats by (_time:60000000000ns offset 1000000000ns, "_stream", "host") count() as __value__`, 300e9, []string{"host"})
+	f(`sum(max_over_time({app="nginx"} | logfmt | unwrap latency [5m]))`,
+		`{app="nginx"} | unpack_logfmt | stats by (_time:60000000000ns offset 1000000000ns, "_stream") max("latency") as __value__`, 300e9, nil)
+	f(`count(count_over_time({app="nginx"}[1m]))`,
+		`{app="nginx"} | stats by (_time:60000000000ns offset 1000000000ns, "_stream") count() as __value__`, 60e9, nil)
+}
+
+func TestParseLogQLFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+
+		e, err := parseLogQL(s)
+		if err == nil {
+			t.Fatalf("expecting non-nil error; got %+v", e)
+		}
+	}
+
+	// missing selector
+	f(``)
+	f(`foo`)
+	f(`"foo"`)
+
+	// invalid selector
+	f(`{`)
+	f(`{app}`)
+	f(`{app="foo"`)
+	f(`{app=foo}`)
+	f(`{app=~"("}`)
+	f(`{app>"foo"}`)
+
+	// invalid line filters
+	f(`{app="foo"} |= foo`)
+	f(`{app="foo"} |~ "("`)
+	f(`{app="foo"} != ""`)
+
+	// invalid stages
+	f(`{app="foo"} |`)
+	f(`{app="foo"} | json foo="bar"`)
+	f(`{app="foo"} | pattern "<foo>"`)
+	f(`{app="foo"} | line_format "{{.foo | upper}}"`)
+	f(`{app="foo"} | line_format "{{.foo"`)
+	f(`{app="foo"} | drop`)
+	f(`{app="foo"} | drop foo="bar"`)
+	f(`{app="foo"} | unwrap`)
+	f(`{app="foo"} | unwrap duration(foo)`)
+	f(`{app="foo"} | unwrap foo | unwrap bar`)
+	f(`{app="foo"} | foo`)
+	f(`{app="foo"} | foo =~ 123`)
+	f(`{app="foo"} | foo = "bar" or`)
+	f(`{app="foo"} | (foo = "bar"`)
+
+	// unexpected tail
+	f(`{app="foo"} foo`)
+	f(`{app="foo"})`)
+
+	// invalid range functions
+	f(`count_over_time({app="foo"})`)
+	f(`count_over_time({app="foo"}[foo])`)
+	f(`count_over_time({app="foo"}[0s])`)
+	f(`count_over_time({app="foo"}[5m] offset 1h)`)
+	f(`count_over_time({app="foo"}[5m]`)
+	f(`count_over_time({app="foo"} | unwrap bar [5m])`)
+	f(`sum_over_time({app="foo"}[5m])`)
+	f(`quantile_over_time(0.99, {app="foo"} | unwrap bar [5m])`)
+
+	// invalid aggregate functions
+	f(`sum({app="foo"})`)
+	f(`sum without (foo) (count_over_time({app="foo"}[5m]))`)
+	f(`sum by (foo) (count_over_time({app="foo"}[5m])) by (bar)`)
+	f(`sum(sum(count_over_time({app="foo"}[5m])))`)
+	f(`topk(5, count_over_time({app="foo"}[5m]))`)
+	f(`sum by (count_over_time({app="foo"}[5m]))`)
+}
+
+func TestParseLogQLSelectorFailure(t *testing.T) {
+	if _, err := parseLogQLSelector(`count_over_time({app="foo"}[5m])`); err == nil {
+		t.Fatalf("expecting non-nil error for metric query")
+	}
+}
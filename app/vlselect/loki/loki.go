@@ -0,0 +1,851 @@
+package loki
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timeutil"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+const (
+	// defaultQueryRangeLookback is the default time range for /loki/api/v1/query_range if start arg is missing.
+	defaultQueryRangeLookback = time.Hour
+
+	// defaultLabelsLookback is the default time range for /loki/api/v1/labels, /loki/api/v1/label/<name>/values and /loki/api/v1/series.
+	defaultLabelsLookback = 6 * time.Hour
+
+	// defaultLimit is the default number of log entries returned from log queries.
+	defaultLimit = 100
+
+	// maxPoints is the maximum number of points per series, which can be returned from a single metric query.
+	maxPoints = 11000
+
+	// maxBuckets is the maximum number of per-bucket stats, which can be requested from the storage for a single metric query.
+	maxBuckets = 1_000_000
+)
+
+// ProcessQueryRangeRequest handles /select/loki/api/v1/query_range request.
+//
+// See https://grafana.com/docs/loki/latest/reference/loki-http-api/#query-logs-within-a-range-of-time
+func ProcessQueryRangeRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	tenantIDs, err := getTenantIDs(r)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	e, err := parseQueryArg(r)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	start, end, err := getTimeRange(r, defaultQueryRangeLookback)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+
+	if !e.isMetric() {
+		limit, err := getLimit(r)
+		if err != nil {
+			httpserver.Errorf(w, r, "%s", err)
+			return
+		}
+		backward, err := isBackwardDirection(r)
+		if err != nil {
+			httpserver.Errorf(w, r, "%s", err)
+			return
+		}
+		streams, err := queryLogs(ctx, tenantIDs, e.sel, start, end, limit, backward)
+		if err != nil {
+			httpserver.Errorf(w, r, "%s", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		WriteStreamsResponse(w, streams)
+		return
+	}
+
+	step, err := getStep(r, start, end)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	series, err := queryMetrics(ctx, tenantIDs, e, start, end, step)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	WriteMatrixResponse(w, series)
+}
+
+// ProcessQueryRequest handles /select/loki/api/v1/query request.
+//
+// See https://grafana.com/docs/loki/latest/reference/loki-http-api/#query-logs-at-a-single-point-in-time
+func ProcessQueryRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	tenantIDs, err := getTenantIDs(r)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	e, err := parseQueryArg(r)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	if !e.isMetric() {
+		httpserver.Errorf(w, r, "log queries are unsupported at /loki/api/v1/query; use /loki/api/v1/query_range instead")
+		return
+	}
+	timestamp, err := getTimeArg(r, "time", time.Now().UnixNano())
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+
+	series, err := queryMetrics(ctx, tenantIDs, e, timestamp, timestamp, e.rangeNsecs)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	WriteVectorResponse(w, series)
+}
+
+// ProcessLabelsRequest handles /select/loki/api/v1/labels request.
+//
+// See https://grafana.com/docs/loki/latest/reference/loki-http-api/#query-labels
+func ProcessLabelsRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	qctx, qs, err := newLabelsQueryContext(ctx, r, r.FormValue("query"))
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	defer vlstorage.UpdatePerQueryStatsMetrics(qs)
+
+	names, err := vlstorage.GetStreamFieldNames(qctx)
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot obtain label names: %s", err)
+		return
+	}
+	values := getSortedValues(names)
+
+	w.Header().Set("Content-Type", "application/json")
+	WriteValuesResponse(w, values)
+}
+
+// ProcessLabelValuesRequest handles /select/loki/api/v1/label/<name>/values request.
+//
+// See https://grafana.com/docs/loki/latest/reference/loki-http-api/#query-label-values
+func ProcessLabelValuesRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, labelName string) {
+	qctx, qs, err := newLabelsQueryContext(ctx, r, r.FormValue("query"))
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	defer vlstorage.UpdatePerQueryStatsMetrics(qs)
+
+	labelValues, err := vlstorage.GetStreamFieldValues(qctx, labelName, 0)
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot obtain values for label %q: %s", labelName, err)
+		return
+	}
+	values := getSortedValues(labelValues)
+
+	w.Header().Set("Content-Type", "application/json")
+	WriteValuesResponse(w, values)
+}
+
+// ProcessSeriesRequest handles /select/loki/api/v1/series request.
+//
+// See https://grafana.com/docs/loki/latest/reference/loki-http-api/#query-streams
+func ProcessSeriesRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		httpserver.Errorf(w, r, "cannot parse request args: %s", err)
+		return
+	}
+	matches := r.Form["match[]"]
+	if len(matches) == 0 {
+		matches = r.Form["match"]
+	}
+	if len(matches) == 0 {
+		matches = []string{"{}"}
+	}
+
+	m := make(map[string]struct{})
+	for _, match := range matches {
+		qctx, qs, err := newLabelsQueryContext(ctx, r, match)
+		if err != nil {
+			httpserver.Errorf(w, r, "%s", err)
+			return
+		}
+		streams, err := vlstorage.GetStreams(qctx, 0)
+		vlstorage.UpdatePerQueryStatsMetrics(qs)
+		if err != nil {
+			httpserver.Errorf(w, r, "cannot obtain series for match[]=%q: %s", match, err)
+			return
+		}
+		for _, s := range streams {
+			m[s.Value] = struct{}{}
+		}
+	}
+
+	series := make([][]logstorage.Field, 0, len(m))
+	for _, s := range getSortedKeys(m) {
+		labels, err := logstorage.ParseStreamFields(nil, s)
+		if err != nil {
+			httpserver.Errorf(w, r, "cannot parse stream %s: %s", s, err)
+			return
+		}
+		series = append(series, labels)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	WriteSeriesResponse(w, series)
+}
+
+func newLabelsQueryContext(ctx context.Context, r *http.Request, qStr string) (*logstorage.QueryContext, *logstorage.QueryStats, error) {
+	tenantIDs, err := getTenantIDs(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	start, end, err := getTimeRange(r, defaultLabelsLookback)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logsqlStr := "*"
+	if qStr != "" {
+		sel, err := parseLogQLSelector(qStr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot parse query %q: %w", qStr, err)
+		}
+		logsqlStr = sel.String()
+	}
+	q, err := logstorage.ParseQueryAtTimestamp(logsqlStr, end)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot parse query [%s] generated from %q: %w", logsqlStr, qStr, err)
+	}
+	q.AddTimeFilter(start, end)
+
+	var qs logstorage.QueryStats
+	qctx := logstorage.NewQueryContext(ctx, &qs, tenantIDs, q)
+	return qctx, &qs, nil
+}
+
+// logStream is a Loki stream returned from log queries.
+type logStream struct {
+	Labels  []logstorage.Field
+	Entries []logEntry
+}
+
+type logEntry struct {
+	Timestamp int64
+	Line      string
+}
+
+// queryLogs returns up to limit logs on the [start, end) time range for the given sel.
+//
+// The newest logs are returned if backward is set. Otherwise the oldest logs are returned.
+func queryLogs(ctx context.Context, tenantIDs []logstorage.TenantID, sel *logSelector, start, end int64, limit int, backward bool) ([]*logStream, error) {
+	sortPipe := "sort by (_time)"
+	if backward {
+		sortPipe += " desc"
+	}
+	qStr := fmt.Sprintf("%s | %s | limit %d | fields _time, _stream, _msg", sel, sortPipe, limit)
+	q, err := logstorage.ParseQueryAtTimestamp(qStr, end)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse query [%s]: %w", qStr, err)
+	}
+	q.AddTimeFilter(start, end-1)
+
+	m := make(map[string]*logStream)
+	var mLock sync.Mutex
+	var parseErr error
+
+	writeBlock := func(_ uint, db *logstorage.DataBlock) {
+		timestamps, ok := db.GetTimestamps(nil)
+		if !ok {
+			return
+		}
+		var streams, msgs []string
+		for _, c := range db.Columns {
+			switch c.Name {
+			case "_stream":
+				streams = c.Values
+			case "_msg":
+				msgs = c.Values
+			}
+		}
+
+		mLock.Lock()
+		defer mLock.Unlock()
+
+		for i, timestamp := range timestamps {
+			stream := ""
+			if streams != nil {
+				stream = streams[i]
+			}
+			ls := m[stream]
+			if ls == nil {
+				stream = strings.Clone(stream)
+				labels, err := logstorage.ParseStreamFields(nil, stream)
+				if err != nil && stream != "" && parseErr == nil {
+					parseErr = fmt.Errorf("cannot parse stream %s: %w", stream, err)
+				}
+				ls = &logStream{
+					Labels: labels,
+				}
+				m[stream] = ls
+			}
+			line := ""
+			if msgs != nil {
+				line = strings.Clone(msgs[i])
+			}
+			ls.Entries = append(ls.Entries, logEntry{
+				Timestamp: timestamp,
+				Line:      line,
+			})
+		}
+	}
+
+	var qs logstorage.QueryStats
+	qctx := logstorage.NewQueryContext(ctx, &qs, tenantIDs, q)
+	defer vlstorage.UpdatePerQueryStatsMetrics(&qs)
+
+	if err := vlstorage.RunQuery(qctx, writeBlock); err != nil {
+		return nil, fmt.Errorf("cannot execute query [%s]: %w", q, err)
+	}
+	if parseErr != nil {
+		return nil, parseErr
+	}
+
+	result := make([]*logStream, 0, len(m))
+	for _, stream := range getSortedKeys(m) {
+		ls := m[stream]
+		sort.SliceStable(ls.Entries, func(i, j int) bool {
+			if backward {
+				return ls.Entries[i].Timestamp > ls.Entries[j].Timestamp
+			}
+			return ls.Entries[i].Timestamp < ls.Entries[j].Timestamp
+		})
+		result = append(result, ls)
+	}
+	return result, nil
+}
+
+// metricSeries is a series returned from metric queries.
+type metricSeries struct {
+	Labels []logstorage.Field
+	Points []metricPoint
+}
+
+type metricPoint struct {
+	Timestamp int64
+	Value     float64
+}
+
+// queryMetrics evaluates metric query e at points start, start+step, ..., end.
+//
+// Per-bucket stats are obtained from the storage, and then they are aggregated over the lookbehind window for every point.
+// The bucket size is the greatest common divisor of step and the lookbehind window,
+// so every window consists of whole buckets.
+func queryMetrics(ctx context.Context, tenantIDs []logstorage.TenantID, e *logqlExpr, start, end, step int64) ([]*metricSeries, error) {
+	if step <= 0 {
+		return nil, fmt.Errorf("step must be positive")
+	}
+	if end < start {
+		return nil, fmt.Errorf("end=%d cannot be smaller than start=%d", end, start)
+	}
+	pointsCount := (end-start)/step + 1
+	if pointsCount > maxPoints {
+		return nil, fmt.Errorf("too many points requested: %d; it mustn't exceed %d; increase step or decrease the selected time range", pointsCount, maxPoints)
+	}
+
+	be := newBucketsEvaluator(e, start, step)
+	bucketsCount := (end-start)/be.bucket + be.bucketsPerWindow
+	if bucketsCount > maxBuckets {
+		return nil, fmt.Errorf("too many buckets needed for evaluating the query: %d; it mustn't exceed %d; "+
+			"use step, which is a multiple of the lookbehind window or vice versa", bucketsCount, maxBuckets)
+	}
+
+	offset := ((be.firstBucket % be.bucket) + be.bucket) % be.bucket
+	qStr := e.metricQueryString(be.bucket, offset)
+	q, err := logstorage.ParseQueryAtTimestamp(qStr, end)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse query [%s]: %w", qStr, err)
+	}
+	q.AddTimeFilter(be.firstBucket, end)
+
+	var qs logstorage.QueryStats
+	qctx := logstorage.NewQueryContext(ctx, &qs, tenantIDs, q)
+	defer vlstorage.UpdatePerQueryStatsMetrics(&qs)
+
+	if err := vlstorage.RunQuery(qctx, be.writeBlock); err != nil {
+		return nil, fmt.Errorf("cannot execute query [%s]: %w", q, err)
+	}
+	if be.err != nil {
+		return nil, be.err
+	}
+
+	return be.getSeries(pointsCount), nil
+}
+
+// bucketsEvaluator collects per-bucket stats for metric query and evaluates it over the collected buckets.
+type bucketsEvaluator struct {
+	e *logqlExpr
+
+	start int64
+	step  int64
+
+	// bucket is the bucket duration in nanoseconds
+	bucket int64
+
+	// bucketsPerWindow is the number of buckets in the lookbehind window.
+	bucketsPerWindow int64
+
+	// firstBucket is the start of the first bucket needed for evaluating the point at start.
+	firstBucket int64
+
+	mu     sync.Mutex
+	m      map[string]*bucketsSeries
+	fields []logstorage.Field
+	err    error
+}
+
+// bucketsSeries contains per-bucket stats for a single group of logs.
+type bucketsSeries struct {
+	// streamLabels contains labels from _stream field
+	streamLabels []logstorage.Field
+
+	// byLabels contains labels from `by (...)` clause of the aggregate function.
+	byLabels []logstorage.Field
+
+	buckets []bucketValue
+}
+
+type bucketValue struct {
+	// idx is the bucket index starting from firstBucket
+	idx int64
+
+	value float64
+	count float64
+}
+
+func newBucketsEvaluator(e *logqlExpr, start, step int64) *bucketsEvaluator {
+	bucket := gcd(step, e.rangeNsecs)
+	return &bucketsEvaluator{
+		e: e,
+
+		start: start,
+		step:  step,
+
+		bucket:           bucket,
+		bucketsPerWindow: e.rangeNsecs / bucket,
+		firstBucket:      start + 1 - e.rangeNsecs,
+
+		m: make(map[string]*bucketsSeries),
+	}
+}
+
+func (be *bucketsEvaluator) writeBlock(_ uint, db *logstorage.DataBlock) {
+	rowsCount := db.RowsCount()
+	columns := db.Columns
+
+	be.mu.Lock()
+	defer be.mu.Unlock()
+
+	if be.err != nil {
+		return
+	}
+
+	for i := 0; i < rowsCount; i++ {
+		var bv bucketValue
+		ok := true
+		hasCount := false
+		fields := be.fields[:0]
+		for _, c := range columns {
+			v := c.Values[i]
+			switch c.Name {
+			case "_time":
+				ts, tsOK := logstorage.TryParseTimestampRFC3339Nano(v)
+				if !tsOK {
+					be.err = fmt.Errorf("cannot parse bucket timestamp %q", v)
+					return
+				}
+				bv.idx = (ts - be.firstBucket) / be.bucket
+			case valueFieldName:
+				f, err := strconv.ParseFloat(v, 64)
+				if err != nil || math.IsNaN(f) {
+					ok = false
+				}
+				bv.value = f
+			case countFieldName:
+				f, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					ok = false
+				}
+				bv.count = f
+				hasCount = true
+			default:
+				fields = append(fields, logstorage.Field{
+					Name:  c.Name,
+					Value: v,
+				})
+			}
+		}
+		be.fields = fields
+		if !ok || bv.idx < 0 || hasCount && bv.count == 0 {
+			continue
+		}
+
+		key := string(logstorage.MarshalFieldsToJSON(nil, fields))
+		bs := be.m[key]
+		if bs == nil {
+			bs = &bucketsSeries{}
+			for _, f := range fields {
+				name := strings.Clone(f.Name)
+				value := strings.Clone(f.Value)
+				if name == "_stream" {
+					labels, err := logstorage.ParseStreamFields(nil, value)
+					if err != nil {
+						be.err = fmt.Errorf("cannot parse stream %s: %w", value, err)
+						return
+					}
+					bs.streamLabels = labels
+					continue
+				}
+				if value != "" {
+					bs.byLabels = append(bs.byLabels, logstorage.Field{
+						Name:  name,
+						Value: value,
+					})
+				}
+			}
+			be.m[key] = bs
+		}
+		bs.buckets = append(bs.buckets, bv)
+	}
+}
+
+// getSeries returns series with pointsCount points, which are evaluated over the collected buckets.
+func (be *bucketsEvaluator) getSeries(pointsCount int64) []*metricSeries {
+	e := be.e
+
+	var result []*metricSeries
+	for _, bs := range be.m {
+		points := be.evalPoints(bs.buckets, pointsCount)
+		if len(points) == 0 {
+			continue
+		}
+		labels := bs.byLabels
+		if e.aggrFunc == "" {
+			labels = bs.streamLabels
+		}
+		result = append(result, &metricSeries{
+			Labels: labels,
+			Points: points,
+		})
+	}
+
+	if e.aggrFunc != "" && !e.canPushDownAggr() {
+		result = aggregateSeries(result, e.aggrFunc)
+	}
+
+	sortSeries(result)
+	return result
+}
+
+// evalPoints evaluates range function over buckets at pointsCount points.
+func (be *bucketsEvaluator) evalPoints(buckets []bucketValue, pointsCount int64) []metricPoint {
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].idx < buckets[j].idx
+	})
+
+	var points []metricPoint
+	rangeSecs := float64(be.e.rangeNsecs) / 1e9
+	stepBuckets := be.step / be.bucket
+	for i := int64(0); i < pointsCount; i++ {
+		lo := i * stepBuckets
+		hi := lo + be.bucketsPerWindow
+		n := sort.Search(len(buckets), func(j int) bool {
+			return buckets[j].idx >= lo
+		})
+		window := buckets[n:]
+		n = sort.Search(len(window), func(j int) bool {
+			return window[j].idx >= hi
+		})
+		window = window[:n]
+		if len(window) == 0 {
+			continue
+		}
+
+		var v float64
+		switch be.e.rangeFunc {
+		case "min_over_time":
+			v = window[0].value
+			for _, bv := range window[1:] {
+				v = math.Min(v, bv.value)
+			}
+		case "max_over_time":
+			v = window[0].value
+			for _, bv := range window[1:] {
+				v = math.Max(v, bv.value)
+			}
+		case "avg_over_time":
+			var sum, count float64
+			for _, bv := range window {
+				sum += bv.value
+				count += bv.count
+			}
+			v = sum / count
+		default:
+			for _, bv := range window {
+				v += bv.value
+			}
+			if be.e.rangeFunc == "rate" || be.e.rangeFunc == "bytes_rate" {
+				v /= rangeSecs
+			}
+		}
+
+		points = append(points, metricPoint{
+			Timestamp: be.start + i*be.step,
+			Value:     v,
+		})
+	}
+	return points
+}
+
+// aggregateSeries aggregates points with the same timestamps across series with the same labels according to aggrFunc.
+func aggregateSeries(series []*metricSeries, aggrFunc string) []*metricSeries {
+	type aggrState struct {
+		value float64
+		count float64
+	}
+	type aggrSeries struct {
+		labels []logstorage.Field
+		points map[int64]*aggrState
+	}
+
+	m := make(map[string]*aggrSeries)
+	for _, ms := range series {
+		key := string(logstorage.MarshalFieldsToJSON(nil, ms.Labels))
+		as := m[key]
+		if as == nil {
+			as = &aggrSeries{
+				labels: ms.Labels,
+				points: make(map[int64]*aggrState),
+			}
+			m[key] = as
+		}
+		for _, p := range ms.Points {
+			st := as.points[p.Timestamp]
+			if st == nil {
+				as.points[p.Timestamp] = &aggrState{
+					value: p.Value,
+					count: 1,
+				}
+				continue
+			}
+			switch aggrFunc {
+			case "min":
+				st.value = math.Min(st.value, p.Value)
+			case "max":
+				st.value = math.Max(st.value, p.Value)
+			default:
+				st.value += p.Value
+			}
+			st.count++
+		}
+	}
+
+	result := make([]*metricSeries, 0, len(m))
+	for _, as := range m {
+		points := make([]metricPoint, 0, len(as.points))
+		for ts, st := range as.points {
+			v := st.value
+			switch aggrFunc {
+			case "avg":
+				v /= st.count
+			case "count":
+				v = st.count
+			}
+			points = append(points, metricPoint{
+				Timestamp: ts,
+				Value:     v,
+			})
+		}
+		sort.Slice(points, func(i, j int) bool {
+			return points[i].Timestamp < points[j].Timestamp
+		})
+		result = append(result, &metricSeries{
+			Labels: as.labels,
+			Points: points,
+		})
+	}
+	return result
+}
+
+func sortSeries(series []*metricSeries) {
+	keys := make(map[*metricSeries]string, len(series))
+	for _, ms := range series {
+		sort.Slice(ms.Labels, func(i, j int) bool {
+			return ms.Labels[i].Name < ms.Labels[j].Name
+		})
+		keys[ms] = string(logstorage.MarshalFieldsToJSON(nil, ms.Labels))
+	}
+	sort.Slice(series, func(i, j int) bool {
+		return keys[series[i]] < keys[series[j]]
+	})
+}
+
+func gcd(a, b int64) int64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func getTenantIDs(r *http.Request) ([]logstorage.TenantID, error) {
+	tenantID, err := logstorage.GetTenantIDFromRequest(r)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain tenantID: %w", err)
+	}
+
+	// Fall back to Loki tenant header if the tenant isn't set via VictoriaLogs headers.
+	if tenantID.AccountID == 0 && tenantID.ProjectID == 0 {
+		if org := r.Header.Get("X-Scope-OrgID"); org != "" {
+			tenantID, err = logstorage.ParseTenantID(org)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse X-Scope-OrgID header: %w", err)
+			}
+		}
+	}
+	return []logstorage.TenantID{tenantID}, nil
+}
+
+func parseQueryArg(r *http.Request) (*logqlExpr, error) {
+	qStr := r.FormValue("query")
+	if qStr == "" {
+		return nil, fmt.Errorf("missing `query` arg")
+	}
+	e, err := parseLogQL(qStr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse query %q: %w", qStr, err)
+	}
+	return e, nil
+}
+
+// getTimeRange returns [start, end] time range from start, end and since args.
+//
+// The end defaults to the current time, while start defaults to end minus since or defaultLookback.
+func getTimeRange(r *http.Request, defaultLookback time.Duration) (int64, int64, error) {
+	end, err := getTimeArg(r, "end", time.Now().UnixNano())
+	if err != nil {
+		return 0, 0, err
+	}
+
+	lookback := defaultLookback
+	if s := r.FormValue("since"); s != "" {
+		d, err := timeutil.ParseDuration(s)
+		if err != nil {
+			return 0, 0, fmt.Errorf("cannot parse since=%q: %w", s, err)
+		}
+		lookback = d
+	}
+	start, err := getTimeArg(r, "start", end-lookback.Nanoseconds())
+	if err != nil {
+		return 0, 0, err
+	}
+	if start > end {
+		return 0, 0, fmt.Errorf("start=%q cannot exceed end=%q", r.FormValue("start"), r.FormValue("end"))
+	}
+	return start, end, nil
+}
+
+func getTimeArg(r *http.Request, argName string, defaultValue int64) (int64, error) {
+	s := r.FormValue(argName)
+	if s == "" {
+		return defaultValue, nil
+	}
+	nsecs, err := timeutil.ParseTimeAt(s, time.Now().UnixNano())
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse %s=%q: %w", argName, s, err)
+	}
+	return nsecs, nil
+}
+
+// getStep returns step arg.
+//
+// The default step is calculated in the same way as Loki does.
+func getStep(r *http.Request, start, end int64) (int64, error) {
+	s := r.FormValue("step")
+	if s == "" {
+		step := ((end - start) / 250 / 1e9) * 1e9
+		return max(step, 1e9), nil
+	}
+	d, err := timeutil.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse step=%q: %w", s, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("step=%q must be positive", s)
+	}
+	return d.Nanoseconds(), nil
+}
+
+func getLimit(r *http.Request) (int, error) {
+	s := r.FormValue("limit")
+	if s == "" {
+		return defaultLimit, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse limit=%q: %w", s, err)
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("limit=%q must be positive", s)
+	}
+	return n, nil
+}
+
+func isBackwardDirection(r *http.Request) (bool, error) {
+	s := r.FormValue("direction")
+	switch strings.ToLower(s) {
+	case "", "backward":
+		return true, nil
+	case "forward":
+		return false, nil
+	default:
+		return false, fmt.Errorf("unsupported direction=%q; supported values: forward, backward", s)
+	}
+}
+
+func getSortedValues(a []logstorage.ValueWithHits) []string {
+	values := make([]string, 0, len(a))
+	for _, v := range a {
+		values = append(values, v.Value)
+	}
+	sort.Strings(values)
+	return values
+}
+
+func getSortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,422 @@
+package loki
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestBucketsEvaluator(t *testing.T) {
+	f := func(query string, rows [][]string, resultExpected string) {
+		t.Helper()
+
+		e, err := parseLogQL(query)
+		if err != nil {
+			t.Fatalf("cannot parse query: %s", err)
+		}
+
+		// Evaluate the query at 600s, 660s and 720s
+		start := int64(600e9)
+		step := int64(60e9)
+		be := newBucketsEvaluator(e, start, step)
+
+		// rows contain bucket index, group-by field values and stats values
+		byFields := e.getStatsByFields()
+		columns := []logstorage.BlockColumn{
+			{
+				Name: "_time",
+			},
+		}
+		for _, f := range byFields {
+			columns = append(columns, logstorage.BlockColumn{
+				Name: f,
+			})
+		}
+		columns = append(columns, logstorage.BlockColumn{
+			Name: valueFieldName,
+		})
+		if e.rangeFunc == "avg_over_time" {
+			columns = append(columns, logstorage.BlockColumn{
+				Name: countFieldName,
+			})
+		}
+		for _, row := range rows {
+			for i := range columns {
+				v := row[i]
+				if i == 0 {
+					idx, err := time.ParseDuration(v)
+					if err != nil {
+						t.Fatalf("cannot parse bucket index: %s", err)
+					}
+					ts := be.firstBucket + int64(idx/time.Minute)*be.bucket
+					v = time.Unix(0, ts).UTC().Format(time.RFC3339Nano)
+				}
+				columns[i].Values = append(columns[i].Values, v)
+			}
+		}
+		db := &logstorage.DataBlock{
+			Columns: columns,
+		}
+		be.writeBlock(0, db)
+		if be.err != nil {
+			t.Fatalf("unexpected error: %s", be.err)
+		}
+
+		series := be.getSeries(3)
+		var bb bytes.Buffer
+		WriteMatrixResponse(&bb, series)
+		result := bb.String()
+		if result != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	// The bucket is 1m and the window is 2m, so every point is evaluated over two buckets.
+	// The bucket index is passed in minutes from the first bucket.
+	rows := [][]string{
+		{"0m", `{app="a",host="x"}`, "1"},
+		{"1m", `{app="a",host="x"}`, "2"},
+		{"2m", `{app="a",host="x"}`, "4"},
+		{"3m", `{app="a",host="x"}`, "8"},
+		{"3m", `{app="b",host="x"}`, "5"},
+	}
+	f(`count_over_time({host="x"}[2m])`, rows,
+		`{"status":"success","data":{"resultType":"matrix","result":[`+
+			`{"metric":{"app":"a","host":"x"},"values":[[600,"3"],[660,"6"],[720,"12"]]},`+
+			`{"metric":{"app":"b","host":"x"},"values":[[720,"5"]]}]}}`)
+	f(`rate({host="x"}[2m])`, rows,
+		`{"status":"success","data":{"resultType":"matrix","result":[`+
+			`{"metric":{"app":"a","host":"x"},"values":[[600,"0.025"],[660,"0.05"],[720,"0.1"]]},`+
+			`{"metric":{"app":"b","host":"x"},"values":[[720,"0.041666666666666664"]]}]}}`)
+	f(`max_over_time({host="x"} | unwrap size [2m])`, rows,
+		`{"status":"success","data":{"resultType":"matrix","result":[`+
+			`{"metric":{"app":"a","host":"x"},"values":[[600,"2"],[660,"4"],[720,"8"]]},`+
+			`{"metric":{"app":"b","host":"x"},"values":[[720,"5"]]}]}}`)
+	f(`min_over_time({host="x"} | unwrap size [2m])`, rows,
+		`{"status":"success","data":{"resultType":"matrix","result":[`+
+			`{"metric":{"app":"a","host":"x"},"values":[[600,"1"],[660,"2"],[720,"4"]]},`+
+			`{"metric":{"app":"b","host":"x"},"values":[[720,"5"]]}]}}`)
+
+	// aggregations over per-stream results
+	f(`max(count_over_time({host="x"}[2m]))`, rows,
+		`{"status":"success","data":{"resultType":"matrix","result":[`+
+			`{"metric":{},"values":[[600,"3"],[660,"6"],[720,"12"]]}]}}`)
+	f(`count(count_over_time({host="x"}[2m]))`, rows,
+		`{"status":"success","data":{"resultType":"matrix","result":[`+
+			`{"metric":{},"values":[[600,"1"],[660,"1"],[720,"2"]]}]}}`)
+	f(`avg(count_over_time({host="x"}[2m]))`, rows,
+		`{"status":"success","data":{"resultType":"matrix","result":[`+
+			`{"metric":{},"values":[[600,"3"],[660,"6"],[720,"8.5"]]}]}}`)
+	f(`min by (host) (count_over_time({host="x"}[2m]))`, [][]string{
+		{"0m", `{app="a",host="x"}`, "x", "1"},
+		{"1m", `{app="a",host="x"}`, "x", "2"},
+		{"1m", `{app="b",host="y"}`, "y", "7"},
+		{"2m", `{app="b",host="x"}`, "x", "1"},
+	}, `{"status":"success","data":{"resultType":"matrix","result":[`+
+		`{"metric":{"host":"x"},"values":[[600,"3"],[660,"1"],[720,"1"]]},`+
+		`{"metric":{"host":"y"},"values":[[600,"7"],[660,"7"]]}]}}`)
+
+	// aggregations pushed down to stats
+	f(`sum by (host) (count_over_time({app=~".+"}[2m]))`, [][]string{
+		{"0m", "x", "1"},
+		{"1m", "x", "2"},
+		{"1m", "", "3"},
+	}, `{"status":"success","data":{"resultType":"matrix","result":[`+
+		`{"metric":{"host":"x"},"values":[[600,"3"],[660,"2"]]},`+
+		`{"metric":{},"values":[[600,"3"],[660,"3"]]}]}}`)
+
+	// avg_over_time
+	f(`avg_over_time({host="x"} | unwrap size [2m])`, [][]string{
+		{"0m", `{app="a"}`, "10", "2"},
+		{"1m", `{app="a"}`, "20", "3"},
+		{"2m", `{app="a"}`, "", "0"},
+	}, `{"status":"success","data":{"resultType":"matrix","result":[`+
+		`{"metric":{"app":"a"},"values":[[600,"6"],[660,"6.666666666666667"]]}]}}`)
+
+	// non-numeric values are skipped
+	f(`max_over_time({host="x"} | unwrap size [2m])`, [][]string{
+		{"0m", `{app="a"}`, "foo"},
+		{"1m", `{app="a"}`, "3"},
+	}, `{"status":"success","data":{"resultType":"matrix","result":[`+
+		`{"metric":{"app":"a"},"values":[[600,"3"],[660,"3"]]}]}}`)
+}
+
+func TestQueryMetricsTooManyPoints(t *testing.T) {
+	e, err := parseLogQL(`count_over_time({app="foo"}[5m])`)
+	if err != nil {
+		t.Fatalf("cannot parse query: %s", err)
+	}
+	if _, err := queryMetrics(t.Context(), nil, e, 0, 1e6*1e9, 1e9); err == nil {
+		t.Fatalf("expecting non-nil error for too many points")
+	}
+	if _, err := queryMetrics(t.Context(), nil, e, 0, 1e4*1e9, 1e9+1); err == nil {
+		t.Fatalf("expecting non-nil error for too many buckets")
+	}
+	if _, err := queryMetrics(t.Context(), nil, e, 1e9, 0, 1e9); err == nil {
+		t.Fatalf("expecting non-nil error for end smaller than start")
+	}
+}
+
+func TestGetTimeRange(t *testing.T) {
+	f := func(args url.Values, startExpected, endExpected int64) {
+		t.Helper()
+
+		r := &http.Request{
+			Form: args,
+		}
+		start, end, err := getTimeRange(r, time.Hour)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if start != startExpected {
+			t.Fatalf("unexpected start; got %d; want %d", start, startExpected)
+		}
+		if end != endExpected {
+			t.Fatalf("unexpected end; got %d; want %d", end, endExpected)
+		}
+	}
+
+	// nanoseconds
+	f(url.Values{
+		"start": {"1700000000000000000"},
+		"end":   {"1700000100000000000"},
+	}, 1700000000000000000, 1700000100000000000)
+
+	// seconds and RFC3339
+	f(url.Values{
+		"start": {"1700000000"},
+		"end":   {"2023-11-14T22:15:00Z"},
+	}, 1700000000000000000, 1700000100000000000)
+
+	// default start
+	f(url.Values{
+		"end": {"1700000100000000000"},
+	}, 1700000100000000000-3600e9, 1700000100000000000)
+
+	// since
+	f(url.Values{
+		"end":   {"1700000100000000000"},
+		"since": {"5m"},
+	}, 1700000100000000000-300e9, 1700000100000000000)
+}
+
+func TestGetTimeRangeFailure(t *testing.T) {
+	f := func(args url.Values) {
+		t.Helper()
+
+		r := &http.Request{
+			Form: args,
+		}
+		if _, _, err := getTimeRange(r, time.Hour); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	f(url.Values{
+		"start": {"foo"},
+	})
+	f(url.Values{
+		"end": {"foo"},
+	})
+	f(url.Values{
+		"since": {"foo"},
+	})
+	f(url.Values{
+		"start": {"1700000100"},
+		"end":   {"1700000000"},
+	})
+}
+
+func TestGetStep(t *testing.T) {
+	f := func(step string, start, end, resultExpected int64) {
+		t.Helper()
+
+		r := &http.Request{
+			Form: url.Values{
+				"step": {step},
+			},
+		}
+		result, err := getStep(r, start, end)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if result != resultExpected {
+			t.Fatalf("unexpected step; got %d; want %d", result, resultExpected)
+		}
+	}
+
+	f("30s", 0, 3600e9, 30e9)
+	f("15", 0, 3600e9, 15e9)
+	f("1m", 0, 3600e9, 60e9)
+
+	// default step
+	f("", 0, 3600e9, 14e9)
+	f("", 0, 60e9, 1e9)
+}
+
+func TestLimitStreams(t *testing.T) {
+	f := func(streams []*logStream, limit int, resultExpected []*logStream) {
+		t.Helper()
+
+		result := limitStreams(streams, limit)
+		if !reflect.DeepEqual(result, resultExpected) {
+			t.Fatalf("unexpected result\ngot\n%v\nwant\n%v", result, resultExpected)
+		}
+	}
+
+	a := []logstorage.Field{{Name: "app", Value: "a"}}
+	b := []logstorage.Field{{Name: "app", Value: "b"}}
+
+	streams := []*logStream{
+		{
+			Labels:  a,
+			Entries: []logEntry{{1, "a1"}, {3, "a3"}, {5, "a5"}},
+		},
+		{
+			Labels:  b,
+			Entries: []logEntry{{2, "b2"}, {4, "b4"}},
+		},
+	}
+	f(streams, 10, streams)
+	f(streams, 5, streams)
+	f(streams, 3, []*logStream{
+		{
+			Labels:  a,
+			Entries: []logEntry{{3, "a3"}, {5, "a5"}},
+		},
+		{
+			Labels:  b,
+			Entries: []logEntry{{4, "b4"}},
+		},
+	})
+	f(streams, 1, []*logStream{
+		{
+			Labels:  a,
+			Entries: []logEntry{{5, "a5"}},
+		},
+	})
+}
+
+func TestTailProcessor(t *testing.T) {
+	tp := newTailProcessor()
+
+	writeRows := func(rows ...string) {
+		t.Helper()
+
+		var timestamps, streams, msgs []string
+		for i := 0; i < len(rows); i += 3 {
+			timestamps = append(timestamps, rows[i])
+			streams = append(streams, rows[i+1])
+			msgs = append(msgs, rows[i+2])
+		}
+		db := &logstorage.DataBlock{
+			Columns: []logstorage.BlockColumn{
+				{
+					Name:   "_time",
+					Values: timestamps,
+				},
+				{
+					Name:   "_stream",
+					Values: streams,
+				},
+				{
+					Name:   "_msg",
+					Values: msgs,
+				},
+			},
+		}
+		tp.writeBlock(0, db)
+	}
+	checkResult := func(resultExpected string) {
+		t.Helper()
+
+		streams, err := tp.getNewStreams()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var bb bytes.Buffer
+		WriteTailResponse(&bb, streams)
+		if bb.String() != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", bb.String(), resultExpected)
+		}
+	}
+
+	writeRows(
+		"2025-01-01T00:00:02Z", `{app="a"}`, "a2",
+		"2025-01-01T00:00:01Z", `{app="a"}`, "a1",
+		"2025-01-01T00:00:01Z", `{app="b"}`, "b1",
+	)
+	checkResult(`{"streams":[` +
+		`{"stream":{"app":"a"},"values":[["1735689601000000000","a1"],["1735689602000000000","a2"]]},` +
+		`{"stream":{"app":"b"},"values":[["1735689601000000000","b1"]]}]}`)
+
+	// Already returned logs must be skipped
+	writeRows(
+		"2025-01-01T00:00:02Z", `{app="a"}`, "a2",
+		"2025-01-01T00:00:03Z", `{app="a"}`, "a3",
+		"2025-01-01T00:00:01Z", `{app="b"}`, "b1",
+	)
+	checkResult(`{"streams":[` +
+		`{"stream":{"app":"a"},"values":[["1735689603000000000","a3"]]}]}`)
+
+	// No new logs
+	writeRows(
+		"2025-01-01T00:00:03Z", `{app="a"}`, "a3",
+	)
+	checkResult(`{"streams":[]}`)
+}
+
+func TestGetWebSocketAccept(t *testing.T) {
+	// See https://www.rfc-editor.org/rfc/rfc6455#section-1.3
+	result := getWebSocketAccept("dGhlIHNhbXBsZSBub25jZQ==")
+	resultExpected := "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="
+	if result != resultExpected {
+		t.Fatalf("unexpected result; got %q; want %q", result, resultExpected)
+	}
+}
+
+func TestResponses(t *testing.T) {
+	f := func(write func(bb *bytes.Buffer), resultExpected string) {
+		t.Helper()
+
+		var bb bytes.Buffer
+		write(&bb)
+		if bb.String() != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", bb.String(), resultExpected)
+		}
+	}
+
+	f(func(bb *bytes.Buffer) {
+		WriteStreamsResponse(bb, []*logStream{
+			{
+				Labels:  []logstorage.Field{{Name: "app", Value: "a"}},
+				Entries: []logEntry{{1700000000000000001, `foo "bar"`}},
+			},
+		})
+	}, `{"status":"success","data":{"resultType":"streams","result":[{"stream":{"app":"a"},"values":[["1700000000000000001","foo \"bar\""]]}]}}`)
+
+	f(func(bb *bytes.Buffer) {
+		WriteVectorResponse(bb, []*metricSeries{
+			{
+				Labels: []logstorage.Field{{Name: "app", Value: "a"}},
+				Points: []metricPoint{{1700000000500000000, 1.5}},
+			},
+		})
+	}, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{"app":"a"},"value":[1700000000.5,"1.5"]}]}}`)
+
+	f(func(bb *bytes.Buffer) {
+		WriteValuesResponse(bb, []string{"a", "b"})
+	}, `{"status":"success","data":["a","b"]}`)
+
+	f(func(bb *bytes.Buffer) {
+		WriteSeriesResponse(bb, [][]logstorage.Field{
+			{{Name: "app", Value: "a"}, {Name: "host", Value: "x"}},
+			{},
+		})
+	}, `{"status":"success","data":[{"app":"a","host":"x"},{}]}`)
+}
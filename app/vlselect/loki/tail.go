@@ -0,0 +1,309 @@
+package loki
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlstorage"
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+const (
+	// tailRefreshInterval is the interval between queries for new logs at /loki/api/v1/tail.
+	tailRefreshInterval = time.Second
+
+	// tailOffsetNsecs is the overlap between the time ranges of subsequent queries at /loki/api/v1/tail.
+	//
+	// It allows capturing logs, which were ingested with some delay.
+	tailOffsetNsecs = 5e9
+
+	// maxTailDelay is the maximum value for delay_for query arg.
+	maxTailDelay = 5 * time.Second
+)
+
+// ProcessTailRequest handles /select/loki/api/v1/tail request.
+//
+// The results are streamed to the client over WebSocket connection.
+//
+// See https://grafana.com/docs/loki/latest/reference/loki-http-api/#stream-logs
+func ProcessTailRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	liveTailRequests.Inc()
+	defer liveTailRequests.Dec()
+
+	tenantIDs, err := getTenantIDs(r)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	qStr := r.FormValue("query")
+	sel, err := parseLogQLSelector(qStr)
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot parse query %q: %s", qStr, err)
+		return
+	}
+	logsqlStr := sel.String() + " | fields _time, _stream, _msg"
+	q, err := logstorage.ParseQuery(logsqlStr)
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot parse query [%s] generated from %q: %s", logsqlStr, qStr, err)
+		return
+	}
+	if !q.CanLiveTail() {
+		httpserver.Errorf(w, r, "the query %q cannot be used in live tailing", qStr)
+		return
+	}
+
+	delay := time.Duration(0)
+	if s := r.FormValue("delay_for"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			httpserver.Errorf(w, r, "cannot parse delay_for=%q: %s", s, err)
+			return
+		}
+		delay = time.Duration(n) * time.Second
+		if delay < 0 || delay > maxTailDelay {
+			httpserver.Errorf(w, r, "delay_for=%q must be in the range [0..%d]", s, int(maxTailDelay.Seconds()))
+			return
+		}
+	}
+	limit, err := getLimit(r)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+	end := time.Now().UnixNano() - delay.Nanoseconds()
+	start, err := getTimeArg(r, "start", end-defaultQueryRangeLookback.Nanoseconds())
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+
+	wc, err := upgradeToWebSocket(w, r)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return
+	}
+
+	ctxWithCancel, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		// Stop tailing when the client closes the connection.
+		_ = wc.ReadLoop()
+		cancel()
+	}()
+
+	err = runTail(ctxWithCancel, wc, tenantIDs, q, start, end, limit, delay)
+	if err != nil && ctxWithCancel.Err() == nil {
+		logger.Warnf("error in live tailing for query %q: %s", qStr, err)
+		wc.Close(websocketCloseInternalError, truncateCloseReason(err.Error()))
+		return
+	}
+	wc.Close(websocketCloseNormal, "")
+}
+
+var liveTailRequests = metrics.NewCounter(`vl_loki_live_tailing_requests`)
+
+func runTail(ctx context.Context, wc *websocketConn, tenantIDs []logstorage.TenantID, q *logstorage.Query, start, end int64, limit int, delay time.Duration) error {
+	tp := newTailProcessor()
+
+	var qs logstorage.QueryStats
+	qctx := logstorage.NewQueryContext(ctx, &qs, tenantIDs, q)
+	defer vlstorage.UpdatePerQueryStatsMetrics(&qs)
+
+	ticker := time.NewTicker(tailRefreshInterval)
+	defer ticker.Stop()
+
+	var bb bytes.Buffer
+
+	isFirst := true
+	for {
+		qLocal := q.CloneWithTimeFilter(end, start, end)
+		if err := vlstorage.RunQuery(qctx.WithQuery(qLocal), tp.writeBlock); err != nil {
+			return fmt.Errorf("cannot execute query [%s]: %w", qLocal, err)
+		}
+		streams, err := tp.getNewStreams()
+		if err != nil {
+			return err
+		}
+		if isFirst {
+			// Send only the last limit logs on the first iteration like Loki does.
+			streams = limitStreams(streams, limit)
+			isFirst = false
+		}
+		if len(streams) > 0 {
+			bb.Reset()
+			WriteTailResponse(&bb, streams)
+			if err := wc.WriteText(bb.Bytes()); err != nil {
+				return fmt.Errorf("cannot send tail results to the client: %w", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			start = end - tailOffsetNsecs
+			end = time.Now().UnixNano() - delay.Nanoseconds()
+		}
+	}
+}
+
+// limitStreams leaves up to limit the most recent entries across all the streams.
+func limitStreams(streams []*logStream, limit int) []*logStream {
+	type streamEntry struct {
+		ls *logStream
+		e  logEntry
+	}
+	var all []streamEntry
+	for _, ls := range streams {
+		for _, e := range ls.Entries {
+			all = append(all, streamEntry{
+				ls: ls,
+				e:  e,
+			})
+		}
+	}
+	if len(all) <= limit {
+		return streams
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].e.Timestamp > all[j].e.Timestamp
+	})
+	all = all[:limit]
+
+	m := make(map[*logStream]*logStream)
+	for _, se := range all {
+		ls := m[se.ls]
+		if ls == nil {
+			ls = &logStream{
+				Labels: se.ls.Labels,
+			}
+			m[se.ls] = ls
+		}
+		ls.Entries = append(ls.Entries, se.e)
+	}
+
+	var result []*logStream
+	for _, ls := range streams {
+		if lsNew := m[ls]; lsNew != nil {
+			sort.SliceStable(lsNew.Entries, func(i, j int) bool {
+				return lsNew.Entries[i].Timestamp < lsNew.Entries[j].Timestamp
+			})
+			result = append(result, lsNew)
+		}
+	}
+	return result
+}
+
+func truncateCloseReason(s string) string {
+	// The close frame payload cannot exceed 125 bytes, including 2 bytes for the status code.
+	if len(s) > 123 {
+		s = s[:123]
+	}
+	return s
+}
+
+// tailProcessor collects logs for live tailing and returns only logs, which weren't returned yet.
+type tailProcessor struct {
+	mu sync.Mutex
+
+	streams        map[string]*logStream
+	lastTimestamps map[string]int64
+
+	err error
+}
+
+func newTailProcessor() *tailProcessor {
+	return &tailProcessor{
+		streams:        make(map[string]*logStream),
+		lastTimestamps: make(map[string]int64),
+	}
+}
+
+func (tp *tailProcessor) writeBlock(_ uint, db *logstorage.DataBlock) {
+	timestamps, ok := db.GetTimestamps(nil)
+	if !ok {
+		return
+	}
+	var streams, msgs []string
+	for _, c := range db.Columns {
+		switch c.Name {
+		case "_stream":
+			streams = c.Values
+		case "_msg":
+			msgs = c.Values
+		}
+	}
+
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	for i, timestamp := range timestamps {
+		stream := ""
+		if streams != nil {
+			stream = streams[i]
+		}
+		ls := tp.streams[stream]
+		if ls == nil {
+			stream = strings.Clone(stream)
+			labels, err := logstorage.ParseStreamFields(nil, stream)
+			if err != nil && stream != "" && tp.err == nil {
+				tp.err = fmt.Errorf("cannot parse stream %s: %w", stream, err)
+			}
+			ls = &logStream{
+				Labels: labels,
+			}
+			tp.streams[stream] = ls
+		}
+		line := ""
+		if msgs != nil {
+			line = strings.Clone(msgs[i])
+		}
+		ls.Entries = append(ls.Entries, logEntry{
+			Timestamp: timestamp,
+			Line:      line,
+		})
+	}
+}
+
+// getNewStreams returns streams with logs, which weren't returned by the previous calls.
+func (tp *tailProcessor) getNewStreams() ([]*logStream, error) {
+	if tp.err != nil {
+		return nil, tp.err
+	}
+
+	var result []*logStream
+	for _, stream := range getSortedKeys(tp.streams) {
+		ls := tp.streams[stream]
+		entries := ls.Entries
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].Timestamp < entries[j].Timestamp
+		})
+
+		if lastTimestamp, ok := tp.lastTimestamps[stream]; ok {
+			// Skip already returned logs
+			for len(entries) > 0 && entries[0].Timestamp <= lastTimestamp {
+				entries = entries[1:]
+			}
+		}
+		if len(entries) > 0 {
+			result = append(result, &logStream{
+				Labels:  ls.Labels,
+				Entries: entries,
+			})
+			tp.lastTimestamps[stream] = entries[len(entries)-1].Timestamp
+		}
+	}
+	clear(tp.streams)
+	return result, nil
+}
@@ -0,0 +1,265 @@
+package loki
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// websocketGUID is used for calculating Sec-WebSocket-Accept header. See https://www.rfc-editor.org/rfc/rfc6455#section-1.3
+	websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	websocketOpText  = 0x1
+	websocketOpClose = 0x8
+	websocketOpPing  = 0x9
+	websocketOpPong  = 0xa
+
+	websocketCloseNormal        = 1000
+	websocketCloseInternalError = 1011
+
+	// websocketWriteTimeout is the timeout for writing a single frame to WebSocket client.
+	websocketWriteTimeout = 10 * time.Second
+
+	// websocketMaxFrameSize is the maximum payload size for frames sent by WebSocket client.
+	websocketMaxFrameSize = 64 * 1024
+)
+
+// websocketConn is a minimal server side of WebSocket connection according to https://www.rfc-editor.org/rfc/rfc6455
+//
+// It supports sending text messages and responding to ping and close frames from the client.
+type websocketConn struct {
+	c  net.Conn
+	br *bufio.Reader
+
+	// mu serializes writes to c
+	mu     sync.Mutex
+	closed bool
+}
+
+// upgradeToWebSocket upgrades the HTTP connection for r to WebSocket connection.
+func upgradeToWebSocket(w http.ResponseWriter, r *http.Request) (*websocketConn, error) {
+	if r.Method != http.MethodGet {
+		return nil, fmt.Errorf("unexpected method %q for WebSocket request; want GET", r.Method)
+	}
+	if !headerContainsToken(r.Header, "Connection", "upgrade") || !headerContainsToken(r.Header, "Upgrade", "websocket") {
+		return nil, fmt.Errorf("missing `Connection: Upgrade` and `Upgrade: websocket` request headers")
+	}
+	if v := r.Header.Get("Sec-WebSocket-Version"); v != "13" {
+		return nil, fmt.Errorf("unsupported Sec-WebSocket-Version=%q; want 13", v)
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, fmt.Errorf("missing Sec-WebSocket-Key request header")
+	}
+
+	hj := getHijacker(w)
+	if hj == nil {
+		return nil, fmt.Errorf("the connection cannot be upgraded to WebSocket, since %T doesn't support hijacking", w)
+	}
+	c, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("cannot hijack the connection: %w", err)
+	}
+
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + getWebSocketAccept(key) + "\r\n\r\n"
+	if err := c.SetWriteDeadline(time.Now().Add(websocketWriteTimeout)); err != nil {
+		_ = c.Close()
+		return nil, fmt.Errorf("cannot set write deadline: %w", err)
+	}
+	if _, err := io.WriteString(c, resp); err != nil {
+		_ = c.Close()
+		return nil, fmt.Errorf("cannot send WebSocket handshake response: %w", err)
+	}
+
+	// Reset the deadlines possibly set by the http server.
+	if err := c.SetDeadline(time.Time{}); err != nil {
+		_ = c.Close()
+		return nil, fmt.Errorf("cannot reset connection deadline: %w", err)
+	}
+
+	wc := &websocketConn{
+		c:  c,
+		br: brw.Reader,
+	}
+	return wc, nil
+}
+
+// getHijacker returns http.Hijacker for w.
+//
+// The http.ResponseWriter passed to request handlers is wrapped by lib/httpserver into a struct,
+// which embeds the original http.ResponseWriter, but doesn't expose Hijack method.
+// So the embedded http.ResponseWriter is searched for http.Hijacker.
+func getHijacker(w http.ResponseWriter) http.Hijacker {
+	for w != nil {
+		if hj, ok := w.(http.Hijacker); ok {
+			return hj
+		}
+		if uw, ok := w.(interface{ Unwrap() http.ResponseWriter }); ok {
+			w = uw.Unwrap()
+			continue
+		}
+
+		v := reflect.ValueOf(w)
+		if v.Kind() == reflect.Pointer {
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			return nil
+		}
+		f := v.FieldByName("ResponseWriter")
+		if !f.IsValid() || !f.CanInterface() {
+			return nil
+		}
+		w, _ = f.Interface().(http.ResponseWriter)
+	}
+	return nil
+}
+
+func getWebSocketAccept(key string) string {
+	h := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+func headerContainsToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, s := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WriteText sends text message with the given data to the client.
+func (wc *websocketConn) WriteText(data []byte) error {
+	return wc.writeFrame(websocketOpText, data)
+}
+
+// Close sends close frame with the given code and reason to the client and closes the connection.
+func (wc *websocketConn) Close(code uint16, reason string) {
+	payload := binary.BigEndian.AppendUint16(nil, code)
+	payload = append(payload, reason...)
+	_ = wc.writeFrame(websocketOpClose, payload)
+
+	wc.mu.Lock()
+	wc.closed = true
+	wc.mu.Unlock()
+
+	_ = wc.c.Close()
+}
+
+func (wc *websocketConn) writeFrame(opcode byte, payload []byte) error {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+
+	if wc.closed {
+		return fmt.Errorf("the connection is closed")
+	}
+
+	header := []byte{0x80 | opcode}
+	n := len(payload)
+	switch {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xffff:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	if err := wc.c.SetWriteDeadline(time.Now().Add(websocketWriteTimeout)); err != nil {
+		return err
+	}
+	if _, err := wc.c.Write(header); err != nil {
+		return err
+	}
+	_, err := wc.c.Write(payload)
+	return err
+}
+
+// ReadLoop reads frames from the client until the client closes the connection or an error occurs.
+//
+// It responds to ping frames with pong frames. The payload of data frames is ignored.
+func (wc *websocketConn) ReadLoop() error {
+	for {
+		opcode, payload, err := wc.readFrame()
+		if err != nil {
+			return err
+		}
+		switch opcode {
+		case websocketOpClose:
+			wc.Close(websocketCloseNormal, "")
+			return nil
+		case websocketOpPing:
+			if err := wc.writeFrame(websocketOpPong, payload); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (wc *websocketConn) readFrame() (byte, []byte, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(wc.br, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := hdr[0] & 0x0f
+	masked := hdr[1]&0x80 != 0
+	n := uint64(hdr[1] & 0x7f)
+	switch n {
+	case 126:
+		var b [2]byte
+		if _, err := io.ReadFull(wc.br, b[:]); err != nil {
+			return 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err := io.ReadFull(wc.br, b[:]); err != nil {
+			return 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(b[:])
+	}
+	if !masked {
+		return 0, nil, fmt.Errorf("unexpected unmasked frame from WebSocket client")
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(wc.br, mask[:]); err != nil {
+		return 0, nil, err
+	}
+
+	if n > websocketMaxFrameSize {
+		if opcode >= websocketOpClose {
+			return 0, nil, fmt.Errorf("too big control frame from WebSocket client: %d bytes", n)
+		}
+		// Skip big data frames, since their contents isn't used.
+		if _, err := io.CopyN(io.Discard, wc.br, int64(n)); err != nil {
+			return 0, nil, err
+		}
+		return opcode, nil, nil
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(wc.br, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/cgroup"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
@@ -17,6 +18,7 @@ import (
 
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlselect/internalselect"
 	"github.com/VictoriaMetrics/VictoriaLogs/app/vlselect/logsql"
+	"github.com/VictoriaMetrics/VictoriaLogs/app/vlselect/loki"
 )
 
 var (
@@ -27,6 +29,11 @@ var (
 		"limit is reached; see also -search.maxQueryDuration")
 	maxQueryDuration = flag.Duration("search.maxQueryDuration", time.Second*30, "The maximum duration for query execution. It can be overridden to a smaller value on a per-query basis via 'timeout' query arg")
 
+	resetCacheAuthKey = flagutil.NewPassword("search.resetCacheAuthKey", "Optional authKey for resetting the cache for /select/logsql/stats_query_range results "+
+		"via /internal/resetStatsQueryRangeCache . It overrides -httpAuth.* . See https://docs.victoriametrics.com/victorialogs/querying/#stats-query-range-cache")
+	tenantsAuthKey = flagutil.NewPassword("search.tenantsAuthKey", "Optional authKey, which must be passed in query string to /select/tenants . It overrides -httpAuth.* . "+
+		"See https://docs.victoriametrics.com/victorialogs/querying/#querying-tenants")
+
 	disableSelect   = flag.Bool("select.disable", false, "Whether to disable /select/* HTTP endpoints")
 	disableInternal = flag.Bool("internalselect.disable", false, "Whether to disable /internal/select/* HTTP endpoints")
 )
@@ -48,10 +55,12 @@ func getDefaultMaxConcurrentRequests() int {
 // Init initializes vlselect
 func Init() {
 	concurrencyLimitCh = make(chan struct{}, *maxConcurrentRequests)
+	logsql.Init()
 }
 
 // Stop stops vlselect
 func Stop() {
+	logsql.Stop()
 }
 
 var concurrencyLimitCh chan struct{}
@@ -86,6 +95,14 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 		return selectHandler(w, r, path)
 	}
 
+	if path == "/internal/resetStatsQueryRangeCache" {
+		if !httpserver.CheckAuthFlag(w, r, resetCacheAuthKey) {
+			return true
+		}
+		logsql.ResetStatsQueryRangeCache()
+		return true
+	}
+
 	if strings.HasPrefix(path, "/internal/select/") {
 		if *disableInternal || *disableSelect {
 			httpserver.Errorf(w, r, "requests to /internal/select/* are disabled with -internalselect.disable or -select.disable command-line flag")
@@ -129,6 +146,12 @@ func selectHandler(w http.ResponseWriter, r *http.Request, path string) bool {
 		logsql.ProcessLiveTailRequest(ctx, w, r)
 		return true
 	}
+	if path == "/select/loki/api/v1/tail" {
+		lokiTailRequests.Inc()
+		// Process Loki live tailing request without timeout and concurrency limit by the same reasons as for /select/logsql/tail.
+		loki.ProcessTailRequest(ctx, w, r)
+		return true
+	}
 
 	// Limit the number of concurrent queries, which can consume big amounts of CPU time.
 	startTime := time.Now()
@@ -213,6 +236,11 @@ func processSelectRequest(ctx context.Context, w http.ResponseWriter, r *http.Re
 	httpserver.EnableCORS(w, r)
 	startTime := time.Now()
 	switch path {
+	case "/select/logsql/export_native":
+		logsqlExportNativeRequests.Inc()
+		logsql.ProcessExportNativeRequest(ctx, w, r)
+		logsqlExportNativeDuration.UpdateDuration(startTime)
+		return true
 	case "/select/logsql/facets":
 		logsqlFacetsRequests.Inc()
 		logsql.ProcessFacetsRequest(ctx, w, r)
@@ -263,14 +291,56 @@ func processSelectRequest(ctx context.Context, w http.ResponseWriter, r *http.Re
 		logsql.ProcessStreamIDsRequest(ctx, w, r)
 		logsqlStreamIDsDuration.UpdateDuration(startTime)
 		return true
+	case "/select/logsql/stream_field_recommendations":
+		logsqlStreamFieldRecommendationsRequests.Inc()
+		logsql.ProcessStreamFieldRecommendationsRequest(ctx, w, r)
+		logsqlStreamFieldRecommendationsDuration.UpdateDuration(startTime)
+		return true
 	case "/select/logsql/streams":
 		logsqlStreamsRequests.Inc()
 		logsql.ProcessStreamsRequest(ctx, w, r)
 		logsqlStreamsDuration.UpdateDuration(startTime)
 		return true
-	default:
-		return false
+	case "/select/tenants":
+		tenantsRequests.Inc()
+		if !httpserver.CheckAuthFlag(w, r, tenantsAuthKey) {
+			return true
+		}
+		logsql.ProcessTenantsRequest(ctx, w, r)
+		tenantsDuration.UpdateDuration(startTime)
+		return true
+	case "/select/loki/api/v1/labels":
+		lokiLabelsRequests.Inc()
+		loki.ProcessLabelsRequest(ctx, w, r)
+		lokiLabelsDuration.UpdateDuration(startTime)
+		return true
+	case "/select/loki/api/v1/query":
+		lokiQueryRequests.Inc()
+		loki.ProcessQueryRequest(ctx, w, r)
+		lokiQueryDuration.UpdateDuration(startTime)
+		return true
+	case "/select/loki/api/v1/query_range":
+		lokiQueryRangeRequests.Inc()
+		loki.ProcessQueryRangeRequest(ctx, w, r)
+		lokiQueryRangeDuration.UpdateDuration(startTime)
+		return true
+	case "/select/loki/api/v1/series":
+		lokiSeriesRequests.Inc()
+		loki.ProcessSeriesRequest(ctx, w, r)
+		lokiSeriesDuration.UpdateDuration(startTime)
+		return true
+	}
+
+	if strings.HasPrefix(path, "/select/loki/api/v1/label/") && strings.HasSuffix(path, "/values") {
+		labelName := strings.TrimPrefix(path, "/select/loki/api/v1/label/")
+		labelName = strings.TrimSuffix(labelName, "/values")
+		lokiLabelValuesRequests.Inc()
+		loki.ProcessLabelValuesRequest(ctx, w, r, labelName)
+		lokiLabelValuesDuration.UpdateDuration(startTime)
+		return true
 	}
+
+	return false
 }
 
 // getMaxQueryDuration returns the maximum duration for query from r.
@@ -287,6 +357,9 @@ func getMaxQueryDuration(r *http.Request) time.Duration {
 }
 
 var (
+	logsqlExportNativeRequests = metrics.NewCounter(`vl_http_requests_total{path="/select/logsql/export_native"}`)
+	logsqlExportNativeDuration = metrics.NewSummary(`vl_http_request_duration_seconds{path="/select/logsql/export_native"}`)
+
 	logsqlFacetsRequests = metrics.NewCounter(`vl_http_requests_total{path="/select/logsql/facets"}`)
 	logsqlFacetsDuration = metrics.NewSummary(`vl_http_request_duration_seconds{path="/select/logsql/facets"}`)
 
@@ -317,9 +390,33 @@ var (
 	logsqlStreamIDsRequests = metrics.NewCounter(`vl_http_requests_total{path="/select/logsql/stream_ids"}`)
 	logsqlStreamIDsDuration = metrics.NewSummary(`vl_http_request_duration_seconds{path="/select/logsql/stream_ids"}`)
 
+	logsqlStreamFieldRecommendationsRequests = metrics.NewCounter(`vl_http_requests_total{path="/select/logsql/stream_field_recommendations"}`)
+	logsqlStreamFieldRecommendationsDuration = metrics.NewSummary(`vl_http_request_duration_seconds{path="/select/logsql/stream_field_recommendations"}`)
+
 	logsqlStreamsRequests = metrics.NewCounter(`vl_http_requests_total{path="/select/logsql/streams"}`)
 	logsqlStreamsDuration = metrics.NewSummary(`vl_http_request_duration_seconds{path="/select/logsql/streams"}`)
 
+	tenantsRequests = metrics.NewCounter(`vl_http_requests_total{path="/select/tenants"}`)
+	tenantsDuration = metrics.NewSummary(`vl_http_request_duration_seconds{path="/select/tenants"}`)
+
 	// no need to track duration for tail requests, as they usually take long time
 	logsqlTailRequests = metrics.NewCounter(`vl_http_requests_total{path="/select/logsql/tail"}`)
+
+	lokiLabelsRequests = metrics.NewCounter(`vl_http_requests_total{path="/select/loki/api/v1/labels"}`)
+	lokiLabelsDuration = metrics.NewSummary(`vl_http_request_duration_seconds{path="/select/loki/api/v1/labels"}`)
+
+	lokiLabelValuesRequests = metrics.NewCounter(`vl_http_requests_total{path="/select/loki/api/v1/label/{}/values"}`)
+	lokiLabelValuesDuration = metrics.NewSummary(`vl_http_request_duration_seconds{path="/select/loki/api/v1/label/{}/values"}`)
+
+	lokiQueryRequests = metrics.NewCounter(`vl_http_requests_total{path="/select/loki/api/v1/query"}`)
+	lokiQueryDuration = metrics.NewSummary(`vl_http_request_duration_seconds{path="/select/loki/api/v1/query"}`)
+
+	lokiQueryRangeRequests = metrics.NewCounter(`vl_http_requests_total{path="/select/loki/api/v1/query_range"}`)
+	lokiQueryRangeDuration = metrics.NewSummary(`vl_http_request_duration_seconds{path="/select/loki/api/v1/query_range"}`)
+
+	lokiSeriesRequests = metrics.NewCounter(`vl_http_requests_total{path="/select/loki/api/v1/series"}`)
+	lokiSeriesDuration = metrics.NewSummary(`vl_http_request_duration_seconds{path="/select/loki/api/v1/series"}`)
+
+	// no need to track duration for tail requests, as they usually take long time
+	lokiTailRequests = metrics.NewCounter(`vl_http_requests_total{path="/select/loki/api/v1/tail"}`)
 )
@@ -1,11 +1,13 @@
 package vlstorage
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
@@ -27,10 +29,19 @@ var (
 	maxDiskSpaceUsageBytes = flagutil.NewBytes("retention.maxDiskSpaceUsageBytes", 0, "The maximum disk space usage at -storageDataPath before older per-day "+
 		"partitions are automatically dropped; see https://docs.victoriametrics.com/victorialogs/#retention-by-disk-space-usage ; see also -retentionPeriod")
 	maxDiskUsagePercent = flag.Int("retention.maxDiskUsagePercent", 0, "The maximum allowed disk usage percentage (1-100) for the filesystem that contains -storageDataPath before older per-day partitions are automatically dropped; mutually exclusive with -retention.maxDiskSpaceUsageBytes; see https://docs.victoriametrics.com/victorialogs/#retention-by-disk-space-usage-percent")
-	futureRetention     = flagutil.NewRetentionDuration("futureRetention", "2d", "Log entries with timestamps bigger than now+futureRetention are rejected during data ingestion; "+
+	retentionTenant     = flagutil.NewArrayString("retention.tenant", "Optional retention rules for particular tenants in the form accountID:projectID:retention "+
+		"or for particular log streams at the tenant in the form accountID:projectID{stream_filter}:retention; for example, -retention.tenant='12:34:90d' "+
+		"or -retention.tenant='12:34{app=\"nginx\"}:3d'. Log entries outside these rules are automatically deleted; the -retentionPeriod is still applied to all the logs; "+
+		"see https://docs.victoriametrics.com/victorialogs/#retention-by-tenant")
+	futureRetention = flagutil.NewRetentionDuration("futureRetention", "2d", "Log entries with timestamps bigger than now+futureRetention are rejected during data ingestion; "+
 		"see https://docs.victoriametrics.com/victorialogs/#retention")
 	storageDataPath = flag.String("storageDataPath", "victoria-logs-data", "Path to directory where to store VictoriaLogs data; "+
 		"see https://docs.victoriametrics.com/victorialogs/#storage")
+	storageDataPathCold = flag.String("storageDataPath.cold", "", "Optional path to directory where to move per-day partitions older than -storageDataPath.coldAfter from -storageDataPath. "+
+		"For example, it may point to a cheaper HDD or network storage. The moved partitions remain searchable; see https://docs.victoriametrics.com/victorialogs/#tiered-storage")
+	storageDataPathColdAfter = flagutil.NewRetentionDuration("storageDataPath.coldAfter", "30d", "Per-day partitions older than this duration are moved "+
+		"from -storageDataPath to -storageDataPath.cold in background; the minimum supported value is 1d (one day); "+
+		"see https://docs.victoriametrics.com/victorialogs/#tiered-storage")
 	inmemoryDataFlushInterval = flag.Duration("inmemoryDataFlushInterval", 5*time.Second, "The interval for guaranteed saving of in-memory data to disk. "+
 		"The saved data survives unclean shutdowns such as OOM crash, hardware reset, SIGKILL, etc. "+
 		"Bigger intervals may help increase the lifetime of flash storage with limited write cycles (e.g. Raspberry PI). "+
@@ -41,18 +52,48 @@ var (
 		"see https://docs.victoriametrics.com/victorialogs/data-ingestion/ ; see also -logNewStreams")
 	minFreeDiskSpaceBytes = flagutil.NewBytes("storage.minFreeDiskSpaceBytes", 10e6, "The minimum free disk space at -storageDataPath after which "+
 		"the storage stops accepting new data")
+	maxNewStreamsPerDay = flagutil.NewArrayString("tenant.maxNewStreamsPerDay", "Optional limit on the number of log streams per tenant per day. "+
+		"It can be set either in the form 'limit' for all the tenants or in the form 'accountID:projectID:limit' for the given tenant; for example, "+
+		"-tenant.maxNewStreamsPerDay=10000 -tenant.maxNewStreamsPerDay=12:34:100000 . "+
+		"Log entries for new streams exceeding the limit are handled according to -tenant.streamsLimitAction; see https://docs.victoriametrics.com/victorialogs/#stream-cardinality-limits")
+	maxNewStreamsPerHour = flagutil.NewArrayString("tenant.maxNewStreamsPerHour", "Optional limit on the number of new log streams per tenant per hour. "+
+		"It can be set either in the form 'limit' for all the tenants or in the form 'accountID:projectID:limit' for the given tenant; for example, "+
+		"-tenant.maxNewStreamsPerHour=1000 -tenant.maxNewStreamsPerHour=12:34:10000 . "+
+		"Log entries for new streams exceeding the limit are handled according to -tenant.streamsLimitAction; see https://docs.victoriametrics.com/victorialogs/#stream-cardinality-limits")
+	streamsLimitAction = flag.String("tenant.streamsLimitAction", "reject", "The action to apply to log entries for new streams exceeding -tenant.maxNewStreamsPerDay or -tenant.maxNewStreamsPerHour. "+
+		"Supported values: 'reject' - drop such log entries; 'fallback' - store such log entries into {stream_limit_exceeded=\"true\"} stream "+
+		"with the original stream in the original_stream field. See https://docs.victoriametrics.com/victorialogs/#stream-cardinality-limits")
+	maxStoredBytes = flagutil.NewArrayString("tenant.maxStoredBytes", "Optional limit on the size of the stored logs per tenant at -storageDataPath. "+
+		"It can be set either in the form 'limit' for all the tenants or in the form 'accountID:projectID:limit' for the given tenant; for example, "+
+		"-tenant.maxStoredBytes=100GiB -tenant.maxStoredBytes=12:34:1TiB . "+
+		"Data ingestion requests for tenants exceeding the limit are rejected with 429 Too Many Requests; see https://docs.victoriametrics.com/victorialogs/#tenant-limits")
 
 	forceMergeAuthKey = flagutil.NewPassword("forceMergeAuthKey", "authKey, which must be passed in query string to /internal/force_merge . It overrides -httpAuth.* . "+
 		"See https://docs.victoriametrics.com/victorialogs/#forced-merge")
 	forceFlushAuthKey = flagutil.NewPassword("forceFlushAuthKey", "authKey, which must be passed in query string to /internal/force_flush . It overrides -httpAuth.* . "+
 		"See https://docs.victoriametrics.com/victorialogs/#forced-flush")
 
+	deleteAuthKey = flagutil.NewPassword("deleteAuthKey", "authKey, which must be passed in query string to /internal/delete . It overrides -httpAuth.* . "+
+		"See https://docs.victoriametrics.com/victorialogs/#deleting-logs")
+
 	partitionManageAuthKey = flagutil.NewPassword("partitionManageAuthKey", "authKey, which must be passed in query string to /internal/partition/* . It overrides -httpAuth.* . "+
 		"See https://docs.victoriametrics.com/victorialogs/#partitions-lifecycle")
 
+	tenantsUsageAuthKey = flagutil.NewPassword("tenantsUsageAuthKey", "authKey, which must be passed in query string to /internal/tenants/usage . It overrides -httpAuth.* . "+
+		"See https://docs.victoriametrics.com/victorialogs/#tenant-usage")
+	tenantUsageMetrics = flag.Bool("tenant.usageMetrics", false, "Whether to expose per-tenant usage metrics such as vl_tenant_ingested_bytes_total and vl_tenant_stored_bytes at /metrics page. "+
+		"Enabling this option may result in a big number of exposed metrics if the storage contains many tenants. See https://docs.victoriametrics.com/victorialogs/#tenant-usage")
+
 	storageNodeAddrs = flagutil.NewArrayString("storageNode", "Comma-separated list of TCP addresses for storage nodes to route the ingested logs to and to send select queries to. "+
 		"If the list is empty, then the ingested logs are stored and queried locally from -storageDataPath")
-	insertConcurrency        = flag.Int("insert.concurrency", 2, "The average number of concurrent data ingestion requests, which can be sent to every -storageNode")
+	replicationFactor = flag.Int("replicationFactor", 1, "How many copies of every ingested log entry to store at distinct -storageNode nodes. "+
+		"Every log stream is queried at a single -storageNode node among the nodes holding its copies if -replicationFactor is bigger than 1. "+
+		"See https://docs.victoriametrics.com/victorialogs/cluster/#replication")
+	insertConcurrency       = flag.Int("insert.concurrency", 2, "The average number of concurrent data ingestion requests, which can be sent to every -storageNode")
+	insertMaxRetryQueueSize = flagutil.NewBytes("insert.maxRetryQueueSize", 256*1024*1024, "The maximum size of the ingested data per every -storageNode, "+
+		"which is kept in memory for re-sending to the unavailable -storageNode after it becomes available again if -replicationFactor is bigger than 1. "+
+		"The data exceeding this limit is dropped and is available only at the remaining replicas. "+
+		"See https://docs.victoriametrics.com/victorialogs/cluster/#replication")
 	insertDisableCompression = flag.Bool("insert.disableCompression", false, "Whether to disable compression when sending the ingested data to -storageNode nodes. "+
 		"Disabled compression reduces CPU usage at the cost of higher network usage")
 	selectDisableCompression = flag.Bool("select.disableCompression", false, "Whether to disable compression for select query responses received from -storageNode nodes. "+
@@ -111,8 +152,50 @@ func initLocalStorage() {
 	if *maxDiskUsagePercent < 0 || *maxDiskUsagePercent > 100 {
 		logger.Fatalf("-retention.maxDiskUsagePercent must be between 1 and 100; got %d", *maxDiskUsagePercent)
 	}
+	var retentionRules []*logstorage.RetentionRule
+	for _, s := range *retentionTenant {
+		rr, err := logstorage.ParseRetentionRule(s)
+		if err != nil {
+			logger.Fatalf("cannot parse -retention.tenant=%q: %s", s, err)
+		}
+		retentionRules = append(retentionRules, rr)
+	}
+	if *storageDataPathCold != "" && storageDataPathColdAfter.Duration() < 24*time.Hour {
+		logger.Fatalf("-storageDataPath.coldAfter cannot be smaller than a day; got %s", storageDataPathColdAfter)
+	}
+	maxNewStreamsPerDayLimits, err := logstorage.ParseTenantLimits(*maxNewStreamsPerDay, func(s string) (int64, error) {
+		return strconv.ParseInt(s, 10, 64)
+	})
+	if err != nil {
+		logger.Fatalf("cannot parse -tenant.maxNewStreamsPerDay: %s", err)
+	}
+	maxNewStreamsPerHourLimits, err := logstorage.ParseTenantLimits(*maxNewStreamsPerHour, func(s string) (int64, error) {
+		return strconv.ParseInt(s, 10, 64)
+	})
+	if err != nil {
+		logger.Fatalf("cannot parse -tenant.maxNewStreamsPerHour: %s", err)
+	}
+	var streamsLimitFallback bool
+	switch *streamsLimitAction {
+	case "reject":
+	case "fallback":
+		streamsLimitFallback = true
+	default:
+		logger.Fatalf("unsupported -tenant.streamsLimitAction=%q; supported values: reject, fallback", *streamsLimitAction)
+	}
+	maxStoredBytesLimits, err := logstorage.ParseTenantLimits(*maxStoredBytes, func(s string) (int64, error) {
+		var b flagutil.Bytes
+		if err := b.Set(s); err != nil {
+			return 0, err
+		}
+		return b.N, nil
+	})
+	if err != nil {
+		logger.Fatalf("cannot parse -tenant.maxStoredBytes: %s", err)
+	}
 	cfg := &logstorage.StorageConfig{
 		Retention:              retentionPeriod.Duration(),
+		RetentionRules:         retentionRules,
 		MaxDiskSpaceUsageBytes: maxDiskSpaceUsageBytes.N,
 		MaxDiskUsagePercent:    *maxDiskUsagePercent,
 		FlushInterval:          *inmemoryDataFlushInterval,
@@ -120,6 +203,13 @@ func initLocalStorage() {
 		LogNewStreams:          *logNewStreams,
 		LogIngestedRows:        *logIngestedRows,
 		MinFreeDiskSpaceBytes:  minFreeDiskSpaceBytes.N,
+		ColdPath:               *storageDataPathCold,
+		ColdAfter:              storageDataPathColdAfter.Duration(),
+
+		MaxNewStreamsPerDayPerTenant:  maxNewStreamsPerDayLimits,
+		MaxNewStreamsPerHourPerTenant: maxNewStreamsPerHourLimits,
+		StreamsLimitFallback:          streamsLimitFallback,
+		MaxStoredBytesPerTenant:       maxStoredBytesLimits,
 	}
 	logger.Infof("opening storage at -storageDataPath=%s", *storageDataPath)
 	startTime := time.Now()
@@ -152,11 +242,18 @@ func initNetworkStorage() {
 		isTLSs[i] = storageNodeTLS.GetOptionalArg(i)
 	}
 
+	if *replicationFactor < 1 {
+		logger.Fatalf("-replicationFactor cannot be smaller than 1; got %d", *replicationFactor)
+	}
+	if *replicationFactor > len(*storageNodeAddrs) {
+		logger.Fatalf("-replicationFactor=%d cannot exceed the number of -storageNode nodes: %d", *replicationFactor, len(*storageNodeAddrs))
+	}
+
 	logger.Infof("starting insert service for nodes %s", *storageNodeAddrs)
-	netstorageInsert = netinsert.NewStorage(*storageNodeAddrs, authCfgs, isTLSs, *insertConcurrency, *insertDisableCompression)
+	netstorageInsert = netinsert.NewStorage(*storageNodeAddrs, authCfgs, isTLSs, *insertConcurrency, *insertDisableCompression, *replicationFactor, insertMaxRetryQueueSize.IntN())
 
 	logger.Infof("initializing select service for nodes %s", *storageNodeAddrs)
-	netstorageSelect = netselect.NewStorage(*storageNodeAddrs, authCfgs, isTLSs, *selectDisableCompression)
+	netstorageSelect = netselect.NewStorage(*storageNodeAddrs, authCfgs, isTLSs, *selectDisableCompression, *replicationFactor)
 
 	logger.Infof("initialized all the network services")
 }
@@ -224,6 +321,8 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 		return processForceMerge(w, r)
 	case "/internal/force_flush":
 		return processForceFlush(w, r)
+	case "/internal/delete":
+		return processDelete(w, r)
 	case "/internal/partition/attach":
 		return processPartitionAttach(w, r)
 	case "/internal/partition/detach":
@@ -234,6 +333,8 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 		return processPartitionSnapshotCreate(w, r)
 	case "/internal/partition/snapshot/list":
 		return processPartitionSnapshotList(w, r)
+	case "/internal/tenants/usage":
+		return processTenantsUsage(w, r)
 	}
 	return false
 }
@@ -276,6 +377,38 @@ func processForceFlush(w http.ResponseWriter, r *http.Request) bool {
 	return true
 }
 
+func processDelete(w http.ResponseWriter, r *http.Request) bool {
+	if !httpserver.CheckAuthFlag(w, r, deleteAuthKey) {
+		return true
+	}
+
+	tenantID, err := logstorage.GetTenantIDFromRequest(r)
+	if err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return true
+	}
+
+	qStr := r.FormValue("query")
+	if qStr == "" {
+		httpserver.Errorf(w, r, "missing `query` arg with the filter for logs to delete")
+		return true
+	}
+	q, err := logstorage.ParseQueryAtTimestamp(qStr, time.Now().UnixNano())
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot parse query [%s]: %s", qStr, err)
+		return true
+	}
+
+	tenantIDs := []logstorage.TenantID{tenantID}
+	qctx := logstorage.NewQueryContext(r.Context(), &logstorage.QueryStats{}, tenantIDs, q)
+	if err := DeleteRows(qctx); err != nil {
+		httpserver.Errorf(w, r, "%s", err)
+		return true
+	}
+
+	return true
+}
+
 func processPartitionAttach(w http.ResponseWriter, r *http.Request) bool {
 	if localStorage == nil {
 		// There are no partitions in non-local storage
@@ -375,6 +508,22 @@ func processPartitionSnapshotList(w http.ResponseWriter, r *http.Request) bool {
 	return true
 }
 
+func processTenantsUsage(w http.ResponseWriter, r *http.Request) bool {
+	if !httpserver.CheckAuthFlag(w, r, tenantsUsageAuthKey) {
+		return true
+	}
+
+	partitionNamePrefix := r.FormValue("partition_prefix")
+	tus, err := GetTenantsUsage(r.Context(), partitionNamePrefix)
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot obtain tenants usage: %s", err)
+		return true
+	}
+
+	writeJSONResponse(w, tus)
+	return true
+}
+
 func writeJSONResponse(w http.ResponseWriter, response any) {
 	responseBody, err := json.Marshal(response)
 	if err != nil {
@@ -405,6 +554,26 @@ func (*Storage) CanWriteData() error {
 	return nil
 }
 
+// CanWriteTenantData returns non-nil error if it cannot write data for the given tenantID to vlstorage because of tenant limits.
+//
+// See https://docs.victoriametrics.com/victorialogs/#tenant-limits
+func (*Storage) CanWriteTenantData(tenantID logstorage.TenantID) error {
+	var err error
+	if localStorage != nil {
+		err = localStorage.CanWriteTenantData(tenantID)
+	} else {
+		// Tenant limits on the stored data are enforced by remote storage nodes, which report tenants exceeding the limits.
+		err = netstorageInsert.CanWriteTenantData(tenantID)
+	}
+	if err != nil {
+		return &httpserver.ErrorWithStatusCode{
+			Err:        err,
+			StatusCode: http.StatusTooManyRequests,
+		}
+	}
+	return nil
+}
+
 // MustAddRows adds lr to vlstorage
 //
 // It is advised to call CanWriteData() before calling MustAddRows()
@@ -418,6 +587,36 @@ func (*Storage) MustAddRows(lr *logstorage.LogRows) {
 	}
 }
 
+// GetTenantsUsage returns per-tenant usage stats for partitions with names starting with partitionNamePrefix.
+//
+// The stats are aggregated across all the -storageNode nodes in cluster mode.
+func GetTenantsUsage(ctx context.Context, partitionNamePrefix string) ([]*logstorage.TenantUsage, error) {
+	if localStorage != nil {
+		return localStorage.GetTenantsUsage(partitionNamePrefix), nil
+	}
+	return netstorageSelect.GetTenantsUsage(ctx, partitionNamePrefix)
+}
+
+// GetDataSetVersion returns the version of the set of stored logs.
+//
+// The version changes when the stored logs are changed other than by data ingestion - for example, when partitions are attached,
+// detached or dropped because of retention, or when logs are deleted. It persists across restarts, so it can be used
+// for invalidating persisted caches for query results.
+func GetDataSetVersion(ctx context.Context) (uint64, error) {
+	if localStorage != nil {
+		return localStorage.GetDataSetVersion(), nil
+	}
+	return netstorageSelect.GetDataSetVersion(ctx)
+}
+
+// GetTenantIDs returns sorted tenantIDs with logs on the given [start, end] time range.
+func GetTenantIDs(ctx context.Context, start, end int64) ([]logstorage.TenantID, error) {
+	if localStorage != nil {
+		return localStorage.GetTenantIDs(ctx, start, end)
+	}
+	return netstorageSelect.GetTenantIDs(ctx, start, end)
+}
+
 // RunQuery runs the given qctx and calls writeBlock for the returned data blocks
 func RunQuery(qctx *logstorage.QueryContext, writeBlock logstorage.WriteDataBlockFunc) error {
 	qOpt, offset, limit := qctx.Query.GetLastNResultsQuery()
@@ -432,6 +631,14 @@ func RunQuery(qctx *logstorage.QueryContext, writeBlock logstorage.WriteDataBloc
 	return netstorageSelect.RunQuery(qctx, writeBlock)
 }
 
+// DeleteRows marks log entries matching qctx as deleted.
+func DeleteRows(qctx *logstorage.QueryContext) error {
+	if localStorage != nil {
+		return localStorage.DeleteRows(qctx)
+	}
+	return netstorageSelect.DeleteRows(qctx)
+}
+
 // GetFieldNames executes qctx and returns field names seen in results.
 func GetFieldNames(qctx *logstorage.QueryContext) ([]logstorage.ValueWithHits, error) {
 	if localStorage != nil {
@@ -497,6 +704,10 @@ func writeStorageMetrics(w io.Writer, strg *logstorage.Storage) {
 	}
 	metrics.WriteGaugeUint64(w, fmt.Sprintf(`vl_free_disk_space_bytes{path=%q}`, *storageDataPath), fs.MustGetFreeSpace(*storageDataPath))
 	metrics.WriteGaugeUint64(w, fmt.Sprintf(`vl_total_disk_space_bytes{path=%q}`, *storageDataPath), fs.MustGetTotalSpace(*storageDataPath))
+	if *storageDataPathCold != "" {
+		metrics.WriteGaugeUint64(w, fmt.Sprintf(`vl_free_disk_space_bytes{path=%q}`, *storageDataPathCold), fs.MustGetFreeSpace(*storageDataPathCold))
+		metrics.WriteGaugeUint64(w, fmt.Sprintf(`vl_total_disk_space_bytes{path=%q}`, *storageDataPathCold), fs.MustGetTotalSpace(*storageDataPathCold))
+	}
 
 	isReadOnly := uint64(0)
 	if ss.IsReadOnly {
@@ -538,6 +749,8 @@ func writeStorageMetrics(w io.Writer, strg *logstorage.Storage) {
 	metrics.WriteGaugeUint64(w, `vl_pending_rows{type="indexdb"}`, ss.IndexdbPendingItems)
 
 	metrics.WriteGaugeUint64(w, `vl_partitions`, ss.PartitionsCount)
+	metrics.WriteGaugeUint64(w, `vl_cold_partitions`, ss.ColdPartitionsCount)
+	metrics.WriteCounterUint64(w, `vl_partitions_moved_to_cold_total`, ss.PartitionsMovedToColdTotal)
 	metrics.WriteCounterUint64(w, `vl_streams_created_total`, ss.StreamsCreatedTotal)
 
 	metrics.WriteGaugeUint64(w, `vl_indexdb_rows`, ss.IndexdbItemsCount)
@@ -557,6 +770,27 @@ func writeStorageMetrics(w io.Writer, strg *logstorage.Storage) {
 
 	metrics.WriteCounterUint64(w, `vl_rows_dropped_total{reason="too_big_timestamp"}`, ss.RowsDroppedTooBigTimestamp)
 	metrics.WriteCounterUint64(w, `vl_rows_dropped_total{reason="too_small_timestamp"}`, ss.RowsDroppedTooSmallTimestamp)
+
+	for _, o := range strg.GetTopStreamsLimitOffenders(10) {
+		metrics.WriteCounterUint64(w, fmt.Sprintf(`vl_tenant_rejected_streams_total{accountID="%d",projectID="%d",stream_fields=%q}`,
+			o.TenantID.AccountID, o.TenantID.ProjectID, o.StreamFields), o.RejectedStreams)
+	}
+
+	if *tenantUsageMetrics {
+		writeTenantUsageMetrics(w, strg)
+	}
+}
+
+func writeTenantUsageMetrics(w io.Writer, strg *logstorage.Storage) {
+	for tenantID, tis := range strg.GetTenantsIngestedStats() {
+		metrics.WriteCounterUint64(w, fmt.Sprintf(`vl_tenant_ingested_bytes_total{accountID="%d",projectID="%d"}`, tenantID.AccountID, tenantID.ProjectID), tis.BytesCount)
+		metrics.WriteCounterUint64(w, fmt.Sprintf(`vl_tenant_ingested_rows_total{accountID="%d",projectID="%d"}`, tenantID.AccountID, tenantID.ProjectID), tis.RowsCount)
+	}
+	for tenantID, ts := range strg.GetTenantsStats() {
+		metrics.WriteGaugeUint64(w, fmt.Sprintf(`vl_tenant_stored_bytes{accountID="%d",projectID="%d",type="compressed"}`, tenantID.AccountID, tenantID.ProjectID), ts.CompressedSizeBytes)
+		metrics.WriteGaugeUint64(w, fmt.Sprintf(`vl_tenant_stored_bytes{accountID="%d",projectID="%d",type="uncompressed"}`, tenantID.AccountID, tenantID.ProjectID), ts.UncompressedSizeBytes)
+		metrics.WriteGaugeUint64(w, fmt.Sprintf(`vl_tenant_stored_rows{accountID="%d",projectID="%d"}`, tenantID.AccountID, tenantID.ProjectID), ts.RowsCount)
+	}
 }
 
 var activeForceMerges = metrics.NewCounter("vl_active_force_merges")
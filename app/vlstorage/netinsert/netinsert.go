@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -32,14 +33,44 @@ const maxInsertBlockSize = 2 * 1024 * 1024
 // It must be changed every time the data encoding at /internal/insert HTTP endpoint is changed.
 const ProtocolVersion = "v1"
 
+// RejectedTenantsHeader is the name of the HTTP response header at /internal/insert endpoint, which contains comma-separated list
+// of accountID:projectID tenants exceeding the limits on the stored logs at the storage node.
+//
+// See https://docs.victoriametrics.com/victorialogs/#tenant-limits
+const RejectedTenantsHeader = "VL-Rejected-Tenants"
+
+// rejectedTenantsDuration is the duration for rejecting data ingestion requests for tenants reported via RejectedTenantsHeader.
+//
+// It is aligned with the interval for updating the size of the stored logs per tenant at storage nodes.
+const rejectedTenantsDuration = 10 * time.Second
+
+const tenantLimitReasonStoredBytes = "stored_bytes"
+
 // Storage is a network storage for sending data to remote storage nodes in the cluster.
 type Storage struct {
 	sns []*storageNode
 
 	disableCompression bool
 
+	// replicationFactor is the number of distinct storage nodes every log entry is written to.
+	replicationFactor int
+
+	// ssp contains storage nodes for log stream shards if replicationFactor > 1.
+	ssp *logstorage.StreamShardsPlacement
+
+	// maxRetryQueueSize is the maximum size of data blocks, which are kept in memory per every storage node
+	// for re-sending to this node after it becomes available again if replicationFactor > 1.
+	maxRetryQueueSize int
+
 	srt *streamRowsTracker
 
+	// rejectedTenantsLock protects rejectedTenants.
+	rejectedTenantsLock sync.Mutex
+
+	// rejectedTenants contains unix timestamps until data ingestion requests must be rejected for the tenants,
+	// which exceed the limits on the stored logs at storage nodes.
+	rejectedTenants map[logstorage.TenantID]uint64
+
 	pendingDataBuffers chan *bytesutil.ByteBuffer
 
 	stopCh chan struct{}
@@ -67,9 +98,21 @@ type storageNode struct {
 	pendingData          *bytesutil.ByteBuffer
 	pendingDataLastFlush time.Time
 
+	// retryQueue contains data blocks, which couldn't be sent to the storage node when replicationFactor > 1.
+	//
+	// These blocks are re-sent to the storage node after it becomes available again,
+	// since replicated log streams must be stored at all their replicas.
+	retryQueueMu   sync.Mutex
+	retryQueue     []*bytesutil.ByteBuffer
+	retryQueueSize int
+
 	// sendErrors counts failed send attempts for this storage node.
 	sendErrors *metrics.Counter
 
+	// droppedBytes counts the bytes of replicated data, which couldn't be sent to this storage node
+	// because of the retry queue overflow.
+	droppedBytes *metrics.Counter
+
 	// disabledUntil contains unix timestamp until the storageNode is disabled for data writing.
 	disabledUntil atomic.Uint64
 
@@ -96,13 +139,21 @@ func newStorageNode(s *Storage, addr string, ac *promauth.Config, isTLS bool) *s
 		},
 		ac: ac,
 
-		sendErrors: metrics.GetOrCreateCounter(fmt.Sprintf(`vl_insert_remote_send_errors_total{addr=%q}`, addr)),
+		sendErrors:   metrics.GetOrCreateCounter(fmt.Sprintf(`vl_insert_remote_send_errors_total{addr=%q}`, addr)),
+		droppedBytes: metrics.GetOrCreateCounter(fmt.Sprintf(`vl_insert_remote_dropped_bytes_total{addr=%q}`, addr)),
 
 		pendingData: &bytesutil.ByteBuffer{},
 	}
 
 	sn.isReachable.Store(true)
 
+	_ = metrics.GetOrCreateGauge(fmt.Sprintf(`vl_insert_remote_retry_queue_bytes{addr=%q}`, addr), func() float64 {
+		sn.retryQueueMu.Lock()
+		n := sn.retryQueueSize
+		sn.retryQueueMu.Unlock()
+		return float64(n)
+	})
+
 	s.wg.Add(1)
 	go func() {
 		defer s.wg.Done()
@@ -126,10 +177,65 @@ func (sn *storageNode) backgroundFlusher() {
 	for {
 		select {
 		case <-sn.s.stopCh:
+			sn.retryQueueMu.Lock()
+			if sn.retryQueueSize > 0 {
+				logger.Errorf("dropping %d bytes of data, which couldn't be sent to the storage node %q", sn.retryQueueSize, sn.addr)
+				sn.droppedBytes.Add(sn.retryQueueSize)
+			}
+			sn.retryQueueMu.Unlock()
 			return
 		case <-t.C:
 			sn.flushPendingData()
+			sn.flushRetryQueue()
+		}
+	}
+}
+
+// addToRetryQueue adds a copy of pendingData to the retry queue for sn.
+func (sn *storageNode) addToRetryQueue(pendingData *bytesutil.ByteBuffer) {
+	dataLen := pendingData.Len()
+
+	sn.retryQueueMu.Lock()
+	defer sn.retryQueueMu.Unlock()
+
+	if sn.retryQueueSize+dataLen > sn.s.maxRetryQueueSize {
+		logger.Errorf("dropping %d bytes of data for the storage node %q, since the retry queue size for this node exceeds -insert.maxRetryQueueSize=%d; "+
+			"the dropped logs are available at the remaining replicas according to -replicationFactor", dataLen, sn.addr, sn.s.maxRetryQueueSize)
+		sn.droppedBytes.Add(dataLen)
+		return
+	}
+
+	bb := &bytesutil.ByteBuffer{}
+	bb.MustWrite(pendingData.B)
+	sn.retryQueue = append(sn.retryQueue, bb)
+	sn.retryQueueSize += dataLen
+}
+
+// flushRetryQueue re-sends data blocks from the retry queue to sn.
+//
+// It stops on the first error, so the remaining blocks are re-sent later.
+func (sn *storageNode) flushRetryQueue() {
+	for {
+		sn.retryQueueMu.Lock()
+		if len(sn.retryQueue) == 0 {
+			sn.retryQueueMu.Unlock()
+			return
+		}
+		bb := sn.retryQueue[0]
+		sn.retryQueueMu.Unlock()
+
+		if err := sn.sendInsertRequest(bb); err != nil {
+			if !errors.Is(err, errTemporarilyDisabled) {
+				logger.Warnf("%s; re-trying to send the data block later", err)
+			}
+			return
 		}
+
+		sn.retryQueueMu.Lock()
+		sn.retryQueue[0] = nil
+		sn.retryQueue = sn.retryQueue[1:]
+		sn.retryQueueSize -= bb.Len()
+		sn.retryQueueMu.Unlock()
 	}
 }
 
@@ -196,6 +302,17 @@ func (sn *storageNode) mustSendInsertRequest(pendingData *bytesutil.ByteBuffer)
 		return
 	}
 
+	if sn.s.replicationFactor > 1 {
+		// Do not re-route the data block to the remaining nodes, since every log stream must be stored only at its replicas,
+		// so it can be read from a single replica during querying. Re-send the data block to the same node
+		// after it becomes available again, so the node doesn't miss logs ingested during its unavailability.
+		if !errors.Is(err, errTemporarilyDisabled) {
+			logger.Warnf("%s; re-trying to send the data block to the same node in background, since it must be stored at all the replicas according to -replicationFactor", err)
+		}
+		sn.addToRetryQueue(pendingData)
+		return
+	}
+
 	if !errors.Is(err, errTemporarilyDisabled) {
 		logger.Warnf("%s; re-routing the data block to the remaining nodes", err)
 	}
@@ -263,6 +380,7 @@ func (sn *storageNode) sendInsertRequest(pendingData *bytesutil.ByteBuffer) erro
 
 	if resp.StatusCode/100 == 2 {
 		sn.isReachable.Store(true)
+		sn.s.registerRejectedTenants(resp.Header.Get(RejectedTenantsHeader))
 		return nil
 	}
 
@@ -296,15 +414,26 @@ var zstdBufPool bytesutil.ByteBufferPool
 //
 // If disableCompression is set, then the data is sent uncompressed to the remote storage.
 //
+// Every log entry is written to replicationFactor distinct storage nodes. The replicationFactor is limited by the number of addrs.
+// If replicationFactor > 1, then every log stream is written to the same storage nodes, so it can be read from a single replica
+// by netselect.Storage created with the same addrs and replicationFactor. Data blocks, which couldn't be sent to some storage node,
+// are kept in memory and are re-sent to this node after it becomes available again. Up to maxRetryQueueSize bytes are kept per every storage node.
+//
 // Call MustStop on the returned storage when it is no longer needed.
-func NewStorage(addrs []string, authCfgs []*promauth.Config, isTLSs []bool, concurrency int, disableCompression bool) *Storage {
+func NewStorage(addrs []string, authCfgs []*promauth.Config, isTLSs []bool, concurrency int, disableCompression bool, replicationFactor, maxRetryQueueSize int) *Storage {
 	pendingDataBuffers := make(chan *bytesutil.ByteBuffer, concurrency*len(addrs))
 	for i := 0; i < cap(pendingDataBuffers); i++ {
 		pendingDataBuffers <- &bytesutil.ByteBuffer{}
 	}
 
+	replicationFactor = max(replicationFactor, 1)
+	replicationFactor = min(replicationFactor, len(addrs))
+
 	s := &Storage{
 		disableCompression: disableCompression,
+		replicationFactor:  replicationFactor,
+		ssp:                logstorage.NewStreamShardsPlacement(addrs, replicationFactor),
+		maxRetryQueueSize:  maxRetryQueueSize,
 		pendingDataBuffers: pendingDataBuffers,
 		stopCh:             make(chan struct{}),
 	}
@@ -341,10 +470,70 @@ func (s *Storage) MustStop() {
 }
 
 // AddRow adds the given log row into s.
+//
+// The row is written to s.replicationFactor distinct storage nodes.
 func (s *Storage) AddRow(streamHash uint64, r *logstorage.InsertRow) {
-	idx := s.srt.getNodeIdx(streamHash)
-	sn := s.sns[idx]
-	sn.addRow(r)
+	if s.replicationFactor == 1 {
+		idx := s.srt.getNodeIdx(streamHash)
+		sn := s.sns[idx]
+		sn.addRow(r)
+		return
+	}
+
+	// Replicated log streams aren't spread among all the storage nodes, since every stream shard
+	// must be stored only at the nodes it is placed at, so it could be read from a single replica.
+	// See logstorage.StreamShardsPlacement.
+	shard := logstorage.GetStreamShard(streamHash)
+	for _, idx := range s.ssp.GetNodeIdxs(shard) {
+		sn := s.sns[idx]
+		sn.addRow(r)
+	}
+}
+
+// CanWriteTenantData returns non-nil error if storage nodes have recently reported that the given tenantID exceeds the limits on the stored logs.
+//
+// See https://docs.victoriametrics.com/victorialogs/#tenant-limits
+func (s *Storage) CanWriteTenantData(tenantID logstorage.TenantID) error {
+	s.rejectedTenantsLock.Lock()
+	deadline, ok := s.rejectedTenants[tenantID]
+	s.rejectedTenantsLock.Unlock()
+
+	if !ok || fasttime.UnixTimestamp() > deadline {
+		return nil
+	}
+	logstorage.GetTenantRejectedRequestsCounter(tenantID, tenantLimitReasonStoredBytes).Inc()
+	return fmt.Errorf("cannot store logs for the tenant %d:%d, since it exceeds the limit on the stored logs size at storage nodes; "+
+		"see https://docs.victoriametrics.com/victorialogs/#tenant-limits", tenantID.AccountID, tenantID.ProjectID)
+}
+
+// registerRejectedTenants registers tenants from RejectedTenantsHeader value returned by a storage node.
+func (s *Storage) registerRejectedTenants(header string) {
+	if header == "" {
+		return
+	}
+
+	currentTime := fasttime.UnixTimestamp()
+	deadline := currentTime + uint64(rejectedTenantsDuration.Seconds())
+
+	s.rejectedTenantsLock.Lock()
+	defer s.rejectedTenantsLock.Unlock()
+
+	if s.rejectedTenants == nil {
+		s.rejectedTenants = make(map[logstorage.TenantID]uint64)
+	}
+	for tenantID, d := range s.rejectedTenants {
+		if d < currentTime {
+			delete(s.rejectedTenants, tenantID)
+		}
+	}
+	for _, tenant := range strings.Split(header, ",") {
+		tenantID, err := logstorage.ParseTenantID(tenant)
+		if err != nil {
+			logger.Warnf("cannot parse tenant from %s response header %q: %s", RejectedTenantsHeader, header, err)
+			continue
+		}
+		s.rejectedTenants[tenantID] = deadline
+	}
 }
 
 func (s *Storage) sendInsertRequestToAnyNode(pendingData *bytesutil.ByteBuffer) bool {
@@ -2,11 +2,23 @@ package netinsert
 
 import (
 	"fmt"
+	"io"
 	"math"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/cespare/xxhash/v2"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
 )
 
 func TestStreamRowsTracker(t *testing.T) {
@@ -55,3 +67,181 @@ func TestStreamRowsTracker(t *testing.T) {
 	nodesCount = 9
 	f(rowsCount, streamsCount, nodesCount)
 }
+
+func TestStorageRejectedTenants(t *testing.T) {
+	s := &Storage{}
+
+	tenantRejected := logstorage.TenantID{AccountID: 12, ProjectID: 34}
+	tenantOther := logstorage.TenantID{AccountID: 5, ProjectID: 6}
+
+	// No tenants are rejected initially
+	if err := s.CanWriteTenantData(tenantRejected); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	s.registerRejectedTenants("")
+	s.registerRejectedTenants("12:34,invalid")
+	if err := s.CanWriteTenantData(tenantRejected); err == nil {
+		t.Fatalf("expecting non-nil error for the rejected tenant")
+	}
+	if err := s.CanWriteTenantData(tenantOther); err != nil {
+		t.Fatalf("unexpected error for the tenant, which isn't rejected: %s", err)
+	}
+
+	// Expired tenants must be accepted again
+	s.rejectedTenantsLock.Lock()
+	s.rejectedTenants[tenantRejected] = fasttime.UnixTimestamp() - 1
+	s.rejectedTenantsLock.Unlock()
+	if err := s.CanWriteTenantData(tenantRejected); err != nil {
+		t.Fatalf("unexpected error for the expired tenant: %s", err)
+	}
+}
+
+type testStorageNode struct {
+	srv *httptest.Server
+
+	isDown atomic.Bool
+
+	mu         sync.Mutex
+	timestamps map[int64]struct{}
+}
+
+func newTestStorageNode(t *testing.T) *testStorageNode {
+	t.Helper()
+
+	tsn := &testStorageNode{
+		timestamps: make(map[int64]struct{}),
+	}
+	tsn.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tsn.isDown.Load() {
+			http.Error(w, "the storage node is unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ir := logstorage.GetInsertRow()
+		defer logstorage.PutInsertRow(ir)
+
+		tsn.mu.Lock()
+		defer tsn.mu.Unlock()
+		for len(data) > 0 {
+			tail, err := ir.UnmarshalInplace(data)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			data = tail
+			tsn.timestamps[ir.Timestamp] = struct{}{}
+		}
+	}))
+	return tsn
+}
+
+func (tsn *testStorageNode) hasTimestamp(timestamp int64) bool {
+	tsn.mu.Lock()
+	_, ok := tsn.timestamps[timestamp]
+	tsn.mu.Unlock()
+	return ok
+}
+
+func TestStorageReplicationNodeOutage(t *testing.T) {
+	const nodesCount = 3
+	const replicationFactor = 2
+	const rowsCount = 1000
+
+	var tsns []*testStorageNode
+	var addrs []string
+	var authCfgs []*promauth.Config
+	for i := 0; i < nodesCount; i++ {
+		tsn := newTestStorageNode(t)
+		defer tsn.srv.Close()
+		tsns = append(tsns, tsn)
+		addrs = append(addrs, strings.TrimPrefix(tsn.srv.URL, "http://"))
+
+		ac, err := (&promauth.Options{}).NewConfig()
+		if err != nil {
+			t.Fatalf("cannot create auth config: %s", err)
+		}
+		authCfgs = append(authCfgs, ac)
+	}
+	isTLSs := make([]bool, nodesCount)
+	s := NewStorage(addrs, authCfgs, isTLSs, 1, true, replicationFactor, 64*1024*1024)
+	defer s.MustStop()
+
+	flushPendingData := func() {
+		t.Helper()
+
+		for _, sn := range s.sns {
+			sn.pendingDataMu.Lock()
+			pendingData := sn.grabPendingDataForFlushLocked()
+			sn.pendingDataMu.Unlock()
+
+			sn.mustSendInsertRequest(pendingData)
+		}
+	}
+
+	// Take the node down and ingest logs
+	const downNodeIdx = 1
+	tsns[downNodeIdx].isDown.Store(true)
+
+	streamHashes := make([]uint64, rowsCount)
+	for i := range streamHashes {
+		streamHashes[i] = xxhash.Sum64([]byte(fmt.Sprintf("stream %d", i%100)))
+		r := &logstorage.InsertRow{
+			StreamTagsCanonical: "foo",
+			Timestamp:           int64(i),
+			Fields: []logstorage.Field{
+				{
+					Name:  "_msg",
+					Value: fmt.Sprintf("message %d", i),
+				},
+			},
+		}
+		s.AddRow(streamHashes[i], r)
+	}
+	flushPendingData()
+
+	snDown := s.sns[downNodeIdx]
+	snDown.retryQueueMu.Lock()
+	retryQueueSize := snDown.retryQueueSize
+	snDown.retryQueueMu.Unlock()
+	if retryQueueSize == 0 {
+		t.Fatalf("expecting non-empty retry queue for the unavailable node")
+	}
+
+	// Bring the node back. The retry queue must be sent to it in background.
+	tsns[downNodeIdx].isDown.Store(false)
+	snDown.disabledUntil.Store(0)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		snDown.retryQueueMu.Lock()
+		retryQueueSize = snDown.retryQueueSize
+		snDown.retryQueueMu.Unlock()
+		if retryQueueSize == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the retry queue hasn't been sent to the node; retryQueueSize=%d", retryQueueSize)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := snDown.droppedBytes.Get(); n != 0 {
+		t.Fatalf("unexpected number of dropped bytes; got %d; want 0", n)
+	}
+
+	// Every log entry must be available at every node holding its shard,
+	// since queries read every shard from a single node among these nodes.
+	for i, streamHash := range streamHashes {
+		shard := logstorage.GetStreamShard(streamHash)
+		for _, nodeIdx := range s.ssp.GetNodeIdxs(shard) {
+			if !tsns[nodeIdx].hasTimestamp(int64(i)) {
+				t.Fatalf("missing log entry %d at the node %d holding the shard %d", i, nodeIdx, shard)
+			}
+		}
+	}
+}
@@ -2,20 +2,26 @@ package netselect
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"math"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/cespare/xxhash/v2"
+
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/contextutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding/zstd"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httputil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
@@ -30,37 +36,57 @@ const (
 	// FieldNamesProtocolVersion is the version of the protocol used for /internal/select/field_names HTTP endpoint.
 	//
 	// It must be updated every time the protocol changes.
-	FieldNamesProtocolVersion = "v2"
+	FieldNamesProtocolVersion = "v3"
 
 	// FieldValuesProtocolVersion is the version of the protocol used for /internal/select/field_values HTTP endpoint.
 	//
 	// It must be updated every time the protocol changes.
-	FieldValuesProtocolVersion = "v2"
+	FieldValuesProtocolVersion = "v3"
 
 	// StreamFieldNamesProtocolVersion is the version of the protocol used for /internal/select/stream_field_names HTTP endpoint.
 	//
 	// It must be updated every time the protocol changes.
-	StreamFieldNamesProtocolVersion = "v2"
+	StreamFieldNamesProtocolVersion = "v3"
 
 	// StreamFieldValuesProtocolVersion is the version of the protocol used for /internal/select/stream_field_values HTTP endpoint.
 	//
 	// It must be updated every time the protocol changes.
-	StreamFieldValuesProtocolVersion = "v2"
+	StreamFieldValuesProtocolVersion = "v3"
 
 	// StreamsProtocolVersion is the version of the protocol used for /internal/select/streams HTTP endpoint.
 	//
 	// It must be updated every time the protocol changes.
-	StreamsProtocolVersion = "v2"
+	StreamsProtocolVersion = "v3"
 
 	// StreamIDsProtocolVersion is the version of the protocol used for /internal/select/stream_ids HTTP endpoint.
 	//
 	// It must be updated every time the protocol changes.
-	StreamIDsProtocolVersion = "v2"
+	StreamIDsProtocolVersion = "v3"
 
 	// QueryProtocolVersion is the version of the protocol used for /internal/select/query HTTP endpoint.
 	//
 	// It must be updated every time the protocol changes.
-	QueryProtocolVersion = "v2"
+	QueryProtocolVersion = "v3"
+
+	// DeleteProtocolVersion is the version of the protocol used for /internal/select/delete HTTP endpoint.
+	//
+	// It must be updated every time the protocol changes.
+	DeleteProtocolVersion = "v1"
+
+	// TenantsUsageProtocolVersion is the version of the protocol used for /internal/select/tenants_usage HTTP endpoint.
+	//
+	// It must be updated every time the protocol changes.
+	TenantsUsageProtocolVersion = "v1"
+
+	// TenantIDsProtocolVersion is the version of the protocol used for /internal/select/tenant_ids HTTP endpoint.
+	//
+	// It must be updated every time the protocol changes.
+	TenantIDsProtocolVersion = "v1"
+
+	// DataSetVersionProtocolVersion is the version of the protocol used for /internal/select/data_set_version HTTP endpoint.
+	//
+	// It must be updated every time the protocol changes.
+	DataSetVersionProtocolVersion = "v1"
 )
 
 // Storage is a network storage for querying remote storage nodes in the cluster.
@@ -68,6 +94,14 @@ type Storage struct {
 	sns []*storageNode
 
 	disableCompression bool
+
+	// replicationFactor is the number of storage nodes every log entry is stored at.
+	//
+	// Every log stream is queried at a single storage node among its replicas if replicationFactor > 1.
+	replicationFactor int
+
+	// ssp contains storage nodes for log stream shards if replicationFactor > 1.
+	ssp *logstorage.StreamShardsPlacement
 }
 
 type storageNode struct {
@@ -88,6 +122,11 @@ type storageNode struct {
 
 	// sendErrors counts failed send attempts for this storage node.
 	sendErrors *metrics.Counter
+
+	// disabledUntil contains unix timestamp until the storageNode is considered unavailable.
+	//
+	// Unavailable storageNode is queried only if all the other replicas are unavailable.
+	disabledUntil atomic.Uint64
 }
 
 func newStorageNode(s *Storage, addr string, ac *promauth.Config, isTLS bool) *storageNode {
@@ -230,6 +269,74 @@ func (sn *storageNode) getStreamIDs(qctx *logstorage.QueryContext, limit uint64)
 	return sn.getValuesWithHits(qctx, "/internal/select/stream_ids", args)
 }
 
+func (sn *storageNode) deleteRows(qctx *logstorage.QueryContext) error {
+	args := sn.getCommonArgs(DeleteProtocolVersion, qctx)
+
+	responseBody, _, err := sn.getResponseBodyForPathAndArgs(qctx.Context, "/internal/select/delete", args)
+	if err != nil {
+		return err
+	}
+	_ = responseBody.Close()
+	return nil
+}
+
+func (sn *storageNode) getTenantsUsage(ctx context.Context, partitionNamePrefix string) ([]*logstorage.TenantUsage, error) {
+	args := url.Values{}
+	args.Set("version", TenantsUsageProtocolVersion)
+	args.Set("partition_prefix", partitionNamePrefix)
+	args.Set("disable_compression", fmt.Sprintf("%v", sn.s.disableCompression))
+
+	data, err := sn.getResponseForPathAndArgs(ctx, "/internal/select/tenants_usage", args)
+	if err != nil {
+		return nil, err
+	}
+
+	var tus []*logstorage.TenantUsage
+	if err := json.Unmarshal(data, &tus); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal tenants usage from storage node %q: %w", sn.addr, err)
+	}
+	return tus, nil
+}
+
+func (sn *storageNode) getTenantIDs(ctx context.Context, start, end int64) ([]logstorage.TenantID, error) {
+	args := url.Values{}
+	args.Set("version", TenantIDsProtocolVersion)
+	args.Set("start", fmt.Sprintf("%d", start))
+	args.Set("end", fmt.Sprintf("%d", end))
+	args.Set("disable_compression", fmt.Sprintf("%v", sn.s.disableCompression))
+
+	data, err := sn.getResponseForPathAndArgs(ctx, "/internal/select/tenant_ids", args)
+	if err != nil {
+		return nil, err
+	}
+
+	tenantIDs, err := logstorage.UnmarshalTenantIDs(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal tenantIDs from storage node %q: %w", sn.addr, err)
+	}
+	return tenantIDs, nil
+}
+
+func (sn *storageNode) getDataSetVersion(ctx context.Context) (uint64, error) {
+	args := url.Values{}
+	args.Set("version", DataSetVersionProtocolVersion)
+
+	responseBody, reqURL, err := sn.getResponseBodyForPathAndArgs(ctx, "/internal/select/data_set_version", args)
+	if err != nil {
+		return 0, err
+	}
+	defer responseBody.Close()
+
+	var bb bytesutil.ByteBuffer
+	if _, err := bb.ReadFrom(responseBody); err != nil {
+		return 0, fmt.Errorf("cannot read response from %q: %w", reqURL, err)
+	}
+	if len(bb.B) != 8 {
+		return 0, fmt.Errorf("unexpected data set version size received from %q; got %d bytes; want 8 bytes", reqURL, len(bb.B))
+	}
+	return encoding.UnmarshalUint64(bb.B), nil
+}
+
 func (sn *storageNode) getCommonArgs(version string, qctx *logstorage.QueryContext) url.Values {
 	args := url.Values{}
 	args.Set("version", version)
@@ -237,6 +344,9 @@ func (sn *storageNode) getCommonArgs(version string, qctx *logstorage.QueryConte
 	args.Set("query", qctx.Query.String())
 	args.Set("timestamp", fmt.Sprintf("%d", qctx.Query.GetTimestamp()))
 	args.Set("disable_compression", fmt.Sprintf("%v", sn.s.disableCompression))
+	if qctx.StreamShards != nil {
+		args.Set("stream_shards", qctx.StreamShards.String())
+	}
 	return args
 }
 
@@ -288,6 +398,10 @@ func (sn *storageNode) getResponseBodyForPathAndArgs(ctx context.Context, path s
 	// send the request to the storage node
 	resp, err := sn.c.Do(req)
 	if err != nil {
+		if ctx.Err() == nil {
+			// Avoid querying the unavailable storage node during the next 10 seconds if there are other replicas.
+			sn.disabledUntil.Store(fasttime.UnixTimestamp() + 10)
+		}
 		return nil, "", &httpserver.ErrorWithStatusCode{
 			Err:        fmt.Errorf("cannot connect to storage node at %q: %w", reqURL, err),
 			StatusCode: http.StatusBadGateway,
@@ -306,6 +420,10 @@ func (sn *storageNode) getResponseBodyForPathAndArgs(ctx context.Context, path s
 	return resp.Body, reqURL, nil
 }
 
+func (sn *storageNode) isAvailable() bool {
+	return sn.disabledUntil.Load() <= fasttime.UnixTimestamp()
+}
+
 func (sn *storageNode) getRequestURL(path string) string {
 	return fmt.Sprintf("%s://%s%s", sn.scheme, sn.addr, path)
 }
@@ -314,10 +432,18 @@ func (sn *storageNode) getRequestURL(path string) string {
 //
 // If disableCompression is set, then uncompressed responses are received from storage nodes.
 //
+// If replicationFactor > 1, then every log stream is queried at a single storage node among the replicationFactor nodes holding its replicas.
+// The addrs and replicationFactor must match the ones passed to netinsert.NewStorage.
+//
 // Call MustStop on the returned storage when it is no longer needed.
-func NewStorage(addrs []string, authCfgs []*promauth.Config, isTLSs []bool, disableCompression bool) *Storage {
+func NewStorage(addrs []string, authCfgs []*promauth.Config, isTLSs []bool, disableCompression bool, replicationFactor int) *Storage {
+	replicationFactor = max(replicationFactor, 1)
+	replicationFactor = min(replicationFactor, len(addrs))
+
 	s := &Storage{
 		disableCompression: disableCompression,
+		replicationFactor:  replicationFactor,
+		ssp:                logstorage.NewStreamShardsPlacement(addrs, replicationFactor),
 	}
 
 	sns := make([]*storageNode, len(addrs))
@@ -356,6 +482,34 @@ func (s *Storage) runQuery(stopCh <-chan struct{}, qctx *logstorage.QueryContext
 
 	qctxLocal := qctx.WithContext(ctxWithCancel)
 
+	return s.queryNodes(qctxLocal, cancel, func(qctxNode *logstorage.QueryContext, nodeIdx int, workerID uint) (bool, error) {
+		sn := s.sns[nodeIdx]
+		hasResults := false
+		err := sn.runQuery(qctxNode, func(db *logstorage.DataBlock) {
+			hasResults = true
+			writeBlock(workerID, db)
+		})
+		return hasResults, err
+	})
+}
+
+// queryNodes calls f for the storage nodes, which must be queried for qctx.
+//
+// f must return true if it has passed some results to the caller before returning.
+// Every f call receives an unique workerID across all the f calls for the given qctx.
+// cancel must cancel qctx.Context.
+//
+// If s.replicationFactor > 1, then every log stream shard is queried at exactly one storage node among the nodes holding its replicas,
+// so every log entry is processed only once. The shards are re-queried at the remaining replicas if the storage node fails
+// without returning any results.
+func (s *Storage) queryNodes(qctx *logstorage.QueryContext, cancel func(), f func(qctxNode *logstorage.QueryContext, nodeIdx int, workerID uint) (bool, error)) error {
+	if s.replicationFactor <= 1 || len(s.sns) <= 1 {
+		return s.queryAllNodes(qctx, cancel, f)
+	}
+	return s.queryReplicas(qctx, cancel, f)
+}
+
+func (s *Storage) queryAllNodes(qctx *logstorage.QueryContext, cancel func(), f func(qctxNode *logstorage.QueryContext, nodeIdx int, workerID uint) (bool, error)) error {
 	errs := make([]error, len(s.sns))
 
 	var wg sync.WaitGroup
@@ -365,16 +519,16 @@ func (s *Storage) runQuery(stopCh <-chan struct{}, qctx *logstorage.QueryContext
 			defer wg.Done()
 
 			sn := s.sns[nodeIdx]
-			err := sn.runQuery(qctxLocal, func(db *logstorage.DataBlock) {
-				writeBlock(uint(nodeIdx), db)
-			})
+			_, err := f(qctx, nodeIdx, uint(nodeIdx))
 			if err != nil {
 				if !errors.Is(err, context.Canceled) {
 					sn.sendErrors.Inc()
 				}
 
-				// Cancel the remaining parallel queries
-				cancel()
+				if !tryRegisterMissingNode(qctx, sn, err) {
+					// Cancel the remaining parallel queries
+					cancel()
+				}
 			}
 
 			errs[nodeIdx] = err
@@ -382,14 +536,149 @@ func (s *Storage) runQuery(stopCh <-chan struct{}, qctx *logstorage.QueryContext
 	}
 	wg.Wait()
 
-	return getFirstNonCancelError(errs)
+	return s.getQueryError(qctx, errs)
+}
+
+func (s *Storage) queryReplicas(qctx *logstorage.QueryContext, cancel func(), f func(qctxNode *logstorage.QueryContext, nodeIdx int, workerID uint) (bool, error)) error {
+	// Log streams are split into logstorage.StreamShardsCount shards. Every shard is stored at s.replicationFactor nodes
+	// according to s.ssp. See netinsert.Storage.AddRow.
+	shardsCount := logstorage.StreamShardsCount
+
+	failedNodes := make([]bool, len(s.sns))
+	shardNodes := make([]int, shardsCount)
+	pendingShards := make([]uint64, shardsCount)
+	for shard := range pendingShards {
+		pendingShards[shard] = uint64(shard)
+		shardNodes[shard] = s.getReplicaNodeIdx(uint64(shard), failedNodes)
+	}
+
+	var errFirst error
+	shardsQueried := 0
+	for round := 0; len(pendingShards) > 0 && qctx.Context.Err() == nil; round++ {
+		nodeShards := make([][]uint64, len(s.sns))
+		for _, shard := range pendingShards {
+			nodeIdx := shardNodes[shard]
+			nodeShards[nodeIdx] = append(nodeShards[nodeIdx], shard)
+		}
+		pendingShards = pendingShards[:0]
+
+		hasResults := make([]bool, len(s.sns))
+		errs := make([]error, len(s.sns))
+
+		var wg sync.WaitGroup
+		for nodeIdx, shards := range nodeShards {
+			if len(shards) == 0 {
+				continue
+			}
+
+			wg.Add(1)
+			go func(nodeIdx int, shards []uint64) {
+				defer wg.Done()
+
+				qctxNode := qctx.WithContext(qctx.Context)
+				qctxNode.StreamShards = &logstorage.StreamShards{
+					ShardsCount: uint64(shardsCount),
+					Shards:      shards,
+				}
+				// Use distinct workerID per every round, since query pipes may expect that every node returns results to its own workerID.
+				workerID := uint(round*len(s.sns) + nodeIdx)
+				ok, err := f(qctxNode, nodeIdx, workerID)
+				if err != nil && ok && qctx.PartialResponse == nil && !errors.Is(err, context.Canceled) {
+					// The shards cannot be re-queried at other replicas, since the node already returned some results.
+					// Cancel the remaining parallel queries
+					cancel()
+				}
+
+				hasResults[nodeIdx] = ok
+				errs[nodeIdx] = err
+			}(nodeIdx, shards)
+		}
+		wg.Wait()
+
+		for nodeIdx, shards := range nodeShards {
+			err := errs[nodeIdx]
+			if len(shards) == 0 || err == nil || errors.Is(err, context.Canceled) {
+				continue
+			}
+
+			sn := s.sns[nodeIdx]
+			sn.sendErrors.Inc()
+			failedNodes[nodeIdx] = true
+			if errFirst == nil {
+				errFirst = err
+			}
+		}
+
+		for nodeIdx, shards := range nodeShards {
+			err := errs[nodeIdx]
+			if len(shards) == 0 || errors.Is(err, context.Canceled) {
+				continue
+			}
+			if err == nil {
+				shardsQueried += len(shards)
+				continue
+			}
+
+			if hasResults[nodeIdx] {
+				// The shards cannot be re-queried at other replicas.
+				if !tryRegisterMissingNode(qctx, s.sns[nodeIdx], err) {
+					return err
+				}
+				continue
+			}
+
+			// Re-query the shards at the remaining replicas.
+			for _, shard := range shards {
+				replicaIdx := s.getReplicaNodeIdx(shard, failedNodes)
+				if replicaIdx >= 0 {
+					shardNodes[shard] = replicaIdx
+					pendingShards = append(pendingShards, shard)
+					continue
+				}
+
+				// All the replicas for the shard have failed.
+				for _, nodeIdx := range s.ssp.GetNodeIdxs(shard) {
+					sn := s.sns[nodeIdx]
+					if !tryRegisterMissingNode(qctx, sn, err) {
+						return err
+					}
+				}
+			}
+		}
+		slices.Sort(pendingShards)
+	}
+
+	if shardsQueried == 0 && errFirst != nil {
+		return fmt.Errorf("all the %d storage nodes failed to return results; the first error: %w", len(s.sns), errFirst)
+	}
+	return nil
+}
+
+// getReplicaNodeIdx returns the index of the storage node to query for the given log stream shard.
+//
+// Storage nodes marked at failedNodes are skipped, while available storage nodes are preferred over temporarily unavailable nodes.
+//
+// -1 is returned if all the storage nodes holding the shard replicas have failed.
+func (s *Storage) getReplicaNodeIdx(shard uint64, failedNodes []bool) int {
+	idx := -1
+	for _, nodeIdx := range s.ssp.GetNodeIdxs(shard) {
+		if failedNodes[nodeIdx] {
+			continue
+		}
+		if s.sns[nodeIdx].isAvailable() {
+			return nodeIdx
+		}
+		if idx < 0 {
+			idx = nodeIdx
+		}
+	}
+	return idx
 }
 
 // GetFieldNames executes qctx and returns field names seen in results.
 func (s *Storage) GetFieldNames(qctx *logstorage.QueryContext) ([]logstorage.ValueWithHits, error) {
-	return s.getValuesWithHits(qctx, 0, false, func(ctx context.Context, sn *storageNode) ([]logstorage.ValueWithHits, error) {
-		qctxLocal := qctx.WithContext(ctx)
-		return sn.getFieldNames(qctxLocal)
+	return s.getValuesWithHits(qctx, 0, false, func(qctx *logstorage.QueryContext, sn *storageNode) ([]logstorage.ValueWithHits, error) {
+		return sn.getFieldNames(qctx)
 	})
 }
 
@@ -397,17 +686,15 @@ func (s *Storage) GetFieldNames(qctx *logstorage.QueryContext) ([]logstorage.Val
 //
 // If limit > 0, then up to limit unique values are returned.
 func (s *Storage) GetFieldValues(qctx *logstorage.QueryContext, fieldName string, limit uint64) ([]logstorage.ValueWithHits, error) {
-	return s.getValuesWithHits(qctx, limit, true, func(ctx context.Context, sn *storageNode) ([]logstorage.ValueWithHits, error) {
-		qctxLocal := qctx.WithContext(ctx)
-		return sn.getFieldValues(qctxLocal, fieldName, limit)
+	return s.getValuesWithHits(qctx, limit, true, func(qctx *logstorage.QueryContext, sn *storageNode) ([]logstorage.ValueWithHits, error) {
+		return sn.getFieldValues(qctx, fieldName, limit)
 	})
 }
 
 // GetStreamFieldNames executes qctx and returns stream field names seen in results.
 func (s *Storage) GetStreamFieldNames(qctx *logstorage.QueryContext) ([]logstorage.ValueWithHits, error) {
-	return s.getValuesWithHits(qctx, 0, false, func(ctx context.Context, sn *storageNode) ([]logstorage.ValueWithHits, error) {
-		qctxLocal := qctx.WithContext(ctx)
-		return sn.getStreamFieldNames(qctxLocal)
+	return s.getValuesWithHits(qctx, 0, false, func(qctx *logstorage.QueryContext, sn *storageNode) ([]logstorage.ValueWithHits, error) {
+		return sn.getStreamFieldNames(qctx)
 	})
 }
 
@@ -415,9 +702,8 @@ func (s *Storage) GetStreamFieldNames(qctx *logstorage.QueryContext) ([]logstora
 //
 // If limit > 0, then up to limit unique stream field values are returned.
 func (s *Storage) GetStreamFieldValues(qctx *logstorage.QueryContext, fieldName string, limit uint64) ([]logstorage.ValueWithHits, error) {
-	return s.getValuesWithHits(qctx, limit, true, func(ctx context.Context, sn *storageNode) ([]logstorage.ValueWithHits, error) {
-		qctxLocal := qctx.WithContext(ctx)
-		return sn.getStreamFieldValues(qctxLocal, fieldName, limit)
+	return s.getValuesWithHits(qctx, limit, true, func(qctx *logstorage.QueryContext, sn *storageNode) ([]logstorage.ValueWithHits, error) {
+		return sn.getStreamFieldValues(qctx, fieldName, limit)
 	})
 }
 
@@ -425,9 +711,8 @@ func (s *Storage) GetStreamFieldValues(qctx *logstorage.QueryContext, fieldName
 //
 // If limit > 0, then up to limit unique streams are returned.
 func (s *Storage) GetStreams(qctx *logstorage.QueryContext, limit uint64) ([]logstorage.ValueWithHits, error) {
-	return s.getValuesWithHits(qctx, limit, true, func(ctx context.Context, sn *storageNode) ([]logstorage.ValueWithHits, error) {
-		qctxLocal := qctx.WithContext(ctx)
-		return sn.getStreams(qctxLocal, limit)
+	return s.getValuesWithHits(qctx, limit, true, func(qctx *logstorage.QueryContext, sn *storageNode) ([]logstorage.ValueWithHits, error) {
+		return sn.getStreams(qctx, limit)
 	})
 }
 
@@ -435,19 +720,72 @@ func (s *Storage) GetStreams(qctx *logstorage.QueryContext, limit uint64) ([]log
 //
 // If limit > 0, then up to limit unique streamIDs are returned.
 func (s *Storage) GetStreamIDs(qctx *logstorage.QueryContext, limit uint64) ([]logstorage.ValueWithHits, error) {
-	return s.getValuesWithHits(qctx, limit, true, func(ctx context.Context, sn *storageNode) ([]logstorage.ValueWithHits, error) {
-		qctxLocal := qctx.WithContext(ctx)
-		return sn.getStreamIDs(qctxLocal, limit)
+	return s.getValuesWithHits(qctx, limit, true, func(qctx *logstorage.QueryContext, sn *storageNode) ([]logstorage.ValueWithHits, error) {
+		return sn.getStreamIDs(qctx, limit)
 	})
 }
 
-func (s *Storage) getValuesWithHits(qctx *logstorage.QueryContext, limit uint64, resetHitsOnLimitExceeded bool,
-	callback func(ctx context.Context, sn *storageNode) ([]logstorage.ValueWithHits, error)) ([]logstorage.ValueWithHits, error) {
+// DeleteRows marks log entries matching qctx at all the storage nodes as deleted.
+//
+// The deletion is attempted at all the storage nodes even if some of them return errors.
+func (s *Storage) DeleteRows(qctx *logstorage.QueryContext) error {
+	errs := make([]error, len(s.sns))
 
-	ctxWithCancel, cancel := context.WithCancel(qctx.Context)
+	var wg sync.WaitGroup
+	for i := range s.sns {
+		wg.Add(1)
+		go func(nodeIdx int) {
+			defer wg.Done()
+
+			sn := s.sns[nodeIdx]
+			err := sn.deleteRows(qctx)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				sn.sendErrors.Inc()
+			}
+			errs[nodeIdx] = err
+		}(i)
+	}
+	wg.Wait()
+
+	return getFirstNonCancelError(errs)
+}
+
+// GetTenantsUsage returns per-tenant usage stats aggregated across all the storage nodes.
+//
+// Only partitions with names starting with partitionNamePrefix are taken into account for the stored logs stats.
+func (s *Storage) GetTenantsUsage(ctx context.Context, partitionNamePrefix string) ([]*logstorage.TenantUsage, error) {
+	results := make([][]*logstorage.TenantUsage, len(s.sns))
+	errs := make([]error, len(s.sns))
+
+	var wg sync.WaitGroup
+	for i := range s.sns {
+		wg.Add(1)
+		go func(nodeIdx int) {
+			defer wg.Done()
+
+			sn := s.sns[nodeIdx]
+			tus, err := sn.getTenantsUsage(ctx, partitionNamePrefix)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				sn.sendErrors.Inc()
+			}
+			results[nodeIdx] = tus
+			errs[nodeIdx] = err
+		}(i)
+	}
+	wg.Wait()
+
+	if err := getFirstNonCancelError(errs); err != nil {
+		return nil, err
+	}
+	return logstorage.MergeTenantsUsage(results, s.replicationFactor), nil
+}
+
+// GetTenantIDs returns sorted tenantIDs with logs on the given [start, end] time range across all the storage nodes.
+func (s *Storage) GetTenantIDs(ctx context.Context, start, end int64) ([]logstorage.TenantID, error) {
+	ctxWithCancel, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	results := make([][]logstorage.ValueWithHits, len(s.sns))
+	results := make([][]logstorage.TenantID, len(s.sns))
 	errs := make([]error, len(s.sns))
 
 	var wg sync.WaitGroup
@@ -457,8 +795,8 @@ func (s *Storage) getValuesWithHits(qctx *logstorage.QueryContext, limit uint64,
 			defer wg.Done()
 
 			sn := s.sns[nodeIdx]
-			vhs, err := callback(ctxWithCancel, sn)
-			results[nodeIdx] = vhs
+			tenantIDs, err := sn.getTenantIDs(ctxWithCancel, start, end)
+			results[nodeIdx] = tenantIDs
 			errs[nodeIdx] = err
 
 			if err != nil {
@@ -476,12 +814,121 @@ func (s *Storage) getValuesWithHits(qctx *logstorage.QueryContext, limit uint64,
 	if err := getFirstNonCancelError(errs); err != nil {
 		return nil, err
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return logstorage.MergeTenantIDs(results), nil
+}
+
+// GetDataSetVersion returns the version of the set of logs stored at all the storage nodes.
+//
+// The version changes when the set of logs changes at any storage node. See logstorage.Storage.GetDataSetVersion for details.
+func (s *Storage) GetDataSetVersion(ctx context.Context) (uint64, error) {
+	versions := make([]uint64, len(s.sns))
+	errs := make([]error, len(s.sns))
+
+	var wg sync.WaitGroup
+	for i := range s.sns {
+		wg.Add(1)
+		go func(nodeIdx int) {
+			defer wg.Done()
+
+			sn := s.sns[nodeIdx]
+			version, err := sn.getDataSetVersion(ctx)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				sn.sendErrors.Inc()
+			}
+			versions[nodeIdx] = version
+			errs[nodeIdx] = err
+		}(i)
+	}
+	wg.Wait()
+
+	if err := getFirstNonCancelError(errs); err != nil {
+		return 0, err
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	var b []byte
+	for _, version := range versions {
+		b = encoding.MarshalUint64(b, version)
+	}
+	return xxhash.Sum64(b), nil
+}
+
+func (s *Storage) getValuesWithHits(qctx *logstorage.QueryContext, limit uint64, resetHitsOnLimitExceeded bool,
+	callback func(qctx *logstorage.QueryContext, sn *storageNode) ([]logstorage.ValueWithHits, error)) ([]logstorage.ValueWithHits, error) {
+
+	ctxWithCancel, cancel := context.WithCancel(qctx.Context)
+	defer cancel()
+
+	qctxLocal := qctx.WithContext(ctxWithCancel)
+
+	var resultsLock sync.Mutex
+	var results [][]logstorage.ValueWithHits
+	err := s.queryNodes(qctxLocal, cancel, func(qctxNode *logstorage.QueryContext, nodeIdx int, _ uint) (bool, error) {
+		sn := s.sns[nodeIdx]
+		vhs, err := callback(qctxNode, sn)
+		if err != nil {
+			// The results are returned all at once, so the query can be safely re-tried at another storage node.
+			return false, err
+		}
+
+		resultsLock.Lock()
+		results = append(results, vhs)
+		resultsLock.Unlock()
+
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	vhs := logstorage.MergeValuesWithHits(results, limit, resetHitsOnLimitExceeded)
 
 	return vhs, nil
 }
 
+// tryRegisterMissingNode registers sn as missing at qctx if qctx allows partial response and err isn't caused by query cancellation.
+//
+// It returns true if sn has been registered as missing, so err can be ignored.
+func tryRegisterMissingNode(qctx *logstorage.QueryContext, sn *storageNode, err error) bool {
+	pr := qctx.PartialResponse
+	if pr == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if pr.AddMissingNode(sn.addr) {
+		atomic.AddUint64(&qctx.QueryStats.MissingStorageNodes, 1)
+	}
+	return true
+}
+
+// getQueryError returns the error for the query executed at s.sns with the given per-node errs.
+//
+// Errors from storage nodes registered as missing at qctx are ignored, unless all the storage nodes are missing.
+func (s *Storage) getQueryError(qctx *logstorage.QueryContext, errs []error) error {
+	if qctx.PartialResponse == nil {
+		return getFirstNonCancelError(errs)
+	}
+
+	var errFirst error
+	failedNodes := 0
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			if errFirst == nil {
+				errFirst = err
+			}
+			failedNodes++
+		}
+	}
+	if failedNodes == len(s.sns) {
+		return fmt.Errorf("all the %d storage nodes failed to return results; the first error: %w", len(s.sns), errFirst)
+	}
+	return nil
+}
+
 func getFirstNonCancelError(errs []error) error {
 	for _, err := range errs {
 		if err != nil && !errors.Is(err, context.Canceled) {
@@ -0,0 +1,508 @@
+package netselect
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+	"github.com/VictoriaMetrics/metrics"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func newTestStorage(nodesCount, replicationFactor int) *Storage {
+	s := &Storage{
+		replicationFactor: replicationFactor,
+	}
+	ms := metrics.NewSet()
+	var addrs []string
+	for i := 0; i < nodesCount; i++ {
+		addr := fmt.Sprintf("node-%d", i)
+		s.sns = append(s.sns, &storageNode{
+			addr:       addr,
+			s:          s,
+			sendErrors: ms.NewCounter(fmt.Sprintf(`send_errors{addr=%q}`, addr)),
+		})
+		addrs = append(addrs, addr)
+	}
+	s.ssp = logstorage.NewStreamShardsPlacement(addrs, replicationFactor)
+	return s
+}
+
+func TestStorageQueryNodes(t *testing.T) {
+	f := func(nodesCount, replicationFactor int, unavailableNodes, failedNodes []int, allowPartialResponse bool, missingNodesExpected []string, errExpected bool) {
+		t.Helper()
+
+		s := newTestStorage(nodesCount, replicationFactor)
+		for _, nodeIdx := range unavailableNodes {
+			s.sns[nodeIdx].disabledUntil.Store(fasttime.UnixTimestamp() + 10)
+		}
+
+		q, err := logstorage.ParseQuery("*")
+		if err != nil {
+			t.Fatalf("cannot parse query: %s", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		qctx := logstorage.NewQueryContext(ctx, &logstorage.QueryStats{}, nil, q)
+		if allowPartialResponse {
+			qctx.PartialResponse = &logstorage.PartialResponse{}
+		}
+
+		var resultLock sync.Mutex
+		result := make(map[int][]uint64)
+		workerIDs := make(map[uint]struct{})
+		err = s.queryNodes(qctx, cancel, func(qctxNode *logstorage.QueryContext, nodeIdx int, workerID uint) (bool, error) {
+			resultLock.Lock()
+			if _, ok := workerIDs[workerID]; ok {
+				panic(fmt.Errorf("duplicate workerID=%d", workerID))
+			}
+			workerIDs[workerID] = struct{}{}
+			resultLock.Unlock()
+
+			if slices.Contains(failedNodes, nodeIdx) {
+				return false, fmt.Errorf("node %d is unavailable", nodeIdx)
+			}
+
+			var shards []uint64
+			if ss := qctxNode.StreamShards; ss != nil {
+				if ss.ShardsCount != logstorage.StreamShardsCount {
+					panic(fmt.Errorf("unexpected number of shards; got %d; want %d", ss.ShardsCount, logstorage.StreamShardsCount))
+				}
+				shards = ss.Shards
+			}
+
+			resultLock.Lock()
+			result[nodeIdx] = append(result[nodeIdx], shards...)
+			resultLock.Unlock()
+
+			return true, nil
+		})
+		if errExpected {
+			if err == nil {
+				t.Fatalf("expecting non-nil error")
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		// Every shard must be queried at the first available node it is placed at.
+		// Unavailable nodes must be queried only if all the other nodes for the shard have failed.
+		resultExpected := make(map[int][]uint64)
+		if replicationFactor <= 1 {
+			for nodeIdx := 0; nodeIdx < nodesCount; nodeIdx++ {
+				if !slices.Contains(failedNodes, nodeIdx) {
+					resultExpected[nodeIdx] = nil
+				}
+			}
+		} else {
+			for shard := uint64(0); shard < logstorage.StreamShardsCount; shard++ {
+				idx := -1
+				for _, nodeIdx := range s.ssp.GetNodeIdxs(shard) {
+					if slices.Contains(failedNodes, nodeIdx) {
+						continue
+					}
+					if !slices.Contains(unavailableNodes, nodeIdx) {
+						idx = nodeIdx
+						break
+					}
+					if idx < 0 {
+						idx = nodeIdx
+					}
+				}
+				if idx >= 0 {
+					resultExpected[idx] = append(resultExpected[idx], shard)
+				}
+			}
+		}
+		for nodeIdx := range result {
+			slices.Sort(result[nodeIdx])
+		}
+		if !reflect.DeepEqual(result, resultExpected) {
+			t.Fatalf("unexpected shards per node\ngot\n%v\nwant\n%v", result, resultExpected)
+		}
+
+		var missingNodes []string
+		if qctx.PartialResponse != nil {
+			missingNodes = qctx.PartialResponse.GetMissingNodes()
+		}
+		if !reflect.DeepEqual(missingNodes, missingNodesExpected) {
+			t.Fatalf("unexpected missing nodes; got %q; want %q", missingNodes, missingNodesExpected)
+		}
+	}
+
+	// without replication all the nodes are queried without stream shards
+	f(3, 1, nil, nil, false, nil, false)
+
+	// without replication the failed node leads to an error
+	f(3, 1, nil, []int{1}, false, nil, true)
+
+	// without replication the failed node is registered as missing if partial response is allowed
+	f(3, 1, nil, []int{1}, true, []string{"node-1"}, false)
+
+	// every shard is queried at its primary node when all the nodes are available
+	f(3, 2, nil, nil, false, nil, false)
+	f(5, 3, nil, nil, false, nil, false)
+
+	// shards from unavailable node are queried at the next replica
+	f(3, 2, []int{1}, nil, false, nil, false)
+
+	// shards from the failed node are re-queried at the next replica
+	f(3, 2, nil, []int{0}, false, nil, false)
+	f(4, 3, nil, []int{1, 2}, false, nil, false)
+
+	// unavailable node is queried if all the other replicas have failed
+	f(3, 2, []int{1}, []int{2}, false, nil, false)
+
+	// all the replicas for a shard have failed
+	f(3, 2, nil, []int{0, 1}, false, nil, true)
+	f(3, 2, nil, []int{0, 1}, true, []string{"node-0", "node-1"}, false)
+
+	// all the nodes have failed
+	f(3, 3, nil, []int{0, 1, 2}, true, nil, true)
+}
+
+func TestStorageQueryNodesShardsPlacement(t *testing.T) {
+	// Every shard must be queried exactly once at one of the nodes it is placed at
+	s := newTestStorage(5, 2)
+
+	q, err := logstorage.ParseQuery("*")
+	if err != nil {
+		t.Fatalf("cannot parse query: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	qctx := logstorage.NewQueryContext(ctx, &logstorage.QueryStats{}, nil, q)
+
+	var shardNodesLock sync.Mutex
+	shardNodes := make(map[uint64][]int)
+	err = s.queryNodes(qctx, cancel, func(qctxNode *logstorage.QueryContext, nodeIdx int, _ uint) (bool, error) {
+		shardNodesLock.Lock()
+		for _, shard := range qctxNode.StreamShards.Shards {
+			shardNodes[shard] = append(shardNodes[shard], nodeIdx)
+		}
+		shardNodesLock.Unlock()
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(shardNodes) != logstorage.StreamShardsCount {
+		t.Fatalf("unexpected number of queried shards; got %d; want %d", len(shardNodes), logstorage.StreamShardsCount)
+	}
+	for shard, nodeIdxs := range shardNodes {
+		if len(nodeIdxs) != 1 {
+			t.Fatalf("shard %d must be queried at a single node; queried at nodes %v", shard, nodeIdxs)
+		}
+		if !slices.Contains(s.ssp.GetNodeIdxs(shard), nodeIdxs[0]) {
+			t.Fatalf("shard %d is queried at node %d, which doesn't hold it; nodes holding the shard: %v", shard, nodeIdxs[0], s.ssp.GetNodeIdxs(shard))
+		}
+	}
+}
+
+func TestStorageQueryNodesNoRetryAfterResults(t *testing.T) {
+	f := func(allowPartialResponse bool, errExpected bool) {
+		t.Helper()
+
+		s := newTestStorage(3, 2)
+
+		q, err := logstorage.ParseQuery("*")
+		if err != nil {
+			t.Fatalf("cannot parse query: %s", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		qctx := logstorage.NewQueryContext(ctx, &logstorage.QueryStats{}, nil, q)
+		if allowPartialResponse {
+			qctx.PartialResponse = &logstorage.PartialResponse{}
+		}
+
+		var callsLock sync.Mutex
+		calls := 0
+		err = s.queryNodes(qctx, cancel, func(_ *logstorage.QueryContext, nodeIdx int, _ uint) (bool, error) {
+			callsLock.Lock()
+			calls++
+			callsLock.Unlock()
+
+			if nodeIdx == 0 {
+				// The node returns some results before the failure, so its shards cannot be re-queried at other replicas.
+				return true, fmt.Errorf("unexpected error")
+			}
+			return true, nil
+		})
+		if errExpected != (err != nil) {
+			t.Fatalf("unexpected error: %v; errExpected=%v", err, errExpected)
+		}
+		if calls != 3 {
+			t.Fatalf("unexpected number of calls; got %d; want 3", calls)
+		}
+	}
+
+	f(false, true)
+	f(true, false)
+}
+
+func newTestStorageNodeServer(isAvailable bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAvailable {
+			http.Error(w, "the storage node is unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		var qs logstorage.QueryStats
+		switch r.URL.Path {
+		case "/internal/select/query":
+			db := &logstorage.DataBlock{
+				Columns: []logstorage.BlockColumn{
+					{
+						Name:   "_msg",
+						Values: []string{"foo"},
+					},
+				},
+			}
+			b := append([]byte{0}, db.Marshal(nil)...)
+			b = append(b, 1)
+			b = qs.CreateDataBlock(0).Marshal(b)
+			_, _ = w.Write(encoding.MarshalUint64(nil, uint64(len(b))))
+			_, _ = w.Write(b)
+		case "/internal/select/field_names":
+			vh := logstorage.ValueWithHits{
+				Value: "foo",
+				Hits:  1,
+			}
+			b := encoding.MarshalUint64(nil, 1)
+			b = vh.Marshal(b)
+			b = qs.CreateDataBlock(0).Marshal(b)
+			_, _ = w.Write(b)
+		case "/internal/select/data_set_version":
+			_, _ = w.Write(encoding.MarshalUint64(nil, 123))
+		default:
+			http.Error(w, "unsupported path", http.StatusBadRequest)
+		}
+	}))
+}
+
+func newTestNetStorage(t *testing.T, nodesAvailability []bool) (*Storage, []string, func()) {
+	t.Helper()
+
+	var servers []*httptest.Server
+	var addrs []string
+	var authCfgs []*promauth.Config
+	for _, isAvailable := range nodesAvailability {
+		srv := newTestStorageNodeServer(isAvailable)
+		servers = append(servers, srv)
+		addrs = append(addrs, strings.TrimPrefix(srv.URL, "http://"))
+
+		ac, err := (&promauth.Options{}).NewConfig()
+		if err != nil {
+			t.Fatalf("cannot create auth config: %s", err)
+		}
+		authCfgs = append(authCfgs, ac)
+	}
+	isTLSs := make([]bool, len(addrs))
+	s := NewStorage(addrs, authCfgs, isTLSs, true, 1)
+
+	stop := func() {
+		s.MustStop()
+		for _, srv := range servers {
+			srv.Close()
+		}
+	}
+	return s, addrs, stop
+}
+
+func newTestQueryContext(t *testing.T, allowPartialResponse bool) *logstorage.QueryContext {
+	t.Helper()
+
+	q, err := logstorage.ParseQuery("*")
+	if err != nil {
+		t.Fatalf("cannot parse query: %s", err)
+	}
+	qctx := logstorage.NewQueryContext(context.Background(), &logstorage.QueryStats{}, nil, q)
+	if allowPartialResponse {
+		qctx.PartialResponse = &logstorage.PartialResponse{}
+	}
+	return qctx
+}
+
+func TestStorageRunQueryPartialResponse(t *testing.T) {
+	f := func(nodesAvailability []bool, allowPartialResponse bool, rowsExpected int, missingNodeIdxsExpected []int, errExpected bool) {
+		t.Helper()
+
+		s, addrs, stop := newTestNetStorage(t, nodesAvailability)
+		defer stop()
+
+		qctx := newTestQueryContext(t, allowPartialResponse)
+		var rows atomic.Int64
+		writeBlock := func(_ uint, db *logstorage.DataBlock) {
+			rows.Add(int64(db.RowsCount()))
+		}
+		err := s.RunQuery(qctx, writeBlock)
+		if errExpected {
+			if err == nil {
+				t.Fatalf("expecting non-nil error")
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if n := int(rows.Load()); n != rowsExpected {
+			t.Fatalf("unexpected number of rows; got %d; want %d", n, rowsExpected)
+		}
+		checkMissingNodes(t, qctx, addrs, missingNodeIdxsExpected)
+	}
+
+	// all the nodes are available
+	f([]bool{true, true, true}, false, 3, nil, false)
+	f([]bool{true, true, true}, true, 3, nil, false)
+
+	// a single node is unavailable
+	f([]bool{true, false, true}, false, 0, nil, true)
+	f([]bool{true, false, true}, true, 2, []int{1}, false)
+
+	// all the nodes are unavailable
+	f([]bool{false, false}, false, 0, nil, true)
+	f([]bool{false, false}, true, 0, nil, true)
+}
+
+func TestStorageGetFieldNamesPartialResponse(t *testing.T) {
+	f := func(nodesAvailability []bool, allowPartialResponse bool, hitsExpected uint64, missingNodeIdxsExpected []int, errExpected bool) {
+		t.Helper()
+
+		s, addrs, stop := newTestNetStorage(t, nodesAvailability)
+		defer stop()
+
+		qctx := newTestQueryContext(t, allowPartialResponse)
+		vhs, err := s.GetFieldNames(qctx)
+		if errExpected {
+			if err == nil {
+				t.Fatalf("expecting non-nil error")
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		vhsExpected := []logstorage.ValueWithHits{
+			{
+				Value: "foo",
+				Hits:  hitsExpected,
+			},
+		}
+		if !reflect.DeepEqual(vhs, vhsExpected) {
+			t.Fatalf("unexpected result; got %v; want %v", vhs, vhsExpected)
+		}
+		checkMissingNodes(t, qctx, addrs, missingNodeIdxsExpected)
+	}
+
+	// all the nodes are available
+	f([]bool{true, true, true}, false, 3, nil, false)
+	f([]bool{true, true, true}, true, 3, nil, false)
+
+	// some nodes are unavailable
+	f([]bool{false, true, true}, false, 0, nil, true)
+	f([]bool{false, true, false}, true, 1, []int{0, 2}, false)
+
+	// all the nodes are unavailable
+	f([]bool{false, false}, false, 0, nil, true)
+	f([]bool{false, false}, true, 0, nil, true)
+}
+
+func checkMissingNodes(t *testing.T, qctx *logstorage.QueryContext, addrs []string, missingNodeIdxsExpected []int) {
+	t.Helper()
+
+	var missingNodesExpected []string
+	for _, idx := range missingNodeIdxsExpected {
+		missingNodesExpected = append(missingNodesExpected, addrs[idx])
+	}
+	slices.Sort(missingNodesExpected)
+
+	var missingNodes []string
+	if qctx.PartialResponse != nil {
+		missingNodes = qctx.PartialResponse.GetMissingNodes()
+	}
+	if !reflect.DeepEqual(missingNodes, missingNodesExpected) {
+		t.Fatalf("unexpected missing nodes; got %q; want %q", missingNodes, missingNodesExpected)
+	}
+	if n := int(qctx.QueryStats.MissingStorageNodes); n != len(missingNodesExpected) {
+		t.Fatalf("unexpected MissingStorageNodes in query stats; got %d; want %d", n, len(missingNodesExpected))
+	}
+}
+
+func TestTryRegisterMissingNode(t *testing.T) {
+	s := newTestStorage(2, 1)
+	errNode := fmt.Errorf("cannot connect to the storage node")
+
+	// partial response isn't allowed
+	qctx := newTestQueryContext(t, false)
+	if tryRegisterMissingNode(qctx, s.sns[0], errNode) {
+		t.Fatalf("the node mustn't be registered as missing when partial response isn't allowed")
+	}
+
+	// partial response is allowed
+	qctx = newTestQueryContext(t, true)
+	if tryRegisterMissingNode(qctx, s.sns[0], context.Canceled) {
+		t.Fatalf("the node mustn't be registered as missing on query cancellation")
+	}
+	if !tryRegisterMissingNode(qctx, s.sns[0], errNode) {
+		t.Fatalf("the node must be registered as missing")
+	}
+	if !tryRegisterMissingNode(qctx, s.sns[0], fmt.Errorf("wrapped: %w", errNode)) {
+		t.Fatalf("the node must be registered as missing on repeated errors")
+	}
+	checkMissingNodes(t, qctx, []string{"node-0"}, []int{0})
+
+	// getQueryError returns error only if all the nodes have failed
+	if err := s.getQueryError(qctx, []error{errNode, nil}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := s.getQueryError(qctx, []error{errNode, context.Canceled}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := s.getQueryError(qctx, []error{errNode, errNode}); err == nil {
+		t.Fatalf("expecting non-nil error when all the nodes have failed")
+	}
+
+	qctx = newTestQueryContext(t, false)
+	if err := s.getQueryError(qctx, []error{nil, errNode}); err == nil {
+		t.Fatalf("expecting non-nil error when partial response isn't allowed")
+	}
+}
+
+func TestStorageGetDataSetVersion(t *testing.T) {
+	s, _, stop := newTestNetStorage(t, []bool{true, true})
+	defer stop()
+
+	version, err := s.GetDataSetVersion(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	versionNext, err := s.GetDataSetVersion(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if versionNext != version {
+		t.Fatalf("unexpected data set version; got %d; want %d", versionNext, version)
+	}
+
+	// The version cannot be obtained if some storage nodes are unavailable
+	sUnavailable, _, stopUnavailable := newTestNetStorage(t, []bool{true, false})
+	defer stopUnavailable()
+
+	if _, err := sUnavailable.GetDataSetVersion(context.Background()); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+}
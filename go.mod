@@ -15,6 +15,7 @@ require (
 	github.com/valyala/fastjson v1.6.4
 	github.com/valyala/fastrand v1.1.0
 	github.com/valyala/quicktemplate v1.8.0
+	gopkg.in/yaml.v2 v2.4.0
 )
 
 require (
@@ -0,0 +1,511 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	vmfs "github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+const (
+	// manifestFilename is the name of the file with the backup manifest.
+	//
+	// The manifest is written after all the other files are uploaded, so its' presence means the backup is complete.
+	manifestFilename = "backup_manifest.json"
+
+	// partsFilename is the name of the file with the list of parts in indexdb and datadb directories.
+	partsFilename = "parts.json"
+
+	// partitionNameFormat is the format for per-day partition names.
+	partitionNameFormat = "20060102"
+)
+
+// partitionDirnames contains the names of partition directories, which are backed up.
+var partitionDirnames = []string{"indexdb", "datadb"}
+
+// manifest describes the backup contents.
+type manifest struct {
+	// PartitionName is the name of the backed up partition in YYYYMMDD format.
+	PartitionName string `json:"partitionName"`
+
+	// CreatedAt is the time when the backup has been created.
+	CreatedAt string `json:"createdAt"`
+
+	// Files contains all the backed up files.
+	Files []fileInfo `json:"files"`
+}
+
+// fileInfo describes a single file in the backup.
+type fileInfo struct {
+	// Path is the path to the file relative to the partition directory. It uses `/` as a separator.
+	Path string `json:"path"`
+
+	// Size is the file size in bytes.
+	Size int64 `json:"size"`
+
+	// SHA256 is hex-encoded sha256 checksum for the file contents.
+	SHA256 string `json:"sha256"`
+}
+
+// Backup uploads the partition snapshot at snapshotPath to dst.
+//
+// The snapshot must be created via /internal/partition/snapshot/create endpoint.
+// Only the files, which are missing at dst or have different contents, are uploaded.
+// Superfluous files are deleted from dst.
+//
+// Up to concurrency files are uploaded in parallel.
+func Backup(ctx context.Context, snapshotPath string, dst RemoteFS, concurrency int) error {
+	startTime := time.Now()
+
+	partitionName, err := getPartitionNameFromSnapshotPath(snapshotPath)
+	if err != nil {
+		return err
+	}
+	for _, dirname := range partitionDirnames {
+		if !vmfs.IsPathExist(filepath.Join(snapshotPath, dirname)) {
+			return fmt.Errorf("missing %q directory at the snapshot %q", dirname, snapshotPath)
+		}
+	}
+
+	localFiles, err := listLocalFiles(snapshotPath)
+	if err != nil {
+		return err
+	}
+	if err := calculateChecksums(ctx, snapshotPath, localFiles, concurrency); err != nil {
+		return err
+	}
+
+	remoteFiles, err := dst.ListFiles(ctx)
+	if err != nil {
+		return err
+	}
+	remoteSizes := make(map[string]int64, len(remoteFiles))
+	for _, rf := range remoteFiles {
+		remoteSizes[rf.Path] = rf.Size
+	}
+
+	// Files from the previous backup are re-used only if their checksums match the checksums of local files.
+	prevChecksums := make(map[string]string)
+	if _, ok := remoteSizes[manifestFilename]; ok {
+		m, err := readManifest(ctx, dst)
+		if err != nil {
+			logger.Warnf("cannot read the previous backup manifest at %s; all the files will be uploaded: %s", dst, err)
+		} else {
+			for _, fi := range m.Files {
+				prevChecksums[fi.Path] = fi.SHA256
+			}
+		}
+
+		// Delete the manifest before modifying the backup, so the backup isn't considered complete if it is interrupted.
+		if err := dst.DeleteFile(ctx, manifestFilename); err != nil {
+			return err
+		}
+	}
+
+	var filesToUpload []fileInfo
+	var bytesToUpload, bytesSkipped int64
+	for _, fi := range localFiles {
+		if size, ok := remoteSizes[fi.Path]; ok && size == fi.Size && prevChecksums[fi.Path] == fi.SHA256 {
+			bytesSkipped += fi.Size
+			continue
+		}
+		filesToUpload = append(filesToUpload, fi)
+		bytesToUpload += fi.Size
+	}
+	logger.Infof("uploading %d files (%d bytes) from %q to %s; skipping %d files (%d bytes) already present at %s",
+		len(filesToUpload), bytesToUpload, snapshotPath, dst, len(localFiles)-len(filesToUpload), bytesSkipped, dst)
+
+	err = runParallel(ctx, concurrency, len(filesToUpload), func(i int) error {
+		fi := filesToUpload[i]
+		return uploadFile(ctx, snapshotPath, fi, dst)
+	})
+	if err != nil {
+		return err
+	}
+
+	localPaths := make(map[string]struct{}, len(localFiles))
+	for _, fi := range localFiles {
+		localPaths[fi.Path] = struct{}{}
+	}
+	var filesToDelete []string
+	for _, rf := range remoteFiles {
+		if _, ok := localPaths[rf.Path]; !ok && rf.Path != manifestFilename {
+			filesToDelete = append(filesToDelete, rf.Path)
+		}
+	}
+	err = runParallel(ctx, concurrency, len(filesToDelete), func(i int) error {
+		return dst.DeleteFile(ctx, filesToDelete[i])
+	})
+	if err != nil {
+		return err
+	}
+
+	// Verify that all the files are stored at dst before writing the manifest.
+	remoteFiles, err = dst.ListFiles(ctx)
+	if err != nil {
+		return err
+	}
+	if err := verifyRemoteFiles(remoteFiles, localFiles); err != nil {
+		return fmt.Errorf("backup verification failed at %s: %w", dst, err)
+	}
+
+	m := &manifest{
+		PartitionName: partitionName,
+		CreatedAt:     time.Now().UTC().Format(time.RFC3339),
+		Files:         localFiles,
+	}
+	if err := writeManifest(ctx, dst, m); err != nil {
+		return err
+	}
+
+	logger.Infof("backed up partition %q from %q to %s in %.3f seconds; uploaded %d files (%d bytes); deleted %d superfluous files",
+		partitionName, snapshotPath, dst, time.Since(startTime).Seconds(), len(filesToUpload), bytesToUpload, len(filesToDelete))
+	return nil
+}
+
+// Restore restores the partition backup from src into storageDataPath.
+//
+// The partition is restored into <storageDataPath>/partitions/YYYYMMDD directory.
+// If coldDataPath isn't empty and the partition already exists at <coldDataPath>/partitions/YYYYMMDD, then the partition is restored there,
+// since VictoriaLogs prefers partitions at coldDataPath over partitions with the same name at storageDataPath.
+// VictoriaLogs must be stopped or the partition must be detached via /internal/partition/detach endpoint during the restore.
+//
+// Only the files, which are missing at the partition directory or have different contents, are downloaded.
+// The checksums of the downloaded files are verified against the backup manifest.
+// Superfluous files are deleted from the partition directory.
+//
+// Up to concurrency files are downloaded in parallel.
+func Restore(ctx context.Context, src RemoteFS, storageDataPath, coldDataPath string, concurrency int) error {
+	startTime := time.Now()
+
+	m, err := readManifest(ctx, src)
+	if err != nil {
+		return fmt.Errorf("cannot restore from %s, since the backup is missing or incomplete: %w", src, err)
+	}
+	if _, err := time.Parse(partitionNameFormat, m.PartitionName); err != nil {
+		return fmt.Errorf("unexpected partition name %q in the backup manifest at %s; it must have YYYYMMDD format", m.PartitionName, src)
+	}
+	for _, fi := range m.Files {
+		if !isValidRelativePath(fi.Path) {
+			return fmt.Errorf("unexpected file path %q in the backup manifest at %s", fi.Path, src)
+		}
+	}
+
+	partitionPath := filepath.Join(storageDataPath, "partitions", m.PartitionName)
+	if coldDataPath != "" {
+		coldPartitionPath := filepath.Join(coldDataPath, "partitions", m.PartitionName)
+		if vmfs.IsPathExist(coldPartitionPath) {
+			partitionPath = coldPartitionPath
+		}
+	}
+	for _, dirname := range partitionDirnames {
+		vmfs.MustMkdirIfNotExist(filepath.Join(partitionPath, dirname))
+	}
+	localFiles, err := listLocalFiles(partitionPath)
+	if err != nil {
+		return err
+	}
+	if err := calculateChecksums(ctx, partitionPath, localFiles, concurrency); err != nil {
+		return err
+	}
+	localChecksums := make(map[string]string, len(localFiles))
+	for _, fi := range localFiles {
+		localChecksums[fi.Path] = fi.SHA256
+	}
+
+	// Download parts.json files after the rest of files, so the partition references only fully downloaded parts
+	// if the restore is interrupted.
+	var filesToDownload, partsFiles []fileInfo
+	var bytesToDownload int64
+	for _, fi := range m.Files {
+		if localChecksums[fi.Path] == fi.SHA256 {
+			continue
+		}
+		if filepath.Base(fi.Path) == partsFilename {
+			partsFiles = append(partsFiles, fi)
+		} else {
+			filesToDownload = append(filesToDownload, fi)
+		}
+		bytesToDownload += fi.Size
+	}
+	logger.Infof("downloading %d files (%d bytes) from %s to %q; skipping %d files already present at %q",
+		len(filesToDownload)+len(partsFiles), bytesToDownload, src, partitionPath, len(m.Files)-len(filesToDownload)-len(partsFiles), partitionPath)
+
+	for _, fis := range [][]fileInfo{filesToDownload, partsFiles} {
+		err := runParallel(ctx, concurrency, len(fis), func(i int) error {
+			return downloadFile(ctx, src, fis[i], partitionPath)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	backupPaths := make(map[string]struct{}, len(m.Files))
+	for _, fi := range m.Files {
+		backupPaths[fi.Path] = struct{}{}
+	}
+	filesDeleted := 0
+	for _, fi := range localFiles {
+		if _, ok := backupPaths[fi.Path]; !ok {
+			vmfs.MustRemovePath(filepath.Join(partitionPath, filepath.FromSlash(fi.Path)))
+			filesDeleted++
+		}
+	}
+	for _, dirname := range partitionDirnames {
+		mustRemoveEmptyDirsAndSync(filepath.Join(partitionPath, dirname))
+	}
+	vmfs.MustSyncPathAndParentDir(partitionPath)
+
+	logger.Infof("restored partition %q from %s to %q in %.3f seconds; downloaded %d files (%d bytes); deleted %d superfluous files",
+		m.PartitionName, src, partitionPath, time.Since(startTime).Seconds(), len(filesToDownload)+len(partsFiles), bytesToDownload, filesDeleted)
+	return nil
+}
+
+// getPartitionNameFromSnapshotPath returns partition name for the snapshot at <storageDataPath>/partitions/YYYYMMDD/snapshots/<snapshotName>.
+func getPartitionNameFromSnapshotPath(snapshotPath string) (string, error) {
+	snapshotsPath := filepath.Dir(filepath.Clean(snapshotPath))
+	if filepath.Base(snapshotsPath) != "snapshots" {
+		return "", fmt.Errorf("unexpected snapshot path %q; it must have the form <storageDataPath>/partitions/YYYYMMDD/snapshots/<snapshotName>", snapshotPath)
+	}
+	name := filepath.Base(filepath.Dir(snapshotsPath))
+	if _, err := time.Parse(partitionNameFormat, name); err != nil {
+		return "", fmt.Errorf("unexpected partition name %q in the snapshot path %q; it must have YYYYMMDD format", name, snapshotPath)
+	}
+	return name, nil
+}
+
+// listLocalFiles returns files from indexdb and datadb directories at partitionPath.
+//
+// The returned files are sorted by path.
+func listLocalFiles(partitionPath string) ([]fileInfo, error) {
+	var fis []fileInfo
+	for _, dirname := range partitionDirnames {
+		dir := filepath.Join(partitionPath, dirname)
+		if !vmfs.IsPathExist(dir) {
+			continue
+		}
+		err := filepath.WalkDir(dir, func(path string, de fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if de.IsDir() || vmfs.IsTemporaryFileName(path) {
+				return nil
+			}
+			fi, err := de.Info()
+			if err != nil {
+				return err
+			}
+			relPath, err := filepath.Rel(partitionPath, path)
+			if err != nil {
+				return err
+			}
+			fis = append(fis, fileInfo{
+				Path: filepath.ToSlash(relPath),
+				Size: fi.Size(),
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cannot list files at %q: %w", dir, err)
+		}
+	}
+	sort.Slice(fis, func(i, j int) bool {
+		return fis[i].Path < fis[j].Path
+	})
+	return fis, nil
+}
+
+// calculateChecksums sets SHA256 for fis located at partitionPath.
+func calculateChecksums(ctx context.Context, partitionPath string, fis []fileInfo, concurrency int) error {
+	return runParallel(ctx, concurrency, len(fis), func(i int) error {
+		path := filepath.Join(partitionPath, filepath.FromSlash(fis[i].Path))
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return fmt.Errorf("cannot read %q: %w", path, err)
+		}
+		fis[i].SHA256 = hex.EncodeToString(h.Sum(nil))
+		return nil
+	})
+}
+
+func uploadFile(ctx context.Context, snapshotPath string, fi fileInfo, dst RemoteFS) error {
+	path := filepath.Join(snapshotPath, filepath.FromSlash(fi.Path))
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := dst.WriteFile(ctx, fi.Path, f, fi.Size); err != nil {
+		return fmt.Errorf("cannot upload %q to %s: %w", path, dst, err)
+	}
+	return nil
+}
+
+func downloadFile(ctx context.Context, src RemoteFS, fi fileInfo, partitionPath string) error {
+	path := filepath.Join(partitionPath, filepath.FromSlash(fi.Path))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("cannot create directory for %q: %w", path, err)
+	}
+
+	r, err := src.ReadFile(ctx, fi.Path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	tmpPath := path + ".tmp.0"
+	h := sha256.New()
+	if err := writeFileSync(tmpPath, io.TeeReader(r, h), fi.Size); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("cannot download %q from %s: %w", fi.Path, src, err)
+	}
+	if checksum := hex.EncodeToString(h.Sum(nil)); checksum != fi.SHA256 {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("checksum mismatch for %q downloaded from %s; got %s; want %s", fi.Path, src, checksum, fi.SHA256)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("cannot rename %q to %q: %w", tmpPath, path, err)
+	}
+	return nil
+}
+
+func verifyRemoteFiles(remoteFiles []RemoteFile, fis []fileInfo) error {
+	remoteSizes := make(map[string]int64, len(remoteFiles))
+	for _, rf := range remoteFiles {
+		remoteSizes[rf.Path] = rf.Size
+	}
+	for _, fi := range fis {
+		size, ok := remoteSizes[fi.Path]
+		if !ok {
+			return fmt.Errorf("missing file %q", fi.Path)
+		}
+		if size != fi.Size {
+			return fmt.Errorf("unexpected size for %q; got %d bytes; want %d bytes", fi.Path, size, fi.Size)
+		}
+	}
+	return nil
+}
+
+func readManifest(ctx context.Context, rfs RemoteFS) (*manifest, error) {
+	r, err := rfs.ReadFile(ctx, manifestFilename)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s from %s: %w", manifestFilename, rfs, err)
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s from %s: %w", manifestFilename, rfs, err)
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("cannot parse %s from %s: %w", manifestFilename, rfs, err)
+	}
+	return &m, nil
+}
+
+func writeManifest(ctx context.Context, rfs RemoteFS, m *manifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("BUG: cannot marshal backup manifest: %w", err)
+	}
+	if err := rfs.WriteFile(ctx, manifestFilename, strings.NewReader(string(data)), int64(len(data))); err != nil {
+		return fmt.Errorf("cannot write %s to %s: %w", manifestFilename, rfs, err)
+	}
+	return nil
+}
+
+// isValidRelativePath returns true if path points to a file inside indexdb or datadb directory.
+func isValidRelativePath(path string) bool {
+	if filepath.IsAbs(path) || strings.Contains(path, "\\") {
+		return false
+	}
+	for _, s := range strings.Split(path, "/") {
+		if s == "" || s == "." || s == ".." {
+			return false
+		}
+	}
+	dirname, _, ok := strings.Cut(path, "/")
+	return ok && (dirname == partitionDirnames[0] || dirname == partitionDirnames[1])
+}
+
+// mustRemoveEmptyDirsAndSync removes empty directories inside dir and syncs the remaining directories.
+func mustRemoveEmptyDirsAndSync(dir string) {
+	for _, de := range vmfs.MustReadDir(dir) {
+		if !de.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, de.Name())
+		mustRemoveEmptyDirsAndSync(path)
+		if len(vmfs.MustReadDir(path)) == 0 {
+			vmfs.MustRemoveDir(path)
+		}
+	}
+	vmfs.MustSyncPath(dir)
+}
+
+// runParallel calls f for indexes [0..n) in up to concurrency parallel goroutines.
+//
+// It returns the first error returned by f.
+func runParallel(ctx context.Context, concurrency, n int, f func(i int) error) error {
+	concurrency = max(concurrency, 1)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var errOnce sync.Once
+	var firstErr error
+	workCh := make(chan int)
+	var wg sync.WaitGroup
+	for range min(concurrency, n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range workCh {
+				if err := f(i); err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		select {
+		case workCh <- i:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(workCh)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,570 @@
+package backup
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	vmfs "github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestBackupRestoreFS(t *testing.T) {
+	path := t.Name()
+	defer vmfs.MustRemoveDir(path)
+
+	backupPath, err := filepath.Abs(filepath.Join(path, "backup"))
+	if err != nil {
+		t.Fatalf("cannot obtain absolute path: %s", err)
+	}
+	rfs, err := NewRemoteFS("fs://" + backupPath)
+	if err != nil {
+		t.Fatalf("cannot create remote fs: %s", err)
+	}
+	testBackupRestore(t, path, rfs)
+}
+
+func TestBackupRestoreS3(t *testing.T) {
+	path := t.Name()
+	defer vmfs.MustRemoveDir(path)
+
+	fs3 := newFakeS3Server()
+	defer fs3.s.Close()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "test-key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test-secret")
+
+	endpointOrig := *customS3Endpoint
+	partSizeOrig := s3MultipartPartSize
+	defer func() {
+		*customS3Endpoint = endpointOrig
+		s3MultipartPartSize = partSizeOrig
+	}()
+	*customS3Endpoint = fs3.s.URL
+
+	// Use small part size in order to verify multipart uploads.
+	s3MultipartPartSize = 1024
+
+	rfs, err := NewRemoteFS("s3://test-bucket/backups/foo")
+	if err != nil {
+		t.Fatalf("cannot create remote fs: %s", err)
+	}
+	testBackupRestore(t, path, rfs)
+
+	if fs3.multipartUploads.Load() == 0 {
+		t.Fatalf("expecting non-zero multipart uploads")
+	}
+	fs3.mu.Lock()
+	for key := range fs3.objects {
+		if !strings.HasPrefix(key, "test-bucket/backups/foo/") {
+			t.Fatalf("unexpected object key %q", key)
+		}
+	}
+	fs3.mu.Unlock()
+}
+
+func testBackupRestore(t *testing.T, path string, rfs RemoteFS) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	srcPath := filepath.Join(path, "src")
+	dstPath := filepath.Join(path, "dst")
+
+	// Create the initial backup and restore it.
+	s := logstorage.MustOpenStorage(srcPath, &logstorage.StorageConfig{})
+	timestamp := time.Now().UnixNano()
+	partitionName := time.Unix(0, timestamp).UTC().Format(partitionNameFormat)
+	addTestRows(s, timestamp, 0, 100)
+	snapshotPath := mustCreateSnapshot(t, s, partitionName)
+	s.MustClose()
+
+	if err := Backup(ctx, snapshotPath, rfs, 4); err != nil {
+		t.Fatalf("cannot make backup: %s", err)
+	}
+	if err := Restore(ctx, rfs, dstPath, "", 4); err != nil {
+		t.Fatalf("cannot restore backup: %s", err)
+	}
+	checkRowsCount(t, dstPath, 100)
+
+	// Make incremental backup and restore it over the previously restored data.
+	s = logstorage.MustOpenStorage(srcPath, &logstorage.StorageConfig{})
+	addTestRows(s, timestamp, 100, 50)
+	s.MustForceMerge(partitionName)
+	snapshotPath = mustCreateSnapshot(t, s, partitionName)
+	s.MustClose()
+
+	if err := Backup(ctx, snapshotPath, rfs, 4); err != nil {
+		t.Fatalf("cannot make incremental backup: %s", err)
+	}
+	if err := Restore(ctx, rfs, dstPath, "", 4); err != nil {
+		t.Fatalf("cannot restore incremental backup: %s", err)
+	}
+	checkRowsCount(t, dstPath, 150)
+
+	// Make sure the restored partition matches the snapshot.
+	srcFiles, err := listLocalFiles(snapshotPath)
+	if err != nil {
+		t.Fatalf("cannot list snapshot files: %s", err)
+	}
+	dstFiles, err := listLocalFiles(filepath.Join(dstPath, "partitions", partitionName))
+	if err != nil {
+		t.Fatalf("cannot list restored files: %s", err)
+	}
+	if len(srcFiles) != len(dstFiles) {
+		t.Fatalf("unexpected number of restored files; got %d; want %d", len(dstFiles), len(srcFiles))
+	}
+	for i := range srcFiles {
+		if srcFiles[i].Path != dstFiles[i].Path || srcFiles[i].Size != dstFiles[i].Size {
+			t.Fatalf("unexpected restored file; got %+v; want %+v", dstFiles[i], srcFiles[i])
+		}
+	}
+
+	// Repeated backup mustn't upload any files.
+	remoteFilesBefore, err := rfs.ListFiles(ctx)
+	if err != nil {
+		t.Fatalf("cannot list remote files: %s", err)
+	}
+	if err := Backup(ctx, snapshotPath, rfs, 4); err != nil {
+		t.Fatalf("cannot repeat backup: %s", err)
+	}
+	remoteFilesAfter, err := rfs.ListFiles(ctx)
+	if err != nil {
+		t.Fatalf("cannot list remote files: %s", err)
+	}
+	if len(remoteFilesBefore) != len(remoteFilesAfter) {
+		t.Fatalf("unexpected number of remote files after repeated backup; got %d; want %d", len(remoteFilesAfter), len(remoteFilesBefore))
+	}
+
+	// Corrupted backup mustn't be restored.
+	var victim RemoteFile
+	for _, rf := range remoteFilesAfter {
+		if rf.Path != manifestFilename && rf.Size > 0 {
+			victim = rf
+			break
+		}
+	}
+	r, err := rfs.ReadFile(ctx, victim.Path)
+	if err != nil {
+		t.Fatalf("cannot read %q: %s", victim.Path, err)
+	}
+	data, err := io.ReadAll(r)
+	_ = r.Close()
+	if err != nil {
+		t.Fatalf("cannot read %q: %s", victim.Path, err)
+	}
+	for i := range data {
+		data[i] ^= 0xff
+	}
+	if err := rfs.WriteFile(ctx, victim.Path, strings.NewReader(string(data)), victim.Size); err != nil {
+		t.Fatalf("cannot corrupt %q: %s", victim.Path, err)
+	}
+	err = Restore(ctx, rfs, filepath.Join(path, "dst-corrupted"), "", 4)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expecting checksum mismatch error; got %v", err)
+	}
+
+	// Incomplete backup mustn't be restored.
+	if err := rfs.DeleteFile(ctx, manifestFilename); err != nil {
+		t.Fatalf("cannot delete manifest: %s", err)
+	}
+	if err := Restore(ctx, rfs, filepath.Join(path, "dst-incomplete"), "", 4); err == nil {
+		t.Fatalf("expecting non-nil error when restoring incomplete backup")
+	}
+}
+
+func TestRestoreColdPartition(t *testing.T) {
+	path := t.Name()
+	defer vmfs.MustRemoveDir(path)
+
+	backupPath, err := filepath.Abs(filepath.Join(path, "backup"))
+	if err != nil {
+		t.Fatalf("cannot obtain absolute path: %s", err)
+	}
+	rfs, err := NewRemoteFS("fs://" + backupPath)
+	if err != nil {
+		t.Fatalf("cannot create remote fs: %s", err)
+	}
+
+	ctx := context.Background()
+
+	srcPath := filepath.Join(path, "src")
+	dstPath := filepath.Join(path, "dst")
+	dstColdPath := filepath.Join(path, "dst-cold")
+
+	s := logstorage.MustOpenStorage(srcPath, &logstorage.StorageConfig{})
+	timestamp := time.Now().UnixNano()
+	partitionName := time.Unix(0, timestamp).UTC().Format(partitionNameFormat)
+	addTestRows(s, timestamp, 0, 100)
+	snapshotPath := mustCreateSnapshot(t, s, partitionName)
+	s.MustClose()
+
+	if err := Backup(ctx, snapshotPath, rfs, 4); err != nil {
+		t.Fatalf("cannot make backup: %s", err)
+	}
+
+	// The partition missing at the cold path must be restored to the hot path.
+	if err := Restore(ctx, rfs, dstPath, dstColdPath, 4); err != nil {
+		t.Fatalf("cannot restore backup: %s", err)
+	}
+	if !vmfs.IsPathExist(filepath.Join(dstPath, "partitions", partitionName)) {
+		t.Fatalf("the partition must be restored to the hot path")
+	}
+	vmfs.MustRemoveDir(dstPath)
+
+	// The partition existing at the cold path must be restored there, since it is preferred over the partition at the hot path.
+	vmfs.MustMkdirIfNotExist(filepath.Join(dstColdPath, "partitions", partitionName))
+	if err := Restore(ctx, rfs, dstPath, dstColdPath, 4); err != nil {
+		t.Fatalf("cannot restore backup: %s", err)
+	}
+	if vmfs.IsPathExist(filepath.Join(dstPath, "partitions", partitionName)) {
+		t.Fatalf("the partition mustn't be restored to the hot path if it exists at the cold path")
+	}
+
+	sc := &logstorage.StorageConfig{
+		ColdPath:  dstColdPath,
+		ColdAfter: 30 * 24 * time.Hour,
+	}
+	s = logstorage.MustOpenStorage(dstPath, sc)
+	var ss logstorage.StorageStats
+	s.UpdateStats(&ss)
+	s.MustClose()
+	if n := ss.RowsCount(); n != 100 {
+		t.Fatalf("unexpected number of rows in the restored storage; got %d; want 100", n)
+	}
+}
+
+func addTestRows(s *logstorage.Storage, timestamp int64, offset, rowsCount int) {
+	lr := logstorage.GetLogRows([]string{"host"}, nil, nil, nil, "")
+	for i := offset; i < offset+rowsCount; i++ {
+		fields := []logstorage.Field{
+			{
+				Name:  "host",
+				Value: fmt.Sprintf("host-%d", i%3),
+			},
+			{
+				Name:  "_msg",
+				Value: fmt.Sprintf("log message #%d", i),
+			},
+		}
+		lr.MustAdd(logstorage.TenantID{}, timestamp+int64(i), fields, nil)
+	}
+	s.MustAddRows(lr)
+	logstorage.PutLogRows(lr)
+	s.DebugFlush()
+}
+
+func mustCreateSnapshot(t *testing.T, s *logstorage.Storage, partitionName string) string {
+	t.Helper()
+
+	snapshotPath, err := s.PartitionSnapshotCreate(partitionName)
+	if err != nil {
+		t.Fatalf("cannot create snapshot: %s", err)
+	}
+	return snapshotPath
+}
+
+func checkRowsCount(t *testing.T, storagePath string, rowsCountExpected uint64) {
+	t.Helper()
+
+	s := logstorage.MustOpenStorage(storagePath, &logstorage.StorageConfig{})
+	defer s.MustClose()
+
+	var ss logstorage.StorageStats
+	s.UpdateStats(&ss)
+	if n := ss.RowsCount(); n != rowsCountExpected {
+		t.Fatalf("unexpected number of rows in the restored storage; got %d; want %d", n, rowsCountExpected)
+	}
+}
+
+func TestGetPartitionNameFromSnapshotPath(t *testing.T) {
+	f := func(snapshotPath, nameExpected string) {
+		t.Helper()
+
+		name, err := getPartitionNameFromSnapshotPath(snapshotPath)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if name != nameExpected {
+			t.Fatalf("unexpected partition name; got %q; want %q", name, nameExpected)
+		}
+	}
+
+	f("/data/partitions/20250102/snapshots/20250102143000-1844B4C1A93E6A67", "20250102")
+	f("/data/partitions/20250102/snapshots/20250102143000-1844B4C1A93E6A67/", "20250102")
+}
+
+func TestGetPartitionNameFromSnapshotPathFailure(t *testing.T) {
+	f := func(snapshotPath string) {
+		t.Helper()
+
+		if _, err := getPartitionNameFromSnapshotPath(snapshotPath); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	f("")
+	f("/data/partitions/20250102")
+	f("/data/partitions/20250102/foo/bar")
+	f("/data/partitions/foo/snapshots/bar")
+}
+
+func TestIsValidRelativePath(t *testing.T) {
+	f := func(path string, resultExpected bool) {
+		t.Helper()
+
+		result := isValidRelativePath(path)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for %q; got %v; want %v", path, result, resultExpected)
+		}
+	}
+
+	f("indexdb/parts.json", true)
+	f("datadb/18A1B2C3D4E5F607/values.bin", true)
+	f("", false)
+	f("parts.json", false)
+	f("snapshots/foo", false)
+	f("/datadb/parts.json", false)
+	f("datadb/../../foo", false)
+	f("datadb//parts.json", false)
+	f("datadb\\parts.json", false)
+}
+
+func TestNewRemoteFSFailure(t *testing.T) {
+	f := func(location string) {
+		t.Helper()
+
+		if _, err := NewRemoteFS(location); err == nil {
+			t.Fatalf("expecting non-nil error for %q", location)
+		}
+	}
+
+	f("")
+	f("/foo/bar")
+	f("fs://foo/bar")
+	f("gcs://bucket/foo")
+	f("s3://")
+}
+
+func TestParseS3Credentials(t *testing.T) {
+	data := `
+# comment
+[default]
+aws_access_key_id = foo
+aws_secret_access_key = bar
+
+[other]
+aws_access_key_id=baz
+aws_secret_access_key=qux
+aws_session_token=token
+`
+	f := func(profile string, credsExpected *s3Credentials) {
+		t.Helper()
+
+		creds, err := parseS3Credentials([]byte(data), profile)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if *creds != *credsExpected {
+			t.Fatalf("unexpected credentials; got %+v; want %+v", creds, credsExpected)
+		}
+	}
+
+	f("default", &s3Credentials{
+		accessKeyID:     "foo",
+		secretAccessKey: "bar",
+	})
+	f("other", &s3Credentials{
+		accessKeyID:     "baz",
+		secretAccessKey: "qux",
+		sessionToken:    "token",
+	})
+
+	if _, err := parseS3Credentials([]byte(data), "missing"); err == nil {
+		t.Fatalf("expecting non-nil error for missing profile")
+	}
+}
+
+// fakeS3Server is a minimal S3-compatible server for tests.
+//
+// It supports path-style requests for object uploads, downloads, deletions, listing and multipart uploads.
+type fakeS3Server struct {
+	s *httptest.Server
+
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int][]byte
+
+	multipartUploads atomic.Int64
+}
+
+func newFakeS3Server() *fakeS3Server {
+	fs3 := &fakeS3Server{
+		objects: make(map[string][]byte),
+		uploads: make(map[string]map[int][]byte),
+	}
+	fs3.s = httptest.NewServer(http.HandlerFunc(fs3.handle))
+	return fs3
+}
+
+func (fs3 *fakeS3Server) handle(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test-key/") {
+		http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	objectKey := bucket + "/" + key
+	qs := r.URL.Query()
+
+	fs3.mu.Lock()
+	defer fs3.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		fs3.handleList(w, bucket, qs)
+	case r.Method == http.MethodGet:
+		data, ok := fs3.objects[objectKey]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case r.Method == http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if uploadID := qs.Get("uploadId"); uploadID != "" {
+			parts := fs3.uploads[uploadID]
+			if parts == nil {
+				http.Error(w, "<Error><Code>NoSuchUpload</Code></Error>", http.StatusNotFound)
+				return
+			}
+			partNumber, _ := strconv.Atoi(qs.Get("partNumber"))
+			parts[partNumber] = data
+			w.Header().Set("ETag", fmt.Sprintf(`"etag-%d"`, partNumber))
+			return
+		}
+		fs3.objects[objectKey] = data
+	case r.Method == http.MethodPost && qs.Has("uploads"):
+		uploadID := fmt.Sprintf("upload-%d", len(fs3.uploads))
+		fs3.uploads[uploadID] = make(map[int][]byte)
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", uploadID)
+	case r.Method == http.MethodPost && qs.Has("uploadId"):
+		uploadID := qs.Get("uploadId")
+		parts := fs3.uploads[uploadID]
+		var cmu completeMultipartUpload
+		if err := xml.NewDecoder(r.Body).Decode(&cmu); err != nil || parts == nil {
+			http.Error(w, "<Error><Code>InvalidRequest</Code></Error>", http.StatusBadRequest)
+			return
+		}
+		var data []byte
+		for _, p := range cmu.Parts {
+			data = append(data, parts[p.PartNumber]...)
+		}
+		fs3.objects[objectKey] = data
+		delete(fs3.uploads, uploadID)
+		fs3.multipartUploads.Add(1)
+		fmt.Fprintf(w, "<CompleteMultipartUploadResult><Key>%s</Key></CompleteMultipartUploadResult>", key)
+	case r.Method == http.MethodDelete && qs.Has("uploadId"):
+		delete(fs3.uploads, qs.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete:
+		delete(fs3.objects, objectKey)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unsupported request", http.StatusBadRequest)
+	}
+}
+
+func (fs3 *fakeS3Server) handleList(w http.ResponseWriter, bucket string, qs map[string][]string) {
+	// Return small pages in order to verify pagination.
+	const maxKeys = 3
+
+	prefix := bucket + "/" + firstValue(qs["prefix"])
+	var keys []string
+	for k := range fs3.objects {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	start := 0
+	if token := firstValue(qs["continuation-token"]); token != "" {
+		start, _ = strconv.Atoi(token)
+	}
+	end := min(start+maxKeys, len(keys))
+
+	var sb strings.Builder
+	sb.WriteString("<ListBucketResult>")
+	for _, k := range keys[start:end] {
+		fmt.Fprintf(&sb, "<Contents><Key>%s</Key><Size>%d</Size></Contents>", strings.TrimPrefix(k, bucket+"/"), len(fs3.objects[k]))
+	}
+	if end < len(keys) {
+		fmt.Fprintf(&sb, "<IsTruncated>true</IsTruncated><NextContinuationToken>%d</NextContinuationToken>", end)
+	} else {
+		sb.WriteString("<IsTruncated>false</IsTruncated>")
+	}
+	sb.WriteString("</ListBucketResult>")
+	w.Write([]byte(sb.String()))
+}
+
+func firstValue(a []string) string {
+	if len(a) == 0 {
+		return ""
+	}
+	return a[0]
+}
+
+func TestFSRemoteDeleteFile(t *testing.T) {
+	path, err := filepath.Abs(t.Name())
+	if err != nil {
+		t.Fatalf("cannot obtain absolute path: %s", err)
+	}
+	defer vmfs.MustRemoveDir(path)
+
+	fr := newFSRemote(path)
+	ctx := context.Background()
+	if err := fr.WriteFile(ctx, "datadb/foo/bar.bin", strings.NewReader("abc"), 3); err != nil {
+		t.Fatalf("cannot write file: %s", err)
+	}
+	if err := fr.WriteFile(ctx, "datadb/parts.json", strings.NewReader("[]"), 2); err != nil {
+		t.Fatalf("cannot write file: %s", err)
+	}
+	if err := fr.WriteFile(ctx, "datadb/baz.bin", strings.NewReader("abc"), 4); err == nil {
+		t.Fatalf("expecting non-nil error for size mismatch")
+	}
+	if err := fr.DeleteFile(ctx, "datadb/foo/bar.bin"); err != nil {
+		t.Fatalf("cannot delete file: %s", err)
+	}
+	if vmfs.IsPathExist(filepath.Join(path, "datadb", "foo")) {
+		t.Fatalf("empty directory must be removed")
+	}
+
+	rfs, err := fr.ListFiles(ctx)
+	if err != nil {
+		t.Fatalf("cannot list files: %s", err)
+	}
+	if len(rfs) != 1 || rfs[0].Path != "datadb/parts.json" || rfs[0].Size != 2 {
+		t.Fatalf("unexpected files: %+v", rfs)
+	}
+	if _, err := os.Stat(filepath.Join(path, "datadb")); err != nil {
+		t.Fatalf("non-empty directory must be preserved: %s", err)
+	}
+}
@@ -0,0 +1,137 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	vmfs "github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+// fsRemote stores backups at the local filesystem.
+type fsRemote struct {
+	dir string
+}
+
+func newFSRemote(dir string) *fsRemote {
+	return &fsRemote{
+		dir: dir,
+	}
+}
+
+func (fr *fsRemote) String() string {
+	return "fs://" + filepath.ToSlash(fr.dir)
+}
+
+func (fr *fsRemote) ListFiles(_ context.Context) ([]RemoteFile, error) {
+	if !vmfs.IsPathExist(fr.dir) {
+		return nil, nil
+	}
+
+	var rfs []RemoteFile
+	err := filepath.WalkDir(fr.dir, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if de.IsDir() || vmfs.IsTemporaryFileName(path) {
+			return nil
+		}
+		fi, err := de.Info()
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(fr.dir, path)
+		if err != nil {
+			return err
+		}
+		rfs = append(rfs, RemoteFile{
+			Path: filepath.ToSlash(relPath),
+			Size: fi.Size(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list files at %q: %w", fr.dir, err)
+	}
+	return rfs, nil
+}
+
+func (fr *fsRemote) ReadFile(_ context.Context, path string) (io.ReadCloser, error) {
+	f, err := os.Open(fr.getFullPath(path))
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (fr *fsRemote) WriteFile(_ context.Context, path string, r io.Reader, size int64) error {
+	fullPath := fr.getFullPath(path)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return fmt.Errorf("cannot create directory for %q: %w", fullPath, err)
+	}
+
+	// Write the data to a temporary file and then atomically rename it to fullPath,
+	// so partially written files never appear at fullPath.
+	tmpPath := fmt.Sprintf("%s.tmp.%d", fullPath, fsRemoteTmpFileNum.Add(1))
+	if err := writeFileSync(tmpPath, r, size); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, fullPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("cannot rename %q to %q: %w", tmpPath, fullPath, err)
+	}
+	vmfs.MustSyncPath(filepath.Dir(fullPath))
+	return nil
+}
+
+var fsRemoteTmpFileNum atomic.Uint64
+
+func (fr *fsRemote) DeleteFile(_ context.Context, path string) error {
+	fullPath := fr.getFullPath(path)
+	if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// Remove empty parent directories, so they do not accumulate after removing old parts from the backup.
+	dir := filepath.Dir(fullPath)
+	for dir != fr.dir && strings.HasPrefix(dir, fr.dir) {
+		if err := os.Remove(dir); err != nil {
+			// The directory isn't empty
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	return nil
+}
+
+func (fr *fsRemote) getFullPath(path string) string {
+	return filepath.Join(fr.dir, filepath.FromSlash(path))
+}
+
+// writeFileSync writes size bytes from r to the file at the given path and syncs the file to disk.
+func writeFileSync(path string, r io.Reader, size int64) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, r)
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("cannot write data to %q: %w", path, err)
+	}
+	if n != size {
+		_ = f.Close()
+		return fmt.Errorf("unexpected number of bytes written to %q; got %d; want %d", path, n, size)
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("cannot sync %q: %w", path, err)
+	}
+	return f.Close()
+}
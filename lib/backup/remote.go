@@ -0,0 +1,72 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// RemoteFS is a remote location for storing backups.
+//
+// File paths passed to RemoteFS methods are relative to the remote location and use `/` as a separator.
+type RemoteFS interface {
+	// String returns human-readable representation of the remote location.
+	String() string
+
+	// ListFiles returns all the files stored at the remote location.
+	ListFiles(ctx context.Context) ([]RemoteFile, error)
+
+	// ReadFile returns a reader for the file at the given path.
+	//
+	// The caller must close the returned reader.
+	ReadFile(ctx context.Context, path string) (io.ReadCloser, error)
+
+	// WriteFile writes size bytes from r to the file at the given path.
+	//
+	// The existing file at the given path is overwritten.
+	WriteFile(ctx context.Context, path string, r io.Reader, size int64) error
+
+	// DeleteFile deletes the file at the given path.
+	DeleteFile(ctx context.Context, path string) error
+}
+
+// RemoteFile describes a file stored at RemoteFS.
+type RemoteFile struct {
+	// Path is the path to the file relative to the remote location.
+	Path string
+
+	// Size is the file size in bytes.
+	Size int64
+}
+
+// NewRemoteFS returns RemoteFS for the given location.
+//
+// The following locations are supported:
+//
+//   - fs:///path/to/backup - the backup is stored at the local filesystem at /path/to/backup
+//   - s3://bucket/path/to/backup - the backup is stored at S3-compatible object storage
+func NewRemoteFS(location string) (RemoteFS, error) {
+	n := strings.Index(location, "://")
+	if n < 0 {
+		return nil, fmt.Errorf("missing scheme in %q; supported schemes: fs://, s3://", location)
+	}
+	scheme := location[:n]
+	path := location[n+len("://"):]
+	switch scheme {
+	case "fs":
+		if !filepath.IsAbs(path) {
+			return nil, fmt.Errorf("the path in %q must be absolute", location)
+		}
+		return newFSRemote(filepath.Clean(path)), nil
+	case "s3":
+		bucket, prefix, _ := strings.Cut(path, "/")
+		if bucket == "" {
+			return nil, fmt.Errorf("missing bucket name in %q", location)
+		}
+		return newS3Remote(bucket, prefix)
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q in %q; supported schemes: fs://, s3://", scheme, location)
+	}
+}
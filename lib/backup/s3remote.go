@@ -0,0 +1,408 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	customS3Endpoint = flag.String("customS3Endpoint", "", "Custom S3 endpoint for use with S3-compatible storages such as MinIO. "+
+		"AWS S3 endpoint for the -s3Region is used if empty")
+	s3ForcePathStyle = flag.Bool("s3ForcePathStyle", true, "Whether to use path-style requests (http://endpoint/bucket/key) instead of "+
+		"virtual-hosted-style requests (http://bucket.endpoint/key) for the -customS3Endpoint")
+	s3Region = flag.String("s3Region", "", "S3 region to use. It is read from AWS_REGION environment variable if empty. "+
+		"The us-east-1 region is used if AWS_REGION is empty")
+	s3TLSInsecureSkipVerify = flag.Bool("s3TLSInsecureSkipVerify", false, "Whether to skip TLS verification when connecting to the -customS3Endpoint")
+	credsFilePath           = flag.String("credsFilePath", "", "Path to file with S3 credentials in AWS shared credentials file format. "+
+		"Credentials are read from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables if empty. "+
+		"See https://docs.aws.amazon.com/cli/latest/userguide/cli-configure-files.html")
+	configProfile = flag.String("configProfile", "default", "The profile to read from -credsFilePath")
+)
+
+// s3MultipartPartSize is the size of a single part for multipart uploads.
+//
+// Files bigger than this size are uploaded via multipart upload.
+// See https://docs.aws.amazon.com/AmazonS3/latest/userguide/mpuoverview.html
+//
+// It is a variable in order to simplify testing.
+var s3MultipartPartSize int64 = 256 * 1024 * 1024
+
+// s3Remote stores backups at S3-compatible object storage.
+type s3Remote struct {
+	c *http.Client
+
+	// endpoint is the endpoint URL for the bucket.
+	endpoint *url.URL
+
+	// bucketPath is the path prefix for all the objects in the bucket.
+	//
+	// It is empty for virtual-hosted-style requests and contains /bucket for path-style requests.
+	bucketPath string
+
+	bucket string
+	prefix string
+	region string
+	creds  *s3Credentials
+}
+
+func newS3Remote(bucket, prefix string) (*s3Remote, error) {
+	region := *s3Region
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	creds, err := getS3Credentials()
+	if err != nil {
+		return nil, err
+	}
+
+	var endpoint *url.URL
+	bucketPath := ""
+	if *customS3Endpoint == "" {
+		endpoint = &url.URL{
+			Scheme: "https",
+			Host:   bucket + ".s3." + region + ".amazonaws.com",
+		}
+	} else {
+		u, err := url.Parse(*customS3Endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse -customS3Endpoint=%q: %w", *customS3Endpoint, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("unsupported scheme in -customS3Endpoint=%q; supported schemes: http, https", *customS3Endpoint)
+		}
+		endpoint = &url.URL{
+			Scheme: u.Scheme,
+			Host:   u.Host,
+		}
+		if *s3ForcePathStyle {
+			bucketPath = "/" + bucket
+		} else {
+			endpoint.Host = bucket + "." + u.Host
+		}
+	}
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if *s3TLSInsecureSkipVerify {
+		tr.TLSClientConfig = &tls.Config{
+			InsecureSkipVerify: true,
+		}
+	}
+
+	sr := &s3Remote{
+		c: &http.Client{
+			Transport: tr,
+		},
+		endpoint:   endpoint,
+		bucketPath: bucketPath,
+		bucket:     bucket,
+		prefix:     strings.Trim(prefix, "/"),
+		region:     region,
+		creds:      creds,
+	}
+	return sr, nil
+}
+
+func getS3Credentials() (*s3Credentials, error) {
+	if *credsFilePath == "" {
+		creds := &s3Credentials{
+			accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+		if creds.accessKeyID == "" || creds.secretAccessKey == "" {
+			return nil, fmt.Errorf("missing S3 credentials; set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables or pass -credsFilePath command-line flag")
+		}
+		return creds, nil
+	}
+
+	data, err := os.ReadFile(*credsFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read -credsFilePath: %w", err)
+	}
+	creds, err := parseS3Credentials(data, *configProfile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -credsFilePath=%q: %w", *credsFilePath, err)
+	}
+	return creds, nil
+}
+
+// parseS3Credentials parses credentials for the given profile from data in AWS shared credentials file format.
+func parseS3Credentials(data []byte, profile string) (*s3Credentials, error) {
+	var creds s3Credentials
+	section := ""
+	found := false
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if section != profile {
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("missing `=` in line %q", line)
+		}
+		v = strings.TrimSpace(v)
+		switch strings.TrimSpace(k) {
+		case "aws_access_key_id":
+			creds.accessKeyID = v
+			found = true
+		case "aws_secret_access_key":
+			creds.secretAccessKey = v
+		case "aws_session_token":
+			creds.sessionToken = v
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if !found || creds.secretAccessKey == "" {
+		return nil, fmt.Errorf("missing aws_access_key_id or aws_secret_access_key for the profile %q", profile)
+	}
+	return &creds, nil
+}
+
+func (sr *s3Remote) String() string {
+	if sr.prefix == "" {
+		return "s3://" + sr.bucket
+	}
+	return "s3://" + sr.bucket + "/" + sr.prefix
+}
+
+type listBucketResult struct {
+	IsTruncated           bool
+	NextContinuationToken string
+	Contents              []struct {
+		Key  string
+		Size int64
+	}
+}
+
+func (sr *s3Remote) ListFiles(ctx context.Context) ([]RemoteFile, error) {
+	keyPrefix := ""
+	if sr.prefix != "" {
+		keyPrefix = sr.prefix + "/"
+	}
+
+	var rfs []RemoteFile
+	continuationToken := ""
+	for {
+		qs := url.Values{
+			"list-type": {"2"},
+			"prefix":    {keyPrefix},
+		}
+		if continuationToken != "" {
+			qs.Set("continuation-token", continuationToken)
+		}
+		u := sr.getURL("", qs)
+		data, err := sr.doRequest(ctx, http.MethodGet, u, nil, emptyPayloadHash)
+		if err != nil {
+			return nil, fmt.Errorf("cannot list objects at %s: %w", sr, err)
+		}
+		var lbr listBucketResult
+		if err := xml.Unmarshal(data, &lbr); err != nil {
+			return nil, fmt.Errorf("cannot parse the list of objects at %s: %w", sr, err)
+		}
+		for _, c := range lbr.Contents {
+			path := strings.TrimPrefix(c.Key, keyPrefix)
+			if path == "" || strings.HasSuffix(path, "/") {
+				// Skip directory markers
+				continue
+			}
+			rfs = append(rfs, RemoteFile{
+				Path: path,
+				Size: c.Size,
+			})
+		}
+		if !lbr.IsTruncated {
+			return rfs, nil
+		}
+		if lbr.NextContinuationToken == "" {
+			return nil, fmt.Errorf("missing NextContinuationToken in the truncated list of objects at %s", sr)
+		}
+		continuationToken = lbr.NextContinuationToken
+	}
+}
+
+func (sr *s3Remote) ReadFile(ctx context.Context, path string) (io.ReadCloser, error) {
+	u := sr.getURL(path, nil)
+	resp, err := sr.do(ctx, http.MethodGet, u, nil, -1, emptyPayloadHash)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %q from %s: %w", path, sr, err)
+	}
+	return resp.Body, nil
+}
+
+func (sr *s3Remote) WriteFile(ctx context.Context, path string, r io.Reader, size int64) error {
+	if size > s3MultipartPartSize {
+		return sr.writeFileMultipart(ctx, path, r, size)
+	}
+
+	u := sr.getURL(path, nil)
+	resp, err := sr.do(ctx, http.MethodPut, u, r, size, unsignedPayload)
+	if err != nil {
+		return fmt.Errorf("cannot write %q to %s: %w", path, sr, err)
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+type initiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name                `xml:"CompleteMultipartUpload"`
+	Parts   []completeMultipartPart `xml:"Part"`
+}
+
+type completeMultipartPart struct {
+	PartNumber int
+	ETag       string
+}
+
+func (sr *s3Remote) writeFileMultipart(ctx context.Context, path string, r io.Reader, size int64) error {
+	data, err := sr.doRequest(ctx, http.MethodPost, sr.getURL(path, url.Values{"uploads": {""}}), nil, emptyPayloadHash)
+	if err != nil {
+		return fmt.Errorf("cannot initiate multipart upload for %q at %s: %w", path, sr, err)
+	}
+	var imur initiateMultipartUploadResult
+	if err := xml.Unmarshal(data, &imur); err != nil {
+		return fmt.Errorf("cannot parse response for multipart upload initiation for %q at %s: %w", path, sr, err)
+	}
+	uploadID := imur.UploadID
+
+	if err := sr.uploadParts(ctx, path, uploadID, r, size); err != nil {
+		// Abort the upload in order to free up the storage space occupied by the uploaded parts.
+		abortURL := sr.getURL(path, url.Values{"uploadId": {uploadID}})
+		if _, errAbort := sr.doRequest(context.Background(), http.MethodDelete, abortURL, nil, emptyPayloadHash); errAbort != nil {
+			return fmt.Errorf("%w; cannot abort multipart upload: %w", err, errAbort)
+		}
+		return err
+	}
+	return nil
+}
+
+func (sr *s3Remote) uploadParts(ctx context.Context, path, uploadID string, r io.Reader, size int64) error {
+	var cmu completeMultipartUpload
+	for offset := int64(0); offset < size; offset += s3MultipartPartSize {
+		partSize := min(size-offset, s3MultipartPartSize)
+		partNumber := len(cmu.Parts) + 1
+		qs := url.Values{
+			"partNumber": {strconv.Itoa(partNumber)},
+			"uploadId":   {uploadID},
+		}
+		resp, err := sr.do(ctx, http.MethodPut, sr.getURL(path, qs), io.LimitReader(r, partSize), partSize, unsignedPayload)
+		if err != nil {
+			return fmt.Errorf("cannot upload part #%d for %q to %s: %w", partNumber, path, sr, err)
+		}
+		_ = resp.Body.Close()
+		cmu.Parts = append(cmu.Parts, completeMultipartPart{
+			PartNumber: partNumber,
+			ETag:       resp.Header.Get("ETag"),
+		})
+	}
+
+	body, err := xml.Marshal(&cmu)
+	if err != nil {
+		return fmt.Errorf("BUG: cannot marshal CompleteMultipartUpload: %w", err)
+	}
+	data, err := sr.doRequest(ctx, http.MethodPost, sr.getURL(path, url.Values{"uploadId": {uploadID}}), body, sha256Hex(body))
+	if err != nil {
+		return fmt.Errorf("cannot complete multipart upload for %q at %s: %w", path, sr, err)
+	}
+	// S3 may return an error with 200 OK status code for CompleteMultipartUpload request.
+	// See https://docs.aws.amazon.com/AmazonS3/latest/API/API_CompleteMultipartUpload.html
+	if bytes.Contains(data, []byte("<Error>")) {
+		return fmt.Errorf("cannot complete multipart upload for %q at %s: %s", path, sr, data)
+	}
+	return nil
+}
+
+func (sr *s3Remote) DeleteFile(ctx context.Context, path string) error {
+	u := sr.getURL(path, nil)
+	if _, err := sr.doRequest(ctx, http.MethodDelete, u, nil, emptyPayloadHash); err != nil {
+		return fmt.Errorf("cannot delete %q from %s: %w", path, sr, err)
+	}
+	return nil
+}
+
+// getURL returns URL for the object at the given path with the given query args.
+//
+// The URL for the bucket is returned if path is empty.
+func (sr *s3Remote) getURL(path string, qs url.Values) *url.URL {
+	key := path
+	if sr.prefix != "" && path != "" {
+		key = sr.prefix + "/" + path
+	}
+	u := *sr.endpoint
+	u.Path = sr.bucketPath + "/" + key
+	u.RawPath = s3Escape(u.Path, false)
+	u.RawQuery = canonicalQueryString(qs)
+	return &u
+}
+
+// doRequest performs the request with the given body and returns the response body.
+func (sr *s3Remote) doRequest(ctx context.Context, method string, u *url.URL, body []byte, payloadHash string) ([]byte, error) {
+	resp, err := sr.do(ctx, method, u, bytes.NewReader(body), int64(len(body)), payloadHash)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read response body from %s: %w", u.Redacted(), err)
+	}
+	return data, nil
+}
+
+// do performs the request with the given body and returns the response with 2xx status code.
+//
+// The caller must close the response body.
+func (sr *s3Remote) do(ctx context.Context, method string, u *url.URL, body io.Reader, size int64, payloadHash string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create request to %s: %w", u.Redacted(), err)
+	}
+	if size >= 0 {
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+	}
+	signRequestV4(req, payloadHash, sr.creds, sr.region, time.Now())
+
+	resp, err := sr.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status code returned from %s %s: %d; want 2xx; response body: %q", method, u.Redacted(), resp.StatusCode, data)
+	}
+	return resp, nil
+}
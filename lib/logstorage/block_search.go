@@ -219,6 +219,11 @@ func (bs *blockSearch) search(qs *QueryStats, bsw *blockSearchWork, bm *bitmap)
 	bm.setBits()
 	bs.bsw.so.filter.applyToBlockSearch(bs, bm)
 
+	if dms := bsw.so.deleteMarkers; len(dms) > 0 && !bm.isZero() {
+		// Skip log entries marked as deleted.
+		applyDeleteMarkersToBlockSearch(bs, bm, dms)
+	}
+
 	if bm.isZero() {
 		// The filter doesn't match any logs in the current block.
 		return
@@ -20,7 +20,11 @@ func mustMergeBlockStreams(ph *partHeader, bsw *blockStreamWriter, bsrs []*block
 			break
 		}
 		bsr := bsm.readersHeap[0]
-		bsm.mustWriteBlock(&bsr.blockData, bsw)
+		if dms := bsr.getDeleteMarkersForBlock(); len(dms) > 0 {
+			bsm.mustWriteBlockWithDeleteMarkers(&bsr.blockData, dms)
+		} else {
+			bsm.mustWriteBlock(&bsr.blockData, bsw)
+		}
 		if bsr.NextBlock() {
 			heap.Fix(&bsm.readersHeap, 0)
 		} else {
@@ -174,6 +178,26 @@ func (bsm *blockStreamMerger) mustWriteBlock(bd *blockData, bsw *blockStreamWrit
 	}
 }
 
+// mustWriteBlockWithDeleteMarkers writes bd to bsm after dropping log entries marked as deleted by dms.
+func (bsm *blockStreamMerger) mustWriteBlockWithDeleteMarkers(bd *blockData, dms []*deleteMarker) {
+	bsm.checkNextBlock(bd)
+	uniqueFields := len(bd.columnsData) + len(bd.constColumns)
+	switch {
+	case !bd.streamID.equal(&bsm.streamID):
+		// The bd contains another streamID.
+		// Write the current log entries under the current streamID, then process the bd.
+		bsm.mustFlushRows()
+		bsm.streamID = bd.streamID
+	case bsm.uniqueFields+uniqueFields > maxColumnsPerBlock:
+		// Cannot merge bd with bsm.rows, because too many columns will be created.
+		bsm.mustFlushRows()
+	}
+
+	// Log entries must be extracted from bd in order to drop the deleted entries.
+	bsm.mustMergeRowsWithDeleteMarkers(bd, dms)
+	bsm.uniqueFields += uniqueFields
+}
+
 // checkNextBlock checks whether the bd can be written next after the current data.
 func (bsm *blockStreamMerger) checkNextBlock(bd *blockData) {
 	if len(bsm.rows.timestamps) > 0 && bsm.bd.rowsCount > 0 {
@@ -220,6 +244,11 @@ func (bsm *blockStreamMerger) ReadersPaths() string {
 
 // mustMergeRows merges the current log entries inside bsm with bd log entries.
 func (bsm *blockStreamMerger) mustMergeRows(bd *blockData) {
+	bsm.mustMergeRowsWithDeleteMarkers(bd, nil)
+}
+
+// mustMergeRowsWithDeleteMarkers merges the current log entries inside bsm with bd log entries, which aren't marked as deleted by dms.
+func (bsm *blockStreamMerger) mustMergeRowsWithDeleteMarkers(bd *blockData, dms []*deleteMarker) {
 	if bsm.bd.rowsCount > 0 {
 		// Unmarshal log entries from bsm.bd
 		bsm.mustUnmarshalRows(&bsm.bd)
@@ -231,6 +260,13 @@ func (bsm *blockStreamMerger) mustMergeRows(bd *blockData) {
 	rowsLen := len(bsm.rows.timestamps)
 	bsm.mustUnmarshalRows(bd)
 
+	if len(dms) > 0 {
+		// Drop the deleted log entries from bd
+		n := removeDeletedRows(&bd.streamID, bsm.rows.timestamps[rowsLen:], bsm.rows.rows[rowsLen:], dms)
+		bsm.rows.timestamps = bsm.rows.timestamps[:rowsLen+n]
+		bsm.rows.rows = bsm.rows.rows[:rowsLen+n]
+	}
+
 	// Merge unmarshaled log entries
 	timestamps := bsm.rows.timestamps
 	rows := bsm.rows.rows
@@ -264,6 +264,12 @@ type blockStreamReader struct {
 
 	// minTimestampLast is the minimum timestamp for the previously read block
 	minTimestampLast int64
+
+	// deleteMarkers contains delete markers for the part, which must be applied to the read blocks during merge.
+	deleteMarkers []*deleteMarker
+
+	// deleteMarkersBuf is a buffer for delete markers, which apply to the current block.
+	deleteMarkersBuf []*deleteMarker
 }
 
 // reset resets bsr, so it can be reused
@@ -297,6 +303,21 @@ func (bsr *blockStreamReader) reset() {
 
 	bsr.sidLast.reset()
 	bsr.minTimestampLast = 0
+
+	bsr.deleteMarkers = nil
+	clear(bsr.deleteMarkersBuf)
+	bsr.deleteMarkersBuf = bsr.deleteMarkersBuf[:0]
+}
+
+// getDeleteMarkersForBlock returns delete markers, which may apply to the current block.
+//
+// The returned delete markers are valid until the next call to getDeleteMarkersForBlock.
+func (bsr *blockStreamReader) getDeleteMarkersForBlock() []*deleteMarker {
+	if len(bsr.deleteMarkers) == 0 {
+		return nil
+	}
+	bsr.deleteMarkersBuf = getDeleteMarkersForBlock(bsr.deleteMarkersBuf[:0], bsr.deleteMarkers, &bsr.blockData)
+	return bsr.deleteMarkersBuf
 }
 
 // Path returns part path for bsr (e.g. file path, url or in-memory reference)
@@ -252,6 +252,9 @@ type blockStreamWriter struct {
 
 	// indexBlockHeader is used for marshaling the data to metaindexData
 	indexBlockHeader indexBlockHeader
+
+	// tenantsStats contains per-tenant stats for the written blocks
+	tenantsStats []partTenantStats
 }
 
 // reset resets bsw for subsequent reuse.
@@ -279,6 +282,9 @@ func (bsw *blockStreamWriter) reset() {
 	}
 
 	bsw.indexBlockHeader.reset()
+
+	// Do not re-use tenantsStats, since it is passed to partHeader at Finalize().
+	bsw.tenantsStats = nil
 }
 
 // MustInitForInmemoryPart initializes bsw from mp
@@ -412,11 +418,13 @@ func (bsw *blockStreamWriter) mustWriteBlockInternal(sid *streamID, b *block, bd
 	bsw.sidLast = *sid
 
 	bh := getBlockHeader()
+	bytesWritten := bsw.streamWriters.totalBytesWritten()
 	if b != nil {
 		b.mustWriteTo(sid, bh, &bsw.streamWriters)
 	} else {
 		bd.mustWriteTo(bh, &bsw.streamWriters)
 	}
+	bsw.updateTenantsStats(&sid.tenantID, bh, bsw.streamWriters.totalBytesWritten()-bytesWritten)
 
 	th := &bh.timestampsHeader
 	if bsw.globalRowsCount == 0 || th.minTimestamp < bsw.globalMinTimestamp {
@@ -449,6 +457,24 @@ func (bsw *blockStreamWriter) mustWriteBlockInternal(sid *streamID, b *block, bd
 	}
 }
 
+// updateTenantsStats updates bsw.tenantsStats with the stats for the written block with the given bh and compressedSize for the given tenantID.
+//
+// Blocks are written in the order of their streamIDs, so the blocks for the same tenant are written sequentially.
+func (bsw *blockStreamWriter) updateTenantsStats(tenantID *TenantID, bh *blockHeader, compressedSize uint64) {
+	tss := bsw.tenantsStats
+	if len(tss) == 0 || tss[len(tss)-1].AccountID != tenantID.AccountID || tss[len(tss)-1].ProjectID != tenantID.ProjectID {
+		tss = append(tss, partTenantStats{
+			AccountID: tenantID.AccountID,
+			ProjectID: tenantID.ProjectID,
+		})
+		bsw.tenantsStats = tss
+	}
+	ts := &tss[len(tss)-1]
+	ts.CompressedSizeBytes += compressedSize
+	ts.UncompressedSizeBytes += bh.uncompressedSizeBytes
+	ts.RowsCount += bh.rowsCount
+}
+
 func (bsw *blockStreamWriter) mustFlushIndexBlock(data []byte) {
 	if len(data) > 0 {
 		bsw.indexBlockHeader.mustWriteIndexBlock(data, bsw.sidFirst, bsw.minTimestamp, bsw.maxTimestamp, &bsw.streamWriters)
@@ -473,6 +499,7 @@ func (bsw *blockStreamWriter) Finalize(ph *partHeader) {
 	ph.MinTimestamp = bsw.globalMinTimestamp
 	ph.MaxTimestamp = bsw.globalMaxTimestamp
 	ph.BloomValuesShardsCount = uint64(len(bsw.streamWriters.bloomValuesShards))
+	ph.TenantsStats = bsw.tenantsStats
 
 	bsw.mustFlushIndexBlock(bsw.indexBlockData)
 
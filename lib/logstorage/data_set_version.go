@@ -0,0 +1,108 @@
+package logstorage
+
+import (
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// dataSetVersionJSON is JSON representation of the data set version stored in dataSetVersionFilename file at the Storage directory.
+type dataSetVersionJSON struct {
+	Version uint64 `json:"version"`
+
+	// Partitions contains fingerprints for the parts of every partition at the time the file was written.
+	Partitions map[string]uint64 `json:"partitions"`
+}
+
+// MaxIngestionDelay is the maximum age of the ingested logs, which doesn't change the data set version.
+//
+// Ingesting logs with timestamps older than the current time minus MaxIngestionDelay changes the version returned by Storage.GetDataSetVersion,
+// so query results over time ranges older than MaxIngestionDelay can be cached until the version changes.
+const MaxIngestionDelay = 15 * time.Minute
+
+// GetDataSetVersion returns the version of the set of logs stored at s.
+//
+// The version changes every time the stored logs are changed other than by ingestion of recent logs - when partitions are attached, detached
+// or dropped because of retention, when logs are deleted or dropped because of retention rules, when logs older than MaxIngestionDelay are ingested,
+// and when partitions are changed while s is closed (for example, when they are restored from backups).
+//
+// The version persists across restarts, so it can be used for invalidating persisted caches for query results.
+func (s *Storage) GetDataSetVersion() uint64 {
+	return s.dataSetVersion.Load()
+}
+
+// updateDataSetVersion must be called every time the stored logs are changed other than by ingestion of logs newer than MaxIngestionDelay.
+func (s *Storage) updateDataSetVersion() {
+	s.dataSetVersion.Add(1)
+}
+
+// mustLoadDataSetVersion loads the data set version for s with the given partitionPaths.
+//
+// The version is changed if partitionPaths do not match the partitions at the time the version was saved via mustSaveDataSetVersion.
+func (s *Storage) mustLoadDataSetVersion(partitionPaths []string) {
+	path := filepath.Join(s.path, dataSetVersionFilename)
+
+	var dsv dataSetVersionJSON
+	isValid := false
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Panicf("FATAL: cannot read %s: %s", path, err)
+		}
+	} else {
+		if err := json.Unmarshal(data, &dsv); err != nil {
+			logger.Errorf("cannot parse %s: %s; changing the data set version", path, err)
+		} else {
+			isValid = maps.Equal(dsv.Partitions, getPartitionsFingerprints(partitionPaths))
+		}
+
+		// Remove the file, so the version is changed after unclean shutdown, since partitions may be changed arbitrarily in this case.
+		fs.MustRemovePath(path)
+	}
+
+	version := dsv.Version
+	if !isValid {
+		// Use the current time for the new version, so it doesn't clash with the versions seen before the storage directory was re-created.
+		version = max(version+1, uint64(time.Now().UnixNano()))
+	}
+	s.dataSetVersion.Store(version)
+}
+
+// mustSaveDataSetVersion saves the data set version for s with the given partitionPaths.
+//
+// It must be called after all the partitions at partitionPaths are closed.
+func (s *Storage) mustSaveDataSetVersion(partitionPaths []string) {
+	dsv := &dataSetVersionJSON{
+		Version:    s.dataSetVersion.Load(),
+		Partitions: getPartitionsFingerprints(partitionPaths),
+	}
+	data, err := json.Marshal(dsv)
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal data set version: %s", err)
+	}
+	path := filepath.Join(s.path, dataSetVersionFilename)
+	fs.MustWriteAtomic(path, data, true)
+}
+
+// getPartitionsFingerprints returns fingerprints for the parts registered at the given partitionPaths.
+//
+// The fingerprint changes when the partition is replaced, since new parts always get new names.
+func getPartitionsFingerprints(partitionPaths []string) map[string]uint64 {
+	m := make(map[string]uint64, len(partitionPaths))
+	for _, partitionPath := range partitionPaths {
+		partsPath := filepath.Join(partitionPath, datadbDirname, partsFilename)
+		data, err := os.ReadFile(partsPath)
+		if err != nil && !os.IsNotExist(err) {
+			logger.Panicf("FATAL: cannot read %s: %s", partsPath, err)
+		}
+		m[filepath.Base(partitionPath)] = xxhash.Sum64(data)
+	}
+	return m
+}
@@ -0,0 +1,111 @@
+package logstorage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+func TestStorageDataSetVersion(t *testing.T) {
+	t.Parallel()
+
+	path := t.Name()
+
+	sc := &StorageConfig{
+		Retention: 24 * time.Hour,
+	}
+	s := MustOpenStorage(path, sc)
+
+	tenantID := TenantID{AccountID: 1}
+	lr := GetLogRows(nil, nil, nil, nil, "")
+	lr.MustAdd(tenantID, time.Now().UnixNano(), []Field{{Name: "_msg", Value: "foo"}}, nil)
+	s.MustAddRows(lr)
+	PutLogRows(lr)
+	s.DebugFlush()
+
+	version := s.GetDataSetVersion()
+	if version == 0 {
+		t.Fatalf("the data set version mustn't be zero")
+	}
+
+	// Data ingestion mustn't change the version
+	lr = GetLogRows(nil, nil, nil, nil, "")
+	lr.MustAdd(tenantID, time.Now().UnixNano(), []Field{{Name: "_msg", Value: "bar"}}, nil)
+	s.MustAddRows(lr)
+	PutLogRows(lr)
+	s.DebugFlush()
+	if v := s.GetDataSetVersion(); v != version {
+		t.Fatalf("unexpected data set version after data ingestion; got %d; want %d", v, version)
+	}
+
+	// Ingestion of logs older than MaxIngestionDelay must change the version
+	lr = GetLogRows(nil, nil, nil, nil, "")
+	lr.MustAdd(tenantID, time.Now().Add(-2*MaxIngestionDelay).UnixNano(), []Field{{Name: "_msg", Value: "baz"}}, nil)
+	s.MustAddRows(lr)
+	PutLogRows(lr)
+	s.DebugFlush()
+	if v := s.GetDataSetVersion(); v == version {
+		t.Fatalf("the data set version must change after ingestion of logs older than MaxIngestionDelay")
+	}
+	version = s.GetDataSetVersion()
+
+	// Logs deletion must change the version
+	q := mustParseQuery("bar")
+	if err := s.DeleteRows(newTestQueryContext([]TenantID{tenantID}, q)); err != nil {
+		t.Fatalf("unexpected error when deleting logs: %s", err)
+	}
+	if v := s.GetDataSetVersion(); v == version {
+		t.Fatalf("the data set version must change after logs deletion")
+	}
+	version = s.GetDataSetVersion()
+
+	// Partition detach and attach must change the version
+	partitionNames := s.PartitionList()
+	if len(partitionNames) != 1 {
+		t.Fatalf("unexpected number of partitions; got %d; want 1", len(partitionNames))
+	}
+	partitionName := partitionNames[0]
+	if err := s.PartitionDetach(partitionName); err != nil {
+		t.Fatalf("cannot detach partition: %s", err)
+	}
+	if v := s.GetDataSetVersion(); v == version {
+		t.Fatalf("the data set version must change after partition detach")
+	}
+	version = s.GetDataSetVersion()
+	if err := s.PartitionAttach(partitionName); err != nil {
+		t.Fatalf("cannot attach partition: %s", err)
+	}
+	if v := s.GetDataSetVersion(); v == version {
+		t.Fatalf("the data set version must change after partition attach")
+	}
+	version = s.GetDataSetVersion()
+
+	// The version must persist across restarts
+	s.MustClose()
+	s = MustOpenStorage(path, sc)
+	if v := s.GetDataSetVersion(); v != version {
+		t.Fatalf("unexpected data set version after restart; got %d; want %d", v, version)
+	}
+
+	// The version must change after unclean shutdown
+	s.MustClose()
+	fs.MustRemovePath(filepath.Join(path, dataSetVersionFilename))
+	s = MustOpenStorage(path, sc)
+	if v := s.GetDataSetVersion(); v <= version {
+		t.Fatalf("the data set version must increase after unclean shutdown; got %d; want bigger than %d", v, version)
+	}
+	version = s.GetDataSetVersion()
+
+	// The version must change if partitions are changed while the storage is closed
+	s.MustClose()
+	fs.MustRemoveDir(filepath.Join(path, partitionsDirname, partitionName))
+	s = MustOpenStorage(path, sc)
+	if v := s.GetDataSetVersion(); v <= version {
+		t.Fatalf("the data set version must increase after partitions change; got %d; want bigger than %d", v, version)
+	}
+
+	s.MustClose()
+	fs.MustRemoveDir(path)
+}
@@ -6,6 +6,7 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"sync"
 	"sync/atomic"
@@ -119,6 +120,11 @@ type partWrapper struct {
 	// The flag, which is set when the part must be deleted after refCount reaches zero.
 	mustDrop atomic.Bool
 
+	// retentionRulesCheckedAt is the timestamp in nanoseconds when p was checked for log entries outside the retention rules.
+	//
+	// It is zero if p wasn't checked yet. See datadb.mustDropRowsOutsideRetentionRules.
+	retentionRulesCheckedAt atomic.Int64
+
 	// p is an opened part
 	p *part
 
@@ -130,6 +136,13 @@ type partWrapper struct {
 
 	// The deadline when in-memory part must be flushed to disk.
 	flushDeadline time.Time
+
+	// deleteMarkers contains markers for the deleted log entries in p.
+	//
+	// The marked log entries are skipped during search and are dropped when p is merged.
+	// It is protected by datadb.partsLock. The slice must be updated in copy-on-write manner,
+	// since it may be accessed by concurrently running searches and merges.
+	deleteMarkers []*deleteMarker
 }
 
 func (pw *partWrapper) incRef() {
@@ -187,6 +200,7 @@ func mustOpenDatadb(pt *partition, path string, flushInterval time.Duration) *da
 
 		p := mustOpenFilePart(pt, partPath)
 		pw := newPartWrapper(p, nil, time.Time{})
+		pw.deleteMarkers = mustReadDeleteMarkers(pt.idb, partPath)
 		if p.ph.CompressedSizeBytes > getMaxInmemoryPartSize() {
 			bigParts = append(bigParts, pw)
 		} else {
@@ -536,10 +550,11 @@ func (ddb *datadb) mustMergeParts(pws []*partWrapper, isFinal bool) {
 
 	if isFinal && len(pws) == 1 && pws[0].mp != nil {
 		// Fast path: flush a single in-memory part to disk.
+		// Delete markers aren't applied here - they are moved to the created part instead.
 		mp := pws[0].mp
 		mp.MustStoreToDisk(dstPartPath)
 		pwNew := ddb.openCreatedPart(&mp.ph, pws, nil, dstPartPath)
-		ddb.swapSrcWithDstParts(pws, pwNew, dstPartType)
+		ddb.swapSrcWithDstParts(pws, pwNew, dstPartType, nil)
 		ddb.updateMergeMetrics(dstPartType, mp.ph.RowsCount, startTime, mp.ph.CompressedSizeBytes)
 		return
 	}
@@ -547,6 +562,9 @@ func (ddb *datadb) mustMergeParts(pws []*partWrapper, isFinal bool) {
 	// Prepare blockStreamReaders for source parts.
 	bsrs := mustOpenBlockStreamReaders(pws)
 
+	// Obtain delete markers for source parts, so the marked log entries are dropped during the merge.
+	dmsApplied := ddb.initDeleteMarkersForMerge(pws, bsrs)
+
 	// Prepare BlockStreamWriter for destination part.
 	srcSize := uint64(0)
 	srcRowsCount := uint64(0)
@@ -609,7 +627,7 @@ func (ddb *datadb) mustMergeParts(pws []*partWrapper, isFinal bool) {
 		dstBlocksCount = pDst.ph.BlocksCount
 	}
 
-	ddb.swapSrcWithDstParts(pws, pwNew, dstPartType)
+	ddb.swapSrcWithDstParts(pws, pwNew, dstPartType, dmsApplied)
 	ddb.updateMergeMetrics(dstPartType, srcRowsCount, startTime, dstSize)
 
 	d := time.Since(startTime)
@@ -624,6 +642,52 @@ func (ddb *datadb) mustMergeParts(pws []*partWrapper, isFinal bool) {
 		len(pws), srcRowsCount, srcBlocksCount, srcSize, dstRowsCount, dstBlocksCount, dstSize, durationSecs, rowsPerSec, dstPartPath)
 }
 
+// initDeleteMarkersForMerge sets delete markers from pws to the corresponding bsrs.
+//
+// Delete markers for the configured retention rules are set to bsrs too, so log entries outside the retention rules are dropped during the merge.
+//
+// It returns all the delete markers from pws set to bsrs.
+func (ddb *datadb) initDeleteMarkersForMerge(pws []*partWrapper, bsrs []*blockStreamReader) []*deleteMarker {
+	var dmsApplied []*deleteMarker
+
+	rdms := ddb.pt.getRetentionDeleteMarkers()
+
+	ddb.partsLock.Lock()
+	for i, pw := range pws {
+		dms := pw.deleteMarkers
+		dmsApplied = appendUniqueDeleteMarkers(dmsApplied, dms)
+		if len(rdms) > 0 {
+			dms = append(slices.Clip(dms), rdms...)
+		}
+		bsrs[i].deleteMarkers = dms
+	}
+	ddb.partsLock.Unlock()
+
+	return dmsApplied
+}
+
+// mustAddDeleteMarker adds dm to all the parts, which may contain log entries matching dm.
+func (ddb *datadb) mustAddDeleteMarker(dm *deleteMarker) {
+	ddb.partsLock.Lock()
+	defer ddb.partsLock.Unlock()
+
+	addDeleteMarker := func(pws []*partWrapper) {
+		for _, pw := range pws {
+			ph := &pw.p.ph
+			if !dm.intersectsTimeRange(ph.MinTimestamp, ph.MaxTimestamp) {
+				continue
+			}
+			pw.deleteMarkers = append(slices.Clip(pw.deleteMarkers), dm)
+			if pw.mp == nil {
+				mustWriteDeleteMarkers(pw.p.path, pw.deleteMarkers)
+			}
+		}
+	}
+	addDeleteMarker(ddb.inmemoryParts)
+	addDeleteMarker(ddb.smallParts)
+	addDeleteMarker(ddb.bigParts)
+}
+
 func (ddb *datadb) updateMergeMetrics(partType partType, srcRowCount uint64, startTime time.Time, dstSize uint64) {
 	switch partType {
 	case partInmemory:
@@ -815,6 +879,12 @@ func (ddb *datadb) mustFlushLogRows(lr *logRows) {
 	ddb.inmemoryParts = append(ddb.inmemoryParts, pw)
 	ddb.startInmemoryPartsMergerLocked()
 	ddb.partsLock.Unlock()
+
+	// Change the data set version after the rows become visible for search if they are older than MaxIngestionDelay,
+	// so the cached query results over their time range are invalidated.
+	if mp.ph.MinTimestamp < time.Now().UnixNano()-MaxIngestionDelay.Nanoseconds() {
+		ddb.pt.s.updateDataSetVersion()
+	}
 }
 
 // DatadbStats contains various stats for datadb.
@@ -943,6 +1013,34 @@ func (ddb *datadb) updateStats(s *DatadbStats) {
 	ddb.partsLock.Unlock()
 }
 
+// updateTenantsStats adds per-tenant stats for ddb to m.
+func (ddb *datadb) updateTenantsStats(m map[TenantID]*TenantStats) {
+	ddb.partsLock.Lock()
+	updateTenantsStatsForParts(m, ddb.inmemoryParts)
+	updateTenantsStatsForParts(m, ddb.smallParts)
+	updateTenantsStatsForParts(m, ddb.bigParts)
+	ddb.partsLock.Unlock()
+}
+
+func updateTenantsStatsForParts(m map[TenantID]*TenantStats, pws []*partWrapper) {
+	for _, pw := range pws {
+		for _, pts := range pw.p.ph.TenantsStats {
+			tenantID := TenantID{
+				AccountID: pts.AccountID,
+				ProjectID: pts.ProjectID,
+			}
+			ts := m[tenantID]
+			if ts == nil {
+				ts = &TenantStats{}
+				m[tenantID] = ts
+			}
+			ts.CompressedSizeBytes += pts.CompressedSizeBytes
+			ts.UncompressedSizeBytes += pts.UncompressedSizeBytes
+			ts.RowsCount += pts.RowsCount
+		}
+	}
+}
+
 // debugFlush() makes sure that the recently ingested data is available for search.
 func (ddb *datadb) debugFlush() {
 	ddb.rb.flush()
@@ -985,7 +1083,10 @@ func (ddb *datadb) mustCreateSnapshotAt(dstDir string) {
 	fs.MustSyncPath(dstDir)
 }
 
-func (ddb *datadb) swapSrcWithDstParts(pws []*partWrapper, pwNew *partWrapper, dstPartType partType) {
+// swapSrcWithDstParts atomically replaces pws with pwNew.
+//
+// Delete markers from pws, which are missing in dmsApplied, are moved to pwNew.
+func (ddb *datadb) swapSrcWithDstParts(pws []*partWrapper, pwNew *partWrapper, dstPartType partType, dmsApplied []*deleteMarker) {
 	// Atomically unregister old parts and add new part to pt.
 	partsToRemove := partsToMap(pws)
 
@@ -995,6 +1096,25 @@ func (ddb *datadb) swapSrcWithDstParts(pws []*partWrapper, pwNew *partWrapper, d
 
 	ddb.partsLock.Lock()
 
+	if pwNew != nil {
+		// Move delete markers, which weren't applied during the merge, to pwNew.
+		// This must be performed under partsLock, since delete markers could be added to pws after the merge start.
+		var dms []*deleteMarker
+		for _, pw := range pws {
+			for _, dm := range pw.deleteMarkers {
+				if !slices.Contains(dmsApplied, dm) && !slices.Contains(dms, dm) {
+					dms = append(dms, dm)
+				}
+			}
+		}
+		pwNew.deleteMarkers = dms
+		if dstPartType != partInmemory && len(dms) > 0 {
+			// Persist delete markers before registering pwNew in parts.json,
+			// so the deleted log entries do not re-appear after unclean shutdown.
+			mustWriteDeleteMarkers(pwNew.p.path, dms)
+		}
+	}
+
 	ddb.inmemoryParts, removedInmemoryParts = removeParts(ddb.inmemoryParts, partsToRemove)
 	ddb.smallParts, removedSmallParts = removeParts(ddb.smallParts, partsToRemove)
 	ddb.bigParts, removedBigParts = removeParts(ddb.bigParts, partsToRemove)
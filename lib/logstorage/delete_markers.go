@@ -0,0 +1,265 @@
+package logstorage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// deleteMarker marks log entries matching the given filter for the given tenants as deleted.
+//
+// Delete markers are attached to parts. The marked log entries are skipped during search
+// and are physically dropped when the part is merged with other parts.
+type deleteMarker struct {
+	// tenantIDs is the sorted list of tenants the deleteMarker applies to.
+	tenantIDs []TenantID
+
+	// q is the query with the filter for the deleted log entries.
+	q *Query
+
+	// f is the filter from q with stream filters initialized for the partition the deleteMarker belongs to.
+	f filter
+
+	// minTimestamp and maxTimestamp is the time range for the deleted log entries.
+	minTimestamp int64
+	maxTimestamp int64
+
+	// idb is the indexdb for the partition the deleteMarker belongs to.
+	//
+	// It is used for obtaining _stream values for log entries during merge.
+	idb *indexdb
+}
+
+func newDeleteMarker(idb *indexdb, tenantIDs []TenantID, q *Query) *deleteMarker {
+	tenantIDs = slices.Clone(tenantIDs)
+	sort.Slice(tenantIDs, func(i, j int) bool {
+		return tenantIDs[i].less(&tenantIDs[j])
+	})
+
+	f := q.f
+	if hasStreamFilters(f) {
+		f = initStreamFilters(tenantIDs, idb, f)
+	}
+	minTimestamp, maxTimestamp := q.GetFilterTimeRange()
+
+	return &deleteMarker{
+		tenantIDs:    tenantIDs,
+		q:            q,
+		f:            f,
+		minTimestamp: minTimestamp,
+		maxTimestamp: maxTimestamp,
+		idb:          idb,
+	}
+}
+
+// matchesBlock returns true if dm may apply to the block with the given streamID and the given time range.
+func (dm *deleteMarker) matchesBlock(sid *streamID, minTimestamp, maxTimestamp int64) bool {
+	if minTimestamp > dm.maxTimestamp || maxTimestamp < dm.minTimestamp {
+		return false
+	}
+	tenantIDs := dm.tenantIDs
+	tenantID := &sid.tenantID
+	n := sort.Search(len(tenantIDs), func(i int) bool {
+		return !tenantIDs[i].less(tenantID)
+	})
+	return n < len(tenantIDs) && tenantIDs[n].equal(tenantID)
+}
+
+// intersectsTimeRange returns true if dm may apply to log entries on the given time range.
+func (dm *deleteMarker) intersectsTimeRange(minTimestamp, maxTimestamp int64) bool {
+	return minTimestamp <= dm.maxTimestamp && maxTimestamp >= dm.minTimestamp
+}
+
+// applyDeleteMarkersToBlockSearch unsets bits at bm for the log entries in bs, which are marked as deleted by dms.
+func applyDeleteMarkersToBlockSearch(bs *blockSearch, bm *bitmap, dms []*deleteMarker) {
+	bh := &bs.bsw.bh
+	th := &bh.timestampsHeader
+	bmTmp := getBitmap(bm.bitsLen)
+	for _, dm := range dms {
+		if !dm.matchesBlock(&bh.streamID, th.minTimestamp, th.maxTimestamp) {
+			continue
+		}
+		bmTmp.copyFrom(bm)
+		dm.f.applyToBlockSearch(bs, bmTmp)
+		bm.andNot(bmTmp)
+		if bm.isZero() {
+			break
+		}
+	}
+	putBitmap(bmTmp)
+}
+
+// getDeleteMarkersForBlock appends dms, which may apply to bd, to dst and returns the result.
+func getDeleteMarkersForBlock(dst, dms []*deleteMarker, bd *blockData) []*deleteMarker {
+	td := &bd.timestampsData
+	for _, dm := range dms {
+		if dm.matchesBlock(&bd.streamID, td.minTimestamp, td.maxTimestamp) {
+			dst = append(dst, dm)
+		}
+	}
+	return dst
+}
+
+// removeDeletedRows removes log entries marked as deleted by dms from the given timestamps and rows for the given sid.
+//
+// It returns the number of the remaining log entries, which are moved to the beginning of timestamps and rows.
+func removeDeletedRows(sid *streamID, timestamps []int64, rows [][]Field, dms []*deleteMarker) int {
+	if len(timestamps) == 0 || len(dms) == 0 {
+		return len(timestamps)
+	}
+
+	br := getBlockResult()
+	initBlockResultFromRows(br, dms[0].idb, sid, timestamps, rows)
+
+	bm := getBitmap(len(timestamps))
+	bm.setBits()
+	bmTmp := getBitmap(len(timestamps))
+	for _, dm := range dms {
+		bmTmp.copyFrom(bm)
+		dm.f.applyToBlockResult(br, bmTmp)
+		bm.andNot(bmTmp)
+		if bm.isZero() {
+			break
+		}
+	}
+	putBitmap(bmTmp)
+	putBlockResult(br)
+
+	n := 0
+	for i := range timestamps {
+		if bm.isSetBit(i) {
+			timestamps[n] = timestamps[i]
+			rows[n] = rows[i]
+			n++
+		}
+	}
+	putBitmap(bm)
+
+	return n
+}
+
+// initBlockResultFromRows initializes br from the given log entries for the given sid.
+//
+// br is valid until timestamps and rows are changed.
+func initBlockResultFromRows(br *blockResult, idb *indexdb, sid *streamID, timestamps []int64, rows [][]Field) {
+	br.reset()
+	br.rowsLen = len(timestamps)
+
+	br.timestampsBuf = append(br.timestampsBuf[:0], timestamps...)
+	br.addTimeColumn()
+
+	bb := bbPool.Get()
+	bb.B = sid.marshalString(bb.B[:0])
+	br.addConstColumn("_stream_id", bytesutil.ToUnsafeString(bb.B))
+
+	bb.B = idb.appendStreamTagsByStreamID(bb.B[:0], sid)
+	if len(bb.B) > 0 {
+		st := GetStreamTags()
+		mustUnmarshalStreamTags(st, bytesutil.ToUnsafeString(bb.B))
+		streamStr := st.marshalString(nil)
+		PutStreamTags(st)
+		br.addConstColumn("_stream", bytesutil.ToUnsafeString(streamStr))
+	}
+	bbPool.Put(bb)
+
+	var columnNames []string
+	columnIdxs := make(map[string]int)
+	for _, fields := range rows {
+		for _, f := range fields {
+			if _, ok := columnIdxs[f.Name]; !ok {
+				columnIdxs[f.Name] = len(columnNames)
+				columnNames = append(columnNames, f.Name)
+			}
+		}
+	}
+	columnValues := make([][]string, len(columnNames))
+	for i := range columnValues {
+		columnValues[i] = make([]string, len(rows))
+	}
+	for rowIdx, fields := range rows {
+		for _, f := range fields {
+			columnValues[columnIdxs[f.Name]][rowIdx] = f.Value
+		}
+	}
+	for i, name := range columnNames {
+		br.addResultColumn(resultColumn{
+			name:   getCanonicalColumnName(name),
+			values: columnValues[i],
+		})
+	}
+}
+
+// deleteMarkerJSON is JSON representation of deleteMarker stored in deleteMarkersFilename file inside part directories.
+type deleteMarkerJSON struct {
+	TenantIDs []TenantID `json:"tenantIDs"`
+	Query     string     `json:"query"`
+	Timestamp int64      `json:"timestamp"`
+}
+
+// mustWriteDeleteMarkers stores dms to deleteMarkersFilename at the given partPath.
+//
+// The deleteMarkersFilename is removed if dms is empty.
+func mustWriteDeleteMarkers(partPath string, dms []*deleteMarker) {
+	path := filepath.Join(partPath, deleteMarkersFilename)
+	if len(dms) == 0 {
+		if fs.IsPathExist(path) {
+			fs.MustRemovePath(path)
+		}
+		return
+	}
+
+	a := make([]deleteMarkerJSON, len(dms))
+	for i, dm := range dms {
+		a[i] = deleteMarkerJSON{
+			TenantIDs: dm.tenantIDs,
+			Query:     dm.q.String(),
+			Timestamp: dm.q.GetTimestamp(),
+		}
+	}
+	data, err := json.Marshal(a)
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal delete markers to JSON: %s", err)
+	}
+	fs.MustWriteAtomic(path, data, true)
+}
+
+// mustReadDeleteMarkers reads delete markers from deleteMarkersFilename at the given partPath.
+func mustReadDeleteMarkers(idb *indexdb, partPath string) []*deleteMarker {
+	path := filepath.Join(partPath, deleteMarkersFilename)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		logger.Panicf("FATAL: cannot read %s: %s", path, err)
+	}
+	var a []deleteMarkerJSON
+	if err := json.Unmarshal(data, &a); err != nil {
+		logger.Panicf("FATAL: cannot parse %s: %s", path, err)
+	}
+	dms := make([]*deleteMarker, 0, len(a))
+	for _, dmj := range a {
+		q, err := ParseQueryAtTimestamp(dmj.Query, dmj.Timestamp)
+		if err != nil {
+			logger.Panicf("FATAL: cannot parse delete marker query %q at %s: %s", dmj.Query, path, err)
+		}
+		dms = append(dms, newDeleteMarker(idb, dmj.TenantIDs, q))
+	}
+	return dms
+}
+
+// appendUniqueDeleteMarkers appends dms missing in dst to dst and returns the result.
+func appendUniqueDeleteMarkers(dst, dms []*deleteMarker) []*deleteMarker {
+	for _, dm := range dms {
+		if !slices.Contains(dst, dm) {
+			dst = append(dst, dm)
+		}
+	}
+	return dst
+}
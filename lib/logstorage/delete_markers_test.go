@@ -0,0 +1,145 @@
+package logstorage
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+func TestStorageDeleteRows(t *testing.T) {
+	t.Parallel()
+
+	path := t.Name()
+
+	const streamsCount = 5
+	const rowsPerStream = 100
+
+	sc := &StorageConfig{
+		Retention: 24 * time.Hour,
+	}
+	s := MustOpenStorage(path, sc)
+
+	tenantIDs := []TenantID{
+		{AccountID: 1, ProjectID: 2},
+		{AccountID: 3, ProjectID: 4},
+	}
+	baseTimestamp := time.Now().UnixNano() - 3600*1e9
+	addRows := func(s *Storage) {
+		var fields []Field
+		for _, tenantID := range tenantIDs {
+			lr := GetLogRows([]string{"app"}, nil, nil, nil, "")
+			for i := 0; i < streamsCount; i++ {
+				for j := 0; j < rowsPerStream; j++ {
+					fields = append(fields[:0], Field{
+						Name:  "app",
+						Value: fmt.Sprintf("app-%d", i),
+					}, Field{
+						Name:  "_msg",
+						Value: fmt.Sprintf("message %d", j),
+					}, Field{
+						Name:  "level",
+						Value: []string{"info", "error"}[j%2],
+					})
+					lr.MustAdd(tenantID, baseTimestamp+int64(j)*1e6, fields, nil)
+				}
+			}
+			s.MustAddRows(lr)
+			PutLogRows(lr)
+		}
+		s.DebugFlush()
+	}
+
+	getRowsCount := func(s *Storage, tenantID TenantID, query string) uint64 {
+		t.Helper()
+
+		q := mustParseQuery(query)
+		var rowsCount atomic.Uint64
+		writeBlock := func(_ uint, db *DataBlock) {
+			rowsCount.Add(uint64(db.RowsCount()))
+		}
+		qctx := newTestQueryContext([]TenantID{tenantID}, q)
+		if err := s.RunQuery(qctx, writeBlock); err != nil {
+			t.Fatalf("unexpected error in query [%s]: %s", q, err)
+		}
+		return rowsCount.Load()
+	}
+
+	deleteRows := func(s *Storage, tenantID TenantID, query string) {
+		t.Helper()
+
+		q := mustParseQuery(query)
+		qctx := newTestQueryContext([]TenantID{tenantID}, q)
+		if err := s.DeleteRows(qctx); err != nil {
+			t.Fatalf("unexpected error when deleting rows for [%s]: %s", q, err)
+		}
+	}
+
+	checkRowsCount := func(s *Storage, tenantID TenantID, query string, rowsCountExpected uint64) {
+		t.Helper()
+
+		if n := getRowsCount(s, tenantID, query); n != rowsCountExpected {
+			t.Fatalf("unexpected number of rows for tenant %s and query [%s]; got %d; want %d", &tenantID, query, n, rowsCountExpected)
+		}
+	}
+
+	checkStorage := func(s *Storage) {
+		t.Helper()
+
+		// All the error logs for app-0 must be deleted at the first tenant.
+		checkRowsCount(s, tenantIDs[0], `*`, streamsCount*rowsPerStream-rowsPerStream/2)
+		checkRowsCount(s, tenantIDs[0], `{app="app-0"} level:error`, 0)
+		checkRowsCount(s, tenantIDs[0], `{app="app-0"} level:info`, rowsPerStream/2)
+		checkRowsCount(s, tenantIDs[0], `{app="app-1"} level:error`, rowsPerStream/2)
+
+		// The second tenant must remain untouched.
+		checkRowsCount(s, tenantIDs[1], `*`, streamsCount*rowsPerStream)
+	}
+
+	addRows(s)
+	checkRowsCount(s, tenantIDs[0], `*`, streamsCount*rowsPerStream)
+
+	// Verify that invalid queries are rejected
+	q := mustParseQuery(`* | count()`)
+	if err := s.DeleteRows(newTestQueryContext(tenantIDs, q)); err == nil {
+		t.Fatalf("expecting non-nil error for the query with pipes")
+	}
+
+	// Delete rows and verify they are invisible for search
+	deleteRows(s, tenantIDs[0], `{app="app-0"} level:error`)
+	checkStorage(s)
+
+	// Verify that the deleted rows remain invisible after force merge
+	s.MustForceMerge("")
+	checkStorage(s)
+
+	var ss StorageStats
+	s.UpdateStats(&ss)
+	if n := ss.RowsCount(); n != 2*streamsCount*rowsPerStream-rowsPerStream/2 {
+		t.Fatalf("unexpected number of rows in the storage after force merge; got %d; want %d", n, 2*streamsCount*rowsPerStream-rowsPerStream/2)
+	}
+
+	// Delete rows once again and verify they remain invisible after the storage re-opening
+	deleteRows(s, tenantIDs[0], `{app="app-1"} level:error`)
+	s.MustClose()
+	s = MustOpenStorage(path, sc)
+	checkRowsCount(s, tenantIDs[0], `{app="app-1"} level:error`, 0)
+	checkRowsCount(s, tenantIDs[1], `{app="app-1"} level:error`, rowsPerStream/2)
+
+	// Verify that the newly added rows are visible after the deletion
+	addRows(s)
+	checkRowsCount(s, tenantIDs[0], `{app="app-0"} level:error`, rowsPerStream/2)
+	checkRowsCount(s, tenantIDs[0], `{app="app-1"} level:error`, rowsPerStream/2)
+	checkRowsCount(s, tenantIDs[1], `*`, 2*streamsCount*rowsPerStream)
+
+	// Verify that the newly added rows are preserved after the force merge
+	s.MustForceMerge("")
+	checkRowsCount(s, tenantIDs[0], `{app="app-0"} level:error`, rowsPerStream/2)
+	checkRowsCount(s, tenantIDs[0], `{app="app-1"} level:error`, rowsPerStream/2)
+	checkRowsCount(s, tenantIDs[0], `*`, 2*streamsCount*rowsPerStream-rowsPerStream)
+
+	s.MustClose()
+	fs.MustRemoveDir(path)
+}
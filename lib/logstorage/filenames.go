@@ -18,6 +18,10 @@ const (
 	metadataFilename = "metadata.json"
 	partsFilename    = "parts.json"
 
+	deleteMarkersFilename = "delete_markers.json"
+
+	dataSetVersionFilename = "data_set_version.json"
+
 	indexdbDirname    = "indexdb"
 	datadbDirname     = "datadb"
 	partitionsDirname = "partitions"
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"math"
 	"sort"
 	"sync"
 	"sync/atomic"
@@ -191,6 +192,96 @@ type indexSearch struct {
 	kb  bytesutil.ByteBuffer
 }
 
+// getStreamsCountForTenant returns the number of streams registered for the given tenantID at idb.
+func (idb *indexdb) getStreamsCountForTenant(tenantID TenantID) uint64 {
+	is := idb.getIndexSearch()
+	defer idb.putIndexSearch(is)
+
+	ts := &is.ts
+	kb := &is.kb
+	kb.B = marshalCommonPrefix(kb.B[:0], nsPrefixStreamID, tenantID)
+	prefix := kb.B
+	ts.Seek(prefix)
+	n := uint64(0)
+	for ts.NextItem() {
+		if !bytes.HasPrefix(ts.Item, prefix) {
+			break
+		}
+		n++
+	}
+	if err := ts.Error(); err != nil {
+		logger.Panicf("FATAL: unexpected error: %s", err)
+	}
+	return n
+}
+
+// updateStreamsCountPerTenant adds the number of streams registered at idb per each tenant to m.
+func (idb *indexdb) updateStreamsCountPerTenant(m map[TenantID]uint64) {
+	is := idb.getIndexSearch()
+	defer idb.putIndexSearch(is)
+
+	ts := &is.ts
+	kb := &is.kb
+	kb.B = append(kb.B[:0], nsPrefixStreamID)
+	prefix := kb.B
+	ts.Seek(prefix)
+	var tenantID TenantID
+	for ts.NextItem() {
+		item := ts.Item
+		if !bytes.HasPrefix(item, prefix) {
+			break
+		}
+		if _, _, err := unmarshalCommonPrefix(&tenantID, item); err != nil {
+			logger.Panicf("FATAL: cannot unmarshal tenantID from streamID entry: %s", err)
+		}
+		m[tenantID]++
+	}
+	if err := ts.Error(); err != nil {
+		logger.Panicf("FATAL: unexpected error: %s", err)
+	}
+}
+
+// appendTenantIDs appends tenantIDs with streams registered at idb to dst and returns the result.
+//
+// The appended tenantIDs are sorted.
+func (idb *indexdb) appendTenantIDs(dst []TenantID) []TenantID {
+	is := idb.getIndexSearch()
+	defer idb.putIndexSearch(is)
+
+	ts := &is.ts
+	kb := &is.kb
+	var tenantID TenantID
+	for {
+		kb.B = marshalCommonPrefix(kb.B[:0], nsPrefixStreamID, tenantID)
+		ts.Seek(kb.B)
+		if !ts.NextItem() {
+			break
+		}
+		item := ts.Item
+		if len(item) == 0 || item[0] != nsPrefixStreamID {
+			break
+		}
+		if _, _, err := unmarshalCommonPrefix(&tenantID, item); err != nil {
+			logger.Panicf("FATAL: cannot unmarshal tenantID from streamID entry: %s", err)
+		}
+		dst = append(dst, tenantID)
+
+		// Skip the remaining streams for the found tenant.
+		if tenantID.ProjectID < math.MaxUint32 {
+			tenantID.ProjectID++
+		} else if tenantID.AccountID < math.MaxUint32 {
+			tenantID.AccountID++
+			tenantID.ProjectID = 0
+		} else {
+			break
+		}
+	}
+	if err := ts.Error(); err != nil {
+		logger.Panicf("FATAL: unexpected error: %s", err)
+	}
+	return dst
+}
+
 func (idb *indexdb) getIndexSearch() *indexSearch {
 	v := idb.indexSearchPool.Get()
 	if v == nil {
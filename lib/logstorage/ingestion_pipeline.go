@@ -0,0 +1,208 @@
+package logstorage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// IngestionPipeline is a sequence of LogsQL pipes, which are applied to log entries before storing them.
+//
+// See https://docs.victoriametrics.com/victorialogs/data-ingestion/#ingestion-pipeline
+type IngestionPipeline struct {
+	pipes []pipe
+}
+
+// ParseIngestionPipeline parses ingestion pipeline from s.
+//
+// s must contain LogsQL pipes delimited by '|', such as `unpack_json | delete foo`.
+// Only pipes, which can process every log entry independently, are allowed.
+func ParseIngestionPipeline(s string) (*IngestionPipeline, error) {
+	timestamp := time.Now().UnixNano()
+	lex := newLexer(s, timestamp)
+	if lex.isKeyword("|") {
+		lex.nextToken()
+	}
+
+	pipes, err := parsePipes(lex)
+	if err != nil {
+		return nil, err
+	}
+	if !lex.isEnd() {
+		return nil, fmt.Errorf("unexpected unparsed tail; context: [%s]; tail: [%s]", lex.context(), lex.rawToken+lex.s)
+	}
+
+	for _, p := range pipes {
+		if !p.canLiveTail() {
+			return nil, fmt.Errorf("pipe [%s] cannot be used in ingestion pipeline, since it cannot process every log entry independently", p)
+		}
+		hasSubqueries := false
+		p.visitSubqueries(func(_ *Query) {
+			hasSubqueries = true
+		})
+		if hasSubqueries {
+			return nil, fmt.Errorf("pipe [%s] cannot be used in ingestion pipeline, since it contains subqueries", p)
+		}
+	}
+
+	ip := &IngestionPipeline{
+		pipes: pipes,
+	}
+	return ip, nil
+}
+
+// Concat returns ingestion pipeline, which applies ip pipes and then ipNext pipes.
+//
+// ip or ipNext may be nil.
+func (ip *IngestionPipeline) Concat(ipNext *IngestionPipeline) *IngestionPipeline {
+	if ip == nil {
+		return ipNext
+	}
+	if ipNext == nil {
+		return ip
+	}
+	pipes := make([]pipe, 0, len(ip.pipes)+len(ipNext.pipes))
+	pipes = append(pipes, ip.pipes...)
+	pipes = append(pipes, ipNext.pipes...)
+	return &IngestionPipeline{
+		pipes: pipes,
+	}
+}
+
+// String returns string representation for ip.
+func (ip *IngestionPipeline) String() string {
+	a := make([]string, len(ip.pipes))
+	for i, p := range ip.pipes {
+		a[i] = p.String()
+	}
+	return strings.Join(a, " | ")
+}
+
+// NewProcessor returns new processor for ip, which calls writeRow for every log entry generated by ip.
+//
+// writeRow mustn't hold references to fields after returning, since they may be reused.
+//
+// Close must be called on the returned processor when it is no longer needed.
+// The returned processor cannot be used from concurrently running goroutines.
+func (ip *IngestionPipeline) NewProcessor(writeRow func(timestamp int64, fields []Field)) *IngestionPipelineProcessor {
+	ipp := &IngestionPipelineProcessor{
+		writeRow: writeRow,
+	}
+
+	pp := newNoopPipeProcessor(ipp.writeBlock)
+	ctx := context.Background()
+	stopCh := ctx.Done()
+	for i := len(ip.pipes) - 1; i >= 0; i-- {
+		p := ip.pipes[i]
+		ctxChild, cancel := context.WithCancel(ctx)
+		pp = p.newPipeProcessor(1, stopCh, cancel, pp)
+
+		ipp.cancels = append(ipp.cancels, cancel)
+		ipp.pps = append(ipp.pps, pp)
+
+		stopCh = ctxChild.Done()
+		ctx = ctxChild
+	}
+	ipp.pp = pp
+
+	return ipp
+}
+
+// IngestionPipelineProcessor applies IngestionPipeline to log entries.
+//
+// It is created via IngestionPipeline.NewProcessor.
+type IngestionPipelineProcessor struct {
+	writeRow func(timestamp int64, fields []Field)
+
+	pp      pipeProcessor
+	pps     []pipeProcessor
+	cancels []func()
+
+	br blockResult
+
+	timestamp int64
+	fieldsBuf []Field
+	seen      map[string]struct{}
+}
+
+// AddRow applies the ingestion pipeline to the log entry with the given timestamp and fields.
+//
+// ipp doesn't hold references to fields after returning.
+func (ipp *IngestionPipelineProcessor) AddRow(timestamp int64, fields []Field) {
+	br := &ipp.br
+	br.reset()
+	br.rowsLen = 1
+	br.timestampsBuf = append(br.timestampsBuf[:0], timestamp)
+	br.addTimeColumn()
+
+	if ipp.seen == nil {
+		ipp.seen = make(map[string]struct{})
+	}
+	clear(ipp.seen)
+	for _, f := range fields {
+		name := getCanonicalColumnName(f.Name)
+		if name == "_time" {
+			continue
+		}
+		if _, ok := ipp.seen[name]; ok {
+			continue
+		}
+		ipp.seen[name] = struct{}{}
+		br.addResultColumn(resultColumn{
+			name:   name,
+			values: []string{f.Value},
+		})
+	}
+
+	ipp.timestamp = timestamp
+	ipp.pp.writeBlock(0, br)
+}
+
+// writeBlock is called for log entries generated by the ingestion pipeline.
+func (ipp *IngestionPipelineProcessor) writeBlock(_ uint, br *blockResult) {
+	cs := br.getColumns()
+	var timestamps []int64
+	for i := 0; i < br.rowsLen; i++ {
+		timestamp := ipp.timestamp
+		fields := ipp.fieldsBuf[:0]
+		for _, c := range cs {
+			if c.isTime && c.name == "_time" {
+				if timestamps == nil {
+					timestamps = br.getTimestamps()
+				}
+				timestamp = timestamps[i]
+				continue
+			}
+			v := c.getValueAtRow(br, i)
+			if c.name == "_time" {
+				// The _time field has been modified by the pipeline.
+				if ts, ok := TryParseTimestampRFC3339Nano(v); ok {
+					timestamp = ts
+				}
+				continue
+			}
+			fields = append(fields, Field{
+				Name:  c.name,
+				Value: v,
+			})
+		}
+		ipp.fieldsBuf = fields
+		ipp.writeRow(timestamp, fields)
+	}
+}
+
+// Close flushes the ingestion pipeline and frees up resources occupied by ipp.
+//
+// It returns the first error occurred in the pipeline pipes.
+func (ipp *IngestionPipelineProcessor) Close() error {
+	var errFlush error
+	for i := len(ipp.pps) - 1; i >= 0; i-- {
+		if err := ipp.pps[i].flush(); err != nil && errFlush == nil {
+			errFlush = err
+		}
+		ipp.cancels[i]()
+	}
+	ipp.br.reset()
+	return errFlush
+}
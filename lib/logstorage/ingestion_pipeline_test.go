@@ -0,0 +1,224 @@
+package logstorage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseIngestionPipelineSuccess(t *testing.T) {
+	f := func(s, resultExpected string) {
+		t.Helper()
+
+		ip, err := ParseIngestionPipeline(s)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		result := ip.String()
+		if result != resultExpected {
+			t.Fatalf("unexpected result;\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	f(`unpack_json`, `unpack_json`)
+	f(`| delete foo, bar`, `delete foo, bar`)
+	f(`unpack_json from _msg | filter level:error | replace_regexp ("token=[^ ]+", "***")`, `unpack_json | filter level:error | replace_regexp ("token=[^ ]+", "***")`)
+	f(`extract "ip=<ip> " | copy ip as client_ip | drop_empty_fields`, `extract "ip=<ip> " | copy ip as client_ip | drop_empty_fields`)
+}
+
+func TestParseIngestionPipelineFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+
+		ip, err := ParseIngestionPipeline(s)
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		if ip != nil {
+			t.Fatalf("expecting nil result")
+		}
+	}
+
+	// empty pipeline
+	f(``)
+
+	// invalid pipe
+	f(`unpack_json from`)
+
+	// unparsed tail
+	f(`delete foo )`)
+
+	// pipes, which cannot process every log entry independently
+	f(`stats count()`)
+	f(`sort by (_time)`)
+	f(`limit 10`)
+	f(`uniq by (host)`)
+
+	// pipes with subqueries
+	f(`filter foo:in(* | keep foo)`)
+	f(`join by (user) (* | keep user, name)`)
+}
+
+func TestIngestionPipelineConcat(t *testing.T) {
+	f := func(s, sNext, resultExpected string) {
+		t.Helper()
+
+		var ip, ipNext *IngestionPipeline
+		var err error
+		if s != "" {
+			ip, err = ParseIngestionPipeline(s)
+			if err != nil {
+				t.Fatalf("cannot parse pipeline: %s", err)
+			}
+		}
+		if sNext != "" {
+			ipNext, err = ParseIngestionPipeline(sNext)
+			if err != nil {
+				t.Fatalf("cannot parse next pipeline: %s", err)
+			}
+		}
+		result := ip.Concat(ipNext).String()
+		if result != resultExpected {
+			t.Fatalf("unexpected result;\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	f(`delete password`, ``, `delete password`)
+	f(``, `unpack_json`, `unpack_json`)
+	f(`delete password`, `unpack_json | filter level:error`, `delete password | unpack_json | filter level:error`)
+}
+
+func TestIngestionPipelineProcessor(t *testing.T) {
+	f := func(s string, rows [][]Field, rowsExpected [][]Field) {
+		t.Helper()
+
+		ip, err := ParseIngestionPipeline(s)
+		if err != nil {
+			t.Fatalf("cannot parse pipeline: %s", err)
+		}
+
+		var resultRows [][]Field
+		ipp := ip.NewProcessor(func(timestamp int64, fields []Field) {
+			row := []Field{
+				{
+					Name:  "_time",
+					Value: string(marshalTimestampRFC3339NanoString(nil, timestamp)),
+				},
+			}
+			for _, f := range fields {
+				row = append(row, Field{
+					Name:  strings.Clone(f.Name),
+					Value: strings.Clone(f.Value),
+				})
+			}
+			resultRows = append(resultRows, row)
+		})
+		for _, row := range rows {
+			timestamp := int64(0)
+			var fields []Field
+			for _, f := range row {
+				if f.Name == "_time" {
+					ts, ok := TryParseTimestampRFC3339Nano(f.Value)
+					if !ok {
+						t.Fatalf("cannot parse _time=%q", f.Value)
+					}
+					timestamp = ts
+					continue
+				}
+				fields = append(fields, f)
+			}
+			ipp.AddRow(timestamp, fields)
+		}
+		if err := ipp.Close(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		assertRowsEqual(t, resultRows, rowsExpected)
+	}
+
+	// unpack_json and delete
+	f(`unpack_json | delete _msg`, [][]Field{
+		{
+			{"_time", "2025-01-02T10:20:30Z"},
+			{"_msg", `{"level":"error","user":"foo"}`},
+		},
+		{
+			{"_time", "2025-01-02T10:20:31Z"},
+			{"_msg", `{"level":"info"}`},
+			{"host", "bar"},
+		},
+	}, [][]Field{
+		{
+			{"_time", "2025-01-02T10:20:30Z"},
+			{"level", "error"},
+			{"user", "foo"},
+		},
+		{
+			{"_time", "2025-01-02T10:20:31Z"},
+			{"host", "bar"},
+			{"level", "info"},
+		},
+	})
+
+	// filter drops log entries
+	f(`filter -level:debug`, [][]Field{
+		{
+			{"_time", "2025-01-02T10:20:30Z"},
+			{"_msg", "foo"},
+			{"level", "debug"},
+		},
+		{
+			{"_time", "2025-01-02T10:20:31Z"},
+			{"_msg", "bar"},
+			{"level", "info"},
+		},
+	}, [][]Field{
+		{
+			{"_time", "2025-01-02T10:20:31Z"},
+			{"_msg", "bar"},
+			{"level", "info"},
+		},
+	})
+
+	// mask tokens
+	f(`replace_regexp ("token=[^ ]+", "token=***")`, [][]Field{
+		{
+			{"_time", "2025-01-02T10:20:30Z"},
+			{"_msg", "login token=abcd ok"},
+		},
+	}, [][]Field{
+		{
+			{"_time", "2025-01-02T10:20:30Z"},
+			{"_msg", "login token=*** ok"},
+		},
+	})
+
+	// modify _time
+	f(`time_add 1h`, [][]Field{
+		{
+			{"_time", "2025-01-02T10:20:30Z"},
+			{"_msg", "foo"},
+		},
+	}, [][]Field{
+		{
+			{"_time", "2025-01-02T11:20:30Z"},
+			{"_msg", "foo"},
+		},
+	})
+
+	// unroll generates multiple log entries
+	f(`unroll by (x)`, [][]Field{
+		{
+			{"_time", "2025-01-02T10:20:30Z"},
+			{"x", `["a","b"]`},
+		},
+	}, [][]Field{
+		{
+			{"_time", "2025-01-02T10:20:30Z"},
+			{"x", "a"},
+		},
+		{
+			{"_time", "2025-01-02T10:20:30Z"},
+			{"x", "b"},
+		},
+	})
+}
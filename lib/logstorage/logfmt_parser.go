@@ -73,6 +73,17 @@ func (p *logfmtParser) parse(s string) {
 	}
 }
 
+// AppendLogfmtFields appends fields parsed from logfmt-encoded s to dst and returns the result.
+//
+// The returned fields may refer to s, so s mustn't be modified while the returned fields are in use.
+func AppendLogfmtFields(dst []Field, s string) []Field {
+	p := getLogfmtParser()
+	p.parse(s)
+	dst = append(dst, p.fields...)
+	putLogfmtParser(p)
+	return dst
+}
+
 func getLogfmtParser() *logfmtParser {
 	v := logfmtParserPool.Get()
 	if v == nil {
@@ -508,6 +508,19 @@ func (q *Query) AddFacetsPipe(limit, maxValuesPerField, maxValueLen int, keepCon
 	q.mustAppendPipe(s)
 }
 
+// AddRowsAndStreamsCountPipe adds '| stats count() rows, count_uniq(_stream_id) streams' to the end of q.
+func (q *Query) AddRowsAndStreamsCountPipe() {
+	q.mustAppendPipe("stats count() rows, count_uniq(_stream_id) streams")
+}
+
+// AddTopStreamsPipe adds '| top <limit> by (_stream)' to the end of q.
+//
+// The pipe returns up to limit log streams with the biggest number of logs in the hits field.
+func (q *Query) AddTopStreamsPipe(limit int) {
+	s := fmt.Sprintf("top %d by (_stream)", limit)
+	q.mustAppendPipe(s)
+}
+
 // AddCountByTimePipe adds '| stats by (_time:step offset off, field1, ..., fieldN) count() hits' to the end of q.
 func (q *Query) AddCountByTimePipe(step, off int64, fields []string) {
 	// Drop pipes from q, which modify or delete _time field, since they make impossible to calculate stats grouped by _time.
@@ -1127,6 +1140,73 @@ func (q *Query) GetStatsByFieldsAddGroupingByTime(step int64) ([]string, error)
 	return byFields, nil
 }
 
+// CanCacheStatsByTimeBuckets returns true if the results of q prepared with GetStatsByFieldsAddGroupingByTime() can be cached per every `_time` bucket.
+//
+// This is possible only if the results for every `_time` bucket do not depend on the selected time range and on the query timestamp.
+func (q *Query) CanCacheStatsByTimeBuckets() bool {
+	idx := getLastPipeStatsIdx(q.pipes)
+	if idx < 0 {
+		return false
+	}
+	for _, p := range q.pipes[idx+1:] {
+		switch p.(type) {
+		case *pipeFilter, *pipeFirst, *pipeLast, *pipeSort, *pipeMath, *pipeFields, *pipeDelete, *pipeCopy, *pipeRename, *pipeFormat:
+			// These pipes are applied independently per every `_time` bucket.
+		default:
+			// For example, `running_stats` pipe depends on the results for the previous `_time` buckets.
+			return false
+		}
+	}
+
+	if q.opts.timeOffset != 0 {
+		// The time offset shifts `_time` buckets relative to the selected time range.
+		return false
+	}
+	if q.opts.ignoreGlobalTimeFilter != nil && *q.opts.ignoreGlobalTimeFilter {
+		// The results cannot be limited to the given time range.
+		return false
+	}
+
+	// Subqueries are executed over the whole selected time range, so their results may change together with the time range.
+	queriesCount := 0
+	q.visitSubqueries(func(_ *Query) {
+		queriesCount++
+	})
+	if queriesCount > 1 {
+		return false
+	}
+
+	// Relative time filters such as _time:1h depend on the query timestamp.
+	qOther := q.Clone(q.timestamp + nsecsPerDay)
+	return slices.Equal(q.getTimeFilterRanges(), qOther.getTimeFilterRanges())
+}
+
+// getTimeFilterRanges returns time ranges for all the `_time` filters at q.
+func (q *Query) getTimeFilterRanges() []int64 {
+	var a []int64
+	visitFunc := func(f filter) bool {
+		if ft, ok := f.(*filterTime); ok {
+			a = append(a, ft.minTimestamp, ft.maxTimestamp)
+		}
+		return false
+	}
+
+	visitFilterRecursive(q.f, visitFunc)
+	for _, p := range q.pipes {
+		switch t := p.(type) {
+		case *pipeFilter:
+			visitFilterRecursive(t.f, visitFunc)
+		case *pipeStats:
+			for _, f := range t.funcs {
+				if f.iff != nil {
+					visitFilterRecursive(f.iff.f, visitFunc)
+				}
+			}
+		}
+	}
+	return a
+}
+
 func hasNeededFieldsExceptTime(fields, neededFields []string) bool {
 	for _, f := range neededFields {
 		if f == "_time" {
@@ -3601,6 +3601,46 @@ func TestQueryGetStatsByFieldsAddGroupingByTime_Failure(t *testing.T) {
 	f("* | unroll by (x) | count()")
 }
 
+func TestQueryCanCacheStatsByTimeBuckets(t *testing.T) {
+	f := func(qStr string, resultExpected bool) {
+		t.Helper()
+
+		q, err := ParseQueryAtTimestamp(qStr, 1e18)
+		if err != nil {
+			t.Fatalf("cannot parse [%s]: %s", qStr, err)
+		}
+		q.AddTimeFilter(1e18-nsecsPerDay, 1e18)
+		if _, err := q.GetStatsByFieldsAddGroupingByTime(nsecsPerHour); err != nil {
+			t.Fatalf("unexpected error in GetStatsByFieldsAddGroupingByTime(): %s", err)
+		}
+		result := q.CanCacheStatsByTimeBuckets()
+		if result != resultExpected {
+			t.Fatalf("unexpected result for [%s]; got %v; want %v", qStr, result, resultExpected)
+		}
+	}
+
+	f(`* | count()`, true)
+	f(`error | by (host) count() hits | filter hits:>10 | sort by (hits desc) limit 3 | math hits*2 as x`, true)
+	f(`_time:>2024-01-01Z | count()`, true)
+	f(`error | count() if (_time:[2024-01-01Z, 2024-01-02Z)) | rename "count(*)" as hits`, true)
+
+	// pipes, which depend on the results for other buckets
+	f(`* | by (x) count() hits | running_stats by (x) sum(hits) total`, false)
+
+	// relative time filters
+	f(`_time:1h | count()`, false)
+	f(`error or _time:1h | count()`, false)
+	f(`* | count() if (_time:5m)`, false)
+	f(`* | count() hits | filter _time:1h`, false)
+
+	// subqueries
+	f(`x:in(* | fields x) | count()`, false)
+
+	// query options, which shift or ignore the time range
+	f(`options(time_offset=1h) * | count()`, false)
+	f(`options(ignore_global_time_filter=true) * | count()`, false)
+}
+
 func TestQueryGetStatsByFields_Success(t *testing.T) {
 	f := func(qStr string, fieldsExpected []string) {
 		t.Helper()
@@ -3876,6 +3916,46 @@ func TestToFieldsFilters(t *testing.T) {
 	f([]string{"a*"}, []string{"foo", "bar*", "abc", "aa*"}, ` | delete aa*, abc | fields a*`)
 }
 
+func TestQuery_AddRowsAndStreamsCountPipe(t *testing.T) {
+	f := func(qStr, resultExpected string) {
+		t.Helper()
+
+		q, err := ParseQuery(qStr)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing [%s]: %s", qStr, err)
+		}
+		q.AddRowsAndStreamsCountPipe()
+
+		result := q.String()
+		if result != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	f("*", "* | stats count(*) as rows, count_uniq(_stream_id) as streams")
+	f("foo bar:baz", "foo bar:baz | stats count(*) as rows, count_uniq(_stream_id) as streams")
+}
+
+func TestQuery_AddTopStreamsPipe(t *testing.T) {
+	f := func(qStr string, limit int, resultExpected string) {
+		t.Helper()
+
+		q, err := ParseQuery(qStr)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing [%s]: %s", qStr, err)
+		}
+		q.AddTopStreamsPipe(limit)
+
+		result := q.String()
+		if result != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	f("*", 5, "* | top 5 by (_stream)")
+	f("foo bar:baz", 3, "foo bar:baz | top 3 by (_stream)")
+}
+
 func TestQuery_AddCountByTimePipe(t *testing.T) {
 	f := func(qStr string, step, offset int64, fields []string, resultExpected string) {
 		t.Helper()
@@ -37,6 +37,29 @@ type partHeader struct {
 
 	// BloomValuesShardsCount is the number of (bloom, values) shards in the part.
 	BloomValuesShardsCount uint64
+
+	// TenantsStats contains per-tenant stats for the part sorted by tenant.
+	//
+	// It is empty for parts created by older VictoriaLogs versions.
+	TenantsStats []partTenantStats `json:",omitempty"`
+}
+
+// partTenantStats contains stats for a single tenant in the part.
+type partTenantStats struct {
+	// AccountID is the accountID for the tenant
+	AccountID uint32
+
+	// ProjectID is the projectID for the tenant
+	ProjectID uint32
+
+	// CompressedSizeBytes is the size of blocks for the tenant in the part
+	CompressedSizeBytes uint64
+
+	// UncompressedSizeBytes is the original size of log entries for the tenant in the part
+	UncompressedSizeBytes uint64
+
+	// RowsCount is the number of log entries for the tenant in the part
+	RowsCount uint64
 }
 
 // reset resets ph for subsequent reuse
@@ -49,6 +72,7 @@ func (ph *partHeader) reset() {
 	ph.MinTimestamp = 0
 	ph.MaxTimestamp = 0
 	ph.BloomValuesShardsCount = 0
+	ph.TenantsStats = nil
 }
 
 // String returns string representation for ph.
@@ -12,6 +12,12 @@ func TestPartHeaderReset(t *testing.T) {
 		RowsCount:             1234,
 		MinTimestamp:          3434,
 		MaxTimestamp:          32434,
+		TenantsStats: []partTenantStats{
+			{
+				AccountID:           12,
+				CompressedSizeBytes: 123,
+			},
+		},
 	}
 	ph.reset()
 	phZero := &partHeader{}
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
@@ -37,6 +38,20 @@ type partition struct {
 	// ddb is the datadb used for the given partition
 	ddb *datadb
 
+	// retentionDeleteMarkers contains the recently created delete markers for log entries outside the retention rules.
+	//
+	// Use getRetentionDeleteMarkers() for obtaining these markers.
+	retentionDeleteMarkers atomic.Pointer[retentionDeleteMarkers]
+
+	// tenantsStreams contains the number of streams per tenant at the partition.
+	//
+	// It is used for enforcing StorageConfig.MaxNewStreamsPerDayPerTenant. It is protected by tenantsStreamsLock.
+	tenantsStreams map[TenantID]uint64
+
+	// tenantsStreamsLock protects tenantsStreams. It also serializes registration of new streams
+	// when limits on new streams are enabled. See partition.mustRegisterNewStream.
+	tenantsStreamsLock sync.Mutex
+
 	// The snapshotLock prevents from concurrent creation of snapshots,
 	// since this may result in snapshots without recently added data,
 	// which may be in the process of flushing to disk by concurrently running
@@ -119,24 +134,37 @@ func mustOpenPartition(s *Storage, path string) *partition {
 //
 // The partition can be deleted if needed after it is closed via mustDeletePartition() call.
 func mustClosePartition(pt *partition) {
+	// Close datadb before indexdb, since the final merges at datadb
+	// may access indexdb when applying delete markers.
+	mustCloseDatadb(pt.ddb)
+	pt.ddb = nil
+
 	// Close indexdb
 	mustCloseIndexdb(pt.idb)
 	pt.idb = nil
 
-	// Close datadb
-	mustCloseDatadb(pt.ddb)
-	pt.ddb = nil
-
 	pt.name = ""
 	pt.path = ""
 	pt.s = nil
 }
 
 func (pt *partition) mustAddRows(lr *LogRows) {
+	// Drop rows for tenants exceeding the limit on the stored logs size.
+	//
+	// rejectReasons contains non-empty reasons for the rows, which must be dropped because of tenant limits.
+	rejectReasons := pt.s.getRowsOverStoredBytesLimit(lr)
+
+	// fallbackReasons contains non-empty reasons for the rows, which must be moved to the fallback stream
+	// because of the limits on new streams.
+	var fallbackReasons []string
+
 	// Register rows in indexdb
 	var pendingRows []int
 	streamIDs := lr.streamIDs
 	for i := range lr.timestamps {
+		if rejectReasons != nil && rejectReasons[i] != "" {
+			continue
+		}
 		streamID := &streamIDs[i]
 		if pt.hasStreamIDInCache(streamID) {
 			continue
@@ -151,6 +179,7 @@ func (pt *partition) mustAddRows(lr *LogRows) {
 		sort.Slice(pendingRows, func(i, j int) bool {
 			return streamIDs[pendingRows[i]].less(&streamIDs[pendingRows[j]])
 		})
+		rejectedStreamIDs := make(map[streamID]string)
 		for i, rowIdx := range pendingRows {
 			streamID := &streamIDs[rowIdx]
 			if i > 0 && streamIDs[pendingRows[i-1]].equal(streamID) {
@@ -161,17 +190,48 @@ func (pt *partition) mustAddRows(lr *LogRows) {
 			}
 			if !pt.idb.hasStreamID(streamID) {
 				streamTagsCanonical := streamTagsCanonicals[rowIdx]
-				pt.idb.mustRegisterStream(streamID, streamTagsCanonical)
-				if logNewStreams {
+				reason, isNew := pt.mustRegisterNewStream(streamID, streamTagsCanonical)
+				if reason != "" {
+					rejectedStreamIDs[*streamID] = reason
+					pt.s.registerStreamsLimitOffender(streamID.tenantID, streamTagsCanonical)
+					continue
+				}
+				if isNew && logNewStreams {
 					pt.logNewStream(streamTagsCanonical, lr.rows[rowIdx])
 				}
 			}
 			pt.putStreamIDToCache(streamID)
 		}
+		if len(rejectedStreamIDs) > 0 {
+			// Rows for the rejected streams are either dropped or moved to the fallback stream
+			// depending on StorageConfig.StreamsLimitFallback.
+			reasons := make([]string, len(lr.timestamps))
+			for i := range streamIDs {
+				if reason, ok := rejectedStreamIDs[streamIDs[i]]; ok {
+					reasons[i] = reason
+				}
+			}
+			if pt.s.streamsLimitFallback {
+				fallbackReasons = reasons
+			} else if rejectReasons == nil {
+				rejectReasons = reasons
+			} else {
+				for i, reason := range reasons {
+					if reason != "" {
+						rejectReasons[i] = reason
+					}
+				}
+			}
+		}
+	}
+	if rejectReasons != nil || fallbackReasons != nil {
+		lr = pt.filterRejectedRows(lr, rejectReasons, fallbackReasons)
+		defer PutLogRows(lr)
 	}
 
 	// Add rows to datadb
 	pt.ddb.mustAddRows(lr)
+	pt.s.updateTenantsIngestedStats(lr)
 	if pt.s.logIngestedRows {
 		pt.logIngestedRows(lr)
 	}
@@ -218,6 +278,15 @@ func (pt *partition) debugFlush() {
 	pt.idb.debugFlush()
 }
 
+// mustDeleteRows marks log entries matching q for the given tenantIDs as deleted.
+func (pt *partition) mustDeleteRows(tenantIDs []TenantID, q *Query) {
+	// Make sure the recently ingested log entries are visible to the delete marker.
+	pt.debugFlush()
+
+	dm := newDeleteMarker(pt.idb, tenantIDs, q)
+	pt.ddb.mustAddDeleteMarker(dm)
+}
+
 // mustCreateSnapshot creates snapshot for the the given pt and returns full path to the created snapshot.
 func (pt *partition) mustCreateSnapshot() string {
 	logger.Infof("creating a snapshot for partition %q", pt.name)
@@ -44,6 +44,9 @@ type QueryStats struct {
 
 	// BytesProcessedUncompressedValues is the total number of uncompressed values bytes processed during the search.
 	BytesProcessedUncompressedValues uint64
+
+	// MissingStorageNodes is the number of remote storage nodes, which failed to return results for the query executed with partial response allowed.
+	MissingStorageNodes uint64
 }
 
 // GetBytesReadTotal returns the total number of bytes read, which is tracked by qs.
@@ -67,6 +70,8 @@ func (qs *QueryStats) UpdateAtomic(src *QueryStats) {
 	atomic.AddUint64(&qs.ValuesRead, src.ValuesRead)
 	atomic.AddUint64(&qs.TimestampsRead, src.TimestampsRead)
 	atomic.AddUint64(&qs.BytesProcessedUncompressedValues, src.BytesProcessedUncompressedValues)
+
+	atomic.AddUint64(&qs.MissingStorageNodes, src.MissingStorageNodes)
 }
 
 // UpdateAtomicFromDataBlock adds query stats from db to qs.
@@ -104,6 +109,12 @@ func (qs *QueryStats) UpdateFromDataBlock(db *DataBlock) error {
 	qs.TimestampsRead += getUint64Entry("TimestampsRead")
 	qs.BytesProcessedUncompressedValues += getUint64Entry("BytesProcessedUncompressedValues")
 
+	// MissingStorageNodes may be missing in query stats received from older remote storage nodes.
+	if c := db.GetColumnByName("MissingStorageNodes"); c != nil {
+		n, _ := tryParseUint64(c.Values[0])
+		qs.MissingStorageNodes += n
+	}
+
 	return errGlobal
 }
 
@@ -165,5 +176,7 @@ func (qs *QueryStats) addEntries(addUint64Entry func(name string, value uint64),
 	addUint64Entry("TimestampsRead", qs.TimestampsRead)
 	addUint64Entry("BytesProcessedUncompressedValues", qs.BytesProcessedUncompressedValues)
 
+	addUint64Entry("MissingStorageNodes", qs.MissingStorageNodes)
+
 	addUint64Entry("QueryDurationNsecs", uint64(queryDurationNsecs))
 }
@@ -0,0 +1,297 @@
+package logstorage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// RetentionRule contains the retention for logs of the given tenant.
+//
+// The retention may be limited to logs for streams matching the given stream filter.
+//
+// See https://docs.victoriametrics.com/victorialogs/#retention-by-tenant
+type RetentionRule struct {
+	// TenantID is the tenant the rule applies to.
+	TenantID TenantID
+
+	// StreamFilter is an optional stream filter for logs the rule applies to.
+	//
+	// If StreamFilter is empty, then the rule applies to all the logs for TenantID,
+	// which do not match stream filters at other rules for the same TenantID.
+	StreamFilter string
+
+	// Retention is the retention for the logs matching the rule.
+	Retention time.Duration
+}
+
+// String returns string representation for rr.
+func (rr *RetentionRule) String() string {
+	return fmt.Sprintf("%d:%d%s:%s", rr.TenantID.AccountID, rr.TenantID.ProjectID, rr.StreamFilter, rr.Retention)
+}
+
+// ParseRetentionRule parses retention rule from s.
+//
+// s must have the form `accountID:projectID[{stream_filter}]:retention`. For example:
+//
+//   - `12:34:7d` - 7 days retention for all the logs at the tenant 12:34
+//   - `12:34{app="nginx"}:90d` - 90 days retention for the logs at {app="nginx"} streams at the tenant 12:34
+func ParseRetentionRule(s string) (*RetentionRule, error) {
+	n := strings.LastIndexByte(s, ':')
+	if n < 0 {
+		return nil, fmt.Errorf("missing ':' in front of retention at %q", s)
+	}
+	prefix, retentionStr := s[:n], s[n+1:]
+
+	nsecs, ok := tryParseDuration(retentionStr)
+	if !ok {
+		return nil, fmt.Errorf("cannot parse retention from %q", retentionStr)
+	}
+	if nsecs <= 0 {
+		return nil, fmt.Errorf("retention must be positive; got %q", retentionStr)
+	}
+
+	tenantStr := prefix
+	streamFilterStr := ""
+	if n := strings.IndexByte(prefix, '{'); n >= 0 {
+		tenantStr, streamFilterStr = prefix[:n], prefix[n:]
+	}
+	if !strings.Contains(tenantStr, ":") {
+		return nil, fmt.Errorf("missing tenant in the form accountID:projectID at %q", s)
+	}
+	tenantID, err := ParseTenantID(tenantStr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse tenant from %q: %w", tenantStr, err)
+	}
+
+	if streamFilterStr != "" {
+		f, err := ParseFilter(streamFilterStr)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse stream filter %q: %w", streamFilterStr, err)
+		}
+		if _, ok := f.f.(*filterStream); !ok {
+			return nil, fmt.Errorf("expecting stream filter in the form {...}; got %q", streamFilterStr)
+		}
+		streamFilterStr = f.String()
+	}
+
+	rr := &RetentionRule{
+		TenantID:     tenantID,
+		StreamFilter: streamFilterStr,
+		Retention:    time.Duration(nsecs),
+	}
+	return rr, nil
+}
+
+// getRetentionRulesQueries returns queries for log entries outside the retention configured by rrs.
+//
+// Stream rules take precedence over tenant-wide rules for the same tenant.
+// If log entries match multiple stream rules, then the smallest retention is applied.
+func getRetentionRulesQueries(rrs []*RetentionRule) ([]TenantID, []string) {
+	var tenantIDs []TenantID
+	var qStrs []string
+	for _, rr := range rrs {
+		d := fmt.Sprintf("%dns", rr.Retention.Nanoseconds())
+		if rr.StreamFilter != "" {
+			tenantIDs = append(tenantIDs, rr.TenantID)
+			qStrs = append(qStrs, fmt.Sprintf("%s _time:>%s", rr.StreamFilter, d))
+			continue
+		}
+
+		// Exclude streams with their own rules for the given tenant.
+		var b strings.Builder
+		fmt.Fprintf(&b, "_time:>%s", d)
+		for _, rrStream := range rrs {
+			if rrStream.StreamFilter != "" && rrStream.TenantID.equal(&rr.TenantID) {
+				fmt.Fprintf(&b, " !%s", rrStream.StreamFilter)
+			}
+		}
+		tenantIDs = append(tenantIDs, rr.TenantID)
+		qStrs = append(qStrs, b.String())
+	}
+	return tenantIDs, qStrs
+}
+
+// retentionDeleteMarkersUpdateInterval is the interval for updating the delete markers for the configured retention rules.
+const retentionDeleteMarkersUpdateInterval = time.Minute
+
+// retentionDeleteMarkers contains delete markers for log entries outside the configured retention rules.
+type retentionDeleteMarkers struct {
+	// timestamp is the timestamp in nanoseconds when dms were created
+	timestamp int64
+
+	// dms are delete markers for log entries outside the retention rules at the given timestamp
+	dms []*deleteMarker
+}
+
+// getRetentionDeleteMarkers returns delete markers for log entries at pt, which are outside the configured retention rules.
+func (pt *partition) getRetentionDeleteMarkers() []*deleteMarker {
+	rdms := pt.getRetentionDeleteMarkersWithTimestamp()
+	if rdms == nil {
+		return nil
+	}
+	return rdms.dms
+}
+
+// getRetentionDeleteMarkersWithTimestamp returns delete markers for log entries at pt, which are outside the configured retention rules,
+// together with the timestamp the markers were created at.
+//
+// nil is returned if there are no retention rules.
+func (pt *partition) getRetentionDeleteMarkersWithTimestamp() *retentionDeleteMarkers {
+	rrs := pt.s.retentionRules
+	if len(rrs) == 0 {
+		return nil
+	}
+
+	currentTimestamp := time.Now().UnixNano()
+	rdms := pt.retentionDeleteMarkers.Load()
+	if rdms != nil && currentTimestamp-rdms.timestamp < retentionDeleteMarkersUpdateInterval.Nanoseconds() {
+		return rdms
+	}
+
+	tenantIDs, qStrs := getRetentionRulesQueries(rrs)
+	dms := make([]*deleteMarker, len(qStrs))
+	for i, qStr := range qStrs {
+		q, err := ParseQueryAtTimestamp(qStr, currentTimestamp)
+		if err != nil {
+			logger.Panicf("BUG: cannot parse query [%s] for retention rules: %s", qStr, err)
+		}
+		dms[i] = newDeleteMarker(pt.idb, []TenantID{tenantIDs[i]}, q)
+	}
+	rdms = &retentionDeleteMarkers{
+		timestamp: currentTimestamp,
+		dms:       dms,
+	}
+	pt.retentionDeleteMarkers.Store(rdms)
+	return rdms
+}
+
+// needRetentionRulesCheck returns true if pw may contain log entries outside rrs at currentTimestamp,
+// which weren't detected during the previous check at pw.
+//
+// The log entries outside rrs at pw may appear only when the retention boundary for some rule crosses the time range of pw since the previous check.
+func (pw *partWrapper) needRetentionRulesCheck(rrs []*RetentionRule, currentTimestamp int64) bool {
+	checkedAt := pw.retentionRulesCheckedAt.Load()
+	if checkedAt == 0 {
+		return true
+	}
+	ph := &pw.p.ph
+	for _, rr := range rrs {
+		d := rr.Retention.Nanoseconds()
+		if currentTimestamp-d > ph.MinTimestamp && checkedAt-d <= ph.MaxTimestamp {
+			return true
+		}
+	}
+	return false
+}
+
+// hasRowsMatchingDeleteMarkers returns true if p contains log entries marked as deleted by dms.
+func (p *part) hasRowsMatchingDeleteMarkers(dms []*deleteMarker) bool {
+	var qs QueryStats
+	var bsw blockSearchWork
+	bhss := getBlockHeaders()
+	bs := getBlockSearch()
+	bm := getBitmap(0)
+	defer func() {
+		putBitmap(bm)
+		putBlockSearch(bs)
+		putBlockHeaders(bhss)
+		bsw.reset()
+	}()
+
+	for i := range p.indexBlockHeaders {
+		ibh := &p.indexBlockHeaders[i]
+		if !hasDeleteMarkersForTimeRange(dms, ibh.minTimestamp, ibh.maxTimestamp) {
+			continue
+		}
+		bhss.bhs = ibh.mustReadBlockHeaders(bhss.bhs[:0], p, &qs)
+		for j := range bhss.bhs {
+			bh := &bhss.bhs[j]
+			if !hasDeleteMarkersForBlock(dms, bh) {
+				continue
+			}
+
+			bsw.p = p
+			bsw.bh.copyFrom(bh)
+			bs.reset()
+			bs.qs = &qs
+			bs.bsw = &bsw
+			bm.init(int(bh.rowsCount))
+			bm.setBits()
+			applyDeleteMarkersToBlockSearch(bs, bm, dms)
+			if !bm.areAllBitsSet() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasDeleteMarkersForTimeRange(dms []*deleteMarker, minTimestamp, maxTimestamp int64) bool {
+	for _, dm := range dms {
+		if dm.intersectsTimeRange(minTimestamp, maxTimestamp) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasDeleteMarkersForBlock(dms []*deleteMarker, bh *blockHeader) bool {
+	th := &bh.timestampsHeader
+	for _, dm := range dms {
+		if dm.matchesBlock(&bh.streamID, th.minTimestamp, th.maxTimestamp) {
+			return true
+		}
+	}
+	return false
+}
+
+// mustDropRowsOutsideRetentionRules drops log entries outside the configured retention rules from file parts at ddb.
+//
+// Parts with such log entries are re-written without these entries one-by-one.
+// Parts, which have been already checked, are skipped until the retention boundary for some rule crosses their time range.
+// The function returns early when stopCh is closed.
+func (ddb *datadb) mustDropRowsOutsideRetentionRules(stopCh <-chan struct{}) {
+	rdms := ddb.pt.getRetentionDeleteMarkersWithTimestamp()
+	if rdms == nil || len(rdms.dms) == 0 {
+		return
+	}
+	dms := rdms.dms
+	rrs := ddb.pt.s.retentionRules
+
+	ddb.partsLock.Lock()
+	pws := appendPartsForRetentionRulesCheckLocked(nil, ddb.smallParts, rrs, rdms.timestamp)
+	pws = appendPartsForRetentionRulesCheckLocked(pws, ddb.bigParts, rrs, rdms.timestamp)
+	ddb.partsLock.Unlock()
+
+	var pwsToRelease []*partWrapper
+	for i, pw := range pws {
+		if needStop(stopCh) {
+			pwsToRelease = append(pwsToRelease, pws[i:]...)
+			break
+		}
+		if !pw.p.hasRowsMatchingDeleteMarkers(dms) {
+			pw.retentionRulesCheckedAt.Store(rdms.timestamp)
+			pwsToRelease = append(pwsToRelease, pw)
+			continue
+		}
+
+		// The merge of a single part drops log entries outside the retention rules.
+		bigPartsConcurrencyCh <- struct{}{}
+		ddb.mustMergeParts([]*partWrapper{pw}, false)
+		<-bigPartsConcurrencyCh
+	}
+	ddb.releasePartsToMerge(pwsToRelease)
+}
+
+func appendPartsForRetentionRulesCheckLocked(dst, src []*partWrapper, rrs []*RetentionRule, currentTimestamp int64) []*partWrapper {
+	for _, pw := range src {
+		if !pw.isInMerge && pw.needRetentionRulesCheck(rrs, currentTimestamp) {
+			pw.isInMerge = true
+			dst = append(dst, pw)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,237 @@
+package logstorage
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+func TestParseRetentionRuleSuccess(t *testing.T) {
+	f := func(s, resultExpected string) {
+		t.Helper()
+
+		rr, err := ParseRetentionRule(s)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		result := rr.String()
+		if result != resultExpected {
+			t.Fatalf("unexpected result; got %q; want %q", result, resultExpected)
+		}
+	}
+
+	f("0:0:1d", "0:0:24h0m0s")
+	f("12:34:7d", "12:34:168h0m0s")
+	f("12:34:1h30m", "12:34:1h30m0s")
+	f(`12:34{app="nginx"}:90d`, `12:34{app="nginx"}:2160h0m0s`)
+	f(`12:34{app="nginx",host=~"foo:.+"}:2w`, `12:34{app="nginx",host=~"foo:.+"}:336h0m0s`)
+}
+
+func TestParseRetentionRuleFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+
+		rr, err := ParseRetentionRule(s)
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		if rr != nil {
+			t.Fatalf("expecting nil rule; got %s", rr)
+		}
+	}
+
+	f("")
+	f("7d")
+
+	// missing tenant
+	f("12:7d")
+	f(`{app="nginx"}:7d`)
+
+	// invalid tenant
+	f("foo:bar:7d")
+	f("12:-1:7d")
+
+	// invalid retention
+	f("12:34:")
+	f("12:34:foo")
+	f("12:34:-1d")
+	f("12:34:0s")
+
+	// invalid stream filter
+	f(`12:34{app=}:7d`)
+	f(`12:34{app="nginx"} foo:7d`)
+}
+
+func TestStorageRetentionRules(t *testing.T) {
+	t.Parallel()
+
+	path := t.Name()
+
+	const streamsCount = 5
+	const rowsPerStream = 100
+
+	tenantIDs := []TenantID{
+		{AccountID: 1, ProjectID: 2},
+		{AccountID: 3, ProjectID: 4},
+	}
+	mustParseRetentionRule := func(s string) *RetentionRule {
+		t.Helper()
+
+		rr, err := ParseRetentionRule(s)
+		if err != nil {
+			t.Fatalf("cannot parse retention rule %q: %s", s, err)
+		}
+		return rr
+	}
+	sc := &StorageConfig{
+		Retention: 30 * 24 * time.Hour,
+		RetentionRules: []*RetentionRule{
+			mustParseRetentionRule("1:2:7d"),
+			mustParseRetentionRule(`1:2{app="app-0"}:30d`),
+		},
+	}
+	s := MustOpenStorage(path, sc)
+
+	// Add recent rows and rows outside the 7d retention for every tenant.
+	recentTimestamp := time.Now().UnixNano() - 3600*1e9
+	oldTimestamp := time.Now().UnixNano() - 10*24*3600*1e9
+	var fields []Field
+	for _, tenantID := range tenantIDs {
+		lr := GetLogRows([]string{"app"}, nil, nil, nil, "")
+		for i := 0; i < streamsCount; i++ {
+			for j := 0; j < rowsPerStream; j++ {
+				fields = append(fields[:0], Field{
+					Name:  "app",
+					Value: fmt.Sprintf("app-%d", i),
+				}, Field{
+					Name:  "_msg",
+					Value: fmt.Sprintf("message %d", j),
+				})
+				timestamp := recentTimestamp
+				if j%2 == 1 {
+					timestamp = oldTimestamp
+				}
+				lr.MustAdd(tenantID, timestamp+int64(j)*1e6, fields, nil)
+			}
+		}
+		s.MustAddRows(lr)
+		PutLogRows(lr)
+	}
+	s.DebugFlush()
+
+	getRowsCount := func(tenantID TenantID, query string) uint64 {
+		t.Helper()
+
+		q := mustParseQuery(query)
+		var rowsCount atomic.Uint64
+		writeBlock := func(_ uint, db *DataBlock) {
+			rowsCount.Add(uint64(db.RowsCount()))
+		}
+		qctx := newTestQueryContext([]TenantID{tenantID}, q)
+		if err := s.RunQuery(qctx, writeBlock); err != nil {
+			t.Fatalf("unexpected error in query [%s]: %s", q, err)
+		}
+		return rowsCount.Load()
+	}
+	checkRowsCount := func(tenantID TenantID, query string, rowsCountExpected uint64) {
+		t.Helper()
+
+		if n := getRowsCount(tenantID, query); n != rowsCountExpected {
+			t.Fatalf("unexpected number of rows for tenant %s and query [%s]; got %d; want %d", &tenantID, query, n, rowsCountExpected)
+		}
+	}
+	checkStorage := func() {
+		t.Helper()
+
+		// Old rows must be dropped at the first tenant except of app-0 stream with bigger retention.
+		checkRowsCount(tenantIDs[0], `*`, streamsCount*rowsPerStream/2+rowsPerStream/2)
+		checkRowsCount(tenantIDs[0], `{app="app-0"}`, rowsPerStream)
+		checkRowsCount(tenantIDs[0], `{app="app-1"}`, rowsPerStream/2)
+
+		// The second tenant must remain untouched.
+		checkRowsCount(tenantIDs[1], `*`, streamsCount*rowsPerStream)
+	}
+	checkStoredRowsCount := func(rowsCountExpected uint64) {
+		t.Helper()
+
+		var ss StorageStats
+		s.UpdateStats(&ss)
+		if n := ss.RowsCount(); n != rowsCountExpected {
+			t.Fatalf("unexpected number of rows in the storage; got %d; want %d", n, rowsCountExpected)
+		}
+	}
+
+	// Rows outside the retention rules must be invisible for search before they are physically deleted.
+	checkStorage()
+	checkStoredRowsCount(2 * streamsCount * rowsPerStream)
+
+	// Rows outside the retention rules must be physically deleted by the retention watcher from file parts.
+	for _, ptw := range s.partitions {
+		ptw.pt.ddb.mustFlushInmemoryPartsToFiles(true)
+	}
+	checkStoredRowsCount(2 * streamsCount * rowsPerStream)
+	s.dropRowsOutsideRetentionRules()
+	checkStorage()
+	rowsCountExpected := uint64(2*streamsCount*rowsPerStream - (streamsCount-1)*rowsPerStream/2)
+	checkStoredRowsCount(rowsCountExpected)
+
+	// The remaining rows must be preserved after the force merge.
+	s.MustForceMerge("")
+	checkStorage()
+	checkStoredRowsCount(rowsCountExpected)
+
+	s.MustClose()
+	fs.MustRemoveDir(path)
+}
+
+func TestPartWrapperNeedRetentionRulesCheck(t *testing.T) {
+	const day = 24 * int64(time.Hour)
+
+	rrs := []*RetentionRule{
+		{
+			TenantID:  TenantID{AccountID: 1},
+			Retention: 7 * time.Duration(day),
+		},
+		{
+			TenantID:  TenantID{AccountID: 2},
+			Retention: 30 * time.Duration(day),
+		},
+	}
+
+	f := func(minTimestamp, maxTimestamp, checkedAt, currentTimestamp int64, resultExpected bool) {
+		t.Helper()
+
+		pw := &partWrapper{
+			p: &part{},
+		}
+		pw.p.ph.MinTimestamp = minTimestamp
+		pw.p.ph.MaxTimestamp = maxTimestamp
+		pw.retentionRulesCheckedAt.Store(checkedAt)
+
+		result := pw.needRetentionRulesCheck(rrs, currentTimestamp)
+		if result != resultExpected {
+			t.Fatalf("unexpected result; got %v; want %v", result, resultExpected)
+		}
+	}
+
+	// The part wasn't checked yet
+	f(0, day, 0, 100*day, true)
+
+	// The retention boundaries didn't reach the part yet
+	f(90*day, 91*day, 95*day, 96*day, false)
+
+	// The retention boundary for 7d rule crosses the part
+	f(90*day, 91*day, 97*day, 97*day+day/2, true)
+
+	// The retention boundary for 7d rule passed the part before the previous check, while 30d boundary didn't reach it yet
+	f(90*day, 91*day, 100*day, 101*day, false)
+
+	// The retention boundary for 30d rule crosses the part
+	f(90*day, 91*day, 120*day, 121*day, true)
+
+	// All the retention boundaries passed the part before the previous check
+	f(90*day, 91*day, 125*day, 126*day, false)
+}
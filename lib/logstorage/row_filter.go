@@ -0,0 +1,105 @@
+package logstorage
+
+import (
+	"fmt"
+	"sync"
+)
+
+// RowFilter matches individual log entries against LogsQL filter.
+//
+// It is safe calling RowFilter methods from concurrently running goroutines.
+type RowFilter struct {
+	f filter
+}
+
+// ParseRowFilter parses LogsQL filter for matching individual log entries.
+//
+// Filters with subqueries aren't supported, since they cannot be evaluated for every log entry independently.
+//
+// See https://docs.victoriametrics.com/victorialogs/logsql/#filters
+func ParseRowFilter(s string) (*RowFilter, error) {
+	f, err := ParseFilter(s)
+	if err != nil {
+		return nil, err
+	}
+	hasSubqueries := false
+	visitSubqueriesInFilter(f.f, func(_ *Query) {
+		hasSubqueries = true
+	})
+	if hasSubqueries {
+		return nil, fmt.Errorf("filter [%s] cannot contain subqueries", f)
+	}
+	rf := &RowFilter{
+		f: f.f,
+	}
+	return rf, nil
+}
+
+// String returns string representation for rf.
+func (rf *RowFilter) String() string {
+	return rf.f.String()
+}
+
+// MatchInsertRow returns true if r matches rf.
+//
+// The `_stream` field is obtained from r.StreamTagsCanonical, while the `_time` field is obtained from r.Timestamp.
+func (rf *RowFilter) MatchInsertRow(r *InsertRow) bool {
+	rfs := getRowFilterState()
+	defer putRowFilterState(rfs)
+
+	br := &rfs.br
+	br.reset()
+	br.rowsLen = 1
+	br.timestampsBuf = append(br.timestampsBuf[:0], r.Timestamp)
+	br.addTimeColumn()
+	br.addResultColumn(resultColumn{
+		name:   "_stream",
+		values: []string{getStreamTagsString(r.StreamTagsCanonical)},
+	})
+
+	seen := rfs.seen
+	clear(seen)
+	for _, f := range r.Fields {
+		name := getCanonicalColumnName(f.Name)
+		if name == "_time" || name == "_stream" {
+			continue
+		}
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		br.addResultColumn(resultColumn{
+			name:   name,
+			values: []string{f.Value},
+		})
+	}
+
+	bm := &rfs.bm
+	bm.init(1)
+	bm.setBits()
+	rf.f.applyToBlockResult(br, bm)
+	return !bm.isZero()
+}
+
+type rowFilterState struct {
+	br   blockResult
+	bm   bitmap
+	seen map[string]struct{}
+}
+
+func getRowFilterState() *rowFilterState {
+	v := rowFilterStatePool.Get()
+	if v == nil {
+		return &rowFilterState{
+			seen: make(map[string]struct{}),
+		}
+	}
+	return v.(*rowFilterState)
+}
+
+func putRowFilterState(rfs *rowFilterState) {
+	rfs.br.reset()
+	rowFilterStatePool.Put(rfs)
+}
+
+var rowFilterStatePool sync.Pool
@@ -0,0 +1,99 @@
+package logstorage
+
+import (
+	"testing"
+)
+
+func TestParseRowFilterFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+
+		rf, err := ParseRowFilter(s)
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		if rf != nil {
+			t.Fatalf("expecting nil result")
+		}
+	}
+
+	// invalid filter
+	f(`foo:(`)
+
+	// pipes
+	f(`level:error | keep _msg`)
+
+	// subqueries
+	f(`user:in(* | keep user)`)
+}
+
+func TestRowFilterMatchInsertRow(t *testing.T) {
+	f := func(s string, fields []Field, resultExpected bool) {
+		t.Helper()
+
+		rf, err := ParseRowFilter(s)
+		if err != nil {
+			t.Fatalf("cannot parse filter [%s]: %s", s, err)
+		}
+
+		st := GetStreamTags()
+		st.Add("app", "nginx")
+		st.Add("host", "h1")
+		r := &InsertRow{
+			StreamTagsCanonical: string(st.MarshalCanonical(nil)),
+			Timestamp:           1735787045000000000,
+			Fields:              fields,
+		}
+		PutStreamTags(st)
+
+		result := rf.MatchInsertRow(r)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for filter [%s]; got %v; want %v", s, result, resultExpected)
+		}
+	}
+
+	fields := []Field{
+		{
+			Name:  "_msg",
+			Value: "cannot open file",
+		},
+		{
+			Name:  "level",
+			Value: "error",
+		},
+		{
+			Name:  "duration",
+			Value: "123",
+		},
+	}
+
+	// match all
+	f(`*`, fields, true)
+
+	// word filter
+	f(`open`, fields, true)
+	f(`close`, fields, false)
+
+	// field filters
+	f(`level:error`, fields, true)
+	f(`level:warn`, fields, false)
+	f(`level:error duration:>100`, fields, true)
+	f(`level:error duration:>200`, fields, false)
+	f(`level:warn or duration:>100`, fields, true)
+	f(`-level:error`, fields, false)
+	f(`missing_field:""`, fields, true)
+
+	// stream filters
+	f(`{app="nginx"}`, fields, true)
+	f(`{app="nginx",host=~"h.+"} level:error`, fields, true)
+	f(`{app="apache"}`, fields, false)
+	f(`_stream:{host="h1"}`, fields, true)
+
+	// time filters
+	f(`_time:2025-01-02`, fields, true)
+	f(`_time:2025-01-03`, fields, false)
+
+	// empty fields
+	f(`level:error`, nil, false)
+	f(`{app="nginx"}`, nil, true)
+}
@@ -29,6 +29,12 @@ type StorageStats struct {
 	// PartitionsCount is the number of partitions in the storage.
 	PartitionsCount uint64
 
+	// ColdPartitionsCount is the number of partitions located at the cold path. See StorageConfig.ColdPath.
+	ColdPartitionsCount uint64
+
+	// PartitionsMovedToColdTotal is the number of partitions moved to the cold path since the storage start.
+	PartitionsMovedToColdTotal uint64
+
 	// MaxDiskSpaceUsageBytes is the maximum disk space logs can use.
 	MaxDiskSpaceUsageBytes int64
 
@@ -82,6 +88,39 @@ type StorageConfig struct {
 	//
 	// This can be useful for debugging of data ingestion.
 	LogIngestedRows bool
+
+	// RetentionRules is an optional list of retention rules for particular tenants and streams.
+	//
+	// Log entries outside these rules are automatically deleted once per hour.
+	// Every rule may set a retention longer than Retention, but log entries older than Retention are always deleted.
+	RetentionRules []*RetentionRule
+
+	// ColdPath is an optional path for storing per-day partitions older than ColdAfter.
+	//
+	// Such partitions are moved from the storage path to ColdPath in background. They remain searchable after the move.
+	ColdPath string
+
+	// ColdAfter is the age of per-day partitions after which they are moved to ColdPath.
+	ColdAfter time.Duration
+
+	// MaxNewStreamsPerDayPerTenant is an optional limit on the number of new log streams per day per tenant.
+	//
+	// Log entries for new streams exceeding the limit are dropped unless StreamsLimitFallback is set.
+	MaxNewStreamsPerDayPerTenant *TenantLimits
+
+	// MaxNewStreamsPerHourPerTenant is an optional limit on the number of new log streams per hour per tenant.
+	//
+	// Log entries for new streams exceeding the limit are dropped unless StreamsLimitFallback is set.
+	MaxNewStreamsPerHourPerTenant *TenantLimits
+
+	// StreamsLimitFallback instructs storing log entries for new streams exceeding MaxNewStreamsPerDayPerTenant
+	// or MaxNewStreamsPerHourPerTenant into a fallback stream per tenant instead of dropping them.
+	StreamsLimitFallback bool
+
+	// MaxStoredBytesPerTenant is an optional limit on the size of the stored logs per tenant.
+	//
+	// Log entries for tenants exceeding the limit are dropped.
+	MaxStoredBytesPerTenant *TenantLimits
 }
 
 // Storage is the storage for log entries.
@@ -97,6 +136,11 @@ type Storage struct {
 	// older data is automatically deleted
 	retention time.Duration
 
+	// retentionRules contains retention rules for particular tenants and streams.
+	//
+	// Log entries outside these rules are automatically deleted during background merges.
+	retentionRules []*RetentionRule
+
 	// maxDiskSpaceUsageBytes is an optional maximum disk space logs can use.
 	//
 	// The oldest per-day partitions are automatically dropped if the total disk space usage exceeds this limit.
@@ -123,6 +167,62 @@ type Storage struct {
 	// flockF is a file, which makes sure that the Storage is opened by a single process
 	flockF *os.File
 
+	// coldPath is an optional path for storing partitions older than coldAfter.
+	coldPath string
+
+	// coldAfter is the age of partitions after which they are moved from path to coldPath.
+	coldAfter time.Duration
+
+	// coldFlockF is a file, which makes sure that the coldPath is used by a single process
+	coldFlockF *os.File
+
+	// partitionsMovedToCold is the number of partitions moved to coldPath.
+	partitionsMovedToCold atomic.Uint64
+
+	// dataSetVersion is the version of the stored logs. See GetDataSetVersion.
+	dataSetVersion atomic.Uint64
+
+	// maxNewStreamsPerDayPerTenant is an optional limit on the number of new log streams per day per tenant.
+	maxNewStreamsPerDayPerTenant *TenantLimits
+
+	// maxNewStreamsPerHourPerTenant is an optional limit on the number of new log streams per hour per tenant.
+	maxNewStreamsPerHourPerTenant *TenantLimits
+
+	// streamsLimitFallback instructs storing log entries for new streams exceeding the limits into a fallback stream.
+	streamsLimitFallback bool
+
+	// newStreamsPerHourLock protects newStreamsHour and newStreamsPerHour.
+	newStreamsPerHourLock sync.Mutex
+
+	// newStreamsHour is the current hour since the unix epoch for newStreamsPerHour.
+	newStreamsHour int64
+
+	// newStreamsPerHour contains the number of new streams registered per tenant during newStreamsHour.
+	//
+	// It is used for enforcing maxNewStreamsPerHourPerTenant.
+	newStreamsPerHour map[TenantID]uint64
+
+	// streamsLimitOffendersLock protects streamsLimitOffenders.
+	streamsLimitOffendersLock sync.Mutex
+
+	// streamsLimitOffenders contains the number of new streams rejected because of the limits on new streams
+	// per tenant and per set of stream field names.
+	streamsLimitOffenders map[streamsLimitOffenderKey]uint64
+
+	// maxStoredBytesPerTenant is an optional limit on the size of the stored logs per tenant.
+	maxStoredBytesPerTenant *TenantLimits
+
+	// tenantsStoredBytes contains the size of the stored logs per tenant.
+	//
+	// It is periodically updated if maxStoredBytesPerTenant is set.
+	tenantsStoredBytes atomic.Pointer[map[TenantID]uint64]
+
+	// tenantsIngested contains the number of log entries and bytes ingested per tenant since the storage start.
+	//
+	// It maps TenantID to *tenantIngestedCounters. sync.Map is used instead of a mutex-protected map,
+	// since the set of tenants is rarely changed, while the counters are updated on every ingested batch.
+	tenantsIngested sync.Map
+
 	// partitions is a list of partitions for the Storage.
 	//
 	// It must be accessed under partitionsLock.
@@ -142,7 +242,15 @@ type Storage struct {
 	// It must be accessed under partitionsLock.
 	deletedPartitions []int64
 
-	// partitionsLock protects partitions, ptwHot, deletedPartitions.
+	// movingPartitions contains days for the partitions, which are moved to coldPath at the moment.
+	//
+	// The corresponding channels are closed when the move is finished.
+	// Writes to these partitions must wait until the move is finished.
+	//
+	// It must be accessed under partitionsLock.
+	movingPartitions map[int64]chan struct{}
+
+	// partitionsLock protects partitions, ptwHot, deletedPartitions, movingPartitions.
 	partitionsLock sync.Mutex
 
 	// stopCh is closed when the Storage must be stopped.
@@ -189,9 +297,9 @@ func (s *Storage) PartitionAttach(name string) error {
 	}
 
 	// Open the partition and add it to the s.partitions.
-	partitionsPath := filepath.Join(s.path, partitionsDirname)
-	partitionPath := filepath.Join(partitionsPath, name)
-	if !fs.IsPathExist(partitionPath) {
+	partitionPath := s.getExistingPartitionPath(name)
+	if partitionPath == "" {
+		partitionPath = filepath.Join(s.path, partitionsDirname, name)
 		return fmt.Errorf("cannot attach the partition %q, because there is no the corresponding directory %q", name, partitionPath)
 	}
 
@@ -200,6 +308,7 @@ func (s *Storage) PartitionAttach(name string) error {
 
 	s.partitions = append(s.partitions, ptw)
 	sortPartitions(s.partitions)
+	s.updateDataSetVersion()
 
 	logger.Infof("successfully attached partition %q from %q", name, partitionPath)
 
@@ -226,6 +335,7 @@ func (s *Storage) PartitionDetach(name string) error {
 			if ptw == s.ptwHot {
 				s.ptwHot = nil
 			}
+			s.updateDataSetVersion()
 			return ptw
 		}
 		return nil
@@ -346,6 +456,12 @@ type partitionWrapper struct {
 
 	// doneCh is closed when refCount reaches zero, e.g. when the partitionWrapper is no longer accessed.
 	doneCh chan struct{}
+
+	// writersWG tracks in-flight writes to the partition.
+	//
+	// It allows waiting until all the writes are finished before moving the partition to Storage.coldPath.
+	// It must be incremented under Storage.partitionsLock.
+	writersWG sync.WaitGroup
 }
 
 func newPartitionWrapper(pt *partition, day int64) *partitionWrapper {
@@ -431,6 +547,11 @@ func MustOpenStorage(path string, cfg *StorageConfig) *Storage {
 		minFreeDiskSpaceBytes = uint64(cfg.MinFreeDiskSpaceBytes)
 	}
 
+	coldAfter := cfg.ColdAfter
+	if coldAfter < 24*time.Hour {
+		coldAfter = 24 * time.Hour
+	}
+
 	if !fs.IsPathExist(path) {
 		mustCreateStorage(path)
 	}
@@ -444,6 +565,7 @@ func MustOpenStorage(path string, cfg *StorageConfig) *Storage {
 	s := &Storage{
 		path:                   path,
 		retention:              retention,
+		retentionRules:         cfg.RetentionRules,
 		maxDiskSpaceUsageBytes: cfg.MaxDiskSpaceUsageBytes,
 		maxDiskUsagePercent:    cfg.MaxDiskUsagePercent,
 		flushInterval:          flushInterval,
@@ -452,7 +574,16 @@ func MustOpenStorage(path string, cfg *StorageConfig) *Storage {
 		logNewStreams:          cfg.LogNewStreams,
 		logIngestedRows:        cfg.LogIngestedRows,
 		flockF:                 flockF,
-		stopCh:                 make(chan struct{}),
+		coldPath:               cfg.ColdPath,
+		coldAfter:              coldAfter,
+		movingPartitions:       make(map[int64]chan struct{}),
+
+		maxNewStreamsPerDayPerTenant:  cfg.MaxNewStreamsPerDayPerTenant,
+		maxNewStreamsPerHourPerTenant: cfg.MaxNewStreamsPerHourPerTenant,
+		streamsLimitFallback:          cfg.StreamsLimitFallback,
+		maxStoredBytesPerTenant:       cfg.MaxStoredBytesPerTenant,
+
+		stopCh: make(chan struct{}),
 
 		streamIDCache:     streamIDCache,
 		filterStreamCache: filterStreamCache,
@@ -462,23 +593,18 @@ func MustOpenStorage(path string, cfg *StorageConfig) *Storage {
 	fs.MustMkdirIfNotExist(partitionsPath)
 	fs.MustSyncPath(path)
 
-	des := fs.MustReadDir(partitionsPath)
-	ptws := make([]*partitionWrapper, len(des))
+	if s.coldPath != "" {
+		s.mustOpenColdPath()
+	}
+
+	partitionPaths := s.mustListPartitionPaths()
+	ptws := make([]*partitionWrapper, len(partitionPaths))
 
 	// Open partitions in parallel. This should improve VictoriaLogs initialization duration
 	// when it opens many partitions.
 	var wg sync.WaitGroup
 	concurrencyLimiterCh := make(chan struct{}, cgroup.AvailableCPUs())
-	for i, de := range des {
-		fname := de.Name()
-
-		partitionDir := filepath.Join(partitionsPath, fname)
-		if fs.IsPartiallyRemovedDir(partitionDir) {
-			// Drop partially removed partition directory. This may happen when unclean shutdown happens during partition deletion.
-			fs.MustRemoveDir(partitionDir)
-			continue
-		}
-
+	for i, partitionPath := range partitionPaths {
 		wg.Add(1)
 		concurrencyLimiterCh <- struct{}{}
 		go func(idx int) {
@@ -487,12 +613,12 @@ func MustOpenStorage(path string, cfg *StorageConfig) *Storage {
 				wg.Done()
 			}()
 
+			fname := filepath.Base(partitionPath)
 			day, err := getPartitionDayFromName(fname)
 			if err != nil {
-				logger.Panicf("FATAL: cannot parse partition filename %q at %q: %s", fname, partitionsPath, err)
+				logger.Panicf("FATAL: cannot parse partition filename %q at %q: %s", fname, filepath.Dir(partitionPath), err)
 			}
 
-			partitionPath := filepath.Join(partitionsPath, fname)
 			pt := mustOpenPartition(s, partitionPath)
 			ptws[idx] = newPartitionWrapper(pt, day)
 		}(i)
@@ -521,11 +647,22 @@ func MustOpenStorage(path string, cfg *StorageConfig) *Storage {
 	ptws = ptws[:j]
 
 	s.partitions = ptws
+	s.mustLoadDataSetVersion(getPartitionPaths(ptws))
 	s.runRetentionWatcher()
 	s.runMaxDiskSpaceUsageWatcher()
+	s.runColdPartitionsMover()
+	s.runTenantsStoredBytesUpdater()
 	return s
 }
 
+func getPartitionPaths(ptws []*partitionWrapper) []string {
+	paths := make([]string, len(ptws))
+	for i, ptw := range ptws {
+		paths[i] = ptw.pt.path
+	}
+	return paths
+}
+
 func sortPartitions(ptws []*partitionWrapper) {
 	sort.Slice(ptws, func(i, j int) bool {
 		return ptws[i].day < ptws[j].day
@@ -573,6 +710,9 @@ func (s *Storage) watchRetention() {
 			ptwsToDelete = ptws[:i]
 			s.partitions = ptws[i:]
 			s.updateDeletedPartitionsLocked(ptwsToDelete)
+			if len(ptwsToDelete) > 0 {
+				s.updateDataSetVersion()
+			}
 
 			// Remove reference to deleted partitions from s.ptwHot
 			if slices.Contains(ptwsToDelete, s.ptwHot) {
@@ -592,6 +732,8 @@ func (s *Storage) watchRetention() {
 			ptwsToDelete[i] = nil
 		}
 
+		s.dropRowsOutsideRetentionRules()
+
 		select {
 		case <-s.stopCh:
 			return
@@ -600,6 +742,44 @@ func (s *Storage) watchRetention() {
 	}
 }
 
+// dropRowsOutsideRetentionRules drops log entries outside s.retentionRules from the stored partitions.
+func (s *Storage) dropRowsOutsideRetentionRules() {
+	if len(s.retentionRules) == 0 {
+		return
+	}
+
+	minRetention := s.retentionRules[0].Retention
+	for _, rr := range s.retentionRules[1:] {
+		minRetention = min(minRetention, rr.Retention)
+	}
+	maxDay := time.Now().UTC().Add(-minRetention).UnixNano() / nsecsPerDay
+
+	// Obtain partitions, which may contain log entries outside the retention rules.
+	var ptws []*partitionWrapper
+	s.partitionsLock.Lock()
+	for _, ptw := range s.partitions {
+		if ptw.day > maxDay {
+			break
+		}
+		ptw.incRef()
+		ptws = append(ptws, ptw)
+	}
+	s.partitionsLock.Unlock()
+
+	for _, ptw := range ptws {
+		if !needStop(s.stopCh) {
+			ptw.pt.ddb.mustDropRowsOutsideRetentionRules(s.stopCh)
+		}
+		ptw.decRef()
+	}
+
+	// Log entries outside the retention rules become invisible for search as the time goes,
+	// so the set of stored logs changes even if nothing has been dropped above.
+	if len(ptws) > 0 {
+		s.updateDataSetVersion()
+	}
+}
+
 func (s *Storage) watchMaxDiskSpaceUsage() {
 	d := timeutil.AddJitterToDuration(10 * time.Second)
 	ticker := time.NewTicker(d)
@@ -647,6 +827,7 @@ func (s *Storage) watchMaxDiskSpaceUsage() {
 			ptwsToDelete = ptws[:i]
 			s.partitions = ptws[i:]
 			s.updateDeletedPartitionsLocked(ptwsToDelete)
+			s.updateDataSetVersion()
 
 			// Remove reference to deleted partitions from s.ptwHot
 			if slices.Contains(ptwsToDelete, s.ptwHot) {
@@ -704,6 +885,7 @@ func (s *Storage) MustClose() {
 	s.wg.Wait()
 
 	// Close partitions
+	partitionPaths := getPartitionPaths(s.partitions)
 	for _, pw := range s.partitions {
 		pw.decRef()
 		if n := pw.refCount.Load(); n != 0 {
@@ -713,6 +895,9 @@ func (s *Storage) MustClose() {
 	s.partitions = nil
 	s.ptwHot = nil
 
+	// Persist the data set version after the partitions are closed, so it reflects their final state.
+	s.mustSaveDataSetVersion(partitionPaths)
+
 	// Stop caches
 
 	// Do not persist caches, since they may become out of sync with partitions
@@ -729,6 +914,10 @@ func (s *Storage) MustClose() {
 	// release lock file
 	fs.MustClose(s.flockF)
 	s.flockF = nil
+	if s.coldFlockF != nil {
+		fs.MustClose(s.coldFlockF)
+		s.coldFlockF = nil
+	}
 
 	s.path = ""
 }
@@ -760,6 +949,56 @@ func (s *Storage) MustForceMerge(partitionNamePrefix string) {
 	}
 }
 
+// DeleteRows marks log entries matching qctx.Query for qctx.TenantIDs as deleted.
+//
+// The marked log entries become invisible for search after returning from DeleteRows.
+// They are physically removed from the storage during background merges.
+// Use MustForceMerge for removing them as soon as possible.
+//
+// The qctx.Query must contain only filters without pipes and subqueries.
+func (s *Storage) DeleteRows(qctx *QueryContext) error {
+	q := qctx.Query
+	if len(q.pipes) > 0 {
+		return fmt.Errorf("the query [%s] mustn't contain pipes", q)
+	}
+	if hasFilterInWithQueryForFilter(q.f) {
+		return fmt.Errorf("the query [%s] mustn't contain subqueries", q)
+	}
+	if len(qctx.TenantIDs) == 0 {
+		return nil
+	}
+
+	minTimestamp, maxTimestamp := q.GetFilterTimeRange()
+	minDay := minTimestamp / nsecsPerDay
+	maxDay := maxTimestamp / nsecsPerDay
+
+	var ptws []*partitionWrapper
+
+	s.partitionsLock.Lock()
+	s.waitForPartitionMovesLocked(minDay, maxDay)
+	for _, ptw := range s.partitions {
+		if ptw.day >= minDay && ptw.day <= maxDay {
+			ptw.incRef()
+			ptw.writersWG.Add(1)
+			ptws = append(ptws, ptw)
+		}
+	}
+	s.partitionsLock.Unlock()
+
+	startTime := time.Now()
+	for _, ptw := range ptws {
+		ptw.pt.mustDeleteRows(qctx.TenantIDs, q)
+		ptw.writersWG.Done()
+		ptw.decRef()
+	}
+	if len(ptws) > 0 {
+		s.updateDataSetVersion()
+	}
+	logger.Infof("marked log entries matching [%s] for %d tenants as deleted at %d partitions in %.3fs", q, len(qctx.TenantIDs), len(ptws), time.Since(startTime).Seconds())
+
+	return nil
+}
+
 // MustAddRows adds lr to s.
 //
 // It is recommended checking whether the s is in read-only mode by calling IsReadOnly()
@@ -773,15 +1012,18 @@ func (s *Storage) MustAddRows(lr *LogRows) {
 	ptwHot := s.ptwHot
 	if ptwHot != nil {
 		ptwHot.incRef()
+		ptwHot.writersWG.Add(1)
 	}
 	s.partitionsLock.Unlock()
 
 	if ptwHot != nil {
 		if ptwHot.canAddAllRows(lr) {
 			ptwHot.pt.mustAddRows(lr)
+			ptwHot.writersWG.Done()
 			ptwHot.decRef()
 			return
 		}
+		ptwHot.writersWG.Done()
 		ptwHot.decRef()
 	}
 
@@ -822,6 +1064,7 @@ func (s *Storage) MustAddRows(lr *LogRows) {
 		ptw := s.getPartitionForWriting(day)
 		if ptw != nil {
 			ptw.pt.mustAddRows(lrPart)
+			ptw.writersWG.Done()
 			ptw.decRef()
 		} else {
 			// the lrPart must contain at least a single row, so log it.
@@ -851,6 +1094,8 @@ func (tf *TimeFormatter) String() string {
 //
 // The partition is automatically created if it didn't exist.
 //
+// The caller must call writersWG.Done() and decRef() on the returned partition when it is no longer needed.
+//
 // nil is returned in the following cases:
 //
 //   - When the partition is outside the configured retention.
@@ -862,6 +1107,9 @@ func (s *Storage) getPartitionForWriting(day int64) *partitionWrapper {
 	s.partitionsLock.Lock()
 	defer s.partitionsLock.Unlock()
 
+	// Wait until the partition is moved to s.coldPath if needed.
+	s.waitForPartitionMovesLocked(day, day)
+
 	// Search for the partition using binary search
 	ptws := s.partitions
 	n := sort.Search(len(ptws), func(i int) bool {
@@ -882,8 +1130,7 @@ func (s *Storage) getPartitionForWriting(day int64) *partitionWrapper {
 		}
 
 		fname := getPartitionNameFromDay(day)
-		partitionPath := filepath.Join(s.path, partitionsDirname, fname)
-		if fs.IsPathExist(partitionPath) {
+		if s.getExistingPartitionPath(fname) != "" {
 			// The partition directory exists. This can happen in the following cases:
 			// - When the partition directory has been manually added, but it wasn't attached yet via Storage.PartitionAttach().
 			// - When the partition has been detached via Storage.PartitionDetach().
@@ -891,6 +1138,7 @@ func (s *Storage) getPartitionForWriting(day int64) *partitionWrapper {
 		}
 
 		// Create missing partition.
+		partitionPath := filepath.Join(s.path, partitionsDirname, fname)
 		mustCreatePartition(partitionPath)
 		pt := mustOpenPartition(s, partitionPath)
 		ptw = newPartitionWrapper(pt, day)
@@ -905,6 +1153,7 @@ func (s *Storage) getPartitionForWriting(day int64) *partitionWrapper {
 
 	s.ptwHot = ptw
 	ptw.incRef()
+	ptw.writersWG.Add(1)
 
 	return ptw
 }
@@ -923,9 +1172,14 @@ func (s *Storage) UpdateStats(ss *StorageStats) {
 	ss.PartitionsCount += uint64(len(s.partitions))
 	for _, ptw := range s.partitions {
 		ptw.pt.updateStats(&ss.PartitionStats)
+		if s.isColdPartitionPath(ptw.pt.path) {
+			ss.ColdPartitionsCount++
+		}
 	}
 	s.partitionsLock.Unlock()
 
+	ss.PartitionsMovedToColdTotal += s.partitionsMovedToCold.Load()
+
 	ss.IsReadOnly = s.IsReadOnly()
 }
 
@@ -952,6 +1206,26 @@ func (s *Storage) DebugFlush() {
 	}
 }
 
+// getExistingPartitionPath returns the path to the existing partition directory with the given name at s.coldPath or s.path.
+//
+// The partition at s.coldPath is preferred over the partition with the same name at s.path in the same way as at startup.
+// See mustListPartitionPaths.
+//
+// An empty string is returned if the partition directory doesn't exist.
+func (s *Storage) getExistingPartitionPath(name string) string {
+	if s.coldPath != "" {
+		partitionPath := filepath.Join(s.coldPath, partitionsDirname, name)
+		if fs.IsPathExist(partitionPath) {
+			return partitionPath
+		}
+	}
+	partitionPath := filepath.Join(s.path, partitionsDirname, name)
+	if fs.IsPathExist(partitionPath) {
+		return partitionPath
+	}
+	return ""
+}
+
 func durationToDays(d time.Duration) int64 {
 	return int64(d / (time.Hour * 24))
 }
@@ -0,0 +1,290 @@
+package logstorage
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timeutil"
+)
+
+// coldTmpDirname is the name of the directory at cold path, where partitions are copied before being moved to the cold partitions directory.
+const coldTmpDirname = "tmp"
+
+// mustOpenColdPath prepares s.coldPath for storing partitions.
+func (s *Storage) mustOpenColdPath() {
+	fs.MustMkdirIfNotExist(s.coldPath)
+	s.coldFlockF = fs.MustCreateFlockFile(s.coldPath)
+
+	// Drop partially copied partitions. This may happen when unclean shutdown happens while moving partitions to cold path.
+	tmpPath := filepath.Join(s.coldPath, coldTmpDirname)
+	fs.MustRemoveDir(tmpPath)
+	fs.MustMkdirIfNotExist(tmpPath)
+
+	fs.MustMkdirIfNotExist(filepath.Join(s.coldPath, partitionsDirname))
+	fs.MustSyncPath(s.coldPath)
+}
+
+// mustListPartitionPaths returns paths to all the partition directories at s.path and s.coldPath.
+func (s *Storage) mustListPartitionPaths() []string {
+	hotPaths := mustListPartitionPathsAt(filepath.Join(s.path, partitionsDirname))
+	if s.coldPath == "" {
+		return hotPaths
+	}
+
+	coldPaths := mustListPartitionPathsAt(filepath.Join(s.coldPath, partitionsDirname))
+	coldNames := make(map[string]struct{}, len(coldPaths))
+	for _, path := range coldPaths {
+		coldNames[filepath.Base(path)] = struct{}{}
+	}
+
+	paths := coldPaths
+	for _, path := range hotPaths {
+		if _, ok := coldNames[filepath.Base(path)]; ok {
+			// The partition has been moved to cold path, but unclean shutdown happened before deleting it from s.path.
+			logger.Infof("removing the partition %s, since it has been already moved to cold path %s", path, s.coldPath)
+			mustDeletePartition(path)
+			continue
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func mustListPartitionPathsAt(partitionsPath string) []string {
+	var paths []string
+	for _, de := range fs.MustReadDir(partitionsPath) {
+		partitionPath := filepath.Join(partitionsPath, de.Name())
+		if fs.IsPartiallyRemovedDir(partitionPath) {
+			// Drop partially removed partition directory. This may happen when unclean shutdown happens during partition deletion.
+			fs.MustRemoveDir(partitionPath)
+			continue
+		}
+		paths = append(paths, partitionPath)
+	}
+	return paths
+}
+
+// isColdPartitionPath returns true if the partition at the given path is located at s.coldPath.
+func (s *Storage) isColdPartitionPath(partitionPath string) bool {
+	return s.coldPath != "" && filepath.Dir(partitionPath) == filepath.Join(s.coldPath, partitionsDirname)
+}
+
+func (s *Storage) runColdPartitionsMover() {
+	if s.coldPath == "" {
+		return
+	}
+	s.wg.Add(1)
+	go func() {
+		s.watchColdPartitions()
+		s.wg.Done()
+	}()
+}
+
+func (s *Storage) watchColdPartitions() {
+	d := timeutil.AddJitterToDuration(time.Hour)
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+	for {
+		s.moveColdPartitions()
+
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// getMaxColdDay returns the maximum day for the partitions, which must be moved to s.coldPath.
+func (s *Storage) getMaxColdDay() int64 {
+	return time.Now().UTC().Add(-s.coldAfter).UnixNano()/nsecsPerDay - 1
+}
+
+// moveColdPartitions moves partitions older than s.coldAfter from s.path to s.coldPath.
+func (s *Storage) moveColdPartitions() {
+	maxDay := s.getMaxColdDay()
+
+	var ptws []*partitionWrapper
+	s.partitionsLock.Lock()
+	for _, ptw := range s.partitions {
+		if ptw.day > maxDay {
+			break
+		}
+		if s.isColdPartitionPath(ptw.pt.path) {
+			continue
+		}
+		ptw.incRef()
+		ptws = append(ptws, ptw)
+	}
+	s.partitionsLock.Unlock()
+
+	// Move partitions one by one in order to reduce load on the system.
+	for _, ptw := range ptws {
+		if !needStop(s.stopCh) {
+			s.mustMovePartitionToCold(ptw)
+		}
+		ptw.decRef()
+	}
+}
+
+// mustMovePartitionToCold moves ptw from s.path to s.coldPath.
+//
+// The partition remains searchable during the move. Writes to the partition are paused while the last changes are copied to s.coldPath.
+//
+// The caller must hold a reference to ptw.
+func (s *Storage) mustMovePartitionToCold(ptw *partitionWrapper) {
+	name := ptw.pt.name
+	hotPath := ptw.pt.path
+	coldPath := filepath.Join(s.coldPath, partitionsDirname, name)
+	tmpPath := filepath.Join(s.coldPath, coldTmpDirname, name)
+
+	logger.Infof("moving the partition %s to cold path %s", hotPath, coldPath)
+	startTime := time.Now()
+
+	fs.MustRemoveDir(tmpPath)
+
+	// Copy the bulk of the partition data while the partition remains writable.
+	snapshotPath := ptw.pt.mustCreateSnapshot()
+	mustCopyDirDelta(snapshotPath, "", tmpPath)
+
+	// Pause writes to the partition.
+	moveDoneCh := make(chan struct{})
+	s.partitionsLock.Lock()
+	s.movingPartitions[ptw.day] = moveDoneCh
+	if s.ptwHot == ptw {
+		s.ptwHot = nil
+	}
+	s.partitionsLock.Unlock()
+	ptw.writersWG.Wait()
+
+	// Copy the data, which has been changed since the first snapshot.
+	// Parts are immutable, so only new parts and metadata files are copied.
+	finalSnapshotPath := ptw.pt.mustCreateSnapshot()
+	mustCopyDirDelta(finalSnapshotPath, snapshotPath, tmpPath)
+	fs.MustRemoveDir(snapshotPath)
+	fs.MustRemoveDir(finalSnapshotPath)
+
+	if err := os.Rename(tmpPath, coldPath); err != nil {
+		logger.Panicf("FATAL: cannot rename %q to %q: %s", tmpPath, coldPath, err)
+	}
+	fs.MustSyncPath(filepath.Dir(tmpPath))
+	fs.MustSyncPath(filepath.Dir(coldPath))
+
+	// Open the partition at s.coldPath before locking s.partitionsLock, since this may take a lot of time,
+	// while ingestion and querying for all the partitions is blocked on s.partitionsLock.
+	// Writes to the partition remain paused until it is replaced below, so the opened partition contains all the data.
+	pt := mustOpenPartition(s, coldPath)
+
+	// Replace the partition at s.path with the partition at s.coldPath.
+	s.partitionsLock.Lock()
+	idx := slices.Index(s.partitions, ptw)
+	if idx >= 0 {
+		s.partitions[idx] = newPartitionWrapper(pt, ptw.day)
+		ptw.mustDrop.Store(true)
+	}
+	delete(s.movingPartitions, ptw.day)
+	s.partitionsLock.Unlock()
+	close(moveDoneCh)
+
+	if idx < 0 {
+		// The partition has been detached or deleted during the move.
+		mustClosePartition(pt)
+		mustDeletePartition(coldPath)
+		logger.Infof("cancelled moving the partition %s to cold path, since it has been detached or deleted", hotPath)
+		return
+	}
+
+	// Release the reference from s.partitions. The partition at s.path is deleted when the last query releases it.
+	ptw.decRef()
+
+	s.partitionsMovedToCold.Add(1)
+	logger.Infof("moved the partition %s to cold path %s in %.3f seconds", hotPath, coldPath, time.Since(startTime).Seconds())
+}
+
+// waitForPartitionMovesLocked waits until partitions for days in the range [minDay, maxDay] are moved to s.coldPath.
+//
+// s.partitionsLock must be locked by the caller. It is temporarily unlocked while waiting.
+func (s *Storage) waitForPartitionMovesLocked(minDay, maxDay int64) {
+	for {
+		var moveDoneCh chan struct{}
+		for day, ch := range s.movingPartitions {
+			if day >= minDay && day <= maxDay {
+				moveDoneCh = ch
+				break
+			}
+		}
+		if moveDoneCh == nil {
+			return
+		}
+
+		s.partitionsLock.Unlock()
+		<-moveDoneCh
+		s.partitionsLock.Lock()
+	}
+}
+
+// mustCopyDirDelta makes dstDir contents identical to srcDir contents.
+//
+// Files at srcDir, which are hard links to files at the same relative paths at prevSrcDir, aren't copied
+// if they already exist at dstDir, since they are already copied from prevSrcDir.
+// prevSrcDir may be empty.
+func mustCopyDirDelta(srcDir, prevSrcDir, dstDir string) {
+	fs.MustMkdirIfNotExist(dstDir)
+
+	srcNames := make(map[string]struct{})
+	for _, de := range fs.MustReadDir(srcDir) {
+		name := de.Name()
+		srcNames[name] = struct{}{}
+
+		srcPath := filepath.Join(srcDir, name)
+		prevSrcPath := ""
+		if prevSrcDir != "" {
+			prevSrcPath = filepath.Join(prevSrcDir, name)
+		}
+		dstPath := filepath.Join(dstDir, name)
+
+		if de.IsDir() {
+			mustCopyDirDelta(srcPath, prevSrcPath, dstPath)
+			continue
+		}
+		if prevSrcPath != "" && isSameFile(srcPath, prevSrcPath) && fs.IsPathExist(dstPath) {
+			continue
+		}
+		fs.MustCopyFile(srcPath, dstPath)
+	}
+
+	// Remove files, which are missing at srcDir. These are parts, which have been merged since prevSrcDir snapshot.
+	for _, de := range fs.MustReadDir(dstDir) {
+		name := de.Name()
+		if _, ok := srcNames[name]; ok {
+			continue
+		}
+		path := filepath.Join(dstDir, name)
+		if de.IsDir() {
+			fs.MustRemoveDir(path)
+		} else {
+			fs.MustRemovePath(path)
+		}
+	}
+
+	fs.MustSyncPath(dstDir)
+}
+
+func isSameFile(path1, path2 string) bool {
+	fi1, err := os.Stat(path1)
+	if err != nil {
+		logger.Panicf("FATAL: cannot stat %q: %s", path1, err)
+	}
+	fi2, err := os.Stat(path2)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false
+		}
+		logger.Panicf("FATAL: cannot stat %q: %s", path2, err)
+	}
+	return os.SameFile(fi1, fi2)
+}
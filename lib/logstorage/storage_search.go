@@ -34,6 +34,17 @@ type QueryContext struct {
 	// Query is the query to execute.
 	Query *Query
 
+	// PartialResponse is an optional state for the query, which is allowed to return partial results
+	// when some of remote storage nodes are unavailable.
+	//
+	// The query fails if some of remote storage nodes are unavailable when PartialResponse is nil.
+	PartialResponse *PartialResponse
+
+	// StreamShards is an optional list of log stream shards to query.
+	//
+	// All the log streams are queried if StreamShards is nil.
+	StreamShards *StreamShards
+
 	// startTime is creation time for the QueryContext.
 	//
 	// It is used for calculating query druation.
@@ -43,22 +54,22 @@ type QueryContext struct {
 // NewQueryContext returns new context for the given query.
 func NewQueryContext(ctx context.Context, qs *QueryStats, tenantIDs []TenantID, q *Query) *QueryContext {
 	startTime := time.Now()
-	return newQueryContext(ctx, qs, tenantIDs, q, startTime)
+	return newQueryContext(ctx, qs, tenantIDs, q, nil, nil, startTime)
 }
 
 // WithQuery returns new QueryContext with the given q, while preserving other fields from qctx.
 func (qctx *QueryContext) WithQuery(q *Query) *QueryContext {
-	return newQueryContext(qctx.Context, qctx.QueryStats, qctx.TenantIDs, q, qctx.startTime)
+	return newQueryContext(qctx.Context, qctx.QueryStats, qctx.TenantIDs, q, qctx.PartialResponse, qctx.StreamShards, qctx.startTime)
 }
 
 // WithContext returns new QueryContext with the given ctx, while preserving other fields from qctx.
 func (qctx *QueryContext) WithContext(ctx context.Context) *QueryContext {
-	return newQueryContext(ctx, qctx.QueryStats, qctx.TenantIDs, qctx.Query, qctx.startTime)
+	return newQueryContext(ctx, qctx.QueryStats, qctx.TenantIDs, qctx.Query, qctx.PartialResponse, qctx.StreamShards, qctx.startTime)
 }
 
 // WithContextAndQuery returns new QueryContext with the given ctx and q, while preserving other fields from qctx.
 func (qctx *QueryContext) WithContextAndQuery(ctx context.Context, q *Query) *QueryContext {
-	return newQueryContext(ctx, qctx.QueryStats, qctx.TenantIDs, q, qctx.startTime)
+	return newQueryContext(ctx, qctx.QueryStats, qctx.TenantIDs, q, qctx.PartialResponse, qctx.StreamShards, qctx.startTime)
 }
 
 // QueryDurationNsecs returns the duration in nanoseconds since the NewQueryContext call.
@@ -66,16 +77,49 @@ func (qctx *QueryContext) QueryDurationNsecs() int64 {
 	return time.Since(qctx.startTime).Nanoseconds()
 }
 
-func newQueryContext(ctx context.Context, qs *QueryStats, tenantIDs []TenantID, q *Query, startTime time.Time) *QueryContext {
+func newQueryContext(ctx context.Context, qs *QueryStats, tenantIDs []TenantID, q *Query, pr *PartialResponse, ss *StreamShards, startTime time.Time) *QueryContext {
 	return &QueryContext{
-		Context:    ctx,
-		QueryStats: qs,
-		TenantIDs:  tenantIDs,
-		Query:      q,
-		startTime:  startTime,
+		Context:         ctx,
+		QueryStats:      qs,
+		TenantIDs:       tenantIDs,
+		Query:           q,
+		PartialResponse: pr,
+		StreamShards:    ss,
+		startTime:       startTime,
 	}
 }
 
+// PartialResponse holds remote storage nodes, which failed to return results for the query allowed to return partial results.
+type PartialResponse struct {
+	mu sync.Mutex
+
+	missingNodes []string
+}
+
+// AddMissingNode registers the remote storage node with the given addr, which failed to return results.
+//
+// It returns false if the node has been already registered.
+func (pr *PartialResponse) AddMissingNode(addr string) bool {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	if slices.Contains(pr.missingNodes, addr) {
+		return false
+	}
+	pr.missingNodes = append(pr.missingNodes, addr)
+	return true
+}
+
+// GetMissingNodes returns sorted addrs for remote storage nodes, which failed to return results.
+func (pr *PartialResponse) GetMissingNodes() []string {
+	pr.mu.Lock()
+	a := slices.Clone(pr.missingNodes)
+	pr.mu.Unlock()
+
+	slices.Sort(a)
+	return a
+}
+
 // genericSearchOptions contain options used for search.
 type genericSearchOptions struct {
 	// tenantIDs must contain the list of tenantIDs for the search.
@@ -99,6 +143,9 @@ type genericSearchOptions struct {
 
 	// timeOffset is the offset in nanoseconds, which must be subtracted from the selected the _time values before these values are passed to query pipes.
 	timeOffset int64
+
+	// streamShards is an optional list of log stream shards to search in.
+	streamShards *StreamShards
 }
 
 type searchOptions struct {
@@ -121,6 +168,11 @@ type searchOptions struct {
 
 	// fieldsFilter is the filter of fields to return in the result
 	fieldsFilter *prefixfilter.Filter
+
+	// deleteMarkers contains optional delete markers for the searched part.
+	//
+	// Log entries matching deleteMarkers are skipped during the search.
+	deleteMarkers []*deleteMarker
 }
 
 // WriteDataBlockFunc must process the db.
@@ -190,6 +242,7 @@ func (s *Storage) runQuery(qctx *QueryContext, writeBlock writeBlockResultFunc)
 		filter:       q.f,
 		fieldsFilter: fieldsFilter,
 		timeOffset:   -q.opts.timeOffset,
+		streamShards: qctx.StreamShards,
 	}
 
 	workersCount := q.GetConcurrency()
@@ -1143,6 +1196,11 @@ func (s *Storage) search(workersCount int, so *genericSearchOptions, qs *QuerySt
 						bsw.reset()
 						continue
 					}
+					if so.streamShards != nil && !so.streamShards.hasStreamID(&bsw.bh.streamID) {
+						// The block belongs to log stream, which must be read from another storage node.
+						bsw.reset()
+						continue
+					}
 
 					rowsProcessed := bsw.bh.rowsCount
 
@@ -1335,14 +1393,39 @@ func (ddb *datadb) search(so *searchOptions, qs *QueryStats, workCh chan<- *bloc
 
 	// Increase references to the searched parts, so they aren't deleted during search.
 	// References to the searched parts must be decremented by calling the returned partitionSearchFinalizer.
-	for _, pw := range pws {
+	//
+	// Obtain delete markers for the searched parts under the lock, since they may be updated concurrently.
+	var dmss [][]*deleteMarker
+	for i, pw := range pws {
 		pw.incRef()
+		if len(pw.deleteMarkers) > 0 {
+			if dmss == nil {
+				dmss = make([][]*deleteMarker, len(pws))
+			}
+			dmss[i] = pw.deleteMarkers
+		}
 	}
 	ddb.partsLock.Unlock()
 
+	// Skip log entries outside the configured retention rules.
+	rdms := ddb.pt.getRetentionDeleteMarkers()
+
 	// Apply search to matching parts
-	for _, pw := range pws {
-		pw.p.search(so, qs, workCh, stopCh)
+	for i, pw := range pws {
+		soLocal := so
+		var dms []*deleteMarker
+		if dmss != nil {
+			dms = dmss[i]
+		}
+		if len(rdms) > 0 {
+			dms = append(slices.Clip(dms), rdms...)
+		}
+		if len(dms) > 0 {
+			soCopy := *so
+			soCopy.deleteMarkers = dms
+			soLocal = &soCopy
+		}
+		pw.p.search(soLocal, qs, workCh, stopCh)
 	}
 
 	return func() {
@@ -1628,7 +1711,7 @@ func forEachStreamField(streams []ValueWithHits, f func(f Field, hits uint64)) {
 	var fields []Field
 	for i := range streams {
 		var err error
-		fields, err = parseStreamFields(fields[:0], streams[i].Value)
+		fields, err = ParseStreamFields(fields[:0], streams[i].Value)
 		if err != nil {
 			continue
 		}
@@ -1639,7 +1722,10 @@ func forEachStreamField(streams []ValueWithHits, f func(f Field, hits uint64)) {
 	}
 }
 
-func parseStreamFields(dst []Field, s string) ([]Field, error) {
+// ParseStreamFields parses stream fields from s in the form {name1="value1",...,nameN="valueN"}, appends them to dst and returns the result.
+//
+// The s must be obtained from the _stream field.
+func ParseStreamFields(dst []Field, s string) ([]Field, error) {
 	if len(s) == 0 || s[0] != '{' {
 		return dst, fmt.Errorf("missing '{' at the beginning of stream name")
 	}
@@ -1285,7 +1285,7 @@ func TestParseStreamFieldsSuccess(t *testing.T) {
 	f := func(s, resultExpected string) {
 		t.Helper()
 
-		labels, err := parseStreamFields(nil, s)
+		labels, err := ParseStreamFields(nil, s)
 		if err != nil {
 			t.Fatalf("unexpected error: %s", err)
 		}
@@ -1440,3 +1440,27 @@ func newTestQueryContext(tenantIDs []TenantID, q *Query) *QueryContext {
 	qs := &QueryStats{}
 	return NewQueryContext(context.Background(), qs, tenantIDs, q)
 }
+
+func TestPartialResponse(t *testing.T) {
+	var pr PartialResponse
+
+	if nodes := pr.GetMissingNodes(); len(nodes) != 0 {
+		t.Fatalf("unexpected missing nodes: %q", nodes)
+	}
+
+	if !pr.AddMissingNode("node-2:9428") {
+		t.Fatalf("expecting true when adding new node")
+	}
+	if !pr.AddMissingNode("node-1:9428") {
+		t.Fatalf("expecting true when adding new node")
+	}
+	if pr.AddMissingNode("node-2:9428") {
+		t.Fatalf("expecting false when adding already registered node")
+	}
+
+	nodes := pr.GetMissingNodes()
+	nodesExpected := []string{"node-1:9428", "node-2:9428"}
+	if !reflect.DeepEqual(nodes, nodesExpected) {
+		t.Fatalf("unexpected missing nodes; got %q; want %q", nodes, nodesExpected)
+	}
+}
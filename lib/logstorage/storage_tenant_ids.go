@@ -0,0 +1,70 @@
+package logstorage
+
+import (
+	"context"
+	"sort"
+)
+
+// GetTenantIDs returns sorted tenantIDs with logs stored at s on the given [start, end] time range.
+//
+// The tenantIDs are obtained from per-day partitions covering the given time range,
+// so the returned tenants may have no logs on the given time range with the precision up to a day.
+func (s *Storage) GetTenantIDs(ctx context.Context, start, end int64) ([]TenantID, error) {
+	minDay := start / nsecsPerDay
+	maxDay := end / nsecsPerDay
+
+	var ptws []*partitionWrapper
+
+	s.partitionsLock.Lock()
+	for _, ptw := range s.partitions {
+		if ptw.day >= minDay && ptw.day <= maxDay {
+			ptw.incRef()
+			ptws = append(ptws, ptw)
+		}
+	}
+	s.partitionsLock.Unlock()
+
+	defer func() {
+		for _, ptw := range ptws {
+			ptw.decRef()
+		}
+	}()
+
+	m := make(map[TenantID]struct{})
+	var tenantIDs []TenantID
+	for _, ptw := range ptws {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		tenantIDs = ptw.pt.idb.appendTenantIDs(tenantIDs[:0])
+		for _, tenantID := range tenantIDs {
+			m[tenantID] = struct{}{}
+		}
+	}
+
+	return getSortedTenantIDs(m), nil
+}
+
+// MergeTenantIDs merges tenantIDs obtained from multiple storage nodes.
+//
+// The returned tenantIDs are sorted and unique.
+func MergeTenantIDs(a [][]TenantID) []TenantID {
+	m := make(map[TenantID]struct{})
+	for _, tenantIDs := range a {
+		for _, tenantID := range tenantIDs {
+			m[tenantID] = struct{}{}
+		}
+	}
+	return getSortedTenantIDs(m)
+}
+
+func getSortedTenantIDs(m map[TenantID]struct{}) []TenantID {
+	tenantIDs := make([]TenantID, 0, len(m))
+	for tenantID := range m {
+		tenantIDs = append(tenantIDs, tenantID)
+	}
+	sort.Slice(tenantIDs, func(i, j int) bool {
+		return tenantIDs[i].less(&tenantIDs[j])
+	})
+	return tenantIDs
+}
@@ -0,0 +1,116 @@
+package logstorage
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+func TestStorageGetTenantIDs(t *testing.T) {
+	t.Parallel()
+
+	path := t.Name()
+
+	cfg := &StorageConfig{
+		Retention: 10 * 24 * time.Hour,
+	}
+	s := MustOpenStorage(path, cfg)
+
+	now := time.Now().UnixNano()
+	lr := GetLogRows([]string{"app"}, nil, nil, nil, "")
+	addRow := func(tenantID TenantID, timestamp int64) {
+		fields := []Field{
+			{
+				Name:  "app",
+				Value: "foo",
+			},
+			{
+				Name:  "_msg",
+				Value: "bar",
+			},
+		}
+		lr.MustAdd(tenantID, timestamp, fields, nil)
+	}
+	addRow(TenantID{AccountID: 3, ProjectID: 0}, now)
+	addRow(TenantID{AccountID: 1, ProjectID: math.MaxUint32}, now)
+	addRow(TenantID{AccountID: 1, ProjectID: 2}, now)
+	addRow(TenantID{AccountID: 1, ProjectID: 2}, now)
+	addRow(TenantID{AccountID: math.MaxUint32, ProjectID: math.MaxUint32}, now)
+	addRow(TenantID{AccountID: 5, ProjectID: 6}, now-3*nsecsPerDay)
+	s.MustAddRows(lr)
+	PutLogRows(lr)
+	s.DebugFlush()
+
+	f := func(start, end int64, tenantIDsExpected []TenantID) {
+		t.Helper()
+
+		tenantIDs, err := s.GetTenantIDs(context.Background(), start, end)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(tenantIDs, tenantIDsExpected) {
+			t.Fatalf("unexpected tenantIDs\ngot\n%v\nwant\n%v", tenantIDs, tenantIDsExpected)
+		}
+	}
+
+	// all the tenants
+	f(math.MinInt64, math.MaxInt64, []TenantID{
+		{AccountID: 1, ProjectID: 2},
+		{AccountID: 1, ProjectID: math.MaxUint32},
+		{AccountID: 3, ProjectID: 0},
+		{AccountID: 5, ProjectID: 6},
+		{AccountID: math.MaxUint32, ProjectID: math.MaxUint32},
+	})
+
+	// tenants for the last day
+	f(now-nsecsPerDay/2, now, []TenantID{
+		{AccountID: 1, ProjectID: 2},
+		{AccountID: 1, ProjectID: math.MaxUint32},
+		{AccountID: 3, ProjectID: 0},
+		{AccountID: math.MaxUint32, ProjectID: math.MaxUint32},
+	})
+
+	// tenants for the older day
+	f(now-3*nsecsPerDay, now-3*nsecsPerDay, []TenantID{
+		{AccountID: 5, ProjectID: 6},
+	})
+
+	// time range without logs
+	f(now-2*nsecsPerDay, now-2*nsecsPerDay, []TenantID{})
+
+	// canceled context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.GetTenantIDs(ctx, math.MinInt64, math.MaxInt64); err == nil {
+		t.Fatalf("expecting non-nil error for canceled context")
+	}
+
+	s.MustClose()
+	fs.MustRemoveDir(path)
+}
+
+func TestMergeTenantIDs(t *testing.T) {
+	f := func(a [][]TenantID, resultExpected []TenantID) {
+		t.Helper()
+
+		result := MergeTenantIDs(a)
+		if !reflect.DeepEqual(result, resultExpected) {
+			t.Fatalf("unexpected result\ngot\n%v\nwant\n%v", result, resultExpected)
+		}
+	}
+
+	f(nil, []TenantID{})
+	f([][]TenantID{
+		{{AccountID: 1, ProjectID: 2}, {AccountID: 3, ProjectID: 4}},
+		nil,
+		{{AccountID: 0, ProjectID: 5}, {AccountID: 1, ProjectID: 2}},
+	}, []TenantID{
+		{AccountID: 0, ProjectID: 5},
+		{AccountID: 1, ProjectID: 2},
+		{AccountID: 3, ProjectID: 4},
+	})
+}
@@ -0,0 +1,419 @@
+package logstorage
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timeutil"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// TenantStats contains stats for the logs stored for a single tenant.
+type TenantStats struct {
+	// CompressedSizeBytes is the size of the stored logs for the tenant on disk.
+	//
+	// It doesn't include the size of per-part metadata and the size of indexdb.
+	CompressedSizeBytes uint64
+
+	// UncompressedSizeBytes is the original size of the stored logs for the tenant.
+	UncompressedSizeBytes uint64
+
+	// RowsCount is the number of the stored log entries for the tenant.
+	RowsCount uint64
+}
+
+// GetTenantsStats returns per-tenant stats for the logs stored in s.
+//
+// Only parts created by VictoriaLogs versions, which support per-tenant stats, are taken into account.
+func (s *Storage) GetTenantsStats() map[TenantID]*TenantStats {
+	s.partitionsLock.Lock()
+	ptws := append([]*partitionWrapper{}, s.partitions...)
+	for _, ptw := range ptws {
+		ptw.incRef()
+	}
+	s.partitionsLock.Unlock()
+
+	m := make(map[TenantID]*TenantStats)
+	for _, ptw := range ptws {
+		ptw.pt.ddb.updateTenantsStats(m)
+		ptw.decRef()
+	}
+	return m
+}
+
+// tenantsStoredBytesUpdateInterval is the interval for updating per-tenant stored bytes used for enforcing StorageConfig.MaxStoredBytesPerTenant.
+const tenantsStoredBytesUpdateInterval = 10 * time.Second
+
+func (s *Storage) runTenantsStoredBytesUpdater() {
+	if s.maxStoredBytesPerTenant.IsEmpty() {
+		return
+	}
+
+	s.updateTenantsStoredBytes()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		d := timeutil.AddJitterToDuration(tenantsStoredBytesUpdateInterval)
+		ticker := time.NewTicker(d)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stopCh:
+				return
+			case <-ticker.C:
+				s.updateTenantsStoredBytes()
+			}
+		}
+	}()
+}
+
+func (s *Storage) updateTenantsStoredBytes() {
+	tss := s.GetTenantsStats()
+	m := make(map[TenantID]uint64, len(tss))
+	for tenantID, ts := range tss {
+		m[tenantID] = ts.CompressedSizeBytes
+	}
+	s.tenantsStoredBytes.Store(&m)
+}
+
+// isTenantStoredBytesLimitExceeded returns true if the given tenantID exceeds StorageConfig.MaxStoredBytesPerTenant.
+func (s *Storage) isTenantStoredBytesLimitExceeded(tenantID TenantID) bool {
+	limit := s.maxStoredBytesPerTenant.Get(tenantID)
+	if limit <= 0 {
+		return false
+	}
+	m := s.tenantsStoredBytes.Load()
+	if m == nil {
+		return false
+	}
+	return (*m)[tenantID] >= uint64(limit)
+}
+
+// CanWriteTenantData returns non-nil error if logs for the given tenantID cannot be written to s because of the configured tenant limits.
+//
+// See https://docs.victoriametrics.com/victorialogs/#tenant-limits
+func (s *Storage) CanWriteTenantData(tenantID TenantID) error {
+	if !s.isTenantStoredBytesLimitExceeded(tenantID) {
+		return nil
+	}
+	GetTenantRejectedRequestsCounter(tenantID, tenantLimitReasonStoredBytes).Inc()
+	return fmt.Errorf("cannot store logs for the tenant %d:%d, since it exceeds the limit on the stored logs size: %d bytes; "+
+		"see https://docs.victoriametrics.com/victorialogs/#tenant-limits", tenantID.AccountID, tenantID.ProjectID, s.maxStoredBytesPerTenant.Get(tenantID))
+}
+
+// mustRegisterNewStream registers the stream with the given sid and streamTagsCanonical at pt, which is missing in pt.idb.
+//
+// It returns non-empty reason if the stream cannot be registered because of StorageConfig.MaxNewStreamsPerDayPerTenant
+// or StorageConfig.MaxNewStreamsPerHourPerTenant. isNew is set to true if the stream has been registered by this call.
+func (pt *partition) mustRegisterNewStream(sid *streamID, streamTagsCanonical string) (reason string, isNew bool) {
+	dayLimit := pt.s.maxNewStreamsPerDayPerTenant.Get(sid.tenantID)
+	hourLimit := pt.s.maxNewStreamsPerHourPerTenant.Get(sid.tenantID)
+	if dayLimit <= 0 && hourLimit <= 0 {
+		pt.idb.mustRegisterStream(sid, streamTagsCanonical)
+		return "", true
+	}
+
+	// Check for the stream existence, check the limits and register the stream under the lock,
+	// so concurrently added rows cannot register more new streams than the limits allow
+	// and the same new stream isn't counted multiple times.
+	pt.tenantsStreamsLock.Lock()
+	defer pt.tenantsStreamsLock.Unlock()
+
+	// The stream may be already registered by concurrent goroutine. Check the cache first,
+	// since the recently registered streams may be invisible in pt.idb yet.
+	if pt.hasStreamIDInCache(sid) || pt.idb.hasStreamID(sid) {
+		return "", false
+	}
+
+	n := uint64(0)
+	if dayLimit > 0 {
+		var ok bool
+		n, ok = pt.tenantsStreams[sid.tenantID]
+		if !ok {
+			if pt.tenantsStreams == nil {
+				pt.tenantsStreams = make(map[TenantID]uint64)
+			}
+			n = pt.idb.getStreamsCountForTenant(sid.tenantID)
+		}
+		if n >= uint64(dayLimit) {
+			pt.tenantsStreams[sid.tenantID] = n
+			return tenantLimitReasonNewStreamsPerDay, false
+		}
+	}
+	if !pt.s.tryRegisterNewStreamForCurrentHour(sid.tenantID, hourLimit) {
+		if dayLimit > 0 {
+			pt.tenantsStreams[sid.tenantID] = n
+		}
+		return tenantLimitReasonNewStreamsPerHour, false
+	}
+
+	pt.idb.mustRegisterStream(sid, streamTagsCanonical)
+	pt.putStreamIDToCache(sid)
+	if dayLimit > 0 {
+		pt.tenantsStreams[sid.tenantID] = n + 1
+	}
+	return "", true
+}
+
+// tryRegisterNewStreamForCurrentHour returns false if a new stream for the given tenantID exceeds the given limit on new streams for the current hour.
+func (s *Storage) tryRegisterNewStreamForCurrentHour(tenantID TenantID, limit int64) bool {
+	if limit <= 0 {
+		return true
+	}
+
+	hour := time.Now().Unix() / 3600
+
+	s.newStreamsPerHourLock.Lock()
+	defer s.newStreamsPerHourLock.Unlock()
+
+	if hour != s.newStreamsHour || s.newStreamsPerHour == nil {
+		s.newStreamsHour = hour
+		s.newStreamsPerHour = make(map[TenantID]uint64)
+	}
+	n := s.newStreamsPerHour[tenantID]
+	if n >= uint64(limit) {
+		return false
+	}
+	s.newStreamsPerHour[tenantID] = n + 1
+	return true
+}
+
+// getRowsOverStoredBytesLimit returns reasons for rejecting the rows at lr for tenants exceeding StorageConfig.MaxStoredBytesPerTenant.
+//
+// nil is returned if all the rows at lr can be stored.
+func (s *Storage) getRowsOverStoredBytesLimit(lr *LogRows) []string {
+	if s.maxStoredBytesPerTenant.IsEmpty() {
+		return nil
+	}
+
+	var rejectReasons []string
+	var tenantIDLast TenantID
+	isExceededLast := false
+	for i := range lr.streamIDs {
+		tenantID := lr.streamIDs[i].tenantID
+		if i == 0 || !tenantID.equal(&tenantIDLast) {
+			tenantIDLast = tenantID
+			isExceededLast = s.isTenantStoredBytesLimitExceeded(tenantID)
+		}
+		if !isExceededLast {
+			continue
+		}
+		if rejectReasons == nil {
+			rejectReasons = make([]string, len(lr.streamIDs))
+		}
+		rejectReasons[i] = tenantLimitReasonStoredBytes
+	}
+	return rejectReasons
+}
+
+// filterRejectedRows returns LogRows without rows with non-empty rejectReasons.
+//
+// Rows with non-empty fallbackReasons are moved to the fallback stream for the corresponding tenant.
+// See getFallbackStreamTagsCanonical for details. fallbackReasons may be nil.
+//
+// The returned LogRows must be passed to PutLogRows when no longer needed.
+func (pt *partition) filterRejectedRows(lr *LogRows, rejectReasons, fallbackReasons []string) *LogRows {
+	type tenantReason struct {
+		tenantID TenantID
+		reason   string
+	}
+	dropped := make(map[tenantReason]int)
+	movedToFallback := make(map[tenantReason]int)
+
+	var fields []Field
+	lrNew := GetLogRows(nil, nil, nil, nil, "")
+	for i, ts := range lr.timestamps {
+		sid := lr.streamIDs[i]
+		if rejectReasons != nil && rejectReasons[i] != "" {
+			dropped[tenantReason{
+				tenantID: sid.tenantID,
+				reason:   rejectReasons[i],
+			}]++
+			continue
+		}
+		if fallbackReasons != nil && fallbackReasons[i] != "" {
+			movedToFallback[tenantReason{
+				tenantID: sid.tenantID,
+				reason:   fallbackReasons[i],
+			}]++
+
+			// Preserve the original stream at the log entry, so it could be investigated later.
+			fields = append(fields[:0], lr.rows[i]...)
+			fields = append(fields, Field{
+				Name:  fallbackStreamOriginalStreamField,
+				Value: getStreamTagsString(lr.streamTagsCanonicals[i]),
+			})
+			fallbackSID := pt.mustRegisterFallbackStream(sid.tenantID)
+			lrNew.mustAddInternal(fallbackSID, ts, fields, getFallbackStreamTagsCanonical())
+			continue
+		}
+		lrNew.mustAddInternal(sid, ts, lr.rows[i], lr.streamTagsCanonicals[i])
+	}
+
+	for tr, n := range dropped {
+		GetTenantRejectedRowsCounter(tr.tenantID, tr.reason).Add(n)
+		tenantLimitsLogger.Warnf("partition %s: dropping %d log entries for the tenant %d:%d, since it exceeds the limit on %s; "+
+			"see https://docs.victoriametrics.com/victorialogs/#tenant-limits", pt.name, n, tr.tenantID.AccountID, tr.tenantID.ProjectID, tr.reason)
+	}
+	for tr, n := range movedToFallback {
+		getTenantFallbackRowsCounter(tr.tenantID, tr.reason).Add(n)
+		tenantLimitsLogger.Warnf("partition %s: moving %d log entries for the tenant %d:%d to the fallback stream %s, since they exceed the limit on %s; "+
+			"see https://docs.victoriametrics.com/victorialogs/#stream-cardinality-limits", pt.name, n, tr.tenantID.AccountID, tr.tenantID.ProjectID,
+			getStreamTagsString(getFallbackStreamTagsCanonical()), tr.reason)
+	}
+	return lrNew
+}
+
+// mustRegisterFallbackStream registers the fallback stream for the given tenantID at pt and returns its streamID.
+//
+// The fallback stream isn't limited by StorageConfig.MaxNewStreamsPerDayPerTenant and StorageConfig.MaxNewStreamsPerHourPerTenant.
+func (pt *partition) mustRegisterFallbackStream(tenantID TenantID) streamID {
+	streamTagsCanonical := getFallbackStreamTagsCanonical()
+	sid := streamID{
+		tenantID: tenantID,
+		id:       hash128(bytesutil.ToUnsafeBytes(streamTagsCanonical)),
+	}
+	if pt.hasStreamIDInCache(&sid) {
+		return sid
+	}
+	if !pt.idb.hasStreamID(&sid) {
+		pt.idb.mustRegisterStream(&sid, streamTagsCanonical)
+	}
+	pt.putStreamIDToCache(&sid)
+	return sid
+}
+
+const (
+	// fallbackStreamField is the name of the stream field for the fallback stream.
+	fallbackStreamField = "stream_limit_exceeded"
+
+	// fallbackStreamOriginalStreamField is the name of the field with the original stream for log entries moved to the fallback stream.
+	fallbackStreamOriginalStreamField = "original_stream"
+)
+
+var fallbackStreamTagsCanonical = func() string {
+	st := GetStreamTags()
+	st.Add(fallbackStreamField, "true")
+	s := string(st.MarshalCanonical(nil))
+	PutStreamTags(st)
+	return s
+}()
+
+// getFallbackStreamTagsCanonical returns canonical stream tags for the stream, which receives log entries exceeding the limits on new streams
+// if StorageConfig.StreamsLimitFallback is set.
+func getFallbackStreamTagsCanonical() string {
+	return fallbackStreamTagsCanonical
+}
+
+var tenantLimitsLogger = logger.WithThrottler("tenant_limits", 5*time.Second)
+
+const (
+	tenantLimitReasonStoredBytes       = "stored_bytes"
+	tenantLimitReasonNewStreamsPerDay  = "new_streams_per_day"
+	tenantLimitReasonNewStreamsPerHour = "new_streams_per_hour"
+)
+
+// GetTenantRejectedRowsCounter returns a counter for log entries of the given tenantID rejected because of the tenant limit with the given reason.
+func GetTenantRejectedRowsCounter(tenantID TenantID, reason string) *metrics.Counter {
+	s := fmt.Sprintf(`vl_tenant_rejected_rows_total{accountID="%d",projectID="%d",reason=%q}`, tenantID.AccountID, tenantID.ProjectID, reason)
+	return metrics.GetOrCreateCounter(s)
+}
+
+func getTenantFallbackRowsCounter(tenantID TenantID, reason string) *metrics.Counter {
+	s := fmt.Sprintf(`vl_tenant_fallback_rows_total{accountID="%d",projectID="%d",reason=%q}`, tenantID.AccountID, tenantID.ProjectID, reason)
+	return metrics.GetOrCreateCounter(s)
+}
+
+// GetTenantRejectedRequestsCounter returns a counter for data ingestion requests of the given tenantID rejected because of the tenant limit with the given reason.
+func GetTenantRejectedRequestsCounter(tenantID TenantID, reason string) *metrics.Counter {
+	s := fmt.Sprintf(`vl_tenant_rejected_requests_total{accountID="%d",projectID="%d",reason=%q}`, tenantID.AccountID, tenantID.ProjectID, reason)
+	return metrics.GetOrCreateCounter(s)
+}
+
+// maxStreamsLimitOffenders is the maximum number of distinct (tenant, stream fields) pairs tracked by Storage.registerStreamsLimitOffender.
+const maxStreamsLimitOffenders = 1000
+
+// streamsLimitOffenderKey identifies the set of stream fields for the tenant, which exceeds the limits on new streams.
+type streamsLimitOffenderKey struct {
+	tenantID     TenantID
+	streamFields string
+}
+
+// StreamsLimitOffender contains the number of new streams rejected for the given set of stream fields for the given tenant.
+type StreamsLimitOffender struct {
+	// TenantID is the tenant, which exceeds the limits on new streams.
+	TenantID TenantID
+
+	// StreamFields contains comma-separated names of the stream fields for the rejected streams.
+	StreamFields string
+
+	// RejectedStreams is the number of rejected new streams with the StreamFields.
+	RejectedStreams uint64
+}
+
+// registerStreamsLimitOffender registers a new stream with the given streamTagsCanonical for the given tenantID,
+// which was rejected because of the limits on new streams.
+func (s *Storage) registerStreamsLimitOffender(tenantID TenantID, streamTagsCanonical string) {
+	st := GetStreamTags()
+	mustUnmarshalStreamTags(st, streamTagsCanonical)
+	var b []byte
+	for i := range st.tags {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, st.tags[i].Name...)
+	}
+	PutStreamTags(st)
+
+	k := streamsLimitOffenderKey{
+		tenantID:     tenantID,
+		streamFields: string(b),
+	}
+
+	s.streamsLimitOffendersLock.Lock()
+	defer s.streamsLimitOffendersLock.Unlock()
+
+	if s.streamsLimitOffenders == nil {
+		s.streamsLimitOffenders = make(map[streamsLimitOffenderKey]uint64)
+	}
+	if _, ok := s.streamsLimitOffenders[k]; !ok && len(s.streamsLimitOffenders) >= maxStreamsLimitOffenders {
+		// Do not track new offenders in order to limit memory usage.
+		return
+	}
+	s.streamsLimitOffenders[k]++
+}
+
+// GetTopStreamsLimitOffenders returns up to n sets of stream fields with the biggest number of rejected new streams
+// because of StorageConfig.MaxNewStreamsPerDayPerTenant and StorageConfig.MaxNewStreamsPerHourPerTenant.
+func (s *Storage) GetTopStreamsLimitOffenders(n int) []StreamsLimitOffender {
+	s.streamsLimitOffendersLock.Lock()
+	offenders := make([]StreamsLimitOffender, 0, len(s.streamsLimitOffenders))
+	for k, v := range s.streamsLimitOffenders {
+		offenders = append(offenders, StreamsLimitOffender{
+			TenantID:        k.tenantID,
+			StreamFields:    k.streamFields,
+			RejectedStreams: v,
+		})
+	}
+	s.streamsLimitOffendersLock.Unlock()
+
+	sort.Slice(offenders, func(i, j int) bool {
+		a, b := &offenders[i], &offenders[j]
+		if a.RejectedStreams != b.RejectedStreams {
+			return a.RejectedStreams > b.RejectedStreams
+		}
+		if !a.TenantID.equal(&b.TenantID) {
+			return a.TenantID.less(&b.TenantID)
+		}
+		return a.StreamFields < b.StreamFields
+	})
+	if len(offenders) > n {
+		offenders = offenders[:n]
+	}
+	return offenders
+}
@@ -0,0 +1,222 @@
+package logstorage
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+func TestStorageTenantLimits(t *testing.T) {
+	t.Parallel()
+
+	path := t.Name()
+
+	tenantLimited := TenantID{AccountID: 12, ProjectID: 34}
+	tenantOther := TenantID{AccountID: 5, ProjectID: 6}
+
+	newLogRows := func(tenantID TenantID, streams, rowsPerStream int) *LogRows {
+		lr := GetLogRows([]string{"app"}, nil, nil, nil, "")
+		timestamp := time.Now().UnixNano()
+		for i := 0; i < streams; i++ {
+			for j := 0; j < rowsPerStream; j++ {
+				fields := []Field{
+					{
+						Name:  "app",
+						Value: fmt.Sprintf("app-%d", i),
+					},
+					{
+						Name:  "_msg",
+						Value: fmt.Sprintf("message %d", j),
+					},
+				}
+				lr.MustAdd(tenantID, timestamp, fields, nil)
+			}
+		}
+		return lr
+	}
+	addRows := func(s *Storage, tenantID TenantID, streams, rowsPerStream int) {
+		lr := newLogRows(tenantID, streams, rowsPerStream)
+		s.MustAddRows(lr)
+		PutLogRows(lr)
+		s.DebugFlush()
+	}
+	checkRowsCount := func(s *Storage, tenantID TenantID, rowsExpected uint64) {
+		t.Helper()
+
+		var rows uint64
+		if ts := s.GetTenantsStats()[tenantID]; ts != nil {
+			rows = ts.RowsCount
+		}
+		if rows != rowsExpected {
+			t.Fatalf("unexpected number of rows for tenant %d:%d; got %d; want %d", tenantID.AccountID, tenantID.ProjectID, rows, rowsExpected)
+		}
+	}
+
+	// Verify the limit on new streams per day
+	cfg := &StorageConfig{
+		MaxNewStreamsPerDayPerTenant: &TenantLimits{
+			PerTenant: map[TenantID]int64{
+				tenantLimited: 3,
+			},
+		},
+	}
+	s := MustOpenStorage(path, cfg)
+	addRows(s, tenantLimited, 5, 2)
+	addRows(s, tenantOther, 5, 2)
+	checkRowsCount(s, tenantLimited, 6)
+	checkRowsCount(s, tenantOther, 10)
+	s.MustClose()
+
+	// Verify that the limit on new streams is preserved after the restart,
+	// while the rows for already registered streams are accepted.
+	s = MustOpenStorage(path, cfg)
+	addRows(s, tenantLimited, 5, 1)
+	checkRowsCount(s, tenantLimited, 9)
+	s.MustClose()
+
+	// Verify the limit on the stored bytes
+	cfg = &StorageConfig{
+		MaxStoredBytesPerTenant: &TenantLimits{
+			PerTenant: map[TenantID]int64{
+				tenantLimited: 1,
+			},
+		},
+	}
+	s = MustOpenStorage(path, cfg)
+	if err := s.CanWriteTenantData(tenantLimited); err == nil {
+		t.Fatalf("expecting non-nil error for the tenant exceeding the limit on the stored bytes")
+	}
+	if err := s.CanWriteTenantData(tenantOther); err != nil {
+		t.Fatalf("unexpected error for the tenant without limits: %s", err)
+	}
+	addRows(s, tenantLimited, 1, 10)
+	addRows(s, tenantOther, 1, 10)
+	checkRowsCount(s, tenantLimited, 9)
+	checkRowsCount(s, tenantOther, 20)
+	s.MustClose()
+
+	// Verify the limit on new streams per hour
+	tenantHourly := TenantID{AccountID: 1, ProjectID: 2}
+	cfg = &StorageConfig{
+		MaxNewStreamsPerHourPerTenant: &TenantLimits{
+			PerTenant: map[TenantID]int64{
+				tenantHourly: 2,
+			},
+		},
+	}
+	s = MustOpenStorage(path, cfg)
+	addRows(s, tenantHourly, 5, 2)
+	checkRowsCount(s, tenantHourly, 4)
+	offenders := s.GetTopStreamsLimitOffenders(10)
+	offendersExpected := []StreamsLimitOffender{
+		{
+			TenantID:        tenantHourly,
+			StreamFields:    "app",
+			RejectedStreams: 3,
+		},
+	}
+	if !reflect.DeepEqual(offenders, offendersExpected) {
+		t.Fatalf("unexpected streams limit offenders\ngot\n%v\nwant\n%v", offenders, offendersExpected)
+	}
+	s.MustClose()
+
+	// Verify that rows for new streams exceeding the limit are moved to the fallback stream
+	tenantFallback := TenantID{AccountID: 3, ProjectID: 4}
+	cfg = &StorageConfig{
+		MaxNewStreamsPerDayPerTenant: &TenantLimits{
+			PerTenant: map[TenantID]int64{
+				tenantFallback: 2,
+			},
+		},
+		StreamsLimitFallback: true,
+	}
+	s = MustOpenStorage(path, cfg)
+	addRows(s, tenantFallback, 5, 2)
+	checkRowsCount(s, tenantFallback, 10)
+	for _, tu := range s.GetTenantsUsage("") {
+		if tu.AccountID != tenantFallback.AccountID || tu.ProjectID != tenantFallback.ProjectID {
+			continue
+		}
+		streams := uint64(0)
+		for _, tpu := range tu.Partitions {
+			streams += tpu.StreamsCount
+		}
+		// Two registered streams plus the fallback stream
+		if streams != 3 {
+			t.Fatalf("unexpected number of streams for the tenant with fallback stream; got %d; want 3", streams)
+		}
+	}
+	s.MustClose()
+
+	fs.MustRemoveDir(path)
+}
+
+func TestStorageTenantLimitsConcurrentNewStreams(t *testing.T) {
+	t.Parallel()
+
+	path := t.Name()
+
+	const streamsLimit = 15
+	const workers = 8
+	const streamsPerWorker = 10
+
+	tenantID := TenantID{AccountID: 12, ProjectID: 34}
+	cfg := &StorageConfig{
+		MaxNewStreamsPerDayPerTenant: &TenantLimits{
+			PerTenant: map[TenantID]int64{
+				tenantID: streamsLimit,
+			},
+		},
+	}
+	s := MustOpenStorage(path, cfg)
+
+	// Add rows for distinct new streams and for the same new stream from concurrent goroutines.
+	timestamp := time.Now().UnixNano()
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(workerID int) {
+			defer wg.Done()
+
+			lr := GetLogRows([]string{"app"}, nil, nil, nil, "")
+			lr.MustAdd(tenantID, timestamp, []Field{{Name: "app", Value: "shared"}, {Name: "_msg", Value: "foo"}}, nil)
+			for j := 0; j < streamsPerWorker; j++ {
+				fields := []Field{
+					{
+						Name:  "app",
+						Value: fmt.Sprintf("app-%d-%d", workerID, j),
+					},
+					{
+						Name:  "_msg",
+						Value: "foo",
+					},
+				}
+				lr.MustAdd(tenantID, timestamp, fields, nil)
+			}
+			s.MustAddRows(lr)
+			PutLogRows(lr)
+		}(i)
+	}
+	wg.Wait()
+	s.DebugFlush()
+
+	var streams uint64
+	for _, tu := range s.GetTenantsUsage("") {
+		if tu.AccountID != tenantID.AccountID || tu.ProjectID != tenantID.ProjectID {
+			continue
+		}
+		for _, tpu := range tu.Partitions {
+			streams += tpu.StreamsCount
+		}
+	}
+	if streams != streamsLimit {
+		t.Fatalf("unexpected number of registered streams; got %d; want %d", streams, streamsLimit)
+	}
+
+	s.MustClose()
+	fs.MustRemoveDir(path)
+}
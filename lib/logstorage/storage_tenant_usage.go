@@ -0,0 +1,287 @@
+package logstorage
+
+import (
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// TenantIngestedStats contains stats for the logs ingested for a single tenant.
+type TenantIngestedStats struct {
+	// BytesCount is the uncompressed size of the ingested logs for the tenant.
+	BytesCount uint64
+
+	// RowsCount is the number of the ingested log entries for the tenant.
+	RowsCount uint64
+}
+
+// TenantUsage contains usage stats for a single tenant.
+//
+// See https://docs.victoriametrics.com/victorialogs/#tenant-usage
+type TenantUsage struct {
+	AccountID uint32 `json:"accountID"`
+	ProjectID uint32 `json:"projectID"`
+
+	// IngestedBytes is the uncompressed size of the logs ingested for the tenant since the storage start.
+	IngestedBytes uint64 `json:"ingestedBytes"`
+
+	// IngestedRows is the number of log entries ingested for the tenant since the storage start.
+	IngestedRows uint64 `json:"ingestedRows"`
+
+	// StoredCompressedBytes is the size of the stored logs for the tenant on disk.
+	StoredCompressedBytes uint64 `json:"storedCompressedBytes"`
+
+	// StoredUncompressedBytes is the original size of the stored logs for the tenant.
+	StoredUncompressedBytes uint64 `json:"storedUncompressedBytes"`
+
+	// StoredRows is the number of the stored log entries for the tenant.
+	StoredRows uint64 `json:"storedRows"`
+
+	// Partitions contains per-partition usage stats for the tenant sorted by partition name.
+	Partitions []TenantPartitionUsage `json:"partitions"`
+}
+
+// TenantPartitionUsage contains usage stats for a single tenant at a single per-day partition.
+type TenantPartitionUsage struct {
+	// Name is the partition name in the form YYYYMMDD.
+	Name string `json:"name"`
+
+	// StoredCompressedBytes is the size of the stored logs for the tenant at the partition on disk.
+	StoredCompressedBytes uint64 `json:"storedCompressedBytes"`
+
+	// StoredUncompressedBytes is the original size of the stored logs for the tenant at the partition.
+	StoredUncompressedBytes uint64 `json:"storedUncompressedBytes"`
+
+	// StoredRows is the number of the stored log entries for the tenant at the partition.
+	StoredRows uint64 `json:"storedRows"`
+
+	// StreamsCount is the number of log streams for the tenant at the partition.
+	StreamsCount uint64 `json:"streamsCount"`
+}
+
+// tenantIngestedCounters contains counters for the logs ingested for a single tenant.
+type tenantIngestedCounters struct {
+	bytesCount atomic.Uint64
+	rowsCount  atomic.Uint64
+}
+
+func (s *Storage) getTenantIngestedCounters(tenantID TenantID) *tenantIngestedCounters {
+	if v, ok := s.tenantsIngested.Load(tenantID); ok {
+		return v.(*tenantIngestedCounters)
+	}
+	v, _ := s.tenantsIngested.LoadOrStore(tenantID, &tenantIngestedCounters{})
+	return v.(*tenantIngestedCounters)
+}
+
+func (s *Storage) updateTenantsIngestedStats(lr *LogRows) {
+	if len(lr.timestamps) == 0 {
+		return
+	}
+
+	// Accumulate stats for consecutive rows of the same tenant locally in order to reduce the number of atomic operations
+	// on the shared per-tenant counters. Rows for the same tenant are usually grouped together in lr.
+	var tic *tenantIngestedCounters
+	var tenantID TenantID
+	var bytesCount, rowsCount uint64
+	flush := func() {
+		if rowsCount > 0 {
+			tic.bytesCount.Add(bytesCount)
+			tic.rowsCount.Add(rowsCount)
+		}
+	}
+	for i := range lr.timestamps {
+		if tic == nil || lr.streamIDs[i].tenantID != tenantID {
+			flush()
+			tenantID = lr.streamIDs[i].tenantID
+			tic = s.getTenantIngestedCounters(tenantID)
+			bytesCount = 0
+			rowsCount = 0
+		}
+		bytesCount += uint64(EstimatedJSONRowLen(lr.rows[i]))
+		rowsCount++
+	}
+	flush()
+}
+
+// GetTenantsIngestedStats returns per-tenant stats for the logs ingested into s since its start.
+func (s *Storage) GetTenantsIngestedStats() map[TenantID]TenantIngestedStats {
+	m := make(map[TenantID]TenantIngestedStats)
+	s.tenantsIngested.Range(func(k, v any) bool {
+		tic := v.(*tenantIngestedCounters)
+		m[k.(TenantID)] = TenantIngestedStats{
+			BytesCount: tic.bytesCount.Load(),
+			RowsCount:  tic.rowsCount.Load(),
+		}
+		return true
+	})
+	return m
+}
+
+// GetTenantsUsage returns usage stats per each tenant at s sorted by tenant.
+//
+// Only partitions with names starting with partitionNamePrefix are taken into account for the stored logs stats.
+//
+// Only parts created by VictoriaLogs versions, which support per-tenant stats, are taken into account for the stored logs stats.
+func (s *Storage) GetTenantsUsage(partitionNamePrefix string) []*TenantUsage {
+	s.partitionsLock.Lock()
+	ptws := make([]*partitionWrapper, 0, len(s.partitions))
+	for _, ptw := range s.partitions {
+		if strings.HasPrefix(ptw.pt.name, partitionNamePrefix) {
+			ptw.incRef()
+			ptws = append(ptws, ptw)
+		}
+	}
+	s.partitionsLock.Unlock()
+
+	m := make(map[TenantID]*TenantUsage)
+	getTenantUsage := func(tenantID TenantID) *TenantUsage {
+		tu := m[tenantID]
+		if tu == nil {
+			tu = &TenantUsage{
+				AccountID: tenantID.AccountID,
+				ProjectID: tenantID.ProjectID,
+			}
+			m[tenantID] = tu
+		}
+		return tu
+	}
+
+	for tenantID, tis := range s.GetTenantsIngestedStats() {
+		tu := getTenantUsage(tenantID)
+		tu.IngestedBytes = tis.BytesCount
+		tu.IngestedRows = tis.RowsCount
+	}
+
+	for _, ptw := range ptws {
+		pt := ptw.pt
+
+		tss := make(map[TenantID]*TenantStats)
+		pt.ddb.updateTenantsStats(tss)
+
+		streamsCounts := make(map[TenantID]uint64)
+		pt.idb.updateStreamsCountPerTenant(streamsCounts)
+
+		ptw.decRef()
+
+		tenantIDs := make(map[TenantID]struct{}, len(tss))
+		for tenantID := range tss {
+			tenantIDs[tenantID] = struct{}{}
+		}
+		for tenantID := range streamsCounts {
+			tenantIDs[tenantID] = struct{}{}
+		}
+
+		for tenantID := range tenantIDs {
+			tpu := TenantPartitionUsage{
+				Name:         pt.name,
+				StreamsCount: streamsCounts[tenantID],
+			}
+			if ts := tss[tenantID]; ts != nil {
+				tpu.StoredCompressedBytes = ts.CompressedSizeBytes
+				tpu.StoredUncompressedBytes = ts.UncompressedSizeBytes
+				tpu.StoredRows = ts.RowsCount
+			}
+
+			tu := getTenantUsage(tenantID)
+			tu.StoredCompressedBytes += tpu.StoredCompressedBytes
+			tu.StoredUncompressedBytes += tpu.StoredUncompressedBytes
+			tu.StoredRows += tpu.StoredRows
+			tu.Partitions = append(tu.Partitions, tpu)
+		}
+	}
+
+	return sortTenantsUsage(m)
+}
+
+// MergeTenantsUsage merges tenants usage stats obtained from multiple storage nodes.
+//
+// Every log entry is stored at replicationFactor storage nodes, so the merged stats are divided by replicationFactor
+// in order to return the stats for the original logs.
+// Note that StreamsCount is the sum of per-node streams counts divided by replicationFactor,
+// so log streams spread across multiple storage nodes (for example, after storage node failover) are counted multiple times.
+//
+// The returned stats are sorted by tenant.
+func MergeTenantsUsage(tus [][]*TenantUsage, replicationFactor int) []*TenantUsage {
+	m := make(map[TenantID]*TenantUsage)
+	for _, a := range tus {
+		for _, tu := range a {
+			tenantID := TenantID{
+				AccountID: tu.AccountID,
+				ProjectID: tu.ProjectID,
+			}
+			dst := m[tenantID]
+			if dst == nil {
+				dst = &TenantUsage{
+					AccountID: tu.AccountID,
+					ProjectID: tu.ProjectID,
+				}
+				m[tenantID] = dst
+			}
+			dst.IngestedBytes += tu.IngestedBytes
+			dst.IngestedRows += tu.IngestedRows
+			dst.StoredCompressedBytes += tu.StoredCompressedBytes
+			dst.StoredUncompressedBytes += tu.StoredUncompressedBytes
+			dst.StoredRows += tu.StoredRows
+			dst.Partitions = mergeTenantPartitionsUsage(dst.Partitions, tu.Partitions)
+		}
+	}
+	if replicationFactor > 1 {
+		rf := uint64(replicationFactor)
+		for _, tu := range m {
+			tu.IngestedBytes /= rf
+			tu.IngestedRows /= rf
+			tu.StoredCompressedBytes /= rf
+			tu.StoredUncompressedBytes /= rf
+			tu.StoredRows /= rf
+			for i := range tu.Partitions {
+				tpu := &tu.Partitions[i]
+				tpu.StoredCompressedBytes /= rf
+				tpu.StoredUncompressedBytes /= rf
+				tpu.StoredRows /= rf
+				tpu.StreamsCount /= rf
+			}
+		}
+	}
+	return sortTenantsUsage(m)
+}
+
+func mergeTenantPartitionsUsage(dst, src []TenantPartitionUsage) []TenantPartitionUsage {
+	for _, tpu := range src {
+		n := sort.Search(len(dst), func(i int) bool {
+			return dst[i].Name >= tpu.Name
+		})
+		if n < len(dst) && dst[n].Name == tpu.Name {
+			dst[n].StoredCompressedBytes += tpu.StoredCompressedBytes
+			dst[n].StoredUncompressedBytes += tpu.StoredUncompressedBytes
+			dst[n].StoredRows += tpu.StoredRows
+			dst[n].StreamsCount += tpu.StreamsCount
+			continue
+		}
+		dst = append(dst, TenantPartitionUsage{})
+		copy(dst[n+1:], dst[n:])
+		dst[n] = tpu
+	}
+	return dst
+}
+
+func sortTenantsUsage(m map[TenantID]*TenantUsage) []*TenantUsage {
+	tus := make([]*TenantUsage, 0, len(m))
+	for _, tu := range m {
+		if tu.Partitions == nil {
+			// This is needed in order to return `[]` instead of `null` to the client.
+			tu.Partitions = []TenantPartitionUsage{}
+		}
+		sort.Slice(tu.Partitions, func(i, j int) bool {
+			return tu.Partitions[i].Name < tu.Partitions[j].Name
+		})
+		tus = append(tus, tu)
+	}
+	sort.Slice(tus, func(i, j int) bool {
+		a, b := tus[i], tus[j]
+		if a.AccountID != b.AccountID {
+			return a.AccountID < b.AccountID
+		}
+		return a.ProjectID < b.ProjectID
+	})
+	return tus
+}
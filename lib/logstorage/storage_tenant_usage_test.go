@@ -0,0 +1,101 @@
+package logstorage
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+func TestStorageGetTenantsUsage(t *testing.T) {
+	t.Parallel()
+
+	path := t.Name()
+
+	cfg := &StorageConfig{
+		Retention: 10 * 24 * time.Hour,
+	}
+	s := MustOpenStorage(path, cfg)
+
+	tenant1 := TenantID{AccountID: 1, ProjectID: 2}
+	tenant2 := TenantID{AccountID: 3, ProjectID: 4}
+	now := time.Now().UnixNano()
+
+	lr := GetLogRows([]string{"app"}, nil, nil, nil, "")
+	addRows := func(tenantID TenantID, timestamp int64, streams, rowsPerStream int) {
+		for i := 0; i < streams; i++ {
+			for j := 0; j < rowsPerStream; j++ {
+				fields := []Field{
+					{
+						Name:  "app",
+						Value: fmt.Sprintf("app-%d", i),
+					},
+					{
+						Name:  "_msg",
+						Value: fmt.Sprintf("message %d", j),
+					},
+				}
+				lr.MustAdd(tenantID, timestamp, fields, nil)
+			}
+		}
+	}
+	addRows(tenant1, now, 2, 3)
+	addRows(tenant1, now-nsecsPerDay, 1, 4)
+	addRows(tenant2, now, 3, 1)
+	s.MustAddRows(lr)
+	PutLogRows(lr)
+	s.DebugFlush()
+
+	tus := s.GetTenantsUsage("")
+	if len(tus) != 2 {
+		t.Fatalf("unexpected number of tenants; got %d; want 2", len(tus))
+	}
+
+	checkTenantUsage := func(tu *TenantUsage, tenantIDExpected TenantID, ingestedRowsExpected, storedRowsExpected uint64, partitionStreamsExpected []uint64) {
+		t.Helper()
+
+		if tu.AccountID != tenantIDExpected.AccountID || tu.ProjectID != tenantIDExpected.ProjectID {
+			t.Fatalf("unexpected tenant; got %d:%d; want %d:%d", tu.AccountID, tu.ProjectID, tenantIDExpected.AccountID, tenantIDExpected.ProjectID)
+		}
+		if tu.IngestedRows != ingestedRowsExpected {
+			t.Fatalf("unexpected number of ingested rows; got %d; want %d", tu.IngestedRows, ingestedRowsExpected)
+		}
+		if tu.StoredRows != storedRowsExpected {
+			t.Fatalf("unexpected number of stored rows; got %d; want %d", tu.StoredRows, storedRowsExpected)
+		}
+		if tu.IngestedBytes == 0 || tu.StoredCompressedBytes == 0 || tu.StoredUncompressedBytes == 0 {
+			t.Fatalf("unexpected zero size at tenant usage: %+v", tu)
+		}
+		var partitionStreams []uint64
+		for _, tpu := range tu.Partitions {
+			partitionStreams = append(partitionStreams, tpu.StreamsCount)
+		}
+		if !reflect.DeepEqual(partitionStreams, partitionStreamsExpected) {
+			t.Fatalf("unexpected number of streams per partition; got %d; want %d", partitionStreams, partitionStreamsExpected)
+		}
+	}
+	checkTenantUsage(tus[0], tenant1, 10, 10, []uint64{1, 2})
+	checkTenantUsage(tus[1], tenant2, 3, 3, []uint64{3})
+
+	// Verify filtering by partition name prefix
+	todayPartitionName := tus[0].Partitions[1].Name
+	tusToday := s.GetTenantsUsage(todayPartitionName)
+	if len(tusToday[0].Partitions) != 1 || tusToday[0].StoredRows != 6 {
+		t.Fatalf("unexpected tenant usage for partition %s: %+v", todayPartitionName, tusToday[0])
+	}
+
+	// Verify merging the usage from multiple storage nodes
+	tusMerged := MergeTenantsUsage([][]*TenantUsage{s.GetTenantsUsage(""), s.GetTenantsUsage(todayPartitionName)}, 1)
+	checkTenantUsage(tusMerged[0], tenant1, 20, 16, []uint64{1, 4})
+	checkTenantUsage(tusMerged[1], tenant2, 6, 6, []uint64{6})
+
+	// Verify merging the usage from storage nodes with replicated data
+	tusReplicated := MergeTenantsUsage([][]*TenantUsage{s.GetTenantsUsage(""), s.GetTenantsUsage("")}, 2)
+	checkTenantUsage(tusReplicated[0], tenant1, 10, 10, []uint64{1, 2})
+	checkTenantUsage(tusReplicated[1], tenant2, 3, 3, []uint64{3})
+
+	s.MustClose()
+	fs.MustRemoveDir(path)
+}
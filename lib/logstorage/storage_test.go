@@ -1,6 +1,7 @@
 package logstorage
 
 import (
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -106,3 +107,91 @@ func TestStorageMustAddRows(t *testing.T) {
 
 	fs.MustRemoveDir(path)
 }
+
+func TestStorageMoveColdPartitions(t *testing.T) {
+	t.Parallel()
+
+	path := t.Name()
+	coldPath := t.Name() + "-cold"
+
+	cfg := &StorageConfig{
+		Retention: 365 * 24 * time.Hour,
+	}
+	s := MustOpenStorage(path, cfg)
+
+	// Write logs to the last 6 days
+	lr := newTestLogRows(3, 6, 0)
+	now := time.Now().UTC().UnixNano()
+	for i := range lr.timestamps {
+		lr.timestamps[i] = now - int64(i%6)*nsecsPerDay
+	}
+	totalRowsCount := uint64(len(lr.timestamps))
+	s.MustAddRows(lr)
+	s.DebugFlush()
+	s.MustClose()
+
+	// Re-open the storage with the cold path and wait until the partitions older than 2 days are moved there
+	cfg.ColdPath = coldPath
+	cfg.ColdAfter = 2 * 24 * time.Hour
+	s = MustOpenStorage(path, cfg)
+
+	var sStats StorageStats
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		sStats.Reset()
+		s.UpdateStats(&sStats)
+		if sStats.ColdPartitionsCount == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for moving partitions to cold path; got %d cold partitions; want 3", sStats.ColdPartitionsCount)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if sStats.PartitionsCount != 6 {
+		t.Fatalf("unexpected number of partitions; got %d; want 6", sStats.PartitionsCount)
+	}
+	if sStats.PartitionsMovedToColdTotal != 3 {
+		t.Fatalf("unexpected number of moved partitions; got %d; want 3", sStats.PartitionsMovedToColdTotal)
+	}
+	if n := sStats.RowsCount(); n != totalRowsCount {
+		t.Fatalf("unexpected number of entries in storage; got %d; want %d", n, totalRowsCount)
+	}
+
+	// Write logs into the moved partition
+	lr = newTestLogRows(1, 1, 0)
+	lr.timestamps[0] = now - 5*nsecsPerDay
+	totalRowsCount++
+	s.MustAddRows(lr)
+	s.DebugFlush()
+	s.MustClose()
+
+	// Verify the partitions layout
+	for i := int64(0); i < 6; i++ {
+		name := getPartitionNameFromDay(now/nsecsPerDay - i)
+		hotPartitionPath := filepath.Join(path, partitionsDirname, name)
+		coldPartitionPath := filepath.Join(coldPath, partitionsDirname, name)
+		isCold := i >= 3
+		if fs.IsPathExist(hotPartitionPath) == isCold {
+			t.Fatalf("unexpected existence of %q; got %v; want %v", hotPartitionPath, !isCold, isCold)
+		}
+		if fs.IsPathExist(coldPartitionPath) != isCold {
+			t.Fatalf("unexpected existence of %q; got %v; want %v", coldPartitionPath, !isCold, isCold)
+		}
+	}
+
+	// Make sure the data is available after re-opening the storage
+	s = MustOpenStorage(path, cfg)
+	sStats.Reset()
+	s.UpdateStats(&sStats)
+	if sStats.PartitionsCount != 6 {
+		t.Fatalf("unexpected number of partitions; got %d; want 6", sStats.PartitionsCount)
+	}
+	if n := sStats.RowsCount(); n != totalRowsCount {
+		t.Fatalf("unexpected number of entries in storage; got %d; want %d", n, totalRowsCount)
+	}
+	s.MustClose()
+
+	fs.MustRemoveDir(path)
+	fs.MustRemoveDir(coldPath)
+}
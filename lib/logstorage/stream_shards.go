@@ -0,0 +1,143 @@
+package logstorage
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// StreamShardsCount is the number of shards log streams are split into when they are replicated among storage nodes.
+//
+// It doesn't depend on the number of storage nodes, so adding or removing a storage node moves only the shards,
+// which are placed at this node. See StreamShardsPlacement.
+const StreamShardsCount = 256
+
+// GetStreamShard returns the shard in the range [0..StreamShardsCount) for the log stream with the given streamHash.
+func GetStreamShard(streamHash uint64) uint64 {
+	return streamHash % StreamShardsCount
+}
+
+// StreamShardsPlacement contains storage nodes for every shard out of StreamShardsCount log stream shards.
+//
+// Shards are placed at storage nodes with rendezvous hashing over storage node names,
+// so adding or removing a storage node changes the set of nodes only for the shards placed at this node.
+type StreamShardsPlacement struct {
+	shardNodes [StreamShardsCount][]int
+}
+
+// NewStreamShardsPlacement returns placement of StreamShardsCount log stream shards among the given nodes.
+//
+// Every shard is placed at replicationFactor distinct nodes. The replicationFactor is limited by the number of nodes.
+func NewStreamShardsPlacement(nodes []string, replicationFactor int) *StreamShardsPlacement {
+	replicationFactor = max(replicationFactor, 1)
+	replicationFactor = min(replicationFactor, len(nodes))
+
+	nodeHashes := make([]uint64, len(nodes))
+	for i, node := range nodes {
+		nodeHashes[i] = xxhash.Sum64([]byte(node))
+	}
+
+	var ssp StreamShardsPlacement
+	for shard := range ssp.shardNodes {
+		h := xxhash.Sum64([]byte(strconv.Itoa(shard)))
+		nodeIdxs := make([]int, 0, replicationFactor)
+		for len(nodeIdxs) < replicationFactor {
+			idx := -1
+			var mMax uint64
+			for i, nh := range nodeHashes {
+				if slices.Contains(nodeIdxs, i) {
+					continue
+				}
+				if m := fastHashUint64(nh ^ h); idx < 0 || m > mMax {
+					mMax = m
+					idx = i
+				}
+			}
+			nodeIdxs = append(nodeIdxs, idx)
+		}
+		ssp.shardNodes[shard] = nodeIdxs
+	}
+	return &ssp
+}
+
+// GetNodeIdxs returns indexes of the nodes the given shard is placed at.
+//
+// The first index is the primary node for the shard, while the rest of indexes are replicas in the order of preference.
+//
+// The returned slice mustn't be modified by the caller.
+func (ssp *StreamShardsPlacement) GetNodeIdxs(shard uint64) []int {
+	return ssp.shardNodes[shard]
+}
+
+// StreamShards limits the search to log streams belonging to the given Shards out of ShardsCount.
+//
+// Log streams are split into shards by the hash of their ids. The shard for the log stream with the given streamHash
+// passed to LogRows.ForEachRow callback is streamHash % ShardsCount.
+// Replicated log streams are split into StreamShardsCount shards. See GetStreamShard.
+//
+// This allows reading every log stream from exactly one storage node when log streams are replicated among multiple storage nodes.
+type StreamShards struct {
+	// ShardsCount is the total number of shards.
+	ShardsCount uint64
+
+	// Shards contains sorted shard numbers in the range [0..ShardsCount) to search in.
+	Shards []uint64
+}
+
+// ParseStreamShards parses StreamShards from s, which must be obtained via StreamShards.String().
+func ParseStreamShards(s string) (*StreamShards, error) {
+	n := strings.IndexByte(s, '/')
+	if n < 0 {
+		return nil, fmt.Errorf("missing '/' in stream shards %q", s)
+	}
+	shardsStr, shardsCountStr := s[:n], s[n+1:]
+
+	shardsCount, err := strconv.ParseUint(shardsCountStr, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse shards count %q: %w", shardsCountStr, err)
+	}
+	if shardsCount == 0 {
+		return nil, fmt.Errorf("shards count must be bigger than 0")
+	}
+
+	var shards []uint64
+	if shardsStr != "" {
+		for _, shardStr := range strings.Split(shardsStr, ",") {
+			shard, err := strconv.ParseUint(shardStr, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse shard %q: %w", shardStr, err)
+			}
+			if shard >= shardsCount {
+				return nil, fmt.Errorf("shard %d must be smaller than shards count %d", shard, shardsCount)
+			}
+			shards = append(shards, shard)
+		}
+	}
+	slices.Sort(shards)
+	shards = slices.Compact(shards)
+
+	ss := &StreamShards{
+		ShardsCount: shardsCount,
+		Shards:      shards,
+	}
+	return ss, nil
+}
+
+// String returns string representation for ss in the form `shard1,...,shardN/shardsCount`.
+func (ss *StreamShards) String() string {
+	a := make([]string, len(ss.Shards))
+	for i, shard := range ss.Shards {
+		a[i] = strconv.FormatUint(shard, 10)
+	}
+	return fmt.Sprintf("%s/%d", strings.Join(a, ","), ss.ShardsCount)
+}
+
+// hasStreamID returns true if the given sid belongs to ss.
+func (ss *StreamShards) hasStreamID(sid *streamID) bool {
+	streamHash := sid.id.lo ^ sid.id.hi
+	_, ok := slices.BinarySearch(ss.Shards, streamHash%ss.ShardsCount)
+	return ok
+}
@@ -0,0 +1,278 @@
+package logstorage
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+func TestParseStreamShardsSuccess(t *testing.T) {
+	f := func(s string, shardsCountExpected uint64, shardsExpected []uint64, resultExpected string) {
+		t.Helper()
+
+		ss, err := ParseStreamShards(s)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if ss.ShardsCount != shardsCountExpected {
+			t.Fatalf("unexpected shards count; got %d; want %d", ss.ShardsCount, shardsCountExpected)
+		}
+		if !reflect.DeepEqual(ss.Shards, shardsExpected) {
+			t.Fatalf("unexpected shards; got %v; want %v", ss.Shards, shardsExpected)
+		}
+		result := ss.String()
+		if result != resultExpected {
+			t.Fatalf("unexpected string representation; got %q; want %q", result, resultExpected)
+		}
+	}
+
+	f("/3", 3, nil, "/3")
+	f("0/1", 1, []uint64{0}, "0/1")
+	f("2,0/3", 3, []uint64{0, 2}, "0,2/3")
+	f("4,1,4/5", 5, []uint64{1, 4}, "1,4/5")
+}
+
+func TestParseStreamShardsFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+
+		ss, err := ParseStreamShards(s)
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		if ss != nil {
+			t.Fatalf("expecting nil result; got %v", ss)
+		}
+	}
+
+	f("")
+	f("1")
+	f("1/")
+	f("1/0")
+	f("1/foo")
+	f("foo/3")
+	f("1,/3")
+	f("3/3")
+}
+
+func TestStreamShardsHasStreamID(t *testing.T) {
+	ss := &StreamShards{
+		ShardsCount: 3,
+		Shards:      []uint64{0, 2},
+	}
+
+	f := func(hi, lo uint64, resultExpected bool) {
+		t.Helper()
+
+		sid := &streamID{
+			id: u128{
+				hi: hi,
+				lo: lo,
+			},
+		}
+		result := ss.hasStreamID(sid)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for streamID with hi=%d, lo=%d; got %v; want %v", hi, lo, result, resultExpected)
+		}
+	}
+
+	// shard 0
+	f(0, 0, true)
+	f(1, 2, true)
+
+	// shard 1
+	f(0, 1, false)
+	f(5, 1, false)
+
+	// shard 2
+	f(2, 0, true)
+	f(0, 5, true)
+}
+
+func TestStreamShardsPlacement(t *testing.T) {
+	f := func(nodesCount, replicationFactor, resultLenExpected int) {
+		t.Helper()
+
+		nodes := make([]string, nodesCount)
+		for i := range nodes {
+			nodes[i] = fmt.Sprintf("vlstorage-%d:9428", i)
+		}
+		ssp := NewStreamShardsPlacement(nodes, replicationFactor)
+
+		shardsPerNode := make([]int, nodesCount)
+		for shard := uint64(0); shard < StreamShardsCount; shard++ {
+			nodeIdxs := ssp.GetNodeIdxs(shard)
+			if len(nodeIdxs) != resultLenExpected {
+				t.Fatalf("unexpected number of nodes for shard %d; got %d; want %d", shard, len(nodeIdxs), resultLenExpected)
+			}
+			m := make(map[int]struct{})
+			for _, idx := range nodeIdxs {
+				if idx < 0 || idx >= nodesCount {
+					t.Fatalf("unexpected node index %d for shard %d; it must be in the range [0..%d)", idx, shard, nodesCount)
+				}
+				if _, ok := m[idx]; ok {
+					t.Fatalf("duplicate node index %d for shard %d: %v", idx, shard, nodeIdxs)
+				}
+				m[idx] = struct{}{}
+			}
+			shardsPerNode[nodeIdxs[0]]++
+		}
+
+		// Primary nodes must be distributed evenly among shards
+		shardsPerNodeExpected := float64(StreamShardsCount) / float64(nodesCount)
+		for nodeIdx, n := range shardsPerNode {
+			if math.Abs(float64(n)-shardsPerNodeExpected)/shardsPerNodeExpected > 0.35 {
+				t.Fatalf("non-uniform distribution of shards among nodes; node %d has %d shards, while it must have %v shards; shardsPerNode=%d",
+					nodeIdx, n, shardsPerNodeExpected, shardsPerNode)
+			}
+		}
+
+		// The placement must be stable
+		ssp2 := NewStreamShardsPlacement(nodes, replicationFactor)
+		if !reflect.DeepEqual(ssp, ssp2) {
+			t.Fatalf("unstable placement for the same nodes")
+		}
+
+		// Adding a node must change the set of nodes only for the shards placed at the added node
+		nodesNew := append(nodes[:len(nodes):len(nodes)], "vlstorage-new:9428")
+		sspNew := NewStreamShardsPlacement(nodesNew, replicationFactor)
+		for shard := uint64(0); shard < StreamShardsCount; shard++ {
+			nodeIdxs := ssp.GetNodeIdxs(shard)
+			nodeIdxsNew := sspNew.GetNodeIdxs(shard)
+			if slices.Contains(nodeIdxsNew, nodesCount) {
+				continue
+			}
+			if len(nodeIdxs) == replicationFactor && !reflect.DeepEqual(nodeIdxs, nodeIdxsNew) {
+				t.Fatalf("unexpected change of nodes for shard %d after adding a node; got %v; want %v", shard, nodeIdxsNew, nodeIdxs)
+			}
+		}
+
+		// Removing a node must change the set of nodes only for the shards placed at the removed node
+		if nodesCount > replicationFactor {
+			sspRemoved := NewStreamShardsPlacement(nodes[1:], replicationFactor)
+			for shard := uint64(0); shard < StreamShardsCount; shard++ {
+				nodeIdxs := ssp.GetNodeIdxs(shard)
+				if slices.Contains(nodeIdxs, 0) {
+					continue
+				}
+				var nodeIdxsRemoved []int
+				for _, idx := range sspRemoved.GetNodeIdxs(shard) {
+					nodeIdxsRemoved = append(nodeIdxsRemoved, idx+1)
+				}
+				if !reflect.DeepEqual(nodeIdxs, nodeIdxsRemoved) {
+					t.Fatalf("unexpected change of nodes for shard %d after removing a node; got %v; want %v", shard, nodeIdxsRemoved, nodeIdxs)
+				}
+			}
+		}
+	}
+
+	f(1, 1, 1)
+	f(3, 1, 1)
+	f(3, 2, 2)
+	f(3, 3, 3)
+	f(5, 2, 2)
+
+	// the replication factor exceeds the number of nodes
+	f(2, 5, 2)
+}
+
+func TestGetStreamShard(t *testing.T) {
+	for _, streamHash := range []uint64{0, 1, StreamShardsCount - 1, StreamShardsCount, 1<<64 - 1} {
+		shard := GetStreamShard(streamHash)
+		if shard >= StreamShardsCount {
+			t.Fatalf("unexpected shard %d for streamHash=%d; it must be smaller than %d", shard, streamHash, StreamShardsCount)
+		}
+		ss := &StreamShards{
+			ShardsCount: StreamShardsCount,
+			Shards:      []uint64{shard},
+		}
+		sid := &streamID{
+			id: u128{
+				lo: streamHash,
+			},
+		}
+		if !ss.hasStreamID(sid) {
+			t.Fatalf("the stream with streamHash=%d must belong to the shard %d", streamHash, shard)
+		}
+	}
+}
+
+func TestStorageRunQueryWithStreamShards(t *testing.T) {
+	t.Parallel()
+
+	path := t.Name()
+
+	const streamsCount = 10
+	const shardsCount = 3
+
+	sc := &StorageConfig{
+		Retention: 24 * time.Hour,
+	}
+	s := MustOpenStorage(path, sc)
+
+	tenantID := TenantID{AccountID: 1}
+	timestamp := time.Now().UnixNano()
+	lr := GetLogRows([]string{"app"}, nil, nil, nil, "")
+	for i := 0; i < streamsCount; i++ {
+		fields := []Field{
+			{Name: "app", Value: fmt.Sprintf("app-%d", i)},
+			{Name: "_msg", Value: "foo"},
+		}
+		lr.MustAdd(tenantID, timestamp, fields, nil)
+	}
+	rowsPerShard := make([]uint64, shardsCount)
+	lr.ForEachRow(func(streamHash uint64, _ *InsertRow) {
+		rowsPerShard[streamHash%shardsCount]++
+	})
+	s.MustAddRows(lr)
+	PutLogRows(lr)
+	s.DebugFlush()
+
+	getRowsCount := func(ss *StreamShards) uint64 {
+		t.Helper()
+
+		q := mustParseQuery("*")
+		var rowsCount atomic.Uint64
+		writeBlock := func(_ uint, db *DataBlock) {
+			rowsCount.Add(uint64(db.RowsCount()))
+		}
+		qctx := newTestQueryContext([]TenantID{tenantID}, q)
+		qctx.StreamShards = ss
+		if err := s.RunQuery(qctx, writeBlock); err != nil {
+			t.Fatalf("unexpected error in query [%s]: %s", q, err)
+		}
+		return rowsCount.Load()
+	}
+
+	if n := getRowsCount(nil); n != streamsCount {
+		t.Fatalf("unexpected number of rows without stream shards; got %d; want %d", n, streamsCount)
+	}
+
+	// Every log stream must be returned only for its own shard
+	for shard := uint64(0); shard < shardsCount; shard++ {
+		ss := &StreamShards{
+			ShardsCount: shardsCount,
+			Shards:      []uint64{shard},
+		}
+		if n := getRowsCount(ss); n != rowsPerShard[shard] {
+			t.Fatalf("unexpected number of rows for shard %d; got %d; want %d", shard, n, rowsPerShard[shard])
+		}
+	}
+
+	ss := &StreamShards{
+		ShardsCount: shardsCount,
+		Shards:      []uint64{0, 1, 2},
+	}
+	if n := getRowsCount(ss); n != streamsCount {
+		t.Fatalf("unexpected number of rows for all the shards; got %d; want %d", n, streamsCount)
+	}
+
+	s.MustClose()
+	fs.MustRemoveDir(path)
+}
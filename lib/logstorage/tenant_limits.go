@@ -0,0 +1,119 @@
+package logstorage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TenantLimits contains per-tenant limits of some kind.
+//
+// See https://docs.victoriametrics.com/victorialogs/#tenant-limits
+type TenantLimits struct {
+	// Default is the limit for tenants without explicitly configured limits at PerTenant.
+	//
+	// Zero means no limit.
+	Default int64
+
+	// PerTenant contains limits for particular tenants.
+	//
+	// Zero value means no limit for the given tenant.
+	PerTenant map[TenantID]int64
+}
+
+// Get returns the limit for the given tenantID.
+//
+// Zero is returned if there is no limit for the given tenantID.
+func (tl *TenantLimits) Get(tenantID TenantID) int64 {
+	if tl == nil {
+		return 0
+	}
+	if n, ok := tl.PerTenant[tenantID]; ok {
+		return n
+	}
+	return tl.Default
+}
+
+// IsEmpty returns true if tl doesn't limit any tenant.
+func (tl *TenantLimits) IsEmpty() bool {
+	if tl == nil {
+		return true
+	}
+	if tl.Default > 0 {
+		return false
+	}
+	for _, n := range tl.PerTenant {
+		if n > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns string representation for tl.
+func (tl *TenantLimits) String() string {
+	if tl == nil {
+		return ""
+	}
+	var a []string
+	if tl.Default > 0 {
+		a = append(a, fmt.Sprintf("%d", tl.Default))
+	}
+	tenantIDs := make([]TenantID, 0, len(tl.PerTenant))
+	for tenantID := range tl.PerTenant {
+		tenantIDs = append(tenantIDs, tenantID)
+	}
+	sort.Slice(tenantIDs, func(i, j int) bool {
+		return tenantIDs[i].less(&tenantIDs[j])
+	})
+	for _, tenantID := range tenantIDs {
+		a = append(a, fmt.Sprintf("%d:%d:%d", tenantID.AccountID, tenantID.ProjectID, tl.PerTenant[tenantID]))
+	}
+	return strings.Join(a, ",")
+}
+
+// ParseTenantLimits parses tenant limits from ss.
+//
+// Every item in ss must have either `limit` form for the default limit applied to all the tenants
+// or `accountID:projectID:limit` form for the limit applied to the given tenant. For example:
+//
+//   - `1000` - the limit 1000 for all the tenants
+//   - `12:34:5000` - the limit 5000 for the tenant 12:34
+//
+// The limit is parsed with parseLimit. Zero limit means no limit.
+func ParseTenantLimits(ss []string, parseLimit func(s string) (int64, error)) (*TenantLimits, error) {
+	tl := &TenantLimits{}
+	for _, s := range ss {
+		limitStr := s
+		tenantStr := ""
+		n := strings.LastIndexByte(s, ':')
+		if n >= 0 {
+			tenantStr, limitStr = s[:n], s[n+1:]
+		}
+
+		limit, err := parseLimit(limitStr)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse limit from %q: %w", s, err)
+		}
+		if limit < 0 {
+			return nil, fmt.Errorf("limit cannot be negative; got %q", s)
+		}
+
+		if n < 0 {
+			tl.Default = limit
+			continue
+		}
+		if !strings.Contains(tenantStr, ":") {
+			return nil, fmt.Errorf("missing tenant in the form accountID:projectID at %q", s)
+		}
+		tenantID, err := ParseTenantID(tenantStr)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse tenant from %q: %w", tenantStr, err)
+		}
+		if tl.PerTenant == nil {
+			tl.PerTenant = make(map[TenantID]int64)
+		}
+		tl.PerTenant[tenantID] = limit
+	}
+	return tl, nil
+}
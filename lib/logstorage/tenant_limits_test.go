@@ -0,0 +1,95 @@
+package logstorage
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestParseTenantLimitsSuccess(t *testing.T) {
+	f := func(ss []string, resultExpected string) {
+		t.Helper()
+
+		tl, err := ParseTenantLimits(ss, parseTestLimit)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		result := tl.String()
+		if result != resultExpected {
+			t.Fatalf("unexpected result; got %q; want %q", result, resultExpected)
+		}
+	}
+
+	f(nil, "")
+	f([]string{"0"}, "")
+	f([]string{"100"}, "100")
+	f([]string{"12:34:1000"}, "12:34:1000")
+	f([]string{"12:34:1000", "100", "0:0:0", "5:6:7"}, "100,0:0:0,5:6:7,12:34:1000")
+
+	// the last value wins
+	f([]string{"100", "200", "1:2:3", "1:2:4"}, "200,1:2:4")
+}
+
+func TestParseTenantLimitsFailure(t *testing.T) {
+	f := func(ss []string) {
+		t.Helper()
+
+		tl, err := ParseTenantLimits(ss, parseTestLimit)
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		if tl != nil {
+			t.Fatalf("expecting nil limits; got %s", tl)
+		}
+	}
+
+	f([]string{""})
+	f([]string{"foo"})
+
+	// negative limit
+	f([]string{"-1"})
+	f([]string{"12:34:-1"})
+
+	// missing tenant
+	f([]string{"12:100"})
+	f([]string{":100"})
+
+	// invalid tenant
+	f([]string{"foo:bar:100"})
+	f([]string{"12:-1:100"})
+
+	// invalid limit
+	f([]string{"12:34:"})
+	f([]string{"12:34:foo"})
+}
+
+func TestTenantLimitsGet(t *testing.T) {
+	f := func(tl *TenantLimits, tenantID TenantID, limitExpected int64) {
+		t.Helper()
+
+		limit := tl.Get(tenantID)
+		if limit != limitExpected {
+			t.Fatalf("unexpected limit for tenant %d:%d; got %d; want %d", tenantID.AccountID, tenantID.ProjectID, limit, limitExpected)
+		}
+		isEmptyExpected := tl == nil || (tl.Default == 0 && tl.PerTenant == nil)
+		if tl.IsEmpty() != isEmptyExpected {
+			t.Fatalf("unexpected IsEmpty() result; got %v; want %v", tl.IsEmpty(), isEmptyExpected)
+		}
+	}
+
+	f(nil, TenantID{}, 0)
+	f(&TenantLimits{}, TenantID{}, 0)
+
+	tl := &TenantLimits{
+		Default: 100,
+		PerTenant: map[TenantID]int64{
+			{AccountID: 12, ProjectID: 34}: 1000,
+		},
+	}
+	f(tl, TenantID{}, 100)
+	f(tl, TenantID{AccountID: 12}, 100)
+	f(tl, TenantID{AccountID: 12, ProjectID: 34}, 1000)
+}
+
+func parseTestLimit(s string) (int64, error) {
+	return strconv.ParseInt(s, 10, 64)
+}
@@ -0,0 +1,100 @@
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding/zstd"
+	"github.com/golang/snappy"
+)
+
+// Codec is a compression codec for Parquet pages.
+type Codec int32
+
+// Compression codecs.
+const (
+	CodecUncompressed Codec = 0
+	CodecSnappy       Codec = 1
+	CodecGzip         Codec = 2
+	CodecZstd         Codec = 6
+)
+
+// ParseCodec returns Codec for the given name.
+//
+// Supported names: none, snappy, gzip, zstd.
+func ParseCodec(name string) (Codec, error) {
+	switch name {
+	case "none", "uncompressed":
+		return CodecUncompressed, nil
+	case "snappy":
+		return CodecSnappy, nil
+	case "gzip":
+		return CodecGzip, nil
+	case "zstd":
+		return CodecZstd, nil
+	default:
+		return 0, fmt.Errorf("unsupported compression codec %q; supported codecs: none, snappy, gzip, zstd", name)
+	}
+}
+
+func (c Codec) compress(dst, src []byte) []byte {
+	switch c {
+	case CodecUncompressed:
+		return append(dst, src...)
+	case CodecSnappy:
+		return append(dst, snappy.Encode(nil, src)...)
+	case CodecGzip:
+		bb := bytes.NewBuffer(dst)
+		zw := gzip.NewWriter(bb)
+		_, _ = zw.Write(src)
+		_ = zw.Close()
+		return bb.Bytes()
+	case CodecZstd:
+		return zstd.CompressLevel(dst, src, 1)
+	default:
+		panic(fmt.Errorf("BUG: unexpected codec: %d", c))
+	}
+}
+
+func (c Codec) decompress(dst, src []byte) ([]byte, error) {
+	switch c {
+	case CodecUncompressed:
+		return append(dst, src...), nil
+	case CodecSnappy:
+		n, err := snappy.DecodedLen(src)
+		if err != nil {
+			return dst, err
+		}
+		if n > maxPageSize {
+			return dst, fmt.Errorf("too big decompressed page size: %d bytes; mustn't exceed %d bytes", n, maxPageSize)
+		}
+		data, err := snappy.Decode(nil, src)
+		if err != nil {
+			return dst, err
+		}
+		return append(dst, data...), nil
+	case CodecGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(src))
+		if err != nil {
+			return dst, err
+		}
+		bb := bytes.NewBuffer(dst)
+		n, err := io.Copy(bb, io.LimitReader(zr, maxPageSize+1))
+		if err != nil {
+			return dst, err
+		}
+		if n > maxPageSize {
+			return dst, fmt.Errorf("too big decompressed page size; mustn't exceed %d bytes", maxPageSize)
+		}
+		return bb.Bytes(), nil
+	case CodecZstd:
+		return zstd.Decompress(dst, src)
+	default:
+		return dst, fmt.Errorf("unsupported compression codec %d; supported codecs: uncompressed, snappy, gzip, zstd", c)
+	}
+}
+
+// maxPageSize is the maximum size of a decompressed page.
+const maxPageSize = 256 * 1024 * 1024
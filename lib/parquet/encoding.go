@@ -0,0 +1,309 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+// appendRLEBitPackedHybrid appends levels encoded with RLE/bit-packed hybrid encoding and the given bitWidth to dst.
+//
+// See https://parquet.apache.org/docs/file-format/data-pages/encodings/#run-length-encoding--bit-packing-hybrid-rle--3
+func appendRLEBitPackedHybrid(dst []byte, levels []uint32, bitWidth int) []byte {
+	byteWidth := (bitWidth + 7) / 8
+	for len(levels) > 0 {
+		// Use RLE run for repeated values, since this is the most common case for definition levels.
+		n := 1
+		for n < len(levels) && levels[n] == levels[0] {
+			n++
+		}
+		if n >= 8 || n == len(levels) {
+			dst = binary.AppendUvarint(dst, uint64(n)<<1)
+			v := levels[0]
+			for i := 0; i < byteWidth; i++ {
+				dst = append(dst, byte(v>>(8*i)))
+			}
+			levels = levels[n:]
+			continue
+		}
+
+		// Use bit-packed run for up to 504 values until the next long RLE run.
+		n = 0
+		for n < len(levels) && n < 504 {
+			if n%8 == 0 && isRLERun(levels[n:]) {
+				break
+			}
+			n++
+		}
+		groups := (n + 7) / 8
+		dst = binary.AppendUvarint(dst, uint64(groups)<<1|1)
+		var acc uint64
+		accBits := 0
+		for i := 0; i < groups*8; i++ {
+			var v uint32
+			if i < n {
+				v = levels[i]
+			}
+			acc |= uint64(v) << accBits
+			accBits += bitWidth
+			for accBits >= 8 {
+				dst = append(dst, byte(acc))
+				acc >>= 8
+				accBits -= 8
+			}
+		}
+		if accBits > 0 {
+			dst = append(dst, byte(acc))
+		}
+		if n > len(levels) {
+			n = len(levels)
+		}
+		levels = levels[n:]
+	}
+	return dst
+}
+
+func isRLERun(levels []uint32) bool {
+	if len(levels) < 8 {
+		return false
+	}
+	for _, v := range levels[1:8] {
+		if v != levels[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// readRLEBitPackedHybrid reads n values encoded with RLE/bit-packed hybrid encoding and the given bitWidth from src and appends them to dst.
+//
+// It returns the tail left after reading n values.
+func readRLEBitPackedHybrid(dst []uint32, src []byte, bitWidth, n int) ([]uint32, []byte, error) {
+	if bitWidth < 0 || bitWidth > 32 {
+		return dst, src, fmt.Errorf("invalid bit width: %d; it must be in the range [0..32]", bitWidth)
+	}
+	if n < 0 {
+		return dst, src, fmt.Errorf("invalid number of values to read: %d", n)
+	}
+	byteWidth := (bitWidth + 7) / 8
+	for n > 0 {
+		header, size := binary.Uvarint(src)
+		if size <= 0 {
+			return dst, src, fmt.Errorf("cannot read run header")
+		}
+		src = src[size:]
+		if header&1 == 0 {
+			// RLE run
+			count := header >> 1
+			if len(src) < byteWidth {
+				return dst, src, fmt.Errorf("cannot read RLE value; want %d bytes; got %d bytes", byteWidth, len(src))
+			}
+			var v uint32
+			for i := 0; i < byteWidth; i++ {
+				v |= uint32(src[i]) << (8 * i)
+			}
+			src = src[byteWidth:]
+			if count > uint64(n) {
+				count = uint64(n)
+			}
+			for i := uint64(0); i < count; i++ {
+				dst = append(dst, v)
+			}
+			n -= int(count)
+			continue
+		}
+
+		// Bit-packed run
+		groups := header >> 1
+		if groups > uint64(len(src)) {
+			return dst, src, fmt.Errorf("too big number of bit-packed groups: %d", groups)
+		}
+		bytesLen := int(groups) * bitWidth
+		if len(src) < bytesLen {
+			return dst, src, fmt.Errorf("cannot read bit-packed run; want %d bytes; got %d bytes", bytesLen, len(src))
+		}
+		count := min(int(groups)*8, n)
+		dst = unpackBits(dst, src[:bytesLen], bitWidth, count)
+		src = src[bytesLen:]
+		n -= count
+	}
+	return dst, src, nil
+}
+
+// unpackBits appends n values with the given bitWidth packed from the least significant bit in src to dst.
+func unpackBits(dst []uint32, src []byte, bitWidth, n int) []uint32 {
+	if bitWidth == 0 {
+		for i := 0; i < n; i++ {
+			dst = append(dst, 0)
+		}
+		return dst
+	}
+	mask := uint64(1)<<bitWidth - 1
+	var acc uint64
+	accBits := 0
+	for i := 0; i < n; i++ {
+		for accBits < bitWidth {
+			acc |= uint64(src[0]) << accBits
+			src = src[1:]
+			accBits += 8
+		}
+		dst = append(dst, uint32(acc&mask))
+		acc >>= bitWidth
+		accBits -= bitWidth
+	}
+	return dst
+}
+
+// unpackBits64 appends n values with the given bitWidth packed from the least significant bit in src to dst.
+func unpackBits64(dst []uint64, src []byte, bitWidth, n int) []uint64 {
+	var acc uint64
+	accBits := 0
+	for i := 0; i < n; i++ {
+		var v uint64
+		vBits := 0
+		for vBits < bitWidth {
+			if accBits == 0 {
+				acc = uint64(src[0])
+				src = src[1:]
+				accBits = 8
+			}
+			take := min(bitWidth-vBits, accBits)
+			v |= (acc & (uint64(1)<<take - 1)) << vBits
+			acc >>= take
+			accBits -= take
+			vBits += take
+		}
+		dst = append(dst, v)
+	}
+	return dst
+}
+
+// readDeltaBinaryPacked reads values encoded with DELTA_BINARY_PACKED encoding from src and appends them to dst.
+//
+// It returns the tail left after reading the values.
+//
+// See https://parquet.apache.org/docs/file-format/data-pages/encodings/#delta-encoding-delta_binary_packed--5
+func readDeltaBinaryPacked(dst []int64, src []byte) ([]int64, []byte, error) {
+	blockSize, size := binary.Uvarint(src)
+	if size <= 0 {
+		return dst, src, fmt.Errorf("cannot read block size")
+	}
+	src = src[size:]
+	miniblocks, size := binary.Uvarint(src)
+	if size <= 0 {
+		return dst, src, fmt.Errorf("cannot read the number of miniblocks")
+	}
+	src = src[size:]
+	totalCount, size := binary.Uvarint(src)
+	if size <= 0 {
+		return dst, src, fmt.Errorf("cannot read the total number of values")
+	}
+	src = src[size:]
+	firstValue, size := binary.Varint(src)
+	if size <= 0 {
+		return dst, src, fmt.Errorf("cannot read the first value")
+	}
+	src = src[size:]
+
+	if totalCount == 0 {
+		return dst, src, nil
+	}
+	if miniblocks == 0 || blockSize == 0 || blockSize%miniblocks != 0 || blockSize%128 != 0 {
+		return dst, src, fmt.Errorf("invalid block size %d for %d miniblocks", blockSize, miniblocks)
+	}
+	if totalCount > uint64(len(src))*64+1 {
+		return dst, src, fmt.Errorf("too big number of values: %d", totalCount)
+	}
+	valuesPerMiniblock := int(blockSize / miniblocks)
+
+	dst = append(dst, firstValue)
+	v := firstValue
+	remaining := int(totalCount) - 1
+	var deltas []uint64
+	for remaining > 0 {
+		minDelta, size := binary.Varint(src)
+		if size <= 0 {
+			return dst, src, fmt.Errorf("cannot read min delta")
+		}
+		src = src[size:]
+		if uint64(len(src)) < miniblocks {
+			return dst, src, fmt.Errorf("cannot read miniblock bit widths")
+		}
+		bitWidths := src[:miniblocks]
+		src = src[miniblocks:]
+		for _, bitWidth := range bitWidths {
+			if remaining <= 0 {
+				break
+			}
+			if bitWidth > 64 {
+				return dst, src, fmt.Errorf("too big miniblock bit width: %d", bitWidth)
+			}
+			bytesLen := valuesPerMiniblock * int(bitWidth) / 8
+			if len(src) < bytesLen {
+				return dst, src, fmt.Errorf("cannot read miniblock; want %d bytes; got %d bytes", bytesLen, len(src))
+			}
+			count := min(valuesPerMiniblock, remaining)
+			deltas = unpackBits64(deltas[:0], src[:bytesLen], int(bitWidth), count)
+			src = src[bytesLen:]
+			for _, d := range deltas {
+				v += minDelta + int64(d)
+				dst = append(dst, v)
+			}
+			remaining -= count
+		}
+	}
+	return dst, src, nil
+}
+
+// readDeltaLengthByteArray reads n values encoded with DELTA_LENGTH_BYTE_ARRAY encoding from src and appends them to dst.
+//
+// It returns the tail left after reading the values.
+func readDeltaLengthByteArray(dst []string, src []byte, n int) ([]string, []byte, error) {
+	lens, tail, err := readDeltaBinaryPacked(nil, src)
+	if err != nil {
+		return dst, src, fmt.Errorf("cannot read lengths: %w", err)
+	}
+	if len(lens) < n {
+		return dst, src, fmt.Errorf("unexpected number of lengths; got %d; want %d", len(lens), n)
+	}
+	src = tail
+	for _, l := range lens[:n] {
+		if l < 0 || l > int64(len(src)) {
+			return dst, src, fmt.Errorf("invalid value length: %d; %d bytes left", l, len(src))
+		}
+		dst = append(dst, string(src[:l]))
+		src = src[l:]
+	}
+	return dst, src, nil
+}
+
+// readDeltaByteArray reads n values encoded with DELTA_BYTE_ARRAY encoding from src and appends them to dst.
+func readDeltaByteArray(dst []string, src []byte, n int) ([]string, error) {
+	prefixLens, tail, err := readDeltaBinaryPacked(nil, src)
+	if err != nil {
+		return dst, fmt.Errorf("cannot read prefix lengths: %w", err)
+	}
+	if len(prefixLens) < n {
+		return dst, fmt.Errorf("unexpected number of prefix lengths; got %d; want %d", len(prefixLens), n)
+	}
+	suffixes, _, err := readDeltaLengthByteArray(nil, tail, n)
+	if err != nil {
+		return dst, fmt.Errorf("cannot read suffixes: %w", err)
+	}
+	prev := ""
+	for i, suffix := range suffixes {
+		l := prefixLens[i]
+		if l < 0 || l > int64(len(prev)) {
+			return dst, fmt.Errorf("invalid prefix length: %d; previous value length: %d", l, len(prev))
+		}
+		v := prev[:l] + suffix
+		dst = append(dst, v)
+		prev = v
+	}
+	return dst, nil
+}
+
+// bitWidth returns the number of bits needed for storing v.
+func bitWidth(v uint32) int {
+	return bits.Len32(v)
+}
@@ -0,0 +1,566 @@
+package parquet
+
+import (
+	"fmt"
+)
+
+// Physical types.
+//
+// See https://github.com/apache/parquet-format/blob/master/src/main/thrift/parquet.thrift
+const (
+	typeBoolean           = 0
+	typeInt32             = 1
+	typeInt64             = 2
+	typeInt96             = 3
+	typeFloat             = 4
+	typeDouble            = 5
+	typeByteArray         = 6
+	typeFixedLenByteArray = 7
+)
+
+// Repetition types.
+const (
+	repetitionRequired = 0
+	repetitionOptional = 1
+	repetitionRepeated = 2
+)
+
+// Converted types, which are needed for formatting values.
+const (
+	convertedTypeUTF8            = 0
+	convertedTypeDecimal         = 5
+	convertedTypeDate            = 6
+	convertedTypeTimeMillis      = 7
+	convertedTypeTimeMicros      = 8
+	convertedTypeTimestampMillis = 9
+	convertedTypeTimestampMicros = 10
+	convertedTypeUint8           = 11
+	convertedTypeUint16          = 12
+	convertedTypeUint32          = 13
+	convertedTypeUint64          = 14
+)
+
+// Encodings.
+const (
+	encodingPlain                = 0
+	encodingPlainDictionary      = 2
+	encodingRLE                  = 3
+	encodingDeltaBinaryPacked    = 5
+	encodingDeltaLengthByteArray = 6
+	encodingDeltaByteArray       = 7
+	encodingRLEDictionary        = 8
+	encodingByteStreamSplit      = 9
+)
+
+// Page types.
+const (
+	pageTypeData       = 0
+	pageTypeDictionary = 2
+	pageTypeDataV2     = 3
+)
+
+// Time units for logical types.
+const (
+	timeUnitNone = iota
+	timeUnitMillis
+	timeUnitMicros
+	timeUnitNanos
+)
+
+// logicalType contains the parts of Parquet LogicalType, which are needed for formatting values.
+type logicalType struct {
+	isString    bool
+	isDate      bool
+	isTime      bool
+	isTimestamp bool
+	isDecimal   bool
+	isUUID      bool
+
+	// timeUnit is set for time and timestamp types.
+	timeUnit int
+
+	// isUnsigned is set for unsigned integer types.
+	isUnsigned bool
+
+	scale int32
+}
+
+// schemaElement is Parquet SchemaElement.
+type schemaElement struct {
+	typ            int32
+	hasType        bool
+	typeLength     int32
+	repetitionType int32
+	name           string
+	numChildren    int32
+
+	convertedType    int32
+	hasConvertedType bool
+
+	scale int32
+
+	logicalType    logicalType
+	hasLogicalType bool
+}
+
+// columnMetaData is Parquet ColumnMetaData.
+type columnMetaData struct {
+	typ                   int32
+	encodings             []int32
+	pathInSchema          []string
+	codec                 int32
+	numValues             int64
+	totalUncompressedSize int64
+	totalCompressedSize   int64
+	dataPageOffset        int64
+	dictionaryPageOffset  int64
+	hasDictionaryPage     bool
+}
+
+// columnChunk is Parquet ColumnChunk.
+type columnChunk struct {
+	filePath   string
+	fileOffset int64
+	metaData   columnMetaData
+}
+
+// rowGroup is Parquet RowGroup.
+type rowGroup struct {
+	columns       []columnChunk
+	totalByteSize int64
+	numRows       int64
+}
+
+// fileMetaData is Parquet FileMetaData.
+type fileMetaData struct {
+	version   int32
+	schema    []schemaElement
+	numRows   int64
+	rowGroups []rowGroup
+	createdBy string
+}
+
+// pageHeader is Parquet PageHeader.
+type pageHeader struct {
+	typ                  int32
+	uncompressedPageSize int32
+	compressedPageSize   int32
+
+	// data page fields
+	numValues               int32
+	encoding                int32
+	definitionLevelEncoding int32
+
+	// data page v2 fields
+	numNulls                   int32
+	numRows                    int32
+	definitionLevelsByteLength int32
+	repetitionLevelsByteLength int32
+	isCompressed               bool
+}
+
+func (fmd *fileMetaData) marshal(tw *thriftWriter) {
+	tw.writeStructBegin()
+	tw.writeI32Field(1, fmd.version)
+	tw.writeListFieldBegin(2, thriftTypeStruct, len(fmd.schema))
+	for i := range fmd.schema {
+		fmd.schema[i].marshal(tw)
+	}
+	tw.writeI64Field(3, fmd.numRows)
+	tw.writeListFieldBegin(4, thriftTypeStruct, len(fmd.rowGroups))
+	for i := range fmd.rowGroups {
+		fmd.rowGroups[i].marshal(tw)
+	}
+	if fmd.createdBy != "" {
+		tw.writeBinaryField(6, fmd.createdBy)
+	}
+	tw.writeStructEnd()
+}
+
+func (se *schemaElement) marshal(tw *thriftWriter) {
+	tw.writeStructBegin()
+	if se.hasType {
+		tw.writeI32Field(1, se.typ)
+	}
+	if se.numChildren == 0 {
+		tw.writeI32Field(3, se.repetitionType)
+	}
+	tw.writeBinaryField(4, se.name)
+	if se.numChildren > 0 {
+		tw.writeI32Field(5, se.numChildren)
+	}
+	if se.hasConvertedType {
+		tw.writeI32Field(6, se.convertedType)
+	}
+	if se.hasLogicalType {
+		lt := &se.logicalType
+		tw.writeStructFieldBegin(10)
+		switch {
+		case lt.isString:
+			tw.writeStructFieldBegin(1)
+			tw.writeStructEnd()
+		case lt.isTimestamp:
+			tw.writeStructFieldBegin(8)
+			tw.writeBoolField(1, true)
+			tw.writeStructFieldBegin(2)
+			tw.writeStructFieldBegin(int16(lt.timeUnit))
+			tw.writeStructEnd()
+			tw.writeStructEnd()
+			tw.writeStructEnd()
+		}
+		tw.writeStructEnd()
+	}
+	tw.writeStructEnd()
+}
+
+func (rg *rowGroup) marshal(tw *thriftWriter) {
+	tw.writeStructBegin()
+	tw.writeListFieldBegin(1, thriftTypeStruct, len(rg.columns))
+	for i := range rg.columns {
+		rg.columns[i].marshal(tw)
+	}
+	tw.writeI64Field(2, rg.totalByteSize)
+	tw.writeI64Field(3, rg.numRows)
+	tw.writeStructEnd()
+}
+
+func (cc *columnChunk) marshal(tw *thriftWriter) {
+	tw.writeStructBegin()
+	tw.writeI64Field(2, cc.fileOffset)
+	tw.writeStructFieldBegin(3)
+	cmd := &cc.metaData
+	tw.writeI32Field(1, cmd.typ)
+	tw.writeListFieldBegin(2, thriftTypeI32, len(cmd.encodings))
+	for _, e := range cmd.encodings {
+		tw.writeVarint(int64(e))
+	}
+	tw.writeListFieldBegin(3, thriftTypeBinary, len(cmd.pathInSchema))
+	for _, s := range cmd.pathInSchema {
+		tw.writeBinary(s)
+	}
+	tw.writeI32Field(4, cmd.codec)
+	tw.writeI64Field(5, cmd.numValues)
+	tw.writeI64Field(6, cmd.totalUncompressedSize)
+	tw.writeI64Field(7, cmd.totalCompressedSize)
+	tw.writeI64Field(9, cmd.dataPageOffset)
+	tw.writeStructEnd()
+	tw.writeStructEnd()
+}
+
+func (ph *pageHeader) marshal(tw *thriftWriter) {
+	tw.writeStructBegin()
+	tw.writeI32Field(1, ph.typ)
+	tw.writeI32Field(2, ph.uncompressedPageSize)
+	tw.writeI32Field(3, ph.compressedPageSize)
+	tw.writeStructFieldBegin(5)
+	tw.writeI32Field(1, ph.numValues)
+	tw.writeI32Field(2, ph.encoding)
+	tw.writeI32Field(3, ph.definitionLevelEncoding)
+	tw.writeI32Field(4, encodingRLE)
+	tw.writeStructEnd()
+	tw.writeStructEnd()
+}
+
+func (fmd *fileMetaData) unmarshal(tr *thriftReader) error {
+	return tr.readStruct(func(id int16, typ byte) error {
+		var err error
+		switch id {
+		case 1:
+			fmd.version, err = tr.readI32Field(typ)
+		case 2:
+			err = tr.readList(typ, func(elemType byte) error {
+				if elemType != thriftTypeStruct {
+					return fmt.Errorf("unexpected type for schema element: %d", elemType)
+				}
+				var se schemaElement
+				if err := se.unmarshal(tr); err != nil {
+					return fmt.Errorf("cannot read schema element: %w", err)
+				}
+				fmd.schema = append(fmd.schema, se)
+				return nil
+			})
+		case 3:
+			fmd.numRows, err = tr.readI64Field(typ)
+		case 4:
+			err = tr.readList(typ, func(elemType byte) error {
+				if elemType != thriftTypeStruct {
+					return fmt.Errorf("unexpected type for row group: %d", elemType)
+				}
+				var rg rowGroup
+				if err := rg.unmarshal(tr); err != nil {
+					return fmt.Errorf("cannot read row group: %w", err)
+				}
+				fmd.rowGroups = append(fmd.rowGroups, rg)
+				return nil
+			})
+		case 6:
+			fmd.createdBy, err = tr.readBinaryField(typ)
+		default:
+			err = tr.skip(typ)
+		}
+		return err
+	})
+}
+
+func (se *schemaElement) unmarshal(tr *thriftReader) error {
+	return tr.readStruct(func(id int16, typ byte) error {
+		var err error
+		switch id {
+		case 1:
+			se.typ, err = tr.readI32Field(typ)
+			se.hasType = true
+		case 2:
+			se.typeLength, err = tr.readI32Field(typ)
+		case 3:
+			se.repetitionType, err = tr.readI32Field(typ)
+		case 4:
+			se.name, err = tr.readBinaryField(typ)
+		case 5:
+			se.numChildren, err = tr.readI32Field(typ)
+		case 6:
+			se.convertedType, err = tr.readI32Field(typ)
+			se.hasConvertedType = true
+		case 7:
+			se.scale, err = tr.readI32Field(typ)
+		case 10:
+			if typ != thriftTypeStruct {
+				return fmt.Errorf("unexpected type for logicalType: %d", typ)
+			}
+			err = se.logicalType.unmarshal(tr)
+			se.hasLogicalType = true
+		default:
+			err = tr.skip(typ)
+		}
+		return err
+	})
+}
+
+func (lt *logicalType) unmarshal(tr *thriftReader) error {
+	return tr.readStruct(func(id int16, typ byte) error {
+		if typ != thriftTypeStruct {
+			return tr.skip(typ)
+		}
+		switch id {
+		case 1:
+			lt.isString = true
+		case 4:
+			// ENUM is stored as a string
+			lt.isString = true
+		case 5:
+			lt.isDecimal = true
+			return tr.readStruct(func(id int16, typ byte) error {
+				var err error
+				switch id {
+				case 1:
+					lt.scale, err = tr.readI32Field(typ)
+				default:
+					err = tr.skip(typ)
+				}
+				return err
+			})
+		case 6:
+			lt.isDate = true
+		case 7, 8:
+			if id == 7 {
+				lt.isTime = true
+			} else {
+				lt.isTimestamp = true
+			}
+			return tr.readStruct(func(id int16, typ byte) error {
+				if id != 2 || typ != thriftTypeStruct {
+					return tr.skip(typ)
+				}
+				return tr.readStruct(func(id int16, typ byte) error {
+					switch id {
+					case 1:
+						lt.timeUnit = timeUnitMillis
+					case 2:
+						lt.timeUnit = timeUnitMicros
+					case 3:
+						lt.timeUnit = timeUnitNanos
+					}
+					return tr.skip(typ)
+				})
+			})
+		case 10:
+			return tr.readStruct(func(id int16, typ byte) error {
+				if id == 2 {
+					isSigned, err := tr.readBoolField(typ)
+					lt.isUnsigned = !isSigned
+					return err
+				}
+				return tr.skip(typ)
+			})
+		case 14:
+			lt.isUUID = true
+		}
+		return tr.skip(typ)
+	})
+}
+
+func (rg *rowGroup) unmarshal(tr *thriftReader) error {
+	return tr.readStruct(func(id int16, typ byte) error {
+		var err error
+		switch id {
+		case 1:
+			err = tr.readList(typ, func(elemType byte) error {
+				if elemType != thriftTypeStruct {
+					return fmt.Errorf("unexpected type for column chunk: %d", elemType)
+				}
+				var cc columnChunk
+				if err := cc.unmarshal(tr); err != nil {
+					return fmt.Errorf("cannot read column chunk: %w", err)
+				}
+				rg.columns = append(rg.columns, cc)
+				return nil
+			})
+		case 2:
+			rg.totalByteSize, err = tr.readI64Field(typ)
+		case 3:
+			rg.numRows, err = tr.readI64Field(typ)
+		default:
+			err = tr.skip(typ)
+		}
+		return err
+	})
+}
+
+func (cc *columnChunk) unmarshal(tr *thriftReader) error {
+	return tr.readStruct(func(id int16, typ byte) error {
+		var err error
+		switch id {
+		case 1:
+			cc.filePath, err = tr.readBinaryField(typ)
+		case 2:
+			cc.fileOffset, err = tr.readI64Field(typ)
+		case 3:
+			if typ != thriftTypeStruct {
+				return fmt.Errorf("unexpected type for column metadata: %d", typ)
+			}
+			err = cc.metaData.unmarshal(tr)
+		default:
+			err = tr.skip(typ)
+		}
+		return err
+	})
+}
+
+func (cmd *columnMetaData) unmarshal(tr *thriftReader) error {
+	return tr.readStruct(func(id int16, typ byte) error {
+		var err error
+		switch id {
+		case 1:
+			cmd.typ, err = tr.readI32Field(typ)
+		case 2:
+			err = tr.readList(typ, func(elemType byte) error {
+				n, err := tr.readListElemInt(elemType)
+				cmd.encodings = append(cmd.encodings, int32(n))
+				return err
+			})
+		case 3:
+			err = tr.readList(typ, func(elemType byte) error {
+				if elemType != thriftTypeBinary {
+					return fmt.Errorf("unexpected type for path in schema: %d", elemType)
+				}
+				s, err := tr.readBinary()
+				cmd.pathInSchema = append(cmd.pathInSchema, s)
+				return err
+			})
+		case 4:
+			cmd.codec, err = tr.readI32Field(typ)
+		case 5:
+			cmd.numValues, err = tr.readI64Field(typ)
+		case 6:
+			cmd.totalUncompressedSize, err = tr.readI64Field(typ)
+		case 7:
+			cmd.totalCompressedSize, err = tr.readI64Field(typ)
+		case 9:
+			cmd.dataPageOffset, err = tr.readI64Field(typ)
+		case 11:
+			cmd.dictionaryPageOffset, err = tr.readI64Field(typ)
+			cmd.hasDictionaryPage = true
+		default:
+			err = tr.skip(typ)
+		}
+		return err
+	})
+}
+
+func (ph *pageHeader) unmarshal(tr *thriftReader) error {
+	// is_compressed is true by default for data page v2
+	ph.isCompressed = true
+	return tr.readStruct(func(id int16, typ byte) error {
+		var err error
+		switch id {
+		case 1:
+			ph.typ, err = tr.readI32Field(typ)
+		case 2:
+			ph.uncompressedPageSize, err = tr.readI32Field(typ)
+		case 3:
+			ph.compressedPageSize, err = tr.readI32Field(typ)
+		case 5:
+			if typ != thriftTypeStruct {
+				return fmt.Errorf("unexpected type for data page header: %d", typ)
+			}
+			err = tr.readStruct(func(id int16, typ byte) error {
+				var err error
+				switch id {
+				case 1:
+					ph.numValues, err = tr.readI32Field(typ)
+				case 2:
+					ph.encoding, err = tr.readI32Field(typ)
+				case 3:
+					ph.definitionLevelEncoding, err = tr.readI32Field(typ)
+				default:
+					err = tr.skip(typ)
+				}
+				return err
+			})
+		case 7:
+			if typ != thriftTypeStruct {
+				return fmt.Errorf("unexpected type for dictionary page header: %d", typ)
+			}
+			err = tr.readStruct(func(id int16, typ byte) error {
+				var err error
+				switch id {
+				case 1:
+					ph.numValues, err = tr.readI32Field(typ)
+				case 2:
+					ph.encoding, err = tr.readI32Field(typ)
+				default:
+					err = tr.skip(typ)
+				}
+				return err
+			})
+		case 8:
+			if typ != thriftTypeStruct {
+				return fmt.Errorf("unexpected type for data page v2 header: %d", typ)
+			}
+			err = tr.readStruct(func(id int16, typ byte) error {
+				var err error
+				switch id {
+				case 1:
+					ph.numValues, err = tr.readI32Field(typ)
+				case 2:
+					ph.numNulls, err = tr.readI32Field(typ)
+				case 3:
+					ph.numRows, err = tr.readI32Field(typ)
+				case 4:
+					ph.encoding, err = tr.readI32Field(typ)
+				case 5:
+					ph.definitionLevelsByteLength, err = tr.readI32Field(typ)
+				case 6:
+					ph.repetitionLevelsByteLength, err = tr.readI32Field(typ)
+				case 7:
+					ph.isCompressed, err = tr.readBoolField(typ)
+				default:
+					err = tr.skip(typ)
+				}
+				return err
+			})
+		default:
+			err = tr.skip(typ)
+		}
+		return err
+	})
+}
@@ -0,0 +1,302 @@
+package parquet
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+func TestWriterReader(t *testing.T) {
+	f := func(codec Codec, rowGroupRows int, rows [][]logstorage.Field) {
+		t.Helper()
+
+		var bb bytes.Buffer
+		pw := NewWriter(&bb, codec)
+		pw.maxRowGroupRows = rowGroupRows
+		for _, fields := range rows {
+			if err := pw.WriteRow(fields); err != nil {
+				t.Fatalf("unexpected error when writing row: %s", err)
+			}
+		}
+		if err := pw.Close(); err != nil {
+			t.Fatalf("unexpected error when closing writer: %s", err)
+		}
+
+		pr, err := NewReader(bb.Bytes())
+		if err != nil {
+			t.Fatalf("cannot open reader: %s", err)
+		}
+		if n := pr.RowsCount(); n != int64(len(rows)) {
+			t.Fatalf("unexpected number of rows; got %d; want %d", n, len(rows))
+		}
+		var result [][]logstorage.Field
+		err = pr.ForEachRow(func(fields []logstorage.Field) error {
+			result = append(result, append([]logstorage.Field{}, fields...))
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error when reading rows: %s", err)
+		}
+
+		// Missing and empty fields must be skipped. Fields are returned in the order of columns in the schema.
+		var resultExpected [][]logstorage.Field
+		columnIdxs := make(map[string]int)
+		for _, fields := range rows {
+			for _, f := range fields {
+				if _, ok := columnIdxs[f.Name]; !ok && f.Value != "" {
+					columnIdxs[f.Name] = len(columnIdxs)
+				}
+			}
+		}
+		for _, fields := range rows {
+			row := make([]logstorage.Field, len(columnIdxs))
+			for _, f := range fields {
+				if f.Value != "" {
+					row[columnIdxs[f.Name]] = f
+				}
+			}
+			var expected []logstorage.Field
+			for _, f := range row {
+				if f.Value != "" {
+					expected = append(expected, f)
+				}
+			}
+			resultExpected = append(resultExpected, expected)
+		}
+		if len(result) != len(resultExpected) {
+			t.Fatalf("unexpected number of rows read; got %d; want %d", len(result), len(resultExpected))
+		}
+		for i := range result {
+			if len(result[i]) == 0 && len(resultExpected[i]) == 0 {
+				continue
+			}
+			if !reflect.DeepEqual(result[i], resultExpected[i]) {
+				t.Fatalf("unexpected row #%d\ngot\n%v\nwant\n%v", i, result[i], resultExpected[i])
+			}
+		}
+	}
+
+	// Empty file
+	f(CodecUncompressed, 10, nil)
+
+	rows := [][]logstorage.Field{
+		{
+			{Name: "_time", Value: "2025-01-02T03:04:05.123456789Z"},
+			{Name: "_msg", Value: "foo bar"},
+			{Name: "level", Value: "info"},
+		},
+		{
+			{Name: "_msg", Value: "baz"},
+			{Name: "empty", Value: ""},
+		},
+		{
+			{Name: "_time", Value: "2025-01-02T03:04:06Z"},
+			{Name: "host", Value: "host-1"},
+			{Name: "_msg", Value: "new field"},
+		},
+	}
+	for _, codec := range []Codec{CodecUncompressed, CodecSnappy, CodecGzip, CodecZstd} {
+		f(codec, 100, rows)
+	}
+
+	// Multiple row groups with columns missing at the first row groups
+	var manyRows [][]logstorage.Field
+	for i := 0; i < 100; i++ {
+		fields := []logstorage.Field{
+			{Name: "_msg", Value: fmt.Sprintf("message %d", i)},
+		}
+		if i >= 50 {
+			fields = append(fields, logstorage.Field{
+				Name:  fmt.Sprintf("field_%d", i%3),
+				Value: fmt.Sprintf("value %d", i),
+			})
+		}
+		manyRows = append(manyRows, fields)
+	}
+	f(CodecZstd, 7, manyRows)
+	f(CodecSnappy, 1000, manyRows)
+}
+
+func TestReaderInvalidData(t *testing.T) {
+	f := func(data []byte) {
+		t.Helper()
+
+		if _, err := NewReader(data); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	f(nil)
+	f([]byte("foobar"))
+	f([]byte("PAR1\x00\x00\x00\x00PAR2"))
+	f([]byte("PAR1\xff\x00\x00\x00PAR1"))
+	f([]byte("PAR1\x05\x00\x00\x00\x00\x00\x00\x00PAR1"))
+}
+
+func TestReaderMalformedPages(t *testing.T) {
+	var bb bytes.Buffer
+	pw := NewWriter(&bb, CodecUncompressed)
+	for i := 0; i < 10; i++ {
+		fields := []logstorage.Field{
+			{Name: "_msg", Value: fmt.Sprintf("message %d", i)},
+		}
+		if err := pw.WriteRow(fields); err != nil {
+			t.Fatalf("unexpected error when writing row: %s", err)
+		}
+	}
+	if err := pw.Close(); err != nil {
+		t.Fatalf("unexpected error when closing writer: %s", err)
+	}
+
+	f := func(numRows int64, maxDef int) {
+		t.Helper()
+
+		pr, err := NewReader(bb.Bytes())
+		if err != nil {
+			t.Fatalf("cannot open reader: %s", err)
+		}
+
+		// Simulate the footer with the number of rows smaller than the number of values in data pages.
+		pr.fmd.rowGroups[0].numRows = numRows
+		for _, cr := range pr.columns {
+			cr.maxDef = maxDef
+		}
+		err = pr.ForEachRow(func(_ []logstorage.Field) error {
+			return nil
+		})
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		if !strings.Contains(err.Error(), "too big number of values in data page") {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	// optional columns
+	f(3, 1)
+	f(9, 1)
+
+	// required columns
+	f(3, 0)
+	f(9, 0)
+}
+
+func TestReadRLEBitPackedHybridInvalidData(t *testing.T) {
+	f := func(data []byte, bitWidth, n int) {
+		t.Helper()
+
+		if _, _, err := readRLEBitPackedHybrid(nil, data, bitWidth, n); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// invalid bit width
+	f([]byte{0x02, 0x01}, 33, 1)
+	f([]byte{0x02, 0x01}, -1, 1)
+
+	// invalid number of values
+	f([]byte{0x02, 0x01}, 1, -1)
+
+	// missing run header
+	f(nil, 1, 1)
+
+	// truncated run header
+	f([]byte{0x80}, 1, 1)
+
+	// missing RLE value
+	f([]byte{0x02}, 8, 1)
+
+	// truncated bit-packed run
+	f([]byte{0x05, 0xff}, 3, 16)
+
+	// not enough values
+	f([]byte{0x02, 0x01}, 1, 2)
+}
+
+func TestRLEBitPackedHybrid(t *testing.T) {
+	f := func(levels []uint32, bitWidth int) {
+		t.Helper()
+
+		data := appendRLEBitPackedHybrid(nil, levels, bitWidth)
+		result, tail, err := readRLEBitPackedHybrid(nil, data, bitWidth, len(levels))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(tail) > 0 {
+			t.Fatalf("unexpected tail left: %X", tail)
+		}
+		if len(levels) == 0 && len(result) == 0 {
+			return
+		}
+		if !reflect.DeepEqual(result, levels) {
+			t.Fatalf("unexpected levels\ngot\n%v\nwant\n%v", result, levels)
+		}
+	}
+
+	f(nil, 1)
+	f([]uint32{1}, 1)
+	f([]uint32{0, 0, 0}, 1)
+	f([]uint32{1, 0, 1, 1, 0, 0, 0, 1, 1}, 1)
+	f([]uint32{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}, 1)
+	f([]uint32{3, 2, 1, 0, 7, 7, 7, 7, 7, 7, 7, 7, 7, 5}, 3)
+
+	var levels []uint32
+	for i := 0; i < 2000; i++ {
+		levels = append(levels, uint32(i%3))
+	}
+	f(levels, 2)
+}
+
+func TestReadDeltaBinaryPacked(t *testing.T) {
+	f := func(data []byte, resultExpected []int64) {
+		t.Helper()
+
+		result, tail, err := readDeltaBinaryPacked(nil, data)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(tail) > 0 {
+			t.Fatalf("unexpected tail left: %X", tail)
+		}
+		if !reflect.DeepEqual(result, resultExpected) {
+			t.Fatalf("unexpected result\ngot\n%v\nwant\n%v", result, resultExpected)
+		}
+	}
+
+	// Examples from https://parquet.apache.org/docs/file-format/data-pages/encodings/#delta-encoding-delta_binary_packed--5
+	f([]byte{0x80, 0x01, 0x04, 0x05, 0x02, 0x02, 0x00, 0x00, 0x00, 0x00}, []int64{1, 2, 3, 4, 5})
+	f([]byte{0x80, 0x01, 0x04, 0x08, 0x0e, 0x03, 0x02, 0x00, 0x00, 0x00, 0xc0, 0x3f, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, []int64{7, 5, 3, 1, 2, 3, 4, 5})
+
+	// Single value
+	f([]byte{0x80, 0x01, 0x04, 0x01, 0x0e}, []int64{7})
+}
+
+func TestFormatDecimal(t *testing.T) {
+	f := func(n int64, scale int, resultExpected string) {
+		t.Helper()
+
+		cr := &columnReader{
+			se: &schemaElement{
+				typ:              typeInt64,
+				hasConvertedType: true,
+				convertedType:    convertedTypeDecimal,
+				scale:            int32(scale),
+			},
+		}
+		result := cr.formatInt64(n)
+		if result != resultExpected {
+			t.Fatalf("unexpected result; got %q; want %q", result, resultExpected)
+		}
+	}
+
+	f(0, 0, "0")
+	f(12345, 0, "12345")
+	f(12345, 2, "123.45")
+	f(-12345, 2, "-123.45")
+	f(5, 3, "0.005")
+	f(-5, 3, "-0.005")
+}
@@ -0,0 +1,691 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+// Reader reads logs from Parquet data.
+//
+// Only flat schemas are supported. Nested optional groups are flattened into columns with dot-separated names.
+// Repeated fields aren't supported.
+type Reader struct {
+	data []byte
+	fmd  fileMetaData
+
+	columns []*columnReader
+}
+
+// columnReader reads values for a single leaf column.
+type columnReader struct {
+	// name is dot-separated path to the column in the schema.
+	name string
+
+	se *schemaElement
+
+	// maxDef is the maximum definition level for the column.
+	maxDef int
+}
+
+// columnData contains decoded values for a single column chunk.
+type columnData struct {
+	// defs contains definition levels per each row.
+	defs []uint32
+
+	// values contains non-null values.
+	values []string
+}
+
+// NewReader returns Reader for the given Parquet data.
+func NewReader(data []byte) (*Reader, error) {
+	if len(data) < 2*len(magic)+4 {
+		return nil, fmt.Errorf("too short Parquet data; got %d bytes", len(data))
+	}
+	if string(data[:len(magic)]) != magic || string(data[len(data)-len(magic):]) != magic {
+		return nil, fmt.Errorf("missing %q magic at the start or at the end of Parquet data", magic)
+	}
+	footerLen := binary.LittleEndian.Uint32(data[len(data)-len(magic)-4:])
+	footerEnd := len(data) - len(magic) - 4
+	if uint64(footerLen) > uint64(footerEnd-len(magic)) {
+		return nil, fmt.Errorf("too big Parquet footer length: %d bytes; file size: %d bytes", footerLen, len(data))
+	}
+	footer := data[footerEnd-int(footerLen) : footerEnd]
+
+	pr := &Reader{
+		data: data,
+	}
+	tr := thriftReader{
+		src: footer,
+	}
+	if err := pr.fmd.unmarshal(&tr); err != nil {
+		return nil, fmt.Errorf("cannot read Parquet footer: %w", err)
+	}
+	if err := pr.initColumns(); err != nil {
+		return nil, err
+	}
+	return pr, nil
+}
+
+// RowsCount returns the number of rows in pr.
+func (pr *Reader) RowsCount() int64 {
+	return pr.fmd.numRows
+}
+
+func (pr *Reader) initColumns() error {
+	schema := pr.fmd.schema
+	if len(schema) == 0 {
+		return fmt.Errorf("missing schema in Parquet footer")
+	}
+
+	idx := 1
+	var walk func(path string, maxDef int, numChildren int32) error
+	walk = func(path string, maxDef int, numChildren int32) error {
+		if numChildren < 0 || int(numChildren) > len(schema)-idx {
+			return fmt.Errorf("invalid number of children in Parquet schema: %d", numChildren)
+		}
+		for i := int32(0); i < numChildren; i++ {
+			se := &schema[idx]
+			idx++
+
+			name := se.name
+			if path != "" {
+				name = path + "." + se.name
+			}
+			if se.repetitionType == repetitionRepeated {
+				return fmt.Errorf("repeated column %q isn't supported", name)
+			}
+			def := maxDef
+			if se.repetitionType == repetitionOptional {
+				def++
+			}
+			if se.numChildren > 0 {
+				if err := walk(name, def, se.numChildren); err != nil {
+					return err
+				}
+				continue
+			}
+			if !se.hasType {
+				return fmt.Errorf("missing type for column %q", name)
+			}
+			pr.columns = append(pr.columns, &columnReader{
+				name:   name,
+				se:     se,
+				maxDef: def,
+			})
+		}
+		return nil
+	}
+	return walk("", 0, schema[0].numChildren)
+}
+
+// ForEachRow calls f for every row in pr.
+//
+// Null values are skipped. f mustn't hold references to fields after returning.
+func (pr *Reader) ForEachRow(f func(fields []logstorage.Field) error) error {
+	var fields []logstorage.Field
+	var cds []*columnData
+	var valueIdxs []int
+	for rgIdx := range pr.fmd.rowGroups {
+		rg := &pr.fmd.rowGroups[rgIdx]
+		if len(rg.columns) != len(pr.columns) {
+			return fmt.Errorf("unexpected number of columns in row group #%d; got %d; want %d", rgIdx, len(rg.columns), len(pr.columns))
+		}
+		cds = cds[:0]
+		for i, cr := range pr.columns {
+			cd, err := cr.readColumnChunk(pr.data, &rg.columns[i], rg.numRows)
+			if err != nil {
+				return fmt.Errorf("cannot read column %q at row group #%d: %w", cr.name, rgIdx, err)
+			}
+			cds = append(cds, cd)
+		}
+
+		valueIdxs = valueIdxs[:0]
+		for range cds {
+			valueIdxs = append(valueIdxs, 0)
+		}
+		for rowIdx := 0; rowIdx < int(rg.numRows); rowIdx++ {
+			fields = fields[:0]
+			for i, cd := range cds {
+				if cd.defs[rowIdx] != uint32(pr.columns[i].maxDef) {
+					continue
+				}
+				v := cd.values[valueIdxs[i]]
+				valueIdxs[i]++
+				if v == "" {
+					continue
+				}
+				fields = append(fields, logstorage.Field{
+					Name:  pr.columns[i].name,
+					Value: v,
+				})
+			}
+			if err := f(fields); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (cr *columnReader) readColumnChunk(data []byte, cc *columnChunk, numRows int64) (*columnData, error) {
+	if cc.filePath != "" {
+		return nil, fmt.Errorf("column chunks stored in external files aren't supported; file_path=%q", cc.filePath)
+	}
+	cmd := &cc.metaData
+	if cmd.typ != cr.se.typ {
+		return nil, fmt.Errorf("unexpected column type; got %d; want %d", cmd.typ, cr.se.typ)
+	}
+	start := cmd.dataPageOffset
+	if cmd.hasDictionaryPage && cmd.dictionaryPageOffset > 0 && cmd.dictionaryPageOffset < start {
+		start = cmd.dictionaryPageOffset
+	}
+	end := start + cmd.totalCompressedSize
+	if start < int64(len(magic)) || cmd.totalCompressedSize < 0 || end > int64(len(data)) {
+		return nil, fmt.Errorf("invalid column chunk bounds [%d..%d]; file size: %d bytes", start, end, len(data))
+	}
+	if numRows < 0 || numRows > int64(len(data))*8 {
+		return nil, fmt.Errorf("invalid number of rows: %d", numRows)
+	}
+	src := data[start:end]
+	codec := Codec(cmd.codec)
+
+	cd := &columnData{}
+	var dict []string
+	var buf []byte
+	for len(cd.defs) < int(numRows) {
+		if len(src) == 0 {
+			return nil, fmt.Errorf("unexpected end of column chunk; read %d rows out of %d rows", len(cd.defs), numRows)
+		}
+		tr := thriftReader{
+			src: src,
+		}
+		var ph pageHeader
+		if err := ph.unmarshal(&tr); err != nil {
+			return nil, fmt.Errorf("cannot read page header: %w", err)
+		}
+		src = tr.src
+		if ph.compressedPageSize < 0 || int(ph.compressedPageSize) > len(src) {
+			return nil, fmt.Errorf("invalid compressed page size: %d bytes; %d bytes left in column chunk", ph.compressedPageSize, len(src))
+		}
+		if ph.uncompressedPageSize < 0 || ph.uncompressedPageSize > maxPageSize {
+			return nil, fmt.Errorf("invalid uncompressed page size: %d bytes", ph.uncompressedPageSize)
+		}
+		if ph.numValues < 0 {
+			return nil, fmt.Errorf("invalid number of values in page: %d", ph.numValues)
+		}
+		if ph.typ != pageTypeDictionary && int64(ph.numValues) > numRows-int64(len(cd.defs)) {
+			// Reject the page before decoding definition levels, since otherwise malformed page could result in big memory allocations.
+			return nil, fmt.Errorf("too big number of values in data page: %d; only %d rows left out of %d rows", ph.numValues, numRows-int64(len(cd.defs)), numRows)
+		}
+		page := src[:ph.compressedPageSize]
+		src = src[ph.compressedPageSize:]
+
+		var err error
+		switch ph.typ {
+		case pageTypeDictionary:
+			buf, err = codec.decompress(buf[:0], page)
+			if err != nil {
+				return nil, fmt.Errorf("cannot decompress dictionary page: %w", err)
+			}
+			if ph.encoding != encodingPlain && ph.encoding != encodingPlainDictionary {
+				return nil, fmt.Errorf("unsupported dictionary page encoding: %d", ph.encoding)
+			}
+			dict, _, err = cr.readPlain(dict[:0], buf, int(ph.numValues))
+			if err != nil {
+				return nil, fmt.Errorf("cannot read dictionary page: %w", err)
+			}
+		case pageTypeData:
+			buf, err = codec.decompress(buf[:0], page)
+			if err != nil {
+				return nil, fmt.Errorf("cannot decompress data page: %w", err)
+			}
+			tail := buf
+			defsLen := len(cd.defs)
+			if cr.maxDef > 0 {
+				if ph.definitionLevelEncoding != encodingRLE {
+					return nil, fmt.Errorf("unsupported definition level encoding: %d", ph.definitionLevelEncoding)
+				}
+				if len(tail) < 4 {
+					return nil, fmt.Errorf("cannot read definition levels length")
+				}
+				n := binary.LittleEndian.Uint32(tail)
+				tail = tail[4:]
+				if uint64(n) > uint64(len(tail)) {
+					return nil, fmt.Errorf("too big definition levels length: %d bytes; %d bytes left", n, len(tail))
+				}
+				cd.defs, _, err = readRLEBitPackedHybrid(cd.defs, tail[:n], bitWidth(uint32(cr.maxDef)), int(ph.numValues))
+				if err != nil {
+					return nil, fmt.Errorf("cannot read definition levels: %w", err)
+				}
+				tail = tail[n:]
+			} else {
+				cd.defs = appendDefs(cd.defs, 0, int(ph.numValues))
+			}
+			if err := cr.readPageValues(cd, defsLen, tail, ph.encoding, dict); err != nil {
+				return nil, err
+			}
+		case pageTypeDataV2:
+			levelsLen := int(ph.repetitionLevelsByteLength) + int(ph.definitionLevelsByteLength)
+			if ph.repetitionLevelsByteLength < 0 || ph.definitionLevelsByteLength < 0 || levelsLen > len(page) {
+				return nil, fmt.Errorf("invalid levels length in data page v2: %d bytes; page size: %d bytes", levelsLen, len(page))
+			}
+			if ph.repetitionLevelsByteLength > 0 {
+				return nil, fmt.Errorf("repetition levels aren't supported")
+			}
+			defsLen := len(cd.defs)
+			if cr.maxDef > 0 {
+				cd.defs, _, err = readRLEBitPackedHybrid(cd.defs, page[:levelsLen], bitWidth(uint32(cr.maxDef)), int(ph.numValues))
+				if err != nil {
+					return nil, fmt.Errorf("cannot read definition levels: %w", err)
+				}
+			} else {
+				cd.defs = appendDefs(cd.defs, 0, int(ph.numValues))
+			}
+			values := page[levelsLen:]
+			if ph.isCompressed {
+				buf, err = codec.decompress(buf[:0], values)
+				if err != nil {
+					return nil, fmt.Errorf("cannot decompress data page: %w", err)
+				}
+				values = buf
+			}
+			if err := cr.readPageValues(cd, defsLen, values, ph.encoding, dict); err != nil {
+				return nil, err
+			}
+		default:
+			// Skip index pages and unknown pages
+		}
+	}
+	if len(cd.defs) != int(numRows) {
+		return nil, fmt.Errorf("unexpected number of values in column chunk; got %d; want %d", len(cd.defs), numRows)
+	}
+	return cd, nil
+}
+
+func appendDefs(dst []uint32, v uint32, n int) []uint32 {
+	for i := 0; i < n; i++ {
+		dst = append(dst, v)
+	}
+	return dst
+}
+
+// readPageValues reads non-null values for the definition levels starting from defsStart in cd.defs.
+func (cr *columnReader) readPageValues(cd *columnData, defsStart int, src []byte, encoding int32, dict []string) error {
+	n := 0
+	for _, def := range cd.defs[defsStart:] {
+		if def == uint32(cr.maxDef) {
+			n++
+		}
+	}
+
+	var err error
+	switch encoding {
+	case encodingPlain:
+		cd.values, _, err = cr.readPlain(cd.values, src, n)
+	case encodingPlainDictionary, encodingRLEDictionary:
+		cd.values, err = readDictionaryValues(cd.values, src, n, dict)
+	case encodingRLE:
+		cd.values, err = cr.readRLEBooleans(cd.values, src, n)
+	case encodingDeltaBinaryPacked:
+		cd.values, err = cr.readDeltaBinaryPacked(cd.values, src, n)
+	case encodingDeltaLengthByteArray:
+		cd.values, err = cr.readDeltaLengthByteArray(cd.values, src, n)
+	case encodingDeltaByteArray:
+		cd.values, err = cr.readDeltaByteArray(cd.values, src, n)
+	case encodingByteStreamSplit:
+		cd.values, err = cr.readByteStreamSplit(cd.values, src, n)
+	default:
+		err = fmt.Errorf("unsupported encoding: %d", encoding)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read values for data page: %w", err)
+	}
+	return nil
+}
+
+func readDictionaryValues(dst []string, src []byte, n int, dict []string) ([]string, error) {
+	if n == 0 {
+		return dst, nil
+	}
+	if len(src) == 0 {
+		return dst, fmt.Errorf("missing bit width for dictionary indexes")
+	}
+	bw := int(src[0])
+	idxs, _, err := readRLEBitPackedHybrid(nil, src[1:], bw, n)
+	if err != nil {
+		return dst, fmt.Errorf("cannot read dictionary indexes: %w", err)
+	}
+	for _, idx := range idxs {
+		if int(idx) >= len(dict) {
+			return dst, fmt.Errorf("too big dictionary index: %d; dictionary size: %d", idx, len(dict))
+		}
+		dst = append(dst, dict[idx])
+	}
+	return dst, nil
+}
+
+func (cr *columnReader) readRLEBooleans(dst []string, src []byte, n int) ([]string, error) {
+	if cr.se.typ != typeBoolean {
+		return dst, fmt.Errorf("RLE encoding is supported only for BOOLEAN type")
+	}
+	if len(src) < 4 {
+		return dst, fmt.Errorf("cannot read RLE data length")
+	}
+	size := binary.LittleEndian.Uint32(src)
+	src = src[4:]
+	if uint64(size) > uint64(len(src)) {
+		return dst, fmt.Errorf("too big RLE data length: %d bytes; %d bytes left", size, len(src))
+	}
+	vs, _, err := readRLEBitPackedHybrid(nil, src[:size], 1, n)
+	if err != nil {
+		return dst, err
+	}
+	for _, v := range vs {
+		dst = append(dst, strconv.FormatBool(v != 0))
+	}
+	return dst, nil
+}
+
+func (cr *columnReader) readDeltaBinaryPacked(dst []string, src []byte, n int) ([]string, error) {
+	vs, _, err := readDeltaBinaryPacked(nil, src)
+	if err != nil {
+		return dst, err
+	}
+	if len(vs) < n {
+		return dst, fmt.Errorf("unexpected number of values; got %d; want %d", len(vs), n)
+	}
+	for _, v := range vs[:n] {
+		switch cr.se.typ {
+		case typeInt32:
+			dst = append(dst, cr.formatInt32(int32(v)))
+		case typeInt64:
+			dst = append(dst, cr.formatInt64(v))
+		default:
+			return dst, fmt.Errorf("DELTA_BINARY_PACKED encoding isn't supported for type %d", cr.se.typ)
+		}
+	}
+	return dst, nil
+}
+
+func (cr *columnReader) readDeltaLengthByteArray(dst []string, src []byte, n int) ([]string, error) {
+	if cr.se.typ != typeByteArray {
+		return dst, fmt.Errorf("DELTA_LENGTH_BYTE_ARRAY encoding is supported only for BYTE_ARRAY type")
+	}
+	dstLen := len(dst)
+	dst, _, err := readDeltaLengthByteArray(dst, src, n)
+	if err != nil {
+		return dst, err
+	}
+	for i := dstLen; i < len(dst); i++ {
+		dst[i] = cr.formatBytes([]byte(dst[i]))
+	}
+	return dst, nil
+}
+
+func (cr *columnReader) readDeltaByteArray(dst []string, src []byte, n int) ([]string, error) {
+	if cr.se.typ != typeByteArray && cr.se.typ != typeFixedLenByteArray {
+		return dst, fmt.Errorf("DELTA_BYTE_ARRAY encoding is supported only for BYTE_ARRAY and FIXED_LEN_BYTE_ARRAY types")
+	}
+	dstLen := len(dst)
+	dst, err := readDeltaByteArray(dst, src, n)
+	if err != nil {
+		return dst, err
+	}
+	for i := dstLen; i < len(dst); i++ {
+		dst[i] = cr.formatBytes([]byte(dst[i]))
+	}
+	return dst, nil
+}
+
+func (cr *columnReader) readByteStreamSplit(dst []string, src []byte, n int) ([]string, error) {
+	width := cr.valueWidth()
+	if width <= 0 {
+		return dst, fmt.Errorf("BYTE_STREAM_SPLIT encoding isn't supported for type %d", cr.se.typ)
+	}
+	if len(src) < n*width {
+		return dst, fmt.Errorf("cannot read %d values with %d bytes each from %d bytes", n, width, len(src))
+	}
+	value := make([]byte, width)
+	for i := 0; i < n; i++ {
+		for j := 0; j < width; j++ {
+			value[j] = src[j*n+i]
+		}
+		dst = append(dst, cr.formatFixedWidthValue(value))
+	}
+	return dst, nil
+}
+
+// valueWidth returns the size of values for fixed-width types.
+//
+// It returns 0 for variable-width types.
+func (cr *columnReader) valueWidth() int {
+	switch cr.se.typ {
+	case typeInt32, typeFloat:
+		return 4
+	case typeInt64, typeDouble:
+		return 8
+	case typeInt96:
+		return 12
+	case typeFixedLenByteArray:
+		return int(cr.se.typeLength)
+	default:
+		return 0
+	}
+}
+
+// readPlain reads n PLAIN-encoded values from src and appends them to dst.
+func (cr *columnReader) readPlain(dst []string, src []byte, n int) ([]string, []byte, error) {
+	switch cr.se.typ {
+	case typeBoolean:
+		if len(src)*8 < n {
+			return dst, src, fmt.Errorf("cannot read %d booleans from %d bytes", n, len(src))
+		}
+		for i := 0; i < n; i++ {
+			v := src[i/8]&(1<<(i%8)) != 0
+			dst = append(dst, strconv.FormatBool(v))
+		}
+		return dst, src[(n+7)/8:], nil
+	case typeByteArray:
+		for i := 0; i < n; i++ {
+			if len(src) < 4 {
+				return dst, src, fmt.Errorf("cannot read BYTE_ARRAY length")
+			}
+			size := binary.LittleEndian.Uint32(src)
+			src = src[4:]
+			if uint64(size) > uint64(len(src)) {
+				return dst, src, fmt.Errorf("too big BYTE_ARRAY length: %d bytes; %d bytes left", size, len(src))
+			}
+			dst = append(dst, cr.formatBytes(src[:size]))
+			src = src[size:]
+		}
+		return dst, src, nil
+	default:
+		width := cr.valueWidth()
+		if width <= 0 {
+			return dst, src, fmt.Errorf("unsupported type: %d", cr.se.typ)
+		}
+		if len(src) < n*width {
+			return dst, src, fmt.Errorf("cannot read %d values with %d bytes each from %d bytes", n, width, len(src))
+		}
+		for i := 0; i < n; i++ {
+			dst = append(dst, cr.formatFixedWidthValue(src[:width]))
+			src = src[width:]
+		}
+		return dst, src, nil
+	}
+}
+
+func (cr *columnReader) formatFixedWidthValue(b []byte) string {
+	switch cr.se.typ {
+	case typeInt32:
+		return cr.formatInt32(int32(binary.LittleEndian.Uint32(b)))
+	case typeInt64:
+		return cr.formatInt64(int64(binary.LittleEndian.Uint64(b)))
+	case typeInt96:
+		// INT96 timestamps: nanoseconds within the day followed by the Julian day
+		nsecs := int64(binary.LittleEndian.Uint64(b))
+		days := int64(binary.LittleEndian.Uint32(b[8:]))
+		const julianDayOfUnixEpoch = 2440588
+		return formatTimestamp((days-julianDayOfUnixEpoch)*24*3600*1e9 + nsecs)
+	case typeFloat:
+		f := math.Float32frombits(binary.LittleEndian.Uint32(b))
+		return strconv.FormatFloat(float64(f), 'g', -1, 32)
+	case typeDouble:
+		f := math.Float64frombits(binary.LittleEndian.Uint64(b))
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	default:
+		return cr.formatBytes(b)
+	}
+}
+
+func (cr *columnReader) timeUnit() int {
+	se := cr.se
+	if se.hasLogicalType && se.logicalType.timeUnit != timeUnitNone {
+		return se.logicalType.timeUnit
+	}
+	if se.hasConvertedType {
+		switch se.convertedType {
+		case convertedTypeTimestampMillis, convertedTypeTimeMillis:
+			return timeUnitMillis
+		case convertedTypeTimestampMicros, convertedTypeTimeMicros:
+			return timeUnitMicros
+		}
+	}
+	return timeUnitNone
+}
+
+func (cr *columnReader) isTimestamp() bool {
+	se := cr.se
+	if se.hasLogicalType && se.logicalType.isTimestamp {
+		return true
+	}
+	return se.hasConvertedType && (se.convertedType == convertedTypeTimestampMillis || se.convertedType == convertedTypeTimestampMicros)
+}
+
+func (cr *columnReader) isTime() bool {
+	se := cr.se
+	if se.hasLogicalType && se.logicalType.isTime {
+		return true
+	}
+	return se.hasConvertedType && (se.convertedType == convertedTypeTimeMillis || se.convertedType == convertedTypeTimeMicros)
+}
+
+func (cr *columnReader) isDecimal() bool {
+	se := cr.se
+	return (se.hasLogicalType && se.logicalType.isDecimal) || (se.hasConvertedType && se.convertedType == convertedTypeDecimal)
+}
+
+func (cr *columnReader) decimalScale() int {
+	se := cr.se
+	if se.hasLogicalType && se.logicalType.isDecimal {
+		return int(se.logicalType.scale)
+	}
+	return int(se.scale)
+}
+
+func (cr *columnReader) isUnsigned() bool {
+	se := cr.se
+	if se.hasLogicalType && se.logicalType.isUnsigned {
+		return true
+	}
+	if !se.hasConvertedType {
+		return false
+	}
+	switch se.convertedType {
+	case convertedTypeUint8, convertedTypeUint16, convertedTypeUint32, convertedTypeUint64:
+		return true
+	default:
+		return false
+	}
+}
+
+func (cr *columnReader) toNanoseconds(v int64) int64 {
+	switch cr.timeUnit() {
+	case timeUnitMillis:
+		return v * 1e6
+	case timeUnitMicros:
+		return v * 1e3
+	default:
+		return v
+	}
+}
+
+func (cr *columnReader) formatInt32(v int32) string {
+	se := cr.se
+	switch {
+	case (se.hasLogicalType && se.logicalType.isDate) || (se.hasConvertedType && se.convertedType == convertedTypeDate):
+		return time.Unix(int64(v)*24*3600, 0).UTC().Format("2006-01-02")
+	case cr.isTime():
+		return formatTimeOfDay(cr.toNanoseconds(int64(v)))
+	case cr.isDecimal():
+		return formatDecimal(big.NewInt(int64(v)), cr.decimalScale())
+	case cr.isUnsigned():
+		return strconv.FormatUint(uint64(uint32(v)), 10)
+	default:
+		return strconv.FormatInt(int64(v), 10)
+	}
+}
+
+func (cr *columnReader) formatInt64(v int64) string {
+	switch {
+	case cr.isTimestamp():
+		return formatTimestamp(cr.toNanoseconds(v))
+	case cr.isTime():
+		return formatTimeOfDay(cr.toNanoseconds(v))
+	case cr.isDecimal():
+		return formatDecimal(big.NewInt(v), cr.decimalScale())
+	case cr.isUnsigned():
+		return strconv.FormatUint(uint64(v), 10)
+	default:
+		return strconv.FormatInt(v, 10)
+	}
+}
+
+func (cr *columnReader) formatBytes(b []byte) string {
+	se := cr.se
+	switch {
+	case cr.isDecimal():
+		n := new(big.Int).SetBytes(b)
+		if len(b) > 0 && b[0]&0x80 != 0 {
+			// Negative two's complement number
+			n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(8*len(b))))
+		}
+		return formatDecimal(n, cr.decimalScale())
+	case se.hasLogicalType && se.logicalType.isUUID && len(b) == 16:
+		s := hex.EncodeToString(b)
+		return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+	default:
+		return string(b)
+	}
+}
+
+func formatTimestamp(nsecs int64) string {
+	return time.Unix(0, nsecs).UTC().Format(time.RFC3339Nano)
+}
+
+func formatTimeOfDay(nsecs int64) string {
+	return time.Unix(0, nsecs).UTC().Format("15:04:05.999999999")
+}
+
+func formatDecimal(n *big.Int, scale int) string {
+	if scale <= 0 {
+		return n.String()
+	}
+	s := new(big.Int).Abs(n).String()
+	if len(s) <= scale {
+		s = strings.Repeat("0", scale-len(s)+1) + s
+	}
+	s = s[:len(s)-scale] + "." + s[len(s)-scale:]
+	if n.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
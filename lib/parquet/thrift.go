@@ -0,0 +1,410 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Thrift compact protocol types.
+//
+// See https://github.com/apache/thrift/blob/master/doc/specs/thrift-compact-protocol.md
+const (
+	thriftTypeStop      = 0
+	thriftTypeBoolTrue  = 1
+	thriftTypeBoolFalse = 2
+	thriftTypeByte      = 3
+	thriftTypeI16       = 4
+	thriftTypeI32       = 5
+	thriftTypeI64       = 6
+	thriftTypeDouble    = 7
+	thriftTypeBinary    = 8
+	thriftTypeList      = 9
+	thriftTypeSet       = 10
+	thriftTypeMap       = 11
+	thriftTypeStruct    = 12
+)
+
+// thriftWriter marshals structs with Thrift compact protocol.
+type thriftWriter struct {
+	buf []byte
+
+	// lastFieldID is the id of the last written field for the current struct.
+	lastFieldID int16
+
+	// fieldIDs contains lastFieldID values for the parent structs.
+	fieldIDs []int16
+}
+
+func (tw *thriftWriter) writeFieldHeader(id int16, typ byte) {
+	delta := id - tw.lastFieldID
+	if delta > 0 && delta <= 15 {
+		tw.buf = append(tw.buf, byte(delta<<4)|typ)
+	} else {
+		tw.buf = append(tw.buf, typ)
+		tw.writeVarint(int64(id))
+	}
+	tw.lastFieldID = id
+}
+
+func (tw *thriftWriter) writeVarint(n int64) {
+	tw.buf = binary.AppendVarint(tw.buf, n)
+}
+
+func (tw *thriftWriter) writeUvarint(n uint64) {
+	tw.buf = binary.AppendUvarint(tw.buf, n)
+}
+
+func (tw *thriftWriter) writeBoolField(id int16, v bool) {
+	if v {
+		tw.writeFieldHeader(id, thriftTypeBoolTrue)
+	} else {
+		tw.writeFieldHeader(id, thriftTypeBoolFalse)
+	}
+}
+
+func (tw *thriftWriter) writeI32Field(id int16, v int32) {
+	tw.writeFieldHeader(id, thriftTypeI32)
+	tw.writeVarint(int64(v))
+}
+
+func (tw *thriftWriter) writeI64Field(id int16, v int64) {
+	tw.writeFieldHeader(id, thriftTypeI64)
+	tw.writeVarint(v)
+}
+
+func (tw *thriftWriter) writeBinaryField(id int16, s string) {
+	tw.writeFieldHeader(id, thriftTypeBinary)
+	tw.writeBinary(s)
+}
+
+func (tw *thriftWriter) writeBinary(s string) {
+	tw.writeUvarint(uint64(len(s)))
+	tw.buf = append(tw.buf, s...)
+}
+
+// writeStructFieldBegin starts writing struct field with the given id.
+//
+// writeStructEnd must be called after writing the struct fields.
+func (tw *thriftWriter) writeStructFieldBegin(id int16) {
+	tw.writeFieldHeader(id, thriftTypeStruct)
+	tw.writeStructBegin()
+}
+
+// writeStructBegin starts writing struct.
+//
+// writeStructEnd must be called after writing the struct fields.
+func (tw *thriftWriter) writeStructBegin() {
+	tw.fieldIDs = append(tw.fieldIDs, tw.lastFieldID)
+	tw.lastFieldID = 0
+}
+
+func (tw *thriftWriter) writeStructEnd() {
+	tw.buf = append(tw.buf, thriftTypeStop)
+	n := len(tw.fieldIDs) - 1
+	tw.lastFieldID = tw.fieldIDs[n]
+	tw.fieldIDs = tw.fieldIDs[:n]
+}
+
+func (tw *thriftWriter) writeListFieldBegin(id int16, elemType byte, size int) {
+	tw.writeFieldHeader(id, thriftTypeList)
+	if size < 15 {
+		tw.buf = append(tw.buf, byte(size<<4)|elemType)
+	} else {
+		tw.buf = append(tw.buf, 0xf0|elemType)
+		tw.writeUvarint(uint64(size))
+	}
+}
+
+// thriftReader unmarshals structs encoded with Thrift compact protocol.
+type thriftReader struct {
+	src []byte
+
+	// lastFieldID is the id of the last read field for the current struct.
+	lastFieldID int16
+
+	// fieldIDs contains lastFieldID values for the parent structs.
+	fieldIDs []int16
+
+	// depth is the current nesting depth. It is used for protecting from stack overflow on malicious input.
+	depth int
+}
+
+const maxThriftDepth = 64
+
+func (tr *thriftReader) readByte() (byte, error) {
+	if len(tr.src) == 0 {
+		return 0, fmt.Errorf("unexpected end of thrift data")
+	}
+	b := tr.src[0]
+	tr.src = tr.src[1:]
+	return b, nil
+}
+
+func (tr *thriftReader) readVarint() (int64, error) {
+	n, size := binary.Varint(tr.src)
+	if size <= 0 {
+		return 0, fmt.Errorf("cannot read varint from thrift data")
+	}
+	tr.src = tr.src[size:]
+	return n, nil
+}
+
+func (tr *thriftReader) readUvarint() (uint64, error) {
+	n, size := binary.Uvarint(tr.src)
+	if size <= 0 {
+		return 0, fmt.Errorf("cannot read uvarint from thrift data")
+	}
+	tr.src = tr.src[size:]
+	return n, nil
+}
+
+func (tr *thriftReader) readI32() (int32, error) {
+	n, err := tr.readVarint()
+	if err != nil {
+		return 0, err
+	}
+	if n < math.MinInt32 || n > math.MaxInt32 {
+		return 0, fmt.Errorf("too big i32 value: %d", n)
+	}
+	return int32(n), nil
+}
+
+func (tr *thriftReader) readBinary() (string, error) {
+	n, err := tr.readUvarint()
+	if err != nil {
+		return "", err
+	}
+	if n > uint64(len(tr.src)) {
+		return "", fmt.Errorf("too big binary length in thrift data: %d bytes; only %d bytes left", n, len(tr.src))
+	}
+	s := string(tr.src[:n])
+	tr.src = tr.src[n:]
+	return s, nil
+}
+
+// readStructBegin starts reading struct.
+//
+// readStructEnd must be called after reading the struct fields.
+func (tr *thriftReader) readStructBegin() error {
+	if tr.depth >= maxThriftDepth {
+		return fmt.Errorf("too deep nesting of thrift structs; it mustn't exceed %d", maxThriftDepth)
+	}
+	tr.depth++
+	tr.fieldIDs = append(tr.fieldIDs, tr.lastFieldID)
+	tr.lastFieldID = 0
+	return nil
+}
+
+func (tr *thriftReader) readStructEnd() {
+	tr.depth--
+	n := len(tr.fieldIDs) - 1
+	tr.lastFieldID = tr.fieldIDs[n]
+	tr.fieldIDs = tr.fieldIDs[:n]
+}
+
+// readFieldHeader reads the next field header for the current struct.
+//
+// It returns thriftTypeStop at the end of the struct.
+func (tr *thriftReader) readFieldHeader() (int16, byte, error) {
+	b, err := tr.readByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	typ := b & 0x0f
+	if typ == thriftTypeStop {
+		return 0, thriftTypeStop, nil
+	}
+	delta := int16(b >> 4)
+	if delta != 0 {
+		tr.lastFieldID += delta
+	} else {
+		id, err := tr.readVarint()
+		if err != nil {
+			return 0, 0, err
+		}
+		tr.lastFieldID = int16(id)
+	}
+	return tr.lastFieldID, typ, nil
+}
+
+func (tr *thriftReader) readListHeader() (byte, int, error) {
+	b, err := tr.readByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	elemType := b & 0x0f
+	size := uint64(b >> 4)
+	if size == 15 {
+		size, err = tr.readUvarint()
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	if size > uint64(len(tr.src)) {
+		// Every list item occupies at least a byte
+		return 0, 0, fmt.Errorf("too big list size in thrift data: %d; only %d bytes left", size, len(tr.src))
+	}
+	return elemType, int(size), nil
+}
+
+// readListElemInt reads integer list element with the given elemType.
+func (tr *thriftReader) readListElemInt(elemType byte) (int64, error) {
+	switch elemType {
+	case thriftTypeI16, thriftTypeI32, thriftTypeI64:
+		return tr.readVarint()
+	default:
+		return 0, fmt.Errorf("unexpected thrift list element type %d; want integer", elemType)
+	}
+}
+
+// skip skips the value with the given type.
+func (tr *thriftReader) skip(typ byte) error {
+	switch typ {
+	case thriftTypeBoolTrue, thriftTypeBoolFalse:
+		// The value is encoded in the field type
+		return nil
+	case thriftTypeByte:
+		_, err := tr.readByte()
+		return err
+	case thriftTypeI16, thriftTypeI32, thriftTypeI64:
+		_, err := tr.readVarint()
+		return err
+	case thriftTypeDouble:
+		if len(tr.src) < 8 {
+			return fmt.Errorf("unexpected end of thrift data when reading double")
+		}
+		tr.src = tr.src[8:]
+		return nil
+	case thriftTypeBinary:
+		_, err := tr.readBinary()
+		return err
+	case thriftTypeList, thriftTypeSet:
+		elemType, size, err := tr.readListHeader()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < size; i++ {
+			if err := tr.skipElem(elemType); err != nil {
+				return err
+			}
+		}
+		return nil
+	case thriftTypeMap:
+		size, err := tr.readUvarint()
+		if err != nil {
+			return err
+		}
+		if size == 0 {
+			return nil
+		}
+		if size > uint64(len(tr.src)) {
+			return fmt.Errorf("too big map size in thrift data: %d; only %d bytes left", size, len(tr.src))
+		}
+		types, err := tr.readByte()
+		if err != nil {
+			return err
+		}
+		for i := uint64(0); i < size; i++ {
+			if err := tr.skipElem(types >> 4); err != nil {
+				return err
+			}
+			if err := tr.skipElem(types & 0x0f); err != nil {
+				return err
+			}
+		}
+		return nil
+	case thriftTypeStruct:
+		return tr.readStruct(func(_ int16, typ byte) error {
+			return tr.skip(typ)
+		})
+	default:
+		return fmt.Errorf("unexpected thrift type %d", typ)
+	}
+}
+
+// skipElem skips list, set or map element with the given type.
+func (tr *thriftReader) skipElem(typ byte) error {
+	if typ == thriftTypeBoolTrue || typ == thriftTypeBoolFalse {
+		// Bool elements are encoded as a single byte
+		_, err := tr.readByte()
+		return err
+	}
+	return tr.skip(typ)
+}
+
+// readStruct reads struct fields and calls f for every field.
+//
+// f must read or skip the field value.
+func (tr *thriftReader) readStruct(f func(id int16, typ byte) error) error {
+	if err := tr.readStructBegin(); err != nil {
+		return err
+	}
+	for {
+		id, typ, err := tr.readFieldHeader()
+		if err != nil {
+			return err
+		}
+		if typ == thriftTypeStop {
+			break
+		}
+		if err := f(id, typ); err != nil {
+			return err
+		}
+	}
+	tr.readStructEnd()
+	return nil
+}
+
+// readList reads list elements and calls f for every element.
+func (tr *thriftReader) readList(typ byte, f func(elemType byte) error) error {
+	if typ != thriftTypeList && typ != thriftTypeSet {
+		return fmt.Errorf("unexpected thrift type %d; want list", typ)
+	}
+	elemType, size, err := tr.readListHeader()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < size; i++ {
+		if err := f(elemType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tr *thriftReader) readI32Field(typ byte) (int32, error) {
+	if typ != thriftTypeI32 && typ != thriftTypeI16 && typ != thriftTypeByte {
+		return 0, fmt.Errorf("unexpected thrift type %d; want i32", typ)
+	}
+	if typ == thriftTypeByte {
+		b, err := tr.readByte()
+		return int32(int8(b)), err
+	}
+	return tr.readI32()
+}
+
+func (tr *thriftReader) readI64Field(typ byte) (int64, error) {
+	if typ != thriftTypeI64 && typ != thriftTypeI32 && typ != thriftTypeI16 {
+		return 0, fmt.Errorf("unexpected thrift type %d; want i64", typ)
+	}
+	return tr.readVarint()
+}
+
+func (tr *thriftReader) readBinaryField(typ byte) (string, error) {
+	if typ != thriftTypeBinary {
+		return "", fmt.Errorf("unexpected thrift type %d; want binary", typ)
+	}
+	return tr.readBinary()
+}
+
+func (tr *thriftReader) readBoolField(typ byte) (bool, error) {
+	switch typ {
+	case thriftTypeBoolTrue:
+		return true, nil
+	case thriftTypeBoolFalse:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unexpected thrift type %d; want bool", typ)
+	}
+}
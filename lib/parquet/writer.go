@@ -0,0 +1,359 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaLogs/lib/logstorage"
+)
+
+const magic = "PAR1"
+
+const (
+	// maxRowGroupRows is the maximum number of rows per row group.
+	maxRowGroupRows = 1024 * 1024
+
+	// maxRowGroupBytes is the maximum size of the buffered values per row group.
+	maxRowGroupBytes = 64 * 1024 * 1024
+
+	// maxPageBytes is the maximum size of the values per data page.
+	maxPageBytes = 1024 * 1024
+)
+
+// Writer writes logs in Parquet format.
+//
+// Every log field is stored in a separate optional column of BYTE_ARRAY type with STRING logical type,
+// except of _time field, which is stored in INT64 column with TIMESTAMP(NANOS) logical type.
+//
+// Log fields may differ among rows. Missing fields are stored as nulls.
+//
+// Writer isn't safe to use from concurrently running goroutines.
+type Writer struct {
+	w     io.Writer
+	codec Codec
+
+	// maxRowGroupRows is the maximum number of rows per row group.
+	maxRowGroupRows int
+
+	// offset is the number of bytes written to w.
+	offset int64
+
+	// err is the first error occurred when writing to w.
+	err error
+
+	columns       []*columnWriter
+	columnsByName map[string]*columnWriter
+
+	// rows is the number of rows in the current row group.
+	rows int
+
+	// rowsBytes is the size of the buffered values for the current row group.
+	rowsBytes int
+
+	rowGroups []rowGroup
+
+	buf        []byte
+	compressed []byte
+}
+
+// columnWriter buffers values for a single column in the current row group.
+type columnWriter struct {
+	name   string
+	isTime bool
+
+	// firstRowGroup is the index of the first row group containing the column.
+	//
+	// The column must be filled with nulls at the previous row groups.
+	firstRowGroup int
+
+	// defs contains definition levels for the buffered rows. 0 means null, 1 means non-null value.
+	defs []uint32
+
+	// values contains PLAIN-encoded non-null values.
+	values []byte
+
+	// valueEnds contains end offsets for values.
+	valueEnds []int
+}
+
+// NewWriter returns new Writer, which writes logs to w with the given codec.
+//
+// Close must be called when all the logs are written.
+func NewWriter(w io.Writer, codec Codec) *Writer {
+	return &Writer{
+		w:               w,
+		codec:           codec,
+		maxRowGroupRows: maxRowGroupRows,
+		columnsByName:   make(map[string]*columnWriter),
+	}
+}
+
+// WriteRow writes a row with the given fields to pw.
+//
+// Fields with empty values are treated as missing.
+//
+// The fields may be re-used by the caller after returning from WriteRow.
+func (pw *Writer) WriteRow(fields []logstorage.Field) error {
+	if pw.err != nil {
+		return pw.err
+	}
+	for _, f := range fields {
+		if f.Value == "" {
+			continue
+		}
+		cw := pw.getColumnWriter(f.Name)
+		if len(cw.defs) > pw.rows {
+			// Duplicate field name in the row. Keep the first value.
+			continue
+		}
+		cw.padNulls(pw.rows)
+		pw.rowsBytes += cw.addValue(f.Value)
+	}
+	pw.rows++
+	if pw.rows >= pw.maxRowGroupRows || pw.rowsBytes >= maxRowGroupBytes {
+		pw.flushRowGroup()
+	}
+	return pw.err
+}
+
+func (pw *Writer) getColumnWriter(name string) *columnWriter {
+	cw := pw.columnsByName[name]
+	if cw == nil {
+		// Clone the name, since it may refer to a buffer, which is re-used by the caller.
+		cw = &columnWriter{
+			name:          strings.Clone(name),
+			isTime:        name == "_time",
+			firstRowGroup: len(pw.rowGroups),
+		}
+		pw.columns = append(pw.columns, cw)
+		pw.columnsByName[cw.name] = cw
+	}
+	return cw
+}
+
+func (cw *columnWriter) padNulls(rows int) {
+	for len(cw.defs) < rows {
+		cw.defs = append(cw.defs, 0)
+	}
+}
+
+// addValue adds the given value to cw and returns the size of the added value.
+func (cw *columnWriter) addValue(v string) int {
+	n := len(cw.values)
+	if cw.isTime {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			cw.defs = append(cw.defs, 0)
+			return 0
+		}
+		cw.values = binary.LittleEndian.AppendUint64(cw.values, uint64(t.UnixNano()))
+	} else {
+		cw.values = binary.LittleEndian.AppendUint32(cw.values, uint32(len(v)))
+		cw.values = append(cw.values, v...)
+	}
+	cw.defs = append(cw.defs, 1)
+	cw.valueEnds = append(cw.valueEnds, len(cw.values))
+	return len(cw.values) - n
+}
+
+func (cw *columnWriter) physicalType() int32 {
+	if cw.isTime {
+		return typeInt64
+	}
+	return typeByteArray
+}
+
+func (cw *columnWriter) reset() {
+	cw.defs = cw.defs[:0]
+	cw.values = cw.values[:0]
+	cw.valueEnds = cw.valueEnds[:0]
+}
+
+func (pw *Writer) write(data []byte) {
+	if pw.err != nil {
+		return
+	}
+	n, err := pw.w.Write(data)
+	pw.offset += int64(n)
+	if err != nil {
+		pw.err = fmt.Errorf("cannot write Parquet data: %w", err)
+	}
+}
+
+func (pw *Writer) flushRowGroup() {
+	if pw.rows == 0 {
+		return
+	}
+	if pw.offset == 0 {
+		pw.write([]byte(magic))
+	}
+
+	rg := rowGroup{
+		numRows: int64(pw.rows),
+	}
+	for _, cw := range pw.columns {
+		cw.padNulls(pw.rows)
+		cc := pw.writeColumnChunk(cw)
+		rg.columns = append(rg.columns, cc)
+		rg.totalByteSize += cc.metaData.totalUncompressedSize
+		cw.reset()
+	}
+	pw.rowGroups = append(pw.rowGroups, rg)
+	pw.rows = 0
+	pw.rowsBytes = 0
+}
+
+// writeColumnChunk writes buffered values from cw to pw as a sequence of data pages and returns the corresponding column chunk.
+func (pw *Writer) writeColumnChunk(cw *columnWriter) columnChunk {
+	cc := columnChunk{
+		fileOffset: pw.offset,
+		metaData: columnMetaData{
+			typ:            cw.physicalType(),
+			encodings:      []int32{encodingPlain, encodingRLE},
+			pathInSchema:   []string{cw.name},
+			codec:          int32(pw.codec),
+			numValues:      int64(len(cw.defs)),
+			dataPageOffset: pw.offset,
+		},
+	}
+	cmd := &cc.metaData
+
+	defs := cw.defs
+	valueEnds := cw.valueEnds
+	valuesStart := 0
+	for len(defs) > 0 {
+		// Collect rows for the next page
+		rows := 0
+		values := 0
+		for rows < len(defs) {
+			if defs[rows] == 1 {
+				values++
+				if valueEnds[values-1]-valuesStart >= maxPageBytes {
+					rows++
+					break
+				}
+			}
+			rows++
+		}
+		valuesEnd := valuesStart
+		if values > 0 {
+			valuesEnd = valueEnds[values-1]
+		}
+		pw.writeDataPage(cmd, defs[:rows], cw.values[valuesStart:valuesEnd])
+		defs = defs[rows:]
+		valueEnds = valueEnds[values:]
+		valuesStart = valuesEnd
+	}
+	return cc
+}
+
+// writeNullColumnChunk writes a column chunk with the given number of null values for the given cw.
+func (pw *Writer) writeNullColumnChunk(cw *columnWriter, rows int) columnChunk {
+	cc := columnChunk{
+		fileOffset: pw.offset,
+		metaData: columnMetaData{
+			typ:            cw.physicalType(),
+			encodings:      []int32{encodingPlain, encodingRLE},
+			pathInSchema:   []string{cw.name},
+			codec:          int32(pw.codec),
+			numValues:      int64(rows),
+			dataPageOffset: pw.offset,
+		},
+	}
+	defs := make([]uint32, rows)
+	pw.writeDataPage(&cc.metaData, defs, nil)
+	return cc
+}
+
+// writeDataPage writes data page v1 with the given definition levels and PLAIN-encoded values.
+func (pw *Writer) writeDataPage(cmd *columnMetaData, defs []uint32, values []byte) {
+	// Encode definition levels with 4-byte length prefix
+	buf := append(pw.buf[:0], 0, 0, 0, 0)
+	buf = appendRLEBitPackedHybrid(buf, defs, 1)
+	binary.LittleEndian.PutUint32(buf, uint32(len(buf)-4))
+	buf = append(buf, values...)
+	pw.buf = buf
+
+	pw.compressed = pw.codec.compress(pw.compressed[:0], buf)
+
+	ph := pageHeader{
+		typ:                     pageTypeData,
+		uncompressedPageSize:    int32(len(buf)),
+		compressedPageSize:      int32(len(pw.compressed)),
+		numValues:               int32(len(defs)),
+		encoding:                encodingPlain,
+		definitionLevelEncoding: encodingRLE,
+	}
+	var tw thriftWriter
+	ph.marshal(&tw)
+
+	pw.write(tw.buf)
+	pw.write(pw.compressed)
+
+	cmd.totalUncompressedSize += int64(len(tw.buf) + len(buf))
+	cmd.totalCompressedSize += int64(len(tw.buf) + len(pw.compressed))
+}
+
+// Close flushes the buffered rows and writes Parquet footer.
+//
+// It doesn't close the underlying writer.
+func (pw *Writer) Close() error {
+	pw.flushRowGroup()
+	if pw.offset == 0 {
+		pw.write([]byte(magic))
+	}
+
+	// Fill columns missing in the previous row groups with nulls.
+	for i := range pw.rowGroups {
+		rg := &pw.rowGroups[i]
+		for _, cw := range pw.columns {
+			if cw.firstRowGroup > i {
+				cc := pw.writeNullColumnChunk(cw, int(rg.numRows))
+				rg.columns = append(rg.columns, cc)
+				rg.totalByteSize += cc.metaData.totalUncompressedSize
+			}
+		}
+	}
+
+	fmd := fileMetaData{
+		version:   1,
+		rowGroups: pw.rowGroups,
+		createdBy: "VictoriaLogs",
+	}
+	fmd.schema = append(fmd.schema, schemaElement{
+		name:        "schema",
+		numChildren: int32(len(pw.columns)),
+	})
+	for _, cw := range pw.columns {
+		se := schemaElement{
+			typ:            cw.physicalType(),
+			hasType:        true,
+			repetitionType: repetitionOptional,
+			name:           cw.name,
+			hasLogicalType: true,
+		}
+		if cw.isTime {
+			se.logicalType.isTimestamp = true
+			se.logicalType.timeUnit = timeUnitNanos
+		} else {
+			se.convertedType = convertedTypeUTF8
+			se.hasConvertedType = true
+			se.logicalType.isString = true
+		}
+		fmd.schema = append(fmd.schema, se)
+	}
+	for _, rg := range pw.rowGroups {
+		fmd.numRows += rg.numRows
+	}
+
+	var tw thriftWriter
+	fmd.marshal(&tw)
+	tw.buf = binary.LittleEndian.AppendUint32(tw.buf, uint32(len(tw.buf)))
+	tw.buf = append(tw.buf, magic...)
+	pw.write(tw.buf)
+
+	return pw.err
+}